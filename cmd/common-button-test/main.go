@@ -44,14 +44,16 @@ func main() {
 		fmt.Println("  gpio:name:pin[:active-high|active-low][:pull-none|pull-up|pull-down|pull-auto]")
 		fmt.Println()
 		fmt.Println("Event Driver Format:")
-		fmt.Println("  event:name:device:event_type:event_code[:low_value:high_value]")
+		fmt.Println("  event:name:device:event_type:event_code[:low_value:high_value][:exclusive]")
+		fmt.Println("  (for EV_KEY, event_code may be a key name such as KEY_POWER; exclusive")
+		fmt.Println("  grabs the whole device so that other programs do not receive its events)")
 		fmt.Println()
 		fmt.Println("Examples:")
 		fmt.Println("  # Simple GPIO button on pin 16")
 		fmt.Println("  common-button-test gpio:btn1:GPIO16")
 		fmt.Println()
 		fmt.Println("  # Multiple buttons with different drivers")
-		fmt.Println("  common-button-test gpio:btn1:GPIO16:active-low:pull-up event:power:/dev/input/event0:EV_KEY:116")
+		fmt.Println("  common-button-test gpio:btn1:GPIO16:active-low:pull-up event:power:/dev/input/event0:EV_KEY:KEY_POWER")
 		fmt.Println()
 		fmt.Println("  # Event button with custom values")
 		fmt.Println("  common-button-test event:volume_up:/dev/input/event1:EV_KEY:115:0:1")
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -11,6 +16,7 @@ import (
 	"github.com/larsks/airdancer/internal/buttonwatcher"
 	"github.com/larsks/airdancer/internal/config"
 	"github.com/larsks/airdancer/internal/monitor"
+	"github.com/larsks/airdancer/internal/switchcollection"
 	"github.com/larsks/airdancer/internal/ui"
 	"github.com/larsks/airdancer/internal/version"
 	"github.com/spf13/pflag"
@@ -21,6 +27,7 @@ func main() {
 		versionFlag = pflag.Bool("version", false, "Show version and exit")
 		configType  = pflag.String("type", "", "Configuration type: api, ui, monitor, or buttons")
 		configFile  = pflag.String("config", "", "Configuration file to validate")
+		format      = pflag.String("format", "text", "Output format: text or json")
 		helpFlag    = pflag.BoolP("help", "h", false, "Show help")
 	)
 
@@ -48,33 +55,114 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Check if config file exists
-	if _, err := os.Stat(*configFile); os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Error: Configuration file %s does not exist\n", *configFile)
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: Unknown format '%s'. Must be 'text' or 'json'\n\n", *format)
+		usage()
 		os.Exit(1)
 	}
 
-	var err error
+	var validate func(string) []error
 	switch *configType {
 	case "api":
-		err = validateAPIConfig(*configFile)
+		validate = validateAPIConfig
 	case "ui":
-		err = validateUIConfig(*configFile)
+		validate = validateUIConfig
 	case "monitor":
-		err = validateMonitorConfig(*configFile)
+		validate = validateMonitorConfig
 	case "buttons":
-		err = validateButtonsConfig(*configFile)
+		validate = validateButtonsConfig
 	default:
 		fmt.Fprintf(os.Stderr, "Error: Unknown configuration type '%s'. Must be 'api', 'ui', 'monitor', or 'buttons'\n", *configType)
 		os.Exit(1)
 	}
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Validation failed: %v\n", err)
+	var errs []error
+	if _, err := os.Stat(*configFile); os.IsNotExist(err) {
+		errs = []error{fmt.Errorf("configuration file %s does not exist", *configFile)}
+	} else {
+		errs = validate(*configFile)
+	}
+
+	if *format == "json" {
+		if err := writeJSONResult(os.Stdout, *configType, errs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		writeTextResult(os.Stdout, os.Stderr, *configType, *configFile, errs)
+	}
+
+	if len(errs) > 0 {
 		os.Exit(1)
 	}
+}
+
+// validationResult is the output of --format json
+type validationResult struct {
+	Valid  bool     `json:"valid"`
+	Type   string   `json:"type"`
+	Errors []string `json:"errors"`
+}
+
+// writeJSONResult writes the result of validating a configuration file as
+// JSON. errors is an empty list if the file is valid.
+func writeJSONResult(w io.Writer, configType string, errs []error) error {
+	result := validationResult{
+		Valid:  len(errs) == 0,
+		Type:   configType,
+		Errors: make([]string, 0, len(errs)),
+	}
+	for _, err := range errs {
+		result.Errors = append(result.Errors, err.Error())
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// writeTextResult writes the result of validating a configuration file for
+// people: a confirmation to stdout, or the errors to stderr
+func writeTextResult(stdout, stderr io.Writer, configType, configFile string, errs []error) {
+	switch len(errs) {
+	case 0:
+		fmt.Fprintf(stdout, "✓ Configuration file %s is valid for %s\n", configFile, configType)
+	case 1:
+		fmt.Fprintf(stderr, "Validation failed: %v\n", errs[0])
+	default:
+		fmt.Fprintf(stderr, "Validation failed:\n")
+		for _, err := range errs {
+			fmt.Fprintf(stderr, "  - %v\n", err)
+		}
+	}
+}
+
+// errorCollector accumulates validation errors, so that every problem in a
+// configuration file is reported rather than just the first
+type errorCollector struct {
+	errs []error
+}
+
+// add records a validation error
+func (c *errorCollector) add(err error) {
+	c.errs = append(c.errs, err)
+}
+
+// errors returns the errors that have been recorded, or nil if there are
+// none
+func (c *errorCollector) errors() []error {
+	return c.errs
+}
 
-	fmt.Printf("✓ Configuration file %s is valid for %s\n", *configFile, *configType)
+// sortedKeys returns the keys of m in order, so that errors are reported in
+// a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // validateSwitchSpec validates a switch spec format (collection.index)
@@ -110,9 +198,13 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  %s --type ui --config airdancer-ui.toml\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s --type monitor --config airdancer-monitor.toml\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s --type buttons --config airdancer-buttons.toml\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s --type api --config airdancer-api.toml --format json\n", os.Args[0])
 }
 
-func validateAPIConfig(configFile string) error {
+// validateAPIConfig returns the problems found in an API configuration
+// file. Every collection and switch is checked, so that all of their
+// problems are reported at once.
+func validateAPIConfig(configFile string) []error {
 	// Save the original command line flags
 	originalFlags := pflag.CommandLine
 	defer func() { pflag.CommandLine = originalFlags }()
@@ -128,7 +220,7 @@ func validateAPIConfig(configFile string) error {
 
 	// Parse with empty arguments (no command line flags set)
 	if err := pflag.CommandLine.Parse([]string{}); err != nil {
-		return fmt.Errorf("failed to parse flags: %v", err)
+		return []error{fmt.Errorf("failed to parse flags: %v", err)}
 	}
 
 	// Create a config loader with strict mode enabled
@@ -146,29 +238,44 @@ func validateAPIConfig(configFile string) error {
 
 	// Use the config loader directly to get strict validation
 	if err := loader.LoadConfig(cfg); err != nil {
-		return fmt.Errorf("failed to load API configuration: %v", err)
+		return []error{fmt.Errorf("failed to load API configuration: %v", err)}
 	}
 
-	// Validate basic configuration
-	if cfg.ListenPort <= 0 || cfg.ListenPort > 65535 {
-		return fmt.Errorf("listen port must be between 1 and 65535, got %d", cfg.ListenPort)
+	var errs errorCollector
+
+	// Validate basic configuration; port 0 lets the system pick a port
+	if cfg.ListenPort < 0 || cfg.ListenPort > 65535 {
+		errs.add(fmt.Errorf("listen port must be between 0 and 65535, got %d", cfg.ListenPort))
+	}
+	if cfg.LineListen != "" {
+		if _, _, err := net.SplitHostPort(cfg.LineListen); err != nil {
+			errs.add(fmt.Errorf("line-listen must be host:port, got '%s': %v", cfg.LineListen, err))
+		}
+	}
+
+	if cfg.MaxOnSeconds < 0 {
+		errs.add(errors.New("max-on-seconds cannot be negative"))
 	}
 
 	// Validate collections
 	collectionNames := make(map[string]bool)
-	for collectionName, collection := range cfg.Collections {
+	for _, collectionName := range sortedKeys(cfg.Collections) {
+		collection := cfg.Collections[collectionName]
 		if collectionName == "" {
-			return fmt.Errorf("collection name cannot be empty")
+			errs.add(errors.New("collection name cannot be empty"))
+			continue
 		}
 
 		collectionNames[collectionName] = true
 
 		if collection.Driver == "" {
-			return fmt.Errorf("collection %s: driver is required", collectionName)
+			errs.add(fmt.Errorf("collection %s: driver is required", collectionName))
+			continue
 		}
 
 		if collection.Driver != "dummy" && collection.Driver != "piface" && collection.Driver != "gpio" {
-			return fmt.Errorf("collection %s: driver must be 'dummy', 'piface', or 'gpio', got '%s'", collectionName, collection.Driver)
+			errs.add(fmt.Errorf("collection %s: driver must be 'dummy', 'piface', or 'gpio', got '%s'", collectionName, collection.Driver))
+			continue
 		}
 
 		// Driver-specific validation
@@ -177,7 +284,7 @@ func validateAPIConfig(configFile string) error {
 			if driverConfig := collection.DriverConfig; driverConfig != nil {
 				if switchCount, ok := driverConfig["switch_count"]; ok {
 					if count, ok := switchCount.(int); ok && count <= 0 {
-						return fmt.Errorf("collection %s: dummy driver requires switch_count > 0", collectionName)
+						errs.add(fmt.Errorf("collection %s: dummy driver requires switch_count > 0", collectionName))
 					}
 				}
 			}
@@ -185,7 +292,7 @@ func validateAPIConfig(configFile string) error {
 			if driverConfig := collection.DriverConfig; driverConfig != nil {
 				if spidev, ok := driverConfig["spidev"]; ok {
 					if spidevStr, ok := spidev.(string); ok && spidevStr == "" {
-						return fmt.Errorf("collection %s: piface driver requires non-empty spidev", collectionName)
+						errs.add(fmt.Errorf("collection %s: piface driver requires non-empty spidev", collectionName))
 					}
 				}
 			}
@@ -193,7 +300,7 @@ func validateAPIConfig(configFile string) error {
 			if driverConfig := collection.DriverConfig; driverConfig != nil {
 				if pins, ok := driverConfig["pins"]; ok {
 					if pinsList, ok := pins.([]interface{}); ok && len(pinsList) == 0 {
-						return fmt.Errorf("collection %s: gpio driver requires at least one pin", collectionName)
+						errs.add(fmt.Errorf("collection %s: gpio driver requires at least one pin", collectionName))
 					}
 				}
 			}
@@ -202,27 +309,103 @@ func validateAPIConfig(configFile string) error {
 
 	// Validate switches
 	switchNames := make(map[string]bool)
-	for switchName, sw := range cfg.Switches {
+	for _, switchName := range sortedKeys(cfg.Switches) {
+		sw := cfg.Switches[switchName]
+		switchNames[switchName] = true
 		if switchName == "" {
-			return fmt.Errorf("switch name cannot be empty")
+			errs.add(errors.New("switch name cannot be empty"))
+			continue
 		}
 
-		switchNames[switchName] = true
-
-		if sw.Spec == "" {
-			return fmt.Errorf("switch %s: spec is required", switchName)
+		if len(sw.Spec) == 0 {
+			errs.add(fmt.Errorf("switch %s: spec is required", switchName))
+			continue
 		}
 
 		// Validate spec format (collection.index)
-		if err := validateSwitchSpec(sw.Spec, collectionNames); err != nil {
-			return fmt.Errorf("switch %s: %v", switchName, err)
+		for _, spec := range sw.Spec {
+			if err := validateSwitchSpec(spec, collectionNames); err != nil {
+				errs.add(fmt.Errorf("switch %s: %v", switchName, err))
+			}
+		}
+
+		switch sw.StartupState {
+		case "", "off", "on":
+		case "last":
+			if cfg.StateFile == "" {
+				errs.add(fmt.Errorf("switch %s: startup-state last requires state-file", switchName))
+			}
+		default:
+			errs.add(fmt.Errorf("switch %s: startup-state must be off, on, or last, got '%s'", switchName, sw.StartupState))
+		}
+
+		if sw.WatchdogSeconds < 0 {
+			errs.add(fmt.Errorf("switch %s: watchdog-seconds cannot be negative", switchName))
+		}
+		if sw.MinOnSeconds < 0 {
+			errs.add(fmt.Errorf("switch %s: min-on-seconds cannot be negative", switchName))
+		}
+		if sw.MaxOnSeconds != nil && *sw.MaxOnSeconds < 0 {
+			errs.add(fmt.Errorf("switch %s: max-on-seconds cannot be negative", switchName))
+		}
+
+		if sw.StatePolicy != "" {
+			if len(sw.Spec) == 1 {
+				errs.add(fmt.Errorf("switch %s: state-policy is only supported for switches with several specs", switchName))
+			} else if _, err := switchcollection.ParseAggregatePolicy(sw.StatePolicy); err != nil {
+				errs.add(fmt.Errorf("switch %s: %v", switchName, err))
+			}
 		}
 	}
 
-	return nil
+	// Validate groups
+	for _, groupName := range sortedKeys(cfg.Groups) {
+		if groupName == "" {
+			errs.add(errors.New("group name cannot be empty"))
+			continue
+		}
+
+		for _, switchName := range cfg.Groups[groupName].Switches {
+			if !switchNames[switchName] {
+				errs.add(fmt.Errorf("group %s: references unknown switch '%s'", groupName, switchName))
+			}
+		}
+	}
+
+	// Validate schedules
+	for _, scheduleName := range sortedKeys(cfg.Schedules) {
+		sch := cfg.Schedules[scheduleName]
+		if err := sch.Validate(); err != nil {
+			errs.add(fmt.Errorf("schedule %s: %v", scheduleName, err))
+			continue
+		}
+		target := sch.Switch
+		if aliasTarget, isAlias := cfg.Aliases[target]; isAlias {
+			target = aliasTarget
+		}
+		if _, isGroup := cfg.Groups[target]; target != "all" && !switchNames[target] && !isGroup {
+			errs.add(fmt.Errorf("schedule %s: references unknown switch or group '%s'", scheduleName, sch.Switch))
+		}
+	}
+
+	// Validate aliases
+	if err := cfg.ValidateAliases(); err != nil {
+		errs.add(err)
+	}
+
+	// Validate buttons
+	for _, buttonName := range sortedKeys(cfg.Buttons) {
+		button := cfg.Buttons[buttonName]
+		if button.Driver == "" || button.Spec == "" {
+			errs.add(fmt.Errorf("button %s: driver and spec are required", buttonName))
+		}
+	}
+
+	return errs.errors()
 }
 
-func validateUIConfig(configFile string) error {
+// validateUIConfig returns the problems found in a UI configuration file
+func validateUIConfig(configFile string) []error {
 	// Save the original command line flags
 	originalFlags := pflag.CommandLine
 	defer func() { pflag.CommandLine = originalFlags }()
@@ -238,7 +421,7 @@ func validateUIConfig(configFile string) error {
 
 	// Parse with empty arguments (no command line flags set)
 	if err := pflag.CommandLine.Parse([]string{}); err != nil {
-		return fmt.Errorf("failed to parse flags: %v", err)
+		return []error{fmt.Errorf("failed to parse flags: %v", err)}
 	}
 
 	// Create a config loader with strict mode enabled
@@ -255,22 +438,26 @@ func validateUIConfig(configFile string) error {
 
 	// Use the config loader directly to get strict validation
 	if err := loader.LoadConfig(cfg); err != nil {
-		return fmt.Errorf("failed to load UI configuration: %v", err)
+		return []error{fmt.Errorf("failed to load UI configuration: %v", err)}
 	}
 
+	var errs errorCollector
+
 	// Validate required fields and reasonable values
 	if cfg.ListenPort <= 0 || cfg.ListenPort > 65535 {
-		return fmt.Errorf("listen port must be between 1 and 65535, got %d", cfg.ListenPort)
+		errs.add(fmt.Errorf("listen port must be between 1 and 65535, got %d", cfg.ListenPort))
 	}
 
 	if cfg.APIBaseURL == "" {
-		return fmt.Errorf("api_base_url is required")
+		errs.add(errors.New("api_base_url is required"))
 	}
 
-	return nil
+	return errs.errors()
 }
 
-func validateMonitorConfig(configFile string) error {
+// validateMonitorConfig returns the problems found in a monitor
+// configuration file
+func validateMonitorConfig(configFile string) []error {
 	// Save the original command line flags
 	originalFlags := pflag.CommandLine
 	defer func() { pflag.CommandLine = originalFlags }()
@@ -286,84 +473,93 @@ func validateMonitorConfig(configFile string) error {
 
 	// Parse with empty arguments (no command line flags set)
 	if err := pflag.CommandLine.Parse([]string{}); err != nil {
-		return fmt.Errorf("failed to parse flags: %v", err)
+		return []error{fmt.Errorf("failed to parse flags: %v", err)}
 	}
 
 	// Use the monitor config's LoadConfigFromStruct method for proper validation
 	if err := cfg.LoadConfigFromStruct(); err != nil {
-		return fmt.Errorf("failed to load monitor configuration: %v", err)
+		return []error{fmt.Errorf("failed to load monitor configuration: %v", err)}
 	}
 
-	// Use the built-in validation
+	var errs errorCollector
+
+	// Use the built-in validation, which stops at the first problem
 	if err := cfg.Validate(); err != nil {
-		return fmt.Errorf("monitor configuration validation failed: %v", err)
+		errs.add(fmt.Errorf("monitor configuration validation failed: %v", err))
 	}
 
 	// Additional validation for the new multi-mailbox structure
-	if err := validateMonitorStructure(cfg); err != nil {
-		return fmt.Errorf("monitor structure validation failed: %v", err)
+	for _, err := range validateMonitorStructure(cfg) {
+		errs.add(fmt.Errorf("monitor structure validation failed: %v", err))
 	}
 
-	return nil
+	return errs.errors()
 }
 
-// validateMonitorStructure performs additional validation on the monitor configuration structure
-func validateMonitorStructure(cfg *monitor.Config) error {
+// validateMonitorStructure performs additional validation on the monitor
+// configuration structure, returning every problem it finds
+func validateMonitorStructure(cfg *monitor.Config) []error {
+	var errs errorCollector
+
 	// Validate IMAP configuration
 	if cfg.IMAP.Server == "" {
-		return fmt.Errorf("IMAP server is required")
+		errs.add(errors.New("IMAP server is required"))
 	}
 
 	if cfg.IMAP.Port <= 0 || cfg.IMAP.Port > 65535 {
-		return fmt.Errorf("IMAP port must be between 1 and 65535, got %d", cfg.IMAP.Port)
+		errs.add(fmt.Errorf("IMAP port must be between 1 and 65535, got %d", cfg.IMAP.Port))
 	}
 
 	if cfg.IMAP.Username == "" {
-		return fmt.Errorf("IMAP username is required")
+		errs.add(errors.New("IMAP username is required"))
 	}
 
 	if cfg.IMAP.Password == "" {
-		return fmt.Errorf("IMAP password is required")
+		errs.add(errors.New("IMAP password is required"))
 	}
 
 	// Validate global check interval if set
 	if cfg.CheckInterval != nil && *cfg.CheckInterval <= 0 {
-		return fmt.Errorf("global check_interval_seconds must be positive, got %d", *cfg.CheckInterval)
+		errs.add(fmt.Errorf("global check_interval_seconds must be positive, got %d", *cfg.CheckInterval))
 	}
 
 	// Validate each mailbox configuration
 	for i, mailbox := range cfg.Monitor {
 		if mailbox.Mailbox == "" {
-			return fmt.Errorf("mailbox name is required for monitor %d", i)
+			errs.add(fmt.Errorf("mailbox name is required for monitor %d", i))
+			continue
 		}
 
 		// Validate mailbox-specific check interval if set
 		if mailbox.CheckInterval != nil && *mailbox.CheckInterval <= 0 {
-			return fmt.Errorf("check_interval_seconds must be positive for mailbox %s, got %d", mailbox.Mailbox, *mailbox.CheckInterval)
+			errs.add(fmt.Errorf("check_interval_seconds must be positive for mailbox %s, got %d", mailbox.Mailbox, *mailbox.CheckInterval))
 		}
 
 		// Validate that mailbox has at least one trigger
 		if len(mailbox.Triggers) == 0 {
-			return fmt.Errorf("mailbox %s must have at least one trigger", mailbox.Mailbox)
+			errs.add(fmt.Errorf("mailbox %s must have at least one trigger", mailbox.Mailbox))
 		}
 
 		// Validate each trigger
 		for j, trigger := range mailbox.Triggers {
 			if trigger.RegexPattern == "" {
-				return fmt.Errorf("regex_pattern is required for trigger %d in mailbox %s", j, mailbox.Mailbox)
+				errs.add(fmt.Errorf("regex_pattern is required for trigger %d in mailbox %s", j, mailbox.Mailbox))
+				continue
 			}
 
 			// Test if regex pattern is valid
 			if _, err := regexp.Compile(trigger.RegexPattern); err != nil {
-				return fmt.Errorf("invalid regex pattern '%s' in trigger %d of mailbox %s: %v", trigger.RegexPattern, j, mailbox.Mailbox, err)
+				errs.add(fmt.Errorf("invalid regex pattern '%s' in trigger %d of mailbox %s: %v", trigger.RegexPattern, j, mailbox.Mailbox, err))
 			}
 		}
 	}
 
-	return nil
+	return errs.errors()
 }
 
-func validateButtonsConfig(configFile string) error {
+// validateButtonsConfig returns the problems found in a buttons
+// configuration file
+func validateButtonsConfig(configFile string) []error {
 	// Save the original command line flags
 	originalFlags := pflag.CommandLine
 	defer func() { pflag.CommandLine = originalFlags }()
@@ -379,17 +575,17 @@ func validateButtonsConfig(configFile string) error {
 
 	// Parse with empty arguments (no command line flags set)
 	if err := pflag.CommandLine.Parse([]string{}); err != nil {
-		return fmt.Errorf("failed to parse flags: %v", err)
+		return []error{fmt.Errorf("failed to parse flags: %v", err)}
 	}
 
 	// Load configuration
 	if err := cfg.LoadConfig(); err != nil {
-		return fmt.Errorf("failed to load buttons configuration: %v", err)
+		return []error{fmt.Errorf("failed to load buttons configuration: %v", err)}
 	}
 
 	// Use the built-in validation
 	if err := cfg.Validate(); err != nil {
-		return fmt.Errorf("buttons configuration validation failed: %v", err)
+		return []error{fmt.Errorf("buttons configuration validation failed: %v", err)}
 	}
 
 	return nil
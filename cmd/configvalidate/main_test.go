@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/larsks/airdancer/internal/monitor"
+)
+
+const badAPIConfig = `
+listen-port = 8080
+
+[collections.panel]
+driver = 'dummy'
+
+[collections.relays]
+driver = 'nonesuch'
+
+[switches.lamp]
+spec = "panel.0"
+
+[switches.fan]
+spec = "attic.1"
+
+[switches.heater]
+spec = "panel.x"
+
+[switches.pump]
+`
+
+func TestValidateAPIConfigJSON(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "airdancer-api.toml")
+	if err := os.WriteFile(configFile, []byte(badAPIConfig), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSONResult(&buf, "api", validateAPIConfig(configFile)); err != nil {
+		t.Fatalf("writeJSONResult() failed: %v", err)
+	}
+
+	var result map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("Output is not JSON: %v\n%s", err, buf.String())
+	}
+
+	want := map[string]any{
+		"valid": false,
+		"type":  "api",
+		"errors": []any{
+			"collection relays: driver must be 'dummy', 'piface', or 'gpio', got 'nonesuch'",
+			"switch fan: references unknown collection 'attic'",
+			"switch heater: invalid switch index 'x' (must be a non-negative integer)",
+			"switch pump: spec is required",
+		},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("Output = %v, want %v", result, want)
+	}
+}
+
+func TestWriteJSONResultValid(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJSONResult(&buf, "ui", nil); err != nil {
+		t.Fatalf("writeJSONResult() failed: %v", err)
+	}
+
+	var result map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("Output is not JSON: %v\n%s", err, buf.String())
+	}
+
+	want := map[string]any{"valid": true, "type": "ui", "errors": []any{}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("Output = %v, want %v", result, want)
+	}
+}
+
+func TestValidateAPIConfigReportsAllErrors(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "airdancer-api.toml")
+	config := `
+listen-port = 70000
+
+[collections.panel]
+driver = 'dummy'
+
+[collections.relays]
+
+[switches.lamp]
+spec = "panel.0"
+
+[switches.fan]
+spec = "panel"
+
+[groups.lights]
+switches = ["lamp", "porch", "garage"]
+
+[schedules.evening]
+switch = "lights"
+type = "window"
+start = "18:00"
+end = "7pm"
+
+[schedules.party]
+switch = "porch"
+type = "once"
+at = "2025-01-01T20:00"
+
+[aliases]
+porch-light = "porch"
+`
+	if err := os.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	want := []string{
+		"listen port must be between 0 and 65535, got 70000",
+		"collection relays: driver is required",
+		"switch fan: invalid spec format 'panel' (expected format: collection.index)",
+		"group lights: references unknown switch 'porch'",
+		"group lights: references unknown switch 'garage'",
+		"schedule evening: invalid schedule: end must be HH:MM, got '7pm'",
+		"schedule party: references unknown switch or group 'porch'",
+		"invalid alias: alias porch-light refers to unknown switch or group 'porch'",
+	}
+	if got := errorStrings(validateAPIConfig(configFile)); !reflect.DeepEqual(got, want) {
+		t.Errorf("validateAPIConfig() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateMonitorStructureReportsAllErrors(t *testing.T) {
+	interval := 0
+	cfg := monitor.NewConfig()
+	cfg.IMAP.Server = "imap.example.com"
+	cfg.IMAP.Username = "user"
+	cfg.Monitor = []monitor.MailboxConfig{
+		{
+			Mailbox:       "INBOX",
+			CheckInterval: &interval,
+			Triggers: []monitor.TriggerConfig{
+				{RegexPattern: "ok"},
+				{RegexPattern: "("},
+				{Subject: "alert"},
+			},
+		},
+		{Mailbox: "Alerts"},
+	}
+
+	want := []string{
+		"IMAP password is required",
+		"check_interval_seconds must be positive for mailbox INBOX, got 0",
+		"invalid regex pattern '(' in trigger 1 of mailbox INBOX: error parsing regexp: missing closing ): `(`",
+		"regex_pattern is required for trigger 2 in mailbox INBOX",
+		"mailbox Alerts must have at least one trigger",
+	}
+	if got := errorStrings(validateMonitorStructure(cfg)); !reflect.DeepEqual(got, want) {
+		t.Errorf("validateMonitorStructure() = %q, want %q", got, want)
+	}
+}
+
+// errorStrings returns the messages of errs
+func errorStrings(errs []error) []string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return messages
+}
@@ -3,11 +3,15 @@ package main
 import (
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/larsks/airdancer/internal/pfbridge"
 	"github.com/larsks/airdancer/internal/piface"
 	"github.com/larsks/airdancer/internal/version"
 	"github.com/spf13/pflag"
@@ -18,8 +22,17 @@ var (
 	spiDevice   = pflag.String("spi-device", "/dev/spidev0.0", "SPI device path")
 	helpFlag    = pflag.BoolP("help", "h", false, "Show help")
 	duration    = pflag.Duration("duration", 0, "Duration to run blink command (0 = run indefinitely)")
+	serverURL   = pflag.String("server-url", defaultServerURL(), "API server URL (for reflect with mappings)")
+	debounce    = pflag.Duration("debounce", 50*time.Millisecond, "Input debounce delay (for reflect with mappings)")
 )
 
+func defaultServerURL() string {
+	if url := os.Getenv("DANCER_SERVER_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:8080"
+}
+
 func usage() {
 	fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] COMMAND [ARGS...]\n\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "A command line tool for controlling PiFace Digital I/O boards.\n\n")
@@ -29,6 +42,7 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  read outputs    Read current output pin states\n")
 	fmt.Fprintf(os.Stderr, "  write pin:value Set output pins to specified values\n")
 	fmt.Fprintf(os.Stderr, "  reflect         Continuously mirror input pins to output pins\n")
+	fmt.Fprintf(os.Stderr, "  reflect pin:target[:mode] Send input changes to airdancer API switches or groups\n")
 	fmt.Fprintf(os.Stderr, "  blink pin:period[:dutycycle] Blink output pins with specified period and duty cycle\n\n")
 
 	fmt.Fprintf(os.Stderr, "Options:\n")
@@ -40,12 +54,16 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  %s write 0:1 1:0 2:1        # Set pin 0 on, pin 1 off, pin 2 on\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s write 0:on 1:off         # Alternative syntax with on/off\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s reflect                  # Mirror inputs to outputs continuously\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s reflect 0:lamp1 1:group1:follow # Input 0 toggles lamp1, input 1 drives group1\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s blink 0:1s 1:500ms:0.3   # Blink pin 0 every 1s, pin 1 every 500ms at 30%% duty cycle\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s --duration 10s blink 0:2s # Blink pin 0 every 2s for 10 seconds\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s --spi-device /dev/spidev0.1 read inputs  # Use alternative SPI device\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "\nPin values for write command:\n")
 	fmt.Fprintf(os.Stderr, "  on, 1, true     Turn pin on\n")
 	fmt.Fprintf(os.Stderr, "  off, 0, false   Turn pin off\n")
+	fmt.Fprintf(os.Stderr, "\nModes for reflect mappings:\n")
+	fmt.Fprintf(os.Stderr, "  toggle          Toggle the target each time the input is pressed (default)\n")
+	fmt.Fprintf(os.Stderr, "  follow          Turn the target on while the input is active, off when released\n")
 }
 
 func main() {
@@ -161,7 +179,7 @@ func handleWriteCommand(pf *piface.PiFace, args []string) error {
 
 func handleReflectCommand(pf *piface.PiFace, args []string) error {
 	if len(args) > 0 {
-		return fmt.Errorf("reflect command does not accept arguments")
+		return handleReflectToAPI(pf, args)
 	}
 
 	fmt.Println("Starting input-to-output reflection. Press Ctrl+C to stop.")
@@ -192,6 +210,34 @@ func handleReflectCommand(pf *piface.PiFace, args []string) error {
 	}
 }
 
+func handleReflectToAPI(pf *piface.PiFace, args []string) error {
+	var mappings []pfbridge.Mapping
+	for _, arg := range args {
+		mapping, err := pfbridge.ParseMapping(arg)
+		if err != nil {
+			return fmt.Errorf("invalid reflect argument '%s': %v", arg, err)
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	bridge, err := pfbridge.NewBridge(pf, &http.Client{Timeout: 5 * time.Second}, *serverURL, mappings, *debounce)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Sending input changes to %s. Press Ctrl+C to stop.\n", *serverURL)
+
+	stop := make(chan struct{})
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		close(stop)
+	}()
+
+	return bridge.Run(stop, 10*time.Millisecond)
+}
+
 func readInputs(pf *piface.PiFace) error {
 	inputs, err := pf.ReadInputs()
 	if err != nil {
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ValidateAliases checks that every alias in c names a configured switch or
+// group, and that no alias is itself the name of a switch or group (or
+// "all").
+func (c *Config) ValidateAliases() error {
+	for _, alias := range slices.Sorted(maps.Keys(c.Aliases)) {
+		target := c.Aliases[alias]
+		_, isSwitch := c.Switches[alias]
+		_, isGroup := c.Groups[alias]
+		switch {
+		case alias == "":
+			return fmt.Errorf("%w: alias name cannot be empty", ErrInvalidAlias)
+		case alias == "all" || isSwitch || isGroup:
+			return fmt.Errorf("%w: %s is the name of a switch or group", ErrInvalidAlias, alias)
+		}
+
+		_, isSwitch = c.Switches[target]
+		_, isGroup = c.Groups[target]
+		if !isSwitch && !isGroup {
+			return fmt.Errorf("%w: alias %s refers to unknown switch or group '%s'", ErrInvalidAlias, alias, target)
+		}
+	}
+	return nil
+}
+
+// aliasesOf returns the aliases of the switch or group name, sorted
+func (s *Server) aliasesOf(name string) []string {
+	var aliases []string
+	for alias, target := range s.aliases {
+		if target == name {
+			aliases = append(aliases, alias)
+		}
+	}
+	slices.Sort(aliases)
+	return aliases
+}
+
+// canonicalName returns the name of the switch or group that the alias
+// name refers to, or name itself if it is not an alias
+func (s *Server) canonicalName(name string) string {
+	if target, ok := s.aliases[name]; ok {
+		return target
+	}
+	return name
+}
+
+// resolveAlias replaces an alias in the name URL parameter with the name of
+// the switch or group it refers to, so that later middleware and handlers
+// only see canonical names.
+func (s *Server) resolveAlias(r *http.Request) {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return
+	}
+	for i, key := range rctx.URLParams.Keys {
+		if key != "name" {
+			continue
+		}
+		rctx.URLParams.Values[i] = s.canonicalName(rctx.URLParams.Values[i])
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/larsks/airdancer/internal/buttondriver"
+	"github.com/larsks/airdancer/internal/buttondriver/common"
+)
+
+// ButtonConfig configures a button whose presses and releases are
+// published on the event stream. Driver and Spec are the same as for
+// airdancer-buttons.
+type ButtonConfig struct {
+	Driver string `mapstructure:"driver"`
+	Spec   string `mapstructure:"spec"`
+}
+
+// buttonEvent is sent to event stream clients when a configured button is
+// pressed or released
+type buttonEvent struct {
+	Button string `json:"button"`
+	Type   string `json:"type"`
+}
+
+// createButtonDrivers creates a driver for each driver type used by
+// buttons and adds the buttons to it
+func createButtonDrivers(buttons map[string]ButtonConfig) (map[string]common.ButtonDriver, error) {
+	drivers := make(map[string]common.ButtonDriver)
+	for buttonName, buttonCfg := range buttons {
+		if buttonCfg.Driver == "" || buttonCfg.Spec == "" {
+			return nil, fmt.Errorf("%w %s: driver and spec are required", ErrInvalidButton, buttonName)
+		}
+
+		driver, exists := drivers[buttonCfg.Driver]
+		if !exists {
+			var err error
+			driver, err = buttondriver.CreateDriver(buttonCfg.Driver, map[string]interface{}{})
+			if err != nil {
+				return nil, fmt.Errorf("%w %s: %w", ErrInvalidButton, buttonName, err)
+			}
+			drivers[buttonCfg.Driver] = driver
+		}
+
+		spec, err := buttondriver.ParseButtonSpec(buttonCfg.Driver, buttonName+":"+buttonCfg.Spec)
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: %w", ErrInvalidButton, buttonName, err)
+		}
+		if err := driver.AddButton(spec); err != nil {
+			return nil, fmt.Errorf("%w %s: %w", ErrInvalidButton, buttonName, err)
+		}
+	}
+	return drivers, nil
+}
+
+// startButtons starts the button drivers and publishes their events on the
+// event stream until the drivers are stopped
+func (s *Server) startButtons() error {
+	for driverType, driver := range s.buttonDrivers {
+		if err := driver.Start(); err != nil {
+			return fmt.Errorf("failed to start %s button driver: %w", driverType, err)
+		}
+		log.Printf("started %s button driver for %s", driverType, strings.Join(driver.GetButtons(), ", "))
+
+		go func() {
+			for event := range driver.Events() {
+				s.publishButtonEvent(event)
+			}
+		}()
+	}
+	return nil
+}
+
+// stopButtons stops the button drivers
+func (s *Server) stopButtons() {
+	for _, driver := range s.buttonDrivers {
+		driver.Stop()
+	}
+}
+
+// publishButtonEvent publishes a button event to event stream clients
+func (s *Server) publishButtonEvent(event common.ButtonEvent) {
+	s.events.publish(streamEvent{
+		name: "button",
+		data: buttonEvent{Button: event.Source, Type: strings.ToLower(event.Type.String())},
+	})
+}
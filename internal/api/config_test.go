@@ -49,7 +49,25 @@ func TestConfigAddFlags(t *testing.T) {
 	expectedFlags := []string{
 		"config",
 		"listen-address",
+		"listen-addresses",
 		"listen-port",
+		"listen-socket",
+		"tls-cert-file",
+		"tls-key-file",
+		"tls-reload",
+		"shutdown-timeout",
+		"off-on-shutdown",
+		"read-only",
+		"default-period",
+		"default-duty-cycle",
+		"max-on-seconds",
+		"base-path",
+		"state-file",
+		"strict",
+		"max-body-bytes",
+		"line-listen",
+		"api-key",
+		"check",
 	}
 
 	for _, flagName := range expectedFlags {
@@ -202,7 +220,7 @@ func TestEmbeddedConfigContent(t *testing.T) {
 	switch1, exists := config.Switches["switch1"]
 	if !exists {
 		t.Error("Expected to find switch1 in switches")
-	} else if switch1.Spec != "dummy-collection.0" {
+	} else if switch1.Spec.String() != "dummy-collection.0" {
 		t.Errorf("Expected switch1 spec to be 'dummy-collection.0', got %s", switch1.Spec)
 	}
 
@@ -238,3 +256,20 @@ func TestEmbeddedConfigContent(t *testing.T) {
 	t.Logf("Embedded test TOML config size: %d bytes", len(testConfigTOML))
 	t.Logf("Embedded invalid TOML config size: %d bytes", len(invalidConfigTOML))
 }
+
+func TestConfigGetBasePath(t *testing.T) {
+	tests := map[string]string{
+		"":            "",
+		"/":           "",
+		"airdancer":   "/airdancer",
+		"/airdancer/": "/airdancer",
+		" /a/b ":      "/a/b",
+	}
+
+	for basePath, want := range tests {
+		config := Config{BasePath: basePath}
+		if got := config.GetBasePath(); got != want {
+			t.Errorf("GetBasePath() with %q = %q, want %q", basePath, got, want)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/larsks/airdancer/internal/config"
+)
+
+// configHandler returns the configuration the server was started with, with
+// secrets redacted as by --config-dump
+func (s *Server) configHandler(w http.ResponseWriter, r *http.Request) {
+	s.sendSuccess(w, config.Redact(s.config))
+}
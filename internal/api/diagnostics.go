@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/larsks/airdancer/internal/switchcollection"
+)
+
+// switchTestStep is the outcome of one step of a switch test. Latency is in
+// seconds.
+type switchTestStep struct {
+	Step    string      `json:"step"`
+	Success bool        `json:"success"`
+	State   switchState `json:"state,omitempty"`
+	Latency float64     `json:"latency"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// switchTestResponse reports the steps of a switch test. RoundTrip is the
+// time, in seconds, taken to reach the device of switches that can be probed
+// individually, such as the switches of HTTP drivers. Skipped, if set, is
+// why the switch was not turned on and off.
+type switchTestResponse struct {
+	Switch    string           `json:"switch"`
+	Success   bool             `json:"success"`
+	RoundTrip *float64         `json:"roundTrip,omitempty"`
+	Skipped   string           `json:"skipped,omitempty"`
+	Steps     []switchTestStep `json:"steps"`
+}
+
+// runTestStep runs fn as the step called name and adds its outcome to
+// report. If want is not empty, the step fails unless fn reports that
+// state.
+func (report *switchTestResponse) runTestStep(name string, want switchState, fn func() (switchState, error)) {
+	start := time.Now()
+	state, err := fn()
+	step := switchTestStep{
+		Step:    name,
+		State:   state,
+		Latency: time.Since(start).Seconds(),
+	}
+	switch {
+	case err != nil:
+		step.Error = err.Error()
+	case want != "" && state != want:
+		step.Error = fmt.Sprintf("switch is %s, want %s", state, want)
+	default:
+		step.Success = true
+	}
+	report.Success = report.Success && step.Success
+	report.Steps = append(report.Steps, step)
+}
+
+// testSwitch exercises the driver of a switch: it reads the state of the
+// switch, turns it on, reads it, turns it off, and reads it again, then
+// turns it back on if it was on to begin with. Switches that can be probed
+// individually are probed first. Every step runs even if an earlier one
+// fails, so that the switch is left off (or in its original state) whenever
+// possible. The switch is turned on and off in the same way as by a POST
+// /switch/{name} request, so events are published, watchdogs are armed and
+// disarmed, and states are saved. A switch with a minimum on time is only
+// read, since it could not be turned off again at once. The caller must
+// hold s.mutex.
+func (s *Server) testSwitch(ctx context.Context, switchName string, sw switchcollection.Switch) switchTestResponse {
+	report := switchTestResponse{Switch: switchName, Success: true}
+
+	if checker, ok := sw.(switchcollection.HealthChecker); ok {
+		report.runTestStep("ping", "", func() (switchState, error) {
+			return "", checker.HealthCheck(ctx)
+		})
+		roundTrip := report.Steps[0].Latency
+		report.RoundTrip = &roundTrip
+	}
+
+	readState := func() (switchState, error) {
+		on, err := sw.GetState()
+		if err != nil {
+			return "", err
+		}
+		if on {
+			return switchStateOn, nil
+		}
+		return switchStateOff, nil
+	}
+	turn := func(state switchState) func() (switchState, error) {
+		return func() (switchState, error) {
+			return state, s.handleSwitchHelper(nil, &switchRequest{State: state}, switchName, sw)
+		}
+	}
+
+	report.runTestStep("read", "", readState)
+	if resolvedSwitch, exists := s.switches[switchName]; exists && resolvedSwitch.MinOn > 0 {
+		report.Skipped = fmt.Sprintf("switch has a minimum on time of %s", resolvedSwitch.MinOn)
+		return report
+	}
+	original := report.Steps[len(report.Steps)-1].State
+	report.runTestStep("on", "", turn(switchStateOn))
+	report.runTestStep("read", switchStateOn, readState)
+	report.runTestStep("off", "", turn(switchStateOff))
+	report.runTestStep("read", switchStateOff, readState)
+	if original == switchStateOn {
+		report.runTestStep("restore", "", turn(switchStateOn))
+	}
+
+	return report
+}
+
+// switchTestHandler runs a test of a single switch, stopping anything that
+// is running on it first, and reports the outcome of each step. It responds
+// with 503 and the report if any step fails.
+func (s *Server) switchTestHandler(w http.ResponseWriter, r *http.Request) {
+	switchName := chi.URLParam(r, "name")
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	resolvedSwitch, exists := s.switches[switchName]
+	if !exists {
+		s.sendErrorCode(w, fmt.Sprintf("test is only supported for individual switches, not %s", switchName), http.StatusBadRequest, errorCodeInvalidRequest, map[string]any{"switch": switchName})
+		return
+	}
+
+	if resolvedSwitch.Switch.IsDisabled() {
+		s.sendSwitchDisabled(w, switchName)
+		return
+	}
+
+	log.Printf("testing switch %s", switchName)
+	s.cancelTasksAndTimers(switchName)
+	report := s.testSwitch(ctx, switchName, resolvedSwitch.Switch)
+
+	if !report.Success {
+		s.sendResponse(w, APIResponse{
+			Status:  "error",
+			Message: fmt.Sprintf("test of switch %s failed", switchName),
+			Data:    report,
+		}, http.StatusServiceUnavailable)
+		return
+	}
+	s.sendSuccess(w, report)
+}
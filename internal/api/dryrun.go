@@ -0,0 +1,32 @@
+package api
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// dryRunQueryParam, set to true on a switch request, validates the request
+// and reports what it would do without changing any switch
+const dryRunQueryParam = "dry_run"
+
+// dryRunResponse is the response to a dry-run switch request: the request
+// as it would be carried out (with defaults filled in), and the switches
+// it would change
+type dryRunResponse struct {
+	switchRequest
+	DryRun   bool     `json:"dryRun"`
+	Switches []string `json:"switches"`
+}
+
+// sendDryRun reports that req would be applied to the switches that are
+// not disabled, in name order
+func (s *Server) sendDryRun(w http.ResponseWriter, req switchRequest, switches map[string]*ResolvedSwitch) {
+	names := []string{}
+	for _, switchName := range slices.Sorted(maps.Keys(switches)) {
+		if !switches[switchName].Switch.IsDisabled() {
+			names = append(names, switchName)
+		}
+	}
+	s.sendSuccess(w, dryRunResponse{switchRequest: req, DryRun: true, Switches: names})
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+	useFakeClock(server)
+
+	if w := serve(server, "POST", "/switch/switch2", `{"state": "blink", "period": 1}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/switch2: status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		body         string
+		wantStatus   int
+		wantSwitches []string
+	}{
+		{"switch", "/switch/switch0?dry_run=true", `{"state": "on", "duration": 10}`, http.StatusOK, []string{"switch0"}},
+		{"all", "/switch/all?dry_run=1", `{"state": "off"}`, http.StatusOK, []string{"switch0", "switch1", "switch2", "switch3"}},
+		{"group blink", "/switch/red?dry_run=true", `{"state": "blink", "period": 1}`, http.StatusOK, []string{"switch0", "switch1"}},
+		{"group flipflop", "/switch/green?dry_run=true", `{"state": "flipflop", "period": 1}`, http.StatusOK, []string{"switch2", "switch3"}},
+		{"invalid request", "/switch/switch0?dry_run=true", `{"state": "blink"}`, http.StatusBadRequest, nil},
+		{"unknown switch", "/switch/porch?dry_run=true", `{"state": "on"}`, http.StatusNotFound, nil},
+		{"invalid dry_run", "/switch/switch0?dry_run=maybe", `{"state": "on"}`, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(server, "POST", tt.path, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Data dryRunResponse `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !resp.Data.DryRun || !reflect.DeepEqual(resp.Data.Switches, tt.wantSwitches) {
+				t.Errorf("response = %+v, want a dry run on %v", resp.Data, tt.wantSwitches)
+			}
+		})
+	}
+
+	// None of the dry runs changed a switch or stopped the running blink
+	for _, switchName := range []string{"switch0", "switch1", "switch3"} {
+		if on, _ := server.switches[switchName].Switch.GetState(); on {
+			t.Errorf("dry run turned on %s", switchName)
+		}
+	}
+	if len(server.timers) != 0 || len(server.flipflops) != 0 {
+		t.Errorf("dry run started tasks: timers = %v, flipflops = %v", server.timers, server.flipflops)
+	}
+	if blinker, exists := server.blinkers["switch2"]; len(server.blinkers) != 1 || !exists || !blinker.IsRunning() {
+		t.Errorf("dry run changed the running blinks: %v", server.blinkers)
+	}
+}
@@ -10,12 +10,31 @@ var (
 	ErrDriverInitFailed = errors.New("failed to initialize driver")
 )
 
+// Configuration errors
+var (
+	ErrInvalidDefaultPeriod       = errors.New("default-period cannot be negative")
+	ErrInvalidDefaultDutyCycle    = errors.New("default-duty-cycle must be between 0 and 1")
+	ErrInvalidStartupState        = errors.New("startup-state must be off, on, or last")
+	ErrStartupStateNeedsStateFile = errors.New("startup-state last requires state-file")
+	ErrInvalidButton              = errors.New("invalid button")
+	ErrInvalidWatchdog            = errors.New("watchdog-seconds cannot be negative")
+	ErrInvalidMinOn               = errors.New("min-on-seconds cannot be negative")
+	ErrInvalidMaxOn               = errors.New("max-on-seconds cannot be negative")
+	ErrInvalidSchedule            = errors.New("invalid schedule")
+	ErrInvalidAlias               = errors.New("invalid alias")
+)
+
 // Switch initialization errors
 var (
-	ErrSwitchInitFailed = errors.New("failed to initialize switches")
+	ErrSwitchInitFailed  = errors.New("failed to initialize switches")
+	ErrSwitchUnavailable = errors.New("switch is no longer provided by its collection")
 )
 
 // Server operation errors
 var (
 	ErrServerShutdownFailed = errors.New("server shutdown failed")
+	ErrListenConflict       = errors.New("listen-socket and listen-address cannot both be set")
+	ErrNotASocket           = errors.New("listen socket path exists and is not a socket")
+	ErrShutdownTimeout      = errors.New("timed out stopping running tasks")
+	ErrStartupCheckFailed   = errors.New("startup check failed")
 )
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventKeepaliveInterval is how often a comment is written to idle event
+// streams, so that proxies do not time out the connection.
+const eventKeepaliveInterval = 30 * time.Second
+
+// eventBufferSize is the number of events queued for each stream. Events
+// for clients that fall further behind are dropped.
+const eventBufferSize = 16
+
+// switchEvent is sent to event stream clients whenever a switch or group
+// changes state. Event has the same values as the MQTT switch events.
+type switchEvent struct {
+	Switch string `json:"switch"`
+	Event  string `json:"event"`
+}
+
+// streamEvent is an event sent to event stream clients: name is the type of
+// the event ("switch" or "button"), and data is encoded as JSON.
+type streamEvent struct {
+	name string
+	data any
+}
+
+// eventBroker fans events out to event stream clients.
+type eventBroker struct {
+	mutex       sync.Mutex
+	subscribers map[chan streamEvent]struct{}
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{
+		subscribers: make(map[chan streamEvent]struct{}),
+	}
+}
+
+// subscribe returns a channel that receives every event published until
+// unsubscribe is called with it.
+func (b *eventBroker) subscribe() chan streamEvent {
+	ch := make(chan streamEvent, eventBufferSize)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (b *eventBroker) unsubscribe(ch chan streamEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.subscribers, ch)
+}
+
+// publish sends event to every subscriber without blocking. A subscriber
+// whose buffer is full misses the event.
+func (b *eventBroker) publish(event streamEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// eventsHandler streams switch and button events to the client as
+// server-sent events until the client disconnects.
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+
+	events := s.events.subscribe()
+	defer s.events.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Printf("Event stream does not support flushing: %v", err)
+		return
+	}
+
+	keepalive := time.NewTicker(eventKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case event := <-events:
+			data, err := json.Marshal(event.data)
+			if err != nil {
+				log.Printf("Failed to encode %s event: %v", event.name, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// groupRequest is the body of a request to create or update a group, and
+// the data in the response
+type groupRequest struct {
+	Switches []string `json:"switches"`
+}
+
+// groupExists returns true if name is a group
+func (s *Server) groupExists(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, exists := s.groups[name]
+	return exists
+}
+
+// groupUpdateHandler creates a group, or replaces the switches in a group
+// that was created through the API. Groups defined in the configuration
+// file cannot be changed.
+func (s *Server) groupUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	groupName := chi.URLParam(r, "name")
+
+	var req groupRequest
+	if !s.decodeJSONBody(w, r, &req, false) {
+		return
+	}
+	if len(req.Switches) == 0 {
+		s.sendInvalidField(w, "A group must contain at least one switch", "switches")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if groupName == "all" || s.switches[groupName] != nil {
+		s.sendErrorCode(w, fmt.Sprintf("%s is the name of a switch", groupName), http.StatusConflict, errorCodeNameConflict, map[string]any{"group": groupName})
+		return
+	}
+	if _, isAlias := s.aliases[groupName]; isAlias {
+		s.sendErrorCode(w, fmt.Sprintf("%s is an alias", groupName), http.StatusConflict, errorCodeNameConflict, map[string]any{"group": groupName})
+		return
+	}
+	if _, exists := s.groups[groupName]; exists && s.runtimeGroups[groupName] == nil {
+		s.sendErrorCode(w, fmt.Sprintf("Group %s is defined in the configuration file and cannot be changed", groupName), http.StatusConflict, errorCodeNameConflict, map[string]any{"group": groupName})
+		return
+	}
+
+	members := make(map[string]*ResolvedSwitch, len(req.Switches))
+	for _, switchName := range req.Switches {
+		resolvedSwitch, exists := s.switches[switchName]
+		if !exists {
+			s.sendErrorCode(w, fmt.Sprintf("Unknown switch name: %s", switchName), http.StatusBadRequest, errorCodeSwitchNotFound, map[string]any{"switch": switchName})
+			return
+		}
+		members[switchName] = resolvedSwitch
+	}
+
+	switchNames := make([]string, 0, len(members))
+	for switchName := range members {
+		switchNames = append(switchNames, switchName)
+	}
+	sort.Strings(switchNames)
+
+	runtimeGroups := make(map[string][]string, len(s.runtimeGroups)+1)
+	for name, switches := range s.runtimeGroups {
+		runtimeGroups[name] = switches
+	}
+	runtimeGroups[groupName] = switchNames
+	if err := s.saveGroups(runtimeGroups); err != nil {
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Effects running on the old group refer to its old switches
+	s.cancelSwitchTasks(groupName)
+	s.runtimeGroups = runtimeGroups
+	s.groups[groupName] = NewSwitchGroup(groupName, members)
+	log.Printf("group %s now has switches %v", groupName, switchNames)
+
+	s.sendSuccess(w, groupRequest{Switches: switchNames})
+}
+
+// groupDeleteHandler deletes a group that was created through the API
+func (s *Server) groupDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	groupName := chi.URLParam(r, "name")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.groups[groupName]; !exists {
+		s.sendErrorCode(w, fmt.Sprintf("Group %s not found", groupName), http.StatusNotFound, errorCodeGroupNotFound, map[string]any{"group": groupName})
+		return
+	}
+	if s.runtimeGroups[groupName] == nil {
+		s.sendErrorCode(w, fmt.Sprintf("Group %s is defined in the configuration file and cannot be deleted", groupName), http.StatusConflict, errorCodeNameConflict, map[string]any{"group": groupName})
+		return
+	}
+
+	runtimeGroups := make(map[string][]string, len(s.runtimeGroups))
+	for name, switches := range s.runtimeGroups {
+		if name != groupName {
+			runtimeGroups[name] = switches
+		}
+	}
+	if err := s.saveGroups(runtimeGroups); err != nil {
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.cancelSwitchTasks(groupName)
+	s.runtimeGroups = runtimeGroups
+	delete(s.groups, groupName)
+	log.Printf("deleted group %s", groupName)
+
+	s.sendSuccess(w, nil)
+}
+
+// saveGroups writes the groups created through the API to the state file,
+// if one is configured
+func (s *Server) saveGroups(groups map[string][]string) error {
+	if s.stateFile == "" {
+		return nil
+	}
+
+	if err := s.writeState(serverState{Groups: groups, Switches: s.switchStates}); err != nil {
+		return fmt.Errorf("failed to save groups: %w", err)
+	}
+	return nil
+}
+
+// restoreGroups adds the groups saved in the state file. Saved groups whose
+// name is now used by a switch, a configured group, or an alias, or that refer to
+// switches that no longer exist, are dropped. The caller must hold s.mutex.
+func (s *Server) restoreGroups(savedGroups map[string][]string) {
+groups:
+	for groupName, switchNames := range savedGroups {
+		if _, exists := s.groups[groupName]; exists || s.switches[groupName] != nil || s.aliases[groupName] != "" {
+			log.Printf("Warning: ignoring saved group %s: the name is already in use", groupName)
+			continue
+		}
+
+		members := make(map[string]*ResolvedSwitch, len(switchNames))
+		for _, switchName := range switchNames {
+			resolvedSwitch, exists := s.switches[switchName]
+			if !exists {
+				log.Printf("Warning: ignoring saved group %s: unknown switch %s", groupName, switchName)
+				continue groups
+			}
+			members[switchName] = resolvedSwitch
+		}
+
+		s.runtimeGroups[groupName] = switchNames
+		s.groups[groupName] = NewSwitchGroup(groupName, members)
+	}
+}
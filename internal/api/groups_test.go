@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// serve sends a request to the server's router and returns the response
+func serve(server *Server, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	return w
+}
+
+// readGroupState returns the groups saved in a state file
+func readGroupState(t *testing.T, stateFile string) map[string][]string {
+	t.Helper()
+
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	var state serverState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("Failed to parse state file %s: %v", data, err)
+	}
+	return state.Groups
+}
+
+func TestGroupCreateUpdateDelete(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+	server.stateFile = filepath.Join(t.TempDir(), "state.json")
+
+	// Create a group and turn it on
+	if w := serve(server, "POST", "/group/stage", `{"switches": ["switch2", "switch0"]}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /group/stage status = %v, want %v: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if w := serve(server, "POST", "/switch/stage", `{"state": "on"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/stage status = %v, want %v: %s", w.Code, http.StatusOK, w.Body)
+	}
+	for switchName, want := range map[string]bool{"switch0": true, "switch1": false, "switch2": true} {
+		if state, _ := server.switches[switchName].Switch.GetState(); state != want {
+			t.Errorf("%s state = %v after turning on the group, want %v", switchName, state, want)
+		}
+	}
+
+	if got, want := readGroupState(t, server.stateFile), map[string][]string{"stage": {"switch0", "switch2"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Saved groups = %v, want %v", got, want)
+	}
+
+	// Update it
+	if w := serve(server, "POST", "/group/stage", `{"switches": ["switch1"]}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /group/stage status = %v, want %v: %s", w.Code, http.StatusOK, w.Body)
+	}
+	w := serve(server, "GET", "/switch/stage", "")
+	var status struct {
+		Data multiSwitchResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode group status: %v", err)
+	}
+	if _, ok := status.Data.Switches["switch1"]; !ok || status.Data.Count != 1 {
+		t.Errorf("Group status after update = %+v, want only switch1", status.Data)
+	}
+
+	// A new server loads the saved group
+	restarted := createTestServerWithGroups(t, 4)
+	defer restarted.Close()
+	restarted.stateFile = server.stateFile
+	if err := restarted.loadState(); err != nil {
+		t.Fatalf("loadState() failed: %v", err)
+	}
+	if w := serve(restarted, "GET", "/switch/stage", ""); w.Code != http.StatusOK {
+		t.Errorf("GET /switch/stage after restart status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	// Delete it
+	if w := serve(server, "DELETE", "/group/stage", ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE /group/stage status = %v, want %v: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if w := serve(server, "GET", "/switch/stage", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /switch/stage after delete status = %v, want %v", w.Code, http.StatusNotFound)
+	}
+	if got := readGroupState(t, server.stateFile); len(got) != 0 {
+		t.Errorf("Saved groups after delete = %v, want none", got)
+	}
+}
+
+func TestGroupUpdateErrors(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"unknown switch", "POST", "/group/stage", `{"switches": ["switch0", "nope"]}`, http.StatusBadRequest},
+		{"no switches", "POST", "/group/stage", `{"switches": []}`, http.StatusBadRequest},
+		{"name of a switch", "POST", "/group/switch0", `{"switches": ["switch1"]}`, http.StatusConflict},
+		{"configured group", "POST", "/group/red", `{"switches": ["switch3"]}`, http.StatusConflict},
+		{"delete configured group", "DELETE", "/group/red", "", http.StatusConflict},
+		{"delete missing group", "DELETE", "/group/stage", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(server, tt.method, tt.path, tt.body); w.Code != tt.want {
+				t.Errorf("%s %s status = %v, want %v: %s", tt.method, tt.path, w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	if _, exists := server.groups["stage"]; exists {
+		t.Errorf("Failed requests created group stage")
+	}
+
+	server.readOnly = true
+	if w := serve(server, "POST", "/group/stage", `{"switches": ["switch0"]}`); w.Code != http.StatusForbidden {
+		t.Errorf("POST /group/stage on a read-only server status = %v, want %v", w.Code, http.StatusForbidden)
+	}
+}
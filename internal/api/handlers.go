@@ -1,20 +1,48 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
+	"math"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/larsks/airdancer/internal/blink"
 	"github.com/larsks/airdancer/internal/flipflop"
 	"github.com/larsks/airdancer/internal/switchcollection"
+	"github.com/larsks/airdancer/internal/version"
 )
 
 type switchState string
 
+// Blink pattern used by the identify endpoint: short, rapid flashes that
+// are easy to tell apart from an ordinary blink.
+const (
+	identifyPeriod    = 0.2
+	identifyDutyCycle = 0.25
+	identifyDuration  = 3
+)
+
+// defaultDutyCycle is the duty cycle for blink and flipflop requests that
+// do not specify one, unless default-duty-cycle is configured.
+const defaultDutyCycle = 0.5
+
+// defaultMaxBodyBytes is the largest request body accepted, unless
+// max-body-bytes is configured.
+const defaultMaxBodyBytes = 1 << 20
+
+// maxConcurrentStateReads limits the number of switches whose state is read
+// in parallel when building a status snapshot.
+const maxConcurrentStateReads = 8
+
 const (
 	switchStateOn       switchState = "on"
 	switchStateOff      switchState = "off"
@@ -30,18 +58,57 @@ type (
 		Duration  *int        `json:"duration,omitempty"`
 		Period    *float64    `json:"period,omitempty"`
 		DutyCycle *float64    `json:"dutyCycle,omitempty"`
+		// Phase offsets the start of a blink or flipflop within its period
+		Phase *float64 `json:"phase,omitempty"`
+		// Jitter randomizes each interval of a blink or flipflop by up to
+		// this fraction of its length
+		Jitter *float64 `json:"jitter,omitempty"`
+		// Stagger, for a blink of all switches, runs the blink of each
+		// switch (in name order) this many seconds behind the previous
+		// one, so that they do not blink together
+		Stagger *float64 `json:"stagger,omitempty"`
+		// RestoreOnStop returns switches to the state they were in before a
+		// blink or flipflop started when its duration expires, rather than
+		// turning them off.
+		RestoreOnStop bool `json:"restoreOnStop,omitempty"`
+		// Transactional, for a group, applies the request only if every
+		// switch in the group can be controlled, rather than to as many
+		// of them as possible
+		Transactional bool `json:"transactional,omitempty"`
+
+		// dryRun is set by the dry_run query parameter
+		dryRun bool
 	}
 
 	switchResponse struct {
 		switchRequest
 		CurrentState bool `json:"currentState"`
+		// Collection and Tags describe where the switch is configured
+		Collection string   `json:"collection,omitempty"`
+		Tags       []string `json:"tags,omitempty"`
+		// Aliases are other names for the switch in request paths
+		Aliases []string `json:"aliases,omitempty"`
+		// Label is the name the switch is given in its driver
+		// configuration, such as a PiFace output name
+		Label string `json:"label,omitempty"`
+		// Capabilities lists the operations the switch supports
+		Capabilities switchcollection.Capabilities `json:"capabilities"`
+		// PreviousState and ChangedAt describe the last change of state
+		// the server saw. PreviousState is omitted if the server has not
+		// seen the switch in another state.
+		PreviousState switchState `json:"previousState,omitempty"`
+		ChangedAt     *time.Time  `json:"changedAt,omitempty"`
 	}
 
-	// Single response type that handles all cases
+	// Single response type that handles all cases. Error responses may
+	// carry a Code, which clients can check instead of parsing Message,
+	// and Details such as the name of the offending field.
 	APIResponse struct {
-		Status  string `json:"status"`
-		Message string `json:"message,omitempty"`
-		Data    any    `json:"data,omitempty"`
+		Status  string         `json:"status"`
+		Message string         `json:"message,omitempty"`
+		Code    errorCode      `json:"code,omitempty"`
+		Details map[string]any `json:"details,omitempty"`
+		Data    any            `json:"data,omitempty"`
 	}
 
 	multiSwitchResponse struct {
@@ -50,15 +117,45 @@ type (
 		Count    uint                       `json:"count"`
 		Switches map[string]*switchResponse `json:"switches"`
 		Groups   map[string]*groupResponse  `json:"groups,omitempty"`
+		Aliases  []string                   `json:"aliases,omitempty"`
 	}
 
 	groupResponse struct {
 		Switches []string    `json:"switches"`
 		Summary  bool        `json:"summary"`
 		State    switchState `json:"state"`
+		Aliases  []string    `json:"aliases,omitempty"`
 	}
 )
 
+// phase returns the requested phase offset, or 0 if none was given
+func (req *switchRequest) phase() float64 {
+	if req.Phase == nil {
+		return 0
+	}
+	return *req.Phase
+}
+
+// staggered returns a copy of req for the index'th switch of a staggered
+// blink, whose phase puts it index*Stagger seconds behind the first switch
+func (req *switchRequest) staggered(index int) *switchRequest {
+	phase := math.Mod(req.phase()-float64(index)*(*req.Stagger)/(*req.Period), 1)
+	if phase < 0 {
+		phase++
+	}
+	staggered := *req
+	staggered.Phase = &phase
+	return &staggered
+}
+
+// jitter returns the requested jitter, or 0 if none was given
+func (req *switchRequest) jitter() float64 {
+	if req.Jitter == nil {
+		return 0
+	}
+	return *req.Jitter
+}
+
 // Helper methods for responses
 func (s *Server) sendSuccess(w http.ResponseWriter, data any) {
 	s.sendResponse(w, APIResponse{Status: "ok", Data: data}, http.StatusOK)
@@ -68,6 +165,36 @@ func (s *Server) sendError(w http.ResponseWriter, message string, code int) {
 	s.sendResponse(w, APIResponse{Status: "error", Message: message}, code)
 }
 
+// sendErrorCode sends an error response with a machine-readable code and,
+// if details is not nil, details about the error
+func (s *Server) sendErrorCode(w http.ResponseWriter, message string, httpCode int, code errorCode, details map[string]any) {
+	s.sendResponse(w, APIResponse{Status: "error", Message: message, Code: code, Details: details}, httpCode)
+}
+
+// sendSwitchDisabled reports that a switch cannot be controlled because it
+// is disabled
+func (s *Server) sendSwitchDisabled(w http.ResponseWriter, switchName string) {
+	s.sendErrorCode(w, fmt.Sprintf("switch %s is disabled due to network connectivity issues", switchName), http.StatusBadRequest, errorCodeSwitchDisabled, map[string]any{"switch": switchName})
+}
+
+// errorCode identifies the kind of an error response
+type errorCode string
+
+const (
+	errorCodeSwitchNotFound     errorCode = "switch_not_found"
+	errorCodeGroupNotFound      errorCode = "group_not_found"
+	errorCodeSwitchDisabled     errorCode = "switch_disabled"
+	errorCodeInvalidState       errorCode = "invalid_state"
+	errorCodeInvalidRequest     errorCode = "invalid_request"
+	errorCodeNameConflict       errorCode = "name_conflict"
+	errorCodeReadOnly           errorCode = "read_only"
+	errorCodeMaintenance        errorCode = "maintenance_mode"
+	errorCodeBodyTooLarge       errorCode = "body_too_large"
+	errorCodeOperationNotFound  errorCode = "operation_not_found"
+	errorCodeTransactionAborted errorCode = "transaction_aborted"
+	errorCodeUnauthorized       errorCode = "unauthorized"
+)
+
 func (s *Server) sendResponse(w http.ResponseWriter, resp APIResponse, code int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
@@ -79,8 +206,8 @@ func (s *Server) switchHandler(w http.ResponseWriter, r *http.Request) {
 
 	if switchName == "all" {
 		s.handleAllSwitches(w, r)
-	} else if group, exists := s.groups[switchName]; exists {
-		s.handleGroupSwitch(w, r, switchName, group)
+	} else if s.groupExists(switchName) {
+		s.handleGroupSwitch(w, r, switchName)
 	} else {
 		s.handleSingleSwitch(w, r, switchName)
 	}
@@ -91,6 +218,9 @@ func (s *Server) handleSwitchHelper(_ http.ResponseWriter, req *switchRequest, s
 	if sw.IsDisabled() {
 		return fmt.Errorf("switch %s is disabled due to network connectivity issues", swid)
 	}
+	if req.dryRun {
+		return nil
+	}
 
 	// Cancel any existing timer for this switch
 	if timer, ok := s.timers[swid]; ok {
@@ -121,18 +251,35 @@ func (s *Server) handleSwitchHelper(_ http.ResponseWriter, req *switchRequest, s
 		delete(s.flipflops, swid)
 	}
 
+	// State to restore when the duration expires (only set if
+	// req.RestoreOnStop is true)
+	var previousStates map[string]bool
+
 	// Execute switch operation
 	switch req.State {
 	case switchStateOn:
+		wasOn := s.minOnTracked(swid, sw)
 		if err := sw.TurnOn(); err != nil {
 			return fmt.Errorf("failed to turn on switch %s: %w", swid, err)
 		}
-		s.publishMQTTSwitchEvent(swid, "on")
+		if !wasOn {
+			s.onSince[swid] = s.clock.Now()
+		}
+		s.publishSwitchEvent(swid, "on")
+		s.recordSwitchStates(swid)
+		s.armWatchdog(swid)
 	case switchStateOff:
+		if wait := s.minOnRemaining(swid); wait > 0 {
+			s.deferTurnOff(swid, sw, wait)
+			return nil
+		}
 		if err := sw.TurnOff(); err != nil {
 			return fmt.Errorf("failed to turn off switch %s: %w", sw, err)
 		}
-		s.publishMQTTSwitchEvent(swid, "off")
+		delete(s.onSince, swid)
+		s.publishSwitchEvent(swid, "off")
+		s.recordSwitchStates(swid)
+		s.disarmWatchdog(swid)
 	case switchStateToggle:
 		var err error
 		var state bool
@@ -143,39 +290,61 @@ func (s *Server) handleSwitchHelper(_ http.ResponseWriter, req *switchRequest, s
 		}
 
 		if state {
+			if wait := s.minOnRemaining(swid); wait > 0 {
+				s.deferTurnOff(swid, sw, wait)
+				return nil
+			}
 			err = sw.TurnOff()
 			if err == nil {
-				s.publishMQTTSwitchEvent(swid, "off")
+				delete(s.onSince, swid)
+				s.publishSwitchEvent(swid, "off")
+				s.disarmWatchdog(swid)
 			}
 		} else {
 			err = sw.TurnOn()
 			if err == nil {
-				s.publishMQTTSwitchEvent(swid, "on")
+				s.onSince[swid] = s.clock.Now()
+				s.publishSwitchEvent(swid, "on")
+				s.armWatchdog(swid)
 			}
 		}
 
 		if err != nil {
 			return fmt.Errorf("failed to toggle switch %s: %w", sw, err)
 		}
+		s.recordSwitchStates(swid)
 
 		// no duration when using "toggle"
 		return nil
 	case switchStateBlink:
-		dutyCycle := 0.5
+		dutyCycle := s.defaultDutyCycle
 		if req.DutyCycle != nil {
 			dutyCycle = *req.DutyCycle
 		}
 
-		newBlinker, err := blink.NewBlink(sw, *req.Period, dutyCycle)
+		if req.RestoreOnStop {
+			state, err := sw.GetState()
+			if err != nil {
+				return fmt.Errorf("failed to get switch state for switch %s: %w", swid, err)
+			}
+			previousStates = map[string]bool{swid: state}
+		}
+
+		newBlinker, err := blink.NewBlink(sw, *req.Period, dutyCycle, req.phase())
 		if err != nil {
 			return fmt.Errorf("failed to create blinker for %s: %w", swid, err)
 		}
+		if err := newBlinker.SetJitter(req.jitter()); err != nil {
+			return fmt.Errorf("failed to create blinker for %s: %w", swid, err)
+		}
+		newBlinker.SetClock(s.clock)
 		s.blinkers[swid] = newBlinker
 		log.Printf("start blinker on %s", swid)
 		if err := newBlinker.Start(); err != nil {
 			return fmt.Errorf("failed to start blinker for %s: %w", swid, err)
 		}
-		s.publishMQTTSwitchEvent(swid, "blink")
+		s.publishSwitchEvent(swid, "blink")
+		s.armWatchdog(swid)
 	case switchStateFlipflop:
 		return fmt.Errorf("flipflop state is only supported for switch groups, not individual switches")
 	}
@@ -184,26 +353,37 @@ func (s *Server) handleSwitchHelper(_ http.ResponseWriter, req *switchRequest, s
 	if req.Duration != nil {
 		duration := time.Duration(*req.Duration) * time.Second
 		log.Printf("start timer on %s for %v", swid, duration)
+		stop := func() {
+			// Stop any running blinker for this switch
+			if blinker, ok := s.blinkers[swid]; ok {
+				if err := blinker.Stop(); err != nil {
+					log.Printf("timer failed to stop blinker on switch %s: %v", swid, err)
+				}
+				delete(s.blinkers, swid)
+			}
+
+			if previousStates != nil {
+				s.restoreSwitchStates(map[string]switchcollection.Switch{swid: sw}, previousStates)
+			} else if wait := s.minOnRemaining(swid); wait > 0 {
+				s.deferTurnOff(swid, sw, wait)
+				return
+			} else if err := sw.TurnOff(); err != nil {
+				log.Printf("timer failed to turn off switch %s: %v", swid, err)
+			} else {
+				delete(s.onSince, swid)
+				s.publishSwitchEvent(swid, "off")
+			}
+			s.recordSwitchStates(swid)
+		}
 		s.timers[swid] = &timerData{
 			duration: duration,
-			timer: time.AfterFunc(duration, func() {
+			expires:  s.clock.Now().Add(duration),
+			stop:     stop,
+			timer: s.clock.AfterFunc(duration, func() {
 				s.mutex.Lock()
 				defer s.mutex.Unlock()
 				delete(s.timers, swid)
-
-				// Stop any running blinker for this switch
-				if blinker, ok := s.blinkers[swid]; ok {
-					if err := blinker.Stop(); err != nil {
-						log.Printf("timer failed to stop blinker on switch %s: %v", swid, err)
-					}
-					delete(s.blinkers, swid)
-				}
-
-				if err := sw.TurnOff(); err != nil {
-					log.Printf("timer failed to turn off switch %s: %v", swid, err)
-				} else {
-					s.publishMQTTSwitchEvent(swid, "off")
-				}
+				stop()
 				log.Printf("timer expired for switch %s after %s", swid, duration)
 			}),
 		}
@@ -212,20 +392,15 @@ func (s *Server) handleSwitchHelper(_ http.ResponseWriter, req *switchRequest, s
 	return nil
 }
 
-func (s *Server) handleAllSwitches(w http.ResponseWriter, r *http.Request) {
-	req, _ := r.Context().Value(switchRequestKey).(switchRequest)
-
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	// Cancel any existing timers for all switches
+// cancelAllTasksAndTimers stops every running timer, blinker, and flipflop.
+// The caller must hold s.mutex.
+func (s *Server) cancelAllTasksAndTimers() {
 	for swid, timer := range s.timers {
 		log.Printf("canceling timer on %s", swid)
 		timer.timer.Stop()
 		delete(s.timers, swid)
 	}
 
-	// Cancel any existing blinker for all switches
 	for swid, blinker := range s.blinkers {
 		log.Printf("canceling blinker on %s", swid)
 		if err := blinker.Stop(); err != nil {
@@ -234,7 +409,6 @@ func (s *Server) handleAllSwitches(w http.ResponseWriter, r *http.Request) {
 		delete(s.blinkers, swid)
 	}
 
-	// Cancel any existing flipflop for all switches
 	for swid, flipflopInstance := range s.flipflops {
 		log.Printf("canceling flipflop on %s", swid)
 		if err := flipflopInstance.Stop(); err != nil {
@@ -242,24 +416,80 @@ func (s *Server) handleAllSwitches(w http.ResponseWriter, r *http.Request) {
 		}
 		delete(s.flipflops, swid)
 	}
+}
+
+// cancelTasksAndTimers stops the timer, blinker, and flipflop running on
+// name (a switch or group), if any. The caller must hold s.mutex.
+func (s *Server) cancelTasksAndTimers(name string) {
+	if timer, ok := s.timers[name]; ok {
+		log.Printf("canceling timer on %s", name)
+		timer.timer.Stop()
+		delete(s.timers, name)
+	}
+
+	if blinker, ok := s.blinkers[name]; ok {
+		if blinker.IsRunning() {
+			log.Printf("canceling blinker on %s", name)
+			if err := blinker.Stop(); err != nil {
+				log.Printf("failed to stop blinker on %s: %v", name, err)
+			}
+		}
+		delete(s.blinkers, name)
+	}
+
+	if flipflopInstance, ok := s.flipflops[name]; ok {
+		if flipflopInstance.IsRunning() {
+			log.Printf("canceling flipflop on %s", name)
+			if err := flipflopInstance.Stop(); err != nil {
+				log.Printf("failed to stop flipflop on %s: %v", name, err)
+			}
+		}
+		delete(s.flipflops, name)
+	}
+}
+
+func (s *Server) handleAllSwitches(w http.ResponseWriter, r *http.Request) {
+	req, _ := r.Context().Value(switchRequestKey).(switchRequest)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !req.dryRun {
+		s.cancelAllTasksAndTimers()
+	}
 
-	// Apply operation to all defined switches
+	// Apply operation to all defined switches, in name order so that
+	// staggered blinks are predictable. Skipped switches do not take up a
+	// stagger slot.
 	var errors []error
-	for switchName, resolvedSwitch := range s.switches {
+	var switchNames []string
+	scheduled := 0
+	for _, switchName := range slices.Sorted(maps.Keys(s.switches)) {
+		resolvedSwitch := s.switches[switchName]
 		// Skip disabled switches
 		if resolvedSwitch.Switch.IsDisabled() {
 			continue
 		}
-		if err := s.handleSwitchHelper(w, &req, switchName, resolvedSwitch.Switch); err != nil {
+		switchReq := &req
+		if req.Stagger != nil {
+			switchReq = req.staggered(scheduled)
+		}
+		scheduled++
+		if err := s.handleSwitchHelper(w, switchReq, switchName, resolvedSwitch.Switch); err != nil {
 			errors = append(errors, fmt.Errorf("switch %s: %w", switchName, err))
 		}
+		switchNames = append(switchNames, switchName)
 	}
 
 	if len(errors) > 0 {
 		s.sendError(w, fmt.Sprintf("errors applying to all switches: %v", errors), http.StatusBadRequest)
 		return
 	}
-	s.sendSuccess(w, req)
+	if req.dryRun {
+		s.sendDryRun(w, req, s.switches)
+		return
+	}
+	s.sendOperation(w, "all", req, switchNames)
 }
 
 func (s *Server) handleSingleSwitch(w http.ResponseWriter, r *http.Request, switchName string) {
@@ -270,7 +500,7 @@ func (s *Server) handleSingleSwitch(w http.ResponseWriter, r *http.Request, swit
 	defer s.mutex.Unlock()
 
 	// Cancel any "all switches" operations that might be running
-	if blinker, ok := s.blinkers["all"]; ok {
+	if blinker, ok := s.blinkers["all"]; ok && !req.dryRun {
 		if blinker.IsRunning() {
 			log.Printf("canceling blinker on all switches")
 			if err := blinker.Stop(); err != nil {
@@ -281,7 +511,7 @@ func (s *Server) handleSingleSwitch(w http.ResponseWriter, r *http.Request, swit
 		}
 	}
 
-	if timer, ok := s.timers["all"]; ok {
+	if timer, ok := s.timers["all"]; ok && !req.dryRun {
 		log.Printf("canceling timer on all switches")
 		timer.timer.Stop()
 		// Turn off all defined switches when canceling "all" timer
@@ -295,7 +525,11 @@ func (s *Server) handleSingleSwitch(w http.ResponseWriter, r *http.Request, swit
 
 	resolvedSwitch, exists := s.switches[switchName]
 	if !exists {
-		s.sendError(w, fmt.Sprintf("Switch %s not found", switchName), http.StatusNotFound)
+		s.sendErrorCode(w, fmt.Sprintf("Switch %s not found", switchName), http.StatusNotFound, errorCodeSwitchNotFound, map[string]any{"switch": switchName})
+		return
+	}
+	if resolvedSwitch.Switch.IsDisabled() {
+		s.sendSwitchDisabled(w, switchName)
 		return
 	}
 
@@ -303,17 +537,216 @@ func (s *Server) handleSingleSwitch(w http.ResponseWriter, r *http.Request, swit
 		s.sendError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	s.sendSuccess(w, req)
+	if req.dryRun {
+		s.sendDryRun(w, req, map[string]*ResolvedSwitch{switchName: resolvedSwitch})
+		return
+	}
+	s.sendOperation(w, switchName, req, []string{switchName})
 }
 
-func (s *Server) handleGroupSwitch(w http.ResponseWriter, r *http.Request, groupName string, group *SwitchGroup) {
+// identifyHandler briefly blinks a single switch with a distinctive pattern
+// so that it can be located physically, then restores its previous state.
+// It returns as soon as the blink has started.
+func (s *Server) identifyHandler(w http.ResponseWriter, r *http.Request) {
+	switchName := chi.URLParam(r, "name")
+
+	resolvedSwitch, exists := s.switches[switchName]
+	if !exists {
+		s.sendErrorCode(w, fmt.Sprintf("identify is only supported for individual switches, not %s", switchName), http.StatusBadRequest, errorCodeInvalidRequest, map[string]any{"switch": switchName})
+		return
+	}
+
+	period := identifyPeriod
+	dutyCycle := identifyDutyCycle
+	duration := identifyDuration
+	req := switchRequest{
+		State:         switchStateBlink,
+		Period:        &period,
+		DutyCycle:     &dutyCycle,
+		Duration:      &duration,
+		RestoreOnStop: true,
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if resolvedSwitch.Switch.IsDisabled() {
+		s.sendSwitchDisabled(w, switchName)
+		return
+	}
+
+	log.Printf("identifying switch %s", switchName)
+	if err := s.handleSwitchHelper(w, &req, switchName, resolvedSwitch.Switch); err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.sendOperation(w, switchName, req, []string{switchName})
+}
+
+// checkHandler probes the device behind a single switch and reports the
+// switch's status. Switches that cannot be probed individually are checked
+// by probing their collection. It responds with 503 if the device cannot
+// be reached.
+func (s *Server) checkHandler(w http.ResponseWriter, r *http.Request) {
+	switchName := chi.URLParam(r, "name")
+
+	// The devices to probe are found with s.mutex held, since the
+	// switches can be replaced when their collection changes, but are
+	// probed without it
+	s.mutex.Lock()
+	resolvedSwitch, exists := s.switches[switchName]
+	var probes []switchProbe
+	if exists {
+		probes = switchProbes(resolvedSwitch)
+	}
+	s.mutex.Unlock()
+
+	if !exists {
+		s.sendError(w, fmt.Sprintf("check is only supported for individual switches, not %s", switchName), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	checkErr := runSwitchProbes(ctx, probes)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	response, err := s.getStatusForSwitch(switchName, resolvedSwitch.Switch)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to get status for switch %s: %v", switchName, err), http.StatusBadRequest)
+		return
+	}
+
+	if checkErr != nil {
+		s.sendResponse(w, APIResponse{
+			Status:  "error",
+			Message: fmt.Sprintf("switch %s is not reachable: %v", switchName, checkErr),
+			Data:    response,
+		}, http.StatusServiceUnavailable)
+		return
+	}
+	s.sendSuccess(w, response)
+}
+
+// checkGroupMembers returns the reason, if any, that each switch in group
+// cannot be controlled: because it is disabled or because its device cannot
+// be reached. The caller must hold s.mutex.
+func checkGroupMembers(ctx context.Context, group *SwitchGroup) map[string]string {
+	failures := make(map[string]string)
+	for switchName, resolvedSwitch := range group.GetSwitches() {
+		if resolvedSwitch.Switch.IsDisabled() {
+			failures[switchName] = "switch is disabled"
+			continue
+		}
+		if err := runSwitchProbes(ctx, switchProbes(resolvedSwitch)); err != nil {
+			failures[switchName] = err.Error()
+		}
+	}
+	return failures
+}
+
+// switchProbe is a device to probe when checking a switch: the switch
+// itself, if it can be probed individually, or else its collection. member
+// names the member of an aggregate switch that the device belongs to.
+type switchProbe struct {
+	member     string
+	sw         switchcollection.Switch
+	collection switchcollection.SwitchCollection
+}
+
+// switchProbes returns the devices to probe to check a switch: the device
+// behind the switch, or the devices behind each member of an aggregate
+// switch. The caller must hold s.mutex.
+func switchProbes(resolvedSwitch *ResolvedSwitch) []switchProbe {
+	if len(resolvedSwitch.Members) == 0 {
+		return []switchProbe{{sw: resolvedSwitch.Switch, collection: resolvedSwitch.Collection}}
+	}
+
+	var probes []switchProbe
+	for _, member := range resolvedSwitch.Members {
+		for _, probe := range switchProbes(member) {
+			if probe.member == "" {
+				probe.member = member.Switch.String()
+			}
+			probes = append(probes, probe)
+		}
+	}
+	return probes
+}
+
+// runSwitchProbes probes each device in probes, and returns the errors of
+// those that cannot be reached
+func runSwitchProbes(ctx context.Context, probes []switchProbe) error {
+	var errs []error
+	for _, probe := range probes {
+		var err error
+		if checker, ok := probe.sw.(switchcollection.HealthChecker); ok {
+			err = checker.HealthCheck(ctx)
+		} else {
+			err = probe.collection.HealthCheck(ctx)
+		}
+		if err == nil {
+			continue
+		}
+		if probe.member != "" {
+			err = fmt.Errorf("%s: %w", probe.member, err)
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) handleGroupSwitch(w http.ResponseWriter, r *http.Request, groupName string) {
 	req, _ := r.Context().Value(switchRequestKey).(switchRequest)
 
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	// The group may have been deleted since the request was validated
+	group, exists := s.groups[groupName]
+	if !exists {
+		s.sendErrorCode(w, fmt.Sprintf("Switch or group %s not found", groupName), http.StatusNotFound, errorCodeSwitchNotFound, map[string]any{"switch": groupName})
+		return
+	}
+
+	// Check that a transactional request can be applied to every switch
+	// before changing any of them, and remember their states so that they
+	// can be restored if applying it fails anyway
+	var transactionStates map[string]bool
+	if req.Transactional {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		failures := checkGroupMembers(ctx, group)
+		if len(failures) == 0 {
+			var err error
+			if transactionStates, err = getSwitchStates(group.GetSwitches()); err != nil {
+				failures[groupName] = err.Error()
+			}
+		}
+		if len(failures) > 0 {
+			log.Printf("aborting transactional %s on group %s: %v", req.State, groupName, failures)
+			s.sendErrorCode(w, fmt.Sprintf("Transactional request on group %s aborted: not every switch in the group can be controlled", groupName), http.StatusConflict, errorCodeTransactionAborted,
+				map[string]any{"group": groupName, "switches": failures})
+			return
+		}
+	}
+
 	// Handle flipflop specially since it operates on the group as a whole
 	if req.State == switchStateFlipflop {
+		// Reject degenerate flipflops before touching any running effects
+		if count := len(group.GetSwitches()); count < 2 {
+			s.sendError(w, fmt.Sprintf("flipflop requires at least two switches, but group %s has %d", groupName, count), http.StatusBadRequest)
+			return
+		}
+		if req.dryRun {
+			s.sendDryRun(w, req, group.GetSwitches())
+			return
+		}
+
 		// Cancel any existing timer for this group
 		if timer, ok := s.timers[groupName]; ok {
 			log.Printf("canceling timer on group %s", groupName)
@@ -351,53 +784,82 @@ func (s *Server) handleGroupSwitch(w http.ResponseWriter, r *http.Request, group
 			switches = append(switches, resolvedSwitch.Switch)
 		}
 
-		dutyCycle := 0.5
+		dutyCycle := s.defaultDutyCycle
 		if req.DutyCycle != nil {
 			dutyCycle = *req.DutyCycle
 		}
 
-		newFlipflop, err := flipflop.NewFlipflop(switches, *req.Period, dutyCycle)
+		var previousStates map[string]bool
+		if req.RestoreOnStop {
+			var err error
+			if previousStates, err = getSwitchStates(group.GetSwitches()); err != nil {
+				s.sendError(w, fmt.Sprintf("failed to get state for group %s: %v", groupName, err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		newFlipflop, err := flipflop.NewFlipflop(switches, *req.Period, dutyCycle, req.phase())
 		if err != nil {
 			s.sendError(w, fmt.Sprintf("failed to create flipflop for group %s: %v", groupName, err), http.StatusBadRequest)
 			return
 		}
 
+		if err := newFlipflop.SetJitter(req.jitter()); err != nil {
+			s.sendError(w, fmt.Sprintf("failed to create flipflop for group %s: %v", groupName, err), http.StatusBadRequest)
+			return
+		}
+		newFlipflop.SetClock(s.clock)
 		s.flipflops[groupName] = newFlipflop
 		log.Printf("start flipflop on group %s", groupName)
 		if err := newFlipflop.Start(); err != nil {
 			s.sendError(w, fmt.Sprintf("failed to start flipflop for group %s: %v", groupName, err), http.StatusBadRequest)
 			return
 		}
-		s.publishMQTTSwitchEvent(groupName, "flipflop")
+		s.publishSwitchEvent(groupName, "flipflop")
+		for switchName := range group.GetSwitches() {
+			s.armWatchdog(switchName)
+		}
 
 		// Set up auto-off timer if duration specified
 		if req.Duration != nil {
 			duration := time.Duration(*req.Duration) * time.Second
 			log.Printf("start timer on group %s for %v", groupName, duration)
+			stop := func() {
+				if flipflopInstance, ok := s.flipflops[groupName]; ok {
+					if err := flipflopInstance.Stop(); err != nil {
+						log.Printf("timer failed to stop flipflop on group %s: %v", groupName, err)
+					}
+					delete(s.flipflops, groupName)
+				}
+				if previousStates != nil {
+					s.restoreSwitchStates(groupSwitches(group), previousStates)
+				}
+			}
 			s.timers[groupName] = &timerData{
 				duration: duration,
-				timer: time.AfterFunc(duration, func() {
+				expires:  s.clock.Now().Add(duration),
+				stop:     stop,
+				timer: s.clock.AfterFunc(duration, func() {
 					s.mutex.Lock()
 					defer s.mutex.Unlock()
 					delete(s.timers, groupName)
-
-					if flipflopInstance, ok := s.flipflops[groupName]; ok {
-						if err := flipflopInstance.Stop(); err != nil {
-							log.Printf("timer failed to stop flipflop on group %s: %v", groupName, err)
-						}
-						delete(s.flipflops, groupName)
-					}
+					stop()
 					log.Printf("timer expired for group %s after %s", groupName, duration)
 				}),
 			}
 		}
 
-		s.sendSuccess(w, req)
+		s.sendOperation(w, groupName, req, []string{groupName})
 		return
 	}
 
 	// Handle blink specially since it operates on the group as a whole
 	if req.State == switchStateBlink {
+		if req.dryRun {
+			s.sendDryRun(w, req, group.GetSwitches())
+			return
+		}
+
 		// Cancel any existing timer for this group
 		if timer, ok := s.timers[groupName]; ok {
 			log.Printf("canceling timer on group %s", groupName)
@@ -429,61 +891,85 @@ func (s *Server) handleGroupSwitch(w http.ResponseWriter, r *http.Request, group
 			delete(s.flipflops, groupName)
 		}
 
-		dutyCycle := 0.5
+		dutyCycle := s.defaultDutyCycle
 		if req.DutyCycle != nil {
 			dutyCycle = *req.DutyCycle
 		}
 
-		newBlinker, err := blink.NewBlink(group, *req.Period, dutyCycle)
+		var previousStates map[string]bool
+		if req.RestoreOnStop {
+			var err error
+			if previousStates, err = getSwitchStates(group.GetSwitches()); err != nil {
+				s.sendError(w, fmt.Sprintf("failed to get state for group %s: %v", groupName, err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		newBlinker, err := blink.NewBlink(group, *req.Period, dutyCycle, req.phase())
 		if err != nil {
 			s.sendError(w, fmt.Sprintf("failed to create blinker for group %s: %v", groupName, err), http.StatusBadRequest)
 			return
 		}
 
+		if err := newBlinker.SetJitter(req.jitter()); err != nil {
+			s.sendError(w, fmt.Sprintf("failed to create blinker for group %s: %v", groupName, err), http.StatusBadRequest)
+			return
+		}
+		newBlinker.SetClock(s.clock)
 		s.blinkers[groupName] = newBlinker
 		log.Printf("start blinker on group %s", groupName)
 		if err := newBlinker.Start(); err != nil {
 			s.sendError(w, fmt.Sprintf("failed to start blinker for group %s: %v", groupName, err), http.StatusBadRequest)
 			return
 		}
-		s.publishMQTTSwitchEvent(groupName, "blink")
+		s.publishSwitchEvent(groupName, "blink")
+		for switchName := range group.GetSwitches() {
+			s.armWatchdog(switchName)
+		}
 
 		// Set up auto-off timer if duration specified
 		if req.Duration != nil {
 			duration := time.Duration(*req.Duration) * time.Second
 			log.Printf("start timer on group %s for %v", groupName, duration)
+			stop := func() {
+				if blinker, ok := s.blinkers[groupName]; ok {
+					if err := blinker.Stop(); err != nil {
+						log.Printf("timer failed to stop blinker on group %s: %v", groupName, err)
+					}
+					delete(s.blinkers, groupName)
+				}
+				if previousStates != nil {
+					s.restoreSwitchStates(groupSwitches(group), previousStates)
+				}
+			}
 			s.timers[groupName] = &timerData{
 				duration: duration,
-				timer: time.AfterFunc(duration, func() {
+				expires:  s.clock.Now().Add(duration),
+				stop:     stop,
+				timer: s.clock.AfterFunc(duration, func() {
 					s.mutex.Lock()
 					defer s.mutex.Unlock()
 					delete(s.timers, groupName)
-
-					if blinker, ok := s.blinkers[groupName]; ok {
-						if err := blinker.Stop(); err != nil {
-							log.Printf("timer failed to stop blinker on group %s: %v", groupName, err)
-						}
-						delete(s.blinkers, groupName)
-					}
+					stop()
 					log.Printf("timer expired for group %s after %s", groupName, duration)
 				}),
 			}
 		}
 
-		s.sendSuccess(w, req)
+		s.sendOperation(w, groupName, req, []string{groupName})
 		return
 	}
 
 	// For all other states, first cancel any group-level activities
 	// Cancel any existing timer for this group
-	if timer, ok := s.timers[groupName]; ok {
+	if timer, ok := s.timers[groupName]; ok && !req.dryRun {
 		log.Printf("canceling timer on group %s", groupName)
 		timer.timer.Stop()
 		delete(s.timers, groupName)
 	}
 
 	// Stop any running blinker for this group
-	if blinker, ok := s.blinkers[groupName]; ok {
+	if blinker, ok := s.blinkers[groupName]; ok && !req.dryRun {
 		if blinker.IsRunning() {
 			log.Printf("canceling blinker on group %s", groupName)
 			if err := blinker.Stop(); err != nil {
@@ -495,7 +981,7 @@ func (s *Server) handleGroupSwitch(w http.ResponseWriter, r *http.Request, group
 	}
 
 	// Stop any running flipflop for this group
-	if flipflopInstance, ok := s.flipflops[groupName]; ok {
+	if flipflopInstance, ok := s.flipflops[groupName]; ok && !req.dryRun {
 		if flipflopInstance.IsRunning() {
 			log.Printf("canceling flipflop on group %s", groupName)
 			if err := flipflopInstance.Stop(); err != nil {
@@ -508,6 +994,7 @@ func (s *Server) handleGroupSwitch(w http.ResponseWriter, r *http.Request, group
 
 	// Now apply operation to all switches in the group
 	var errors []error
+	var switchNames []string
 	for switchName, resolvedSwitch := range group.GetSwitches() {
 		// Skip disabled switches
 		if resolvedSwitch.Switch.IsDisabled() {
@@ -516,26 +1003,50 @@ func (s *Server) handleGroupSwitch(w http.ResponseWriter, r *http.Request, group
 		if err := s.handleSwitchHelper(w, &req, switchName, resolvedSwitch.Switch); err != nil {
 			errors = append(errors, fmt.Errorf("switch %s: %w", switchName, err))
 		}
+		switchNames = append(switchNames, switchName)
 	}
 
+	if len(errors) > 0 && transactionStates != nil {
+		// Undo the request on the switches it was applied to
+		for _, switchName := range switchNames {
+			s.cancelTasksAndTimers(switchName)
+		}
+		s.restoreSwitchStates(groupSwitches(group), transactionStates)
+		s.recordSwitchStates(groupName)
+		s.sendErrorCode(w, fmt.Sprintf("Transactional request on group %s rolled back: %v", groupName, errors), http.StatusConflict, errorCodeTransactionAborted, map[string]any{"group": groupName})
+		return
+	}
 	if len(errors) > 0 {
 		s.sendError(w, fmt.Sprintf("errors applying to group %s: %v", groupName, errors), http.StatusBadRequest)
 		return
 	}
-	s.sendSuccess(w, req)
+	if req.dryRun {
+		s.sendDryRun(w, req, group.GetSwitches())
+		return
+	}
+	s.sendOperation(w, groupName, req, switchNames)
 }
 
 func (s *Server) getStatusForSwitch(switchName string, sw switchcollection.Switch) (*switchResponse, error) {
 	swid := switchName
 
+	var response switchResponse
+	if resolvedSwitch, ok := s.switches[switchName]; ok {
+		response.Collection = resolvedSwitch.CollectionName
+		response.Tags = resolvedSwitch.Tags
+	}
+	response.Aliases = s.aliasesOf(switchName)
+	response.Label = switchcollection.GetLabel(sw)
+	response.Capabilities = switchcollection.GetCapabilities(sw)
+	if change, ok := s.lastStateChange(switchName); ok {
+		response.PreviousState = change.previous
+		response.ChangedAt = &change.changedAt
+	}
+
 	// Check if switch is disabled first
 	if sw.IsDisabled() {
-		return &switchResponse{
-			CurrentState: false,
-			switchRequest: switchRequest{
-				State: switchStateDisabled,
-			},
-		}, nil
+		response.State = switchStateDisabled
+		return &response, nil
 	}
 
 	currentState, err := sw.GetState()
@@ -543,9 +1054,7 @@ func (s *Server) getStatusForSwitch(switchName string, sw switchcollection.Switc
 		return nil, fmt.Errorf("failed to get state for switch %s: %w", sw, err)
 	}
 
-	response := switchResponse{
-		CurrentState: currentState,
-	}
+	response.CurrentState = currentState
 
 	response.State = switchStateOn
 	if !currentState {
@@ -560,6 +1069,9 @@ func (s *Server) getStatusForSwitch(switchName string, sw switchcollection.Switc
 			response.State = switchStateBlink
 			response.Period = &period
 			response.DutyCycle = &duty
+			if phase := blinker.GetPhase(); phase != 0 {
+				response.Phase = &phase
+			}
 		}
 	}
 
@@ -571,6 +1083,99 @@ func (s *Server) getStatusForSwitch(switchName string, sw switchcollection.Switc
 	return &response, nil
 }
 
+// getSwitchStates returns the current state of each of the given switches.
+func getSwitchStates(switches map[string]*ResolvedSwitch) (map[string]bool, error) {
+	states := make(map[string]bool, len(switches))
+	for switchName, resolvedSwitch := range switches {
+		state, err := resolvedSwitch.Switch.GetState()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get state for switch %s: %w", switchName, err)
+		}
+		states[switchName] = state
+	}
+	return states, nil
+}
+
+// groupSwitches returns the switches in a group indexed by name.
+func groupSwitches(group *SwitchGroup) map[string]switchcollection.Switch {
+	switches := make(map[string]switchcollection.Switch)
+	for switchName, resolvedSwitch := range group.GetSwitches() {
+		switches[switchName] = resolvedSwitch.Switch
+	}
+	return switches
+}
+
+// restoreSwitchStates returns each switch to the state recorded in states
+// (as returned by getSwitchStates). The caller must hold s.mutex.
+func (s *Server) restoreSwitchStates(switches map[string]switchcollection.Switch, states map[string]bool) {
+	for switchName, sw := range switches {
+		state, ok := states[switchName]
+		if !ok {
+			continue
+		}
+
+		if state {
+			if err := sw.TurnOn(); err != nil {
+				log.Printf("failed to restore switch %s to on: %v", switchName, err)
+				continue
+			}
+			s.publishSwitchEvent(switchName, "on")
+		} else {
+			if err := sw.TurnOff(); err != nil {
+				log.Printf("failed to restore switch %s to off: %v", switchName, err)
+				continue
+			}
+			s.publishSwitchEvent(switchName, "off")
+		}
+		log.Printf("restored switch %s to previous state", switchName)
+	}
+}
+
+// snapshotSwitchStates returns the status of each of the given switches.
+//
+// The caller must hold s.mutex for the duration of the call. Every API
+// operation that changes switch state (including batch operations on groups
+// and "all") holds s.mutex until it completes, so holding it here guarantees
+// that the snapshot never observes a batch operation half-applied. Switch
+// states are read in parallel (at most maxConcurrentStateReads at a time) so
+// that slow network drivers do not make the snapshot time proportional to the
+// number of switches.
+func (s *Server) snapshotSwitchStates(switches map[string]*ResolvedSwitch) (map[string]*switchResponse, error) {
+	type result struct {
+		name   string
+		status *switchResponse
+		err    error
+	}
+
+	results := make(chan result, len(switches))
+	sem := make(chan struct{}, maxConcurrentStateReads)
+	var wg sync.WaitGroup
+
+	for switchName, resolvedSwitch := range switches {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			status, err := s.getStatusForSwitch(switchName, resolvedSwitch.Switch)
+			results <- result{name: switchName, status: status, err: err}
+		}()
+	}
+
+	wg.Wait()
+	close(results)
+
+	snapshot := make(map[string]*switchResponse, len(switches))
+	for res := range results {
+		if res.err != nil {
+			return nil, fmt.Errorf("failed to get status for switch %s: %w", res.name, res.err)
+		}
+		snapshot[res.name] = res.status
+	}
+
+	return snapshot, nil
+}
+
 func (s *Server) switchStatusHandler(w http.ResponseWriter, r *http.Request) {
 	switchName := chi.URLParam(r, "name")
 
@@ -586,7 +1191,9 @@ func (s *Server) switchStatusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) getStatusForGroup(groupName string, group *SwitchGroup) (*groupResponse, error) {
+// getStatusForGroup returns the status of a group, using states (a snapshot
+// from snapshotSwitchStates) for the state of the group's switches.
+func (s *Server) getStatusForGroup(groupName string, group *SwitchGroup, states map[string]*switchResponse) (*groupResponse, error) {
 	// Get list of switch names in the group
 	switchNames := make([]string, 0, len(group.GetSwitches()))
 	for switchName := range group.GetSwitches() {
@@ -595,17 +1202,13 @@ func (s *Server) getStatusForGroup(groupName string, group *SwitchGroup) (*group
 
 	// Calculate summary state (true if all switches in group are on)
 	allOn := true
-	for _, resolvedSwitch := range group.GetSwitches() {
-		// Skip disabled switches when calculating group summary
-		if resolvedSwitch.Switch.IsDisabled() {
-			allOn = false
-			break
-		}
-		currentState, err := resolvedSwitch.Switch.GetState()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get state for switch %s in group %s: %w", resolvedSwitch.Name, groupName, err)
+	for switchName := range group.GetSwitches() {
+		switchStatus, ok := states[switchName]
+		if !ok {
+			return nil, fmt.Errorf("no state for switch %s in group %s", switchName, groupName)
 		}
-		if !currentState {
+		// Disabled switches are reported as off
+		if !switchStatus.CurrentState {
 			allOn = false
 			break
 		}
@@ -615,6 +1218,7 @@ func (s *Server) getStatusForGroup(groupName string, group *SwitchGroup) (*group
 		Switches: switchNames,
 		Summary:  allOn,
 		State:    switchStateOff,
+		Aliases:  s.aliasesOf(groupName),
 	}
 
 	if allOn {
@@ -640,26 +1244,23 @@ func (s *Server) getStatusForGroup(groupName string, group *SwitchGroup) (*group
 func (s *Server) handleAllSwitchesStatus(w http.ResponseWriter) {
 	switchCount := uint(len(s.switches))
 	response := multiSwitchResponse{
-		Count:    switchCount,
-		Switches: make(map[string]*switchResponse),
-		Groups:   make(map[string]*groupResponse),
+		Count:  switchCount,
+		Groups: make(map[string]*groupResponse),
+	}
+
+	snapshot, err := s.snapshotSwitchStates(s.switches)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	response.Switches = snapshot
 
 	// Calculate summary state (true if all defined switches are on)
 	allOn := true
-
-	for switchName, resolvedSwitch := range s.switches {
-		switchStatus, err := s.getStatusForSwitch(switchName, resolvedSwitch.Switch)
-		if err != nil {
-			s.sendError(w, fmt.Sprintf("Failed to get status for switch %s: %v", switchName, err), http.StatusBadRequest)
-			return
-		}
-
-		// Store switch status with its name as the key
-		response.Switches[switchName] = switchStatus
-
+	for _, switchStatus := range snapshot {
 		if !switchStatus.CurrentState {
 			allOn = false
+			break
 		}
 	}
 
@@ -675,9 +1276,9 @@ func (s *Server) handleAllSwitchesStatus(w http.ResponseWriter) {
 		}
 	}
 
-	// Populate group information
+	// Populate group information from the same snapshot
 	for groupName, group := range s.groups {
-		groupStatus, err := s.getStatusForGroup(groupName, group)
+		groupStatus, err := s.getStatusForGroup(groupName, group, snapshot)
 		if err != nil {
 			s.sendError(w, fmt.Sprintf("Failed to get status for group %s: %v", groupName, err), http.StatusBadRequest)
 			return
@@ -691,25 +1292,23 @@ func (s *Server) handleAllSwitchesStatus(w http.ResponseWriter) {
 func (s *Server) handleGroupSwitchStatus(w http.ResponseWriter, groupName string, group *SwitchGroup) {
 	switchCount := group.CountSwitches()
 	response := multiSwitchResponse{
-		Count:    switchCount,
-		Switches: make(map[string]*switchResponse),
+		Count:   switchCount,
+		Aliases: s.aliasesOf(groupName),
+	}
+
+	snapshot, err := s.snapshotSwitchStates(group.GetSwitches())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to get status for group %s: %v", groupName, err), http.StatusBadRequest)
+		return
 	}
+	response.Switches = snapshot
 
 	// Calculate summary state (true if all switches in group are on)
 	allOn := true
-
-	for switchName, resolvedSwitch := range group.GetSwitches() {
-		switchStatus, err := s.getStatusForSwitch(switchName, resolvedSwitch.Switch)
-		if err != nil {
-			s.sendError(w, fmt.Sprintf("Failed to get status for switch %s in group %s: %v", switchName, groupName, err), http.StatusBadRequest)
-			return
-		}
-
-		// Store switch status with its name as the key
-		response.Switches[switchName] = switchStatus
-
+	for _, switchStatus := range snapshot {
 		if !switchStatus.CurrentState {
 			allOn = false
+			break
 		}
 	}
 
@@ -738,7 +1337,7 @@ func (s *Server) handleSingleSwitchStatus(w http.ResponseWriter, switchName stri
 	// Check if switch exists
 	resolvedSwitch, exists := s.switches[switchName]
 	if !exists {
-		s.sendError(w, fmt.Sprintf("Switch %s not found", switchName), http.StatusNotFound)
+		s.sendErrorCode(w, fmt.Sprintf("Switch %s not found", switchName), http.StatusNotFound, errorCodeSwitchNotFound, map[string]any{"switch": switchName})
 		return
 	}
 
@@ -751,6 +1350,262 @@ func (s *Server) handleSingleSwitchStatus(w http.ResponseWriter, switchName stri
 	s.sendSuccess(w, response)
 }
 
+// searchHandler returns the switches whose name contains the q parameter
+// (ignoring case) and whose state matches the state parameter. Either
+// parameter may be omitted. "on" and "off" match the current state of a
+// switch, while "blink" and "disabled" match its reported state.
+func (s *Server) searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.ToLower(r.URL.Query().Get("q"))
+	state := switchState(r.URL.Query().Get("state"))
+
+	switch state {
+	case "", switchStateOn, switchStateOff, switchStateBlink, switchStateDisabled:
+	default:
+		s.sendErrorCode(w, "State must be 'on', 'off', 'blink', or 'disabled'", http.StatusBadRequest, errorCodeInvalidState,
+			map[string]any{"field": "state", "allowed": []switchState{switchStateOn, switchStateOff, switchStateBlink, switchStateDisabled}})
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	candidates := make(map[string]*ResolvedSwitch)
+	for switchName, resolvedSwitch := range s.switches {
+		if strings.Contains(strings.ToLower(switchName), query) {
+			candidates[switchName] = resolvedSwitch
+		}
+	}
+
+	snapshot, err := s.snapshotSwitchStates(candidates)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := multiSwitchResponse{
+		Switches: make(map[string]*switchResponse),
+	}
+
+	allOn := true
+	for switchName, switchStatus := range snapshot {
+		var match bool
+		switch state {
+		case "":
+			match = true
+		case switchStateOn, switchStateOff:
+			match = switchStatus.CurrentState == (state == switchStateOn)
+		default:
+			match = switchStatus.State == state
+		}
+		if !match {
+			continue
+		}
+
+		response.Switches[switchName] = switchStatus
+		if !switchStatus.CurrentState {
+			allOn = false
+		}
+	}
+
+	response.Count = uint(len(response.Switches))
+	response.Summary = allOn && response.Count > 0
+	response.State = switchStateOff
+	if response.Summary {
+		response.State = switchStateOn
+	}
+
+	s.sendSuccess(w, response)
+}
+
+// serverStatusResponse describes server-wide settings
+type serverStatusResponse struct {
+	ReadOnly    bool           `json:"readOnly"`
+	Maintenance bool           `json:"maintenance"`
+	Defaults    effectDefaults `json:"defaults"`
+}
+
+// effectDefaults are the values used for blink and flipflop requests that
+// omit them
+type effectDefaults struct {
+	Period    *float64 `json:"period,omitempty"`
+	DutyCycle float64  `json:"dutyCycle"`
+}
+
+func (s *Server) serverStatusHandler(w http.ResponseWriter, r *http.Request) {
+	response := serverStatusResponse{
+		ReadOnly:    s.readOnly,
+		Maintenance: s.maintenance.Load(),
+		Defaults: effectDefaults{
+			DutyCycle: s.defaultDutyCycle,
+		},
+	}
+	if s.defaultPeriod > 0 {
+		period := s.defaultPeriod
+		response.Defaults.Period = &period
+	}
+
+	s.sendSuccess(w, response)
+}
+
+// readinessTimeout limits how long the readiness check waits for the
+// switch collections to respond
+const readinessTimeout = 5 * time.Second
+
+// readinessResponse reports the health of each switch collection, either
+// "ok" or the error returned by its health check, and the state of the
+// MQTT connection if MQTT is configured
+type readinessResponse struct {
+	Collections map[string]string `json:"collections"`
+	MQTT        *mqttStatus       `json:"mqtt,omitempty"`
+}
+
+// mqttStatus reports whether the server is connected to the MQTT broker and
+// how many switch events are waiting to be published. Error is the reason
+// the last connection attempt failed or the connection was lost. A
+// disconnected broker does not make the server unready, since events are
+// queued until it reconnects.
+type mqttStatus struct {
+	Connected bool   `json:"connected"`
+	Queued    int    `json:"queued"`
+	Error     string `json:"error,omitempty"`
+}
+
+// readyzHandler reports whether every switch collection passes its health
+// check. It responds with 503 if any of them fail.
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	collections, errs := s.checkCollections(ctx)
+	response := readinessResponse{Collections: collections, MQTT: s.mqttState()}
+
+	if len(errs) > 0 {
+		s.sendResponse(w, APIResponse{
+			Status:  "error",
+			Message: "one or more switch collections are not ready",
+			Data:    response,
+		}, http.StatusServiceUnavailable)
+		return
+	}
+	s.sendSuccess(w, response)
+}
+
+// checkCollections runs the health check of every switch collection. It
+// returns the result for each collection, either "ok" or the error returned
+// by its health check, and the errors of those that failed.
+func (s *Server) checkCollections(ctx context.Context) (map[string]string, []error) {
+	var mutex sync.Mutex
+	results := make(map[string]string, len(s.collections))
+	errs := s.forEachCollection(func(name string, collection switchcollection.SwitchCollection) error {
+		status := "ok"
+		err := collection.HealthCheck(ctx)
+		if err != nil {
+			status = err.Error()
+			err = fmt.Errorf("collection %s: %w", name, err)
+		}
+		mutex.Lock()
+		results[name] = status
+		mutex.Unlock()
+		return err
+	})
+	return results, errs
+}
+
+// mqttState returns the state of the MQTT connection, or nil if MQTT is not
+// configured
+func (s *Server) mqttState() *mqttStatus {
+	if s.mqttClient == nil {
+		return nil
+	}
+	status := &mqttStatus{
+		Connected: s.mqttClient.IsConnected(),
+		Queued:    s.mqttClient.QueueLength(),
+	}
+	if err := s.mqttClient.LastError(); err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// panicResponse reports the result of turning off each switch collection,
+// either "ok" or the error returned by the collection
+type panicResponse struct {
+	Collections map[string]string `json:"collections"`
+}
+
+// panicHandler stops every running task and timer and turns off every
+// switch collection. Unlike turning off "all", it also tries to turn off
+// disabled switches: those that can be probed are checked first, which
+// re-enables them if their device responds. It responds with 503 if any
+// collection could not be turned off.
+func (s *Server) panicHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// However far the panic gets, even if a driver panics, bring the
+	// watchdogs and the saved switch states in line with the switches
+	defer func() {
+		for switchName := range s.watchdogs {
+			s.disarmWatchdog(switchName)
+		}
+		s.recordSwitchStates("all")
+	}()
+
+	log.Printf("panic: stopping all tasks and turning off all switches")
+	s.cancelAllTasksAndTimers()
+	clear(s.onSince)
+
+	var mutex sync.Mutex
+	response := panicResponse{Collections: make(map[string]string, len(s.collections))}
+	errs := s.forEachCollection(func(name string, collection switchcollection.SwitchCollection) error {
+		for switchName, resolvedSwitch := range s.switches {
+			if resolvedSwitch.Collection != collection || !resolvedSwitch.Switch.IsDisabled() {
+				continue
+			}
+			if checker, ok := resolvedSwitch.Switch.(switchcollection.HealthChecker); ok {
+				if err := checker.HealthCheck(ctx); err != nil {
+					log.Printf("panic: switch %s is still unreachable: %v", switchName, err)
+				}
+			}
+		}
+
+		status := "ok"
+		err := collection.TurnOff()
+		if err != nil {
+			status = err.Error()
+			err = fmt.Errorf("collection %s: %w", name, err)
+		}
+		mutex.Lock()
+		response.Collections[name] = status
+		mutex.Unlock()
+		return err
+	})
+
+	for switchName, resolvedSwitch := range s.switches {
+		if !resolvedSwitch.Switch.IsDisabled() {
+			s.publishSwitchEvent(switchName, "off")
+		}
+	}
+
+	if len(errs) > 0 {
+		s.sendResponse(w, APIResponse{
+			Status:  "error",
+			Message: "one or more switch collections could not be turned off",
+			Data:    response,
+		}, http.StatusServiceUnavailable)
+		return
+	}
+	s.sendSuccess(w, response)
+}
+
+// versionHandler reports the build version of the server
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	s.sendSuccess(w, version.GetInfo())
+}
+
 func (s *Server) listRoutesHandler(w http.ResponseWriter, r *http.Request) {
 	data := map[string]any{"routes": s.ListRoutes()}
 	s.sendSuccess(w, data)
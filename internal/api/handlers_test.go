@@ -3,14 +3,20 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/larsks/airdancer/internal/clock"
 	"github.com/larsks/airdancer/internal/switchcollection"
 )
 
@@ -44,7 +50,7 @@ func createTestServer(t *testing.T, switchCount uint) *Server {
 
 	// Use the shared constructor without production middleware and no listen address for tests
 	groups := make(map[string]*SwitchGroup)
-	return newServerWithCollections(collections, switches, groups, "", false)
+	return newServerWithCollections(collections, switches, groups, nil, false)
 }
 
 func TestSendResponse(t *testing.T) {
@@ -164,6 +170,199 @@ func TestSwitchStatusHandler_SingleSwitch(t *testing.T) {
 	}
 }
 
+func TestSwitchStatusHandler_Capabilities(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+
+	req := httptest.NewRequest("GET", "/switch/switch0", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /switch/switch0 status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var response struct {
+		Data switchResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response not valid JSON: %v", err)
+	}
+	if response.Data.Capabilities != switchcollection.BasicCapabilities {
+		t.Errorf("capabilities = %+v, want %+v", response.Data.Capabilities, switchcollection.BasicCapabilities)
+	}
+}
+
+// labeledSwitch wraps a switch and gives it a name, as the PiFace driver
+// does for outputs listed in output-names
+type labeledSwitch struct {
+	switchcollection.Switch
+	name string
+}
+
+func (s *labeledSwitch) GetName() string {
+	return s.name
+}
+
+func TestSwitchStatusHandler_Label(t *testing.T) {
+	server := createTestServer(t, 2)
+	defer server.Close()
+
+	server.switches["switch0"].Switch = &labeledSwitch{Switch: server.switches["switch0"].Switch, name: "fan"}
+
+	w := serve(server, "GET", "/switch/all", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /switch/all status = %v, want %v", w.Code, http.StatusOK)
+	}
+	var response struct {
+		Data multiSwitchResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response not valid JSON: %v", err)
+	}
+	if label := response.Data.Switches["switch0"].Label; label != "fan" {
+		t.Errorf("switch0 label = %q, want %q", label, "fan")
+	}
+	if label := response.Data.Switches["switch1"].Label; label != "" {
+		t.Errorf("switch1 label = %q, want none", label)
+	}
+}
+
+func TestSwitchStatusHandler_StateChanges(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+	fake := useFakeClock(server)
+
+	status := func(switchName string) switchResponse {
+		t.Helper()
+		w := serve(server, "GET", "/switch/"+switchName, "")
+		var response struct {
+			Data switchResponse `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("response not valid JSON: %v", err)
+		}
+		return response.Data
+	}
+
+	// Nothing is reported until the server sees the switch change
+	if got := status("switch0"); got.PreviousState != "" || got.ChangedAt != nil {
+		t.Errorf("switch0 previousState/changedAt = %q/%v before any change, want none", got.PreviousState, got.ChangedAt)
+	}
+
+	var lastChange time.Time
+	for i, want := range []struct {
+		state    switchState
+		previous switchState
+	}{
+		{switchStateOn, ""},
+		{switchStateOff, switchStateOn},
+		{switchStateOn, switchStateOff},
+	} {
+		fake.Advance(5 * time.Second)
+		if w := serve(server, "POST", "/switch/switch0", `{"state": "toggle"}`); w.Code != http.StatusOK {
+			t.Fatalf("toggle %d: status = %v, body: %s", i, w.Code, w.Body.String())
+		}
+
+		got := status("switch0")
+		if got.State != want.state || got.PreviousState != want.previous {
+			t.Errorf("toggle %d: state/previousState = %q/%q, want %q/%q", i, got.State, got.PreviousState, want.state, want.previous)
+		}
+		if got.ChangedAt == nil || !got.ChangedAt.Equal(fake.Now()) {
+			t.Errorf("toggle %d: changedAt = %v, want %v", i, got.ChangedAt, fake.Now())
+		}
+		lastChange = fake.Now()
+	}
+
+	// Requests that leave the switch in the same state are not changes
+	fake.Advance(5 * time.Second)
+	serve(server, "POST", "/switch/switch0", `{"state": "on"}`)
+	if got := status("switch0"); got.ChangedAt == nil || !got.ChangedAt.Equal(lastChange) {
+		t.Errorf("changedAt after turning on a switch that is on = %v, want %v", got.ChangedAt, lastChange)
+	}
+
+	// Changes made through a group are recorded for its switches
+	serve(server, "POST", "/switch/green", `{"state": "on"}`)
+	for _, switchName := range []string{"switch2", "switch3"} {
+		got := status(switchName)
+		if got.PreviousState != "" || got.ChangedAt == nil || !got.ChangedAt.Equal(fake.Now()) {
+			t.Errorf("%s previousState/changedAt = %q/%v, want none/%v", switchName, got.PreviousState, got.ChangedAt, fake.Now())
+		}
+	}
+}
+
+func TestAllSwitchesStaggeredBlink(t *testing.T) {
+	server := createTestServer(t, 3)
+	defer server.Close()
+	fake := useFakeClock(server)
+
+	req := httptest.NewRequest("POST", "/switch/all", strings.NewReader(`{"state": "blink", "period": 1, "stagger": 0.25}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/all status = %v, body: %s", w.Code, w.Body.String())
+	}
+
+	// Each switch runs 0.25 seconds (a quarter period) behind the previous
+	wantPhases := map[string]float64{"switch0": 0, "switch1": 0.75, "switch2": 0.5}
+	for switchName, want := range wantPhases {
+		if got := server.blinkers[switchName].GetPhase(); got != want {
+			t.Errorf("phase of %s = %v, want %v", switchName, got, want)
+		}
+	}
+
+	wantStates := []struct {
+		advance time.Duration
+		states  map[string]bool
+	}{
+		{0, map[string]bool{"switch0": false, "switch1": true, "switch2": true}},
+		{250 * time.Millisecond, map[string]bool{"switch0": false, "switch1": false, "switch2": true}},
+		{250 * time.Millisecond, map[string]bool{"switch0": true, "switch1": false, "switch2": false}},
+		{250 * time.Millisecond, map[string]bool{"switch0": true, "switch1": true, "switch2": false}},
+		{250 * time.Millisecond, map[string]bool{"switch0": false, "switch1": true, "switch2": true}},
+	}
+	for _, step := range wantStates {
+		fake.BlockUntil(3)
+		fake.Advance(step.advance)
+		fake.BlockUntil(3)
+		for switchName, want := range step.states {
+			if got, _ := server.switches[switchName].Switch.GetState(); got != want {
+				t.Errorf("after %v more: %s is on = %v, want %v", step.advance, switchName, got, want)
+			}
+		}
+	}
+
+	req = httptest.NewRequest("POST", "/switch/switch0", strings.NewReader(`{"state": "blink", "period": 1, "stagger": 0.25}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("stagger on a single switch: status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAllSwitchesStaggeredBlinkSkipsDisabled(t *testing.T) {
+	server := createTestServer(t, 3)
+	defer server.Close()
+	useFakeClock(server)
+	server.switches["switch1"].Switch.(*switchcollection.DummySwitch).SetDisabled(true)
+
+	if w := serve(server, "POST", "/switch/all", `{"state": "blink", "period": 1, "stagger": 0.25}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/all status = %v, body: %s", w.Code, w.Body.String())
+	}
+
+	// The disabled switch does not leave a gap between the others
+	if _, exists := server.blinkers["switch1"]; exists {
+		t.Error("disabled switch1 was blinked")
+	}
+	wantPhases := map[string]float64{"switch0": 0, "switch2": 0.75}
+	for switchName, want := range wantPhases {
+		if got := server.blinkers[switchName].GetPhase(); got != want {
+			t.Errorf("phase of %s = %v, want %v", switchName, got, want)
+		}
+	}
+}
+
 func TestSwitchStatusHandler_AllSwitches(t *testing.T) {
 	server := createTestServer(t, 2)
 	defer server.Close()
@@ -276,7 +475,7 @@ func createTestServerWithGroups(t *testing.T, switchCount uint) *Server {
 		groups["green"] = NewSwitchGroup("green", greenSwitches)
 	}
 
-	return newServerWithCollections(collections, switches, groups, "", false)
+	return newServerWithCollections(collections, switches, groups, nil, false)
 }
 
 func TestSwitchStatusHandler_AllSwitches_WithGroups(t *testing.T) {
@@ -394,9 +593,17 @@ func TestSwitchStatusHandler_AllSwitches_WithGroups(t *testing.T) {
 	}
 }
 
+// useFakeClock replaces the server's clock with a fake and returns it
+func useFakeClock(server *Server) *clock.Fake {
+	fake := clock.NewFake(time.Unix(0, 0))
+	server.clock = fake
+	return fake
+}
+
 func TestSwitchHandler_BlinkWithTimerExpiration(t *testing.T) {
 	server := createTestServer(t, 1)
 	defer server.Close()
+	fake := useFakeClock(server)
 
 	// Test starting a blink operation with a short duration
 	reqBody := `{"state": "blink", "duration": 1, "period": 0.1}`
@@ -440,8 +647,15 @@ func TestSwitchHandler_BlinkWithTimerExpiration(t *testing.T) {
 	}
 	server.mutex.Unlock()
 
-	// Wait for timer to expire (1 second + small buffer)
-	time.Sleep(1200 * time.Millisecond)
+	// Not expired just before the duration is up
+	fake.Advance(999 * time.Millisecond)
+	server.mutex.Lock()
+	if _, exists := server.timers["switch0"]; !exists {
+		t.Error("Timer should not expire before its duration")
+	}
+	server.mutex.Unlock()
+
+	fake.Advance(time.Millisecond)
 
 	// Verify blinker was stopped and cleaned up after timer expiration
 	server.mutex.Lock()
@@ -472,3 +686,671 @@ func TestSwitchHandler_BlinkWithTimerExpiration(t *testing.T) {
 		t.Error("Blinker should not be running after timer expiration")
 	}
 }
+
+func TestSwitchHandler_RestoreOnStop(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+	fake := useFakeClock(server)
+
+	initialStates := map[string]bool{
+		"switch0": true,
+		"switch1": false,
+		"switch2": true,
+		"switch3": false,
+	}
+	for switchName, state := range initialStates {
+		sw := server.switches[switchName].Switch
+		if state {
+			if err := sw.TurnOn(); err != nil {
+				t.Fatalf("Failed to turn on %s: %v", switchName, err)
+			}
+		}
+	}
+
+	requests := map[string]string{
+		"red":     `{"state": "flipflop", "period": 0.1, "duration": 1, "restoreOnStop": true}`,
+		"switch2": `{"state": "blink", "period": 0.1, "duration": 1, "restoreOnStop": true}`,
+		"switch3": `{"state": "blink", "period": 0.1, "duration": 1, "restoreOnStop": true}`,
+	}
+	for target, body := range requests {
+		req := httptest.NewRequest("POST", "/switch/"+target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST /switch/%s status = %v, want %v, body: %s", target, w.Code, http.StatusOK, w.Body.String())
+		}
+	}
+
+	fake.Advance(time.Second)
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if len(server.blinkers) != 0 || len(server.flipflops) != 0 {
+		t.Errorf("effects should be cleaned up after timer expiration (blinkers=%d, flipflops=%d)", len(server.blinkers), len(server.flipflops))
+	}
+
+	for switchName, want := range initialStates {
+		got, err := server.switches[switchName].Switch.GetState()
+		if err != nil {
+			t.Fatalf("Failed to get state of %s: %v", switchName, err)
+		}
+		if got != want {
+			t.Errorf("%s state after timer expiration = %v, want %v", switchName, got, want)
+		}
+	}
+}
+
+// slowSwitch wraps a switch and delays every GetState call.
+type slowSwitch struct {
+	switchcollection.Switch
+	delay time.Duration
+}
+
+func (s *slowSwitch) GetState() (bool, error) {
+	time.Sleep(s.delay)
+	return s.Switch.GetState()
+}
+
+func TestSnapshotSwitchStates_Concurrent(t *testing.T) {
+	const switchCount = maxConcurrentStateReads
+	const delay = 50 * time.Millisecond
+
+	server := createTestServer(t, switchCount)
+	defer server.Close()
+
+	for _, resolvedSwitch := range server.switches {
+		resolvedSwitch.Switch = &slowSwitch{Switch: resolvedSwitch.Switch, delay: delay}
+	}
+
+	server.mutex.Lock()
+	start := time.Now()
+	snapshot, err := server.snapshotSwitchStates(server.switches)
+	elapsed := time.Since(start)
+	server.mutex.Unlock()
+
+	if err != nil {
+		t.Fatalf("snapshotSwitchStates() unexpected error = %v", err)
+	}
+	if len(snapshot) != switchCount {
+		t.Errorf("snapshotSwitchStates() returned %d switches, want %d", len(snapshot), switchCount)
+	}
+
+	// Reading serially would take switchCount * delay.
+	if elapsed >= switchCount*delay/2 {
+		t.Errorf("snapshotSwitchStates() took %v, expected states to be read in parallel", elapsed)
+	}
+}
+
+func TestSwitchStatusHandler_AllSwitchesConsistentDuringBatchWrite(t *testing.T) {
+	server := createTestServer(t, 16)
+	defer server.Close()
+
+	for _, resolvedSwitch := range server.switches {
+		resolvedSwitch.Switch = &slowSwitch{Switch: resolvedSwitch.Switch, delay: time.Millisecond}
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		states := []string{"on", "off"}
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			body := fmt.Sprintf(`{"state": "%s"}`, states[i%2])
+			req := httptest.NewRequest("POST", "/switch/all", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Errorf("POST /switch/all status = %v, want %v", w.Code, http.StatusOK)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest("GET", "/switch/all", nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /switch/all status = %v, want %v", w.Code, http.StatusOK)
+		}
+
+		var response struct {
+			Data multiSwitchResponse `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("GET /switch/all response not valid JSON: %v", err)
+		}
+
+		onCount := 0
+		for _, switchStatus := range response.Data.Switches {
+			if switchStatus.CurrentState {
+				onCount++
+			}
+		}
+		if onCount != 0 && onCount != len(response.Data.Switches) {
+			t.Fatalf("GET /switch/all returned a partially applied batch: %d of %d switches on", onCount, len(response.Data.Switches))
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestSwitchHandler_FlipflopRequiresTwoSwitches(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+
+	server.groups["solo"] = NewSwitchGroup("solo", map[string]*ResolvedSwitch{
+		"switch0": server.switches["switch0"],
+	})
+
+	req := httptest.NewRequest("POST", "/switch/solo", strings.NewReader(`{"state": "flipflop", "period": 0.1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("POST /switch/solo status = %v, want %v, body: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "at least two switches") {
+		t.Errorf("error response %q does not explain the problem", w.Body.String())
+	}
+	if len(server.flipflops) != 0 {
+		t.Errorf("no flipflop should be started, got %d", len(server.flipflops))
+	}
+}
+
+func TestSwitchHandler_Identify(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+	fake := useFakeClock(server)
+
+	if err := server.switches["switch1"].Switch.TurnOn(); err != nil {
+		t.Fatalf("Failed to turn on switch1: %v", err)
+	}
+
+	for _, switchName := range []string{"switch0", "switch1"} {
+		req := httptest.NewRequest("POST", "/switch/"+switchName+"/identify", nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST /switch/%s/identify status = %v, want %v, body: %s", switchName, w.Code, http.StatusOK, w.Body.String())
+		}
+	}
+
+	server.mutex.Lock()
+	for _, switchName := range []string{"switch0", "switch1"} {
+		blinker, ok := server.blinkers[switchName]
+		if !ok || !blinker.IsRunning() {
+			t.Errorf("identify should start a blinker on %s", switchName)
+		}
+		if _, ok := server.timers[switchName]; !ok {
+			t.Errorf("identify should start a timer on %s", switchName)
+		}
+	}
+	server.mutex.Unlock()
+
+	fake.Advance(identifyDuration * time.Second)
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if len(server.blinkers) != 0 || len(server.timers) != 0 {
+		t.Errorf("identify should clean up after itself (blinkers=%d, timers=%d)", len(server.blinkers), len(server.timers))
+	}
+
+	for switchName, want := range map[string]bool{"switch0": false, "switch1": true} {
+		got, err := server.switches[switchName].Switch.GetState()
+		if err != nil {
+			t.Fatalf("Failed to get state of %s: %v", switchName, err)
+		}
+		if got != want {
+			t.Errorf("%s state after identify = %v, want %v", switchName, got, want)
+		}
+	}
+}
+
+// stuckSwitch wraps a switch that cannot be turned on
+type stuckSwitch struct {
+	switchcollection.Switch
+}
+
+func (s *stuckSwitch) TurnOn() error {
+	return errors.New("relay is stuck")
+}
+
+func TestSwitchHandler_TransactionalGroup(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+	server.switches["switch1"].Switch.(*switchcollection.DummySwitch).SetDisabled(true)
+
+	// switch1 is disabled, so a transactional request on red is not
+	// applied to switch0 either
+	w := serve(server, "POST", "/switch/red", `{"state": "on", "transactional": true}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("transactional request with a disabled switch: status = %d, want %d, body: %s", w.Code, http.StatusConflict, w.Body.String())
+	}
+	var resp APIResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Code != errorCodeTransactionAborted {
+		t.Errorf("code = %q, want %q", resp.Code, errorCodeTransactionAborted)
+	}
+	if failures, _ := resp.Details["switches"].(map[string]any); len(failures) != 1 || failures["switch1"] == nil {
+		t.Errorf("details = %v, want a failure for switch1 only", resp.Details)
+	}
+	if on, _ := server.switches["switch0"].Switch.GetState(); on {
+		t.Error("aborted transactional request turned on switch0")
+	}
+
+	// Without transactional, the request is applied to the switches that
+	// can be controlled
+	if w := serve(server, "POST", "/switch/red", `{"state": "on"}`); w.Code != http.StatusOK {
+		t.Fatalf("non-transactional request: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if on, _ := server.switches["switch0"].Switch.GetState(); !on {
+		t.Error("non-transactional request did not turn on switch0")
+	}
+
+	// A switch that fails while the request is applied causes the others
+	// to be restored
+	server.switches["switch3"].Switch = &stuckSwitch{server.switches["switch3"].Switch}
+	if w := serve(server, "POST", "/switch/green", `{"state": "on", "transactional": true}`); w.Code != http.StatusConflict {
+		t.Fatalf("transactional request with a failing switch: status = %d, want %d, body: %s", w.Code, http.StatusConflict, w.Body.String())
+	}
+	if on, _ := server.switches["switch2"].Switch.GetState(); on {
+		t.Error("switch2 was not restored after the transactional request failed")
+	}
+
+	if w := serve(server, "POST", "/switch/switch0", `{"state": "on", "transactional": true}`); w.Code != http.StatusBadRequest {
+		t.Errorf("transactional request on a switch: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSwitchHandler_IdentifyGroup(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+
+	for _, target := range []string{"red", "all"} {
+		req := httptest.NewRequest("POST", "/switch/"+target+"/identify", nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("POST /switch/%s/identify status = %v, want %v", target, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestSwitchHandler_Test(t *testing.T) {
+	server := createTestServer(t, 2)
+	defer server.Close()
+
+	// switch1 starts on, and must be left on
+	if err := server.switches["switch1"].Switch.TurnOn(); err != nil {
+		t.Fatalf("TurnOn() error: %v", err)
+	}
+
+	for switchName, wantSteps := range map[string][]string{
+		"switch0": {"read", "on", "read", "off", "read"},
+		"switch1": {"read", "on", "read", "off", "read", "restore"},
+	} {
+		w := serve(server, "POST", "/switch/"+switchName+"/test", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST /switch/%s/test status = %v, want %v, body: %s", switchName, w.Code, http.StatusOK, w.Body.String())
+		}
+
+		var resp struct {
+			Data switchTestResponse `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode test response: %v", err)
+		}
+		if !resp.Data.Success || resp.Data.Switch != switchName {
+			t.Errorf("POST /switch/%s/test = %+v, want success", switchName, resp.Data)
+		}
+		var steps []string
+		for _, step := range resp.Data.Steps {
+			steps = append(steps, step.Step)
+			if !step.Success || step.Error != "" {
+				t.Errorf("switch %s step %s failed: %s", switchName, step.Step, step.Error)
+			}
+		}
+		if !slices.Equal(steps, wantSteps) {
+			t.Errorf("switch %s steps = %v, want %v", switchName, steps, wantSteps)
+		}
+		if resp.Data.RoundTrip != nil {
+			t.Errorf("switch %s roundTrip = %v, want none for a dummy switch", switchName, *resp.Data.RoundTrip)
+		}
+	}
+
+	for switchName, want := range map[string]bool{"switch0": false, "switch1": true} {
+		if got, _ := server.switches[switchName].Switch.GetState(); got != want {
+			t.Errorf("%s state after test = %v, want %v", switchName, got, want)
+		}
+	}
+
+	if w := serve(server, "POST", "/switch/all/test", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("POST /switch/all/test status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSwitchHandler_TestUsesSwitchPath(t *testing.T) {
+	server := createTestServer(t, 2)
+	defer server.Close()
+	server.switches["switch1"].MinOn = time.Minute
+
+	events := server.events.subscribe()
+	defer server.events.unsubscribe(events)
+
+	if w := serve(server, "POST", "/switch/switch0/test", ""); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/switch0/test status = %v, want %v, body: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var published []string
+	for len(events) > 0 {
+		event := <-events
+		if data, ok := event.data.(switchEvent); ok && data.Switch == "switch0" {
+			published = append(published, data.Event)
+		}
+	}
+	if !slices.Equal(published, []string{"on", "off"}) {
+		t.Errorf("events published by the test of switch0 = %v, want [on off]", published)
+	}
+
+	// A switch with a minimum on time is not turned on
+	w := serve(server, "POST", "/switch/switch1/test", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/switch1/test status = %v, want %v, body: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp struct {
+		Data switchTestResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode test response: %v", err)
+	}
+	if resp.Data.Skipped == "" || len(resp.Data.Steps) != 1 || resp.Data.Steps[0].Step != "read" {
+		t.Errorf("test of a switch with a minimum on time = %+v, want only a read step and a reason it was skipped", resp.Data)
+	}
+	if on, _ := server.switches["switch1"].Switch.GetState(); on {
+		t.Error("test turned on a switch with a minimum on time")
+	}
+}
+
+func TestSwitchHandler_Check(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+
+	check := func() (int, APIResponse, switchResponse) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/switch/switch0/check", nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		var resp struct {
+			APIResponse
+			Data switchResponse `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode check response: %v", err)
+		}
+		return w.Code, resp.APIResponse, resp.Data
+	}
+
+	code, _, data := check()
+	if code != http.StatusOK {
+		t.Errorf("POST /switch/switch0/check status = %v, want %v", code, http.StatusOK)
+	}
+	if data.State != switchStateOff {
+		t.Errorf("POST /switch/switch0/check state = %q, want %q", data.State, switchStateOff)
+	}
+
+	// Switches without their own health check fall back to the collection
+	resolvedSwitch := server.switches["switch0"]
+	resolvedSwitch.Collection = &unhealthyCollection{
+		SwitchCollection: resolvedSwitch.Collection,
+		err:              errors.New("unreachable"),
+	}
+
+	code, resp, _ := check()
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("POST /switch/switch0/check status = %v, want %v", code, http.StatusServiceUnavailable)
+	}
+	if !strings.Contains(resp.Message, "unreachable") {
+		t.Errorf("POST /switch/switch0/check message = %q, want it to contain %q", resp.Message, "unreachable")
+	}
+}
+
+func TestPanicHandlerCleansUp(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	server := newStartupTestServer(t, stateFile, map[string]SwitchConfig{
+		"heater": {Spec: SwitchSpec{"panel.0"}, StartupState: "last", WatchdogSeconds: 30},
+	})
+	defer server.Close()
+
+	if w := serve(server, "POST", "/switch/heater", `{"state": "on"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/heater: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if w := serve(server, "POST", "/panic", ""); w.Code != http.StatusOK {
+		t.Fatalf("POST /panic: status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	if _, armed := server.watchdogs["heater"]; armed {
+		t.Error("watchdog of heater is still armed after a panic")
+	}
+	if on, saved := server.switchStates["heater"]; !saved || on {
+		t.Errorf("saved state of heater = %v (saved: %v) after a panic, want off", on, saved)
+	}
+}
+
+func TestPanicHandler(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+
+	for path, body := range map[string]string{
+		"/switch/switch0": `{"state": "blink", "period": 1}`,
+		"/switch/switch1": `{"state": "on", "duration": 60}`,
+		"/switch/green":   `{"state": "flipflop", "period": 1}`,
+	} {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST %s status = %v, want %v: %s", path, w.Code, http.StatusOK, w.Body)
+		}
+	}
+
+	sendPanic := func() (int, panicResponse) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/panic", nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		var resp struct {
+			Data panicResponse `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode panic response: %v", err)
+		}
+		return w.Code, resp.Data
+	}
+
+	code, data := sendPanic()
+	if code != http.StatusOK {
+		t.Errorf("POST /panic status = %v, want %v", code, http.StatusOK)
+	}
+	if data.Collections["test-collection"] != "ok" {
+		t.Errorf("POST /panic collections = %v, want test-collection: ok", data.Collections)
+	}
+
+	server.mutex.Lock()
+	if len(server.timers) != 0 || len(server.blinkers) != 0 || len(server.flipflops) != 0 {
+		t.Errorf("Tasks still running after panic: %d timers, %d blinkers, %d flipflops", len(server.timers), len(server.blinkers), len(server.flipflops))
+	}
+	server.mutex.Unlock()
+
+	for switchName, resolvedSwitch := range server.switches {
+		if state, _ := resolvedSwitch.Switch.GetState(); state {
+			t.Errorf("%s is still on after panic", switchName)
+		}
+	}
+
+	// A switch that cannot be turned off is reported
+	server.switches["switch3"].Switch.(*switchcollection.DummySwitch).SetDisabled(true)
+	code, data = sendPanic()
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("POST /panic with a disabled switch status = %v, want %v", code, http.StatusServiceUnavailable)
+	}
+	if data.Collections["test-collection"] == "ok" {
+		t.Errorf("POST /panic with a disabled switch collections = %v, want an error", data.Collections)
+	}
+}
+
+func TestSearchHandler(t *testing.T) {
+	server := createTestServer(t, 4)
+	defer server.Close()
+
+	for _, switchName := range []string{"switch1", "switch3"} {
+		if err := server.switches[switchName].Switch.TurnOn(); err != nil {
+			t.Fatalf("Failed to turn on %s: %v", switchName, err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"switch0", "switch1", "switch2", "switch3"}},
+		{"q=1", []string{"switch1"}},
+		{"q=SWITCH&state=on", []string{"switch1", "switch3"}},
+		{"state=off", []string{"switch0", "switch2"}},
+		{"q=3&state=off", nil},
+		{"state=blink", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/switch/search?"+tt.query, nil)
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET /switch/search?%s status = %v, want %v, body: %s", tt.query, w.Code, http.StatusOK, w.Body.String())
+			}
+
+			var resp struct {
+				Data multiSwitchResponse `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if resp.Data.Count != uint(len(tt.want)) || len(resp.Data.Switches) != len(tt.want) {
+				t.Errorf("got %d switches (count %d), want %v", len(resp.Data.Switches), resp.Data.Count, tt.want)
+			}
+			for _, switchName := range tt.want {
+				if _, ok := resp.Data.Switches[switchName]; !ok {
+					t.Errorf("result is missing %s", switchName)
+				}
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/switch/search?state=sideways", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("GET /switch/search with invalid state status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	server := createTestServer(t, 2)
+	defer server.Close()
+	server.switches["switch1"].Switch.(*switchcollection.DummySwitch).SetDisabled(true)
+
+	tests := []struct {
+		name        string
+		path        string
+		body        string
+		wantStatus  int
+		wantCode    errorCode
+		wantDetails map[string]any
+	}{
+		{
+			name:        "unknown switch",
+			path:        "/switch/nonesuch",
+			body:        `{"state": "on"}`,
+			wantStatus:  http.StatusNotFound,
+			wantCode:    errorCodeSwitchNotFound,
+			wantDetails: map[string]any{"switch": "nonesuch"},
+		},
+		{
+			name:        "disabled switch",
+			path:        "/switch/switch1",
+			body:        `{"state": "on"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    errorCodeSwitchDisabled,
+			wantDetails: map[string]any{"switch": "switch1"},
+		},
+		{
+			name:       "invalid state",
+			path:       "/switch/switch0",
+			body:       `{"state": "sideways"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   errorCodeInvalidState,
+			wantDetails: map[string]any{
+				"field":   "state",
+				"allowed": []any{"on", "off", "toggle", "blink", "flipflop"},
+			},
+		},
+		{
+			name:        "invalid field",
+			path:        "/switch/switch0",
+			body:        `{"state": "on", "duration": -1}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    errorCodeInvalidRequest,
+			wantDetails: map[string]any{"field": "duration"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			var resp struct {
+				Status  string         `json:"status"`
+				Message string         `json:"message"`
+				Code    errorCode      `json:"code"`
+				Details map[string]any `json:"details"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if resp.Status != "error" || resp.Message == "" {
+				t.Errorf("response = %+v, want an error with a message", resp)
+			}
+			if resp.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", resp.Code, tt.wantCode)
+			}
+			if !reflect.DeepEqual(resp.Details, tt.wantDetails) {
+				t.Errorf("details = %v, want %v", resp.Details, tt.wantDetails)
+			}
+		})
+	}
+}
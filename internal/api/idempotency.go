@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// idempotencyKeyHeader lets clients retry a request safely: a request
+	// that repeats the key of a recent request to the same switch gets
+	// the earlier response instead of being executed again
+	idempotencyKeyHeader = "Idempotency-Key"
+
+	// idempotencyReplayedHeader is set on responses that were replayed
+	idempotencyReplayedHeader = "Idempotency-Replayed"
+
+	// idempotencyKeyTTL is how long the response to a request is kept
+	idempotencyKeyTTL = 10 * time.Minute
+
+	// maxIdempotencyKeys bounds the number of responses kept; the oldest
+	// are dropped first
+	maxIdempotencyKeys = 1000
+)
+
+// idempotentResponse is the response to a request with an idempotency key.
+// done is closed once the response has been recorded, so that a duplicate
+// that arrives while the first request is still running waits for it.
+type idempotentResponse struct {
+	done    chan struct{}
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// idempotencyCache holds recent responses to requests with an idempotency
+// key, by route, switch, and key
+type idempotencyCache struct {
+	mutex     sync.Mutex
+	responses map[string]*idempotentResponse
+	// order holds the keys of responses from oldest to newest
+	order []string
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{responses: make(map[string]*idempotentResponse)}
+}
+
+// lookup returns the response recorded for key, or, if there is none,
+// reserves key for a new response and returns it with found set to false.
+// The caller must fill in a new response and then close its done channel.
+func (c *idempotencyCache) lookup(key string, now time.Time) (response *idempotentResponse, found bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.expire(now)
+	if response, exists := c.responses[key]; exists {
+		return response, true
+	}
+
+	for len(c.order) >= maxIdempotencyKeys {
+		delete(c.responses, c.order[0])
+		c.order = c.order[1:]
+	}
+
+	response = &idempotentResponse{done: make(chan struct{}), expires: now.Add(idempotencyKeyTTL)}
+	c.responses[key] = response
+	c.order = append(c.order, key)
+	return response, false
+}
+
+// expire drops the responses that have expired. The caller must hold
+// c.mutex.
+func (c *idempotencyCache) expire(now time.Time) {
+	for len(c.order) > 0 {
+		response := c.responses[c.order[0]]
+		if response != nil && now.Before(response.expires) {
+			return
+		}
+		delete(c.responses, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// responseRecorder passes a response through to the client while keeping
+// a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(data []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	rr.body.Write(data)
+	return rr.ResponseWriter.Write(data)
+}
+
+// idempotencyCacheKey returns the key under which the response to r, a
+// request with Idempotency-Key key, is kept. It identifies the operation by
+// its route, and the switch by the name it was resolved to, so that a
+// request through an alias and one to the switch it refers to share a
+// response.
+func idempotencyCacheKey(r *http.Request, key string) string {
+	route := r.URL.Path
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		route = rctx.RoutePattern()
+	}
+	return route + "\x00" + chi.URLParam(r, "name") + "\x00" + key
+}
+
+// deduplicateRequest replays the response to an earlier request to the same
+// switch with the same Idempotency-Key header, instead of executing the
+// request again. Requests without the header are always executed.
+func (s *Server) deduplicateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		response, found := s.idempotencyKeys.lookup(idempotencyCacheKey(r, key), s.clock.Now())
+		if found {
+			<-response.done
+			for name, values := range response.header {
+				w.Header()[name] = values
+			}
+			w.Header().Set(idempotencyReplayedHeader, "true")
+			w.WriteHeader(response.status)
+			w.Write(response.body) //nolint:errcheck
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		defer func() {
+			response.status = recorder.status
+			if response.status == 0 {
+				response.status = http.StatusOK
+			}
+			response.header = w.Header().Clone()
+			response.body = recorder.body.Bytes()
+			close(response.done)
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
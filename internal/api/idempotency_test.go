@@ -0,0 +1,128 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/larsks/airdancer/internal/clock"
+)
+
+// postToggle sends a toggle request for switch0 with the given
+// Idempotency-Key header (none if key is empty)
+func postToggle(t *testing.T, server *Server, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	return postToggleTo(t, server, "switch0", key)
+}
+
+// postToggleTo is like postToggle, for the switch (or alias) name
+func postToggleTo(t *testing.T, server *Server, name, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/switch/"+name, strings.NewReader(`{"state": "toggle"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("toggle request failed: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	return w
+}
+
+func TestIdempotencyKeyTogglesOnce(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+	fake := clock.NewFake(time.Unix(0, 0))
+	server.clock = fake
+
+	isOn := func() bool {
+		state, err := server.switches["switch0"].Switch.GetState()
+		if err != nil {
+			t.Fatalf("GetState() failed: %v", err)
+		}
+		return state
+	}
+
+	first := postToggle(t, server, "retry-1")
+	if !isOn() {
+		t.Fatal("switch is off after the first toggle")
+	}
+
+	retry := postToggle(t, server, "retry-1")
+	if !isOn() {
+		t.Error("retrying the toggle with the same key toggled the switch again")
+	}
+	if retry.Header().Get(idempotencyReplayedHeader) != "true" {
+		t.Errorf("retry was not marked as replayed; headers: %v", retry.Header())
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("retry body = %s, want %s", retry.Body.String(), first.Body.String())
+	}
+
+	postToggle(t, server, "retry-2")
+	if isOn() {
+		t.Error("a toggle with a new key did not toggle the switch")
+	}
+
+	postToggle(t, server, "")
+	postToggle(t, server, "")
+	if isOn() {
+		t.Error("toggles without a key were deduplicated")
+	}
+
+	// Keys are forgotten once they expire
+	fake.Advance(idempotencyKeyTTL)
+	postToggle(t, server, "retry-1")
+	if !isOn() {
+		t.Error("a toggle with an expired key did not toggle the switch")
+	}
+}
+
+func TestIdempotencyKeyThroughAlias(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+	server.aliases = map[string]string{"lamp": "switch0"}
+
+	postToggleTo(t, server, "lamp", "retry-1")
+	retry := postToggleTo(t, server, "switch0", "retry-1")
+	if retry.Header().Get(idempotencyReplayedHeader) != "true" {
+		t.Errorf("retry through the switch name was not replayed; headers: %v", retry.Header())
+	}
+	if state, _ := server.switches["switch0"].Switch.GetState(); !state {
+		t.Error("the same key sent through an alias and the switch name toggled the switch twice")
+	}
+
+	// The key is still specific to the operation
+	req := httptest.NewRequest("POST", "/switch/switch0/identify", nil)
+	req.Header.Set(idempotencyKeyHeader, "retry-1")
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Header().Get(idempotencyReplayedHeader) == "true" {
+		t.Error("identify request was replayed from a toggle request with the same key")
+	}
+}
+
+func TestIdempotencyCacheIsBounded(t *testing.T) {
+	cache := newIdempotencyCache()
+	now := time.Unix(0, 0)
+
+	for i := 0; i <= maxIdempotencyKeys; i++ {
+		response, found := cache.lookup(fmt.Sprintf("key-%d", i), now)
+		if found {
+			t.Fatalf("lookup(key-%d) found a response for a new key", i)
+		}
+		close(response.done)
+	}
+
+	if len(cache.responses) != maxIdempotencyKeys {
+		t.Errorf("cache holds %d responses, want %d", len(cache.responses), maxIdempotencyKeys)
+	}
+	if _, found := cache.responses["key-0"]; found {
+		t.Error("the oldest response was not dropped")
+	}
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+)
+
+// The line protocol lets controllers that can only open a socket and send
+// lines of text, such as AV control systems, control switches. Each line
+// is a command:
+//
+//	ON <name>
+//	OFF <name>
+//	TOGGLE <name>
+//	STATUS <name>
+//	QUIT
+//
+// where name is a switch, a group, an alias, or "all". Commands are not
+// case sensitive. Each command is answered with "OK" or "ERR <message>";
+// STATUS first sends a "<switch> <state>" line for each switch. Like
+// requests sent on behalf of automated actions, commands that change
+// switches are rejected in maintenance mode.
+
+// serveLineProtocol accepts line protocol connections on listener until ctx
+// is canceled
+func (s *Server) serveLineProtocol(ctx context.Context, listener net.Listener) {
+	stop := context.AfterFunc(ctx, func() {
+		listener.Close() //nolint:errcheck
+	})
+	defer stop()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("line protocol: failed to accept connection: %v", err)
+			}
+			return
+		}
+		go s.serveLineConn(ctx, conn)
+	}
+}
+
+// serveLineConn runs the commands sent on conn until the client sends QUIT
+// or disconnects, or ctx is canceled
+func (s *Server) serveLineConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close() //nolint:errcheck
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close() //nolint:errcheck
+	})
+	defer stop()
+
+	log.Printf("line protocol: connection from %s", conn.RemoteAddr())
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if strings.EqualFold(fields[0], "QUIT") {
+			return
+		}
+
+		reply, err := s.lineCommand(fields)
+		if err != nil {
+			reply = append(reply, "ERR "+strings.ReplaceAll(err.Error(), "\n", "; "))
+		} else {
+			reply = append(reply, "OK")
+		}
+		for _, line := range reply {
+			if _, err := fmt.Fprintf(conn, "%s\r\n", line); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// lineCommand runs a line protocol command and returns the lines of its
+// reply, not including the final OK
+func (s *Server) lineCommand(fields []string) ([]string, error) {
+	command := strings.ToUpper(fields[0])
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("usage: %s <name>", command)
+	}
+	name := fields[1]
+
+	switch command {
+	case "ON":
+		return nil, s.lineControl(switchStateOn, name)
+	case "OFF":
+		return nil, s.lineControl(switchStateOff, name)
+	case "TOGGLE":
+		return nil, s.lineControl(switchStateToggle, name)
+	case "STATUS":
+		return s.lineStatus(name)
+	default:
+		return nil, fmt.Errorf("unknown command %s", command)
+	}
+}
+
+// lineSwitches returns the switches that name (a switch, a group, an
+// alias of either, or "all") refers to. The caller must hold s.mutex.
+func (s *Server) lineSwitches(name string) (map[string]*ResolvedSwitch, error) {
+	name = s.canonicalName(name)
+	if name == "all" {
+		return s.switches, nil
+	}
+	if group, exists := s.groups[name]; exists {
+		return group.GetSwitches(), nil
+	}
+	if resolvedSwitch, exists := s.switches[name]; exists {
+		return map[string]*ResolvedSwitch{name: resolvedSwitch}, nil
+	}
+	return nil, fmt.Errorf("switch or group %s not found", name)
+}
+
+// lineControl applies state to the switches that name refers to, in the
+// same way as a POST /switch/{name} request
+func (s *Server) lineControl(state switchState, name string) error {
+	if s.readOnly {
+		return errors.New("server is read-only")
+	}
+
+	if s.maintenance.Load() {
+		log.Printf("maintenance mode: skipping line protocol command %s %s", state, name)
+		return errors.New("maintenance mode is on")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switches, err := s.lineSwitches(name)
+	if err != nil {
+		return err
+	}
+	name = s.canonicalName(name)
+	if _, exists := s.switches[name]; exists && switches[name].Switch.IsDisabled() {
+		return fmt.Errorf("switch %s is disabled", name)
+	}
+
+	// Stop anything running on the whole set of switches, as the
+	// equivalent API request does
+	if name == "all" {
+		s.cancelAllTasksAndTimers()
+	} else {
+		s.cancelTasksAndTimers(name)
+	}
+
+	req := switchRequest{State: state}
+	var errs []error
+	for _, switchName := range slices.Sorted(maps.Keys(switches)) {
+		resolvedSwitch := switches[switchName]
+		if resolvedSwitch.Switch.IsDisabled() {
+			continue
+		}
+		if err := s.handleSwitchHelper(nil, &req, switchName, resolvedSwitch.Switch); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// lineStatus returns a "<switch> <state>" line for each switch that name
+// refers to
+func (s *Server) lineStatus(name string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switches, err := s.lineSwitches(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply []string
+	for _, switchName := range slices.Sorted(maps.Keys(switches)) {
+		status, err := s.getStatusForSwitch(switchName, switches[switchName].Switch)
+		if err != nil {
+			return nil, err
+		}
+		reply = append(reply, fmt.Sprintf("%s %s", switchName, status.State))
+	}
+	return reply, nil
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/larsks/airdancer/internal/switchcollection"
+)
+
+func TestLineProtocol(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+	server.switches["switch3"].Switch.(*switchcollection.DummySwitch).SetDisabled(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, conn := net.Pipe()
+	defer client.Close() //nolint:errcheck
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.serveLineConn(ctx, conn)
+	}()
+
+	reader := bufio.NewReader(client)
+	send := func(command string) []string {
+		t.Helper()
+		if err := client.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatalf("SetDeadline() failed: %v", err)
+		}
+		if _, err := fmt.Fprintf(client, "%s\r\n", command); err != nil {
+			t.Fatalf("failed to send %q: %v", command, err)
+		}
+
+		var reply []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read reply to %q: %v", command, err)
+			}
+			line = strings.TrimRight(line, "\r\n")
+			reply = append(reply, line)
+			if line == "OK" || strings.HasPrefix(line, "ERR ") {
+				return reply
+			}
+		}
+	}
+
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"ON switch0", []string{"OK"}},
+		{"status switch0", []string{"switch0 on", "OK"}},
+		{"ON red", []string{"OK"}},
+		{"STATUS all", []string{"switch0 on", "switch1 on", "switch2 off", "switch3 disabled", "OK"}},
+		{"TOGGLE switch1", []string{"OK"}},
+		{"OFF all", []string{"OK"}},
+		{"STATUS red", []string{"switch0 off", "switch1 off", "OK"}},
+		{"ON switch3", []string{"ERR switch switch3 is disabled"}},
+		{"ON porch", []string{"ERR switch or group porch not found"}},
+		{"DIM switch0", []string{"ERR unknown command DIM"}},
+		{"ON", []string{"ERR usage: ON <name>"}},
+	}
+	for _, tt := range tests {
+		got := send(tt.command)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: reply = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+
+	if _, err := fmt.Fprintf(client, "QUIT\r\n"); err != nil {
+		t.Fatalf("failed to send QUIT: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not closed after QUIT")
+	}
+}
+
+func TestLineProtocolReadOnly(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+	server.readOnly = true
+
+	if _, err := server.lineCommand([]string{"ON", "switch0"}); err == nil {
+		t.Error("ON succeeded on a read-only server")
+	}
+	if reply, err := server.lineCommand([]string{"STATUS", "switch0"}); err != nil || len(reply) != 1 {
+		t.Errorf("STATUS on a read-only server = %q, %v; want one status line", reply, err)
+	}
+}
+
+func TestLineProtocolAliasesAndMaintenance(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+	server.aliases = map[string]string{"lamp": "switch0", "garden": "green"}
+
+	if _, err := server.lineCommand([]string{"ON", "garden"}); err != nil {
+		t.Fatalf("ON garden failed: %v", err)
+	}
+	reply, err := server.lineCommand([]string{"STATUS", "garden"})
+	if err != nil || strings.Join(reply, "|") != "switch2 on|switch3 on" {
+		t.Errorf("STATUS garden = %q, %v; want switch2 and switch3 on", reply, err)
+	}
+
+	server.maintenance.Store(true)
+	if _, err := server.lineCommand([]string{"ON", "lamp"}); err == nil {
+		t.Error("ON lamp succeeded in maintenance mode")
+	}
+	if on, _ := server.switches["switch0"].Switch.GetState(); on {
+		t.Error("ON lamp turned switch0 on in maintenance mode")
+	}
+	if reply, err := server.lineCommand([]string{"STATUS", "lamp"}); err != nil || strings.Join(reply, "|") != "switch0 off" {
+		t.Errorf("STATUS lamp in maintenance mode = %q, %v; want switch0 off", reply, err)
+	}
+
+	server.maintenance.Store(false)
+	if _, err := server.lineCommand([]string{"ON", "lamp"}); err != nil {
+		t.Fatalf("ON lamp failed after maintenance mode: %v", err)
+	}
+	if on, _ := server.switches["switch0"].Switch.GetState(); !on {
+		t.Error("ON lamp did not turn switch0 on")
+	}
+}
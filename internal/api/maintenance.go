@@ -0,0 +1,65 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// actionSourceHeader names the program that sent a request on behalf of an
+// automated action, such as a trigger command run by airdancer-monitor.
+// Requests without it are treated as coming from an operator.
+const actionSourceHeader = "X-Airdancer-Source"
+
+// maintenanceRequest is the body of a request to change maintenance mode.
+// If Enabled is omitted, maintenance mode is toggled.
+type maintenanceRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// maintenanceResponse reports whether maintenance mode is on
+type maintenanceResponse struct {
+	Maintenance bool `json:"maintenance"`
+}
+
+// maintenanceHandler turns maintenance mode on or off. While it is on,
+// automated actions are skipped, but operators can still control switches.
+func (s *Server) maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	var req maintenanceRequest
+	if !s.decodeJSONBody(w, r, &req, true) {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	enabled := !s.maintenance.Load()
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	if s.maintenance.Swap(enabled) != enabled {
+		if enabled {
+			log.Printf("maintenance mode is on: skipping automated actions")
+		} else {
+			log.Printf("maintenance mode is off")
+			s.reconcileSchedules()
+		}
+	}
+
+	s.sendSuccess(w, maintenanceResponse{Maintenance: enabled})
+}
+
+// skipAutomatedDuringMaintenance rejects requests sent on behalf of an
+// automated action (those with an X-Airdancer-Source header) while
+// maintenance mode is on
+func (s *Server) skipAutomatedDuringMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if source := r.Header.Get(actionSourceHeader); source != "" && s.maintenance.Load() {
+			log.Printf("maintenance mode: skipping %s %s from %s", r.Method, r.URL.Path, source)
+			s.sendErrorCode(w, fmt.Sprintf("Maintenance mode is on: skipped request from %s", source), http.StatusServiceUnavailable, errorCodeMaintenance, map[string]any{"source": source})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
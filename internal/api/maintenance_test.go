@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/larsks/airdancer/internal/clock"
+)
+
+// postSwitch sends body to POST /switch/switch0, with an X-Airdancer-Source
+// header if source is set
+func postSwitch(server *Server, body, source string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/switch/switch0", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if source != "" {
+		req.Header.Set(actionSourceHeader, source)
+	}
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	return w
+}
+
+// setMaintenance sends body to POST /maintenance and returns the resulting
+// maintenance mode
+func setMaintenance(t *testing.T, server *Server, body string) bool {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/maintenance", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /maintenance: status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data maintenanceResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp.Data.Maintenance
+}
+
+func TestMaintenanceSkipsSchedule(t *testing.T) {
+	server := createTestServer(t, 2)
+	defer server.Close()
+	fake := clock.NewFake(monday)
+	server.clock = fake
+
+	addSchedule(t, server, "party", ScheduleConfig{Switch: "switch0", Type: "once", At: "2025-01-06T10:30"})
+	server.startSchedules()
+
+	if w := serve(server, "POST", "/switch/switch1", `{"state": "on", "duration": 60}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/switch1: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if !setMaintenance(t, server, `{"enabled": true}`) {
+		t.Fatal("maintenance mode is off after enabling it")
+	}
+
+	fake.Advance(30 * time.Minute)
+
+	if on, _ := server.switches["switch0"].Switch.GetState(); on {
+		t.Error("a schedule turned switch0 on while maintenance mode was on")
+	}
+	// Timers set by an operator still expire
+	if on, _ := server.switches["switch1"].Switch.GetState(); on {
+		t.Error("the timer on switch1 did not turn it off while maintenance mode was on")
+	}
+}
+
+func TestMaintenanceSkipsAutomatedRequests(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+
+	// An empty body toggles maintenance mode
+	if !setMaintenance(t, server, "") {
+		t.Fatal("maintenance mode is off after toggling it on")
+	}
+
+	if w := postSwitch(server, `{"state": "on"}`, "monitor"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("automated request: status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if state, _ := server.switches["switch0"].Switch.GetState(); state {
+		t.Error("automated request turned the switch on while maintenance mode was on")
+	}
+
+	if w := postSwitch(server, `{"state": "on"}`, ""); w.Code != http.StatusOK {
+		t.Errorf("operator request: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if state, _ := server.switches["switch0"].Switch.GetState(); !state {
+		t.Error("operator request did not turn the switch on while maintenance mode was on")
+	}
+
+	req := httptest.NewRequest("GET", "/status", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	var resp struct {
+		Data serverStatusResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if !resp.Data.Maintenance {
+		t.Error("GET /status does not report maintenance mode")
+	}
+
+	if setMaintenance(t, server, `{"enabled": false}`) {
+		t.Fatal("maintenance mode is on after disabling it")
+	}
+	if w := postSwitch(server, `{"state": "off"}`, "monitor"); w.Code != http.StatusOK {
+		t.Errorf("automated request after maintenance: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
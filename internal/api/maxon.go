@@ -0,0 +1,134 @@
+package api
+
+import (
+	"log"
+	"maps"
+	"slices"
+	"time"
+)
+
+// maxOnCheckInterval is how often the max-on reaper looks for switches that
+// have been on for too long. Switches with a shorter limit are checked as
+// often as their limit.
+const maxOnCheckInterval = time.Minute
+
+// maxOnInterval returns how often the max-on reaper runs, or 0 if no switch
+// has a max-on limit. The caller must hold s.mutex.
+func (s *Server) maxOnInterval() time.Duration {
+	var interval time.Duration
+	for _, resolvedSwitch := range s.switches {
+		if resolvedSwitch.MaxOn == 0 {
+			continue
+		}
+		if interval == 0 || resolvedSwitch.MaxOn < interval {
+			interval = resolvedSwitch.MaxOn
+		}
+	}
+	return min(interval, maxOnCheckInterval)
+}
+
+// startMaxOnReaper starts turning off switches that have been on for longer
+// than their max-on limit, if any switch has one
+func (s *Server) startMaxOnReaper() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	interval := s.maxOnInterval()
+	if interval == 0 {
+		return
+	}
+
+	var reap func()
+	reap = func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.maxOnReaper == nil {
+			return
+		}
+		s.reapSwitches()
+		s.maxOnReaper = s.clock.AfterFunc(interval, reap)
+	}
+	s.maxOnReaper = s.clock.AfterFunc(interval, reap)
+}
+
+// stopMaxOnReaper stops the max-on reaper
+func (s *Server) stopMaxOnReaper() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.maxOnReaper != nil {
+		s.maxOnReaper.Stop()
+		s.maxOnReaper = nil
+	}
+}
+
+// inActiveTask returns true if a blink or flipflop is running on switchName,
+// on a group it belongs to, or on all switches. The caller must hold
+// s.mutex.
+func (s *Server) inActiveTask(switchName string) bool {
+	covers := func(name string) bool {
+		if name == switchName || name == "all" {
+			return true
+		}
+		group, isGroup := s.groups[name]
+		if !isGroup {
+			return false
+		}
+		_, member := group.GetSwitches()[switchName]
+		return member
+	}
+
+	for name, blinker := range s.blinkers {
+		if blinker.IsRunning() && covers(name) {
+			return true
+		}
+	}
+	for name, flipflopInstance := range s.flipflops {
+		if flipflopInstance.IsRunning() && covers(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// reapSwitches turns off every switch that has been on for longer than its
+// max-on limit, publishing a max-on-off event once it has. The limit is
+// measured from the last time the switch was turned on, so turning on a
+// switch that is already on extends it; a switch found on without a
+// recorded on time (for example, one turned on at startup) is recorded as
+// turned on now. Switches in a running blink or flipflop are skipped. The
+// caller must hold s.mutex.
+func (s *Server) reapSwitches() {
+	now := s.clock.Now()
+	for _, switchName := range slices.Sorted(maps.Keys(s.switches)) {
+		resolvedSwitch := s.switches[switchName]
+		if resolvedSwitch.MaxOn == 0 || resolvedSwitch.Switch.IsDisabled() || s.inActiveTask(switchName) {
+			continue
+		}
+
+		on, err := resolvedSwitch.Switch.GetState()
+		if err != nil || !on {
+			continue
+		}
+		change, ok := s.lastStateChange(switchName)
+		if !ok || change.state != switchStateOn {
+			s.recordStateChange(switchName, switchStateOn)
+			continue
+		}
+		if now.Sub(change.onAt) < resolvedSwitch.MaxOn {
+			continue
+		}
+
+		log.Printf("switch %s has been on for more than %s, turning it off", switchName, resolvedSwitch.MaxOn)
+		s.cancelTasksAndTimers(switchName)
+		if err := resolvedSwitch.Switch.TurnOff(); err != nil {
+			log.Printf("failed to turn off switch %s after its maximum on time: %v", switchName, err)
+			continue
+		}
+		delete(s.onSince, switchName)
+		s.publishSwitchEvent(switchName, "max-on-off")
+		s.publishSwitchEvent(switchName, "off")
+		s.recordSwitchStates(switchName)
+		s.disarmWatchdog(switchName)
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMaxOnReaperTurnsSwitchOff(t *testing.T) {
+	server := createTestServer(t, 3)
+	defer server.Close()
+	fake := useFakeClock(server)
+	server.switches["switch0"].MaxOn = 10 * time.Second
+	server.switches["switch2"].MaxOn = 10 * time.Second
+
+	isOn := func(switchName string) bool {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		on, _ := server.switches[switchName].Switch.GetState()
+		return on
+	}
+
+	events := server.events.subscribe()
+	defer server.events.unsubscribe(events)
+
+	for _, req := range []struct{ switchName, body string }{
+		{"switch0", `{"state": "on"}`},
+		{"switch1", `{"state": "on"}`},
+		{"switch2", `{"state": "blink", "period": 1000}`},
+	} {
+		if w := serve(server, "POST", "/switch/"+req.switchName, req.body); w.Code != http.StatusOK {
+			t.Fatalf("POST /switch/%s: status = %d, body: %s", req.switchName, w.Code, w.Body.String())
+		}
+	}
+	fake.BlockUntil(1)
+	server.startMaxOnReaper()
+
+	fake.Advance(5 * time.Second)
+	if !isOn("switch0") {
+		t.Fatal("switch0 was turned off before its maximum on time")
+	}
+	fake.Advance(5 * time.Second)
+	if isOn("switch0") {
+		t.Error("switch0 is still on after its maximum on time")
+	}
+	if !isOn("switch1") {
+		t.Error("switch1, which has no maximum on time, was turned off")
+	}
+	server.mutex.Lock()
+	blinking := server.inActiveTask("switch2")
+	server.mutex.Unlock()
+	if !blinking {
+		t.Error("blink on switch2 was stopped by the max-on reaper")
+	}
+
+	warned := false
+	for len(events) > 0 {
+		event := <-events
+		if data, ok := event.data.(switchEvent); ok && data == (switchEvent{Switch: "switch0", Event: "max-on-off"}) {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Error("no max-on-off event was published for switch0")
+	}
+}
+
+func TestMaxOnExtendedByOnCommand(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+	fake := useFakeClock(server)
+	server.switches["switch0"].MaxOn = 10 * time.Second
+
+	isOn := func() bool {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		on, _ := server.switches["switch0"].Switch.GetState()
+		return on
+	}
+
+	if w := serve(server, "POST", "/switch/switch0", `{"state": "on"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/switch0: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	server.startMaxOnReaper()
+
+	// Turning the switch on again restarts its limit
+	fake.Advance(5 * time.Second)
+	if w := serve(server, "POST", "/switch/switch0", `{"state": "on"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/switch0: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	fake.Advance(5 * time.Second)
+	if !isOn() {
+		t.Fatal("switch0 was turned off although it was turned on again before its limit")
+	}
+	// The reaper checks again after another 10 seconds
+	fake.Advance(10 * time.Second)
+	if isOn() {
+		t.Error("switch0 is still on after its limit since it was last turned on")
+	}
+}
+
+func TestMaxOnSwitchOverride(t *testing.T) {
+	zero, twenty := 0, 20
+	cfg := NewConfig()
+	cfg.MaxOnSeconds = 60
+	cfg.Collections["dummy"] = CollectionConfig{Driver: "dummy", DriverConfig: map[string]interface{}{"switch-count": 3}}
+	cfg.Switches["default"] = SwitchConfig{Spec: SwitchSpec{"dummy.0"}}
+	cfg.Switches["exempt"] = SwitchConfig{Spec: SwitchSpec{"dummy.1"}, MaxOnSeconds: &zero}
+	cfg.Switches["short"] = SwitchConfig{Spec: SwitchSpec{"dummy.2"}, MaxOnSeconds: &twenty}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer server.Close()
+
+	for switchName, want := range map[string]time.Duration{
+		"default": time.Minute,
+		"exempt":  0,
+		"short":   20 * time.Second,
+	} {
+		if got := server.switches[switchName].MaxOn; got != want {
+			t.Errorf("switch %s: MaxOn = %s, want %s", switchName, got, want)
+		}
+	}
+}
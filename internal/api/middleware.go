@@ -2,9 +2,14 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -15,20 +20,22 @@ type (
 
 const switchRequestKey contextKey = "switchRequest"
 
-// validateSwitchName validates that the switch name parameter is either "all" or a valid switch name
+// validateSwitchName validates that the switch name parameter is either "all" or a valid switch name,
+// after replacing an alias with the name it refers to
 func (s *Server) validateSwitchName(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.resolveAlias(r)
 		switchName := chi.URLParam(r, "name")
 
 		if switchName == "" {
-			s.sendError(w, "Switch name is required", http.StatusBadRequest)
+			s.sendErrorCode(w, "Switch name is required", http.StatusBadRequest, errorCodeInvalidRequest, nil)
 			return
 		}
 
 		if switchName != "all" {
 			if _, exists := s.switches[switchName]; !exists {
-				if _, exists := s.groups[switchName]; !exists {
-					s.sendError(w, fmt.Sprintf("Unknown switch or group name: %s", switchName), http.StatusNotFound)
+				if !s.groupExists(switchName) {
+					s.sendErrorCode(w, fmt.Sprintf("Unknown switch or group name: %s", switchName), http.StatusNotFound, errorCodeSwitchNotFound, map[string]any{"switch": switchName})
 					return
 				}
 			}
@@ -38,12 +45,45 @@ func (s *Server) validateSwitchName(next http.Handler) http.Handler {
 	})
 }
 
+// rejectIfReadOnly rejects requests when the server is running in read-only mode
+func (s *Server) rejectIfReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.readOnly {
+			s.sendErrorCode(w, "Server is read-only", http.StatusForbidden, errorCodeReadOnly, nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAPIKey rejects requests that do not carry the configured API key
+// as a bearer token. If no API key is configured, every request is
+// rejected, so that endpoints behind it are never public.
+func (s *Server) requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.apiKey == "" {
+			s.sendErrorCode(w, "This endpoint requires an API key, and none is configured", http.StatusForbidden, errorCodeUnauthorized, nil)
+			return
+		}
+
+		key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(key), []byte(s.apiKey)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			s.sendErrorCode(w, "A valid API key is required", http.StatusUnauthorized, errorCodeUnauthorized, nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // validateJSONRequest validates that the request has proper JSON content type
 func (s *Server) validateJSONRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		contentType := r.Header.Get("Content-Type")
 		if contentType != "" && contentType != "application/json" {
-			s.sendError(w, "Content-Type must be application/json", http.StatusBadRequest)
+			s.sendErrorCode(w, "Content-Type must be application/json", http.StatusBadRequest, errorCodeInvalidRequest, map[string]any{"header": "Content-Type"})
 			return
 		}
 
@@ -51,39 +91,127 @@ func (s *Server) validateJSONRequest(next http.Handler) http.Handler {
 	})
 }
 
+// limitRequestBody rejects request bodies larger than s.maxBodyBytes
+func (s *Server) limitRequestBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeJSONBody decodes the request body into v, rejecting fields that v
+// does not have. If it fails, it sends an error response and returns
+// false. An empty body is accepted (leaving v unchanged) if allowEmpty is
+// set.
+func (s *Server) decodeJSONBody(w http.ResponseWriter, r *http.Request, v any, allowEmpty bool) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err == nil || (allowEmpty && errors.Is(err, io.EOF)) {
+		return true
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		s.sendErrorCode(w, fmt.Sprintf("Request body is larger than %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge, errorCodeBodyTooLarge,
+			map[string]any{"limit": maxBytesErr.Limit})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		s.sendInvalidField(w, fmt.Sprintf("Unknown field %q", field), field)
+	default:
+		s.sendErrorCode(w, "Invalid JSON format", http.StatusBadRequest, errorCodeInvalidRequest, nil)
+	}
+	return false
+}
+
 // validateSwitchRequest validates and parses the switch request JSON body
 func (s *Server) validateSwitchRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var req switchRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			s.sendError(w, "Invalid JSON format", http.StatusBadRequest)
+		if !s.decodeJSONBody(w, r, &req, false) {
 			return
 		}
 
 		// Validate state field
 		if req.State != switchStateOn && req.State != switchStateOff && req.State != switchStateBlink && req.State != switchStateToggle && req.State != switchStateFlipflop {
-			s.sendError(w, "State must be 'on', 'off', 'toggle', 'blink', or 'flipflop'", http.StatusBadRequest)
+			s.sendErrorCode(w, "State must be 'on', 'off', 'toggle', 'blink', or 'flipflop'", http.StatusBadRequest, errorCodeInvalidState,
+				map[string]any{"field": "state", "allowed": []switchState{switchStateOn, switchStateOff, switchStateToggle, switchStateBlink, switchStateFlipflop}})
 			return
 		}
 
 		// Validate duration field if present
 		if req.Duration != nil && *req.Duration <= 0 {
-			s.sendError(w, "Duration must be positive", http.StatusBadRequest)
+			s.sendInvalidField(w, "Duration must be positive", "duration")
 			return
 		}
 
 		if req.State == "blink" || req.State == "flipflop" {
+			if req.Period == nil && s.defaultPeriod > 0 {
+				period := s.defaultPeriod
+				req.Period = &period
+			}
 			if req.Period == nil {
-				s.sendError(w, fmt.Sprintf("Period is required for %s state", req.State), http.StatusBadRequest)
+				s.sendInvalidField(w, fmt.Sprintf("Period is required for %s state", req.State), "period")
 				return
 			}
 			if *req.Period <= 0 {
-				s.sendError(w, "Period must be positive", http.StatusBadRequest)
+				s.sendInvalidField(w, "Period must be positive", "period")
 				return
 			}
 
 			if req.DutyCycle != nil && (*req.DutyCycle < 0 || *req.DutyCycle > 1) {
-				s.sendError(w, "DutyCycle must be between 0 and 1", http.StatusBadRequest)
+				s.sendInvalidField(w, "DutyCycle must be between 0 and 1", "dutyCycle")
+				return
+			}
+
+			if req.Phase != nil && (*req.Phase < 0 || *req.Phase > 1) {
+				s.sendInvalidField(w, "Phase must be between 0 and 1", "phase")
+				return
+			}
+
+			if req.Jitter != nil && (*req.Jitter < 0 || *req.Jitter > 1) {
+				s.sendInvalidField(w, "Jitter must be between 0 and 1", "jitter")
+				return
+			}
+		} else if req.Phase != nil || req.Jitter != nil {
+			s.sendInvalidField(w, "Phase and jitter are only supported for blink and flipflop states", "state")
+			return
+		}
+
+		if req.Stagger != nil {
+			if req.State != switchStateBlink || chi.URLParam(r, "name") != "all" {
+				s.sendInvalidField(w, "Stagger is only supported for blinking all switches", "stagger")
+				return
+			}
+			if *req.Stagger < 0 {
+				s.sendInvalidField(w, "Stagger cannot be negative", "stagger")
+				return
+			}
+		}
+
+		if value := r.URL.Query().Get(dryRunQueryParam); value != "" {
+			dryRun, err := strconv.ParseBool(value)
+			if err != nil {
+				s.sendInvalidField(w, fmt.Sprintf("%s must be true or false", dryRunQueryParam), dryRunQueryParam)
+				return
+			}
+			req.dryRun = dryRun
+		}
+
+		if req.Transactional && !s.groupExists(chi.URLParam(r, "name")) {
+			s.sendInvalidField(w, "Transactional is only supported for groups", "transactional")
+			return
+		}
+
+		if req.RestoreOnStop {
+			if req.State != switchStateBlink && req.State != switchStateFlipflop {
+				s.sendInvalidField(w, "RestoreOnStop is only supported for blink and flipflop states", "restoreOnStop")
+				return
+			}
+			if req.Duration == nil {
+				s.sendInvalidField(w, "RestoreOnStop requires a duration", "duration")
 				return
 			}
 		}
@@ -92,11 +220,11 @@ func (s *Server) validateSwitchRequest(next http.Handler) http.Handler {
 		if req.State == "flipflop" {
 			switchName := chi.URLParam(r, "name")
 			if switchName == "all" {
-				s.sendError(w, "Flipflop state is not supported for 'all' switches", http.StatusBadRequest)
+				s.sendErrorCode(w, "Flipflop state is not supported for 'all' switches", http.StatusBadRequest, errorCodeInvalidState, map[string]any{"field": "state"})
 				return
 			}
 			if _, exists := s.switches[switchName]; exists {
-				s.sendError(w, "Flipflop state is only supported for switch groups, not individual switches", http.StatusBadRequest)
+				s.sendErrorCode(w, "Flipflop state is only supported for switch groups, not individual switches", http.StatusBadRequest, errorCodeInvalidState, map[string]any{"field": "state"})
 				return
 			}
 		}
@@ -107,6 +235,11 @@ func (s *Server) validateSwitchRequest(next http.Handler) http.Handler {
 	})
 }
 
+// sendInvalidField reports a request whose field has an invalid value
+func (s *Server) sendInvalidField(w http.ResponseWriter, message, field string) {
+	s.sendErrorCode(w, message, http.StatusBadRequest, errorCodeInvalidRequest, map[string]any{"field": field})
+}
+
 // validateSwitchExists validates that the requested switch(es) exist
 func (s *Server) validateSwitchExists(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -114,8 +247,8 @@ func (s *Server) validateSwitchExists(next http.Handler) http.Handler {
 
 		if switchName != "all" {
 			if _, exists := s.switches[switchName]; !exists {
-				if _, exists := s.groups[switchName]; !exists {
-					s.sendError(w, fmt.Sprintf("Switch or group %s not found", switchName), http.StatusNotFound)
+				if !s.groupExists(switchName) {
+					s.sendErrorCode(w, fmt.Sprintf("Switch or group %s not found", switchName), http.StatusNotFound, errorCodeSwitchNotFound, map[string]any{"switch": switchName})
 					return
 				}
 			}
@@ -2,8 +2,10 @@ package api
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
 
@@ -222,6 +224,66 @@ func TestValidateSwitchRequest(t *testing.T) {
 			wantHandlerCalled: false,
 			wantErrorMsg:      "State must be 'on', 'off', 'toggle', 'blink', or 'flipflop'",
 		},
+		{
+			name:              "valid blink with restoreOnStop",
+			requestBody:       `{"state":"blink","period":1,"duration":5,"restoreOnStop":true}`,
+			wantStatus:        http.StatusOK,
+			wantHandlerCalled: true,
+		},
+		{
+			name:              "restoreOnStop without duration",
+			requestBody:       `{"state":"blink","period":1,"restoreOnStop":true}`,
+			wantStatus:        http.StatusBadRequest,
+			wantHandlerCalled: false,
+			wantErrorMsg:      "RestoreOnStop requires a duration",
+		},
+		{
+			name:              "restoreOnStop with on state",
+			requestBody:       `{"state":"on","duration":5,"restoreOnStop":true}`,
+			wantStatus:        http.StatusBadRequest,
+			wantHandlerCalled: false,
+			wantErrorMsg:      "RestoreOnStop is only supported for blink and flipflop states",
+		},
+		{
+			name:              "valid blink with phase",
+			requestBody:       `{"state":"blink","period":1,"phase":0.5}`,
+			wantStatus:        http.StatusOK,
+			wantHandlerCalled: true,
+		},
+		{
+			name:              "phase out of range",
+			requestBody:       `{"state":"blink","period":1,"phase":1.5}`,
+			wantStatus:        http.StatusBadRequest,
+			wantHandlerCalled: false,
+			wantErrorMsg:      "Phase must be between 0 and 1",
+		},
+		{
+			name:              "phase with on state",
+			requestBody:       `{"state":"on","phase":0.5}`,
+			wantStatus:        http.StatusBadRequest,
+			wantHandlerCalled: false,
+			wantErrorMsg:      "Phase and jitter are only supported for blink and flipflop states",
+		},
+		{
+			name:              "stagger with on state",
+			requestBody:       `{"state":"on","stagger":0.1}`,
+			wantStatus:        http.StatusBadRequest,
+			wantHandlerCalled: false,
+			wantErrorMsg:      "Stagger is only supported for blinking all switches",
+		},
+		{
+			name:              "valid blink with jitter",
+			requestBody:       `{"state":"blink","period":1,"jitter":0.2}`,
+			wantStatus:        http.StatusOK,
+			wantHandlerCalled: true,
+		},
+		{
+			name:              "jitter out of range",
+			requestBody:       `{"state":"blink","period":1,"jitter":-0.2}`,
+			wantStatus:        http.StatusBadRequest,
+			wantHandlerCalled: false,
+			wantErrorMsg:      "Jitter must be between 0 and 1",
+		},
 		{
 			name:              "zero duration",
 			requestBody:       `{"state":"on","duration":0}`,
@@ -243,6 +305,13 @@ func TestValidateSwitchRequest(t *testing.T) {
 			wantHandlerCalled: false,
 			wantErrorMsg:      "State must be 'on', 'off', 'toggle', 'blink', or 'flipflop'",
 		},
+		{
+			name:              "unknown field",
+			requestBody:       `{"state":"on","durration":10}`,
+			wantStatus:        http.StatusBadRequest,
+			wantHandlerCalled: false,
+			wantErrorMsg:      `Unknown field \"durration\"`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -273,6 +342,43 @@ func TestValidateSwitchRequest(t *testing.T) {
 	}
 }
 
+func TestLimitRequestBody(t *testing.T) {
+	server := createTestServer(t, 1)
+	server.maxBodyBytes = 64
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   errorCode
+	}{
+		{"within limit", `{"state":"on"}`, http.StatusOK, ""},
+		{"too large", `{"state":"on","duration":1` + strings.Repeat(" ", 64) + `}`, http.StatusRequestEntityTooLarge, errorCodeBodyTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/switch/switch0", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			var resp APIResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if resp.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", resp.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
 func TestValidateSwitchExists(t *testing.T) {
 	server := createTestServer(t, 3) // Create server with 3 switches (switch0, switch1, switch2)
 
@@ -501,3 +607,56 @@ func TestMiddlewareChain(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateSwitchNameAliases(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+	server.aliases = map[string]string{"porch-light": "switch0", "garden": "green"}
+
+	// An alias reaches the switch it refers to
+	if w := serve(server, "POST", "/switch/porch-light", `{"state": "on"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/porch-light status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if on, _ := server.switches["switch0"].Switch.GetState(); !on {
+		t.Error("POST /switch/porch-light did not turn on switch0")
+	}
+
+	// Status responses report the aliases of switches and groups
+	w := serve(server, "GET", "/switch/porch-light", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /switch/porch-light status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var switchStatus struct {
+		Data switchResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&switchStatus); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !switchStatus.Data.CurrentState || !slices.Equal(switchStatus.Data.Aliases, []string{"porch-light"}) {
+		t.Errorf("GET /switch/porch-light = %+v, want switch0 on with alias porch-light", switchStatus.Data)
+	}
+
+	w = serve(server, "GET", "/switch/garden", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /switch/garden status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var groupStatus struct {
+		Data multiSwitchResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&groupStatus); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if groupStatus.Data.Count != 2 || !slices.Equal(groupStatus.Data.Aliases, []string{"garden"}) {
+		t.Errorf("GET /switch/garden = %+v, want group green with alias garden", groupStatus.Data)
+	}
+
+	// An unknown alias is not found
+	if w := serve(server, "POST", "/switch/back-porch", `{"state": "on"}`); w.Code != http.StatusNotFound {
+		t.Errorf("POST /switch/back-porch status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// A group cannot be created with the name of an alias
+	if w := serve(server, "POST", "/group/garden", `{"switches": ["switch1"]}`); w.Code != http.StatusConflict {
+		t.Errorf("POST /group/garden status = %d, want %d", w.Code, http.StatusConflict)
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"log"
+	"time"
+
+	"github.com/larsks/airdancer/internal/switchcollection"
+)
+
+// minOnRemaining returns how much longer switch swid must stay on before it
+// may be turned off, or 0 if it may be turned off now. The caller must hold
+// s.mutex.
+func (s *Server) minOnRemaining(swid string) time.Duration {
+	resolvedSwitch, exists := s.switches[swid]
+	if !exists || resolvedSwitch.MinOn == 0 {
+		return 0
+	}
+	since, on := s.onSince[swid]
+	if !on {
+		return 0
+	}
+	return max(resolvedSwitch.MinOn-s.clock.Now().Sub(since), 0)
+}
+
+// minOnTracked returns true if switch swid is on and the time it was turned
+// on is known, so that turning it on again does not restart its minimum on
+// time. The caller must hold s.mutex.
+func (s *Server) minOnTracked(swid string, sw switchcollection.Switch) bool {
+	if _, tracked := s.onSince[swid]; !tracked {
+		return false
+	}
+	on, err := sw.GetState()
+	if err != nil || !on {
+		// The switch was turned off some other way, for example by a
+		// blink that was stopped
+		delete(s.onSince, swid)
+		return false
+	}
+	return true
+}
+
+// deferTurnOff turns switch swid off after wait, once its minimum on time
+// has passed. The pending off is an ordinary timer on the switch, so a
+// later request on the switch replaces it. The caller must hold s.mutex.
+func (s *Server) deferTurnOff(swid string, sw switchcollection.Switch, wait time.Duration) {
+	log.Printf("deferring turning off %s for %s until its minimum on time has passed", swid, wait)
+	stop := func() {
+		if err := sw.TurnOff(); err != nil {
+			log.Printf("failed to turn off switch %s after its minimum on time: %v", swid, err)
+			return
+		}
+		delete(s.onSince, swid)
+		s.publishSwitchEvent(swid, "off")
+		s.recordSwitchStates(swid)
+		s.disarmWatchdog(swid)
+	}
+	s.timers[swid] = &timerData{
+		duration: wait,
+		expires:  s.clock.Now().Add(wait),
+		stop:     stop,
+		timer: s.clock.AfterFunc(wait, func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			delete(s.timers, swid)
+
+			stop()
+			log.Printf("turned off %s after its minimum on time", swid)
+		}),
+	}
+}
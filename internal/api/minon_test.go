@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMinOnDefersEarlyOff(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+	fake := useFakeClock(server)
+	server.switches["switch0"].MinOn = 10 * time.Second
+
+	isOn := func() bool {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		on, _ := server.switches["switch0"].Switch.GetState()
+		return on
+	}
+
+	if w := serve(server, "POST", "/switch/switch0", `{"state": "on"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST on: status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	// An off request 3 seconds after the switch was turned on is deferred
+	// until it has been on for 10 seconds
+	fake.Advance(3 * time.Second)
+	if w := serve(server, "POST", "/switch/switch0", `{"state": "off"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST off: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if !isOn() {
+		t.Fatal("switch0 was turned off before its minimum on time")
+	}
+	fake.Advance(6 * time.Second)
+	if !isOn() {
+		t.Fatal("switch0 was turned off before its minimum on time")
+	}
+	fake.Advance(time.Second)
+	if isOn() {
+		t.Fatal("deferred off was not executed once the minimum on time passed")
+	}
+
+	// Once the minimum on time has passed, off takes effect at once
+	if w := serve(server, "POST", "/switch/switch0", `{"state": "on"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST on: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	fake.Advance(10 * time.Second)
+	if w := serve(server, "POST", "/switch/switch0", `{"state": "off"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST off: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if isOn() {
+		t.Error("off after the minimum on time was not executed at once")
+	}
+}
+
+func TestMinOnDeferredOffReplacedByOn(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+	fake := useFakeClock(server)
+	server.switches["switch0"].MinOn = 10 * time.Second
+
+	for _, body := range []string{`{"state": "on"}`, `{"state": "off"}`, `{"state": "on"}`} {
+		if w := serve(server, "POST", "/switch/switch0", body); w.Code != http.StatusOK {
+			t.Fatalf("POST %s: status = %d, body: %s", body, w.Code, w.Body.String())
+		}
+	}
+
+	// The later on request canceled the pending off
+	fake.Advance(time.Minute)
+	if on, _ := server.switches["switch0"].Switch.GetState(); !on {
+		t.Error("pending off was executed although a later request turned the switch on")
+	}
+}
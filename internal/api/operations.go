@@ -0,0 +1,208 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/larsks/airdancer/internal/blink"
+	"github.com/larsks/airdancer/internal/flipflop"
+)
+
+// operation is a long-running task started by a switch request: a blink,
+// a flipflop, or a duration timer. Its ID lets clients cancel it without
+// naming the switch, so that canceling an operation that has finished
+// never stops a task that a later request started on the same switch.
+type operation struct {
+	ID      string      `json:"id"`
+	Target  string      `json:"target"`
+	State   switchState `json:"state"`
+	Started time.Time   `json:"started"`
+	// Expires is set if the operation was given a duration
+	Expires *time.Time `json:"expires,omitempty"`
+
+	tasks []operationTask
+}
+
+// operationTask records the timer, blinker, and flipflop an operation
+// started under key (a switch or group name). The operation is running
+// for as long as any of them is still the one stored under key.
+type operationTask struct {
+	key      string
+	timer    *timerData
+	blinker  *blink.Blink
+	flipflop *flipflop.Flipflop
+}
+
+// operationResponse is the response to a switch request: the request, and
+// the ID of the operation it started, if any
+type operationResponse struct {
+	switchRequest
+	OperationID string `json:"operationId,omitempty"`
+}
+
+// readRandom fills operation IDs; tests replace it to simulate a failing
+// random source
+var readRandom = rand.Read
+
+// newOperationID returns a random operation ID
+func newOperationID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := readRandom(b); err != nil {
+		return "", fmt.Errorf("failed to generate operation ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// startOperation records the tasks that req started under keys as an
+// operation on target, and returns its ID, or "" if req started no tasks.
+// The caller must hold s.mutex.
+func (s *Server) startOperation(target string, req switchRequest, keys []string) (string, error) {
+	op := &operation{
+		Target:  target,
+		State:   req.State,
+		Started: s.clock.Now(),
+	}
+	for _, key := range keys {
+		task := operationTask{key: key, timer: s.timers[key], blinker: s.blinkers[key], flipflop: s.flipflops[key]}
+		if task.timer != nil || task.blinker != nil || task.flipflop != nil {
+			op.tasks = append(op.tasks, task)
+		}
+	}
+	if len(op.tasks) == 0 {
+		return "", nil
+	}
+	id, err := newOperationID()
+	if err != nil {
+		return "", err
+	}
+	op.ID = id
+	if req.Duration != nil {
+		expires := op.Started.Add(time.Duration(*req.Duration) * time.Second)
+		op.Expires = &expires
+	}
+
+	s.pruneOperations()
+	s.operations[op.ID] = op
+	log.Printf("start operation %s (%s on %s)", op.ID, op.State, op.Target)
+	return op.ID, nil
+}
+
+// sendOperation records the tasks that req started under keys as an
+// operation on target and responds with its ID. The switches have already
+// changed by then, so a failure here is reported as a server error rather
+// than a bad request. The caller must hold s.mutex.
+func (s *Server) sendOperation(w http.ResponseWriter, target string, req switchRequest, keys []string) {
+	id, err := s.startOperation(target, req, keys)
+	if err != nil {
+		log.Printf("start operation on %s: %v", target, err)
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.sendSuccess(w, operationResponse{switchRequest: req, OperationID: id})
+}
+
+// operationRunning returns true if any of the tasks of op is still running.
+// The caller must hold s.mutex.
+func (s *Server) operationRunning(op *operation) bool {
+	for _, task := range op.tasks {
+		if task.timer != nil && s.timers[task.key] == task.timer {
+			return true
+		}
+		if task.blinker != nil && s.blinkers[task.key] == task.blinker && task.blinker.IsRunning() {
+			return true
+		}
+		if task.flipflop != nil && s.flipflops[task.key] == task.flipflop && task.flipflop.IsRunning() {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneOperations forgets operations that are no longer running. The
+// caller must hold s.mutex.
+func (s *Server) pruneOperations() {
+	for id, op := range s.operations {
+		if !s.operationRunning(op) {
+			delete(s.operations, id)
+		}
+	}
+}
+
+// cancelOperation stops the tasks of op that are still running. Tasks with
+// a timer end as they would when the timer expires, so switches are turned
+// off, or restored if the request set restoreOnStop. The caller must hold
+// s.mutex.
+func (s *Server) cancelOperation(op *operation) {
+	for _, task := range op.tasks {
+		if task.timer != nil && s.timers[task.key] == task.timer {
+			task.timer.timer.Stop()
+			delete(s.timers, task.key)
+			task.timer.stop()
+		}
+
+		if task.blinker != nil && s.blinkers[task.key] == task.blinker {
+			if task.blinker.IsRunning() {
+				if err := task.blinker.Stop(); err != nil {
+					log.Printf("failed to stop blinker on %s: %v", task.key, err)
+				}
+			}
+			delete(s.blinkers, task.key)
+		}
+
+		if task.flipflop != nil && s.flipflops[task.key] == task.flipflop {
+			if task.flipflop.IsRunning() {
+				if err := task.flipflop.Stop(); err != nil {
+					log.Printf("failed to stop flipflop on %s: %v", task.key, err)
+				}
+			}
+			delete(s.flipflops, task.key)
+		}
+	}
+	delete(s.operations, op.ID)
+}
+
+// operationListHandler lists the running operations, oldest first
+func (s *Server) operationListHandler(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pruneOperations()
+	operations := make([]*operation, 0, len(s.operations))
+	for _, op := range s.operations {
+		operations = append(operations, op)
+	}
+	slices.SortFunc(operations, func(a, b *operation) int {
+		if c := a.Started.Compare(b.Started); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	s.sendSuccess(w, operations)
+}
+
+// operationCancelHandler cancels a running operation
+func (s *Server) operationCancelHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	op, exists := s.operations[id]
+	if !exists || !s.operationRunning(op) {
+		delete(s.operations, id)
+		s.sendErrorCode(w, fmt.Sprintf("Operation %s not found or no longer running", id), http.StatusNotFound, errorCodeOperationNotFound, map[string]any{"operation": id})
+		return
+	}
+
+	log.Printf("canceling operation %s (%s on %s)", op.ID, op.State, op.Target)
+	s.cancelOperation(op)
+	s.sendSuccess(w, op)
+}
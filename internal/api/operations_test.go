@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// startOperation sends body to POST path and returns the ID of the
+// operation it started
+func startOperation(t *testing.T, server *Server, path, body string) string {
+	t.Helper()
+	w := serve(server, "POST", path, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST %s: status = %d, body: %s", path, w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data operationResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp.Data.OperationID
+}
+
+// listOperations returns the running operations
+func listOperations(t *testing.T, server *Server) []operation {
+	t.Helper()
+	w := serve(server, "GET", "/operation", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /operation: status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data []operation `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp.Data
+}
+
+func TestOperationStartListCancel(t *testing.T) {
+	server := createTestServer(t, 2)
+	defer server.Close()
+	useFakeClock(server)
+
+	id := startOperation(t, server, "/switch/switch0", `{"state": "blink", "period": 1}`)
+	if id == "" {
+		t.Fatal("blink did not return an operation ID")
+	}
+	if other := startOperation(t, server, "/switch/switch1", `{"state": "on"}`); other != "" {
+		t.Errorf("on without a duration returned operation ID %q, want none", other)
+	}
+
+	operations := listOperations(t, server)
+	if len(operations) != 1 {
+		t.Fatalf("GET /operation returned %d operations, want 1: %+v", len(operations), operations)
+	}
+	if op := operations[0]; op.ID != id || op.Target != "switch0" || op.State != switchStateBlink || op.Expires != nil {
+		t.Errorf("GET /operation returned %+v, want blink on switch0 with ID %s and no expiry", op, id)
+	}
+
+	if w := serve(server, "DELETE", "/operation/"+id, ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE /operation/%s: status = %d, body: %s", id, w.Code, w.Body.String())
+	}
+	if _, exists := server.blinkers["switch0"]; exists {
+		t.Error("blinker on switch0 is still running after its operation was canceled")
+	}
+	if on, _ := server.switches["switch0"].Switch.GetState(); on {
+		t.Error("switch0 is on after its operation was canceled")
+	}
+	if on, _ := server.switches["switch1"].Switch.GetState(); !on {
+		t.Error("canceling an operation on switch0 turned off switch1")
+	}
+	if operations := listOperations(t, server); len(operations) != 0 {
+		t.Errorf("GET /operation returned %+v after cancel, want none", operations)
+	}
+
+	w := serve(server, "DELETE", "/operation/"+id, "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("second DELETE /operation/%s: status = %d, want %d", id, w.Code, http.StatusNotFound)
+	}
+	var resp APIResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Code != errorCodeOperationNotFound {
+		t.Errorf("code = %q, want %q", resp.Code, errorCodeOperationNotFound)
+	}
+}
+
+func TestOperationCancelAfterReplaced(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+	useFakeClock(server)
+
+	first := startOperation(t, server, "/switch/switch0", `{"state": "blink", "period": 1}`)
+	second := startOperation(t, server, "/switch/switch0", `{"state": "blink", "period": 2}`)
+
+	// The first blink was replaced, so canceling it must not stop the
+	// second
+	if w := serve(server, "DELETE", "/operation/"+first, ""); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE of replaced operation: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if blinker, exists := server.blinkers["switch0"]; !exists || !blinker.IsRunning() {
+		t.Fatal("canceling a replaced operation stopped the blink that replaced it")
+	}
+
+	if w := serve(server, "DELETE", "/operation/"+second, ""); w.Code != http.StatusOK {
+		t.Errorf("DELETE /operation/%s: status = %d, body: %s", second, w.Code, w.Body.String())
+	}
+}
+
+func TestOperationCancelBeforeTimeout(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+	fake := useFakeClock(server)
+
+	if err := server.switches["switch0"].Switch.TurnOn(); err != nil {
+		t.Fatalf("TurnOn() failed: %v", err)
+	}
+
+	id := startOperation(t, server, "/switch/switch0", `{"state": "blink", "period": 1, "duration": 10, "restoreOnStop": true}`)
+	operations := listOperations(t, server)
+	if len(operations) != 1 || operations[0].Expires == nil || !operations[0].Expires.Equal(fake.Now().Add(10*time.Second)) {
+		t.Fatalf("GET /operation returned %+v, want one operation expiring in 10s", operations)
+	}
+
+	// Canceling ends the blink as the timeout would, restoring the switch
+	if w := serve(server, "DELETE", "/operation/"+id, ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE /operation/%s: status = %d, body: %s", id, w.Code, w.Body.String())
+	}
+	if _, exists := server.timers["switch0"]; exists {
+		t.Error("timer on switch0 is still set after its operation was canceled")
+	}
+	if on, _ := server.switches["switch0"].Switch.GetState(); !on {
+		t.Error("switch0 was not restored to on after its operation was canceled")
+	}
+
+	// An operation that times out is no longer listed
+	startOperation(t, server, "/switch/switch0", `{"state": "on", "duration": 5}`)
+	fake.BlockUntil(1)
+	fake.Advance(5 * time.Second)
+	if operations := listOperations(t, server); len(operations) != 0 {
+		t.Errorf("GET /operation returned %+v after the timeout, want none", operations)
+	}
+}
+
+func TestOperationIDFailure(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+	useFakeClock(server)
+
+	defer func(read func([]byte) (int, error)) { readRandom = read }(readRandom)
+	readRandom = func([]byte) (int, error) { return 0, errors.New("no entropy") }
+
+	if w := serve(server, "POST", "/switch/switch0", `{"state": "on"}`); w.Code != http.StatusOK {
+		t.Errorf("on without a duration: status = %d, want %d, body: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	w := serve(server, "POST", "/switch/switch0", `{"state": "blink", "period": 1}`)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("blink: status = %d, want %d, body: %s", w.Code, http.StatusInternalServerError, w.Body.String())
+	}
+	if operations := listOperations(t, server); len(operations) != 0 {
+		t.Errorf("GET /operation returned %+v, want none", operations)
+	}
+}
@@ -0,0 +1,353 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/larsks/airdancer/internal/clock"
+	"github.com/larsks/airdancer/internal/switchcollection"
+)
+
+// scheduleType selects how a schedule controls its switch
+type scheduleType string
+
+const (
+	// scheduleTypeWindow keeps the switch in a state during a window on
+	// some days of the week, and restores its previous state afterwards
+	scheduleTypeWindow scheduleType = "window"
+	// scheduleTypeOnce puts the switch in a state once, at a given time
+	scheduleTypeOnce scheduleType = "once"
+)
+
+// scheduleAtLayout is the layout of a once schedule's time in local time.
+// RFC 3339 times are accepted as well.
+const scheduleAtLayout = "2006-01-02T15:04"
+
+// weekdays maps the names of the days of the week, and their three letter
+// abbreviations, to time.Weekday
+var weekdays = func() map[string]time.Weekday {
+	days := make(map[string]time.Weekday)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		days[name] = day
+		days[name[:3]] = day
+	}
+	return days
+}()
+
+// timeOfDay is a time of day, in hours and minutes
+type timeOfDay struct {
+	hour, minute int
+}
+
+// on returns the time of day on the date of day
+func (t timeOfDay) on(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), t.hour, t.minute, 0, 0, day.Location())
+}
+
+// schedule is a parsed ScheduleConfig and, while the server runs, the state
+// of its timer. Schedules are accessed with s.mutex held.
+type schedule struct {
+	name   string
+	target string
+	kind   scheduleType
+	state  switchState
+
+	// days, start, and end give the windows of a window schedule. A window
+	// whose end is not after its start ends the next day.
+	days       [7]bool
+	start, end timeOfDay
+
+	// at is when a once schedule fires
+	at time.Time
+
+	timer clock.Timer
+
+	// open is set while a window schedule has put its switches in its
+	// state, and previous holds the states they had before, which are
+	// restored when the window closes
+	open     bool
+	previous map[string]bool
+}
+
+// Validate checks that c describes a valid schedule. It does not check
+// that the switch or group exists.
+func (c ScheduleConfig) Validate() error {
+	_, err := parseSchedule("", c)
+	return err
+}
+
+// parseSchedule parses the schedule called name
+func parseSchedule(name string, c ScheduleConfig) (*schedule, error) {
+	if c.Switch == "" {
+		return nil, fmt.Errorf("%w: switch is required", ErrInvalidSchedule)
+	}
+	sch := &schedule{name: name, target: c.Switch, kind: scheduleType(c.Type)}
+
+	switch state := switchState(c.State); state {
+	case "":
+		sch.state = switchStateOn
+	case switchStateOn, switchStateOff:
+		sch.state = state
+	default:
+		return nil, fmt.Errorf("%w: state must be on or off, got '%s'", ErrInvalidSchedule, c.State)
+	}
+
+	switch sch.kind {
+	case scheduleTypeWindow:
+		if c.At != "" {
+			return nil, fmt.Errorf("%w: at is only supported for once schedules", ErrInvalidSchedule)
+		}
+		if len(c.Days) == 0 {
+			sch.days = [7]bool{true, true, true, true, true, true, true}
+		}
+		for _, name := range c.Days {
+			day, ok := weekdays[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown day '%s'", ErrInvalidSchedule, name)
+			}
+			sch.days[day] = true
+		}
+		var err error
+		if sch.start, err = parseTimeOfDay("start", c.Start); err != nil {
+			return nil, err
+		}
+		if sch.end, err = parseTimeOfDay("end", c.End); err != nil {
+			return nil, err
+		}
+	case scheduleTypeOnce:
+		if len(c.Days) > 0 || c.Start != "" || c.End != "" {
+			return nil, fmt.Errorf("%w: days, start, and end are only supported for window schedules", ErrInvalidSchedule)
+		}
+		at, err := time.ParseInLocation(scheduleAtLayout, c.At, time.Local)
+		if err != nil {
+			at, err = time.Parse(time.RFC3339, c.At)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: at must be YYYY-MM-DDTHH:MM or an RFC 3339 time, got '%s'", ErrInvalidSchedule, c.At)
+		}
+		sch.at = at
+	default:
+		return nil, fmt.Errorf("%w: type must be window or once, got '%s'", ErrInvalidSchedule, c.Type)
+	}
+
+	return sch, nil
+}
+
+// parseTimeOfDay parses the time of day of the setting called name, in
+// HH:MM form
+func parseTimeOfDay(name, value string) (timeOfDay, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return timeOfDay{}, fmt.Errorf("%w: %s must be HH:MM, got '%s'", ErrInvalidSchedule, name, value)
+	}
+	return timeOfDay{hour: t.Hour(), minute: t.Minute()}, nil
+}
+
+// window returns whether a window of the schedule is open at now, and the
+// time of its next transition: the end of the open window, or the start of
+// the next one. The zero time means that there is no next transition.
+func (sch *schedule) window(now time.Time) (bool, time.Time) {
+	var next time.Time
+	// A window that opened yesterday may still be open
+	for offset := -1; offset <= 7; offset++ {
+		day := time.Date(now.Year(), now.Month(), now.Day()+offset, 0, 0, 0, 0, now.Location())
+		if !sch.days[day.Weekday()] {
+			continue
+		}
+
+		start := sch.start.on(day)
+		end := sch.end.on(day)
+		if !end.After(start) {
+			end = sch.end.on(day.AddDate(0, 0, 1))
+		}
+		if !now.Before(start) && now.Before(end) {
+			return true, end
+		}
+		if start.After(now) && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return false, next
+}
+
+// startSchedules reconciles every schedule with the current time and arms
+// its timer. A window that is open puts its switches in its state at once;
+// a once schedule whose time has passed is skipped.
+func (s *Server) startSchedules() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, name := range slices.Sorted(maps.Keys(s.schedules)) {
+		sch := s.schedules[name]
+		if sch.kind == scheduleTypeOnce && !s.clock.Now().Before(sch.at) {
+			log.Printf("schedule %s: %s has already passed, skipping", name, sch.at.Format(time.RFC3339))
+			continue
+		}
+		s.runSchedule(sch)
+	}
+}
+
+// stopSchedules stops the timers of every schedule
+func (s *Server) stopSchedules() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, sch := range s.schedules {
+		if sch.timer != nil {
+			sch.timer.Stop()
+			sch.timer = nil
+		}
+	}
+}
+
+// runSchedule brings the switches of sch in line with the schedule at the
+// current time, then arms its timer for its next transition. The caller
+// must hold s.mutex.
+func (s *Server) runSchedule(sch *schedule) {
+	now := s.clock.Now()
+	var next time.Time
+
+	switch sch.kind {
+	case scheduleTypeWindow:
+		var open bool
+		open, next = sch.window(now)
+		if open && !sch.open {
+			s.openWindow(sch)
+		} else if !open && sch.open {
+			s.closeWindow(sch)
+		}
+	case scheduleTypeOnce:
+		if now.Before(sch.at) {
+			next = sch.at
+		} else {
+			log.Printf("schedule %s: turning %s %s", sch.name, sch.target, sch.state)
+			s.applySchedule(sch)
+		}
+	}
+
+	sch.timer = nil
+	if !next.IsZero() {
+		sch.timer = s.clock.AfterFunc(next.Sub(now), func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			s.runSchedule(sch)
+		})
+	}
+}
+
+// reconcileSchedules opens the windows that should be open and closes the
+// windows that should be closed, for windows whose opening or closing was
+// skipped in maintenance mode. Timers are left as they are. The caller
+// must hold s.mutex.
+func (s *Server) reconcileSchedules() {
+	now := s.clock.Now()
+	for _, name := range slices.Sorted(maps.Keys(s.schedules)) {
+		sch := s.schedules[name]
+		if sch.kind != scheduleTypeWindow {
+			continue
+		}
+		if open, _ := sch.window(now); open && !sch.open {
+			s.openWindow(sch)
+		} else if !open && sch.open {
+			s.closeWindow(sch)
+		}
+	}
+}
+
+// scheduleSwitches returns the switches that the target of sch, which may
+// be an alias, refers to. The caller must hold s.mutex.
+func (s *Server) scheduleSwitches(sch *schedule) map[string]*ResolvedSwitch {
+	switches, err := s.lineSwitches(s.canonicalName(sch.target))
+	if err != nil {
+		// Groups created through the API can be deleted
+		log.Printf("schedule %s: %v", sch.name, err)
+		return nil
+	}
+	return switches
+}
+
+// openWindow records the states of the switches of sch and puts them in
+// the state of the schedule. The caller must hold s.mutex.
+func (s *Server) openWindow(sch *schedule) {
+	if s.maintenance.Load() {
+		log.Printf("schedule %s: maintenance mode is on, not opening window", sch.name)
+		return
+	}
+
+	sch.previous = make(map[string]bool)
+	for switchName, resolvedSwitch := range s.scheduleSwitches(sch) {
+		if state, err := resolvedSwitch.Switch.GetState(); err == nil {
+			sch.previous[switchName] = state
+		}
+	}
+	sch.open = true
+
+	log.Printf("schedule %s: window opened, turning %s %s", sch.name, sch.target, sch.state)
+	s.applySchedule(sch)
+}
+
+// closeWindow stops anything running on the switches of sch and restores
+// the states they had when the window opened. In maintenance mode the
+// window is left open, to be closed by reconcileSchedules once maintenance
+// mode is turned off. The caller must hold s.mutex.
+func (s *Server) closeWindow(sch *schedule) {
+	if s.maintenance.Load() {
+		log.Printf("schedule %s: maintenance mode is on, not closing window", sch.name)
+		return
+	}
+
+	sch.open = false
+	previous := sch.previous
+	sch.previous = nil
+
+	log.Printf("schedule %s: window closed, restoring %s", sch.name, sch.target)
+	s.cancelScheduleTarget(sch)
+	switches := make(map[string]switchcollection.Switch)
+	for switchName, resolvedSwitch := range s.scheduleSwitches(sch) {
+		if !resolvedSwitch.Switch.IsDisabled() {
+			switches[switchName] = resolvedSwitch.Switch
+		}
+	}
+	s.restoreSwitchStates(switches, previous)
+	for switchName := range switches {
+		s.recordSwitchStates(switchName)
+	}
+}
+
+// applySchedule puts the switches of sch in the state of the schedule, in
+// the same way as a POST /switch/{name} request. The caller must hold
+// s.mutex.
+func (s *Server) applySchedule(sch *schedule) {
+	if s.maintenance.Load() {
+		log.Printf("schedule %s: maintenance mode is on, not turning %s %s", sch.name, sch.target, sch.state)
+		return
+	}
+
+	s.cancelScheduleTarget(sch)
+	req := switchRequest{State: sch.state}
+	switches := s.scheduleSwitches(sch)
+	for _, switchName := range slices.Sorted(maps.Keys(switches)) {
+		resolvedSwitch := switches[switchName]
+		if resolvedSwitch.Switch.IsDisabled() {
+			continue
+		}
+		if err := s.handleSwitchHelper(nil, &req, switchName, resolvedSwitch.Switch); err != nil {
+			log.Printf("schedule %s: failed to turn %s %s: %v", sch.name, switchName, sch.state, err)
+		}
+	}
+}
+
+// cancelScheduleTarget stops anything running on the target of sch. The
+// caller must hold s.mutex.
+func (s *Server) cancelScheduleTarget(sch *schedule) {
+	if target := s.canonicalName(sch.target); target == "all" {
+		s.cancelAllTasksAndTimers()
+	} else {
+		s.cancelTasksAndTimers(target)
+	}
+}
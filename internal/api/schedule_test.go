@@ -0,0 +1,228 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/larsks/airdancer/internal/clock"
+)
+
+// monday is a Monday morning, in local time
+var monday = time.Date(2025, time.January, 6, 10, 0, 0, 0, time.Local)
+
+// addSchedule parses cfg and adds it to server as a schedule called name
+func addSchedule(t *testing.T, server *Server, name string, cfg ScheduleConfig) {
+	t.Helper()
+	sch, err := parseSchedule(name, cfg)
+	if err != nil {
+		t.Fatalf("parseSchedule() failed: %v", err)
+	}
+	server.schedules[name] = sch
+}
+
+func TestScheduleWindowActiveAtStartup(t *testing.T) {
+	server := createTestServer(t, 2)
+	defer server.Close()
+	fake := clock.NewFake(monday)
+	server.clock = fake
+
+	isOn := func(switchName string) bool {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		on, _ := server.switches[switchName].Switch.GetState()
+		return on
+	}
+
+	addSchedule(t, server, "office", ScheduleConfig{Switch: "switch0", Type: "window", Days: []string{"mon", "Wednesday"}, Start: "09:00", End: "17:00"})
+	addSchedule(t, server, "night", ScheduleConfig{Switch: "switch1", Type: "window", Start: "22:00", End: "06:00"})
+
+	// The window that is open at startup is applied at once
+	server.startSchedules()
+	if !isOn("switch0") {
+		t.Fatal("switch0 is off at startup inside its window")
+	}
+	if isOn("switch1") {
+		t.Fatal("switch1 is on at startup outside its window")
+	}
+
+	// Windows close, and reopen on their days
+	fake.Advance(7 * time.Hour) // Monday 17:00
+	if isOn("switch0") {
+		t.Error("switch0 is still on after its window closed")
+	}
+	fake.Advance(5 * time.Hour) // Monday 22:00
+	if !isOn("switch1") {
+		t.Error("switch1 is off after its window opened")
+	}
+	fake.Advance(8 * time.Hour) // Tuesday 06:00
+	if isOn("switch1") {
+		t.Error("switch1 is still on after its overnight window closed")
+	}
+	fake.Advance(4 * time.Hour) // Tuesday 10:00
+	if isOn("switch0") {
+		t.Error("switch0 is on on a Tuesday")
+	}
+	fake.Advance(24 * time.Hour) // Wednesday 10:00
+	if !isOn("switch0") {
+		t.Error("switch0 is off inside its Wednesday window")
+	}
+}
+
+func TestScheduleWindowRestoresState(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+	fake := clock.NewFake(monday)
+	server.clock = fake
+
+	if err := server.switches["switch0"].Switch.TurnOn(); err != nil {
+		t.Fatalf("TurnOn() failed: %v", err)
+	}
+	addSchedule(t, server, "quiet", ScheduleConfig{Switch: "switch0", Type: "window", State: "off", Start: "11:00", End: "12:00"})
+	server.startSchedules()
+
+	fake.Advance(time.Hour)
+	if on, _ := server.switches["switch0"].Switch.GetState(); on {
+		t.Error("switch0 is on inside an off window")
+	}
+	fake.Advance(time.Hour)
+	if on, _ := server.switches["switch0"].Switch.GetState(); !on {
+		t.Error("switch0 was not restored to on after the window closed")
+	}
+}
+
+func TestScheduleOnce(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+	fake := clock.NewFake(monday)
+	server.clock = fake
+
+	addSchedule(t, server, "party", ScheduleConfig{Switch: "red", Type: "once", At: "2025-01-06T10:30"})
+	addSchedule(t, server, "missed", ScheduleConfig{Switch: "green", Type: "once", At: "2025-01-06T09:30"})
+	server.startSchedules()
+
+	isOn := func(switchName string) bool {
+		on, _ := server.switches[switchName].Switch.GetState()
+		return on
+	}
+	if isOn("switch0") || isOn("switch2") {
+		t.Fatal("a once schedule fired before its time")
+	}
+
+	fake.Advance(30 * time.Minute)
+	if !isOn("switch0") || !isOn("switch1") {
+		t.Error("the switches of group red are not on after their once schedule fired")
+	}
+	if isOn("switch2") || isOn("switch3") {
+		t.Error("a once schedule whose time had passed at startup fired")
+	}
+
+	// It fires only once
+	if err := server.switches["switch0"].Switch.TurnOff(); err != nil {
+		t.Fatalf("TurnOff() failed: %v", err)
+	}
+	fake.Advance(7 * 24 * time.Hour)
+	if isOn("switch0") {
+		t.Error("a once schedule fired again")
+	}
+}
+
+func TestScheduleWindowInMaintenance(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+	fake := clock.NewFake(monday)
+	server.clock = fake
+
+	isOn := func() bool {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		on, _ := server.switches["switch0"].Switch.GetState()
+		return on
+	}
+
+	addSchedule(t, server, "office", ScheduleConfig{Switch: "switch0", Type: "window", Start: "11:00", End: "12:00"})
+	server.startSchedules()
+	setMaintenance(t, server, `{"enabled": true}`)
+
+	// The window does not open in maintenance mode, but is opened once
+	// maintenance mode is turned off
+	fake.Advance(30 * time.Minute) // 10:30
+	fake.Advance(30 * time.Minute) // 11:00
+	if isOn() {
+		t.Fatal("window opened in maintenance mode")
+	}
+	setMaintenance(t, server, `{"enabled": false}`)
+	if !isOn() {
+		t.Fatal("window that opened in maintenance mode was not opened after it")
+	}
+
+	// Likewise, it is not closed in maintenance mode
+	setMaintenance(t, server, `{"enabled": true}`)
+	fake.Advance(time.Hour) // 12:00
+	if !isOn() {
+		t.Fatal("window closed in maintenance mode")
+	}
+	setMaintenance(t, server, `{"enabled": false}`)
+	if isOn() {
+		t.Error("window that closed in maintenance mode was not closed after it")
+	}
+
+	// The next window opens as usual
+	fake.Advance(23 * time.Hour) // Tuesday 11:00
+	if !isOn() {
+		t.Error("window did not open on the next day")
+	}
+}
+
+func TestScheduleAlias(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+	fake := clock.NewFake(monday)
+	server.clock = fake
+	server.aliases = map[string]string{"garden": "green"}
+
+	addSchedule(t, server, "evening", ScheduleConfig{Switch: "garden", Type: "window", Start: "10:00", End: "11:00"})
+	server.startSchedules()
+
+	for switchName, want := range map[string]bool{"switch0": false, "switch1": false, "switch2": true, "switch3": true} {
+		if on, _ := server.switches[switchName].Switch.GetState(); on != want {
+			t.Errorf("%s is on = %v inside the window of a schedule on alias garden, want %v", switchName, on, want)
+		}
+	}
+
+	fake.Advance(time.Hour)
+	for _, switchName := range []string{"switch2", "switch3"} {
+		if on, _ := server.switches[switchName].Switch.GetState(); on {
+			t.Errorf("%s is still on after the window closed", switchName)
+		}
+	}
+}
+
+func TestScheduleConfigValidate(t *testing.T) {
+	valid := []ScheduleConfig{
+		{Switch: "porch", Type: "window", Start: "09:00", End: "17:00"},
+		{Switch: "porch", Type: "window", Days: []string{"sat", "Sunday"}, Start: "22:00", End: "02:00", State: "off"},
+		{Switch: "porch", Type: "once", At: "2025-01-01T20:00"},
+		{Switch: "porch", Type: "once", At: "2025-01-01T20:00:00-05:00"},
+	}
+	for _, cfg := range valid {
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validate(%+v) unexpected error: %v", cfg, err)
+		}
+	}
+
+	invalid := []ScheduleConfig{
+		{Type: "window", Start: "09:00", End: "17:00"},
+		{Switch: "porch", Type: "cron"},
+		{Switch: "porch", Type: "window", Start: "9am", End: "17:00"},
+		{Switch: "porch", Type: "window", Days: []string{"funday"}, Start: "09:00", End: "17:00"},
+		{Switch: "porch", Type: "window", Start: "09:00", End: "17:00", State: "blink"},
+		{Switch: "porch", Type: "once", At: "tomorrow"},
+		{Switch: "porch", Type: "once", At: "2025-01-01T20:00", Start: "09:00"},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("Validate(%+v) error = %v, want %v", cfg, err, ErrInvalidSchedule)
+		}
+	}
+}
@@ -1,15 +1,21 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -17,39 +23,172 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/larsks/airdancer/internal/blink"
+	"github.com/larsks/airdancer/internal/buttondriver/common"
+	"github.com/larsks/airdancer/internal/clock"
 	"github.com/larsks/airdancer/internal/config"
 	"github.com/larsks/airdancer/internal/flipflop"
+	"github.com/larsks/airdancer/internal/httpserver"
 	"github.com/larsks/airdancer/internal/mqtt"
 	"github.com/larsks/airdancer/internal/switchcollection"
 	"github.com/larsks/airdancer/internal/switchdrivers"
 	"github.com/spf13/pflag"
+	"golang.org/x/sync/errgroup"
 )
 
+// maxConcurrentCollectionOps limits the number of switch collections that
+// are initialized or closed in parallel.
+const maxConcurrentCollectionOps = 8
+
+// listenSocketMode is the permission mode of the Unix socket created when
+// listen-socket is set. Group access allows a reverse proxy running as a
+// different user to connect.
+const listenSocketMode = 0660
+
 type timerData struct {
-	timer    *time.Timer
+	timer    clock.Timer
 	duration time.Duration
+	// expires is when the timer fires
+	expires time.Time
+	// stop ends the task the timer was started for, as the timer does
+	// when it expires. The caller must hold Server.mutex.
+	stop func()
 }
 
 // ResolvedSwitch represents a switch that has been resolved to a specific collection and index.
 type ResolvedSwitch struct {
-	Name       string
-	Collection switchcollection.SwitchCollection
-	Index      uint
-	Switch     switchcollection.Switch
+	Name           string
+	CollectionName string
+	Collection     switchcollection.SwitchCollection
+	Index          uint
+	Switch         switchcollection.Switch
+	Tags           []string
+	StartupState   startupState
+	// Watchdog, if set, turns the switch off when it is on and no
+	// heartbeat has arrived for this long
+	Watchdog time.Duration
+	// MinOn, if set, is how long the switch must stay on before it may
+	// be turned off
+	MinOn time.Duration
+	// MaxOn, if set, is how long the switch may stay on before the
+	// max-on reaper turns it off
+	MaxOn time.Duration
+	// Members holds the switches operated by an aggregate switch, which
+	// has no collection of its own
+	Members []*ResolvedSwitch
 }
 
 // Server represents the API server.
 type Server struct {
-	listenAddr  string
-	collections map[string]switchcollection.SwitchCollection
-	switches    map[string]*ResolvedSwitch
-	groups      map[string]*SwitchGroup
-	mutex       sync.Mutex
-	timers      map[string]*timerData
-	blinkers    map[string]*blink.Blink
-	flipflops   map[string]*flipflop.Flipflop
-	router      *chi.Mux
-	mqttClient  *mqtt.Client
+	listenAddrs  []string
+	listenSocket string
+	tlsConfig    *tls.Config
+	collections  map[string]switchcollection.SwitchCollection
+	switches     map[string]*ResolvedSwitch
+	groups       map[string]*SwitchGroup
+	mutex        sync.Mutex
+	timers       map[string]*timerData
+	blinkers     map[string]*blink.Blink
+	flipflops    map[string]*flipflop.Flipflop
+	operations   map[string]*operation
+	watchdogs    map[string]*timerData
+	onSince      map[string]time.Time
+	schedules    map[string]*schedule
+	maxOnReaper  clock.Timer
+	router       *chi.Mux
+	mqttClient   *mqtt.Client
+
+	// events delivers switch events to clients of the event stream
+	events *eventBroker
+
+	// stateChanges records the last change of state of each switch and
+	// group. It is protected by stateChangesMutex rather than s.mutex,
+	// since it is updated by callbacks that must not acquire s.mutex.
+	stateChanges      map[string]stateChange
+	stateChangesMutex sync.Mutex
+
+	// switchesMutex protects the Switch of each resolved switch, which
+	// handleCountChange replaces, for the collection callbacks that
+	// must not acquire s.mutex. Code that holds s.mutex may read the
+	// Switch of a resolved switch without it.
+	switchesMutex sync.RWMutex
+
+	// clock times durations and effects; tests replace it with a fake
+	clock clock.Clock
+
+	// disabledWebhookURL, if set, receives a POST request whenever a
+	// switch is disabled or re-enabled.
+	disabledWebhookURL string
+	webhookClient      *http.Client
+
+	// shutdownTimeout bounds how long in-flight requests, and then running
+	// tasks, are given to finish on shutdown.
+	shutdownTimeout time.Duration
+
+	// offOnShutdown turns off every collection when the server is closed,
+	// rather than leaving switches in their last state.
+	offOnShutdown bool
+
+	// readOnly rejects requests that change switch state, leaving only
+	// status queries available.
+	readOnly bool
+
+	// maxBodyBytes limits the size of request bodies
+	maxBodyBytes int64
+
+	// lineListen, if set, is the address on which line protocol
+	// connections are accepted
+	lineListen string
+
+	// apiKey, if set, must be sent as a bearer token to endpoints that
+	// require it. Those endpoints are unavailable if it is not set.
+	apiKey string
+
+	// checkOnly makes Start log the startup summary and return without
+	// serving requests
+	checkOnly bool
+
+	// aliases maps friendly names that may be used in request paths to
+	// the names of switches and groups. They do not change while the
+	// server runs.
+	aliases map[string]string
+
+	// config is the configuration the server was created from, which is
+	// served (redacted) for diagnostics
+	config *Config
+
+	// defaultPeriod and defaultDutyCycle are used for blink and flipflop
+	// requests that do not specify them. A zero defaultPeriod means the
+	// period is required.
+	defaultPeriod    float64
+	defaultDutyCycle float64
+
+	// runtimeGroups holds the switches of each group created through the
+	// API, which are saved to stateFile (if set) when they change. Groups
+	// from the configuration file are not included.
+	runtimeGroups map[string][]string
+	stateFile     string
+
+	// switchStates holds the last state of each switch whose startup
+	// state is "last", which is saved to stateFile
+	switchStates map[string]bool
+
+	// maintenance is set while automated actions (schedules and requests
+	// with an X-Airdancer-Source header) are to be skipped
+	maintenance atomic.Bool
+
+	// idempotencyKeys holds recent responses to control requests with
+	// an Idempotency-Key header, so that retries are not executed twice
+	idempotencyKeys *idempotencyCache
+
+	// boundAddrs holds the addresses the server is listening on while it
+	// is running. They differ from listenAddrs when listen-port is 0 and
+	// the system picks the port.
+	boundAddrs      []net.Addr
+	boundAddrsMutex sync.Mutex
+
+	// buttonDrivers read the configured buttons, whose events are
+	// published on the event stream
+	buttonDrivers map[string]common.ButtonDriver
 }
 
 // Config holds the configuration for the API server.
@@ -61,21 +200,93 @@ type (
 	}
 
 	SwitchConfig struct {
-		Spec string `mapstructure:"spec"`
+		// Spec is "collection.index", or a list of them for a switch
+		// that drives several physical switches together
+		Spec SwitchSpec `mapstructure:"spec"`
+		// StatePolicy determines whether a switch with several specs is
+		// on when all of them are on ("all-on", the default) or when
+		// any of them is ("any-on")
+		StatePolicy string `mapstructure:"state-policy"`
+		// StartupState is the state the switch is put in when the
+		// server starts: "off" (the default), "on", or "last" to
+		// restore the state saved in the state file
+		StartupState string `mapstructure:"startup-state"`
+		// WatchdogSeconds, if set, turns the switch off when no
+		// heartbeat has arrived for this many seconds since it was
+		// turned on or since the last heartbeat
+		WatchdogSeconds int `mapstructure:"watchdog-seconds"`
+		// MinOnSeconds, if set, defers requests to turn the switch off
+		// until it has been on for this many seconds, for loads such as
+		// compressors that must not be cycled quickly
+		MinOnSeconds int `mapstructure:"min-on-seconds"`
+		// MaxOnSeconds, if set, overrides the server's max-on-seconds
+		// for the switch; 0 exempts the switch from it
+		MaxOnSeconds *int `mapstructure:"max-on-seconds"`
+		// Tags are labels reported with the switch state, which clients
+		// such as the UI can use to organize switches.
+		Tags []string `mapstructure:"tags"`
 	}
 
 	GroupConfig struct {
 		Switches []string `mapstructure:"switches"`
 	}
 
+	ScheduleConfig struct {
+		// Switch is the switch or group (or "all") that the schedule
+		// controls
+		Switch string `mapstructure:"switch"`
+		// Type is "window", to keep the switch in State during a window
+		// on some days of the week and restore its previous state
+		// afterwards, or "once", to put it in State once, at At
+		Type string `mapstructure:"type"`
+		// State is "on" (the default) or "off"
+		State string `mapstructure:"state"`
+		// Days are the days of the week on which a window opens, such as
+		// "mon" or "monday" (default: every day). Start and End are the
+		// times of day, as HH:MM, at which it opens and closes; a window
+		// whose end is not after its start closes the next day.
+		Days  []string `mapstructure:"days"`
+		Start string   `mapstructure:"start"`
+		End   string   `mapstructure:"end"`
+		// At is when a once schedule fires, as YYYY-MM-DDTHH:MM in local
+		// time or as an RFC 3339 time
+		At string `mapstructure:"at"`
+	}
+
 	Config struct {
-		ListenAddress string                      `mapstructure:"listen-address"`
-		ListenPort    int                         `mapstructure:"listen-port"`
-		ConfigFile    string                      `mapstructure:"config-file"`
-		Collections   map[string]CollectionConfig `mapstructure:"collections"`
-		Switches      map[string]SwitchConfig     `mapstructure:"switches"`
-		Groups        map[string]GroupConfig      `mapstructure:"groups"`
-		MqttServer    string                      `mapstructure:"mqtt-server"`
+		ListenAddress     string                      `mapstructure:"listen-address"`
+		ListenAddresses   []string                    `mapstructure:"listen-addresses"`
+		ListenPort        int                         `mapstructure:"listen-port"`
+		ListenSocket      string                      `mapstructure:"listen-socket"`
+		TLSCertFile       string                      `mapstructure:"tls-cert-file"`
+		TLSKeyFile        string                      `mapstructure:"tls-key-file"`
+		TLSReload         bool                        `mapstructure:"tls-reload"`
+		ShutdownTimeout   int                         `mapstructure:"shutdown-timeout"`
+		OffOnShutdown     bool                        `mapstructure:"off-on-shutdown"`
+		ReadOnly          bool                        `mapstructure:"read-only"`
+		MaxBodyBytes      int64                       `mapstructure:"max-body-bytes"`
+		LineListen        string                      `mapstructure:"line-listen"`
+		APIKey            string                      `mapstructure:"api-key"`
+		Check             bool                        `mapstructure:"check"`
+		DefaultPeriod     float64                     `mapstructure:"default-period"`
+		DefaultDutyCycle  float64                     `mapstructure:"default-duty-cycle"`
+		MaxOnSeconds      int                         `mapstructure:"max-on-seconds"`
+		ConfigFile        string                      `mapstructure:"config-file"`
+		Strict            bool                        `mapstructure:"strict"`
+		Collections       map[string]CollectionConfig `mapstructure:"collections"`
+		Switches          map[string]SwitchConfig     `mapstructure:"switches"`
+		Groups            map[string]GroupConfig      `mapstructure:"groups"`
+		Buttons           map[string]ButtonConfig     `mapstructure:"buttons"`
+		Schedules         map[string]ScheduleConfig   `mapstructure:"schedules"`
+		Aliases           map[string]string           `mapstructure:"aliases"`
+		MqttServer        string                      `mapstructure:"mqtt-server"`
+		MqttTopicTemplate string                      `mapstructure:"mqtt-topic-template"`
+		BasePath          string                      `mapstructure:"base-path"`
+		StateFile         string                      `mapstructure:"state-file"`
+
+		// DisabledWebhookURL is called when a switch is disabled due to
+		// connectivity problems or re-enabled.
+		DisabledWebhookURL string `mapstructure:"disabled-webhook-url"`
 	}
 )
 
@@ -83,11 +294,14 @@ type (
 
 func NewConfig() *Config {
 	return &Config{
-		ListenAddress: "",
-		ListenPort:    8080,
-		Collections:   make(map[string]CollectionConfig),
-		Switches:      make(map[string]SwitchConfig),
-		Groups:        make(map[string]GroupConfig),
+		ListenAddress:    "",
+		ListenPort:       8080,
+		MaxBodyBytes:     defaultMaxBodyBytes,
+		ShutdownTimeout:  int(httpserver.ShutdownTimeout / time.Second),
+		DefaultDutyCycle: defaultDutyCycle,
+		Collections:      make(map[string]CollectionConfig),
+		Switches:         make(map[string]SwitchConfig),
+		Groups:           make(map[string]GroupConfig),
 	}
 }
 
@@ -96,7 +310,36 @@ func NewConfig() *Config {
 func (c *Config) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&c.ConfigFile, "config", "", "Config file to use")
 	fs.StringVar(&c.ListenAddress, "listen-address", c.ListenAddress, "Listen address for http server")
-	fs.IntVar(&c.ListenPort, "listen-port", c.ListenPort, "Listen port for http server")
+	fs.StringSliceVar(&c.ListenAddresses, "listen-addresses", c.ListenAddresses, "Listen addresses for http server (instead of --listen-address)")
+	fs.IntVar(&c.ListenPort, "listen-port", c.ListenPort, "Listen port for http server (0 to pick a free port)")
+	fs.StringVar(&c.ListenSocket, "listen-socket", c.ListenSocket, "Listen on a Unix socket at this path instead of TCP")
+	fs.StringVar(&c.TLSCertFile, "tls-cert-file", c.TLSCertFile, "TLS certificate file (enables HTTPS)")
+	fs.StringVar(&c.TLSKeyFile, "tls-key-file", c.TLSKeyFile, "TLS private key file (enables HTTPS)")
+	fs.BoolVar(&c.TLSReload, "tls-reload", c.TLSReload, "Reload the TLS certificate and key when they change")
+	fs.IntVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "Seconds to wait for requests and running tasks to finish on shutdown")
+	fs.BoolVar(&c.OffOnShutdown, "off-on-shutdown", c.OffOnShutdown, "Turn off all switches when the server shuts down")
+	fs.Float64Var(&c.DefaultPeriod, "default-period", c.DefaultPeriod, "Period in seconds for blink and flipflop requests that do not specify one (0 = period is required)")
+	fs.Float64Var(&c.DefaultDutyCycle, "default-duty-cycle", c.DefaultDutyCycle, "Duty cycle for blink and flipflop requests that do not specify one")
+	fs.IntVar(&c.MaxOnSeconds, "max-on-seconds", c.MaxOnSeconds, "Turn off switches that have been on for this many seconds (0 = no limit)")
+	fs.BoolVar(&c.ReadOnly, "read-only", c.ReadOnly, "Only allow status queries; reject requests that change switches")
+	fs.Int64Var(&c.MaxBodyBytes, "max-body-bytes", c.MaxBodyBytes, "Maximum size in bytes of request bodies")
+	fs.StringVar(&c.LineListen, "line-listen", c.LineListen, "Address (host:port) on which to accept line protocol connections (default: disabled)")
+	fs.StringVar(&c.APIKey, "api-key", c.APIKey, "API key that clients must send as a bearer token to endpoints that require one, such as /config (default: those endpoints are disabled)")
+	fs.StringVar(&c.StateFile, "state-file", c.StateFile, "File in which to save groups created through the API and the state of switches with startup-state last")
+	fs.StringVar(&c.BasePath, "base-path", c.BasePath, "Serve the API under this path prefix (e.g., '/api') when hosted behind a proxy")
+	fs.BoolVar(&c.Strict, "strict", c.Strict, "Fail if the config file contains unknown settings")
+	fs.BoolVar(&c.Check, "check", c.Check, "Log the startup summary and exit without serving requests or changing switches")
+}
+
+// GetBasePath returns the normalized base path, which starts with a slash
+// and does not end with one, or an empty string if the API is served at
+// the root.
+func (c *Config) GetBasePath() string {
+	basePath := strings.Trim(strings.TrimSpace(c.BasePath), "/")
+	if basePath == "" {
+		return ""
+	}
+	return "/" + basePath
 }
 
 // LoadConfig loads the configuration from a file and binds it to the Config struct.
@@ -109,15 +352,36 @@ func (c *Config) LoadConfig() error {
 func (c *Config) LoadConfigWithFlagSet(fs *pflag.FlagSet) error {
 	loader := config.NewConfigLoader()
 	loader.SetConfigFile(c.ConfigFile)
+	loader.SetStrictModeKey("strict")
 
 	// Set default values
 	loader.SetDefaults(map[string]any{
-		"listen-address": "",
-		"listen-port":    8080,
-		"collections":    make(map[string]CollectionConfig),
-		"switches":       make(map[string]SwitchConfig),
-		"groups":         make(map[string]GroupConfig),
-		"mqtt-server":    "",
+		"listen-address":       "",
+		"listen-addresses":     []string{},
+		"listen-port":          8080,
+		"listen-socket":        "",
+		"tls-cert-file":        "",
+		"tls-key-file":         "",
+		"tls-reload":           false,
+		"shutdown-timeout":     int(httpserver.ShutdownTimeout / time.Second),
+		"off-on-shutdown":      false,
+		"read-only":            false,
+		"max-body-bytes":       defaultMaxBodyBytes,
+		"line-listen":          "",
+		"api-key":              "",
+		"check":                false,
+		"default-period":       0.0,
+		"default-duty-cycle":   defaultDutyCycle,
+		"max-on-seconds":       0,
+		"collections":          make(map[string]CollectionConfig),
+		"switches":             make(map[string]SwitchConfig),
+		"groups":               make(map[string]GroupConfig),
+		"mqtt-server":          "",
+		"mqtt-topic-template":  "",
+		"disabled-webhook-url": "",
+		"base-path":            "",
+		"state-file":           "",
+		"strict":               false,
 	})
 
 	return loader.LoadConfigWithFlagSet(c, fs)
@@ -134,6 +398,40 @@ func createSwitchCollection(collectionName string, collectionCfg CollectionConfi
 
 // NewServer creates a new Server instance.
 func NewServer(cfg *Config) (*Server, error) {
+	if cfg.ListenSocket != "" && (cfg.ListenAddress != "" || len(cfg.ListenAddresses) > 0) {
+		return nil, ErrListenConflict
+	}
+
+	if cfg.DefaultPeriod < 0 {
+		return nil, ErrInvalidDefaultPeriod
+	}
+	if cfg.DefaultDutyCycle < 0 || cfg.DefaultDutyCycle > 1 {
+		return nil, ErrInvalidDefaultDutyCycle
+	}
+	if cfg.MaxOnSeconds < 0 {
+		return nil, ErrInvalidMaxOn
+	}
+
+	if cfg.MqttTopicTemplate != "" {
+		if err := mqtt.ValidateTopicTemplate(cfg.MqttTopicTemplate); err != nil {
+			return nil, err
+		}
+	}
+
+	listenAddrs, err := httpserver.ListenAddresses(cfg.ListenAddress, cfg.ListenAddresses, cfg.ListenPort)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := httpserver.NewTLSConfig(httpserver.TLSOptions{
+		CertFile: cfg.TLSCertFile,
+		KeyFile:  cfg.TLSKeyFile,
+		Reload:   cfg.TLSReload,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	collections := make(map[string]switchcollection.SwitchCollection)
 	switches := make(map[string]*ResolvedSwitch)
 	groups := make(map[string]*SwitchGroup)
@@ -167,6 +465,29 @@ func NewServer(cfg *Config) (*Server, error) {
 			return nil, fmt.Errorf("failed to resolve switch %s: %w", switchName, err)
 		}
 
+		if resolved.StartupState, err = parseStartupState(switchCfg.StartupState); err != nil {
+			return nil, fmt.Errorf("switch %s: %w", switchName, err)
+		}
+		if resolved.StartupState == startupStateLast && cfg.StateFile == "" {
+			return nil, fmt.Errorf("switch %s: %w", switchName, ErrStartupStateNeedsStateFile)
+		}
+		if switchCfg.WatchdogSeconds < 0 {
+			return nil, fmt.Errorf("switch %s: %w", switchName, ErrInvalidWatchdog)
+		}
+		resolved.Watchdog = time.Duration(switchCfg.WatchdogSeconds) * time.Second
+		if switchCfg.MinOnSeconds < 0 {
+			return nil, fmt.Errorf("switch %s: %w", switchName, ErrInvalidMinOn)
+		}
+		resolved.MinOn = time.Duration(switchCfg.MinOnSeconds) * time.Second
+		maxOnSeconds := cfg.MaxOnSeconds
+		if switchCfg.MaxOnSeconds != nil {
+			maxOnSeconds = *switchCfg.MaxOnSeconds
+		}
+		if maxOnSeconds < 0 {
+			return nil, fmt.Errorf("switch %s: %w", switchName, ErrInvalidMaxOn)
+		}
+		resolved.MaxOn = time.Duration(maxOnSeconds) * time.Second
+
 		switches[switchName] = resolved
 	}
 
@@ -188,12 +509,68 @@ func NewServer(cfg *Config) (*Server, error) {
 		groups[groupName] = NewSwitchGroup(groupName, groupSwitches)
 	}
 
-	listenAddr := fmt.Sprintf("%s:%d", cfg.ListenAddress, cfg.ListenPort)
-	server := newServerWithCollections(collections, switches, groups, listenAddr, true)
+	if err := cfg.ValidateAliases(); err != nil {
+		return nil, err
+	}
+
+	// A schedule may refer to its switch or group by an alias
+	schedules := make(map[string]*schedule)
+	for scheduleName, scheduleCfg := range cfg.Schedules {
+		sch, err := parseSchedule(scheduleName, scheduleCfg)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", scheduleName, err)
+		}
+		target := sch.target
+		if aliasTarget, isAlias := cfg.Aliases[target]; isAlias {
+			target = aliasTarget
+		}
+		if _, exists := switches[target]; !exists && groups[target] == nil && target != "all" {
+			return nil, fmt.Errorf("schedule %s: %w: switch or group %s not found", scheduleName, ErrInvalidSchedule, sch.target)
+		}
+		schedules[scheduleName] = sch
+	}
+
+	buttonDrivers, err := createButtonDrivers(cfg.Buttons)
+	if err != nil {
+		return nil, err
+	}
+
+	server := newServerWithCollections(collections, switches, groups, listenAddrs, true)
+	server.buttonDrivers = buttonDrivers
+	server.schedules = schedules
+	server.aliases = cfg.Aliases
+	if basePath := cfg.GetBasePath(); basePath != "" {
+		server.mountAt(basePath)
+	}
+	server.listenSocket = cfg.ListenSocket
+	server.tlsConfig = tlsConfig
+	if cfg.ShutdownTimeout > 0 {
+		server.shutdownTimeout = time.Duration(cfg.ShutdownTimeout) * time.Second
+	}
+	server.disabledWebhookURL = cfg.DisabledWebhookURL
+	server.offOnShutdown = cfg.OffOnShutdown
+	server.readOnly = cfg.ReadOnly
+	if cfg.MaxBodyBytes > 0 {
+		server.maxBodyBytes = cfg.MaxBodyBytes
+	}
+	server.lineListen = cfg.LineListen
+	server.apiKey = cfg.APIKey
+	server.checkOnly = cfg.Check
+	server.config = cfg
+	server.defaultPeriod = cfg.DefaultPeriod
+	if cfg.DefaultDutyCycle > 0 {
+		server.defaultDutyCycle = cfg.DefaultDutyCycle
+	}
+	if cfg.StateFile != "" {
+		server.stateFile = cfg.StateFile
+		if err := server.loadState(); err != nil {
+			return nil, err
+		}
+	}
 
 	// Initialize MQTT client if server is configured
 	if cfg.MqttServer != "" {
-		if err := server.initMQTTClient(cfg.MqttServer); err != nil {
+		if err := server.initMQTTClient(cfg.MqttServer, cfg.MqttTopicTemplate); err != nil {
 			log.Printf("Failed to initialize MQTT client: %v", err)
 		}
 	}
@@ -201,12 +578,70 @@ func NewServer(cfg *Config) (*Server, error) {
 	return server, nil
 }
 
-// resolveSwitch parses a switch spec and resolves it to a specific switch in a collection.
+// SwitchSpec is the list of switches ("collection.index") that a
+// configured switch drives. A single string is accepted for a switch with
+// one spec.
+type SwitchSpec []string
+
+func (spec SwitchSpec) String() string {
+	return strings.Join(spec, ",")
+}
+
+// resolveSwitch resolves a configured switch to the switches it drives. A
+// switch with several specs is resolved to an aggregate switch that
+// operates all of them.
 func resolveSwitch(switchName string, switchCfg SwitchConfig, collections map[string]switchcollection.SwitchCollection) (*ResolvedSwitch, error) {
+	if len(switchCfg.Spec) == 0 {
+		return nil, fmt.Errorf("no spec for switch %s", switchName)
+	}
+
+	if len(switchCfg.Spec) == 1 {
+		if switchCfg.StatePolicy != "" {
+			return nil, fmt.Errorf("state-policy is only supported for switches with several specs (switch %s)", switchName)
+		}
+		resolved, err := resolveSwitchSpec(switchName, switchCfg.Spec[0], collections)
+		if err != nil {
+			return nil, err
+		}
+		resolved.Tags = switchCfg.Tags
+		return resolved, nil
+	}
+
+	policy, err := switchcollection.ParseAggregatePolicy(switchCfg.StatePolicy)
+	if err != nil {
+		return nil, fmt.Errorf("switch %s: %w", switchName, err)
+	}
+
+	members := make([]*ResolvedSwitch, len(switchCfg.Spec))
+	memberSwitches := make([]switchcollection.Switch, len(switchCfg.Spec))
+	for i, spec := range switchCfg.Spec {
+		member, err := resolveSwitchSpec(switchName, spec, collections)
+		if err != nil {
+			return nil, err
+		}
+		members[i] = member
+		memberSwitches[i] = member.Switch
+	}
+
+	aggregate, err := switchcollection.NewAggregateSwitch(memberSwitches, policy)
+	if err != nil {
+		return nil, fmt.Errorf("switch %s: %w", switchName, err)
+	}
+
+	return &ResolvedSwitch{
+		Name:    switchName,
+		Switch:  aggregate,
+		Tags:    switchCfg.Tags,
+		Members: members,
+	}, nil
+}
+
+// resolveSwitchSpec parses a switch spec and resolves it to a specific switch in a collection.
+func resolveSwitchSpec(switchName string, spec string, collections map[string]switchcollection.SwitchCollection) (*ResolvedSwitch, error) {
 	// Parse spec format: "collection_name.index"
-	parts := strings.Split(switchCfg.Spec, ".")
+	parts := strings.Split(spec, ".")
 	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid switch spec format: %s (expected format: collection.index)", switchCfg.Spec)
+		return nil, fmt.Errorf("invalid switch spec format: %s (expected format: collection.index)", spec)
 	}
 
 	collectionName := parts[0]
@@ -235,25 +670,56 @@ func resolveSwitch(switchName string, switchCfg SwitchConfig, collections map[st
 	}
 
 	return &ResolvedSwitch{
-		Name:       switchName,
-		Collection: collection,
-		Index:      switchIndex,
-		Switch:     sw,
+		Name:           switchName,
+		CollectionName: collectionName,
+		Collection:     collection,
+		Index:          switchIndex,
+		Switch:         sw,
 	}, nil
 }
 
 // newServerWithCollections creates a new Server instance with the given collections and switches.
 // If addProductionMiddleware is true, adds logger and CORS middleware.
-func newServerWithCollections(collections map[string]switchcollection.SwitchCollection, switches map[string]*ResolvedSwitch, groups map[string]*SwitchGroup, listenAddr string, addProductionMiddleware bool) *Server {
+func newServerWithCollections(collections map[string]switchcollection.SwitchCollection, switches map[string]*ResolvedSwitch, groups map[string]*SwitchGroup, listenAddrs []string, addProductionMiddleware bool) *Server {
 	s := &Server{
-		listenAddr:  listenAddr,
+		listenAddrs: listenAddrs,
 		collections: collections,
 		switches:    switches,
 		groups:      groups,
 		timers:      make(map[string]*timerData),
 		blinkers:    make(map[string]*blink.Blink),
 		flipflops:   make(map[string]*flipflop.Flipflop),
+		operations:  make(map[string]*operation),
+		watchdogs:   make(map[string]*timerData),
+		onSince:     make(map[string]time.Time),
+		schedules:   make(map[string]*schedule),
 		router:      chi.NewRouter(),
+		events:      newEventBroker(),
+		clock:       clock.Real,
+
+		defaultDutyCycle: defaultDutyCycle,
+		maxBodyBytes:     defaultMaxBodyBytes,
+		runtimeGroups:    make(map[string][]string),
+		switchStates:     make(map[string]bool),
+		stateChanges:     make(map[string]stateChange),
+		idempotencyKeys:  newIdempotencyCache(),
+
+		shutdownTimeout: httpserver.ShutdownTimeout,
+		webhookClient:   &http.Client{Timeout: 5 * time.Second},
+	}
+
+	// Observe switches becoming disabled or re-enabled, being switched on
+	// or off on the device, or collections changing size
+	for _, collection := range collections {
+		if notifier, ok := collection.(switchcollection.DisabledStateNotifier); ok {
+			notifier.SetDisabledCallback(s.handleDisabledStateChange)
+		}
+		if notifier, ok := collection.(switchcollection.StateChangeNotifier); ok {
+			notifier.SetStateCallback(s.handleStateChange)
+		}
+		if notifier, ok := collection.(switchcollection.CountChangeNotifier); ok {
+			notifier.SetCountChangedCallback(s.handleCountChange)
+		}
 	}
 
 	if addProductionMiddleware {
@@ -261,8 +727,8 @@ func newServerWithCollections(collections map[string]switchcollection.SwitchColl
 		s.router.Use(cors.Handler(cors.Options{
 			AllowedOrigins:   []string{"http://*", "https://*"},
 			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-			ExposedHeaders:   []string{"Link"},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", idempotencyKeyHeader, actionSourceHeader},
+			ExposedHeaders:   []string{"Link", idempotencyReplayedHeader},
 			AllowCredentials: true,
 			MaxAge:           300, // Maximum value not ignored by any of major browsers
 		}))
@@ -272,11 +738,18 @@ func newServerWithCollections(collections map[string]switchcollection.SwitchColl
 	return s
 }
 
-// initMQTTClient initializes the MQTT client with the given server URL
-func (s *Server) initMQTTClient(serverURL string) error {
+// initMQTTClient initializes the MQTT client with the given server URL and
+// switch event topic template (empty for the default). The client publishes
+// whether the server is online to mqtt.DefaultStatusTopic. It keeps
+// trying to connect in the background, with exponential backoff, until it
+// succeeds or the server is closed.
+func (s *Server) initMQTTClient(serverURL, topicTemplate string) error {
 	mqttConfig := mqtt.Config{
-		ServerURL: serverURL,
-		ClientID:  "airdancer-api",
+		ServerURL:        serverURL,
+		ClientID:         "airdancer-api",
+		OnConnect:        s.handleMQTTConnect,
+		SwitchEventTopic: topicTemplate,
+		StatusTopic:      mqtt.DefaultStatusTopic,
 	}
 
 	client, err := mqtt.NewClient(mqttConfig)
@@ -288,23 +761,371 @@ func (s *Server) initMQTTClient(serverURL string) error {
 	return nil
 }
 
-// publishMQTTSwitchEvent publishes a switch event to MQTT
-func (s *Server) publishMQTTSwitchEvent(switchName, eventName string) {
-	if s.mqttClient == nil || !s.mqttClient.IsConnected() {
+// publishSwitchEvent publishes a switch event to event stream clients and
+// to MQTT, and records the change of state it implies
+func (s *Server) publishSwitchEvent(switchName, eventName string) {
+	s.events.publish(streamEvent{name: "switch", data: switchEvent{Switch: switchName, Event: eventName}})
+
+	state, hasState := s.eventState(switchName, eventName)
+	if hasState {
+		s.recordStateChange(switchName, state)
+	}
+
+	// Events published while the broker is unreachable are queued by the
+	// client and sent when it reconnects
+	if s.mqttClient == nil {
 		return
 	}
 
 	if err := s.mqttClient.PublishSwitchEvent(switchName, eventName); err != nil {
 		log.Printf("Failed to publish MQTT switch event: %v", err)
 	}
+
+	if hasState {
+		if err := s.mqttClient.PublishSwitchState(switchName, string(state), true); err != nil {
+			log.Printf("Failed to publish MQTT switch state: %v", err)
+		}
+	}
+}
+
+// eventState returns the state a switch is in after eventName, if the
+// event implies one
+func (s *Server) eventState(switchName, eventName string) (switchState, bool) {
+	switch state := switchState(eventName); state {
+	case switchStateOn, switchStateOff, switchStateBlink, switchStateDisabled:
+		return state, true
+	case "enabled":
+		resolvedSwitch, ok := s.switches[switchName]
+		if !ok {
+			return "", false
+		}
+		s.switchesMutex.RLock()
+		sw := resolvedSwitch.Switch
+		s.switchesMutex.RUnlock()
+		on, err := sw.GetState()
+		if err != nil {
+			return "", false
+		}
+		if on {
+			return switchStateOn, true
+		}
+		return switchStateOff, true
+	default:
+		return "", false
+	}
+}
+
+// handleMQTTConnect is called each time the MQTT client connects. It
+// subscribes to telemetry and publishes the state of every switch, so that
+// the retained states are correct even if they changed while the broker was
+// unreachable.
+func (s *Server) handleMQTTConnect(client *mqtt.Client) {
+	s.subscribeTelemetry(client)
+	s.publishStateSnapshot(client)
+}
+
+// publishStateSnapshot publishes the current state of every switch as a
+// retained message
+func (s *Server) publishStateSnapshot(client *mqtt.Client) {
+	s.mutex.Lock()
+	snapshot, err := s.snapshotSwitchStates(s.switches)
+	s.mutex.Unlock()
+	if err != nil {
+		log.Printf("Failed to publish MQTT switch states: %v", err)
+		return
+	}
+
+	for switchName, status := range snapshot {
+		if err := client.PublishSwitchState(switchName, string(status.State), true); err != nil {
+			log.Printf("Failed to publish MQTT switch state: %v", err)
+		}
+	}
+}
+
+// subscribeTelemetry subscribes every collection that supports it to the
+// state reports its devices publish. It is called each time the MQTT client
+// connects, since subscriptions do not survive a reconnect.
+func (s *Server) subscribeTelemetry(client *mqtt.Client) {
+	for name, collection := range s.collections {
+		if subscriber, ok := collection.(switchcollection.TelemetrySubscriber); ok {
+			if err := subscriber.SubscribeTelemetry(client); err != nil {
+				log.Printf("Failed to subscribe to telemetry for collection %s: %v", name, err)
+			}
+		}
+	}
+}
+
+// handleStateChange is called by switch collections when a device reports
+// that it was turned on or off outside of airdancer. It publishes an MQTT
+// event for each named switch that refers to sw. Like
+// handleDisabledStateChange, it must not acquire s.mutex.
+func (s *Server) handleStateChange(sw switchcollection.Switch, state bool) {
+	event := "off"
+	if state {
+		event = "on"
+	}
+
+	for _, switchName := range s.switchNamesFor(sw) {
+		log.Printf("switch %s was turned %s on the device", switchName, event)
+		s.publishSwitchEvent(switchName, event)
+	}
+}
+
+// switchNamesFor returns the names of the switches that refer to sw. It
+// may be called with or without s.mutex held.
+func (s *Server) switchNamesFor(sw switchcollection.Switch) []string {
+	s.switchesMutex.RLock()
+	defer s.switchesMutex.RUnlock()
+
+	var names []string
+	for switchName, resolvedSwitch := range s.switches {
+		if resolvedSwitch.Switch == sw {
+			names = append(names, switchName)
+		}
+	}
+	return names
+}
+
+// unavailableSwitch stands in for a switch whose index is past the end of
+// its collection after the collection shrank. It reports itself as
+// disabled and rejects changes.
+type unavailableSwitch struct {
+	name string
+}
+
+func (u *unavailableSwitch) TurnOn() error {
+	return fmt.Errorf("%w: %s", ErrSwitchUnavailable, u.name)
+}
+
+func (u *unavailableSwitch) TurnOff() error {
+	return fmt.Errorf("%w: %s", ErrSwitchUnavailable, u.name)
+}
+
+func (u *unavailableSwitch) GetState() (bool, error) {
+	return false, nil
+}
+
+func (u *unavailableSwitch) IsDisabled() bool {
+	return true
+}
+
+func (u *unavailableSwitch) String() string {
+	return fmt.Sprintf("unavailable switch %s", u.name)
+}
+
+// handleCountChange is called by switch collections when their number of
+// switches changes. Every named switch in the collection is resolved again
+// by index; switches whose index no longer exists are replaced by an
+// unavailableSwitch, and so are reported as disabled until the collection
+// grows again. Aggregate switches with members in the collection are
+// rebuilt from their members, resolved again in the same way. Timers and
+// blinks on switches that change are canceled, and so are those on the
+// groups that include them and on all switches, since they hold the
+// switches that were replaced.
+func (s *Server) handleCountChange(collection switchcollection.SwitchCollection) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := collection.CountSwitches()
+	for switchName, resolvedSwitch := range s.switches {
+		var sw switchcollection.Switch
+		if len(resolvedSwitch.Members) > 0 {
+			sw = s.reresolveAggregate(switchName, resolvedSwitch, collection, count)
+		} else if resolvedSwitch.Collection == collection {
+			sw = reresolveSwitch(switchName, resolvedSwitch, collection, count)
+		}
+		if sw == nil || sw == resolvedSwitch.Switch {
+			continue
+		}
+
+		wasUnavailable := isUnavailable(resolvedSwitch.Switch)
+		s.cancelSwitchTasks(switchName)
+		for groupName, group := range s.groups {
+			if _, member := group.GetSwitches()[switchName]; member {
+				s.cancelSwitchTasks(groupName)
+			}
+		}
+		s.cancelSwitchTasks("all")
+		s.switchesMutex.Lock()
+		resolvedSwitch.Switch = sw
+		s.switchesMutex.Unlock()
+
+		if isUnavailable(sw) {
+			if !wasUnavailable {
+				log.Printf("switch %s is unavailable: collection %s has %d switches", switchName, resolvedSwitch.CollectionName, count)
+				s.publishSwitchEvent(switchName, "disabled")
+			}
+		} else if wasUnavailable {
+			log.Printf("switch %s is available again", switchName)
+			s.publishSwitchEvent(switchName, "enabled")
+		} else {
+			log.Printf("switch %s was replaced by its collection", switchName)
+		}
+	}
+}
+
+// reresolveSwitch returns the switch at the index of resolvedSwitch in
+// collection, which has count switches, or an unavailableSwitch called
+// switchName if there is none. An unavailableSwitch that stands in for
+// resolvedSwitch already is returned as it is.
+func reresolveSwitch(switchName string, resolvedSwitch *ResolvedSwitch, collection switchcollection.SwitchCollection, count uint) switchcollection.Switch {
+	if resolvedSwitch.Index < count {
+		sw, err := collection.GetSwitch(resolvedSwitch.Index)
+		if err == nil {
+			return sw
+		}
+		log.Printf("failed to resolve switch %s: %v", switchName, err)
+	}
+	if _, ok := resolvedSwitch.Switch.(*unavailableSwitch); ok {
+		return resolvedSwitch.Switch
+	}
+	return &unavailableSwitch{name: switchName}
+}
+
+// reresolveAggregate resolves again the members of the aggregate switch
+// switchName that belong to collection, which has count switches, and
+// returns a new aggregate switch operating them if any of them changed, or
+// the current one otherwise. The caller must hold s.mutex.
+func (s *Server) reresolveAggregate(switchName string, resolvedSwitch *ResolvedSwitch, collection switchcollection.SwitchCollection, count uint) switchcollection.Switch {
+	aggregate, ok := resolvedSwitch.Switch.(*switchcollection.AggregateSwitch)
+	if !ok {
+		return resolvedSwitch.Switch
+	}
+
+	changed := false
+	memberSwitches := make([]switchcollection.Switch, len(resolvedSwitch.Members))
+	for i, member := range resolvedSwitch.Members {
+		if member.Collection == collection {
+			if sw := reresolveSwitch(switchName, member, collection, count); sw != member.Switch {
+				s.switchesMutex.Lock()
+				member.Switch = sw
+				s.switchesMutex.Unlock()
+				changed = true
+			}
+		}
+		memberSwitches[i] = member.Switch
+	}
+	if !changed {
+		return resolvedSwitch.Switch
+	}
+
+	rebuilt, err := switchcollection.NewAggregateSwitch(memberSwitches, aggregate.Policy())
+	if err != nil {
+		log.Printf("failed to rebuild aggregate switch %s: %v", switchName, err)
+		return resolvedSwitch.Switch
+	}
+	return rebuilt
+}
+
+// isUnavailable returns true if sw is an unavailableSwitch, or an aggregate
+// switch with an unavailableSwitch among its members
+func isUnavailable(sw switchcollection.Switch) bool {
+	if aggregate, ok := sw.(*switchcollection.AggregateSwitch); ok {
+		return slices.ContainsFunc(aggregate.Members(), isUnavailable)
+	}
+	_, ok := sw.(*unavailableSwitch)
+	return ok
+}
+
+// cancelSwitchTasks stops any timer, blinker, or flipflop running on a
+// single switch or group. The caller must hold s.mutex.
+func (s *Server) cancelSwitchTasks(swid string) {
+	if timer, ok := s.timers[swid]; ok {
+		log.Printf("canceling timer on %s", swid)
+		timer.timer.Stop()
+		delete(s.timers, swid)
+	}
+
+	if blinker, ok := s.blinkers[swid]; ok {
+		log.Printf("canceling blinker on %s", swid)
+		if err := blinker.Stop(); err != nil {
+			log.Printf("failed to stop blinker on %s: %v", swid, err)
+		}
+		delete(s.blinkers, swid)
+	}
+
+	if flipflopInstance, ok := s.flipflops[swid]; ok {
+		log.Printf("canceling flipflop on %s", swid)
+		if err := flipflopInstance.Stop(); err != nil {
+			log.Printf("failed to stop flipflop on %s: %v", swid, err)
+		}
+		delete(s.flipflops, swid)
+	}
+}
+
+// disabledEvent is the payload sent to the disabled webhook.
+type disabledEvent struct {
+	Switch    string    `json:"switch"`
+	Event     string    `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// handleDisabledStateChange is called by switch collections when a switch is
+// disabled or re-enabled. It publishes an MQTT event and calls the disabled
+// webhook (if configured) for each named switch that refers to sw.
+//
+// Drivers call this from inside switch operations, which may happen while
+// s.mutex is held, so it must not acquire s.mutex.
+func (s *Server) handleDisabledStateChange(sw switchcollection.Switch, disabled bool) {
+	event := "enabled"
+	if disabled {
+		event = "disabled"
+	}
+
+	for _, switchName := range s.switchNamesFor(sw) {
+		log.Printf("switch %s is now %s", switchName, event)
+		s.publishSwitchEvent(switchName, event)
+
+		if s.disabledWebhookURL != "" {
+			go s.sendDisabledWebhook(disabledEvent{
+				Switch:    switchName,
+				Event:     event,
+				Timestamp: s.clock.Now(),
+			})
+		}
+	}
+}
+
+// sendDisabledWebhook posts a disabledEvent to the disabled webhook URL
+func (s *Server) sendDisabledWebhook(event disabledEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode webhook payload: %v", err)
+		return
+	}
+
+	resp, err := s.webhookClient.Post(s.disabledWebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to call disabled webhook for switch %s: %v", event.Switch, err)
+		return
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("Disabled webhook for switch %s returned status %d", event.Switch, resp.StatusCode)
+	}
 }
 
 // setupRoutes configures the HTTP routes and middleware for the server.
 func (s *Server) setupRoutes() {
+	s.router.Use(s.limitRequestBody)
+
 	s.router.Get("/", s.listRoutesHandler)
+	s.router.Get("/status", s.serverStatusHandler)
+	s.router.Get("/readyz", s.readyzHandler)
+	s.router.Get("/events", s.eventsHandler)
+	s.router.Get("/version", s.versionHandler)
+	s.router.Get("/tasks", s.tasksHandler)
+	s.router.Get("/timers", s.timersHandler)
+	s.router.With(s.requireAPIKey).Get("/config", s.configHandler)
+	s.router.With(s.rejectIfReadOnly).Post("/panic", s.panicHandler)
+	s.router.With(s.rejectIfReadOnly, s.validateJSONRequest).Post("/maintenance", s.maintenanceHandler)
 
 	// Set up routes with validation middleware
 	s.router.Route("/switch", func(r chi.Router) {
+		// Find switches by name and state
+		r.Get("/search", s.searchHandler)
+
 		// GET endpoints for status queries - only need basic name validation for status
 		r.With(
 			s.validateJSONRequest,
@@ -314,68 +1135,258 @@ func (s *Server) setupRoutes() {
 
 		// POST endpoints for switch control - restore full validation middleware chain
 		r.With(
+			s.rejectIfReadOnly,
+			s.skipAutomatedDuringMaintenance,
 			s.validateJSONRequest,
 			s.validateSwitchName,
 			s.validateSwitchExists,
+			s.deduplicateRequest,
 			s.validateSwitchRequest,
 		).Post("/{name}", s.switchHandler)
+
+		// Blink a single switch briefly to locate it
+		r.With(
+			s.rejectIfReadOnly,
+			s.skipAutomatedDuringMaintenance,
+			s.validateSwitchName,
+			s.validateSwitchExists,
+			s.deduplicateRequest,
+		).Post("/{name}/identify", s.identifyHandler)
+
+		// Probe a single switch's device, re-enabling it if it responds
+		r.With(
+			s.validateSwitchName,
+			s.validateSwitchExists,
+		).Post("/{name}/check", s.checkHandler)
+
+		// Exercise a single switch's driver by turning it on and off
+		r.With(
+			s.rejectIfReadOnly,
+			s.skipAutomatedDuringMaintenance,
+			s.validateSwitchName,
+			s.validateSwitchExists,
+		).Post("/{name}/test", s.switchTestHandler)
+
+		// Keep a switch's watchdog from turning it off
+		r.With(
+			s.rejectIfReadOnly,
+			s.validateSwitchName,
+			s.validateSwitchExists,
+		).Post("/{name}/heartbeat", s.heartbeatHandler)
+	})
+
+	// List and cancel long-running operations
+	s.router.Route("/operation", func(r chi.Router) {
+		r.Get("/", s.operationListHandler)
+		r.With(
+			s.rejectIfReadOnly,
+			s.skipAutomatedDuringMaintenance,
+		).Delete("/{id}", s.operationCancelHandler)
+	})
+
+	// Create, update, and delete groups at runtime
+	s.router.Route("/group", func(r chi.Router) {
+		r.With(
+			s.rejectIfReadOnly,
+			s.validateJSONRequest,
+		).Post("/{name}", s.groupUpdateHandler)
+		r.With(s.rejectIfReadOnly).Delete("/{name}", s.groupDeleteHandler)
 	})
 }
 
+// mountAt moves every route under basePath, for servers hosted behind a
+// proxy that routes by path. Requests outside basePath are not found.
+func (s *Server) mountAt(basePath string) {
+	root := chi.NewRouter()
+	root.Mount(basePath, s.router)
+	s.router = root
+}
+
+// Handler returns the HTTP handler for the API, so that it can be mounted
+// in another server or served by an httptest.Server. Unlike Start, it does
+// not put the switches in their startup state first.
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
 // Start starts the API server.
 
 func (s *Server) Start() error {
-	// Initialize all switch collections to off, but don't fail if some switches are unreachable
-	for name, collection := range s.collections {
-		if err := collection.TurnOff(); err != nil {
-			log.Printf("Warning: failed to initialize switches for collection %s: %v", name, err)
-			// Continue startup even if some switches are unreachable
+	if s.checkOnly {
+		return s.check()
+	}
+
+	s.initSwitches()
+	s.startSchedules()
+	s.startMaxOnReaper()
+	if err := s.startButtons(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return s.run(ctx)
+}
+
+// run serves requests until ctx is canceled, then shuts down the server.
+// Once the HTTP server has stopped accepting requests, running tasks and
+// timers are canceled so that nothing is left toggling switches.
+func (s *Server) run(ctx context.Context) error {
+	listeners, err := s.listen()
+	if err != nil {
+		return err
+	}
+
+	s.setBoundAddrs(listeners)
+	defer s.setBoundAddrs(nil)
+
+	var lineAddr string
+	if s.lineListen != "" {
+		lineListener, err := net.Listen("tcp", s.lineListen)
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close() //nolint:errcheck
+			}
+			return fmt.Errorf("failed to listen for line protocol on %s: %w", s.lineListen, err)
 		}
+		log.Printf("accepting line protocol connections on %s", lineListener.Addr())
+		go s.serveLineProtocol(ctx, lineListener)
+		lineAddr = lineListener.Addr().String()
+	}
+
+	var listenAddrs []string
+	for _, listener := range listeners {
+		listenAddrs = append(listenAddrs, listener.Addr().String())
 	}
+	s.logStartupSummary(listenAddrs, lineAddr)
 
 	srv := &http.Server{
-		Addr:    s.listenAddr,
-		Handler: s.router,
+		Handler:   s.router,
+		TLSConfig: s.tlsConfig,
+	}
+
+	err = httpserver.ServeWithShutdownTimeout(ctx, srv, listeners, s.shutdownTimeout)
+	if drainErr := s.drain(); drainErr != nil && err == nil {
+		err = drainErr
+	}
+	return err
+}
+
+// setBoundAddrs records the addresses of listeners as those the server is
+// listening on
+func (s *Server) setBoundAddrs(listeners []net.Listener) {
+	s.boundAddrsMutex.Lock()
+	defer s.boundAddrsMutex.Unlock()
+
+	s.boundAddrs = nil
+	for _, listener := range listeners {
+		s.boundAddrs = append(s.boundAddrs, listener.Addr())
+	}
+}
+
+// Addr returns the address the server is listening on (the first one, if it
+// listens on several), or nil if it is not running. With listen-port 0, it
+// reports the port chosen by the system.
+func (s *Server) Addr() net.Addr {
+	s.boundAddrsMutex.Lock()
+	defer s.boundAddrsMutex.Unlock()
+
+	if len(s.boundAddrs) == 0 {
+		return nil
 	}
+	return s.boundAddrs[0]
+}
 
+// drain cancels all running tasks and timers, giving up after
+// s.shutdownTimeout.
+func (s *Server) drain() error {
+	done := make(chan struct{})
 	go func() {
-		log.Printf("starting server on %s", s.listenAddr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server failed: %v", err)
-		}
+		defer close(done)
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.cancelAllTasksAndTimers()
 	}()
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-	<-stop
+	select {
+	case <-done:
+		return nil
+	case <-time.After(s.shutdownTimeout):
+		return fmt.Errorf("%w after %s", ErrShutdownTimeout, s.shutdownTimeout)
+	}
+}
+
+// listen creates the listeners for the server: a Unix socket if
+// listenSocket is set, otherwise a TCP socket on each of listenAddrs.
+func (s *Server) listen() ([]net.Listener, error) {
+	if s.listenSocket == "" {
+		return httpserver.Listen(s.listenAddrs)
+	}
 
-	log.Println("shutting down server...")
+	// Remove a socket left behind by a previous run, but refuse to remove
+	// anything that isn't a socket.
+	if info, err := os.Lstat(s.listenSocket); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNotASocket, s.listenSocket)
+		}
+		if err := os.Remove(s.listenSocket); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", s.listenSocket, err)
+		}
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	listener, err := net.Listen("unix", s.listenSocket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", s.listenSocket, err)
+	}
 
-	if err := srv.Shutdown(ctx); err != nil {
-		return fmt.Errorf("server shutdown failed: %w", err)
+	if err := os.Chmod(s.listenSocket, listenSocketMode); err != nil {
+		listener.Close() //nolint:errcheck
+		return nil, fmt.Errorf("failed to set permissions on %s: %w", s.listenSocket, err)
 	}
 
-	log.Println("server gracefully stopped")
-	return nil
+	return []net.Listener{listener}, nil
 }
 
-// Close closes all switch collection connections.
+// Close closes all switch collection connections. If offOnShutdown is set,
+// running tasks are stopped and every collection is turned off first.
 
 func (s *Server) Close() error {
+	s.stopButtons()
+
 	// Disconnect MQTT client if connected
 	if s.mqttClient != nil {
 		s.mqttClient.Disconnect(250)
 	}
 
-	var errors []error
-	for name, collection := range s.collections {
+	s.stopSchedules()
+	s.stopMaxOnReaper()
+
+	// Watchdogs cannot turn switches off once the collections are closed
+	s.mutex.Lock()
+	for switchName := range s.watchdogs {
+		s.disarmWatchdog(switchName)
+	}
+	s.mutex.Unlock()
+
+	if s.offOnShutdown {
+		// Stop tasks first so that nothing turns a switch back on
+		s.mutex.Lock()
+		s.cancelAllTasksAndTimers()
+		s.mutex.Unlock()
+	}
+
+	errors := s.forEachCollection(func(name string, collection switchcollection.SwitchCollection) error {
+		if s.offOnShutdown {
+			if err := collection.TurnOff(); err != nil {
+				log.Printf("Warning: failed to turn off switches for collection %s: %v", name, err)
+			}
+		}
 		if err := collection.Close(); err != nil {
-			errors = append(errors, fmt.Errorf("failed to close collection %s: %w", name, err))
+			return fmt.Errorf("failed to close collection %s: %w", name, err)
 		}
-	}
+		return nil
+	})
 
 	if len(errors) > 0 {
 		return fmt.Errorf("errors closing collections: %v", errors)
@@ -383,6 +1394,37 @@ func (s *Server) Close() error {
 	return nil
 }
 
+// forEachCollection calls fn for every switch collection and returns any
+// errors. Collections are processed concurrently (at most
+// maxConcurrentCollectionOps at a time) so that a slow or unreachable
+// collection doesn't delay the others.
+func (s *Server) forEachCollection(fn func(name string, collection switchcollection.SwitchCollection) error) []error {
+	var g errgroup.Group
+	g.SetLimit(maxConcurrentCollectionOps)
+
+	// Each collection reports its error in its own slot, so that every
+	// error is returned rather than only the first
+	results := make([]error, len(s.collections))
+	i := 0
+	for name, collection := range s.collections {
+		slot := i
+		g.Go(func() error {
+			results[slot] = fn(name, collection)
+			return nil
+		})
+		i++
+	}
+	g.Wait() //nolint:errcheck
+
+	var errs []error
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
 func (s *Server) ListRoutes() [][]string {
 	routes := [][]string{}
 
@@ -1,8 +1,26 @@
 package api
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/larsks/airdancer/internal/buttondriver/common"
+	"github.com/larsks/airdancer/internal/mqtt"
+	"github.com/larsks/airdancer/internal/mqtt/mqtttest"
+	"github.com/larsks/airdancer/internal/switchcollection"
+	"github.com/larsks/airdancer/internal/version"
 )
 
 func TestNewServer(t *testing.T) {
@@ -26,8 +44,8 @@ func TestNewServer(t *testing.T) {
 					},
 				},
 				Switches: map[string]SwitchConfig{
-					"switch1": {Spec: "test-collection.0"},
-					"switch2": {Spec: "test-collection.1"},
+					"switch1": {Spec: SwitchSpec{"test-collection.0"}},
+					"switch2": {Spec: SwitchSpec{"test-collection.1"}},
 				},
 			},
 			wantError: false,
@@ -56,7 +74,7 @@ func TestNewServer(t *testing.T) {
 					},
 				},
 				Switches: map[string]SwitchConfig{
-					"switch1": {Spec: "invalid-spec"},
+					"switch1": {Spec: SwitchSpec{"invalid-spec"}},
 				},
 			},
 			wantError:     true,
@@ -69,7 +87,7 @@ func TestNewServer(t *testing.T) {
 				ListenPort:    8080,
 				Collections:   make(map[string]CollectionConfig),
 				Switches: map[string]SwitchConfig{
-					"switch1": {Spec: "nonexistent.0"},
+					"switch1": {Spec: SwitchSpec{"nonexistent.0"}},
 				},
 			},
 			wantError:     true,
@@ -91,6 +109,79 @@ func TestNewServer(t *testing.T) {
 			wantError:     true,
 			errorContains: "unknown driver: unknown",
 		},
+		{
+			name: "negative default period",
+			config: &Config{
+				ListenAddress: "localhost",
+				ListenPort:    8080,
+				DefaultPeriod: -1,
+			},
+			wantError:     true,
+			errorContains: ErrInvalidDefaultPeriod.Error(),
+		},
+		{
+			name: "default duty cycle out of range",
+			config: &Config{
+				ListenAddress:    "localhost",
+				ListenPort:       8080,
+				DefaultDutyCycle: 1.5,
+			},
+			wantError:     true,
+			errorContains: ErrInvalidDefaultDutyCycle.Error(),
+		},
+		{
+			name: "invalid mqtt topic template",
+			config: &Config{
+				ListenAddress:     "localhost",
+				ListenPort:        8080,
+				MqttServer:        "mqtt://localhost:1883",
+				MqttTopicTemplate: "home/{name}/state",
+			},
+			wantError:     true,
+			errorContains: mqtt.ErrInvalidTopicTemplate.Error(),
+		},
+		{
+			name: "schedule for unknown switch",
+			config: &Config{
+				ListenAddress: "localhost",
+				ListenPort:    8080,
+				Schedules: map[string]ScheduleConfig{
+					"office": {Switch: "porch", Type: "window", Start: "09:00", End: "17:00"},
+				},
+			},
+			wantError:     true,
+			errorContains: "switch or group porch not found",
+		},
+		{
+			name: "alias that shadows a switch",
+			config: &Config{
+				ListenAddress: "localhost",
+				ListenPort:    8080,
+				Collections: map[string]CollectionConfig{
+					"test-collection": {
+						Driver:       "dummy",
+						DriverConfig: map[string]interface{}{"switch_count": 2},
+					},
+				},
+				Switches: map[string]SwitchConfig{
+					"switch1": {Spec: SwitchSpec{"test-collection.0"}},
+					"switch2": {Spec: SwitchSpec{"test-collection.1"}},
+				},
+				Aliases: map[string]string{"switch2": "switch1"},
+			},
+			wantError:     true,
+			errorContains: "switch2 is the name of a switch or group",
+		},
+		{
+			name: "alias for unknown switch",
+			config: &Config{
+				ListenAddress: "localhost",
+				ListenPort:    8080,
+				Aliases:       map[string]string{"porch-light": "porch"},
+			},
+			wantError:     true,
+			errorContains: "alias porch-light refers to unknown switch or group 'porch'",
+		},
 	}
 
 	for _, tt := range tests {
@@ -156,7 +247,7 @@ func TestServerClose(t *testing.T) {
 			},
 		},
 		Switches: map[string]SwitchConfig{
-			"switch1": {Spec: "test-collection.0"},
+			"switch1": {Spec: SwitchSpec{"test-collection.0"}},
 		},
 	}
 
@@ -177,3 +268,1022 @@ func TestServerClose(t *testing.T) {
 		t.Errorf("Second Close() returned error: %v", err)
 	}
 }
+
+// slowCollection wraps a collection so that TurnOff and Close take delay to
+// complete and then fail with err (if set).
+type slowCollection struct {
+	switchcollection.SwitchCollection
+	delay time.Duration
+	err   error
+}
+
+func (c *slowCollection) TurnOff() error {
+	time.Sleep(c.delay)
+	return c.err
+}
+
+func (c *slowCollection) Close() error {
+	time.Sleep(c.delay)
+	return c.err
+}
+
+// unhealthyCollection wraps a collection so that HealthCheck fails with err
+type unhealthyCollection struct {
+	switchcollection.SwitchCollection
+	err error
+}
+
+func (c *unhealthyCollection) HealthCheck(ctx context.Context) error {
+	return c.err
+}
+
+func TestServerCollectionsProcessedConcurrently(t *testing.T) {
+	const delay = 100 * time.Millisecond
+
+	collections := map[string]switchcollection.SwitchCollection{}
+	for _, name := range []string{"c1", "c2", "c3", "c4"} {
+		collections[name] = &slowCollection{
+			SwitchCollection: switchcollection.NewDummySwitchCollection(1),
+			delay:            delay,
+			err:              errors.New("unreachable"),
+		}
+	}
+
+	server := newServerWithCollections(collections, map[string]*ResolvedSwitch{}, map[string]*SwitchGroup{}, nil, false)
+
+	// Running serially would take len(collections) * delay
+	start := time.Now()
+	server.initSwitches()
+	if elapsed := time.Since(start); elapsed >= 2*delay {
+		t.Errorf("initSwitches() took %v, want roughly %v", elapsed, delay)
+	}
+
+	start = time.Now()
+	err := server.Close()
+	if elapsed := time.Since(start); elapsed >= 2*delay {
+		t.Errorf("Close() took %v, want roughly %v", elapsed, delay)
+	}
+	if err == nil {
+		t.Fatal("Close() expected error from failing collections")
+	}
+	for name := range collections {
+		if !strings.Contains(err.Error(), "collection "+name+":") {
+			t.Errorf("Close() error %q does not mention collection %s", err, name)
+		}
+	}
+}
+
+func TestServerDisabledWebhook(t *testing.T) {
+	events := make(chan disabledEvent, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event disabledEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("webhook received invalid JSON: %v", err)
+		}
+		events <- event
+	}))
+	defer webhook.Close()
+
+	collection := switchcollection.NewDummySwitchCollection(2)
+	sw, err := collection.GetSwitch(1)
+	if err != nil {
+		t.Fatalf("GetSwitch() failed: %v", err)
+	}
+	switches := map[string]*ResolvedSwitch{
+		"lamp": {Name: "lamp", Collection: collection, Index: 1, Switch: sw},
+	}
+
+	server := newServerWithCollections(map[string]switchcollection.SwitchCollection{"dummy": collection}, switches, map[string]*SwitchGroup{}, nil, false)
+	server.disabledWebhookURL = webhook.URL
+	defer server.Close()
+
+	dummySwitch := sw.(*switchcollection.DummySwitch)
+	waitForEvent := func(want string) {
+		t.Helper()
+		select {
+		case event := <-events:
+			if event.Switch != "lamp" || event.Event != want {
+				t.Errorf("webhook received %s/%s, want lamp/%s", event.Switch, event.Event, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %s event", want)
+		}
+	}
+
+	// Repeated calls without a transition must not fire the hook again
+	dummySwitch.SetDisabled(true)
+	dummySwitch.SetDisabled(true)
+	waitForEvent("disabled")
+
+	dummySwitch.SetDisabled(false)
+	dummySwitch.SetDisabled(false)
+	waitForEvent("enabled")
+
+	select {
+	case event := <-events:
+		t.Errorf("unexpected extra webhook event: %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestServerListenSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "api.sock")
+
+	// Leave a stale socket behind, as a crashed server would
+	stale, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to create stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close() //nolint:errcheck
+
+	server := createTestServer(t, 2)
+	defer server.Close()
+	server.listenSocket = socketPath
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- server.run(ctx)
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		resp, err = client.Get("http://unix/switch/all")
+		if err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("request over unix socket failed: %v", err)
+	}
+	resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /switch/all over unix socket status = %v, want %v", resp.StatusCode, http.StatusOK)
+	}
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("failed to stat socket: %v", err)
+	}
+	if info.Mode().Perm() != listenSocketMode {
+		t.Errorf("socket mode = %v, want %v", info.Mode().Perm(), os.FileMode(listenSocketMode))
+	}
+
+	cancel()
+	if err := <-runErr; err != nil {
+		t.Errorf("run() returned error: %v", err)
+	}
+}
+
+func TestServerListenPortZero(t *testing.T) {
+	config := NewConfig()
+	config.ListenAddress = "127.0.0.1"
+	config.ListenPort = 0
+	config.Collections["panel"] = CollectionConfig{Driver: "dummy", DriverConfig: map[string]interface{}{"switch_count": 1}}
+	server, err := NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	defer server.Close()
+
+	if addr := server.Addr(); addr != nil {
+		t.Errorf("Addr() = %v before the server started, want nil", addr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- server.run(ctx)
+	}()
+
+	var addr net.Addr
+	for i := 0; i < 50 && addr == nil; i++ {
+		time.Sleep(20 * time.Millisecond)
+		addr = server.Addr()
+	}
+	if addr == nil {
+		t.Fatal("Addr() is nil after the server started")
+	}
+	if port := addr.(*net.TCPAddr).Port; port == 0 {
+		t.Fatalf("Addr() = %v, want the port chosen by the system", addr)
+	}
+
+	resp, err := http.Get("http://" + addr.String() + "/switch/all")
+	if err != nil {
+		t.Fatalf("GET /switch/all on %v failed: %v", addr, err)
+	}
+	resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /switch/all status = %v, want %v", resp.StatusCode, http.StatusOK)
+	}
+
+	cancel()
+	if err := <-runErr; err != nil {
+		t.Errorf("run() returned error: %v", err)
+	}
+	if addr := server.Addr(); addr != nil {
+		t.Errorf("Addr() = %v after the server stopped, want nil", addr)
+	}
+}
+
+func TestServerListenSocketNotASocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	if err := os.WriteFile(path, []byte("not a socket"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	server := createTestServer(t, 1)
+	defer server.Close()
+	server.listenSocket = path
+
+	if _, err := server.listen(); !errors.Is(err, ErrNotASocket) {
+		t.Errorf("listen() error = %v, want %v", err, ErrNotASocket)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("listen() must not remove a regular file: %v", err)
+	}
+}
+
+func TestNewServerListenConflict(t *testing.T) {
+	config := NewConfig()
+	config.ListenAddress = "localhost"
+	config.ListenSocket = "/tmp/airdancer.sock"
+
+	if _, err := NewServer(config); !errors.Is(err, ErrListenConflict) {
+		t.Errorf("NewServer() error = %v, want %v", err, ErrListenConflict)
+	}
+}
+
+func TestServerRunStopsTasksOnShutdown(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+	server.listenAddrs = []string{"127.0.0.1:0"}
+	server.shutdownTimeout = time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- server.run(ctx)
+	}()
+
+	requests := map[string]string{
+		"switch0": `{"state": "blink", "period": 0.05}`,
+		"green":   `{"state": "flipflop", "period": 0.05}`,
+		"switch1": `{"state": "on", "duration": 60}`,
+	}
+	for target, body := range requests {
+		req := httptest.NewRequest("POST", "/switch/"+target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST /switch/%s status = %v, want %v, body: %s", target, w.Code, http.StatusOK, w.Body.String())
+		}
+	}
+
+	server.mutex.Lock()
+	blinker := server.blinkers["switch0"]
+	flipflopInstance := server.flipflops["green"]
+	server.mutex.Unlock()
+
+	cancel()
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Fatalf("run() returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run() did not return after shutdown")
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if len(server.blinkers) != 0 || len(server.flipflops) != 0 || len(server.timers) != 0 {
+		t.Errorf("tasks left after shutdown: blinkers=%d, flipflops=%d, timers=%d",
+			len(server.blinkers), len(server.flipflops), len(server.timers))
+	}
+	if blinker.IsRunning() {
+		t.Error("blinker still running after shutdown")
+	}
+	if flipflopInstance.IsRunning() {
+		t.Error("flipflop still running after shutdown")
+	}
+}
+
+func TestServerCloseOffOnShutdown(t *testing.T) {
+	for _, offOnShutdown := range []bool{false, true} {
+		t.Run(fmt.Sprintf("off-on-shutdown=%v", offOnShutdown), func(t *testing.T) {
+			server := createTestServer(t, 4)
+			server.offOnShutdown = offOnShutdown
+
+			req := httptest.NewRequest("POST", "/switch/all", strings.NewReader(`{"state": "on"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("POST /switch/all status = %v, want %v, body: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+
+			if err := server.Close(); err != nil {
+				t.Fatalf("Close() returned error: %v", err)
+			}
+
+			for name, resolvedSwitch := range server.switches {
+				state, err := resolvedSwitch.Switch.GetState()
+				if err != nil {
+					t.Fatalf("failed to get state of %s: %v", name, err)
+				}
+				if state == offOnShutdown {
+					t.Errorf("%s state after shutdown = %v, want %v", name, state, !offOnShutdown)
+				}
+			}
+		})
+	}
+}
+
+func TestServerSwitchMetadata(t *testing.T) {
+	server, err := NewServer(&Config{
+		Collections: map[string]CollectionConfig{
+			"porch": {
+				Driver:       "dummy",
+				DriverConfig: map[string]interface{}{"switch_count": 2},
+			},
+		},
+		Switches: map[string]SwitchConfig{
+			"light":  {Spec: SwitchSpec{"porch.0"}, Tags: []string{"lights", "outside"}},
+			"heater": {Spec: SwitchSpec{"porch.1"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	server.initSwitches()
+	defer server.Close()
+
+	req := httptest.NewRequest("GET", "/switch/all", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	var resp struct {
+		Data multiSwitchResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	light := resp.Data.Switches["light"]
+	if light == nil || light.Collection != "porch" || strings.Join(light.Tags, ",") != "lights,outside" {
+		t.Errorf("light = %+v, want collection porch and tags [lights outside]", light)
+	}
+	heater := resp.Data.Switches["heater"]
+	if heater == nil || heater.Collection != "porch" || len(heater.Tags) != 0 {
+		t.Errorf("heater = %+v, want collection porch and no tags", heater)
+	}
+}
+
+func TestServerAggregateSwitch(t *testing.T) {
+	server, err := NewServer(&Config{
+		Collections: map[string]CollectionConfig{
+			"col1": {Driver: "dummy", DriverConfig: map[string]interface{}{"switch_count": 1}},
+			"col2": {Driver: "dummy", DriverConfig: map[string]interface{}{"switch_count": 1}},
+		},
+		Switches: map[string]SwitchConfig{
+			"both": {Spec: SwitchSpec{"col1.0", "col2.0"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	server.initSwitches()
+	defer server.Close()
+
+	members := []switchcollection.Switch{
+		server.switches["both"].Members[0].Switch,
+		server.switches["both"].Members[1].Switch,
+	}
+
+	for _, state := range []string{"on", "off"} {
+		req := httptest.NewRequest("POST", "/switch/both", strings.NewReader(fmt.Sprintf(`{"state": %q}`, state)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST /switch/both %s: status = %d, body: %s", state, w.Code, w.Body.String())
+		}
+
+		for _, member := range members {
+			if memberState, _ := member.GetState(); memberState != (state == "on") {
+				t.Errorf("after turning both %s, member %s is on = %v", state, member, memberState)
+			}
+		}
+	}
+}
+
+func TestServerAggregateSwitchCountChange(t *testing.T) {
+	server, err := NewServer(&Config{
+		Collections: map[string]CollectionConfig{
+			"col1": {Driver: "dummy", DriverConfig: map[string]interface{}{"switch-count": 2}},
+			"col2": {Driver: "dummy", DriverConfig: map[string]interface{}{"switch-count": 1}},
+		},
+		Switches: map[string]SwitchConfig{
+			"both": {Spec: SwitchSpec{"col1.1", "col2.0"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	server.initSwitches()
+	defer server.Close()
+	collection := server.collections["col1"].(*switchcollection.DummySwitchCollection)
+
+	// The member in col1 goes away, so the aggregate is disabled
+	collection.SetSwitchCount(1)
+	if !server.switches["both"].Switch.IsDisabled() {
+		t.Fatal("aggregate switch is not disabled after one of its members was removed")
+	}
+	if w := serve(server, "POST", "/switch/both", `{"state": "on"}`); w.Code == http.StatusOK {
+		t.Error("aggregate switch with a removed member was turned on")
+	}
+
+	// The member comes back as a new switch, which the aggregate operates
+	collection.SetSwitchCount(2)
+	if server.switches["both"].Switch.IsDisabled() {
+		t.Fatal("aggregate switch is still disabled after its collection grew again")
+	}
+	if w := serve(server, "POST", "/switch/both", `{"state": "on"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/both: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	member, err := collection.GetSwitch(1)
+	if err != nil {
+		t.Fatalf("GetSwitch() failed: %v", err)
+	}
+	if on, _ := member.GetState(); !on {
+		t.Error("aggregate switch did not turn on the member that replaced the removed one")
+	}
+}
+
+func TestResolveSwitchStatePolicy(t *testing.T) {
+	collections := map[string]switchcollection.SwitchCollection{
+		"col": switchcollection.NewDummySwitchCollection(2),
+	}
+
+	if _, err := resolveSwitch("one", SwitchConfig{Spec: SwitchSpec{"col.0"}, StatePolicy: "any-on"}, collections); err == nil {
+		t.Error("resolveSwitch() accepted a state-policy for a switch with one spec")
+	}
+	if _, err := resolveSwitch("two", SwitchConfig{Spec: SwitchSpec{"col.0", "col.1"}, StatePolicy: "most-on"}, collections); !errors.Is(err, switchcollection.ErrInvalidAggregatePolicy) {
+		t.Errorf("resolveSwitch() error = %v, want %v", err, switchcollection.ErrInvalidAggregatePolicy)
+	}
+}
+
+func TestServerReadOnly(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+	server.readOnly = true
+
+	for _, path := range []string{"/switch/switch0", "/switch/switch0/identify"} {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"state":"on"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("POST %s status = %v, want %v", path, w.Code, http.StatusForbidden)
+		}
+	}
+
+	if state, _ := server.switches["switch0"].Switch.GetState(); state {
+		t.Error("switch0 was turned on by a read-only server")
+	}
+
+	for _, path := range []string{"/switch/switch0", "/switch/all", "/switch/search?state=off"} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s status = %v, want %v, body: %s", path, w.Code, http.StatusOK, w.Body.String())
+		}
+	}
+}
+
+func TestServerEffectDefaults(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+
+	// Without a default period, blink requests must give one
+	req := httptest.NewRequest("POST", "/switch/switch0", strings.NewReader(`{"state":"blink"}`))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("blink without period status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+
+	server.defaultPeriod = 2
+	server.defaultDutyCycle = 0.25
+
+	for _, target := range []string{"switch0", "green"} {
+		body := `{"state":"blink"}`
+		if target == "green" {
+			body = `{"state":"flipflop"}`
+		}
+		req := httptest.NewRequest("POST", "/switch/"+target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST /switch/%s status = %v, want %v, body: %s", target, w.Code, http.StatusOK, w.Body.String())
+		}
+	}
+
+	server.mutex.Lock()
+	blinker := server.blinkers["switch0"]
+	if blinker.GetPeriod() != 2 || blinker.GetDutyCycle() != 0.25 {
+		t.Errorf("blink period, duty cycle = %v, %v; want 2, 0.25", blinker.GetPeriod(), blinker.GetDutyCycle())
+	}
+	ff := server.flipflops["green"]
+	if ff.GetPeriod() != 2 || ff.GetDutyCycle() != 0.25 {
+		t.Errorf("flipflop period, duty cycle = %v, %v; want 2, 0.25", ff.GetPeriod(), ff.GetDutyCycle())
+	}
+	server.mutex.Unlock()
+
+	// Values in the request override the defaults
+	req = httptest.NewRequest("POST", "/switch/switch1", strings.NewReader(`{"state":"blink","period":0.5,"dutyCycle":0.75}`))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/switch1 status = %v, want %v", w.Code, http.StatusOK)
+	}
+	server.mutex.Lock()
+	blinker = server.blinkers["switch1"]
+	if blinker.GetPeriod() != 0.5 || blinker.GetDutyCycle() != 0.75 {
+		t.Errorf("blink period, duty cycle = %v, %v; want 0.5, 0.75", blinker.GetPeriod(), blinker.GetDutyCycle())
+	}
+	server.mutex.Unlock()
+
+	// The defaults are reported by /status
+	req = httptest.NewRequest("GET", "/status", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	var resp struct {
+		Data serverStatusResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode /status response: %v", err)
+	}
+	if resp.Data.Defaults.Period == nil || *resp.Data.Defaults.Period != 2 || resp.Data.Defaults.DutyCycle != 0.25 {
+		t.Errorf("/status defaults = %+v, want period 2 and duty cycle 0.25", resp.Data.Defaults)
+	}
+}
+
+func TestServerReadyz(t *testing.T) {
+	collections := map[string]switchcollection.SwitchCollection{
+		"good": switchcollection.NewDummySwitchCollection(1),
+	}
+	server := newServerWithCollections(collections, map[string]*ResolvedSwitch{}, map[string]*SwitchGroup{}, nil, false)
+
+	readyz := func() (int, APIResponse, readinessResponse) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/readyz", nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		var resp struct {
+			APIResponse
+			Data readinessResponse `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode /readyz response: %v", err)
+		}
+		return w.Code, resp.APIResponse, resp.Data
+	}
+
+	code, _, data := readyz()
+	if code != http.StatusOK {
+		t.Errorf("GET /readyz status = %v, want %v", code, http.StatusOK)
+	}
+	if data.Collections["good"] != "ok" {
+		t.Errorf("GET /readyz collections = %v, want good: ok", data.Collections)
+	}
+
+	collections["bad"] = &unhealthyCollection{
+		SwitchCollection: switchcollection.NewDummySwitchCollection(1),
+		err:              errors.New("unreachable"),
+	}
+
+	code, resp, data := readyz()
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("GET /readyz status = %v, want %v", code, http.StatusServiceUnavailable)
+	}
+	if resp.Status != "error" {
+		t.Errorf("GET /readyz response status = %q, want %q", resp.Status, "error")
+	}
+	if data.Collections["good"] != "ok" || data.Collections["bad"] != "unreachable" {
+		t.Errorf("GET /readyz collections = %v, want good: ok, bad: unreachable", data.Collections)
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	server := createTestServer(t, 1)
+	ts := httptest.NewServer(server.router)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", ts.URL+"/events", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /events failed: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("GET /events Content-Type = %q, want %q", ct, "text/event-stream")
+	}
+
+	// The handler subscribes before sending headers, so the event cannot be
+	// missed
+	switchReq := httptest.NewRequest("POST", "/switch/switch0", strings.NewReader(`{"state": "on"}`))
+	switchReq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, switchReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/switch0 status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && scanner.Text() != "" {
+		lines = append(lines, scanner.Text())
+	}
+
+	want := []string{"event: switch", `data: {"switch":"switch0","event":"on"}`}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("GET /events sent %q, want %q", lines, want)
+	}
+}
+
+// fakeButtonDriver delivers the events sent on its channel
+type fakeButtonDriver struct {
+	events chan common.ButtonEvent
+}
+
+func (d *fakeButtonDriver) Events() <-chan common.ButtonEvent { return d.events }
+func (d *fakeButtonDriver) Start() error                      { return nil }
+func (d *fakeButtonDriver) Stop()                             {}
+func (d *fakeButtonDriver) AddButton(interface{}) error       { return nil }
+func (d *fakeButtonDriver) GetButtons() []string              { return []string{"power"} }
+
+func TestServerButtonEvents(t *testing.T) {
+	server := createTestServer(t, 1)
+	driver := &fakeButtonDriver{events: make(chan common.ButtonEvent)}
+	server.buttonDrivers = map[string]common.ButtonDriver{"fake": driver}
+	if err := server.startButtons(); err != nil {
+		t.Fatalf("startButtons() failed: %v", err)
+	}
+	defer close(driver.events)
+
+	ts := httptest.NewServer(server.router)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", ts.URL+"/events", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /events failed: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	driver.events <- common.ButtonEvent{Source: "power", Type: common.ButtonPressed, Timestamp: time.Now()}
+	driver.events <- common.ButtonEvent{Source: "power", Type: common.ButtonReleased, Timestamp: time.Now()}
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(lines) < 5 && scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	want := []string{
+		"event: button",
+		`data: {"button":"power","type":"pressed"}`,
+		"",
+		"event: button",
+		`data: {"button":"power","type":"released"}`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("GET /events sent %q, want %q", lines, want)
+	}
+}
+
+func TestNewServerInvalidButton(t *testing.T) {
+	config := NewConfig()
+	config.Buttons = map[string]ButtonConfig{"power": {Driver: "gpio"}}
+
+	if _, err := NewServer(config); !errors.Is(err, ErrInvalidButton) {
+		t.Errorf("NewServer() error = %v, want %v", err, ErrInvalidButton)
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	oldVersion := version.BuildVersion
+	version.BuildVersion = "1.2.3"
+	t.Cleanup(func() { version.BuildVersion = oldVersion })
+
+	server := createTestServer(t, 1)
+	defer server.Close()
+
+	req := httptest.NewRequest("GET", "/version", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /version status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var resp struct {
+		Data version.Info `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode /version response: %v", err)
+	}
+	if resp.Data.Version != "1.2.3" {
+		t.Errorf("GET /version version = %q, want %q", resp.Data.Version, "1.2.3")
+	}
+}
+
+func TestServerSwitchCountChange(t *testing.T) {
+	server := createTestServer(t, 3)
+	defer server.Close()
+	collection := server.collections["test-collection"].(*switchcollection.DummySwitchCollection)
+
+	status := func(switchName string) switchState {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/switch/"+switchName, nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		var resp struct {
+			Data switchResponse `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode status of %s: %v", switchName, err)
+		}
+		return resp.Data.State
+	}
+
+	turnOn := func(switchName string) int {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/switch/"+switchName, strings.NewReader(`{"state":"on"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := turnOn("switch2"); code != http.StatusOK {
+		t.Fatalf("POST /switch/switch2 status = %v, want %v", code, http.StatusOK)
+	}
+
+	// Switches past the end of the collection become disabled
+	collection.SetSwitchCount(2)
+	if state := status("switch2"); state != switchStateDisabled {
+		t.Errorf("switch2 state after shrinking = %q, want %q", state, switchStateDisabled)
+	}
+	if state := status("switch1"); state != switchStateOff {
+		t.Errorf("switch1 state after shrinking = %q, want %q", state, switchStateOff)
+	}
+	if code := turnOn("switch2"); code != http.StatusBadRequest {
+		t.Errorf("POST /switch/switch2 after shrinking status = %v, want %v", code, http.StatusBadRequest)
+	}
+
+	// and are resolved again when it grows
+	collection.SetSwitchCount(3)
+	if state := status("switch2"); state != switchStateOff {
+		t.Errorf("switch2 state after growing = %q, want %q", state, switchStateOff)
+	}
+	if code := turnOn("switch2"); code != http.StatusOK {
+		t.Errorf("POST /switch/switch2 after growing status = %v, want %v", code, http.StatusOK)
+	}
+	if state, _ := collection.ListSwitches()[2].GetState(); !state {
+		t.Error("POST /switch/switch2 after growing did not turn on the new switch")
+	}
+}
+
+func TestServerSwitchCountChangeDuringCallbacks(t *testing.T) {
+	// Collections call handleStateChange and handleDisabledStateChange
+	// without s.mutex while another collection change may be replacing
+	// switches; run with -race to check that they do not conflict
+	server := createTestServer(t, 3)
+	defer server.Close()
+	collection := server.collections["test-collection"].(*switchcollection.DummySwitchCollection)
+	sw := collection.ListSwitches()[0]
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 50 {
+			collection.SetSwitchCount(uint(2 + i%2))
+		}
+	}()
+	for i := range 50 {
+		server.handleStateChange(sw, i%2 == 0)
+		server.handleDisabledStateChange(sw, false)
+	}
+	wg.Wait()
+
+	// The collection ends with 3 switches
+	if server.switches["switch2"].Switch.IsDisabled() {
+		t.Error("switch2 is disabled after the collection grew again")
+	}
+}
+
+func TestServerSwitchCountChangeDuringCheck(t *testing.T) {
+	// Run with -race to check that a check does not read a switch while
+	// a collection change replaces it
+	server := createTestServer(t, 3)
+	defer server.Close()
+	collection := server.collections["test-collection"].(*switchcollection.DummySwitchCollection)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				collection.SetSwitchCount(3)
+				return
+			default:
+				collection.SetSwitchCount(uint(2 + i%2))
+			}
+		}
+	}()
+	for range 500 {
+		serve(server, "POST", "/switch/switch2/check", "")
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestServerSwitchCountChangeCancelsGroupTasks(t *testing.T) {
+	server := createTestServerWithGroups(t, 4)
+	defer server.Close()
+	collection := server.collections["test-collection"].(*switchcollection.DummySwitchCollection)
+
+	for _, target := range []string{"red", "green"} {
+		if w := serve(server, "POST", "/switch/"+target, `{"state": "blink", "period": 1000}`); w.Code != http.StatusOK {
+			t.Fatalf("POST /switch/%s: status = %d, body: %s", target, w.Code, w.Body.String())
+		}
+	}
+
+	// switch3, in group green, is removed
+	collection.SetSwitchCount(3)
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if _, ok := server.blinkers["green"]; ok {
+		t.Error("blink on group green is still running after one of its switches was removed")
+	}
+	if blinker, ok := server.blinkers["red"]; !ok || !blinker.IsRunning() {
+		t.Error("blink on group red, whose switches did not change, was stopped")
+	}
+}
+
+func TestServerMQTTSwitchState(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	server := createTestServer(t, 2)
+	if err := server.switches["switch1"].Switch.TurnOn(); err != nil {
+		t.Fatalf("Failed to turn on switch1: %v", err)
+	}
+
+	if err := server.initMQTTClient(broker.URL(), ""); err != nil {
+		t.Fatalf("initMQTTClient() failed: %v", err)
+	}
+	defer server.mqttClient.Disconnect(0)
+
+	// nextState returns the next retained switch state published to the
+	// broker, skipping switch events
+	nextState := func() mqtt.SwitchState {
+		t.Helper()
+		for {
+			msg := broker.Next(t)
+			if !strings.HasPrefix(msg.Topic, "state/switch/") {
+				continue
+			}
+			if !msg.Retained {
+				t.Errorf("State published to %s was not retained", msg.Topic)
+			}
+			var state mqtt.SwitchState
+			if err := json.Unmarshal(msg.Payload, &state); err != nil {
+				t.Fatalf("Failed to decode switch state %s: %v", msg.Payload, err)
+			}
+			if msg.Topic != mqtt.SwitchStateTopic(state.SwitchName) {
+				t.Errorf("State for %s published to %s", state.SwitchName, msg.Topic)
+			}
+			return state
+		}
+	}
+
+	// Connecting publishes a snapshot of every switch
+	snapshot := make(map[string]string)
+	for range server.switches {
+		state := nextState()
+		snapshot[state.SwitchName] = state.State
+	}
+	if snapshot["switch0"] != "off" || snapshot["switch1"] != "on" {
+		t.Errorf("Snapshot = %v, want switch0: off, switch1: on", snapshot)
+	}
+
+	req := httptest.NewRequest("POST", "/switch/switch0", strings.NewReader(`{"state": "on"}`))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/switch0 status = %v, want %v: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	if state := nextState(); state.SwitchName != "switch0" || state.State != "on" {
+		t.Errorf("State after turning on switch0 = %+v, want switch0 on", state)
+	}
+}
+
+func TestServerHandler(t *testing.T) {
+	server := createTestServer(t, 1)
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/switch/switch0", "application/json", strings.NewReader(`{"state": "on"}`))
+	if err != nil {
+		t.Fatalf("POST /switch/switch0 failed: %v", err)
+	}
+	resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /switch/switch0 status = %v, want %v", resp.StatusCode, http.StatusOK)
+	}
+
+	resp, err = http.Get(ts.URL + "/switch/switch0")
+	if err != nil {
+		t.Fatalf("GET /switch/switch0 failed: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /switch/switch0 status = %v, want %v", resp.StatusCode, http.StatusOK)
+	}
+
+	var status struct {
+		APIResponse
+		Data switchResponse `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode switch status: %v", err)
+	}
+	if status.Data.State != switchStateOn {
+		t.Errorf("switch0 state = %q, want %q", status.Data.State, switchStateOn)
+	}
+}
+
+func TestServerBasePath(t *testing.T) {
+	server := createTestServer(t, 1)
+	server.mountAt("/airdancer")
+
+	get := func(path string) int {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, path := range []string{"/airdancer/status", "/airdancer/switch/switch0"} {
+		if code := get(path); code != http.StatusOK {
+			t.Errorf("GET %s status = %v, want %v", path, code, http.StatusOK)
+		}
+	}
+	for _, path := range []string{"/status", "/switch/switch0"} {
+		if code := get(path); code != http.StatusNotFound {
+			t.Errorf("GET %s status = %v, want %v", path, code, http.StatusNotFound)
+		}
+	}
+
+	for _, route := range server.ListRoutes() {
+		if !strings.HasPrefix(route[1], "/airdancer/") {
+			t.Errorf("Route %s %s is not under the base path", route[0], route[1])
+		}
+	}
+}
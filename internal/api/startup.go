@@ -0,0 +1,121 @@
+package api
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/larsks/airdancer/internal/switchcollection"
+)
+
+// startupState is the state a switch is put in when the server starts
+type startupState string
+
+const (
+	startupStateOff  startupState = "off"
+	startupStateOn   startupState = "on"
+	startupStateLast startupState = "last"
+)
+
+// parseStartupState parses the startup-state of a switch. An empty value
+// selects startupStateOff.
+func parseStartupState(value string) (startupState, error) {
+	switch state := startupState(value); state {
+	case "":
+		return startupStateOff, nil
+	case startupStateOff, startupStateOn, startupStateLast:
+		return state, nil
+	default:
+		return "", fmt.Errorf("%w, got '%s'", ErrInvalidStartupState, value)
+	}
+}
+
+// initSwitches puts every switch in its startup state. The switches of
+// different collections are initialized concurrently, so that an
+// unreachable collection doesn't delay the others; aggregate switches are
+// initialized afterwards. Failures are logged rather than returned so that
+// unreachable switches don't prevent startup.
+func (s *Server) initSwitches() {
+	s.forEachCollection(func(name string, collection switchcollection.SwitchCollection) error {
+		for switchName, resolvedSwitch := range s.switches {
+			if resolvedSwitch.Collection == collection {
+				s.applyStartupState(switchName, resolvedSwitch)
+			}
+		}
+		return nil
+	})
+
+	for switchName, resolvedSwitch := range s.switches {
+		if len(resolvedSwitch.Members) > 0 {
+			s.applyStartupState(switchName, resolvedSwitch)
+		}
+	}
+}
+
+// applyStartupState turns a switch on or off according to its startup
+// state. A switch whose startup state is "last" but that has no saved state
+// is turned off.
+func (s *Server) applyStartupState(switchName string, resolvedSwitch *ResolvedSwitch) {
+	on := resolvedSwitch.StartupState == startupStateOn
+	if resolvedSwitch.StartupState == startupStateLast {
+		on = s.switchStates[switchName]
+	}
+
+	var err error
+	if on {
+		err = resolvedSwitch.Switch.TurnOn()
+	} else {
+		err = resolvedSwitch.Switch.TurnOff()
+	}
+	if err != nil {
+		log.Printf("Warning: failed to initialize switch %s: %v", switchName, err)
+	}
+}
+
+// recordSwitchStates saves the state of each switch controlled by name (a
+// switch, a group, or "all") whose startup state is "last", so that it is
+// restored when the server restarts. The caller must hold s.mutex.
+func (s *Server) recordSwitchStates(name string) {
+	if s.stateFile == "" {
+		return
+	}
+
+	resolvedSwitches := map[string]*ResolvedSwitch{}
+	if resolvedSwitch, exists := s.switches[name]; exists {
+		resolvedSwitches[name] = resolvedSwitch
+	} else if group, exists := s.groups[name]; exists {
+		resolvedSwitches = group.GetSwitches()
+	} else if name == "all" {
+		resolvedSwitches = s.switches
+	}
+
+	states := make(map[string]bool, len(s.switchStates))
+	for switchName, on := range s.switchStates {
+		states[switchName] = on
+	}
+
+	changed := false
+	for switchName, resolvedSwitch := range resolvedSwitches {
+		if resolvedSwitch.StartupState != startupStateLast {
+			continue
+		}
+
+		on, err := resolvedSwitch.Switch.GetState()
+		if err != nil {
+			log.Printf("failed to get state of switch %s: %v", switchName, err)
+			continue
+		}
+		if saved, exists := states[switchName]; !exists || saved != on {
+			states[switchName] = on
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	if err := s.writeState(serverState{Groups: s.runtimeGroups, Switches: states}); err != nil {
+		log.Printf("failed to save switch states: %v", err)
+		return
+	}
+	s.switchStates = states
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newStartupTestServer returns a server with a dummy collection "panel" of
+// two switches, configured with switches
+func newStartupTestServer(t *testing.T, stateFile string, switches map[string]SwitchConfig) *Server {
+	t.Helper()
+	server, err := NewServer(&Config{
+		Collections: map[string]CollectionConfig{
+			"panel": {Driver: "dummy", DriverConfig: map[string]interface{}{"switch_count": 2}},
+		},
+		Switches:  switches,
+		StateFile: stateFile,
+	})
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	return server
+}
+
+func switchIsOn(t *testing.T, server *Server, switchName string) bool {
+	t.Helper()
+	state, err := server.switches[switchName].Switch.GetState()
+	if err != nil {
+		t.Fatalf("GetState() for %s failed: %v", switchName, err)
+	}
+	return state
+}
+
+func TestInitSwitchesStartupState(t *testing.T) {
+	server := newStartupTestServer(t, "", map[string]SwitchConfig{
+		"status": {Spec: SwitchSpec{"panel.0"}, StartupState: "on"},
+		"lamp":   {Spec: SwitchSpec{"panel.1"}},
+	})
+	defer server.Close()
+
+	server.switches["lamp"].Switch.TurnOn() //nolint:errcheck
+	server.initSwitches()
+
+	if !switchIsOn(t, server, "status") {
+		t.Error("switch with startup-state on is off after startup")
+	}
+	if switchIsOn(t, server, "lamp") {
+		t.Error("switch with the default startup-state is on after startup")
+	}
+}
+
+func TestInitSwitchesRestoresLastState(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	switches := map[string]SwitchConfig{
+		"porch": {Spec: SwitchSpec{"panel.0"}, StartupState: "last"},
+		"lamp":  {Spec: SwitchSpec{"panel.1"}},
+	}
+
+	server := newStartupTestServer(t, stateFile, switches)
+	server.initSwitches()
+	for _, switchName := range []string{"porch", "lamp"} {
+		req := httptest.NewRequest("POST", "/switch/"+switchName, strings.NewReader(`{"state": "on"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST /switch/%s: status = %d, body: %s", switchName, w.Code, w.Body.String())
+		}
+	}
+	server.Close() //nolint:errcheck
+
+	restarted := newStartupTestServer(t, stateFile, switches)
+	defer restarted.Close()
+	restarted.initSwitches()
+
+	if !switchIsOn(t, restarted, "porch") {
+		t.Error("switch with startup-state last was not restored to on")
+	}
+	if switchIsOn(t, restarted, "lamp") {
+		t.Error("switch with the default startup-state is on after startup")
+	}
+}
+
+func TestNewServerStartupStateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		startup string
+		want    error
+	}{
+		{"invalid", "dim", ErrInvalidStartupState},
+		{"last without state file", "last", ErrStartupStateNeedsStateFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewServer(&Config{
+				Collections: map[string]CollectionConfig{
+					"panel": {Driver: "dummy", DriverConfig: map[string]interface{}{"switch_count": 1}},
+				},
+				Switches: map[string]SwitchConfig{
+					"lamp": {Spec: SwitchSpec{"panel.0"}, StartupState: tt.startup},
+				},
+			})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("NewServer() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
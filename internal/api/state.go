@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// serverState is the content of the state file. Groups maps the name of
+// each group created through the API to its switches. Switches records the
+// last state of each switch whose startup-state is "last".
+type serverState struct {
+	Groups   map[string][]string `json:"groups"`
+	Switches map[string]bool     `json:"switches,omitempty"`
+}
+
+// writeState replaces the content of the state file. The file is replaced
+// atomically so that a crash does not leave it truncated.
+func (s *Server) writeState(state serverState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmpFile := s.stateFile + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.stateFile, err)
+	}
+	if err := os.Rename(tmpFile, s.stateFile); err != nil {
+		os.Remove(tmpFile) //nolint:errcheck
+		return fmt.Errorf("failed to write %s: %w", s.stateFile, err)
+	}
+	return nil
+}
+
+// loadState restores the groups and switch states saved in the state file.
+// A missing state file is not an error.
+func (s *Server) loadState() error {
+	data, err := os.ReadFile(s.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read state file %s: %w", s.stateFile, err)
+	}
+
+	var state serverState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse state file %s: %w", s.stateFile, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.restoreGroups(state.Groups)
+	for switchName, on := range state.Switches {
+		if _, exists := s.switches[switchName]; exists {
+			s.switchStates[switchName] = on
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"time"
+)
+
+// stateChange records the last change of state of a switch or group.
+// onAt is when it was last turned on, even if it was already on.
+type stateChange struct {
+	state     switchState
+	previous  switchState
+	changedAt time.Time
+	onAt      time.Time
+}
+
+// recordStateChange records that name, a switch, group, or "all", is now in
+// state, if that is not the state it was last recorded in. A change made
+// through a group (or "all") is recorded for its switches as well. Turning
+// name on is recorded as its latest on time even if it was already on.
+//
+// Like publishSwitchEvent, which calls it, it may be called with or without
+// s.mutex held. Only callers that hold s.mutex pass the names of groups.
+func (s *Server) recordStateChange(name string, state switchState) {
+	names := []string{name}
+	if _, isSwitch := s.switches[name]; !isSwitch {
+		members := s.switches
+		if group, isGroup := s.groups[name]; isGroup {
+			members = group.GetSwitches()
+		} else if name != "all" {
+			members = nil
+		}
+		for switchName := range members {
+			names = append(names, switchName)
+		}
+	}
+
+	s.stateChangesMutex.Lock()
+	defer s.stateChangesMutex.Unlock()
+
+	now := s.clock.Now()
+	for _, name := range names {
+		last, ok := s.stateChanges[name]
+		if ok && last.state == state {
+			if state == switchStateOn {
+				last.onAt = now
+				s.stateChanges[name] = last
+			}
+			continue
+		}
+		change := stateChange{state: state, previous: last.state, changedAt: now}
+		if state == switchStateOn {
+			change.onAt = now
+		}
+		s.stateChanges[name] = change
+	}
+}
+
+// lastStateChange returns the last recorded change of state of name
+func (s *Server) lastStateChange(name string) (stateChange, bool) {
+	s.stateChangesMutex.Lock()
+	defer s.stateChangesMutex.Unlock()
+
+	change, ok := s.stateChanges[name]
+	return change, ok
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// mqttCheckInterval is how often --check polls for the MQTT connection
+const mqttCheckInterval = 100 * time.Millisecond
+
+// startupSummary describes the server as it starts, so that a deployment
+// can be checked from a single log line. Collections holds the result of
+// each collection's health check, either "ok" or the error it returned.
+type startupSummary struct {
+	Collections map[string]string `json:"collections"`
+	Switches    int               `json:"switches"`
+	Disabled    []string          `json:"disabled,omitempty"`
+	Groups      int               `json:"groups"`
+	MQTT        *mqttStatus       `json:"mqtt,omitempty"`
+	Listen      []string          `json:"listen"`
+	LineListen  string            `json:"lineListen,omitempty"`
+}
+
+// summarize probes the switch collections and returns a summary of the
+// server, listening on listen and lineListen. It also returns the errors of
+// the collections that failed their health check.
+func (s *Server) summarize(listen []string, lineListen string) (startupSummary, []error) {
+	ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+	defer cancel()
+
+	collections, errs := s.checkCollections(ctx)
+	summary := startupSummary{
+		Collections: collections,
+		MQTT:        s.mqttState(),
+		Listen:      listen,
+		LineListen:  lineListen,
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	summary.Switches = len(s.switches)
+	summary.Groups = len(s.groups)
+	for switchName, resolvedSwitch := range s.switches {
+		if resolvedSwitch.Switch.IsDisabled() {
+			summary.Disabled = append(summary.Disabled, switchName)
+		}
+	}
+	slices.Sort(summary.Disabled)
+
+	return summary, errs
+}
+
+// logStartupSummary logs a summary of the server as one line of JSON and
+// returns the errors of the collections that failed their health check
+func (s *Server) logStartupSummary(listen []string, lineListen string) []error {
+	summary, errs := s.summarize(listen, lineListen)
+	data, err := json.Marshal(summary)
+	if err != nil {
+		log.Printf("failed to encode startup summary: %v", err)
+		return errs
+	}
+	log.Printf("startup summary: %s", data)
+	return errs
+}
+
+// check logs the startup summary and returns without serving requests or
+// putting the switches in their startup state. It gives the MQTT client up
+// to readinessTimeout to connect, so that the summary shows whether the
+// broker can be reached, and fails if any collection fails its health
+// check.
+func (s *Server) check() error {
+	if s.mqttClient != nil {
+		deadline := time.Now().Add(readinessTimeout)
+		for !s.mqttClient.IsConnected() && time.Now().Before(deadline) {
+			time.Sleep(mqttCheckInterval)
+		}
+	}
+
+	listen := s.listenAddrs
+	if s.listenSocket != "" {
+		listen = []string{s.listenSocket}
+	}
+	if errs := s.logStartupSummary(listen, s.lineListen); len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrStartupCheckFailed, errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/larsks/airdancer/internal/switchcollection"
+)
+
+func TestStartCheck(t *testing.T) {
+	// Hold the port, so that Start fails if it tries to bind it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close() //nolint:errcheck
+
+	server, err := NewServer(&Config{
+		ListenAddress: "127.0.0.1",
+		ListenPort:    listener.Addr().(*net.TCPAddr).Port,
+		Check:         true,
+		Collections: map[string]CollectionConfig{
+			"test-collection": {Driver: "dummy", DriverConfig: map[string]interface{}{"switch_count": 2}},
+		},
+		Switches: map[string]SwitchConfig{
+			"switch0": {Spec: SwitchSpec{"test-collection.0"}},
+			"switch1": {Spec: SwitchSpec{"test-collection.1"}},
+		},
+		Groups: map[string]GroupConfig{
+			"both": {Switches: []string{"switch0", "switch1"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	defer server.Close() //nolint:errcheck
+	server.switches["switch1"].Switch.(*switchcollection.DummySwitch).SetDisabled(true)
+
+	done := make(chan error, 1)
+	go func() { done <- server.Start() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Start() in check mode failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start() in check mode did not return")
+	}
+	if addr := server.Addr(); addr != nil {
+		t.Errorf("Addr() = %v after a check, want nil", addr)
+	}
+
+	summary, errs := server.summarize(server.listenAddrs, "")
+	if len(errs) != 0 {
+		t.Errorf("summarize() errors = %v, want none", errs)
+	}
+	wantListen := net.JoinHostPort("127.0.0.1", strconv.Itoa(listener.Addr().(*net.TCPAddr).Port))
+	if summary.Collections["test-collection"] != "ok" || summary.Switches != 2 || summary.Groups != 1 ||
+		len(summary.Disabled) != 1 || summary.Disabled[0] != "switch1" ||
+		len(summary.Listen) != 1 || summary.Listen[0] != wantListen || summary.MQTT != nil {
+		t.Errorf("summarize() = %+v, want 2 switches (switch1 disabled), 1 group, listening on %s", summary, wantListen)
+	}
+
+	// The check fails if a collection fails its health check
+	server.collections["test-collection"] = &unhealthyCollection{
+		SwitchCollection: server.collections["test-collection"],
+		err:              errors.New("unreachable"),
+	}
+	if err := server.Start(); !errors.Is(err, ErrStartupCheckFailed) {
+		t.Errorf("Start() with an unhealthy collection error = %v, want %v", err, ErrStartupCheckFailed)
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/larsks/airdancer/internal/switchcollection"
@@ -121,6 +122,12 @@ func (sg *SwitchGroup) Close() error {
 	return nil
 }
 
+// HealthCheck returns nil; the health of the underlying collections is
+// checked directly.
+func (sg *SwitchGroup) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
 // IsDisabled returns true if any switch in the group is disabled
 func (sg *SwitchGroup) IsDisabled() bool {
 	for _, resolvedSwitch := range sg.switches {
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// taskStatus describes a blink or flipflop started by a request
+type taskStatus struct {
+	// Name is the switch or group the task runs on
+	Name      string      `json:"name"`
+	Type      switchState `json:"type"`
+	Period    float64     `json:"period"`
+	DutyCycle float64     `json:"dutyCycle"`
+	Running   bool        `json:"running"`
+}
+
+// timerStatus describes a pending timer. Durations are in seconds.
+type timerStatus struct {
+	// Name is the switch or group the timer runs on
+	Name string `json:"name"`
+	// Type is "duration" for timers that end a request (or carry out a
+	// deferred off), and "watchdog" for switch watchdogs
+	Type      string    `json:"type"`
+	Duration  float64   `json:"duration"`
+	Remaining float64   `json:"remaining"`
+	Expires   time.Time `json:"expires"`
+}
+
+// tasksHandler lists the blinks and flipflops the server is running, by
+// name
+func (s *Server) tasksHandler(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tasks := []taskStatus{}
+	for name, blinker := range s.blinkers {
+		tasks = append(tasks, taskStatus{
+			Name:      name,
+			Type:      switchStateBlink,
+			Period:    blinker.GetPeriod(),
+			DutyCycle: blinker.GetDutyCycle(),
+			Running:   blinker.IsRunning(),
+		})
+	}
+	for name, flipflopInstance := range s.flipflops {
+		tasks = append(tasks, taskStatus{
+			Name:      name,
+			Type:      switchStateFlipflop,
+			Period:    flipflopInstance.GetPeriod(),
+			DutyCycle: flipflopInstance.GetDutyCycle(),
+			Running:   flipflopInstance.IsRunning(),
+		})
+	}
+	slices.SortFunc(tasks, func(a, b taskStatus) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Type, b.Type))
+	})
+
+	s.sendSuccess(w, tasks)
+}
+
+// timersHandler lists the pending timers and watchdogs, by name
+func (s *Server) timersHandler(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clock.Now()
+	timers := []timerStatus{}
+	for timerType, timerMap := range map[string]map[string]*timerData{"duration": s.timers, "watchdog": s.watchdogs} {
+		for name, timer := range timerMap {
+			timers = append(timers, timerStatus{
+				Name:      name,
+				Type:      timerType,
+				Duration:  timer.duration.Seconds(),
+				Remaining: max(timer.expires.Sub(now), 0).Seconds(),
+				Expires:   timer.expires,
+			})
+		}
+	}
+	slices.SortFunc(timers, func(a, b timerStatus) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Type, b.Type))
+	})
+
+	s.sendSuccess(w, timers)
+}
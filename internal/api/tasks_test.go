@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTasksAndTimersHandlers(t *testing.T) {
+	server := createTestServer(t, 2)
+	defer server.Close()
+	fake := useFakeClock(server)
+
+	if w := serve(server, "POST", "/switch/switch0", `{"state": "blink", "period": 2, "dutyCycle": 0.25, "duration": 10}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/switch0: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	fake.BlockUntil(2)
+	fake.Advance(4 * time.Second)
+
+	w := serve(server, "GET", "/tasks", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /tasks: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var tasks struct {
+		Data []taskStatus `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&tasks); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	wantTask := taskStatus{Name: "switch0", Type: switchStateBlink, Period: 2, DutyCycle: 0.25, Running: true}
+	if len(tasks.Data) != 1 || tasks.Data[0] != wantTask {
+		t.Errorf("GET /tasks = %+v, want [%+v]", tasks.Data, wantTask)
+	}
+
+	w = serve(server, "GET", "/timers", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /timers: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var timers struct {
+		Data []timerStatus `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&timers); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(timers.Data) != 1 {
+		t.Fatalf("GET /timers = %+v, want one timer", timers.Data)
+	}
+	if got := timers.Data[0]; got.Name != "switch0" || got.Type != "duration" || got.Duration != 10 || got.Remaining != 6 {
+		t.Errorf("GET /timers = %+v, want a 10 second duration timer on switch0 with 6 seconds remaining", got)
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// heartbeatResponse reports when a switch's watchdog will turn it off
+// unless another heartbeat arrives
+type heartbeatResponse struct {
+	Switch  string    `json:"switch"`
+	Expires time.Time `json:"expires"`
+}
+
+// armWatchdog (re)starts the watchdog of switchName, if it has one, so that
+// the switch is turned off unless a heartbeat arrives within its watchdog
+// period. It returns the time at which the watchdog expires. The caller must
+// hold s.mutex.
+func (s *Server) armWatchdog(switchName string) (time.Time, bool) {
+	resolvedSwitch, exists := s.switches[switchName]
+	if !exists || resolvedSwitch.Watchdog == 0 {
+		return time.Time{}, false
+	}
+
+	s.disarmWatchdog(switchName)
+	watchdog := &timerData{duration: resolvedSwitch.Watchdog, expires: s.clock.Now().Add(resolvedSwitch.Watchdog)}
+	watchdog.stop = func() {
+		// Stop anything that could turn the switch back on: tasks on the
+		// switch itself, and on any group it belongs to
+		s.cancelTasksAndTimers(switchName)
+		for groupName, group := range s.groups {
+			if _, member := group.GetSwitches()[switchName]; member {
+				s.cancelTasksAndTimers(groupName)
+			}
+		}
+
+		if err := resolvedSwitch.Switch.TurnOff(); err != nil {
+			log.Printf("watchdog failed to turn off switch %s: %v", switchName, err)
+			return
+		}
+		delete(s.onSince, switchName)
+		s.publishSwitchEvent(switchName, "off")
+		s.recordSwitchStates(switchName)
+	}
+	watchdog.timer = s.clock.AfterFunc(watchdog.duration, func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.watchdogs[switchName] != watchdog {
+			return
+		}
+		delete(s.watchdogs, switchName)
+
+		log.Printf("watchdog expired for switch %s: no heartbeat for %s", switchName, watchdog.duration)
+		watchdog.stop()
+	})
+	s.watchdogs[switchName] = watchdog
+
+	return watchdog.expires, true
+}
+
+// disarmWatchdog stops the watchdog of switchName, if it is running. The
+// caller must hold s.mutex.
+func (s *Server) disarmWatchdog(switchName string) {
+	if watchdog, ok := s.watchdogs[switchName]; ok {
+		watchdog.timer.Stop()
+		delete(s.watchdogs, switchName)
+	}
+}
+
+// heartbeatHandler arms or re-arms the watchdog of a single switch
+func (s *Server) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	switchName := chi.URLParam(r, "name")
+
+	if _, exists := s.switches[switchName]; !exists {
+		s.sendErrorCode(w, fmt.Sprintf("heartbeat is only supported for individual switches, not %s", switchName), http.StatusBadRequest, errorCodeInvalidRequest, map[string]any{"switch": switchName})
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	expires, armed := s.armWatchdog(switchName)
+	if !armed {
+		s.sendErrorCode(w, fmt.Sprintf("Switch %s has no watchdog", switchName), http.StatusBadRequest, errorCodeInvalidRequest, map[string]any{"switch": switchName})
+		return
+	}
+	s.sendSuccess(w, heartbeatResponse{Switch: switchName, Expires: expires})
+}
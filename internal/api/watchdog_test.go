@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWatchdogTurnsSwitchOffWithoutHeartbeat(t *testing.T) {
+	server := createTestServer(t, 2)
+	defer server.Close()
+	fake := useFakeClock(server)
+	server.switches["switch0"].Watchdog = 5 * time.Second
+
+	if w := serve(server, "POST", "/switch/switch0", `{"state": "on"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/switch0: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if w := serve(server, "POST", "/switch/switch1", `{"state": "on"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/switch1: status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	// A heartbeat within the watchdog period keeps the switch on for
+	// another period
+	fake.Advance(3 * time.Second)
+	if w := serve(server, "POST", "/switch/switch0/heartbeat", ""); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/switch0/heartbeat: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	fake.Advance(4 * time.Second)
+	if on, _ := server.switches["switch0"].Switch.GetState(); !on {
+		t.Fatal("switch0 was turned off although a heartbeat arrived in time")
+	}
+
+	// Once the heartbeats stop, the switch is turned off
+	fake.Advance(time.Second)
+	if on, _ := server.switches["switch0"].Switch.GetState(); on {
+		t.Error("switch0 is still on after its heartbeat window expired")
+	}
+	if on, _ := server.switches["switch1"].Switch.GetState(); !on {
+		t.Error("switch1, which has no watchdog, was turned off")
+	}
+}
+
+func TestWatchdogStopsBlink(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+	fake := useFakeClock(server)
+	server.switches["switch0"].Watchdog = 2 * time.Second
+
+	if w := serve(server, "POST", "/switch/switch0", `{"state": "blink", "period": 4}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /switch/switch0: status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	fake.BlockUntil(2)
+	fake.Advance(2 * time.Second)
+	if _, exists := server.blinkers["switch0"]; exists {
+		t.Error("blinker on switch0 is still running after its watchdog expired")
+	}
+	if on, _ := server.switches["switch0"].Switch.GetState(); on {
+		t.Error("switch0 is still on after its watchdog expired")
+	}
+}
+
+func TestHeartbeatWithoutWatchdog(t *testing.T) {
+	server := createTestServer(t, 1)
+	defer server.Close()
+
+	if w := serve(server, "POST", "/switch/switch0/heartbeat", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("heartbeat for a switch without a watchdog: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -2,9 +2,11 @@ package blink
 
 import (
 	"log"
+	"math/rand/v2"
 	"sync"
 	"time"
 
+	"github.com/larsks/airdancer/internal/clock"
 	"github.com/larsks/airdancer/internal/switchcollection"
 )
 
@@ -13,14 +15,20 @@ type Blink struct {
 	sw        switchcollection.Switch
 	period    float64
 	dutyCycle float64
+	phase     float64
+	jitter    float64
+	rng       *rand.Rand
+	clock     clock.Clock
 	stopCh    chan struct{}
 	doneCh    chan struct{}
 	mutex     sync.RWMutex
 	running   bool
 }
 
-// NewBlink creates a new Blink instance with the given switch and period in seconds
-func NewBlink(sw switchcollection.Switch, period float64, dutyCycle float64) (*Blink, error) {
+// NewBlink creates a new Blink instance with the given switch and period in
+// seconds. Phase (0 to 1) offsets the starting point within the period, so
+// that blinks started with phases 0 and 0.5 run in opposition.
+func NewBlink(sw switchcollection.Switch, period float64, dutyCycle float64, phase float64) (*Blink, error) {
 	if sw == nil {
 		return nil, ErrSwitchRequired
 	}
@@ -30,6 +38,9 @@ func NewBlink(sw switchcollection.Switch, period float64, dutyCycle float64) (*B
 	if dutyCycle < 0 || dutyCycle > 1 {
 		return nil, ErrInvalidDutyCycle
 	}
+	if phase < 0 || phase > 1 {
+		return nil, ErrInvalidPhase
+	}
 
 	// Default duty cycle is 0.5 if not specified
 	if dutyCycle == 0 {
@@ -40,11 +51,42 @@ func NewBlink(sw switchcollection.Switch, period float64, dutyCycle float64) (*B
 		sw:        sw,
 		period:    period,
 		dutyCycle: dutyCycle,
+		phase:     phase,
+		clock:     clock.Real,
 		stopCh:    make(chan struct{}),
 		doneCh:    make(chan struct{}),
 	}, nil
 }
 
+// SetClock sets the clock used to time the blink. It must be called
+// before Start.
+func (b *Blink) SetClock(c clock.Clock) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.clock = c
+}
+
+// SetJitter randomizes each on and off interval by up to the given
+// fraction (0 to 1) of its length, so that the blink is less regular. It
+// must be called before Start.
+func (b *Blink) SetJitter(jitter float64) error {
+	if jitter < 0 || jitter > 1 {
+		return ErrInvalidJitter
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.jitter = jitter
+	return nil
+}
+
+// SetRand sets the random number generator used for jitter. It must be
+// called before Start.
+func (b *Blink) SetRand(rng *rand.Rand) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.rng = rng
+}
+
 // Start begins the blinking operation
 func (b *Blink) Start() error {
 	b.mutex.Lock()
@@ -108,6 +150,13 @@ func (b *Blink) GetDutyCycle() float64 {
 	return b.dutyCycle
 }
 
+// GetPhase returns the phase offset
+func (b *Blink) GetPhase() float64 {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.phase
+}
+
 // GetSwitch returns the underlying switch
 func (b *Blink) GetSwitch() switchcollection.Switch {
 	b.mutex.RLock()
@@ -115,36 +164,68 @@ func (b *Blink) GetSwitch() switchcollection.Switch {
 	return b.sw
 }
 
-// blinkLoop is the main goroutine that handles the blinking
+// blinkLoop is the main goroutine that handles the blinking. Each period
+// starts with the switch off and ends with it on.
 func (b *Blink) blinkLoop() {
 	defer close(b.doneCh)
 
 	onTime := time.Duration(b.period * b.dutyCycle * float64(time.Second))
 	offTime := time.Duration(b.period * (1 - b.dutyCycle) * float64(time.Second))
-	clock := time.NewTimer(offTime)
-	defer clock.Stop()
+
+	// Work out where in the period the phase puts us
+	offset := time.Duration(b.period * b.phase * float64(time.Second))
+	if offset >= onTime+offTime {
+		offset = 0
+	}
 
 	state := false // Start with off state
+	delay := offTime - offset
+	if offset >= offTime {
+		state = true
+		delay = onTime + offTime - offset
+		if err := b.sw.TurnOn(); err != nil {
+			log.Printf("blinker failed to turn on switch %s", b.sw)
+		}
+	}
+
+	timer := b.clock.NewTimer(b.jittered(delay))
+	defer func() { timer.Stop() }()
 
 	for {
 		select {
 		case <-b.stopCh:
 			return
-		case <-clock.C:
+		case <-timer.C():
 			state = !state
 			if state {
 				if err := b.sw.TurnOn(); err != nil {
 					log.Printf("blinker failed to turn on switch %s", b.sw)
 					break
 				}
-				clock = time.NewTimer(onTime)
+				timer = b.clock.NewTimer(b.jittered(onTime))
 			} else {
 				if err := b.sw.TurnOff(); err != nil {
 					log.Printf("blinker failed to turn off switch %s", b.sw)
 					break
 				}
-				clock = time.NewTimer(offTime)
+				timer = b.clock.NewTimer(b.jittered(offTime))
 			}
 		}
 	}
 }
+
+// jittered returns d adjusted by a random amount within the jitter bound
+func (b *Blink) jittered(d time.Duration) time.Duration {
+	if b.jitter == 0 {
+		return d
+	}
+
+	var r float64
+	if b.rng != nil {
+		r = b.rng.Float64()
+	} else {
+		r = rand.Float64()
+	}
+
+	return time.Duration(float64(d) * (1 + b.jitter*(2*r-1)))
+}
@@ -1,9 +1,13 @@
 package blink
 
 import (
+	"errors"
+	"math/rand/v2"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/larsks/airdancer/internal/clock"
 	"github.com/larsks/airdancer/internal/switchcollection"
 )
 
@@ -12,7 +16,7 @@ func TestNewBlink(t *testing.T) {
 	sw := &switchcollection.DummySwitch{}
 	period := 0.5 // 0.5 seconds, equivalent to 2Hz
 
-	blink, err := NewBlink(sw, period, 0)
+	blink, err := NewBlink(sw, period, 0, 0)
 	if err != nil {
 		t.Fatalf("NewBlink() failed: %v", err)
 	}
@@ -59,7 +63,7 @@ func TestNewBlinkErrors(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := NewBlink(tt.sw, tt.period, 0)
+			_, err := NewBlink(tt.sw, tt.period, 0, 0)
 			if err != tt.wantErr {
 				t.Errorf("NewBlink() error = %v, want %v", err, tt.wantErr)
 			}
@@ -69,7 +73,7 @@ func TestNewBlinkErrors(t *testing.T) {
 
 func TestBlinkStartStop(t *testing.T) {
 	sw := &switchcollection.DummySwitch{}
-	blink, err := NewBlink(sw, 0.1, 0) // 0.1s period for faster testing
+	blink, err := NewBlink(sw, 0.1, 0, 0) // 0.1s period for faster testing
 	if err != nil {
 		t.Fatalf("NewBlink() failed: %v", err)
 	}
@@ -117,7 +121,7 @@ func TestBlinkStartStop(t *testing.T) {
 
 func TestBlinkRestartability(t *testing.T) {
 	sw := &switchcollection.DummySwitch{}
-	blink, err := NewBlink(sw, 0.1, 0)
+	blink, err := NewBlink(sw, 0.1, 0, 0)
 	if err != nil {
 		t.Fatalf("NewBlink() failed: %v", err)
 	}
@@ -151,7 +155,7 @@ func TestBlinkPeriod(t *testing.T) {
 	sw := &switchcollection.DummySwitch{}
 
 	// Test with 0.2s period (should toggle every 100ms)
-	blink, err := NewBlink(sw, 0.2, 0)
+	blink, err := NewBlink(sw, 0.2, 0, 0)
 	if err != nil {
 		t.Fatalf("NewBlink() failed: %v", err)
 	}
@@ -196,7 +200,7 @@ func TestBlinkPeriod(t *testing.T) {
 
 func TestBlinkConcurrency(t *testing.T) {
 	sw := &switchcollection.DummySwitch{}
-	blink, err := NewBlink(sw, 0.05, 0) // High frequency for more concurrent operations
+	blink, err := NewBlink(sw, 0.05, 0, 0) // High frequency for more concurrent operations
 	if err != nil {
 		t.Fatalf("NewBlink() failed: %v", err)
 	}
@@ -228,3 +232,130 @@ func TestBlinkConcurrency(t *testing.T) {
 
 	<-done // Wait for goroutine to finish
 }
+
+func TestNewBlinkInvalidPhase(t *testing.T) {
+	sw := &switchcollection.DummySwitch{}
+	for _, phase := range []float64{-0.1, 1.1} {
+		if _, err := NewBlink(sw, 1, 0, phase); !errors.Is(err, ErrInvalidPhase) {
+			t.Errorf("NewBlink() with phase %v error = %v, want %v", phase, err, ErrInvalidPhase)
+		}
+	}
+}
+
+func TestBlinkPhase(t *testing.T) {
+	tests := []struct {
+		name         string
+		phase        float64
+		initialState bool
+		firstEdge    time.Duration
+	}{
+		{"no offset", 0, false, 500 * time.Millisecond},
+		{"quarter period", 0.25, false, 250 * time.Millisecond},
+		{"half period", 0.5, true, 500 * time.Millisecond},
+		{"three quarter period", 0.75, true, 250 * time.Millisecond},
+		{"full period", 1, false, 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sw := &switchcollection.DummySwitch{}
+			fake := clock.NewFake(time.Unix(0, 0))
+
+			blink, err := NewBlink(sw, 1, 0.5, tt.phase)
+			if err != nil {
+				t.Fatalf("NewBlink() failed: %v", err)
+			}
+			blink.SetClock(fake)
+
+			if err := blink.Start(); err != nil {
+				t.Fatalf("Start() failed: %v", err)
+			}
+			defer blink.Stop() //nolint:errcheck
+
+			fake.BlockUntil(1)
+			if state, _ := sw.GetState(); state != tt.initialState {
+				t.Errorf("initial state = %v, want %v", state, tt.initialState)
+			}
+
+			fake.Advance(tt.firstEdge - time.Millisecond)
+			if state, _ := sw.GetState(); state != tt.initialState {
+				t.Errorf("state before first edge = %v, want %v", state, tt.initialState)
+			}
+
+			fake.Advance(time.Millisecond)
+			fake.BlockUntil(1)
+			if state, _ := sw.GetState(); state == tt.initialState {
+				t.Errorf("state after first edge = %v, want %v", state, !tt.initialState)
+			}
+		})
+	}
+}
+
+// recordingClock records the duration of every timer created
+type recordingClock struct {
+	*clock.Fake
+	mutex     sync.Mutex
+	durations []time.Duration
+}
+
+func (c *recordingClock) NewTimer(d time.Duration) clock.Timer {
+	c.mutex.Lock()
+	c.durations = append(c.durations, d)
+	c.mutex.Unlock()
+	return c.Fake.NewTimer(d)
+}
+
+// collectIntervals advances c until n timers have been created and
+// returns their durations.
+func (c *recordingClock) collectIntervals(n int) []time.Duration {
+	for {
+		c.BlockUntil(1)
+		c.mutex.Lock()
+		if len(c.durations) >= n {
+			durations := append([]time.Duration(nil), c.durations[:n]...)
+			c.mutex.Unlock()
+			return durations
+		}
+		c.mutex.Unlock()
+		c.Advance(time.Second)
+	}
+}
+
+func TestBlinkJitter(t *testing.T) {
+	sw := &switchcollection.DummySwitch{}
+	rc := &recordingClock{Fake: clock.NewFake(time.Unix(0, 0))}
+
+	blink, err := NewBlink(sw, 1, 0.5, 0)
+	if err != nil {
+		t.Fatalf("NewBlink() failed: %v", err)
+	}
+	if err := blink.SetJitter(1.5); !errors.Is(err, ErrInvalidJitter) {
+		t.Errorf("SetJitter(1.5) error = %v, want %v", err, ErrInvalidJitter)
+	}
+	if err := blink.SetJitter(0.2); err != nil {
+		t.Fatalf("SetJitter() failed: %v", err)
+	}
+	blink.SetRand(rand.New(rand.NewPCG(1, 2)))
+	blink.SetClock(rc)
+
+	if err := blink.Start(); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	defer blink.Stop() //nolint:errcheck
+
+	intervals := rc.collectIntervals(20)
+
+	// Each half of the 1s period is 500ms +/- 20%
+	varied := false
+	for i, d := range intervals {
+		if d < 400*time.Millisecond || d > 600*time.Millisecond {
+			t.Errorf("interval %d = %v, want between 400ms and 600ms", i, d)
+		}
+		if d != 500*time.Millisecond {
+			varied = true
+		}
+	}
+	if !varied {
+		t.Error("jitter did not change any interval")
+	}
+}
@@ -7,6 +7,8 @@ var (
 	ErrSwitchRequired   = errors.New("switch is required")
 	ErrInvalidPeriod    = errors.New("period must be greater than 0")
 	ErrInvalidDutyCycle = errors.New("period must be between 0 and 1")
+	ErrInvalidPhase     = errors.New("phase must be between 0 and 1")
+	ErrInvalidJitter    = errors.New("jitter must be between 0 and 1")
 )
 
 // Blink operation errors
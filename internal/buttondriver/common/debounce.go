@@ -0,0 +1,48 @@
+package common
+
+import "time"
+
+// Debouncer tracks the debounced state of a single input. A reading that
+// differs from the last one starts the debounce period; once the input has
+// kept the same state for the debounce delay, the state is reported if it
+// differs from the last state reported.
+type Debouncer struct {
+	lastState     bool
+	currentState  bool
+	lastDebounce  time.Time
+	stateReported bool
+}
+
+// NewDebouncer returns a Debouncer for an input whose initial state, read
+// at now, is state. The initial state is considered reported.
+func NewDebouncer(state bool, now time.Time) Debouncer {
+	return Debouncer{
+		lastState:     state,
+		currentState:  state,
+		lastDebounce:  now,
+		stateReported: true,
+	}
+}
+
+// Update records that the input was in state at now, and reports whether
+// its debounced state has changed, and if so, the new state.
+func (d *Debouncer) Update(state bool, now time.Time, delay time.Duration) (bool, bool) {
+	// State changed, start debounce timer
+	if state != d.currentState {
+		d.currentState = state
+		d.lastDebounce = now
+		d.stateReported = false
+		return false, false
+	}
+
+	// State is stable, check if debounce period has elapsed and we haven't reported this state yet
+	if !d.stateReported && now.Sub(d.lastDebounce) >= delay {
+		d.stateReported = true
+		if state != d.lastState {
+			d.lastState = state
+			return true, state
+		}
+	}
+
+	return false, false
+}
@@ -0,0 +1,83 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDebouncer(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	start := time.Unix(0, 0)
+
+	type reading struct {
+		at          time.Duration
+		state       bool
+		wantChanged bool
+	}
+
+	tests := []struct {
+		name     string
+		readings []reading
+	}{
+		{
+			name: "change after the delay",
+			readings: []reading{
+				{0, true, false},
+				{30 * time.Millisecond, true, false},
+				{50 * time.Millisecond, true, true},
+			},
+		},
+		{
+			name: "bounce shorter than the delay",
+			readings: []reading{
+				{0, true, false},
+				{20 * time.Millisecond, false, false},
+				{40 * time.Millisecond, true, false},
+				{60 * time.Millisecond, false, false},
+				// Back to the initial state, which was already reported
+				{200 * time.Millisecond, false, false},
+			},
+		},
+		{
+			name: "bounce restarts the delay",
+			readings: []reading{
+				{0, true, false},
+				{40 * time.Millisecond, false, false},
+				{45 * time.Millisecond, true, false},
+				{60 * time.Millisecond, true, false},
+				{95 * time.Millisecond, true, true},
+			},
+		},
+		{
+			name: "repeated stable state",
+			readings: []reading{
+				{0, true, false},
+				{50 * time.Millisecond, true, true},
+				{100 * time.Millisecond, true, false},
+				{500 * time.Millisecond, true, false},
+			},
+		},
+		{
+			name: "initial state is not reported",
+			readings: []reading{
+				{0, false, false},
+				{100 * time.Millisecond, false, false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDebouncer(false, start)
+			for _, r := range tt.readings {
+				changed, state := d.Update(r.state, start.Add(r.at), delay)
+				if changed != r.wantChanged {
+					t.Fatalf("Update(%v) at %s: changed = %v, want %v", r.state, r.at, changed, r.wantChanged)
+				}
+				if changed && state != r.state {
+					t.Errorf("Update(%v) at %s: state = %v, want %v", r.state, r.at, state, r.state)
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"strings"
 	"sync"
@@ -62,6 +63,16 @@ func (d *EventButtonDriver) Start() error {
 				return fmt.Errorf("failed to open device %s: %v", device, err)
 			}
 			d.files[device] = file
+
+			// A grab applies to the whole device, so grab it if any of its
+			// buttons asks for exclusive access
+			if d.wantsExclusive(device) {
+				if err := grabDevice(file); err != nil {
+					log.Printf("Warning: failed to grab device %s for exclusive access, other programs will also receive its events: %v", device, err)
+				} else {
+					log.Printf("Grabbed device %s for exclusive access", device)
+				}
+			}
 		}
 	}
 
@@ -122,6 +133,17 @@ func (d *EventButtonDriver) AddButton(buttonSpec interface{}) error {
 	return nil
 }
 
+// wantsExclusive returns true if any button on device asks for exclusive
+// access to it
+func (d *EventButtonDriver) wantsExclusive(device string) bool {
+	for _, spec := range d.buttons[device] {
+		if spec.Exclusive {
+			return true
+		}
+	}
+	return false
+}
+
 // GetButtons returns a list of button sources being monitored
 func (d *EventButtonDriver) GetButtons() []string {
 	d.mutex.RLock()
@@ -142,6 +164,9 @@ func (d *EventButtonDriver) monitorDevice(device string, buttonSpecs []*EventBut
 
 	file := d.files[device]
 	log.Printf("Starting monitoring for device: %s with %d button(s)", device, len(buttonSpecs))
+	for _, spec := range buttonSpecs {
+		log.Printf("Button %s: %s", spec.Name, describeEvent(spec.EventType, spec.EventCode))
+	}
 
 	eventSize := int(unsafe.Sizeof(events.InputEvent{}))
 
@@ -245,3 +270,14 @@ func (d *EventButtonDriver) handleButtonEvent(spec *EventButtonSpec, value uint3
 		log.Printf("Warning: event channel full, dropping event for button %s", spec.Name)
 	}
 }
+
+// describeEvent returns the event type and code of a button for logging,
+// with the name of the key if it is a well-known one
+func describeEvent(eventType events.EventType, eventCode uint32) string {
+	if eventType == events.EV_KEY && eventCode <= math.MaxUint16 {
+		if name, ok := events.KeyCodeName(uint16(eventCode)); ok {
+			return fmt.Sprintf("%s %s (%d)", events.GetEventTypeCode(eventType), name, eventCode)
+		}
+	}
+	return fmt.Sprintf("%s %d", events.GetEventTypeCode(eventType), eventCode)
+}
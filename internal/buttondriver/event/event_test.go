@@ -1,6 +1,8 @@
 package event
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -149,10 +151,63 @@ func TestParseEventButtonSpec(t *testing.T) {
 				HighValue: 5,
 			},
 		},
+		{
+			name:  "valid spec with key name",
+			input: "power:/dev/input/event0:EV_KEY:KEY_POWER",
+			expected: &EventButtonSpec{
+				Name:      "power",
+				Device:    "/dev/input/event0",
+				EventType: events.EV_KEY,
+				EventCode: 116,
+				LowValue:  0,
+				HighValue: 1,
+			},
+		},
+		{
+			name:  "exclusive",
+			input: "keypad:/dev/input/event3:EV_KEY:KEY_KP1:exclusive",
+			expected: &EventButtonSpec{
+				Name:      "keypad",
+				Device:    "/dev/input/event3",
+				EventType: events.EV_KEY,
+				EventCode: 79,
+				LowValue:  0,
+				HighValue: 1,
+				Exclusive: true,
+			},
+		},
+		{
+			name:  "exclusive with custom values",
+			input: "keypad:/dev/input/event3:EV_KEY:79:0:2:exclusive",
+			expected: &EventButtonSpec{
+				Name:      "keypad",
+				Device:    "/dev/input/event3",
+				EventType: events.EV_KEY,
+				EventCode: 79,
+				LowValue:  0,
+				HighValue: 2,
+				Exclusive: true,
+			},
+		},
+		{
+			name:        "unknown key name",
+			input:       "power:/dev/input/event0:EV_KEY:KEY_NONESUCH",
+			expectedErr: "invalid event code: KEY_NONESUCH",
+		},
+		{
+			name:        "key name for another event type",
+			input:       "lid:/dev/input/event0:EV_SW:KEY_POWER",
+			expectedErr: "invalid event code: KEY_POWER",
+		},
 		{
 			name:        "too few parts",
 			input:       "power:/dev/input/event0:EV_KEY",
-			expectedErr: "invalid event button spec format. Expected: name:device:event_type:event_code[:low_value:high_value]",
+			expectedErr: "invalid event button spec format. Expected: name:device:event_type:event_code[:low_value:high_value][:exclusive]",
+		},
+		{
+			name:        "exclusive without event code",
+			input:       "power:/dev/input/event0:EV_KEY:exclusive",
+			expectedErr: "invalid event code: exclusive",
 		},
 		{
 			name:        "empty name",
@@ -227,6 +282,9 @@ func TestParseEventButtonSpec(t *testing.T) {
 			if result.HighValue != tt.expected.HighValue {
 				t.Errorf("expected HighValue %v, got %v", tt.expected.HighValue, result.HighValue)
 			}
+			if result.Exclusive != tt.expected.Exclusive {
+				t.Errorf("expected Exclusive %v, got %v", tt.expected.Exclusive, result.Exclusive)
+			}
 		})
 	}
 }
@@ -413,6 +471,41 @@ func TestEventButtonDriver_StartStop(t *testing.T) {
 	driver.Stop() // Should not panic
 }
 
+func TestEventButtonDriver_StartExclusiveFallback(t *testing.T) {
+	// A regular file cannot be grabbed; the driver should still start
+	device := filepath.Join(t.TempDir(), "event0")
+	if err := os.WriteFile(device, nil, 0600); err != nil {
+		t.Fatalf("failed to create device file: %v", err)
+	}
+
+	file, err := os.Open(device)
+	if err != nil {
+		t.Fatalf("failed to open device file: %v", err)
+	}
+	defer file.Close() //nolint:errcheck
+	if err := grabDevice(file); err == nil {
+		t.Error("expected grabbing a regular file to fail")
+	}
+
+	driver := NewEventButtonDriver()
+	spec := &EventButtonSpec{
+		Name:      "test-button",
+		Device:    device,
+		EventType: events.EV_KEY,
+		EventCode: 116,
+		LowValue:  0,
+		HighValue: 1,
+		Exclusive: true,
+	}
+	if err := driver.AddButton(spec); err != nil {
+		t.Fatalf("AddButton() failed: %v", err)
+	}
+	if err := driver.Start(); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	driver.Stop()
+}
+
 func TestEventButtonDriver_handleButtonEvent(t *testing.T) {
 	driver := NewEventButtonDriver()
 
@@ -0,0 +1,34 @@
+package event
+
+import (
+	"os"
+	"syscall"
+)
+
+// eviocgrab is the EVIOCGRAB ioctl request, _IOW('E', 0x90, int), from
+// linux/input.h
+const eviocgrab = 0x40044590
+
+// grabDevice requests exclusive access to an input device, so that its
+// events are delivered only to this process and not, for example, to the
+// console or the foreground application. The grab applies to every event
+// from the device and is released when the device is closed.
+func grabDevice(file *os.File) error {
+	// Use the raw connection rather than file.Fd(), which would put the file
+	// in blocking mode so that closing it no longer interrupts a read
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var errno syscall.Errno
+	if err := conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, eviocgrab, 1)
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
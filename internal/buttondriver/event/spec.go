@@ -16,6 +16,10 @@ type EventButtonSpec struct {
 	EventCode uint32
 	LowValue  uint32
 	HighValue uint32
+	// Exclusive grabs the device so that its events are delivered only to
+	// the button driver. The grab applies to the whole device, not just
+	// to EventCode.
+	Exclusive bool
 }
 
 // GetName returns the button's name
@@ -43,12 +47,21 @@ func (spec *EventButtonSpec) Validate() error {
 }
 
 // ParseEventButtonSpec parses a button specification string
-// Format: name:device:event_type:event_code[:low_value:high_value]
+// Format: name:device:event_type:event_code[:low_value:high_value][:exclusive]
 // Example: "power:/dev/input/event0:EV_KEY:116" or "power:/dev/input/event0:EV_KEY:116:0:1"
+// For EV_KEY events, the code may also be the name of a well-known key, as in
+// "power:/dev/input/event0:EV_KEY:KEY_POWER".
 func ParseEventButtonSpec(spec string) (*EventButtonSpec, error) {
 	parts := strings.Split(spec, ":")
+
+	exclusive := false
+	if len(parts) > 4 && parts[len(parts)-1] == "exclusive" {
+		exclusive = true
+		parts = parts[:len(parts)-1]
+	}
+
 	if len(parts) < 4 {
-		return nil, fmt.Errorf("invalid event button spec format. Expected: name:device:event_type:event_code[:low_value:high_value]")
+		return nil, fmt.Errorf("invalid event button spec format. Expected: name:device:event_type:event_code[:low_value:high_value][:exclusive]")
 	}
 
 	name := parts[0]
@@ -70,9 +83,9 @@ func ParseEventButtonSpec(spec string) (*EventButtonSpec, error) {
 	}
 
 	// Parse event code
-	eventCode, err := strconv.ParseUint(eventCodeStr, 10, 32)
+	eventCode, err := parseEventCode(eventType, eventCodeStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid event code: %s", eventCodeStr)
+		return nil, err
 	}
 
 	// Default values
@@ -98,8 +111,23 @@ func ParseEventButtonSpec(spec string) (*EventButtonSpec, error) {
 		Name:      name,
 		Device:    device,
 		EventType: eventType,
-		EventCode: uint32(eventCode),
+		EventCode: eventCode,
 		LowValue:  lowValue,
 		HighValue: highValue,
+		Exclusive: exclusive,
 	}, nil
 }
+
+// parseEventCode parses a numeric event code, or the name of a key for
+// EV_KEY events
+func parseEventCode(eventType events.EventType, eventCodeStr string) (uint32, error) {
+	if eventCode, err := strconv.ParseUint(eventCodeStr, 10, 32); err == nil {
+		return uint32(eventCode), nil
+	}
+	if eventType == events.EV_KEY {
+		if keyCode, err := events.LookupKeyCode(eventCodeStr); err == nil {
+			return uint32(keyCode), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid event code: %s", eventCodeStr)
+}
@@ -34,16 +34,13 @@ type ButtonDriver struct {
 
 // ButtonPin represents a single GPIO pin configured as a button
 type ButtonPin struct {
-	line          *gpiocdev.Line
-	name          string
-	pinName       string
-	lastState     bool
-	currentState  bool
-	lastDebounce  time.Time
-	stateReported bool
-	polarity      int
-	driver        *ButtonDriver
-	mutex         sync.Mutex
+	line      *gpiocdev.Line
+	name      string
+	pinName   string
+	debouncer common.Debouncer
+	polarity  int
+	driver    *ButtonDriver
+	mutex     sync.Mutex
 }
 
 // NewButtonDriver creates a new GPIO button driver
@@ -133,14 +130,12 @@ func (bd *ButtonDriver) AddButton(buttonSpec interface{}) error {
 
 	initialState := bd.readButtonState(line, polarity)
 	buttonPin := &ButtonPin{
-		line:          line,
-		name:          spec.Name,
-		pinName:       spec.Pin,
-		driver:        bd,
-		lastState:     initialState,
-		currentState:  initialState,
-		stateReported: true, // Initial state is considered "reported"
-		polarity:      polarity,
+		line:      line,
+		name:      spec.Name,
+		pinName:   spec.Pin,
+		driver:    bd,
+		debouncer: common.NewDebouncer(initialState, time.Now()),
+		polarity:  polarity,
 	}
 
 	bd.pins[spec.Name] = buttonPin
@@ -258,49 +253,32 @@ func (bd *ButtonDriver) checkPinState(buttonPin *ButtonPin) {
 	buttonPin.mutex.Lock()
 	defer buttonPin.mutex.Unlock()
 
-	// Check if state has changed from what we're currently tracking
-	if currentState != buttonPin.currentState {
-		// State changed, start debounce timer
-		buttonPin.currentState = currentState
-		buttonPin.lastDebounce = now
-		buttonPin.stateReported = false
+	changed, pressed := buttonPin.debouncer.Update(currentState, now, bd.debounceDelay)
+	if !changed {
 		return
 	}
 
-	// State is stable, check if debounce period has elapsed and we haven't reported this state yet
-	if !buttonPin.stateReported && now.Sub(buttonPin.lastDebounce) >= bd.debounceDelay {
-		// Debounce period has elapsed and this is a new stable state
-		// Check if this is actually a change from the last reported state
-		if currentState != buttonPin.lastState {
-			buttonPin.lastState = currentState
-			buttonPin.stateReported = true
-
-			// Send event using common.ButtonEvent
-			eventType := common.ButtonReleased
-			if currentState {
-				eventType = common.ButtonPressed
-			}
-
-			event := common.ButtonEvent{
-				Source:    buttonPin.name,
-				Type:      eventType,
-				Timestamp: now,
-				Device:    buttonPin.pinName,
-				Metadata: map[string]interface{}{
-					"gpio_pin": buttonPin.pinName,
-					"pressed":  currentState,
-				},
-			}
-
-			select {
-			case bd.eventChannel <- event:
-			default:
-				log.Printf("Warning: event channel full, dropping event for button %s", buttonPin.name)
-			}
-		} else {
-			// State is the same as last reported, just mark as reported
-			buttonPin.stateReported = true
-		}
+	// Send event using common.ButtonEvent
+	eventType := common.ButtonReleased
+	if pressed {
+		eventType = common.ButtonPressed
+	}
+
+	event := common.ButtonEvent{
+		Source:    buttonPin.name,
+		Type:      eventType,
+		Timestamp: now,
+		Device:    buttonPin.pinName,
+		Metadata: map[string]interface{}{
+			"gpio_pin": buttonPin.pinName,
+			"pressed":  pressed,
+		},
+	}
+
+	select {
+	case bd.eventChannel <- event:
+	default:
+		log.Printf("Warning: event channel full, dropping event for button %s", buttonPin.name)
 	}
 }
 
@@ -28,6 +28,7 @@ type Config struct {
 	ConfigFile string         `mapstructure:"config-file"`
 	Buttons    []ButtonConfig `mapstructure:"buttons"`
 	MqttServer string         `mapstructure:"mqtt-server"`
+	Strict     bool           `mapstructure:"strict"`
 
 	// Global defaults for timing-related settings
 	ClickInterval      *time.Duration `mapstructure:"click-interval"`
@@ -44,6 +45,7 @@ func NewConfig() *Config {
 func (c *Config) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&c.ConfigFile, "config", c.ConfigFile, "Config file to use")
 	fs.StringVar(&c.MqttServer, "mqtt-server", c.MqttServer, "MQTT server URL (mqtt://host:port)")
+	fs.BoolVar(&c.Strict, "strict", c.Strict, "Fail if the config file contains unknown settings")
 }
 
 func (c *Config) LoadConfig() error {
@@ -53,6 +55,7 @@ func (c *Config) LoadConfig() error {
 func (c *Config) LoadConfigWithFlagSet(fs *pflag.FlagSet) error {
 	loader := config.NewConfigLoader()
 	loader.SetConfigFile(c.ConfigFile)
+	loader.SetStrictModeKey("strict")
 	return loader.LoadConfigWithFlagSet(c, fs)
 }
 
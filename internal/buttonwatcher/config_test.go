@@ -107,6 +107,32 @@ func TestConfigLoadConfig(t *testing.T) {
 	})
 }
 
+func TestConfigLoadConfigStrict(t *testing.T) {
+	load := func(t *testing.T, content []byte, args ...string) error {
+		t.Helper()
+		configFile := t.TempDir() + "/config.toml"
+		require.NoError(t, os.WriteFile(configFile, content, 0600), "Failed to write config file")
+
+		config := NewConfig()
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		config.AddFlags(fs)
+		require.NoError(t, fs.Parse(append([]string{"--config", configFile}, args...)))
+		return config.LoadConfigWithFlagSet(fs)
+	}
+
+	misspelled := append([]byte("mqtt-sever = \"mqtt://localhost\"\n"), testConfigTOML...)
+
+	assert.NoError(t, load(t, misspelled), "LoadConfig() should ignore unknown keys by default")
+	assert.NoError(t, load(t, testConfigTOML, "--strict"), "LoadConfig() with --strict should accept a valid config")
+
+	err := load(t, misspelled, "--strict")
+	require.Error(t, err, "LoadConfig() with --strict should reject unknown keys")
+	assert.Contains(t, err.Error(), "mqtt-sever")
+
+	err = load(t, append([]byte("strict = true\n"), misspelled...))
+	assert.Error(t, err, "LoadConfig() with strict = true should reject unknown keys")
+}
+
 func TestConfigValidate(t *testing.T) {
 	t.Run("valid config", func(t *testing.T) {
 		clickAction := "echo 'click'"
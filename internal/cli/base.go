@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/larsks/airdancer/internal/config"
 	"github.com/larsks/airdancer/internal/version"
 	"github.com/spf13/pflag"
 )
@@ -57,6 +58,7 @@ func (c *BaseCLI) ParseArgsStandard(args []string, configFactory func() Configur
 func (c *BaseCLI) ParseArgsStandardWithFlagSet(args []string, configFactory func() Configurable, fs *pflag.FlagSet) (*CommandArgs, error) {
 	// Define standard flags
 	versionFlag := fs.Bool("version", false, "Show version and exit")
+	configDumpFlag := fs.Bool("config-dump", false, "Print the effective configuration and exit")
 
 	// Create config and add its flags
 	cfg := configFactory()
@@ -77,6 +79,10 @@ func (c *BaseCLI) ParseArgsStandardWithFlagSet(args []string, configFactory func
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
+	if *configDumpFlag {
+		return &CommandArgs{Command: "config-dump", Config: cfg}, nil
+	}
+
 	return &CommandArgs{Command: "start", Config: cfg}, nil
 }
 
@@ -90,6 +96,7 @@ func (c *BaseCLI) ParseArgsWithSubCommandsAndFlagSet(args []string, configFactor
 	// Define standard flags
 	versionFlag := fs.Bool("version", false, "Show version and exit")
 	helpFlag := fs.BoolP("help", "h", false, "Show help")
+	configDumpFlag := fs.Bool("config-dump", false, "Print the effective configuration and exit")
 
 	// Create config and add its flags
 	cfg := configFactory()
@@ -108,6 +115,14 @@ func (c *BaseCLI) ParseArgsWithSubCommandsAndFlagSet(args []string, configFactor
 		return &CommandArgs{Command: "version", Args: []string{}, Config: cfg}, nil
 	}
 
+	// Handle config dump flag; no subcommand is needed
+	if *configDumpFlag {
+		if err := cfg.LoadConfigWithFlagSet(fs); err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+		return &CommandArgs{Command: "config-dump", Args: []string{}, Config: cfg}, nil
+	}
+
 	// Handle help flag or no arguments
 	remainingArgs := fs.Args()
 	if *helpFlag || len(remainingArgs) == 0 {
@@ -132,6 +147,8 @@ func (c *BaseCLI) Execute(cmdArgs *CommandArgs, handler CommandHandler) error {
 	case "version":
 		version.ShowVersion()
 		return nil
+	case "config-dump":
+		return c.DumpConfig(cmdArgs.Config)
 	case "start":
 		return handler.Start(cmdArgs.Config)
 	default:
@@ -145,6 +162,8 @@ func (c *BaseCLI) ExecuteWithSubCommands(cmdArgs *CommandArgs, handler SubComman
 	case "version":
 		version.ShowVersion()
 		return nil
+	case "config-dump":
+		return c.DumpConfig(cmdArgs.Config)
 	case "help", "execute":
 		return handler.Execute(cmdArgs)
 	default:
@@ -152,6 +171,12 @@ func (c *BaseCLI) ExecuteWithSubCommands(cmdArgs *CommandArgs, handler SubComman
 	}
 }
 
+// DumpConfig prints the fully resolved configuration, with secrets
+// redacted, to stdout
+func (c *BaseCLI) DumpConfig(cfg Configurable) error {
+	return config.Dump(c.stdout, cfg)
+}
+
 // StandardMain provides a complete main function implementation for simple services
 func StandardMain(configFactory func() Configurable, handler CommandHandler) {
 	cli := NewBaseCLI(os.Stdout, os.Stderr)
@@ -1,7 +1,9 @@
 package cli
 
 import (
+	"bytes"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/spf13/pflag"
@@ -74,6 +76,35 @@ func TestParseArgsStandard_Start(t *testing.T) {
 	}
 }
 
+func TestParseArgsStandard_ConfigDump(t *testing.T) {
+	var stdout bytes.Buffer
+	cli := NewBaseCLI(&stdout, os.Stderr)
+	handler := &MockHandler{}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+
+	args := []string{"--config-dump", "--test-value", "custom"}
+	cmdArgs, err := cli.ParseArgsStandardWithFlagSet(args, func() Configurable { return &MockConfig{} }, fs)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cmdArgs.Command != "config-dump" {
+		t.Errorf("Expected command 'config-dump', got '%s'", cmdArgs.Command)
+	}
+
+	if err := cli.Execute(cmdArgs, handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if handler.StartCalled {
+		t.Error("Start should not have been called for config-dump command")
+	}
+
+	if !strings.Contains(stdout.String(), `"TestValue": "custom"`) {
+		t.Errorf("Expected dumped config to contain TestValue, got %s", stdout.String())
+	}
+}
+
 func TestExecute_Version(t *testing.T) {
 	cli := NewBaseCLI(os.Stdout, os.Stderr)
 	handler := &MockHandler{}
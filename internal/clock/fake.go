@@ -0,0 +1,177 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock whose time only moves when Advance is called. Functions
+// scheduled with AfterFunc run synchronously from Advance, so once Advance
+// returns their effects are visible to the caller.
+type Fake struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter is a pending timer, AfterFunc, or ticker
+type fakeWaiter struct {
+	clock    *Fake
+	deadline time.Time
+	period   time.Duration // non-zero for tickers
+	ch       chan time.Time
+	fn       func()
+}
+
+// NewFake returns a fake clock set to now
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.mutex)
+	return f
+}
+
+// Now returns the current fake time
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+// NewTimer returns a timer that fires once the fake time has advanced by d
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	w := &fakeWaiter{clock: f, ch: make(chan time.Time, 1)}
+	f.schedule(w, d)
+	return w
+}
+
+// AfterFunc calls fn once the fake time has advanced by d
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	w := &fakeWaiter{clock: f, fn: fn}
+	f.schedule(w, d)
+	return w
+}
+
+// NewTicker returns a ticker that ticks every d of fake time. As with
+// time.Ticker, ticks are dropped if the receiver falls behind.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	w := &fakeWaiter{clock: f, period: d, ch: make(chan time.Time, 1)}
+	f.schedule(w, d)
+	return &fakeTicker{w}
+}
+
+func (f *Fake) schedule(w *fakeWaiter, d time.Duration) {
+	f.mutex.Lock()
+	w.deadline = f.now.Add(d)
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+	f.mutex.Unlock()
+
+	// Timers with no duration fire immediately
+	if d <= 0 {
+		f.Advance(0)
+	}
+}
+
+// Advance moves the fake time forward by d, firing every timer, function,
+// and ticker whose deadline is reached, in deadline order.
+func (f *Fake) Advance(d time.Duration) {
+	f.mutex.Lock()
+	target := f.now.Add(d)
+
+	for {
+		next := f.nextDue(target)
+		if next == nil {
+			break
+		}
+
+		f.now = next.deadline
+		if next.period > 0 {
+			next.deadline = next.deadline.Add(next.period)
+		} else {
+			f.remove(next)
+		}
+		now := f.now
+
+		// Fire without holding the lock, since the receiver may schedule
+		// new timers
+		f.mutex.Unlock()
+		if next.fn != nil {
+			next.fn()
+		} else {
+			select {
+			case next.ch <- now:
+			default:
+			}
+		}
+		f.mutex.Lock()
+	}
+
+	if target.After(f.now) {
+		f.now = target
+	}
+	f.mutex.Unlock()
+}
+
+// BlockUntil waits until at least n timers, functions, or tickers are
+// waiting to fire. This lets a test wait for a goroutine to arm its next
+// timer before advancing the clock.
+func (f *Fake) BlockUntil(n int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// nextDue returns the waiter with the earliest deadline no later than
+// target, or nil. The caller must hold f.mutex.
+func (f *Fake) nextDue(target time.Time) *fakeWaiter {
+	var next *fakeWaiter
+	for _, w := range f.waiters {
+		if w.deadline.After(target) {
+			continue
+		}
+		if next == nil || w.deadline.Before(next.deadline) {
+			next = w
+		}
+	}
+	return next
+}
+
+// remove drops w from the pending waiters, returning false if it was not
+// pending. The caller must hold f.mutex.
+func (f *Fake) remove(w *fakeWaiter) bool {
+	for i, other := range f.waiters {
+		if other == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+func (w *fakeWaiter) Stop() bool {
+	w.clock.mutex.Lock()
+	defer w.clock.mutex.Unlock()
+	return w.clock.remove(w)
+}
+
+type fakeTicker struct {
+	waiter *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.waiter.ch
+}
+
+func (t *fakeTicker) Stop() {
+	t.waiter.Stop()
+}
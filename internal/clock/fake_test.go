@@ -0,0 +1,104 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeTimer(t *testing.T) {
+	start := time.Unix(0, 0)
+	fake := NewFake(start)
+
+	timer := fake.NewTimer(time.Second)
+
+	fake.Advance(999 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	fake.Advance(time.Millisecond)
+	select {
+	case fired := <-timer.C():
+		if want := start.Add(time.Second); !fired.Equal(want) {
+			t.Errorf("timer fired at %v, want %v", fired, want)
+		}
+	default:
+		t.Fatal("timer did not fire")
+	}
+
+	if timer.Stop() {
+		t.Error("Stop() on a fired timer = true, want false")
+	}
+}
+
+func TestFakeTimerStop(t *testing.T) {
+	fake := NewFake(time.Unix(0, 0))
+
+	timer := fake.NewTimer(time.Second)
+	if !timer.Stop() {
+		t.Error("Stop() on a pending timer = false, want true")
+	}
+
+	fake.Advance(time.Second)
+	select {
+	case <-timer.C():
+		t.Error("stopped timer fired")
+	default:
+	}
+}
+
+func TestFakeAfterFunc(t *testing.T) {
+	fake := NewFake(time.Unix(0, 0))
+
+	var calls []string
+	fake.AfterFunc(2*time.Second, func() { calls = append(calls, "second") })
+	fake.AfterFunc(time.Second, func() {
+		calls = append(calls, "first")
+		// Functions may schedule further work within the same advance
+		fake.AfterFunc(500*time.Millisecond, func() { calls = append(calls, "chained") })
+	})
+	stopped := fake.AfterFunc(time.Second, func() { calls = append(calls, "stopped") })
+	stopped.Stop()
+
+	fake.Advance(3 * time.Second)
+
+	want := []string{"first", "chained", "second"}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("calls = %v, want %v", calls, want)
+		}
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	start := time.Unix(0, 0)
+	fake := NewFake(start)
+
+	ticker := fake.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for i := 1; i <= 3; i++ {
+		fake.Advance(time.Second)
+		select {
+		case tick := <-ticker.C():
+			if want := start.Add(time.Duration(i) * time.Second); !tick.Equal(want) {
+				t.Errorf("tick %d at %v, want %v", i, tick, want)
+			}
+		default:
+			t.Fatalf("ticker did not tick after %d seconds", i)
+		}
+	}
+
+	ticker.Stop()
+	fake.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Error("stopped ticker ticked")
+	default:
+	}
+}
@@ -6,6 +6,8 @@ import "errors"
 var (
 	ErrConfigFileRead  = errors.New("failed to read config file")
 	ErrConfigUnmarshal = errors.New("failed to unmarshal config")
+	ErrSecretFileRead  = errors.New("failed to read secret file")
+	ErrSecretEnvNotSet = errors.New("secret environment variable is not set")
 )
 
 // Configuration validation errors
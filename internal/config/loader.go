@@ -24,6 +24,7 @@ type ConfigLoader struct {
 	defaults     map[string]any
 	preserveFile bool
 	strictMode   bool
+	strictKey    string
 }
 
 // NewConfigLoader creates a new ConfigLoader instance.
@@ -58,6 +59,12 @@ func (cl *ConfigLoader) SetStrictMode(strict bool) {
 	cl.strictMode = strict
 }
 
+// SetStrictModeKey names a boolean setting that, when true in the config
+// file or on the command line, enables strict mode for this load.
+func (cl *ConfigLoader) SetStrictModeKey(key string) {
+	cl.strictKey = key
+}
+
 // LoadConfig loads configuration with proper precedence: defaults < config file < explicit flags.
 // The config parameter should be a pointer to the configuration struct to populate.
 func (cl *ConfigLoader) LoadConfig(config any) error {
@@ -93,7 +100,10 @@ func (cl *ConfigLoader) LoadConfigWithFlagSet(config any, fs *pflag.FlagSet) err
 
 	// Only override with flags that were explicitly set by the user
 	// This preserves the precedence: defaults < config file < explicit flags
+	flagKeys := make(map[string]bool)
 	fs.Visit(func(flag *pflag.Flag) {
+		flagKeys[flag.Name] = true
+
 		// Keep flag names as-is since we now use hyphens in mapstructure tags
 		// This handles cases like --dummy.switch-count -> dummy.switch-count
 		viperKey := flag.Name
@@ -165,21 +175,41 @@ func (cl *ConfigLoader) LoadConfigWithFlagSet(config any, fs *pflag.FlagSet) err
 		}
 	})
 
+	// Replace @file: and @env: references with the secrets they refer to
+	if err := cl.resolveSecrets(v); err != nil {
+		return err
+	}
+
 	// Use strict mode if enabled to detect unknown configuration fields
-	if cl.strictMode {
+	strict := cl.strictMode || (cl.strictKey != "" && v.GetBool(cl.strictKey))
+	if strict {
 		// Use strict mode if enabled to detect unknown configuration fields
 		var unmarshalConfig mapstructure.DecoderConfig
 		unmarshalConfig.Result = config
 		unmarshalConfig.ErrorUnused = true
 		unmarshalConfig.TagName = "mapstructure"
 		unmarshalConfig.WeaklyTypedInput = true
+		unmarshalConfig.DecodeHook = mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		)
+
+		// Flags that don't correspond to a setting (such as --config)
+		// are not typos, so they are left out of the check
+		settings := v.AllSettings()
+		fieldKeys := structKeys(config)
+		for key := range flagKeys {
+			if !fieldKeys[key] {
+				delete(settings, key)
+			}
+		}
 
 		decoder, err := mapstructure.NewDecoder(&unmarshalConfig)
 		if err != nil {
 			return fmt.Errorf("%w: failed to create decoder: %v", ErrConfigUnmarshal, err)
 		}
 
-		if err := decoder.Decode(v.AllSettings()); err != nil {
+		if err := decoder.Decode(settings); err != nil {
 			// Enhance the error message to include the config file name for better context
 			if cl.configFile != "" {
 				// Check if this is an "unused keys" error and enhance it with file context
@@ -227,6 +257,29 @@ func (cl *ConfigLoader) LoadConfigWithFlagSet(config any, fs *pflag.FlagSet) err
 	return nil
 }
 
+// structKeys returns the top-level mapstructure keys of the struct that
+// config points to
+func structKeys(config any) map[string]bool {
+	keys := make(map[string]bool)
+
+	t := reflect.TypeOf(config)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return keys
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("mapstructure"), ",")
+		if key == "" {
+			key = t.Field(i).Name
+		}
+		keys[strings.ToLower(key)] = true
+	}
+	return keys
+}
+
 // setConfigFileField attempts to set a ConfigFile field on the config struct using reflection.
 func (cl *ConfigLoader) setConfigFileField(config any, configFile string) error {
 	v := reflect.ValueOf(config)
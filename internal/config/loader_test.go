@@ -2,7 +2,10 @@ package config
 
 import (
 	_ "embed"
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/spf13/pflag"
@@ -380,3 +383,172 @@ listen-port = 8080
 		t.Errorf("Expected ListenAddress to remain '${NONEXISTENT_VAR}' (unset env var), got '%s'", config.ListenAddress)
 	}
 }
+
+// secretTestConfig is used to test resolving secret references
+type secretTestConfig struct {
+	ConfigFile string `mapstructure:"config-file"`
+	IMAP       struct {
+		Username string `mapstructure:"username"`
+		Password string `mapstructure:"password"`
+	} `mapstructure:"imap"`
+	Tokens []string `mapstructure:"tokens"`
+}
+
+// loadSecretTestConfig writes content to a config file and loads it
+func loadSecretTestConfig(t *testing.T, content string, args ...string) (*secretTestConfig, error) {
+	t.Helper()
+
+	configFile := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(configFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	config := &secretTestConfig{ConfigFile: configFile}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.StringVar(&config.IMAP.Password, "imap.password", "", "IMAP password")
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	loader := NewConfigLoader()
+	loader.SetConfigFile(configFile)
+	return config, loader.LoadConfigWithFlagSet(config, fs)
+}
+
+func TestConfigLoader_SecretReferences(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(secretFile, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+	t.Setenv("TEST_SECRET_TOKEN", "env-secret")
+	t.Setenv("TEST_SECRET_DIR", filepath.Dir(secretFile))
+
+	t.Run("file", func(t *testing.T) {
+		config, err := loadSecretTestConfig(t, `
+[imap]
+username = "testuser"
+password = "@file:`+secretFile+`"
+`)
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if config.IMAP.Password != "file-secret" {
+			t.Errorf("Expected IMAP.Password to be 'file-secret' (read from file), got '%s'", config.IMAP.Password)
+		}
+		if config.IMAP.Username != "testuser" {
+			t.Errorf("Expected IMAP.Username to remain 'testuser', got '%s'", config.IMAP.Username)
+		}
+	})
+
+	t.Run("env", func(t *testing.T) {
+		config, err := loadSecretTestConfig(t, `
+tokens = ["@env:TEST_SECRET_TOKEN", "plain"]
+
+[imap]
+password = "@env:TEST_SECRET_TOKEN"
+`)
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if config.IMAP.Password != "env-secret" {
+			t.Errorf("Expected IMAP.Password to be 'env-secret' (read from environment), got '%s'", config.IMAP.Password)
+		}
+		if len(config.Tokens) != 2 || config.Tokens[0] != "env-secret" || config.Tokens[1] != "plain" {
+			t.Errorf("Expected Tokens to be [env-secret plain], got %v", config.Tokens)
+		}
+	})
+
+	t.Run("file path after environment expansion", func(t *testing.T) {
+		config, err := loadSecretTestConfig(t, `
+[imap]
+password = "@file:${TEST_SECRET_DIR}/password"
+`)
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if config.IMAP.Password != "file-secret" {
+			t.Errorf("Expected IMAP.Password to be 'file-secret', got '%s'", config.IMAP.Password)
+		}
+	})
+
+	t.Run("flag", func(t *testing.T) {
+		config, err := loadSecretTestConfig(t, "", "--imap.password", "@file:"+secretFile)
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if config.IMAP.Password != "file-secret" {
+			t.Errorf("Expected IMAP.Password from flag to be 'file-secret', got '%s'", config.IMAP.Password)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		missing := filepath.Join(t.TempDir(), "missing")
+		_, err := loadSecretTestConfig(t, `
+[imap]
+password = "@file:`+missing+`"
+`)
+		if !errors.Is(err, ErrSecretFileRead) {
+			t.Fatalf("Expected error %v, got %v", ErrSecretFileRead, err)
+		}
+		if !strings.Contains(err.Error(), "imap.password") {
+			t.Errorf("Expected error to name the setting, got %v", err)
+		}
+	})
+
+	t.Run("unset environment variable", func(t *testing.T) {
+		_, err := loadSecretTestConfig(t, `
+[imap]
+password = "@env:TEST_SECRET_UNSET"
+`)
+		if !errors.Is(err, ErrSecretEnvNotSet) {
+			t.Fatalf("Expected error %v, got %v", ErrSecretEnvNotSet, err)
+		}
+	})
+}
+
+func TestConfigLoader_StrictModeKey(t *testing.T) {
+	type strictTestConfig struct {
+		ConfigFile string `mapstructure:"config-file"`
+		ListenPort int    `mapstructure:"listen-port"`
+		Strict     bool   `mapstructure:"strict"`
+	}
+
+	load := func(t *testing.T, content string, args ...string) error {
+		t.Helper()
+		configFile := filepath.Join(t.TempDir(), "config.toml")
+		if err := os.WriteFile(configFile, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		config := &strictTestConfig{}
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		fs.StringVar(&config.ConfigFile, "config", "", "Config file")
+		fs.BoolVar(&config.Strict, "strict", false, "Strict mode")
+		if err := fs.Parse(append([]string{"--config", configFile}, args...)); err != nil {
+			t.Fatalf("Failed to parse flags: %v", err)
+		}
+
+		loader := NewConfigLoader()
+		loader.SetConfigFile(configFile)
+		loader.SetStrictModeKey("strict")
+		return loader.LoadConfigWithFlagSet(config, fs)
+	}
+
+	if err := load(t, "listen-port = 8080\nlisten-prot = 8081\n"); err != nil {
+		t.Errorf("Expected unknown key to be ignored without strict mode, got %v", err)
+	}
+
+	if err := load(t, "listen-port = 8080\n", "--strict"); err != nil {
+		t.Errorf("Expected valid config to load in strict mode, got %v", err)
+	}
+
+	err := load(t, "listen-port = 8080\nlisten-prot = 8081\n", "--strict")
+	if !errors.Is(err, ErrConfigUnmarshal) || !strings.Contains(err.Error(), "listen-prot") {
+		t.Errorf("Expected --strict to report unknown key listen-prot, got %v", err)
+	}
+
+	err = load(t, "strict = true\nlisten-prot = 8081\n")
+	if !errors.Is(err, ErrConfigUnmarshal) || !strings.Contains(err.Error(), "listen-prot") {
+		t.Errorf("Expected strict = true to report unknown key listen-prot, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Prefixes of string values that refer to a secret stored elsewhere. The
+// rest of the value is a file path or an environment variable name.
+const (
+	secretFilePrefix = "@file:"
+	secretEnvPrefix  = "@env:"
+)
+
+// resolveSecrets replaces every "@file:/path" or "@env:VAR" reference in
+// the viper configuration with the contents of the file (without trailing
+// newlines) or the value of the environment variable.
+func (cl *ConfigLoader) resolveSecrets(v *viper.Viper) error {
+	settings := v.AllSettings()
+
+	for key, value := range settings {
+		resolved, err := cl.resolveSecretValue(key, value)
+		if err != nil {
+			return err
+		}
+		v.Set(key, resolved)
+	}
+
+	return nil
+}
+
+// resolveSecretValue resolves secret references in value, which is the
+// setting named key. Maps and lists are processed recursively.
+func (cl *ConfigLoader) resolveSecretValue(key string, value any) (any, error) {
+	switch val := value.(type) {
+	case string:
+		return cl.resolveSecretString(key, val)
+	case map[string]any:
+		for k, item := range val {
+			resolved, err := cl.resolveSecretValue(key+"."+k, item)
+			if err != nil {
+				return nil, err
+			}
+			val[k] = resolved
+		}
+		return val, nil
+	case []any:
+		for i, item := range val {
+			resolved, err := cl.resolveSecretValue(fmt.Sprintf("%s[%d]", key, i), item)
+			if err != nil {
+				return nil, err
+			}
+			val[i] = resolved
+		}
+		return val, nil
+	default:
+		return value, nil
+	}
+}
+
+// resolveSecretString returns the secret referred to by s, or s itself if
+// it is not a secret reference
+func (cl *ConfigLoader) resolveSecretString(key, s string) (string, error) {
+	if path, ok := strings.CutPrefix(s, secretFilePrefix); ok {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("%w for %s: %v", ErrSecretFileRead, key, err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+
+	if name, ok := strings.CutPrefix(s, secretEnvPrefix); ok {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("%w for %s: %s", ErrSecretEnvNotSet, key, name)
+		}
+		return value, nil
+	}
+
+	return s, nil
+}
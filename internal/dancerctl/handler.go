@@ -6,7 +6,9 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/larsks/airdancer/internal/cli"
 	"github.com/larsks/airdancer/internal/version"
@@ -45,12 +47,20 @@ type GroupResponse struct {
 	State    string   `json:"state"`
 }
 
+// RoutesResponse represents the route list served at the root of the API
+type RoutesResponse struct {
+	Routes [][]string `json:"routes"`
+}
+
 // SwitchRequest represents a request to control a switch
 type SwitchRequest struct {
-	State     string   `json:"state"`
-	Duration  *uint    `json:"duration,omitempty"`
-	Period    *float64 `json:"period,omitempty"`
-	DutyCycle *float64 `json:"dutyCycle,omitempty"`
+	State         string   `json:"state"`
+	Duration      *uint    `json:"duration,omitempty"`
+	Period        *float64 `json:"period,omitempty"`
+	DutyCycle     *float64 `json:"dutyCycle,omitempty"`
+	Phase         *float64 `json:"phase,omitempty"`
+	Jitter        *float64 `json:"jitter,omitempty"`
+	RestoreOnStop bool     `json:"restoreOnStop,omitempty"`
 }
 
 // HTTPClient interface for testing
@@ -69,6 +79,9 @@ type Handler struct {
 	period    float64
 	duration  uint
 	dutyCycle float64
+	phase     float64
+	jitter    float64
+	restore   bool
 }
 
 // NewHandler creates a new dancerctl handler
@@ -85,6 +98,9 @@ func (h *Handler) AddFlags(fs *pflag.FlagSet) {
 	fs.Float64VarP(&h.period, "period", "p", 1.0, "Period in seconds (for blink/flipflop)")
 	fs.UintVarP(&h.duration, "duration", "d", 0, "Duration in seconds (0 = indefinite)")
 	fs.Float64VarP(&h.dutyCycle, "duty-cycle", "c", 0.5, "Duty cycle (0.0 to 1.0)")
+	fs.Float64Var(&h.phase, "phase", 0, "Phase offset within the period (0.0 to 1.0, for blink/flipflop)")
+	fs.Float64Var(&h.jitter, "jitter", 0, "Randomize each interval by up to this fraction (0.0 to 1.0, for blink/flipflop)")
+	fs.BoolVarP(&h.restore, "restore", "r", false, "Restore previous state when duration expires (for blink/flipflop)")
 }
 
 // Execute implements the cli.SubCommandHandler interface
@@ -117,8 +133,12 @@ func (h *Handler) Execute(cmdArgs *cli.CommandArgs) error {
 		return h.cmdOff(args)
 	case "toggle":
 		return h.cmdToggle(args)
+	case "identify":
+		return h.cmdIdentify(args)
 	case "status":
 		return h.cmdStatus(args)
+	case "describe":
+		return h.cmdDescribe(args)
 	default:
 		return fmt.Errorf("unknown command: %s", command)
 	}
@@ -135,7 +155,9 @@ Commands:
   on <switch>                 Turn on a switch
   off <switch>                Turn off a switch
   toggle <switch>             Toggle a switch
+  identify <switch>           Briefly blink a switch to locate it
   status [switch]             Get status of a switch or list all switches
+  describe                    List the routes the server supports
   help                        Show this help
   version                     Show version information
 
@@ -144,7 +166,10 @@ Flags:
   -d, --duration uint   Duration in seconds (0 = indefinite)
   -c, --duty-cycle float Duty cycle (0.0 to 1.0) (default 0.5)
   -h, --help            Show help
+  --jitter float        Randomize each interval by up to this fraction (0.0 to 1.0, for blink/flipflop)
   -p, --period float    Period in seconds (for blink/flipflop) (default 1)
+  --phase float         Phase offset within the period (0.0 to 1.0, for blink/flipflop)
+  -r, --restore         Restore previous state when duration expires (for blink/flipflop)
   --server-url string   API server URL (default "%s")
   --version             Show version and exit
 `, getDefaultConfigFile(), defaultServerURL)
@@ -167,6 +192,13 @@ func (h *Handler) cmdBlink(args []string) error {
 	if h.dutyCycle > 0 {
 		req.DutyCycle = &h.dutyCycle
 	}
+	if h.phase > 0 {
+		req.Phase = &h.phase
+	}
+	if h.jitter > 0 {
+		req.Jitter = &h.jitter
+	}
+	req.RestoreOnStop = h.restore
 
 	if err := h.sendSwitchRequest(switchName, req); err != nil {
 		return err
@@ -193,6 +225,13 @@ func (h *Handler) cmdFlipflop(args []string) error {
 	if h.dutyCycle > 0 {
 		req.DutyCycle = &h.dutyCycle
 	}
+	if h.phase > 0 {
+		req.Phase = &h.phase
+	}
+	if h.jitter > 0 {
+		req.Jitter = &h.jitter
+	}
+	req.RestoreOnStop = h.restore
 
 	if err := h.sendSwitchRequest(switchName, req); err != nil {
 		return err
@@ -258,6 +297,29 @@ func (h *Handler) cmdToggle(args []string) error {
 	return nil
 }
 
+func (h *Handler) cmdIdentify(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("identify command requires exactly one switch argument")
+	}
+
+	switchName := args[0]
+	resp, err := h.makeAPIRequest("POST", "/switch/"+switchName+"/identify", nil)
+	if err != nil {
+		return err
+	}
+
+	var apiResp APIResponse
+	if err := json.Unmarshal(resp, &apiResp); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if apiResp.Status != "ok" {
+		return fmt.Errorf("API error: %s", apiResp.Message)
+	}
+
+	fmt.Fprintf(h.stdout, "Identifying switch: %s\n", switchName) //nolint:errcheck
+	return nil
+}
+
 func (h *Handler) cmdStatus(args []string) error {
 	if len(args) == 0 {
 		return h.cmdSwitches()
@@ -382,6 +444,52 @@ func (h *Handler) cmdSwitches() error {
 	return nil
 }
 
+func (h *Handler) cmdDescribe(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("describe command takes no arguments")
+	}
+
+	resp, err := h.makeAPIRequest("GET", "/", nil)
+	if err != nil {
+		return err
+	}
+
+	var apiResp struct {
+		APIResponse
+		Data RoutesResponse `json:"data"`
+	}
+	if err := json.Unmarshal(resp, &apiResp); err != nil {
+		return fmt.Errorf("error parsing response: %w", err)
+	}
+
+	if apiResp.Status != "ok" {
+		return fmt.Errorf("API error: %s", apiResp.Message)
+	}
+
+	// Each route is a [method, pattern] pair
+	routes := apiResp.Data.Routes
+	for _, route := range routes {
+		if len(route) != 2 {
+			return fmt.Errorf("error parsing route: %q", route)
+		}
+	}
+
+	// Sort by pattern so that the methods for a route are listed together
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i][1] != routes[j][1] {
+			return routes[i][1] < routes[j][1]
+		}
+		return routes[i][0] < routes[j][0]
+	})
+
+	tw := tabwriter.NewWriter(h.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tROUTE") //nolint:errcheck
+	for _, route := range routes {
+		fmt.Fprintf(tw, "%s\t%s\n", route[0], route[1]) //nolint:errcheck
+	}
+	return tw.Flush()
+}
+
 func (h *Handler) sendSwitchRequest(switchName string, req SwitchRequest) error {
 	reqBody, err := json.Marshal(req)
 	if err != nil {
@@ -424,6 +532,12 @@ func (h *Handler) makeAPIRequest(method, path string, body []byte) ([]byte, erro
 		}
 	}
 
+	// Commands run by automated actions (such as email triggers) identify
+	// themselves, so that the server can skip them in maintenance mode
+	if source := os.Getenv("AIRDANCER_SOURCE"); source != "" {
+		req.Header.Set("X-Airdancer-Source", source)
+	}
+
 	resp, err := h.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %w", err)
@@ -0,0 +1,78 @@
+package dancerctl
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/larsks/airdancer/internal/cli"
+)
+
+// mockHTTPClient returns body for every request and records the last one
+type mockHTTPClient struct {
+	status  int
+	body    string
+	request *http.Request
+}
+
+func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	m.request = req
+	return &http.Response{
+		StatusCode: m.status,
+		Body:       io.NopCloser(strings.NewReader(m.body)),
+	}, nil
+}
+
+// runCommand runs a dancerctl command against client and returns its output
+func runCommand(t *testing.T, client HTTPClient, args ...string) (string, error) {
+	t.Helper()
+
+	var stdout bytes.Buffer
+	h := &Handler{httpClient: client, stdout: &stdout, stderr: io.Discard}
+	err := h.Execute(&cli.CommandArgs{
+		Config: &Config{ServerURL: "http://airdancer.example.com"},
+		Args:   args,
+	})
+	return stdout.String(), err
+}
+
+func TestDescribe(t *testing.T) {
+	client := &mockHTTPClient{
+		status: http.StatusOK,
+		body:   `{"status":"ok","data":{"routes":[["POST","/switch/{name}"],["GET","/"],["GET","/switch/{name}"]]}}`,
+	}
+
+	out, err := runCommand(t, client, "describe")
+	if err != nil {
+		t.Fatalf("describe failed: %v", err)
+	}
+
+	if got := client.request.URL.String(); got != "http://airdancer.example.com/" {
+		t.Errorf("describe requested %s, want http://airdancer.example.com/", got)
+	}
+
+	want := `METHOD  ROUTE
+GET     /
+GET     /switch/{name}
+POST    /switch/{name}
+`
+	if out != want {
+		t.Errorf("describe output =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestDescribeError(t *testing.T) {
+	client := &mockHTTPClient{
+		status: http.StatusInternalServerError,
+		body:   `{"status":"error","message":"something broke"}`,
+	}
+
+	if _, err := runCommand(t, client, "describe"); err == nil || !strings.Contains(err.Error(), "something broke") {
+		t.Errorf("describe error = %v, want API error", err)
+	}
+	if _, err := runCommand(t, client, "describe", "extra"); err == nil {
+		t.Errorf("describe with an argument succeeded, want error")
+	}
+}
@@ -0,0 +1,7 @@
+package events
+
+import "errors"
+
+var (
+	ErrUnknownKeyName = errors.New("unknown key name")
+)
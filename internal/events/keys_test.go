@@ -0,0 +1,54 @@
+package events
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLookupKeyCode(t *testing.T) {
+	tests := []struct {
+		name string
+		want uint16
+	}{
+		{"KEY_POWER", 116},
+		{"KEY_VOLUMEUP", 115},
+		{"KEY_VOLUMEDOWN", 114},
+		{"KEY_ESC", 1},
+		{"BTN_0", 256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := LookupKeyCode(tt.name)
+			if err != nil {
+				t.Fatalf("LookupKeyCode(%q) failed: %v", tt.name, err)
+			}
+			if code != tt.want {
+				t.Errorf("LookupKeyCode(%q) = %d, want %d", tt.name, code, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupKeyCodeUnknown(t *testing.T) {
+	for _, name := range []string{"KEY_NONESUCH", "key_power", "POWER", ""} {
+		if _, err := LookupKeyCode(name); !errors.Is(err, ErrUnknownKeyName) {
+			t.Errorf("LookupKeyCode(%q) error = %v, want %v", name, err, ErrUnknownKeyName)
+		}
+	}
+}
+
+func TestKeyNameRoundTrip(t *testing.T) {
+	for name, code := range keyNames {
+		if got, ok := KeyCodeName(code); !ok || got != name {
+			t.Errorf("KeyCodeName(%d) = %q, %v, want %q", code, got, ok, name)
+		}
+		if got, err := LookupKeyCode(name); err != nil || got != code {
+			t.Errorf("LookupKeyCode(%q) = %d, %v, want %d", name, got, err, code)
+		}
+	}
+
+	if name, ok := KeyCodeName(65535); ok {
+		t.Errorf("KeyCodeName(65535) = %q, want no name", name)
+	}
+}
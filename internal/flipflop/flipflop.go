@@ -2,9 +2,11 @@ package flipflop
 
 import (
 	"log"
+	"math/rand/v2"
 	"sync"
 	"time"
 
+	"github.com/larsks/airdancer/internal/clock"
 	"github.com/larsks/airdancer/internal/switchcollection"
 )
 
@@ -13,6 +15,10 @@ type Flipflop struct {
 	switches  []switchcollection.Switch
 	period    float64
 	dutyCycle float64
+	phase     float64
+	jitter    float64
+	rng       *rand.Rand
+	clock     clock.Clock
 	stopCh    chan struct{}
 	doneCh    chan struct{}
 	mutex     sync.RWMutex
@@ -20,10 +26,12 @@ type Flipflop struct {
 	current   int // Index of currently active switch
 }
 
-// NewFlipflop creates a new Flipflop instance with the given switches and period in seconds
-func NewFlipflop(switches []switchcollection.Switch, period float64, dutyCycle float64) (*Flipflop, error) {
-	if len(switches) == 0 {
-		return nil, ErrNoSwitches
+// NewFlipflop creates a new Flipflop instance with the given switches and
+// period in seconds. Phase (0 to 1) offsets the starting point within the
+// period.
+func NewFlipflop(switches []switchcollection.Switch, period float64, dutyCycle float64, phase float64) (*Flipflop, error) {
+	if len(switches) < 2 {
+		return nil, ErrTooFewSwitches
 	}
 	if period <= 0 {
 		return nil, ErrInvalidPeriod
@@ -31,6 +39,9 @@ func NewFlipflop(switches []switchcollection.Switch, period float64, dutyCycle f
 	if dutyCycle < 0 || dutyCycle > 1 {
 		return nil, ErrInvalidDutyCycle
 	}
+	if phase < 0 || phase > 1 {
+		return nil, ErrInvalidPhase
+	}
 
 	// Default duty cycle is 0.5 if not specified
 	if dutyCycle == 0 {
@@ -41,12 +52,43 @@ func NewFlipflop(switches []switchcollection.Switch, period float64, dutyCycle f
 		switches:  switches,
 		period:    period,
 		dutyCycle: dutyCycle,
+		phase:     phase,
+		clock:     clock.Real,
 		stopCh:    make(chan struct{}),
 		doneCh:    make(chan struct{}),
 		current:   -1, // Start with no switch active
 	}, nil
 }
 
+// SetClock sets the clock used to time the flipflop. It must be called
+// before Start.
+func (f *Flipflop) SetClock(c clock.Clock) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.clock = c
+}
+
+// SetJitter randomizes each on and off interval by up to the given
+// fraction (0 to 1) of its length, so that the flipflop is less regular. It
+// must be called before Start.
+func (f *Flipflop) SetJitter(jitter float64) error {
+	if jitter < 0 || jitter > 1 {
+		return ErrInvalidJitter
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.jitter = jitter
+	return nil
+}
+
+// SetRand sets the random number generator used for jitter. It must be
+// called before Start.
+func (f *Flipflop) SetRand(rng *rand.Rand) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.rng = rng
+}
+
 // Start begins the flipflop operation
 func (f *Flipflop) Start() error {
 	f.mutex.Lock()
@@ -112,6 +154,13 @@ func (f *Flipflop) GetDutyCycle() float64 {
 	return f.dutyCycle
 }
 
+// GetPhase returns the phase offset
+func (f *Flipflop) GetPhase() float64 {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.phase
+}
+
 // GetSwitches returns the underlying switches
 func (f *Flipflop) GetSwitches() []switchcollection.Switch {
 	f.mutex.RLock()
@@ -126,32 +175,42 @@ func (f *Flipflop) GetCurrentSwitch() int {
 	return f.current
 }
 
-// flipflopLoop is the main goroutine that handles the rotation
+// flipflopLoop is the main goroutine that handles the rotation. Each period
+// starts with all switches off and ends with the next switch on.
 func (f *Flipflop) flipflopLoop() {
 	defer close(f.doneCh)
 
 	onTime := time.Duration(f.period * f.dutyCycle * float64(time.Second))
 	offTime := time.Duration(f.period * (1 - f.dutyCycle) * float64(time.Second))
-	clock := time.NewTimer(offTime)
-	defer clock.Stop()
+
+	// Work out where in the period the phase puts us
+	offset := time.Duration(f.period * f.phase * float64(time.Second))
+	if offset >= onTime+offTime {
+		offset = 0
+	}
 
 	state := false // Start with off state
+	delay := offTime - offset
+	if offset >= offTime {
+		state = true
+		delay = onTime + offTime - offset
+		f.turnOnNext()
+	}
+
+	timer := f.clock.NewTimer(f.jittered(delay))
+	defer func() { timer.Stop() }()
 
 	for {
 		select {
 		case <-f.stopCh:
 			return
-		case <-clock.C:
+		case <-timer.C():
 			state = !state
 			if state {
-				// Turn on the next switch in sequence
-				f.current = (f.current + 1) % len(f.switches)
-				sw := f.switches[f.current]
-				if err := sw.TurnOn(); err != nil {
-					log.Printf("flipflop failed to turn on switch %s", sw)
+				if err := f.turnOnNext(); err != nil {
 					break
 				}
-				clock = time.NewTimer(onTime)
+				timer = f.clock.NewTimer(f.jittered(onTime))
 			} else {
 				// Turn off the current switch
 				if f.current >= 0 && f.current < len(f.switches) {
@@ -161,8 +220,35 @@ func (f *Flipflop) flipflopLoop() {
 						break
 					}
 				}
-				clock = time.NewTimer(offTime)
+				timer = f.clock.NewTimer(f.jittered(offTime))
 			}
 		}
 	}
 }
+
+// turnOnNext turns on the next switch in sequence
+func (f *Flipflop) turnOnNext() error {
+	f.current = (f.current + 1) % len(f.switches)
+	sw := f.switches[f.current]
+	if err := sw.TurnOn(); err != nil {
+		log.Printf("flipflop failed to turn on switch %s", sw)
+		return err
+	}
+	return nil
+}
+
+// jittered returns d adjusted by a random amount within the jitter bound
+func (f *Flipflop) jittered(d time.Duration) time.Duration {
+	if f.jitter == 0 {
+		return d
+	}
+
+	var r float64
+	if f.rng != nil {
+		r = f.rng.Float64()
+	} else {
+		r = rand.Float64()
+	}
+
+	return time.Duration(float64(d) * (1 + f.jitter*(2*r-1)))
+}
@@ -0,0 +1,173 @@
+package flipflop
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/larsks/airdancer/internal/clock"
+	"github.com/larsks/airdancer/internal/switchcollection"
+)
+
+func TestNewFlipflopInvalidPhase(t *testing.T) {
+	switches := switchcollection.NewDummySwitchCollection(2).ListSwitches()
+	for _, phase := range []float64{-0.1, 1.1} {
+		if _, err := NewFlipflop(switches, 1, 0, phase); !errors.Is(err, ErrInvalidPhase) {
+			t.Errorf("NewFlipflop() with phase %v error = %v, want %v", phase, err, ErrInvalidPhase)
+		}
+	}
+}
+
+func TestFlipflopPhase(t *testing.T) {
+	tests := []struct {
+		name         string
+		phase        float64
+		initialState bool
+		firstEdge    time.Duration
+	}{
+		{"no offset", 0, false, 500 * time.Millisecond},
+		{"quarter period", 0.25, false, 250 * time.Millisecond},
+		{"three quarter period", 0.75, true, 250 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			switches := switchcollection.NewDummySwitchCollection(2).ListSwitches()
+			fake := clock.NewFake(time.Unix(0, 0))
+
+			ff, err := NewFlipflop(switches, 1, 0.5, tt.phase)
+			if err != nil {
+				t.Fatalf("NewFlipflop() failed: %v", err)
+			}
+			ff.SetClock(fake)
+
+			if err := ff.Start(); err != nil {
+				t.Fatalf("Start() failed: %v", err)
+			}
+			defer ff.Stop() //nolint:errcheck
+
+			first := switches[0]
+
+			fake.BlockUntil(1)
+			if state, _ := first.GetState(); state != tt.initialState {
+				t.Errorf("initial state = %v, want %v", state, tt.initialState)
+			}
+
+			fake.Advance(tt.firstEdge - time.Millisecond)
+			if state, _ := first.GetState(); state != tt.initialState {
+				t.Errorf("state before first edge = %v, want %v", state, tt.initialState)
+			}
+
+			fake.Advance(time.Millisecond)
+			fake.BlockUntil(1)
+			if state, _ := first.GetState(); state == tt.initialState {
+				t.Errorf("state after first edge = %v, want %v", state, !tt.initialState)
+			}
+		})
+	}
+}
+
+func TestFlipflopAntiPhase(t *testing.T) {
+	switches := switchcollection.NewDummySwitchCollection(4).ListSwitches()
+	fake := clock.NewFake(time.Unix(0, 0))
+
+	var flipflops []*Flipflop
+	for i, phase := range []float64{0, 0.5} {
+		ff, err := NewFlipflop(switches[i*2:i*2+2], 1, 0.5, phase)
+		if err != nil {
+			t.Fatalf("NewFlipflop() failed: %v", err)
+		}
+		ff.SetClock(fake)
+		if err := ff.Start(); err != nil {
+			t.Fatalf("Start() failed: %v", err)
+		}
+		defer ff.Stop() //nolint:errcheck
+		flipflops = append(flipflops, ff)
+	}
+
+	anyOn := func(group []switchcollection.Switch) bool {
+		for _, sw := range group {
+			if state, _ := sw.GetState(); state {
+				return true
+			}
+		}
+		return false
+	}
+
+	// At every half period exactly one of the two groups is on
+	for step := 0; step < 4; step++ {
+		fake.BlockUntil(2)
+		first, second := anyOn(switches[:2]), anyOn(switches[2:])
+		if first == second {
+			t.Fatalf("step %d: first group on = %v, second group on = %v; want opposite", step, first, second)
+		}
+		fake.Advance(500 * time.Millisecond)
+	}
+}
+
+// recordingClock records the duration of every timer created
+type recordingClock struct {
+	*clock.Fake
+	mutex     sync.Mutex
+	durations []time.Duration
+}
+
+func (c *recordingClock) NewTimer(d time.Duration) clock.Timer {
+	c.mutex.Lock()
+	c.durations = append(c.durations, d)
+	c.mutex.Unlock()
+	return c.Fake.NewTimer(d)
+}
+
+// collectIntervals advances c until n timers have been created and
+// returns their durations.
+func (c *recordingClock) collectIntervals(n int) []time.Duration {
+	for {
+		c.BlockUntil(1)
+		c.mutex.Lock()
+		if len(c.durations) >= n {
+			durations := append([]time.Duration(nil), c.durations[:n]...)
+			c.mutex.Unlock()
+			return durations
+		}
+		c.mutex.Unlock()
+		c.Advance(time.Second)
+	}
+}
+
+func TestFlipflopJitter(t *testing.T) {
+	switches := switchcollection.NewDummySwitchCollection(2).ListSwitches()
+	rc := &recordingClock{Fake: clock.NewFake(time.Unix(0, 0))}
+
+	ff, err := NewFlipflop(switches, 1, 0.25, 0)
+	if err != nil {
+		t.Fatalf("NewFlipflop() failed: %v", err)
+	}
+	if err := ff.SetJitter(-0.1); !errors.Is(err, ErrInvalidJitter) {
+		t.Errorf("SetJitter(-0.1) error = %v, want %v", err, ErrInvalidJitter)
+	}
+	if err := ff.SetJitter(0.1); err != nil {
+		t.Fatalf("SetJitter() failed: %v", err)
+	}
+	ff.SetRand(rand.New(rand.NewPCG(3, 4)))
+	ff.SetClock(rc)
+
+	if err := ff.Start(); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	defer ff.Stop() //nolint:errcheck
+
+	// Intervals alternate between off (750ms) and on (250ms), each +/- 10%
+	for i, d := range rc.collectIntervals(20) {
+		nominal := 750 * time.Millisecond
+		if i%2 == 1 {
+			nominal = 250 * time.Millisecond
+		}
+		low, high := nominal*9/10, nominal*11/10
+		if d < low || d > high {
+			t.Errorf("interval %d = %v, want between %v and %v", i, d, low, high)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package httpserver
+
+import "errors"
+
+// Configuration errors
+var (
+	ErrListenAddressConflict = errors.New("listen-address and listen-addresses cannot both be set")
+	ErrTLSIncomplete         = errors.New("tls-cert-file and tls-key-file must be set together")
+	ErrTLSLoadFailed         = errors.New("failed to load TLS certificate")
+)
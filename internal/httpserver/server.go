@@ -2,57 +2,173 @@ package httpserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
-	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
+// ShutdownTimeout is how long a server is given to finish in-flight
+// requests when shutting down.
+const ShutdownTimeout = 5 * time.Second
+
 // StartWithGracefulShutdown starts an HTTP server with graceful shutdown handling
 func StartWithGracefulShutdown(addr string, handler http.Handler) error {
+	return StartOnAddresses([]string{addr}, handler)
+}
+
+// StartOnAddresses starts an HTTP server listening on each of addrs and
+// shuts it down gracefully on SIGINT or SIGTERM
+func StartOnAddresses(addrs []string, handler http.Handler) error {
+	listeners, err := Listen(addrs)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	srv := &http.Server{
-		Addr:    addr,
 		Handler: handler,
 	}
 
-	// Start server in goroutine
-	go func() {
-		log.Printf("starting server on %s", addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server failed: %v", err)
+	return Serve(ctx, srv, listeners)
+}
+
+// Listen opens a TCP listener on each address. If any address cannot be
+// bound, the listeners that were already opened are closed.
+func Listen(addrs []string) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close() //nolint:errcheck
+			}
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
 		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// Serve serves requests from srv on every listener until ctx is canceled,
+// one of the listeners fails, or srv is closed, and then shuts srv down
+// gracefully. A failure on one listener stops the server on all of them.
+// If srv.TLSConfig is set, connections are served over TLS.
+func Serve(ctx context.Context, srv *http.Server, listeners []net.Listener) error {
+	return ServeWithShutdownTimeout(ctx, srv, listeners, ShutdownTimeout)
+}
+
+// ServeWithShutdownTimeout is like Serve, but allows in-flight requests up
+// to timeout to finish when shutting down.
+func ServeWithShutdownTimeout(ctx context.Context, srv *http.Server, listeners []net.Listener, timeout time.Duration) error {
+	serveErr := make(chan error, len(listeners))
+	var wg sync.WaitGroup
+
+	// Checked once up front: serving modifies srv.TLSConfig to set up HTTP/2
+	useTLS := srv.TLSConfig != nil
+
+	for _, listener := range listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if useTLS {
+				log.Printf("starting server on %s (TLS)", listener.Addr())
+				err = srv.ServeTLS(listener, "", "")
+			} else {
+				log.Printf("starting server on %s", listener.Addr())
+				err = srv.Serve(listener)
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- fmt.Errorf("server on %s failed: %w", listener.Addr(), err)
+			}
+		}()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
 	}()
 
-	// Wait for interrupt signal
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-	<-stop
+	var err error
+	select {
+	case err = <-serveErr:
+	case <-ctx.Done():
+	case <-stopped:
+	}
 
 	log.Println("shutting down server...")
 
-	// Create context with timeout for graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
-		return fmt.Errorf("server shutdown failed: %w", err)
+	if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+		err = fmt.Errorf("server shutdown failed: %w", shutdownErr)
+	}
+	<-stopped
+
+	// A listener may have failed at the same time as the others stopped
+	if err == nil {
+		select {
+		case err = <-serveErr:
+		default:
+		}
+	}
+
+	if err == nil {
+		log.Println("server gracefully stopped")
+	}
+	return err
+}
+
+// ListenAddresses returns the host:port addresses for a server. If hosts is
+// non-empty there is one address for each entry, otherwise a single address
+// for host. IPv6 literals are bracketed as needed.
+func ListenAddresses(host string, hosts []string, port int) ([]string, error) {
+	if len(hosts) == 0 {
+		return []string{JoinHostPort(host, port)}, nil
+	}
+	if host != "" {
+		return nil, ErrListenAddressConflict
 	}
 
-	log.Println("server gracefully stopped")
-	return nil
+	addrs := make([]string, len(hosts))
+	for i, h := range hosts {
+		addrs[i] = JoinHostPort(h, port)
+	}
+	return addrs, nil
+}
+
+// JoinHostPort combines a host (which may be empty, a name, an IPv4
+// address, or an IPv6 address with or without brackets) and a port into a
+// listen address.
+func JoinHostPort(host string, port int) string {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return net.JoinHostPort(host, strconv.Itoa(port))
 }
 
 // Config represents common HTTP server configuration
 type Config interface {
 	GetListenAddress() string
+	GetListenAddresses() []string
 	GetListenPort() int
 }
 
 // StartFromConfig starts an HTTP server using a Config interface
 func StartFromConfig(cfg Config, handler http.Handler) error {
-	addr := fmt.Sprintf("%s:%d", cfg.GetListenAddress(), cfg.GetListenPort())
-	return StartWithGracefulShutdown(addr, handler)
+	addrs, err := ListenAddresses(cfg.GetListenAddress(), cfg.GetListenAddresses(), cfg.GetListenPort())
+	if err != nil {
+		return err
+	}
+	return StartOnAddresses(addrs, handler)
 }
@@ -0,0 +1,129 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestJoinHostPort(t *testing.T) {
+	tests := []struct {
+		host string
+		port int
+		want string
+	}{
+		{"", 8080, ":8080"},
+		{"localhost", 8080, "localhost:8080"},
+		{"127.0.0.1", 8080, "127.0.0.1:8080"},
+		{"::1", 8080, "[::1]:8080"},
+		{"[::1]", 8080, "[::1]:8080"},
+		{"::", 80, "[::]:80"},
+		{"fe80::1%eth0", 8080, "[fe80::1%eth0]:8080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := JoinHostPort(tt.host, tt.port); got != tt.want {
+				t.Errorf("JoinHostPort(%q, %d) = %q, want %q", tt.host, tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListenAddresses(t *testing.T) {
+	addrs, err := ListenAddresses("::1", nil, 8080)
+	if err != nil {
+		t.Fatalf("ListenAddresses() unexpected error = %v", err)
+	}
+	if len(addrs) != 1 || addrs[0] != "[::1]:8080" {
+		t.Errorf("ListenAddresses() = %v, want [[::1]:8080]", addrs)
+	}
+
+	addrs, err = ListenAddresses("", []string{"0.0.0.0", "::"}, 8080)
+	if err != nil {
+		t.Fatalf("ListenAddresses() unexpected error = %v", err)
+	}
+	if len(addrs) != 2 || addrs[0] != "0.0.0.0:8080" || addrs[1] != "[::]:8080" {
+		t.Errorf("ListenAddresses() = %v, want [0.0.0.0:8080 [::]:8080]", addrs)
+	}
+
+	if _, err := ListenAddresses("localhost", []string{"::1"}, 8080); !errors.Is(err, ErrListenAddressConflict) {
+		t.Errorf("ListenAddresses() error = %v, want %v", err, ErrListenAddressConflict)
+	}
+}
+
+func TestServeMultipleListeners(t *testing.T) {
+	hosts := []string{"127.0.0.1"}
+	if l, err := net.Listen("tcp6", "[::1]:0"); err == nil {
+		l.Close() //nolint:errcheck
+		hosts = append(hosts, "::1")
+	} else {
+		t.Logf("IPv6 loopback not available, testing IPv4 only: %v", err)
+	}
+
+	addrs, err := ListenAddresses("", hosts, 0)
+	if err != nil {
+		t.Fatalf("ListenAddresses() unexpected error = %v", err)
+	}
+
+	listeners, err := Listen(addrs)
+	if err != nil {
+		t.Fatalf("Listen(%v) unexpected error = %v", addrs, err)
+	}
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- Serve(ctx, srv, listeners)
+	}()
+
+	for _, listener := range listeners {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/")
+		if err != nil {
+			t.Fatalf("request to %s failed: %v", listener.Addr(), err)
+		}
+		resp.Body.Close() //nolint:errcheck
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("request to %s status = %d, want %d", listener.Addr(), resp.StatusCode, http.StatusNoContent)
+		}
+	}
+
+	cancel()
+	if err := <-serveErr; err != nil {
+		t.Errorf("Serve() returned error: %v", err)
+	}
+
+	// All listeners are closed on shutdown
+	for _, listener := range listeners {
+		if _, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+			t.Errorf("listener on %s still accepting connections after shutdown", listener.Addr())
+		}
+	}
+}
+
+func TestListenIPv6Literal(t *testing.T) {
+	if l, err := net.Listen("tcp6", "[::1]:0"); err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	} else {
+		l.Close() //nolint:errcheck
+	}
+
+	listeners, err := Listen([]string{JoinHostPort("::1", 0)})
+	if err != nil {
+		t.Fatalf("Listen() on IPv6 literal failed: %v", err)
+	}
+	defer listeners[0].Close() //nolint:errcheck
+
+	addr := listeners[0].Addr().(*net.TCPAddr)
+	if !addr.IP.Equal(net.IPv6loopback) {
+		t.Errorf("listener bound to %v, want %v", addr.IP, net.IPv6loopback)
+	}
+}
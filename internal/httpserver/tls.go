@@ -0,0 +1,136 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSOptions holds the TLS settings shared by the HTTP servers
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// Reload causes the certificate and key to be reloaded when the files
+	// change, so that renewed certificates are picked up without a restart.
+	Reload bool
+}
+
+// Enabled returns true if a certificate has been configured
+func (o TLSOptions) Enabled() bool {
+	return o.CertFile != "" || o.KeyFile != ""
+}
+
+// NewTLSConfig returns a TLS configuration for serving the given
+// certificate, or nil if TLS is not configured. Only TLS 1.2 and later with
+// forward-secret AEAD cipher suites are accepted.
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	if !opts.Enabled() {
+		return nil, nil
+	}
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, ErrTLSIncomplete
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{
+			tls.X25519,
+			tls.CurveP256,
+		},
+		// Only used for TLS 1.2; TLS 1.3 suites are not configurable.
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+
+	if opts.Reload {
+		reloader, err := newCertReloader(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GetCertificate = reloader.GetCertificate
+		return cfg, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTLSLoadFailed, err)
+	}
+	cfg.Certificates = []tls.Certificate{cert}
+
+	return cfg, nil
+}
+
+// certReloader serves a certificate and key pair, reloading them when the
+// modification time of either file changes.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	certMod  time.Time
+	keyMod   time.Time
+	mutex    sync.Mutex
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Keep serving the old certificate if the new one can't be loaded
+	// (for example, because only one of the files has been replaced yet)
+	if err := r.reloadIfChanged(); err != nil {
+		log.Printf("failed to reload TLS certificate: %v", err)
+	}
+	return r.cert, nil
+}
+
+// reloadIfChanged loads the certificate if it has not been loaded yet or
+// either file has changed. The caller must hold r.mutex (or have exclusive
+// access to r).
+func (r *certReloader) reloadIfChanged() error {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTLSLoadFailed, err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTLSLoadFailed, err)
+	}
+
+	if r.cert != nil && certInfo.ModTime().Equal(r.certMod) && keyInfo.ModTime().Equal(r.keyMod) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTLSLoadFailed, err)
+	}
+
+	if r.cert != nil {
+		log.Printf("reloaded TLS certificate from %s", r.certFile)
+	}
+	r.cert = &cert
+	r.certMod = certInfo.ModTime()
+	r.keyMod = keyInfo.ModTime()
+	return nil
+}
@@ -0,0 +1,201 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 with
+// the given common name to dir, and returns the paths of the certificate
+// and key files along with the parsed certificate.
+func writeSelfSignedCert(t *testing.T, dir, commonName string) (string, string, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	return certFile, keyFile, cert
+}
+
+// startTLSServer serves a trivial handler over TLS on a loopback port and
+// returns its address. The server is shut down when the test ends.
+func startTLSServer(t *testing.T, tlsConfig *tls.Config) string {
+	t.Helper()
+
+	listeners, err := Listen([]string{"127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+		TLSConfig: tlsConfig,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- Serve(ctx, srv, listeners)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-serveErr; err != nil {
+			t.Errorf("Serve() returned error: %v", err)
+		}
+	})
+
+	return listeners[0].Addr().String()
+}
+
+// newTLSClient returns a client that trusts only the given certificates
+func newTLSClient(certs ...*x509.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: pool},
+			DisableKeepAlives: true,
+		},
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	cfg, err := NewTLSConfig(TLSOptions{})
+	if err != nil || cfg != nil {
+		t.Errorf("NewTLSConfig() with no files = %v, %v; want nil, nil", cfg, err)
+	}
+
+	if _, err := NewTLSConfig(TLSOptions{CertFile: "cert.pem"}); !errors.Is(err, ErrTLSIncomplete) {
+		t.Errorf("NewTLSConfig() without key error = %v, want %v", err, ErrTLSIncomplete)
+	}
+
+	dir := t.TempDir()
+	if _, err := NewTLSConfig(TLSOptions{
+		CertFile: filepath.Join(dir, "missing.pem"),
+		KeyFile:  filepath.Join(dir, "missing.key"),
+	}); !errors.Is(err, ErrTLSLoadFailed) {
+		t.Errorf("NewTLSConfig() with missing files error = %v, want %v", err, ErrTLSLoadFailed)
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	certFile, keyFile, cert := writeSelfSignedCert(t, t.TempDir(), "airdancer")
+
+	tlsConfig, err := NewTLSConfig(TLSOptions{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("NewTLSConfig() failed: %v", err)
+	}
+	addr := startTLSServer(t, tlsConfig)
+
+	resp, err := newTLSClient(cert).Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("HTTPS request status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+
+	// Clients limited to TLS 1.1 are rejected
+	oldClient := newTLSClient(cert)
+	oldClient.Transport.(*http.Transport).TLSClientConfig.MaxVersion = tls.VersionTLS11
+	if resp, err := oldClient.Get("https://" + addr + "/"); err == nil {
+		resp.Body.Close() //nolint:errcheck
+		t.Error("TLS 1.1 request succeeded, want handshake failure")
+	}
+}
+
+func TestServeTLSReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, firstCert := writeSelfSignedCert(t, dir, "first")
+
+	tlsConfig, err := NewTLSConfig(TLSOptions{CertFile: certFile, KeyFile: keyFile, Reload: true})
+	if err != nil {
+		t.Fatalf("NewTLSConfig() failed: %v", err)
+	}
+	addr := startTLSServer(t, tlsConfig)
+
+	peerName := func(client *http.Client) string {
+		t.Helper()
+		resp, err := client.Get("https://" + addr + "/")
+		if err != nil {
+			t.Fatalf("HTTPS request failed: %v", err)
+		}
+		resp.Body.Close() //nolint:errcheck
+		return resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	if name := peerName(newTLSClient(firstCert)); name != "first" {
+		t.Errorf("server certificate = %q, want %q", name, "first")
+	}
+
+	// Replace the certificate, making sure the modification time changes
+	_, _, secondCert := writeSelfSignedCert(t, dir, "second")
+	future := time.Now().Add(time.Minute)
+	for _, path := range []string{certFile, keyFile} {
+		if err := os.Chtimes(path, future, future); err != nil {
+			t.Fatalf("failed to update modification time: %v", err)
+		}
+	}
+
+	if name := peerName(newTLSClient(secondCert)); name != "second" {
+		t.Errorf("server certificate after reload = %q, want %q", name, "second")
+	}
+}
@@ -0,0 +1,176 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Command modes select how a trigger's command is run
+const (
+	// CommandModeShell runs the command with "sh -c", so that it can use
+	// pipes, redirections, and variables. This is the default.
+	CommandModeShell = "shell"
+	// CommandModeExec splits the command into arguments, honoring single
+	// and double quotes and backslashes, and runs it directly, without
+	// a shell
+	CommandModeExec = "exec"
+)
+
+// commandOptions control how a trigger's command is run
+type commandOptions struct {
+	mode       string
+	workingDir string
+	cleanEnv   bool
+	inheritEnv []string
+	env        []string
+}
+
+// newCommandOptions returns the command options set in trigger
+func newCommandOptions(trigger TriggerConfig) commandOptions {
+	return commandOptions{
+		mode:       trigger.CommandMode,
+		workingDir: trigger.WorkingDir,
+		cleanEnv:   trigger.CleanEnv,
+		inheritEnv: trigger.InheritEnv,
+		env:        trigger.Env,
+	}
+}
+
+// baseEnv returns the variables the command inherits from the monitor's
+// environment: all of them, unless cleanEnv or inheritEnv is set, in which
+// case only those named in inheritEnv
+func (o commandOptions) baseEnv() []string {
+	if !o.cleanEnv && len(o.inheritEnv) == 0 {
+		return os.Environ()
+	}
+
+	var env []string
+	for _, name := range o.inheritEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// validateCommandEnv returns an error if an entry of env is not of the
+// form NAME=value
+func validateCommandEnv(env []string) error {
+	for _, entry := range env {
+		if name, _, found := strings.Cut(entry, "="); !found || name == "" {
+			return fmt.Errorf("%w: %q", ErrInvalidCommandEnv, entry)
+		}
+	}
+	return nil
+}
+
+// validateCommandMode returns an error if mode is not a known command mode.
+// An empty mode is CommandModeShell.
+func validateCommandMode(mode string) error {
+	switch mode {
+	case "", CommandModeShell, CommandModeExec:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q (must be %s or %s)", ErrInvalidCommandMode, mode, CommandModeShell, CommandModeExec)
+	}
+}
+
+// commandArgs returns the arguments with which to run command in mode,
+// with the ${mailbox} and ${account} references expanded for mailbox
+func commandArgs(command, mode string, mailbox compiledMailbox) ([]string, error) {
+	if err := validateCommandMode(mode); err != nil {
+		return nil, err
+	}
+	if mode == CommandModeExec {
+		args, err := splitCommand(command)
+		if err != nil {
+			return nil, err
+		}
+		for i := range args {
+			args[i] = mailbox.expand(args[i], false)
+		}
+		return args, nil
+	}
+	return []string{"sh", "-c", mailbox.expand(command, true)}, nil
+}
+
+// expand replaces the ${mailbox} and ${account} references in s with the
+// name of the mailbox and its account. If quote is true, the values are
+// quoted for the shell.
+func (m compiledMailbox) expand(s string, quote bool) string {
+	mailbox, account := m.mailbox, m.account
+	if quote {
+		mailbox, account = shellQuote(mailbox), shellQuote(account)
+	}
+	return strings.NewReplacer("${mailbox}", mailbox, "${account}", account).Replace(s)
+}
+
+// shellQuote quotes s so that the shell takes it literally
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// splitCommand splits command into arguments the way the shell would,
+// without expanding anything. Text in single quotes is taken literally;
+// in double quotes, a backslash escapes only $, `, ", \, and newline;
+// elsewhere, a backslash escapes the next character.
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case quote == '"':
+			switch {
+			case r == '"':
+				quote = 0
+			case r == '\\' && i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]):
+				i++
+				arg.WriteRune(runes[i])
+			default:
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("%w: trailing backslash in %q", ErrInvalidCommand, command)
+			}
+			i++
+			arg.WriteRune(runes[i])
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("%w: unterminated %c quote in %q", ErrInvalidCommand, quote, command)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%w: %q is empty", ErrInvalidCommand, command)
+	}
+	return args, nil
+}
@@ -0,0 +1,260 @@
+package monitor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    []string
+		wantErr error
+	}{
+		{"words", "dancerctl switch on", []string{"dancerctl", "switch", "on"}, nil},
+		{"extra spaces", "  dancerctl\tswitch  on ", []string{"dancerctl", "switch", "on"}, nil},
+		{"single quotes", "echo 'hello  world'", []string{"echo", "hello  world"}, nil},
+		{"double quotes", `echo "hello world" "$HOME"`, []string{"echo", "hello world", "$HOME"}, nil},
+		{"escapes in double quotes", `echo "say \"hi\" \n"`, []string{"echo", `say "hi" \n`}, nil},
+		{"backslash", `echo hello\ world`, []string{"echo", "hello world"}, nil},
+		{"empty argument", `echo ""`, []string{"echo", ""}, nil},
+		{"adjacent quotes", `echo a'b c'"d"`, []string{"echo", "ab cd"}, nil},
+		{"shell operators", "echo a | wc", []string{"echo", "a", "|", "wc"}, nil},
+		{"unterminated quote", `echo "hello`, nil, ErrInvalidCommand},
+		{"trailing backslash", `echo \`, nil, ErrInvalidCommand},
+		{"empty", "   ", nil, ErrInvalidCommand},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitCommand(tt.command)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("splitCommand(%q) error = %v, want %v", tt.command, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandArgsInvalidMode(t *testing.T) {
+	if _, err := commandArgs("echo hello", "bash", compiledMailbox{}); !errors.Is(err, ErrInvalidCommandMode) {
+		t.Errorf("commandArgs() error = %v, want %v", err, ErrInvalidCommandMode)
+	}
+}
+
+func TestRealCommandExecutorQuotedSpaces(t *testing.T) {
+	for _, mode := range []string{CommandModeShell, CommandModeExec} {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			command := `touch "` + dir + `/hello world"`
+
+			args, err := commandArgs(command, mode, compiledMailbox{})
+			if err != nil {
+				t.Fatalf("commandArgs() failed: %v", err)
+			}
+
+			executor := &RealCommandExecutor{}
+			if err := executor.Execute(args, "", os.Environ(), nil); err != nil {
+				t.Fatalf("Execute() failed: %v", err)
+			}
+			executor.Wait()
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("ReadDir() failed: %v", err)
+			}
+			if len(entries) != 1 || entries[0].Name() != "hello world" {
+				var names []string
+				for _, entry := range entries {
+					names = append(names, entry.Name())
+				}
+				t.Errorf("command created %q, want [%q]", names, "hello world")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "hello world")); err != nil {
+				t.Errorf("quoted argument was not passed as one argument: %v", err)
+			}
+		})
+	}
+}
+
+func TestEmailMonitorExecuteCommandExecMode(t *testing.T) {
+	config := Config{
+		IMAP: IMAPConfig{Server: "imap.example.com", Port: 993},
+		Monitor: []MailboxConfig{
+			{
+				Mailbox: "INBOX",
+				Triggers: []TriggerConfig{
+					{RegexPattern: "test", Command: `dancerctl switch "front porch" on`, CommandMode: CommandModeExec},
+				},
+			},
+		},
+	}
+
+	mockExecutor := &MockCommandExecutor{}
+	monitor, err := NewEmailMonitor(config, &MockIMAPDialer{}, mockExecutor, &MockLogger{}, &MockTimer{})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	notifier := monitor.mailboxes[0].triggers[0].notifier
+	if err := notifier.Notify(&Notification{msg: &imap.Message{Uid: 123, Envelope: &imap.Envelope{Subject: "Test Subject"}}}); err != nil {
+		t.Fatalf("Notify() failed: %v", err)
+	}
+
+	want := []string{"dancerctl", "switch", "front porch", "on"}
+	if !reflect.DeepEqual(mockExecutor.lastArgs, want) {
+		t.Errorf("Expected args %q, got %q", want, mockExecutor.lastArgs)
+	}
+}
+
+func TestEmailMonitorExecuteCommandMailbox(t *testing.T) {
+	tests := []struct {
+		mode     string
+		command  string
+		wantArgs []string
+	}{
+		{CommandModeShell, "route ${mailbox} ${account}", []string{"sh", "-c", `route 'Alerts/Door'\''s' 'alice@imap.example.com'`}},
+		{CommandModeExec, "route ${mailbox} --account=${account}", []string{"route", "Alerts/Door's", "--account=alice@imap.example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			trigger := TriggerConfig{RegexPattern: "test", Command: tt.command, CommandMode: tt.mode}
+			config := Config{
+				IMAP: IMAPConfig{Server: "imap.example.com", Port: 993, Username: "alice"},
+				Monitor: []MailboxConfig{
+					{Mailbox: "INBOX", Triggers: []TriggerConfig{trigger}},
+					{Mailbox: "Alerts/Door's", Triggers: []TriggerConfig{trigger}},
+				},
+			}
+
+			mockExecutor := &MockCommandExecutor{}
+			monitor, err := NewEmailMonitor(config, &MockIMAPDialer{}, mockExecutor, &MockLogger{}, &MockTimer{})
+			if err != nil {
+				t.Fatalf("Failed to create monitor: %v", err)
+			}
+
+			msg := &imap.Message{
+				Uid:      123,
+				Envelope: &imap.Envelope{Subject: "Test Subject"},
+				Body: map[*imap.BodySectionName]imap.Literal{
+					{}: &MockLiteral{content: testEmailWithPattern},
+				},
+			}
+			if err := monitor.processMessageInMailbox(msg, monitor.mailboxes[1]); err != nil {
+				t.Fatalf("processMessageInMailbox() failed: %v", err)
+			}
+
+			for _, want := range []string{"EMAIL_MAILBOX=Alerts/Door's", "EMAIL_ACCOUNT=alice@imap.example.com"} {
+				if !containsEnv(mockExecutor.lastEnv, want) {
+					t.Errorf("command environment is missing %s", want)
+				}
+			}
+			if !reflect.DeepEqual(mockExecutor.lastArgs, tt.wantArgs) {
+				t.Errorf("Expected args %q, got %q", tt.wantArgs, mockExecutor.lastArgs)
+			}
+		})
+	}
+}
+
+func TestRealCommandExecutorWorkingDir(t *testing.T) {
+	dir := t.TempDir()
+
+	executor := &RealCommandExecutor{}
+	if err := executor.Execute([]string{"touch", "created"}, dir, os.Environ(), nil); err != nil {
+		t.Fatalf("Execute() failed: %v", err)
+	}
+	executor.Wait()
+
+	if _, err := os.Stat(filepath.Join(dir, "created")); err != nil {
+		t.Errorf("command did not run in the working directory: %v", err)
+	}
+}
+
+func TestEmailMonitorExecuteCommandEnvironment(t *testing.T) {
+	t.Setenv("AIRDANCER_TEST_SECRET", "secret")
+	t.Setenv("AIRDANCER_TEST_KEEP", "kept")
+
+	tests := []struct {
+		name        string
+		trigger     TriggerConfig
+		wantVars    []string
+		notWantVars []string
+	}{
+		{
+			name:     "inherit everything",
+			trigger:  TriggerConfig{},
+			wantVars: []string{"AIRDANCER_TEST_SECRET=secret", "AIRDANCER_TEST_KEEP=kept"},
+		},
+		{
+			name:        "clean env",
+			trigger:     TriggerConfig{CleanEnv: true, Env: []string{"GREETING=hello world"}},
+			wantVars:    []string{"GREETING=hello world", "EMAIL_UID=123", "AIRDANCER_SOURCE=monitor"},
+			notWantVars: []string{"AIRDANCER_TEST_SECRET=secret", "AIRDANCER_TEST_KEEP=kept"},
+		},
+		{
+			name:        "inherit-env",
+			trigger:     TriggerConfig{InheritEnv: []string{"AIRDANCER_TEST_KEEP", "AIRDANCER_TEST_UNSET"}},
+			wantVars:    []string{"AIRDANCER_TEST_KEEP=kept"},
+			notWantVars: []string{"AIRDANCER_TEST_SECRET=secret"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trigger := tt.trigger
+			trigger.RegexPattern = "test"
+			trigger.Command = "dancerctl switch porch on"
+			trigger.WorkingDir = "/var/lib/airdancer"
+			config := Config{
+				IMAP:    IMAPConfig{Server: "imap.example.com", Port: 993},
+				Monitor: []MailboxConfig{{Mailbox: "INBOX", Triggers: []TriggerConfig{trigger}}},
+			}
+
+			mockExecutor := &MockCommandExecutor{}
+			monitor, err := NewEmailMonitor(config, &MockIMAPDialer{}, mockExecutor, &MockLogger{}, &MockTimer{})
+			if err != nil {
+				t.Fatalf("Failed to create monitor: %v", err)
+			}
+
+			notifier := monitor.mailboxes[0].triggers[0].notifier
+			if err := notifier.Notify(&Notification{msg: &imap.Message{Uid: 123, Envelope: &imap.Envelope{Subject: "Test Subject"}}}); err != nil {
+				t.Fatalf("Notify() failed: %v", err)
+			}
+
+			if mockExecutor.lastDir != trigger.WorkingDir {
+				t.Errorf("Expected working directory %q, got %q", trigger.WorkingDir, mockExecutor.lastDir)
+			}
+			for _, v := range tt.wantVars {
+				if !slices.Contains(mockExecutor.lastEnv, v) {
+					t.Errorf("Expected %s in environment %q", v, mockExecutor.lastEnv)
+				}
+			}
+			for _, v := range tt.notWantVars {
+				if slices.Contains(mockExecutor.lastEnv, v) {
+					t.Errorf("Expected %s not to be in environment", v)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateCommandEnv(t *testing.T) {
+	if err := validateCommandEnv([]string{"A=1", "B="}); err != nil {
+		t.Errorf("validateCommandEnv() error = %v, want nil", err)
+	}
+	for _, entry := range []string{"A", "=1"} {
+		if err := validateCommandEnv([]string{entry}); !errors.Is(err, ErrInvalidCommandEnv) {
+			t.Errorf("validateCommandEnv(%q) error = %v, want %v", entry, err, ErrInvalidCommandEnv)
+		}
+	}
+}
@@ -26,13 +26,79 @@ type TriggerConfig struct {
 	IgnoreCase   *bool  `mapstructure:"ignore-case"`
 	Final        bool   `mapstructure:"final"`
 	Command      string `mapstructure:"command"`
+	// CommandMode is CommandModeShell (the default) to run Command with
+	// the shell, or CommandModeExec to run it directly
+	CommandMode string `mapstructure:"command-mode"`
+	// WorkingDir is the directory in which Command runs; by default it
+	// runs in the monitor's working directory
+	WorkingDir string `mapstructure:"working-dir"`
+	// CleanEnv runs Command without the monitor's environment, except
+	// for the variables named in InheritEnv
+	CleanEnv bool `mapstructure:"clean-env"`
+	// InheritEnv, if set, limits the variables Command inherits from the
+	// monitor's environment to these names
+	InheritEnv []string `mapstructure:"inherit-env"`
+	// Env holds additional NAME=value environment variables for Command
+	Env []string `mapstructure:"env"`
+	// AttachmentName and AttachmentType match against the filename and
+	// media type of the message's attachments; both must match the same
+	// attachment. SaveAttachment writes the matching attachment to a
+	// temporary file whose path is passed to the command.
+	AttachmentName string `mapstructure:"match-attachment-name"`
+	AttachmentType string `mapstructure:"match-attachment-type"`
+	SaveAttachment bool   `mapstructure:"save-attachment"`
+	// Notify selects how the trigger acts on a matching message. If it
+	// is not set, the trigger runs Command.
+	Notify *NotifyConfig `mapstructure:"notify"`
+}
+
+// NotifyConfig configures the notifier for a trigger. Title and Message are
+// Go templates that can refer to the fields of the matching message
+// ({{.From}}, {{.Subject}}, {{.Mailbox}}, and so on) and to the capture
+// groups of regex-pattern ({{index .Groups 1}}).
+type NotifyConfig struct {
+	// Type is "command" (the default), "ntfy", or "webhook"
+	Type string `mapstructure:"type"`
+	// Server and Topic select the ntfy topic; Server defaults to
+	// https://ntfy.sh
+	Server   string `mapstructure:"server"`
+	Topic    string `mapstructure:"topic"`
+	Priority string `mapstructure:"priority"`
+	// URL receives a JSON POST request for webhook notifications
+	URL string `mapstructure:"url"`
+	// Token, if set, is sent as a bearer token
+	Token   string `mapstructure:"token"`
+	Title   string `mapstructure:"title"`
+	Message string `mapstructure:"message"`
+}
+
+// Validate checks that the settings required by the notifier type are set
+func (n *NotifyConfig) Validate() error {
+	switch n.Type {
+	case "", NotifierCommand:
+	case NotifierNtfy:
+		if n.Topic == "" {
+			return fmt.Errorf("%w: ntfy requires a topic", ErrInvalidNotifier)
+		}
+	case NotifierWebhook:
+		if n.URL == "" {
+			return fmt.Errorf("%w: webhook requires a url", ErrInvalidNotifier)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidNotifier, n.Type)
+	}
+	return nil
 }
 
 // MailboxConfig holds configuration for a single mailbox
 type MailboxConfig struct {
-	Mailbox       string          `mapstructure:"mailbox"`
-	CheckInterval *int            `mapstructure:"check-interval-seconds"`
-	Triggers      []TriggerConfig `mapstructure:"triggers"`
+	Mailbox       string `mapstructure:"mailbox"`
+	CheckInterval *int   `mapstructure:"check-interval-seconds"`
+	// SearchUnseenOnly and SearchFrom narrow the server-side search so that
+	// only matching messages are fetched from busy mailboxes.
+	SearchUnseenOnly bool            `mapstructure:"search-unseen-only"`
+	SearchFrom       string          `mapstructure:"search-from"`
+	Triggers         []TriggerConfig `mapstructure:"triggers"`
 }
 
 // Config holds the complete configuration for the email monitor
@@ -40,9 +106,52 @@ type Config struct {
 	ConfigFile    string          `mapstructure:"config-file"`
 	IMAP          IMAPConfig      `mapstructure:"imap"`
 	CheckInterval *int            `mapstructure:"check-interval-seconds"`
+	MetricsListen string          `mapstructure:"metrics-listen"`
+	Strict        bool            `mapstructure:"strict"`
 	Monitor       []MailboxConfig `mapstructure:"monitor"`
+
+	// ProcessBacklogMinutes, if set, processes messages that arrived up
+	// to this many minutes before the monitor started, so that triggers
+	// missed while it was down still fire.
+	ProcessBacklogMinutes int `mapstructure:"process-backlog-minutes"`
+
+	// MaxBodyBytes limits how much of each text part of a message is read
+	// for matching; the rest of the part is ignored. If zero,
+	// DefaultMaxBodyBytes is used.
+	MaxBodyBytes int `mapstructure:"max-body-bytes"`
+
+	// FetchBatchSize is the number of new messages fetched from a mailbox
+	// at a time. The position in the mailbox is saved after each batch, so
+	// that a large backlog is not processed again from the start if the
+	// monitor stops partway through. If zero, DefaultFetchBatchSize is
+	// used.
+	FetchBatchSize int `mapstructure:"fetch-batch-size"`
+
+	// Once checks each mailbox a single time and exits instead of
+	// monitoring continuously.
+	Once bool `mapstructure:"once"`
+
+	// StateFile, if set, is where the last UID seen in each mailbox is
+	// saved, so that the monitor resumes where it left off when it
+	// restarts. It is required when Once is set.
+	StateFile string `mapstructure:"state-file"`
+
+	// AllowedCommands, if set, restricts the commands that triggers may
+	// run. A command is allowed if it is one of the entries or starts
+	// with one of them followed by a space and, if it is run with the
+	// shell, does not contain shell operators. If it is empty, any command
+	// may run.
+	AllowedCommands []string `mapstructure:"allowed-commands"`
 }
 
+// DefaultMaxBodyBytes is the default limit on the size of each text part
+// of a message that is read for matching
+const DefaultMaxBodyBytes = 10 * 1024 * 1024
+
+// DefaultFetchBatchSize is the default number of messages fetched from a
+// mailbox at a time
+const DefaultFetchBatchSize = 50
+
 // NewConfig creates a new Config with default values
 func NewConfig() *Config {
 	defaultCheckInterval := 30
@@ -53,8 +162,10 @@ func NewConfig() *Config {
 			UseSSL:               true,
 			RetryIntervalSeconds: &defaultRetryInterval,
 		},
-		CheckInterval: &defaultCheckInterval,
-		Monitor:       []MailboxConfig{},
+		CheckInterval:  &defaultCheckInterval,
+		Monitor:        []MailboxConfig{},
+		MaxBodyBytes:   DefaultMaxBodyBytes,
+		FetchBatchSize: DefaultFetchBatchSize,
 	}
 }
 
@@ -77,6 +188,15 @@ func (c *Config) AddFlags(fs *pflag.FlagSet) {
 	if c.CheckInterval != nil {
 		fs.IntVar(c.CheckInterval, "check-interval", *c.CheckInterval, "Global interval in seconds to check for new emails")
 	}
+
+	fs.StringVar(&c.MetricsListen, "metrics-listen", c.MetricsListen, "Address (host:port) on which to serve metrics (disabled if empty)")
+	fs.IntVar(&c.ProcessBacklogMinutes, "process-backlog-minutes", c.ProcessBacklogMinutes, "On startup, process messages that arrived within this many minutes")
+	fs.IntVar(&c.MaxBodyBytes, "max-body-bytes", c.MaxBodyBytes, "Maximum number of bytes of each text part of a message to read for matching")
+	fs.IntVar(&c.FetchBatchSize, "fetch-batch-size", c.FetchBatchSize, "Number of new messages to fetch from a mailbox at a time")
+	fs.BoolVar(&c.Once, "once", c.Once, "Check each mailbox once and exit")
+	fs.StringVar(&c.StateFile, "state-file", c.StateFile, "File in which to save the last message seen in each mailbox")
+	fs.StringSliceVar(&c.AllowedCommands, "allowed-commands", c.AllowedCommands, "Commands (or command prefixes) that triggers may run (default: any command)")
+	fs.BoolVar(&c.Strict, "strict", c.Strict, "Fail if the config file contains unknown settings")
 }
 
 // LoadConfig loads configuration using the common config loader.
@@ -93,6 +213,13 @@ func (c *Config) LoadConfig(configFile string) error {
 		"imap.use-ssl":                c.IMAP.UseSSL,
 		"imap.retry-interval-seconds": 30,
 		"check-interval-seconds":      30,
+		"metrics-listen":              "",
+		"process-backlog-minutes":     0,
+		"max-body-bytes":              DefaultMaxBodyBytes,
+		"fetch-batch-size":            DefaultFetchBatchSize,
+		"once":                        false,
+		"state-file":                  "",
+		"allowed-commands":            []string{},
 	})
 
 	return loader.LoadConfig(c)
@@ -108,6 +235,7 @@ func (c *Config) LoadConfigFromStruct() error {
 func (c *Config) LoadConfigWithFlagSet(fs *pflag.FlagSet) error {
 	loader := config.NewConfigLoader()
 	loader.SetConfigFile(c.ConfigFile)
+	loader.SetStrictModeKey("strict")
 
 	// Set default values using the struct defaults
 	loader.SetDefaults(map[string]any{
@@ -118,6 +246,14 @@ func (c *Config) LoadConfigWithFlagSet(fs *pflag.FlagSet) error {
 		"imap.use-ssl":                true,
 		"imap.retry-interval-seconds": 30,
 		"check-interval-seconds":      30,
+		"metrics-listen":              "",
+		"process-backlog-minutes":     0,
+		"max-body-bytes":              DefaultMaxBodyBytes,
+		"fetch-batch-size":            DefaultFetchBatchSize,
+		"once":                        false,
+		"state-file":                  "",
+		"allowed-commands":            []string{},
+		"strict":                      false,
 	})
 
 	return loader.LoadConfigWithFlagSet(c, fs)
@@ -131,6 +267,18 @@ func (c *Config) Validate() error {
 	if c.IMAP.Port <= 0 {
 		return fmt.Errorf("%w: port is %d", ErrInvalidIMAPPort, c.IMAP.Port)
 	}
+	if c.ProcessBacklogMinutes < 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidBacklog, c.ProcessBacklogMinutes)
+	}
+	if c.MaxBodyBytes < 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidMaxBodyBytes, c.MaxBodyBytes)
+	}
+	if c.FetchBatchSize < 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidFetchBatchSize, c.FetchBatchSize)
+	}
+	if c.Once && c.StateFile == "" {
+		return fmt.Errorf("%w: once is set", ErrMissingStateFile)
+	}
 	if len(c.Monitor) == 0 {
 		return fmt.Errorf("%w: no monitor configurations provided", ErrMissingRegexPattern)
 	}
@@ -143,9 +291,26 @@ func (c *Config) Validate() error {
 		}
 		for j, trigger := range mailbox.Triggers {
 			// At least one trigger condition must be specified
-			if trigger.RegexPattern == "" && trigger.To == "" && trigger.From == "" && trigger.Subject == "" {
+			if trigger.RegexPattern == "" && trigger.To == "" && trigger.From == "" && trigger.Subject == "" &&
+				trigger.AttachmentName == "" && trigger.AttachmentType == "" {
 				return fmt.Errorf("%w: no trigger conditions specified in trigger %d of mailbox %s", ErrMissingRegexPattern, j, mailbox.Mailbox)
 			}
+			if err := validateCommandMode(trigger.CommandMode); err != nil {
+				return fmt.Errorf("%w in trigger %d of mailbox %s", err, j, mailbox.Mailbox)
+			}
+			if err := validateCommandEnv(trigger.Env); err != nil {
+				return fmt.Errorf("%w in trigger %d of mailbox %s", err, j, mailbox.Mailbox)
+			}
+			if trigger.CommandMode == CommandModeExec && trigger.Command != "" {
+				if _, err := splitCommand(trigger.Command); err != nil {
+					return fmt.Errorf("%w in trigger %d of mailbox %s", err, j, mailbox.Mailbox)
+				}
+			}
+			if trigger.Notify != nil {
+				if err := trigger.Notify.Validate(); err != nil {
+					return fmt.Errorf("%w in trigger %d of mailbox %s", err, j, mailbox.Mailbox)
+				}
+			}
 		}
 	}
 	return nil
@@ -1,11 +1,15 @@
 package monitor
 
 import (
+	"bytes"
 	_ "embed"
+	"encoding/json"
 	"errors"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/larsks/airdancer/internal/config"
 	"github.com/spf13/pflag"
 )
 
@@ -62,6 +66,14 @@ func TestConfigAddFlags(t *testing.T) {
 		"imap.use-ssl",
 		"imap.retry-interval-seconds",
 		"check-interval",
+		"metrics-listen",
+		"process-backlog-minutes",
+		"max-body-bytes",
+		"fetch-batch-size",
+		"once",
+		"state-file",
+		"allowed-commands",
+		"strict",
 	}
 
 	for _, flagName := range expectedFlags {
@@ -206,6 +218,27 @@ func TestConfigValidate(t *testing.T) {
 			},
 			expectedError: nil,
 		},
+		{
+			name: "valid config with attachment pattern",
+			config: &Config{
+				IMAP: IMAPConfig{
+					Server: "imap.example.com",
+					Port:   993,
+				},
+				Monitor: []MailboxConfig{
+					{
+						Mailbox: "INBOX",
+						Triggers: []TriggerConfig{
+							{
+								AttachmentName: `\.pdf$`,
+								Command:        "echo 'matched'",
+							},
+						},
+					},
+				},
+			},
+			expectedError: nil,
+		},
 		{
 			name: "valid config with ignore-case false",
 			config: &Config{
@@ -259,6 +292,71 @@ func TestConfigValidate(t *testing.T) {
 			},
 			expectedError: ErrMissingRegexPattern,
 		},
+		{
+			name: "once without state file",
+			config: &Config{
+				IMAP: IMAPConfig{
+					Server: "imap.example.com",
+					Port:   993,
+				},
+				Once: true,
+				Monitor: []MailboxConfig{
+					{
+						Mailbox: "INBOX",
+						Triggers: []TriggerConfig{
+							{
+								RegexPattern: ".*",
+							},
+						},
+					},
+				},
+			},
+			expectedError: ErrMissingStateFile,
+		},
+		{
+			name: "invalid command mode",
+			config: &Config{
+				IMAP: IMAPConfig{
+					Server: "imap.example.com",
+					Port:   993,
+				},
+				Monitor: []MailboxConfig{
+					{
+						Mailbox: "INBOX",
+						Triggers: []TriggerConfig{
+							{
+								RegexPattern: ".*",
+								Command:      "echo 'matched'",
+								CommandMode:  "bash",
+							},
+						},
+					},
+				},
+			},
+			expectedError: ErrInvalidCommandMode,
+		},
+		{
+			name: "unterminated quote in exec command",
+			config: &Config{
+				IMAP: IMAPConfig{
+					Server: "imap.example.com",
+					Port:   993,
+				},
+				Monitor: []MailboxConfig{
+					{
+						Mailbox: "INBOX",
+						Triggers: []TriggerConfig{
+							{
+								RegexPattern: ".*",
+								Command:      "echo 'matched",
+								CommandMode:  CommandModeExec,
+							},
+						},
+					},
+				},
+			},
+			expectedError: ErrInvalidCommand,
+		},
 	}
 
 	for _, tt := range tests {
@@ -365,6 +463,42 @@ func TestConfigLoadConfigFromStruct(t *testing.T) {
 	}
 }
 
+func TestConfigDumpRedactsPassword(t *testing.T) {
+	configFile := t.TempDir() + "/monitor.toml"
+	if err := os.WriteFile(configFile, []byte(testConfigContent), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.ConfigFile = configFile
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	cfg.AddFlags(fs)
+	if err := cfg.LoadConfigWithFlagSet(fs); err != nil {
+		t.Fatalf("LoadConfigWithFlagSet() failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := config.Dump(&buf, cfg); err != nil {
+		t.Fatalf("Dump() failed: %v", err)
+	}
+	if strings.Contains(buf.String(), cfg.IMAP.Password) {
+		t.Errorf("Dump() output contains the IMAP password:\n%s", buf.String())
+	}
+
+	var dumped struct {
+		IMAP map[string]any `json:"imap"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &dumped); err != nil {
+		t.Fatalf("Dump() output is not valid JSON: %v", err)
+	}
+	if dumped.IMAP["password"] != config.RedactedValue {
+		t.Errorf("dumped imap.password = %v, want %q", dumped.IMAP["password"], config.RedactedValue)
+	}
+	if dumped.IMAP["username"] != "testuser" || dumped.IMAP["port"] != float64(143) {
+		t.Errorf("dumped imap = %v, want username testuser and port 143", dumped.IMAP)
+	}
+}
+
 func TestConfigLoadConfigFromStructWithInvalidFile(t *testing.T) {
 	config := NewConfig()
 	config.ConfigFile = "/nonexistent/config.toml"
@@ -4,17 +4,28 @@ import "errors"
 
 var (
 	// Configuration errors
-	ErrMissingIMAPServer   = errors.New("IMAP server must be set")
-	ErrInvalidIMAPPort     = errors.New("IMAP port must be non-zero")
-	ErrMissingRegexPattern = errors.New("regex pattern must be set")
-	ErrInvalidRegexPattern = errors.New("invalid regex pattern")
+	ErrMissingIMAPServer     = errors.New("IMAP server must be set")
+	ErrInvalidIMAPPort       = errors.New("IMAP port must be non-zero")
+	ErrMissingRegexPattern   = errors.New("regex pattern must be set")
+	ErrInvalidRegexPattern   = errors.New("invalid regex pattern")
+	ErrInvalidBacklog        = errors.New("process-backlog-minutes cannot be negative")
+	ErrInvalidNotifier       = errors.New("invalid notifier")
+	ErrInvalidMaxBodyBytes   = errors.New("max-body-bytes cannot be negative")
+	ErrInvalidFetchBatchSize = errors.New("fetch-batch-size cannot be negative")
+	ErrMissingStateFile      = errors.New("state-file must be set")
+	ErrInvalidCommandMode    = errors.New("invalid command-mode")
+	ErrInvalidCommand        = errors.New("invalid command")
+	ErrInvalidCommandEnv     = errors.New("env entries must be NAME=value")
 
 	// Connection errors
 	ErrConnectionFailed     = errors.New("failed to connect to IMAP server")
 	ErrAuthenticationFailed = errors.New("IMAP authentication failed")
 	ErrMailboxNotFound      = errors.New("mailbox not found")
+	ErrUIDValidityChanged   = errors.New("UIDVALIDITY changed")
 
 	// Message processing errors
-	ErrMessageProcessing = errors.New("error processing message")
-	ErrCommandExecution  = errors.New("error executing command")
+	ErrMessageProcessing  = errors.New("error processing message")
+	ErrCommandExecution   = errors.New("error executing command")
+	ErrCommandNotAllowed  = errors.New("command is not in allowed-commands")
+	ErrNotificationFailed = errors.New("error sending notification")
 )
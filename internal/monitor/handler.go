@@ -39,6 +39,10 @@ func (h *MonitorHandler) Start(config cli.Configurable) error {
 		return fmt.Errorf("failed to create monitor: %w", err)
 	}
 
+	if cfg.Once {
+		return emailMonitor.RunOnce()
+	}
+
 	// Start monitoring (this blocks)
 	emailMonitor.Start()
 
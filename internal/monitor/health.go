@@ -0,0 +1,69 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// staleCheckIntervals is how many check intervals may pass without a
+// successful check of a mailbox before the monitor is considered unhealthy.
+const staleCheckIntervals = 3
+
+// healthResponse is returned by the /healthz endpoint
+type healthResponse struct {
+	Status    string               `json:"status"`
+	Connected bool                 `json:"connected"`
+	LastCheck map[string]time.Time `json:"lastCheck"`
+	Stale     []string             `json:"stale,omitempty"`
+}
+
+// health reports whether the monitor is connected and every mailbox has been
+// checked recently. A mailbox that has not been checked yet is measured from
+// the time the connection was established.
+func (em *EmailMonitor) health(now time.Time) healthResponse {
+	m := em.metrics
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	resp := healthResponse{
+		Status:    "ok",
+		Connected: m.connected,
+		LastCheck: make(map[string]time.Time, len(m.lastCheck)),
+	}
+	for mailbox, when := range m.lastCheck {
+		resp.LastCheck[mailbox] = when
+	}
+
+	if !m.connected {
+		resp.Status = "disconnected"
+		return resp
+	}
+
+	for _, mailbox := range em.mailboxes {
+		last := m.lastCheck[mailbox.mailbox]
+		if last.Before(m.connectedSince) {
+			last = m.connectedSince
+		}
+		maxAge := time.Duration(staleCheckIntervals*mailbox.checkInterval) * time.Second
+		if now.Sub(last) > maxAge {
+			resp.Stale = append(resp.Stale, mailbox.mailbox)
+		}
+	}
+	if len(resp.Stale) > 0 {
+		resp.Status = "stale"
+	}
+
+	return resp
+}
+
+// handleHealth returns 200 when the monitor is healthy and 503 otherwise
+func (em *EmailMonitor) handleHealth(w http.ResponseWriter, r *http.Request) {
+	resp := em.health(time.Now())
+
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp) //nolint:errcheck
+}
@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthEndpoint(t *testing.T) {
+	monitor, err := NewEmailMonitor(newMetricsTestConfig(), &MockIMAPDialer{}, &MockCommandExecutor{}, &MockLogger{}, &MockTimer{})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	healthStatus := func() int {
+		req := httptest.NewRequest("GET", "/healthz", nil)
+		w := httptest.NewRecorder()
+		monitor.metricsHandler().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := healthStatus(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d before connecting, got %d", http.StatusServiceUnavailable, code)
+	}
+
+	monitor.metrics.setConnected(true)
+	if code := healthStatus(); code != http.StatusOK {
+		t.Errorf("Expected status %d when connected, got %d", http.StatusOK, code)
+	}
+
+	monitor.metrics.setConnected(false)
+	if code := healthStatus(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d after disconnecting, got %d", http.StatusServiceUnavailable, code)
+	}
+}
+
+func TestHealthStaleMailbox(t *testing.T) {
+	monitor, err := NewEmailMonitor(newMetricsTestConfig(), &MockIMAPDialer{}, &MockCommandExecutor{}, &MockLogger{}, &MockTimer{})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	monitor.metrics.setConnected(true)
+
+	interval := time.Duration(monitor.mailboxes[0].checkInterval) * time.Second
+	now := time.Now()
+
+	// Connected recently but not checked yet
+	if resp := monitor.health(now); resp.Status != "ok" {
+		t.Errorf("Expected status ok right after connecting, got %s", resp.Status)
+	}
+
+	// Checked recently
+	monitor.metrics.checkSucceeded("INBOX", now.Add(staleCheckIntervals*interval))
+	if resp := monitor.health(now.Add(staleCheckIntervals*interval + interval)); resp.Status != "ok" {
+		t.Errorf("Expected status ok after a recent check, got %s", resp.Status)
+	}
+
+	// No successful check for too long
+	resp := monitor.health(now.Add(3 * staleCheckIntervals * interval))
+	if resp.Status != "stale" || len(resp.Stale) != 1 || resp.Stale[0] != "INBOX" {
+		t.Errorf("Expected INBOX to be stale, got %+v", resp)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"io"
 	"log"
 	"os/exec"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/emersion/go-imap"
@@ -30,9 +32,11 @@ type IMAPDialer interface {
 	Dial(addr string) (IMAPClient, error)
 }
 
-// CommandExecutor interface abstracts command execution for testing
+// CommandExecutor interface abstracts command execution for testing. args
+// holds the program to run followed by its arguments; dir is the directory
+// to run it in, or empty for the current directory.
 type CommandExecutor interface {
-	Execute(command string, env []string, stdin io.Reader) error
+	Execute(args []string, dir string, env []string, stdin io.Reader) error
 }
 
 // Logger interface abstracts logging for testing
@@ -81,13 +85,19 @@ func (r *RealIMAPClient) Close() error {
 	return r.Client.Close()
 }
 
-// RealCommandExecutor implements CommandExecutor using os/exec
-type RealCommandExecutor struct{}
+// RealCommandExecutor implements CommandExecutor using os/exec. Commands
+// run in the background; Wait waits for those that have been started to
+// finish.
+type RealCommandExecutor struct {
+	running sync.WaitGroup
+}
 
-func (r *RealCommandExecutor) Execute(command string, env []string, stdin io.Reader) error {
+func (r *RealCommandExecutor) Execute(args []string, dir string, env []string, stdin io.Reader) error {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
-	cmd := exec.Command("sh", "-c", command)
+	command := strings.Join(args, " ")
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
 	cmd.Env = env
 	cmd.Stdin = stdin
 	cmd.Stdout = &stdout
@@ -97,7 +107,9 @@ func (r *RealCommandExecutor) Execute(command string, env []string, stdin io.Rea
 		return fmt.Errorf("%w \"%s\": %v", ErrCommandExecution, command, err)
 	}
 
+	r.running.Add(1)
 	go func() {
+		defer r.running.Done()
 		if err := cmd.Wait(); err != nil {
 			log.Printf("command execution failed: %v, stdout: %s, stderr: %s", err, stdout.String(), stderr.String())
 		} else {
@@ -108,6 +120,11 @@ func (r *RealCommandExecutor) Execute(command string, env []string, stdin io.Rea
 	return nil
 }
 
+// Wait waits for the commands started by Execute to finish
+func (r *RealCommandExecutor) Wait() {
+	r.running.Wait()
+}
+
 // RealLogger implements Logger using the standard log package
 type RealLogger struct{}
 
@@ -0,0 +1,156 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/larsks/airdancer/internal/httpserver"
+)
+
+// monitorMetrics tracks activity counters for the monitor. The counters are
+// exposed in the Prometheus text exposition format.
+type monitorMetrics struct {
+	mutex             sync.Mutex
+	connected         bool
+	connectedSince    time.Time
+	messagesProcessed map[string]uint64
+	triggersFired     map[string]uint64
+	lastCheck         map[string]time.Time
+}
+
+func newMonitorMetrics() *monitorMetrics {
+	return &monitorMetrics{
+		messagesProcessed: make(map[string]uint64),
+		triggersFired:     make(map[string]uint64),
+		lastCheck:         make(map[string]time.Time),
+	}
+}
+
+func (m *monitorMetrics) setConnected(connected bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if connected && !m.connected {
+		m.connectedSince = time.Now()
+	}
+	m.connected = connected
+}
+
+func (m *monitorMetrics) messageProcessed(mailbox string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.messagesProcessed[mailbox]++
+}
+
+func (m *monitorMetrics) triggerFired(mailbox string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.triggersFired[mailbox]++
+}
+
+func (m *monitorMetrics) checkSucceeded(mailbox string, when time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lastCheck[mailbox] = when
+}
+
+// ServeHTTP writes the current metrics
+func (m *monitorMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.writeTo(w) //nolint:errcheck
+}
+
+func (m *monitorMetrics) writeTo(w io.Writer) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	connected := 0
+	if m.connected {
+		connected = 1
+	}
+
+	if _, err := fmt.Fprintf(w, "# HELP airdancer_monitor_connected Whether the monitor is connected to the IMAP server.\n"+
+		"# TYPE airdancer_monitor_connected gauge\n"+
+		"airdancer_monitor_connected %d\n", connected); err != nil {
+		return err
+	}
+
+	if err := writeMailboxCounter(w, "airdancer_monitor_messages_processed_total",
+		"Number of messages processed.", m.messagesProcessed); err != nil {
+		return err
+	}
+	if err := writeMailboxCounter(w, "airdancer_monitor_triggers_fired_total",
+		"Number of triggers that matched a message.", m.triggersFired); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "# HELP airdancer_monitor_last_check_timestamp_seconds Time of the last successful check of the mailbox.\n"+
+		"# TYPE airdancer_monitor_last_check_timestamp_seconds gauge\n"); err != nil {
+		return err
+	}
+	for _, mailbox := range sortedKeys(m.lastCheck) {
+		ts := float64(m.lastCheck[mailbox].UnixNano()) / float64(time.Second)
+		if _, err := fmt.Fprintf(w, "airdancer_monitor_last_check_timestamp_seconds{mailbox=%q} %.3f\n", mailbox, ts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeMailboxCounter(w io.Writer, name, help string, values map[string]uint64) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name); err != nil {
+		return err
+	}
+	for _, mailbox := range sortedKeys(values) {
+		if _, err := fmt.Fprintf(w, "%s{mailbox=%q} %d\n", name, mailbox, values[mailbox]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// metricsHandler returns the handler for the metrics and health listener
+func (em *EmailMonitor) metricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", em.metrics)
+	mux.HandleFunc("/healthz", em.handleHealth)
+	return mux
+}
+
+// startMetricsServer starts serving metrics and health checks on the
+// configured address. The server runs until the monitor is stopped.
+func (em *EmailMonitor) startMetricsServer() error {
+	listeners, err := httpserver.Listen([]string{em.config.MetricsListen})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-em.stopCh
+		cancel()
+	}()
+
+	srv := &http.Server{Handler: em.metricsHandler()}
+	go func() {
+		if err := httpserver.Serve(ctx, srv, listeners); err != nil {
+			em.logger.Printf("metrics server failed: %v", err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+func newMetricsTestConfig() Config {
+	return Config{
+		IMAP: IMAPConfig{
+			Server: "imap.example.com",
+			Port:   993,
+		},
+		Monitor: []MailboxConfig{
+			{
+				Mailbox: "INBOX",
+				Triggers: []TriggerConfig{
+					{
+						RegexPattern: "pattern",
+						Command:      "echo 'matched'",
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestMetricsTriggerCounter(t *testing.T) {
+	monitor, err := NewEmailMonitor(newMetricsTestConfig(), &MockIMAPDialer{}, &MockCommandExecutor{}, &MockLogger{}, &MockTimer{})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	messages := []string{testEmailWithPattern, testEmailWithoutMatch}
+	for _, content := range messages {
+		msg := &imap.Message{
+			Envelope: &imap.Envelope{Subject: "Test Subject"},
+			Body: map[*imap.BodySectionName]imap.Literal{
+				{}: &MockLiteral{content: content},
+			},
+		}
+		if err := monitor.processMessageInMailbox(msg, monitor.mailboxes[0]); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	if got := monitor.metrics.triggersFired["INBOX"]; got != 1 {
+		t.Errorf("Expected 1 trigger fired, got %d", got)
+	}
+	if got := monitor.metrics.messagesProcessed["INBOX"]; got != 2 {
+		t.Errorf("Expected 2 messages processed, got %d", got)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	monitor, err := NewEmailMonitor(newMetricsTestConfig(), &MockIMAPDialer{}, &MockCommandExecutor{}, &MockLogger{}, &MockTimer{})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	mockClient := &MockIMAPClient{mailboxStatus: &imap.MailboxStatus{Messages: 0}}
+	monitor.client = mockClient
+	monitor.metrics.setConnected(true)
+	monitor.metrics.triggerFired("INBOX")
+	if err := monitor.checkForNewMessagesInMailbox(compiledMailbox{mailbox: "INBOX"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	monitor.metricsHandler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"airdancer_monitor_connected 1\n",
+		`airdancer_monitor_triggers_fired_total{mailbox="INBOX"} 1` + "\n",
+		"# TYPE airdancer_monitor_messages_processed_total counter\n",
+		`airdancer_monitor_last_check_timestamp_seconds{mailbox="INBOX"} `,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics output to contain %q, got:\n%s", want, body)
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package monitor
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/emersion/go-imap"
@@ -20,13 +23,59 @@ type compiledTrigger struct {
 	subjectRegex *regexp.Regexp
 	final        bool
 	command      string
+
+	attachmentNameRegex *regexp.Regexp
+	attachmentTypeRegex *regexp.Regexp
+	saveAttachment      bool
+
+	// notifier acts on messages that match; by default it runs command
+	notifier Notifier
+}
+
+// hasAttachmentConditions returns true if the trigger matches on attachments
+func (t *compiledTrigger) hasAttachmentConditions() bool {
+	return t.attachmentNameRegex != nil || t.attachmentTypeRegex != nil
+}
+
+// matchAttachment returns the first attachment that satisfies the trigger's
+// attachment conditions, or nil if there is none
+func (t *compiledTrigger) matchAttachment(attachments []attachment) *attachment {
+	for i := range attachments {
+		a := &attachments[i]
+		if t.attachmentNameRegex != nil && !t.attachmentNameRegex.MatchString(a.filename) {
+			continue
+		}
+		if t.attachmentTypeRegex != nil && !t.attachmentTypeRegex.MatchString(a.contentType) {
+			continue
+		}
+		return a
+	}
+	return nil
+}
+
+// attachment holds an attachment extracted from a message
+type attachment struct {
+	filename    string
+	contentType string
+	content     []byte
+}
+
+// messageContent holds the parts of a message that triggers match against
+type messageContent struct {
+	body        string
+	attachments []attachment
 }
 
 // compiledMailbox holds a compiled mailbox configuration
 type compiledMailbox struct {
-	mailbox       string
-	checkInterval int
-	triggers      []compiledTrigger
+	mailbox string
+	// account identifies the IMAP account the mailbox belongs to, as
+	// username@server
+	account          string
+	checkInterval    int
+	searchUnseenOnly bool
+	searchFrom       string
+	triggers         []compiledTrigger
 }
 
 // EmailMonitor handles monitoring multiple IMAP mailboxes for new emails
@@ -36,12 +85,21 @@ type EmailMonitor struct {
 	mailboxes   []compiledMailbox
 	lastUIDs    map[string]uint32
 	reconnectCh chan bool
+	metrics     *monitorMetrics
+
+	// uidValidity records the UIDVALIDITY of each mailbox when it was
+	// initialized, and savedState the content of the state file. They,
+	// and lastUIDs, are protected by stateMutex.
+	uidValidity map[string]uint32
+	savedState  map[string]mailboxState
+	stateMutex  sync.Mutex
 
 	// Injected dependencies for testability
 	dialer   IMAPDialer
 	executor CommandExecutor
 	logger   Logger
 	timer    Timer
+	now      func() time.Time
 
 	// Control channels for testing
 	stopCh chan struct{}
@@ -53,6 +111,21 @@ func NewEmailMonitor(config Config, dialer IMAPDialer, executor CommandExecutor,
 		return nil, err
 	}
 
+	monitor := &EmailMonitor{
+		config:      config,
+		lastUIDs:    make(map[string]uint32),
+		reconnectCh: make(chan bool, 1),
+		uidValidity: make(map[string]uint32),
+		savedState:  make(map[string]mailboxState),
+		metrics:     newMonitorMetrics(),
+		dialer:      dialer,
+		executor:    executor,
+		logger:      logger,
+		timer:       timer,
+		now:         time.Now,
+		stopCh:      make(chan struct{}),
+	}
+
 	var mailboxes []compiledMailbox
 	for _, mailboxConfig := range config.Monitor {
 		var triggers []compiledTrigger
@@ -95,38 +168,66 @@ func NewEmailMonitor(config Config, dialer IMAPDialer, executor CommandExecutor,
 				return nil, fmt.Errorf("invalid 'subject' pattern \"%s\" in trigger %d of mailbox %s: %v", triggerConfig.Subject, j, mailboxConfig.Mailbox, err)
 			}
 
+			attachmentNameRegex, err := compileRegex(triggerConfig.AttachmentName)
+			if err != nil {
+				return nil, fmt.Errorf("invalid 'match-attachment-name' pattern \"%s\" in trigger %d of mailbox %s: %v", triggerConfig.AttachmentName, j, mailboxConfig.Mailbox, err)
+			}
+
+			attachmentTypeRegex, err := compileRegex(triggerConfig.AttachmentType)
+			if err != nil {
+				return nil, fmt.Errorf("invalid 'match-attachment-type' pattern \"%s\" in trigger %d of mailbox %s: %v", triggerConfig.AttachmentType, j, mailboxConfig.Mailbox, err)
+			}
+
+			notifier, err := monitor.newNotifier(triggerConfig)
+			if err != nil {
+				return nil, fmt.Errorf("invalid notify in trigger %d of mailbox %s: %w", j, mailboxConfig.Mailbox, err)
+			}
+
 			triggers = append(triggers, compiledTrigger{
-				bodyRegex:    bodyRegex,
-				toRegex:      toRegex,
-				fromRegex:    fromRegex,
-				subjectRegex: subjectRegex,
-				final:        triggerConfig.Final,
-				command:      triggerConfig.Command,
+				bodyRegex:           bodyRegex,
+				toRegex:             toRegex,
+				fromRegex:           fromRegex,
+				subjectRegex:        subjectRegex,
+				final:               triggerConfig.Final,
+				command:             triggerConfig.Command,
+				attachmentNameRegex: attachmentNameRegex,
+				attachmentTypeRegex: attachmentTypeRegex,
+				saveAttachment:      triggerConfig.SaveAttachment,
+				notifier:            notifier,
 			})
 		}
 
 		mailboxes = append(mailboxes, compiledMailbox{
-			mailbox:       mailboxConfig.Mailbox,
-			checkInterval: config.GetEffectiveCheckInterval(&mailboxConfig),
-			triggers:      triggers,
+			mailbox:          mailboxConfig.Mailbox,
+			account:          fmt.Sprintf("%s@%s", config.IMAP.Username, config.IMAP.Server),
+			checkInterval:    config.GetEffectiveCheckInterval(&mailboxConfig),
+			searchUnseenOnly: mailboxConfig.SearchUnseenOnly,
+			searchFrom:       mailboxConfig.SearchFrom,
+			triggers:         triggers,
 		})
 	}
 
-	monitor := &EmailMonitor{
-		config:      config,
-		mailboxes:   mailboxes,
-		lastUIDs:    make(map[string]uint32),
-		reconnectCh: make(chan bool, 1),
-		dialer:      dialer,
-		executor:    executor,
-		logger:      logger,
-		timer:       timer,
-		stopCh:      make(chan struct{}),
+	monitor.mailboxes = mailboxes
+
+	if len(config.AllowedCommands) == 0 && monitor.runsCommands() {
+		logger.Println("warning: allowed-commands is not set, so triggers can run any command")
 	}
 
 	return monitor, nil
 }
 
+// runsCommands returns true if any trigger runs a command
+func (em *EmailMonitor) runsCommands() bool {
+	for _, mailbox := range em.mailboxes {
+		for _, trigger := range mailbox.triggers {
+			if notifier, ok := trigger.notifier.(*commandNotifier); ok && notifier.command != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // NewEmailMonitorWithDefaults creates a new EmailMonitor with default (real) implementations
 func NewEmailMonitorWithDefaults(config Config) (*EmailMonitor, error) {
 	return NewEmailMonitor(
@@ -142,6 +243,16 @@ func NewEmailMonitorWithDefaults(config Config) (*EmailMonitor, error) {
 func (em *EmailMonitor) Start() {
 	em.logger.Println("starting email monitor...")
 
+	if em.config.MetricsListen != "" {
+		if err := em.startMetricsServer(); err != nil {
+			em.logger.Printf("failed to start metrics server: %v", err)
+		}
+	}
+
+	if err := em.loadState(); err != nil {
+		em.logger.Printf("failed to load state: %v", err)
+	}
+
 	for {
 		select {
 		case <-em.stopCh:
@@ -172,6 +283,7 @@ func (em *EmailMonitor) Start() {
 			em.disconnect()
 			continue
 		}
+		em.persistState()
 
 		// Start monitoring all mailboxes
 		err = em.monitorAllMailboxes()
@@ -195,6 +307,53 @@ func (em *EmailMonitor) Stop() {
 	em.disconnect()
 }
 
+// RunOnce connects to the IMAP server, checks each configured mailbox a
+// single time, and returns, so that the monitor can be run periodically
+// (for example, from cron) instead of as a daemon. The last UID seen in each
+// mailbox is loaded from and saved to the state file so that successive runs
+// do not process the same messages again. A mailbox that is not in the state
+// file, or whose UIDVALIDITY has changed, is initialized as it would be when
+// the monitor starts, without processing existing messages (other than the
+// backlog, if process-backlog-minutes is set).
+func (em *EmailMonitor) RunOnce() error {
+	if err := em.loadState(); err != nil {
+		return err
+	}
+
+	if err := em.connect(); err != nil {
+		return err
+	}
+	defer em.disconnect()
+
+	var errs []error
+	for _, mailbox := range em.mailboxes {
+		uid, err := em.initializeLastUIDForMailbox(mailbox.mailbox)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		em.setLastUID(mailbox.mailbox, uid)
+
+		if err := em.checkForNewMessagesInMailbox(mailbox); err != nil {
+			errs = append(errs, fmt.Errorf("failed to check %s: %w", mailbox.mailbox, err))
+		}
+	}
+
+	// Save the progress made in the mailboxes that were checked even if
+	// others failed
+	if err := em.saveState(); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Commands run in the background; let them finish before the process
+	// exits
+	if w, ok := em.executor.(interface{ Wait() }); ok {
+		w.Wait()
+	}
+
+	return errors.Join(errs...)
+}
+
 // connect establishes a connection to the IMAP server
 func (em *EmailMonitor) connect() error {
 	var c IMAPClient
@@ -219,6 +378,7 @@ func (em *EmailMonitor) connect() error {
 	}
 
 	em.client = c
+	em.metrics.setConnected(true)
 	return nil
 }
 
@@ -228,6 +388,7 @@ func (em *EmailMonitor) disconnect() {
 		em.client.Close() //nolint:errcheck
 		em.client = nil
 	}
+	em.metrics.setConnected(false)
 }
 
 // initializeLastUIDs gets the UID of the most recent message in each mailbox to track new emails
@@ -237,18 +398,26 @@ func (em *EmailMonitor) initializeLastUIDs() error {
 		if err != nil {
 			return err
 		}
-		em.lastUIDs[mailbox.mailbox] = uid
+		em.setLastUID(mailbox.mailbox, uid)
 	}
 	return nil
 }
 
-// initializeLastUIDForMailbox gets the UID of the most recent message in a specific mailbox
+// initializeLastUIDForMailbox gets the UID of the most recent message in a
+// specific mailbox, or the UID saved in the state file if there is one and
+// the UIDVALIDITY of the mailbox has not changed
 func (em *EmailMonitor) initializeLastUIDForMailbox(mailboxName string) (uint32, error) {
 	em.logger.Printf("selecting mailbox %s", mailboxName)
 	mbox, err := em.client.Select(mailboxName, false)
 	if err != nil {
 		return 0, fmt.Errorf("%w \"%s\": %v", ErrMailboxNotFound, mailboxName, err)
 	}
+	em.setUIDValidity(mailboxName, mbox.UidValidity)
+
+	if lastUID, ok := em.savedLastUID(mailboxName, mbox.UidValidity); ok {
+		em.logger.Printf("resuming mailbox %s from saved last UID: %d", mailboxName, lastUID)
+		return lastUID, nil
+	}
 
 	// If the mailbox is empty, there's no UID
 	if mbox.Messages == 0 {
@@ -256,6 +425,20 @@ func (em *EmailMonitor) initializeLastUIDForMailbox(mailboxName string) (uint32,
 		return 0, nil
 	}
 
+	// The backlog is only processed when the monitor starts, not when it
+	// reconnects
+	if _, initialized := em.lastUID(mailboxName); !initialized && em.config.ProcessBacklogMinutes > 0 {
+		since := em.now().Add(-time.Duration(em.config.ProcessBacklogMinutes) * time.Minute)
+		lastUID, found, err := em.backlogLastUID(since)
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			em.logger.Printf("initialized mailbox %s with last UID: %d to process messages since %s", mailboxName, lastUID, since.Format(time.RFC3339))
+			return lastUID, nil
+		}
+	}
+
 	// Search for all messages to get the sequence numbers
 	criteria := imap.NewSearchCriteria()
 	criteria.SeqNum = new(imap.SeqSet)
@@ -291,6 +474,49 @@ func (em *EmailMonitor) initializeLastUIDForMailbox(mailboxName string) (uint32,
 	return lastUID, nil
 }
 
+// backlogLastUID returns a last UID for the selected mailbox that causes the
+// messages that arrived at or after since to be processed. found is false
+// if there are no such messages.
+func (em *EmailMonitor) backlogLastUID(since time.Time) (lastUID uint32, found bool, err error) {
+	criteria := imap.NewSearchCriteria()
+	criteria.Since = since
+	uids, err := em.client.UidSearch(criteria)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(uids) == 0 {
+		return 0, false, nil
+	}
+
+	// SINCE only compares dates, so check the time each message arrived
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+
+	messages := make(chan *imap.Message, len(uids))
+	done := make(chan error, 1)
+	go func() {
+		done <- em.client.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, imap.FetchInternalDate}, messages)
+	}()
+
+	var firstUID uint32
+	for msg := range messages {
+		if msg.InternalDate.Before(since) {
+			continue
+		}
+		if firstUID == 0 || msg.Uid < firstUID {
+			firstUID = msg.Uid
+		}
+	}
+
+	if err := <-done; err != nil {
+		return 0, false, err
+	}
+	if firstUID == 0 {
+		return 0, false, nil
+	}
+	return firstUID - 1, true, nil
+}
+
 // monitorAllMailboxes coordinates monitoring of all configured mailboxes
 func (em *EmailMonitor) monitorAllMailboxes() error {
 	// Group mailboxes by their check interval to optimize monitoring
@@ -335,14 +561,20 @@ func (em *EmailMonitor) monitorMailboxGroup(checkInterval int, mailboxes []compi
 				if err != nil {
 					return err
 				}
+				em.persistState()
 			}
 		}
 	}
 }
 
 // checkForNewMessagesInMailbox looks for new messages in a specific mailbox and processes them
-func (em *EmailMonitor) checkForNewMessagesInMailbox(mailbox compiledMailbox) error {
+func (em *EmailMonitor) checkForNewMessagesInMailbox(mailbox compiledMailbox) (err error) {
 	mailboxName := mailbox.mailbox
+	defer func() {
+		if err == nil {
+			em.metrics.checkSucceeded(mailboxName, time.Now())
+		}
+	}()
 	em.logger.Printf("checking for new messages in %s", mailboxName)
 
 	mbox, err := em.client.Select(mailboxName, false)
@@ -350,13 +582,19 @@ func (em *EmailMonitor) checkForNewMessagesInMailbox(mailbox compiledMailbox) er
 		return err
 	}
 
+	// UIDs from before a change of UIDVALIDITY do not refer to the same
+	// messages; reconnecting initializes the mailbox again
+	if uidValidity, known := em.knownUIDValidity(mailboxName); known && uidValidity != mbox.UidValidity {
+		return fmt.Errorf("%w in %s: was %d, now %d", ErrUIDValidityChanged, mailboxName, uidValidity, mbox.UidValidity)
+	}
+
 	// If no messages in mailbox, nothing to do
 	if mbox.Messages == 0 {
 		em.logger.Printf("no messages in %s", mailboxName)
 		return nil
 	}
 
-	lastUID := em.lastUIDs[mailboxName]
+	lastUID, _ := em.lastUID(mailboxName)
 
 	// Search for messages with UID greater than lastUID
 	criteria := imap.NewSearchCriteria()
@@ -370,6 +608,14 @@ func (em *EmailMonitor) checkForNewMessagesInMailbox(mailbox compiledMailbox) er
 		criteria.Uid.AddRange(1, 0)
 	}
 
+	// Apply any per-mailbox filters
+	if mailbox.searchUnseenOnly {
+		criteria.WithoutFlags = append(criteria.WithoutFlags, imap.SeenFlag)
+	}
+	if mailbox.searchFrom != "" {
+		criteria.Header.Add("From", mailbox.searchFrom)
+	}
+
 	uids, err := em.client.UidSearch(criteria)
 	if err != nil {
 		return err
@@ -390,9 +636,41 @@ func (em *EmailMonitor) checkForNewMessagesInMailbox(mailbox compiledMailbox) er
 
 	em.logger.Printf("found %d new messages in %s (UIDs: %v)", len(newUIDs), mailboxName, newUIDs)
 
-	// Fetch new messages
+	batchSize := em.config.FetchBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultFetchBatchSize
+	}
+
+	var processedUIDs []uint32
+	for start := 0; start < len(newUIDs); start += batchSize {
+		batch := newUIDs[start:min(start+batchSize, len(newUIDs))]
+		processed, err := em.fetchAndProcessMessages(mailbox, batch)
+		processedUIDs = append(processedUIDs, processed...)
+		if err != nil {
+			return err
+		}
+
+		// Save the position after each batch but the last, which the
+		// caller saves, so that a restart partway through a large
+		// backlog does not process it again from the start
+		if start+batchSize < len(newUIDs) {
+			em.persistState()
+		}
+	}
+
+	newLastUID, _ := em.lastUID(mailboxName)
+	em.logger.Printf("processed messages in %s with UIDs: %v, new lastUID: %d", mailboxName, processedUIDs, newLastUID)
+	return nil
+}
+
+// fetchAndProcessMessages fetches the messages with the given UIDs from
+// mailbox, which must be selected, and processes each as it arrives. It
+// returns the UIDs of the messages that were processed.
+func (em *EmailMonitor) fetchAndProcessMessages(mailbox compiledMailbox, uids []uint32) ([]uint32, error) {
+	mailboxName := mailbox.mailbox
+
 	seqset := new(imap.SeqSet)
-	for _, uid := range newUIDs {
+	for _, uid := range uids {
 		seqset.AddNum(uid)
 	}
 
@@ -411,17 +689,12 @@ func (em *EmailMonitor) checkForNewMessagesInMailbox(mailbox compiledMailbox) er
 		}
 
 		processedUIDs = append(processedUIDs, msg.Uid)
-		if msg.Uid > lastUID {
-			em.lastUIDs[mailboxName] = msg.Uid
+		if lastUID, _ := em.lastUID(mailboxName); msg.Uid > lastUID {
+			em.setLastUID(mailboxName, msg.Uid)
 		}
 	}
 
-	if err := <-done; err != nil {
-		return err
-	}
-
-	em.logger.Printf("processed messages in %s with UIDs: %v, new lastUID: %d", mailboxName, processedUIDs, em.lastUIDs[mailboxName])
-	return nil
+	return processedUIDs, <-done
 }
 
 // processMessageInMailbox processes a single email message using the triggers for a specific mailbox
@@ -443,20 +716,22 @@ func (em *EmailMonitor) processMessageInMailbox(msg *imap.Message, mailbox compi
 	}
 
 	em.logger.Printf("processing message from: %s, To: %v, Subject: %s in mailbox: %s", from, toAddresses, msg.Envelope.Subject, mailbox.mailbox)
+	em.metrics.messageProcessed(mailbox.mailbox)
 
-	// Get message body once
-	var body string
+	// Get message body and attachments once
+	var content messageContent
 	for _, part := range msg.Body {
-		extractedBody, err := em.extractTextFromPart(part)
+		extracted, err := em.extractContentFromPart(part)
 		if err != nil {
 			em.logger.Printf("error extracting text: %v", err)
 			continue
 		}
-		if extractedBody != "" {
-			body = extractedBody
+		if extracted.body != "" || len(extracted.attachments) > 0 {
+			content = extracted
 			break
 		}
 	}
+	body := content.body
 
 	// Check triggers
 	for i, trigger := range mailbox.triggers {
@@ -497,12 +772,48 @@ func (em *EmailMonitor) processMessageInMailbox(msg *imap.Message, mailbox compi
 			}
 		}
 
+		// Check attachments (all conditions must match the same attachment)
+		var matchedAttachment *attachment
+		if matched && trigger.hasAttachmentConditions() {
+			matchedAttachment = trigger.matchAttachment(content.attachments)
+			if matchedAttachment == nil {
+				matched = false
+			}
+		}
+
 		if matched {
 			em.logger.Printf("trigger match found in message from: %s (trigger %d in mailbox %s)", from, i, mailbox.mailbox)
+			em.metrics.triggerFired(mailbox.mailbox)
 
-			err := em.executeCommand(msg, body, trigger.command)
-			if err != nil {
-				return fmt.Errorf("%w: %v", ErrCommandExecution, err)
+			var extraEnv []string
+			if matchedAttachment != nil {
+				var err error
+				extraEnv, err = em.attachmentEnv(matchedAttachment, trigger.saveAttachment)
+				if err != nil {
+					return fmt.Errorf("%w: %v", ErrMessageProcessing, err)
+				}
+			}
+
+			var groups []string
+			if trigger.bodyRegex != nil {
+				groups = trigger.bodyRegex.FindStringSubmatch(body)
+			}
+
+			if err := trigger.notifier.Notify(&Notification{
+				From:     from,
+				To:       toAddresses,
+				Subject:  msg.Envelope.Subject,
+				Date:     msg.Envelope.Date,
+				UID:      msg.Uid,
+				Mailbox:  mailbox.mailbox,
+				Account:  mailbox.account,
+				Groups:   groups,
+				msg:      msg,
+				source:   mailbox,
+				body:     body,
+				extraEnv: extraEnv,
+			}); err != nil {
+				return err
 			}
 
 			// If this trigger has final=true, stop processing further triggers
@@ -516,11 +827,14 @@ func (em *EmailMonitor) processMessageInMailbox(msg *imap.Message, mailbox compi
 	return nil
 }
 
-// extractTextFromPart extracts text content from an email part
-func (em *EmailMonitor) extractTextFromPart(part io.Reader) (string, error) {
+// extractContentFromPart extracts text content and attachments from an
+// email part
+func (em *EmailMonitor) extractContentFromPart(part io.Reader) (messageContent, error) {
+	var content messageContent
+
 	mr, err := mail.CreateReader(part)
 	if err != nil {
-		return "", err
+		return content, err
 	}
 
 	var body strings.Builder
@@ -530,43 +844,155 @@ func (em *EmailMonitor) extractTextFromPart(part io.Reader) (string, error) {
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return "", err
+			return content, err
 		}
 
 		switch h := p.Header.(type) {
 		case *mail.InlineHeader:
 			mediaType, _, _ := h.ContentType()
 			if strings.HasPrefix(mediaType, "text/") {
-				content, err := io.ReadAll(p.Body)
+				data, err := em.readTextPart(p.Body)
 				if err != nil {
 					continue
 				}
-				body.WriteString(string(content))
+				body.WriteString(string(data))
+			}
+		case *mail.AttachmentHeader:
+			filename, _ := h.Filename()
+			mediaType, _, _ := h.ContentType()
+			data, err := io.ReadAll(p.Body)
+			if err != nil {
+				em.logger.Printf("error reading attachment %q: %v", filename, err)
+				continue
 			}
+			content.attachments = append(content.attachments, attachment{
+				filename:    filename,
+				contentType: mediaType,
+				content:     data,
+			})
 		}
 	}
 
-	return body.String(), nil
+	content.body = body.String()
+	return content, nil
 }
 
-// executeCommand runs the configured command when a regex match is found
-func (em *EmailMonitor) executeCommand(msg *imap.Message, body string, command string) error {
+// readTextPart reads a text part of a message, up to the configured
+// max-body-bytes. Anything beyond that is discarded.
+func (em *EmailMonitor) readTextPart(r io.Reader) ([]byte, error) {
+	limit := em.config.MaxBodyBytes
+	if limit == 0 {
+		limit = DefaultMaxBodyBytes
+	}
+
+	// Read one byte past the limit to tell whether the part was truncated
+	data, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		em.logger.Printf("message text part exceeds %d bytes, truncating", limit)
+		data = data[:limit]
+	}
+	return data, nil
+}
+
+// attachmentEnv returns the environment variables describing an attachment
+// for a trigger command. If save is true the attachment is written to a
+// temporary file, which the command is responsible for removing.
+func (em *EmailMonitor) attachmentEnv(a *attachment, save bool) ([]string, error) {
+	env := []string{
+		fmt.Sprintf("EMAIL_ATTACHMENT_NAME=%s", a.filename),
+		fmt.Sprintf("EMAIL_ATTACHMENT_TYPE=%s", a.contentType),
+	}
+	if !save {
+		return env, nil
+	}
+
+	// Only the extension of the (untrusted) filename is used in the path
+	f, err := os.CreateTemp("", "airdancer-attachment-*"+filepath.Ext(filepath.Base(a.filename)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save attachment %q: %w", a.filename, err)
+	}
+	_, err = f.Write(a.content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name()) //nolint:errcheck
+		return nil, fmt.Errorf("failed to save attachment %q: %w", a.filename, err)
+	}
+
+	em.logger.Printf("saved attachment %q to %s", a.filename, f.Name())
+	return append(env, fmt.Sprintf("EMAIL_ATTACHMENT_PATH=%s", f.Name())), nil
+}
+
+// executeCommand runs the configured command with the shell when a regex
+// match is found in mailbox
+func (em *EmailMonitor) executeCommand(msg *imap.Message, body string, command string, mailbox compiledMailbox) error {
+	return em.executeCommandWithEnv(msg, body, command, mailbox, commandOptions{mode: CommandModeShell}, nil)
+}
+
+// shellOperators are the characters that would let a command run more than
+// the allowed command when it is passed to the shell
+const shellOperators = ";&|<>$`()\n"
+
+// commandAllowed returns true if command, run in mode, may run according
+// to AllowedCommands
+func (em *EmailMonitor) commandAllowed(command, mode string) bool {
+	if len(em.config.AllowedCommands) == 0 {
+		return true
+	}
+	if mode != CommandModeExec && strings.ContainsAny(command, shellOperators) {
+		return false
+	}
+
+	command = strings.TrimSpace(command)
+	for _, allowed := range em.config.AllowedCommands {
+		if command == allowed || strings.HasPrefix(command, allowed+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// executeCommandWithEnv runs a command for a message in mailbox with the
+// given options and additional environment variables. References to
+// ${mailbox} and ${account} in the command are expanded.
+func (em *EmailMonitor) executeCommandWithEnv(msg *imap.Message, body string, command string, mailbox compiledMailbox, options commandOptions, extraEnv []string) error {
 	if command == "" {
 		em.logger.Println("no command configured")
 		return nil
 	}
 
+	if !em.commandAllowed(mailbox.expand(command, options.mode != CommandModeExec), options.mode) {
+		em.logger.Printf("refusing to run command that is not allowed by allowed-commands: %s", command)
+		return fmt.Errorf("%w: %s", ErrCommandNotAllowed, command)
+	}
+
 	from := "<unknown>"
 	if msg.Envelope != nil && len(msg.Envelope.From) > 0 {
 		from = msg.Envelope.From[0].Address()
 	}
 
 	// Set environment variables with message info
-	env := os.Environ()
+	env := options.baseEnv()
 	env = append(env, fmt.Sprintf("EMAIL_FROM=%s", from))
 	env = append(env, fmt.Sprintf("EMAIL_SUBJECT=%s", msg.Envelope.Subject))
 	env = append(env, fmt.Sprintf("EMAIL_DATE=%s", msg.Envelope.Date.Format(time.RFC3339)))
 	env = append(env, fmt.Sprintf("EMAIL_UID=%d", msg.Uid))
-
-	return em.executor.Execute(command, env, strings.NewReader(body))
+	env = append(env, fmt.Sprintf("EMAIL_MAILBOX=%s", mailbox.mailbox))
+	env = append(env, fmt.Sprintf("EMAIL_ACCOUNT=%s", mailbox.account))
+	// Identifies requests made by the command (for example, with
+	// dancerctl) as automated, so that the API can skip them in
+	// maintenance mode
+	env = append(env, "AIRDANCER_SOURCE=monitor")
+	env = append(env, options.env...)
+	env = append(env, extraEnv...)
+
+	args, err := commandArgs(command, options.mode, mailbox)
+	if err != nil {
+		return err
+	}
+	return em.executor.Execute(args, options.workingDir, env, strings.NewReader(body))
 }
@@ -2,9 +2,12 @@ package monitor
 
 import (
 	_ "embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -18,6 +21,12 @@ var testEmailWithPattern string
 //go:embed testdata/test-email-without-match.txt
 var testEmailWithoutMatch string
 
+//go:embed testdata/test-email-with-attachment.txt
+var testEmailWithAttachment string
+
+//go:embed testdata/test-email-oversized.txt
+var testEmailOversized string
+
 // Mock implementations for testing
 
 type MockLiteral struct {
@@ -54,6 +63,10 @@ type MockIMAPClient struct {
 	uidFetchCalled  bool
 	closeCalled     bool
 
+	// Recorded arguments
+	uidSearchCriteria *imap.SearchCriteria
+	uidFetchSeqSets   []*imap.SeqSet
+
 	// Return values
 	mailboxStatus *imap.MailboxStatus
 	searchResults []uint32
@@ -86,6 +99,7 @@ func (m *MockIMAPClient) Search(criteria *imap.SearchCriteria) ([]uint32, error)
 
 func (m *MockIMAPClient) UidSearch(criteria *imap.SearchCriteria) ([]uint32, error) {
 	m.uidSearchCalled = true
+	m.uidSearchCriteria = criteria
 	if m.uidSearchErr != nil {
 		return nil, m.uidSearchErr
 	}
@@ -108,13 +122,16 @@ func (m *MockIMAPClient) Fetch(seqset *imap.SeqSet, items []imap.FetchItem, ch c
 
 func (m *MockIMAPClient) UidFetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
 	m.uidFetchCalled = true
+	m.uidFetchSeqSets = append(m.uidFetchSeqSets, seqset)
 	if m.uidFetchErr != nil {
 		return m.uidFetchErr
 	}
 	go func() {
 		defer close(ch)
 		for _, msg := range m.messages {
-			ch <- msg
+			if msg == nil || seqset.Contains(msg.Uid) {
+				ch <- msg
+			}
 		}
 	}()
 	return nil
@@ -152,14 +169,16 @@ func (m *MockIMAPDialer) Dial(addr string) (IMAPClient, error) {
 type MockCommandExecutor struct {
 	executeErr    error
 	executeCalled bool
-	lastCommand   string
+	lastArgs      []string
+	lastDir       string
 	lastEnv       []string
 	lastStdin     string
 }
 
-func (m *MockCommandExecutor) Execute(command string, env []string, stdin io.Reader) error {
+func (m *MockCommandExecutor) Execute(args []string, dir string, env []string, stdin io.Reader) error {
 	m.executeCalled = true
-	m.lastCommand = command
+	m.lastArgs = args
+	m.lastDir = dir
 	m.lastEnv = env
 	if stdin != nil {
 		stdinBytes, _ := io.ReadAll(stdin)
@@ -513,6 +532,203 @@ func TestEmailMonitorInitializeLastUID(t *testing.T) {
 	}
 }
 
+func TestEmailMonitorInitializeLastUIDBacklog(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	config := Config{
+		IMAP: IMAPConfig{
+			Server: "imap.example.com",
+			Port:   993,
+		},
+		ProcessBacklogMinutes: 30,
+		Monitor: []MailboxConfig{
+			{
+				Mailbox:  "INBOX",
+				Triggers: []TriggerConfig{{RegexPattern: "test"}},
+			},
+		},
+	}
+
+	// SINCE matches the whole day, so the server returns a message from
+	// before the backlog window as well
+	mockClient := &MockIMAPClient{
+		mailboxStatus: &imap.MailboxStatus{Messages: 3},
+		searchResults: []uint32{3, 4, 5},
+		messages: []*imap.Message{
+			{Uid: 3, InternalDate: now.Add(-2 * time.Hour)},
+			{Uid: 4, InternalDate: now.Add(-20 * time.Minute)},
+			{Uid: 5, InternalDate: now.Add(-time.Minute)},
+		},
+	}
+
+	monitor, err := NewEmailMonitor(config, &MockIMAPDialer{}, &MockCommandExecutor{}, &MockLogger{}, &MockTimer{})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	monitor.client = mockClient
+	monitor.now = func() time.Time { return now }
+
+	if err := monitor.initializeLastUIDs(); err != nil {
+		t.Fatalf("initializeLastUIDs() failed: %v", err)
+	}
+
+	if want := now.Add(-30 * time.Minute); !mockClient.uidSearchCriteria.Since.Equal(want) {
+		t.Errorf("search since = %v, want %v", mockClient.uidSearchCriteria.Since, want)
+	}
+
+	// Messages 4 and 5 arrived within the backlog window
+	if got := monitor.lastUIDs["INBOX"]; got != 3 {
+		t.Errorf("lastUID = %d, want 3", got)
+	}
+}
+
+func TestEmailMonitorSearchCriteria(t *testing.T) {
+	tests := []struct {
+		name          string
+		unseenOnly    bool
+		from          string
+		wantFlags     []string
+		wantFromValue []string
+	}{
+		{
+			name: "no filters",
+		},
+		{
+			name:       "unseen only",
+			unseenOnly: true,
+			wantFlags:  []string{imap.SeenFlag},
+		},
+		{
+			name:          "from sender",
+			from:          "alerts@example.com",
+			wantFromValue: []string{"alerts@example.com"},
+		},
+		{
+			name:          "unseen from sender",
+			unseenOnly:    true,
+			from:          "alerts@example.com",
+			wantFlags:     []string{imap.SeenFlag},
+			wantFromValue: []string{"alerts@example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{
+				IMAP: IMAPConfig{
+					Server: "imap.example.com",
+					Port:   993,
+				},
+				Monitor: []MailboxConfig{
+					{
+						Mailbox:          "INBOX",
+						SearchUnseenOnly: tt.unseenOnly,
+						SearchFrom:       tt.from,
+						Triggers: []TriggerConfig{
+							{
+								RegexPattern: "test",
+							},
+						},
+					},
+				},
+			}
+
+			mockClient := &MockIMAPClient{
+				mailboxStatus: &imap.MailboxStatus{Messages: 1},
+			}
+
+			monitor, err := NewEmailMonitor(config, &MockIMAPDialer{}, &MockCommandExecutor{}, &MockLogger{}, &MockTimer{})
+			if err != nil {
+				t.Fatalf("Failed to create monitor: %v", err)
+			}
+			monitor.client = mockClient
+			monitor.lastUIDs["INBOX"] = 10
+
+			if err := monitor.checkForNewMessagesInMailbox(monitor.mailboxes[0]); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			criteria := mockClient.uidSearchCriteria
+			if criteria == nil {
+				t.Fatal("Expected UidSearch to be called")
+			}
+			if !reflect.DeepEqual(criteria.WithoutFlags, tt.wantFlags) {
+				t.Errorf("Expected WithoutFlags %v, got %v", tt.wantFlags, criteria.WithoutFlags)
+			}
+			if got := criteria.Header.Values("From"); !reflect.DeepEqual(got, tt.wantFromValue) {
+				t.Errorf("Expected From header %v, got %v", tt.wantFromValue, got)
+			}
+			if criteria.Uid.String() != "11:*" {
+				t.Errorf("Expected UID range 11:*, got %s", criteria.Uid.String())
+			}
+		})
+	}
+}
+
+func TestEmailMonitorFetchBatches(t *testing.T) {
+	stateFile := t.TempDir() + "/state.json"
+	config := Config{
+		IMAP:           IMAPConfig{Server: "imap.example.com", Port: 993, Username: "user"},
+		FetchBatchSize: 50,
+		StateFile:      stateFile,
+		Monitor: []MailboxConfig{
+			{
+				Mailbox:  "INBOX",
+				Triggers: []TriggerConfig{{RegexPattern: "test"}},
+			},
+		},
+	}
+
+	var uids []uint32
+	var messages []*imap.Message
+	for uid := uint32(11); uid <= 130; uid++ {
+		uids = append(uids, uid)
+		messages = append(messages, &imap.Message{Uid: uid})
+	}
+	mockClient := &MockIMAPClient{
+		mailboxStatus: &imap.MailboxStatus{Messages: 130, UidValidity: 1},
+		searchResults: uids,
+		messages:      messages,
+	}
+
+	monitor, err := NewEmailMonitor(config, &MockIMAPDialer{}, &MockCommandExecutor{}, &MockLogger{}, &MockTimer{})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	monitor.client = mockClient
+	monitor.lastUIDs["INBOX"] = 10
+	monitor.uidValidity["INBOX"] = 1
+
+	if err := monitor.checkForNewMessagesInMailbox(monitor.mailboxes[0]); err != nil {
+		t.Fatalf("checkForNewMessagesInMailbox() failed: %v", err)
+	}
+
+	var fetched []string
+	for _, seqset := range mockClient.uidFetchSeqSets {
+		fetched = append(fetched, seqset.String())
+	}
+	if want := []string{"11:60", "61:110", "111:130"}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("fetched UIDs %q, want %q", fetched, want)
+	}
+	if got := monitor.lastUIDs["INBOX"]; got != 130 {
+		t.Errorf("lastUID = %d, want 130", got)
+	}
+
+	// The position is saved after every batch but the last, which is left
+	// to the caller
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	var state monitorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("Failed to decode state file: %v", err)
+	}
+	if got := state.Mailboxes["user@imap.example.com:993/INBOX"].LastUID; got != 110 {
+		t.Errorf("saved lastUID = %d, want 110", got)
+	}
+}
+
 func TestEmailMonitorProcessMessage(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -616,8 +832,8 @@ func TestEmailMonitorProcessMessage(t *testing.T) {
 				if !mockExecutor.executeCalled {
 					t.Error("Expected command to be executed")
 				}
-				if mockExecutor.lastCommand != tt.command {
-					t.Errorf("Expected command %q, got %q", tt.command, mockExecutor.lastCommand)
+				if want := []string{"sh", "-c", tt.command}; !reflect.DeepEqual(mockExecutor.lastArgs, want) {
+					t.Errorf("Expected args %q, got %q", want, mockExecutor.lastArgs)
 				}
 			} else {
 				if mockExecutor.executeCalled {
@@ -628,6 +844,228 @@ func TestEmailMonitorProcessMessage(t *testing.T) {
 	}
 }
 
+func TestEmailMonitorProcessMessageAttachment(t *testing.T) {
+	tests := []struct {
+		name            string
+		trigger         TriggerConfig
+		expectedCommand bool
+		expectedEnv     []string
+	}{
+		{
+			name:            "attachment name match",
+			trigger:         TriggerConfig{AttachmentName: `invoice-\d+\.pdf`, Command: "echo matched"},
+			expectedCommand: true,
+			expectedEnv:     []string{"EMAIL_ATTACHMENT_NAME=invoice-1234.pdf", "EMAIL_ATTACHMENT_TYPE=application/pdf", "AIRDANCER_SOURCE=monitor"},
+		},
+		{
+			name:            "attachment type match",
+			trigger:         TriggerConfig{AttachmentType: "^application/pdf$", Command: "echo matched"},
+			expectedCommand: true,
+			expectedEnv:     []string{"EMAIL_ATTACHMENT_NAME=invoice-1234.pdf", "EMAIL_ATTACHMENT_TYPE=application/pdf"},
+		},
+		{
+			name:            "name and type must match the same attachment",
+			trigger:         TriggerConfig{AttachmentName: `\.pdf$`, AttachmentType: "^image/", Command: "echo matched"},
+			expectedCommand: false,
+		},
+		{
+			name:            "body and attachment match",
+			trigger:         TriggerConfig{RegexPattern: "invoice is attached", AttachmentName: `\.pdf$`, Command: "echo matched"},
+			expectedCommand: true,
+		},
+		{
+			name:            "no attachment match",
+			trigger:         TriggerConfig{AttachmentName: `\.docx$`, Command: "echo matched"},
+			expectedCommand: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{
+				IMAP: IMAPConfig{
+					Server: "imap.example.com",
+					Port:   993,
+				},
+				Monitor: []MailboxConfig{
+					{
+						Mailbox:  "INBOX",
+						Triggers: []TriggerConfig{tt.trigger},
+					},
+				},
+			}
+
+			mockExecutor := &MockCommandExecutor{}
+			monitor, err := NewEmailMonitor(config, &MockIMAPDialer{}, mockExecutor, &MockLogger{}, &MockTimer{})
+			if err != nil {
+				t.Fatalf("Failed to create monitor: %v", err)
+			}
+
+			message := &imap.Message{
+				Envelope: &imap.Envelope{
+					Subject: "Your invoice",
+					From:    []*imap.Address{{MailboxName: "billing", HostName: "example.com"}},
+				},
+				Body: map[*imap.BodySectionName]imap.Literal{
+					{}: &MockLiteral{content: testEmailWithAttachment},
+				},
+			}
+
+			if err := monitor.processMessageInMailbox(message, monitor.mailboxes[0]); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if mockExecutor.executeCalled != tt.expectedCommand {
+				t.Fatalf("Expected command executed=%v, got %v", tt.expectedCommand, mockExecutor.executeCalled)
+			}
+			for _, want := range tt.expectedEnv {
+				if !containsEnv(mockExecutor.lastEnv, want) {
+					t.Errorf("Expected environment to contain %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestEmailMonitorProcessMessageMaxBodyBytes(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxBodyBytes    int
+		expectedCommand bool
+		expectTruncated bool
+	}{
+		{
+			name:            "default limit reads whole body",
+			expectedCommand: true,
+		},
+		{
+			name:            "pattern beyond limit is not matched",
+			maxBodyBytes:    1024,
+			expectedCommand: false,
+			expectTruncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{
+				IMAP: IMAPConfig{
+					Server: "imap.example.com",
+					Port:   993,
+				},
+				MaxBodyBytes: tt.maxBodyBytes,
+				Monitor: []MailboxConfig{
+					{
+						Mailbox:  "INBOX",
+						Triggers: []TriggerConfig{{RegexPattern: "with pattern", Command: "echo matched"}},
+					},
+				},
+			}
+
+			mockExecutor := &MockCommandExecutor{}
+			mockLogger := &MockLogger{}
+			monitor, err := NewEmailMonitor(config, &MockIMAPDialer{}, mockExecutor, mockLogger, &MockTimer{})
+			if err != nil {
+				t.Fatalf("Failed to create monitor: %v", err)
+			}
+
+			message := &imap.Message{
+				Envelope: &imap.Envelope{
+					Subject: "Test Subject",
+					From:    []*imap.Address{{MailboxName: "test", HostName: "example.com"}},
+				},
+				Body: map[*imap.BodySectionName]imap.Literal{
+					{}: &MockLiteral{content: testEmailOversized},
+				},
+			}
+
+			if err := monitor.processMessageInMailbox(message, monitor.mailboxes[0]); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if mockExecutor.executeCalled != tt.expectedCommand {
+				t.Errorf("Expected command executed=%v, got %v", tt.expectedCommand, mockExecutor.executeCalled)
+			}
+
+			truncated := false
+			for _, call := range mockLogger.printfCalls {
+				if strings.Contains(call, "truncating") {
+					truncated = true
+				}
+			}
+			if truncated != tt.expectTruncated {
+				t.Errorf("Expected truncation logged=%v, got %v", tt.expectTruncated, truncated)
+			}
+		})
+	}
+}
+
+func TestEmailMonitorSaveAttachment(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	config := Config{
+		IMAP: IMAPConfig{
+			Server: "imap.example.com",
+			Port:   993,
+		},
+		Monitor: []MailboxConfig{
+			{
+				Mailbox: "INBOX",
+				Triggers: []TriggerConfig{
+					{AttachmentType: "application/pdf", SaveAttachment: true, Command: "echo saved"},
+				},
+			},
+		},
+	}
+
+	mockExecutor := &MockCommandExecutor{}
+	monitor, err := NewEmailMonitor(config, &MockIMAPDialer{}, mockExecutor, &MockLogger{}, &MockTimer{})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	message := &imap.Message{
+		Envelope: &imap.Envelope{Subject: "Your invoice"},
+		Body: map[*imap.BodySectionName]imap.Literal{
+			{}: &MockLiteral{content: testEmailWithAttachment},
+		},
+	}
+
+	if err := monitor.processMessageInMailbox(message, monitor.mailboxes[0]); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var path string
+	for _, v := range mockExecutor.lastEnv {
+		if p, ok := strings.CutPrefix(v, "EMAIL_ATTACHMENT_PATH="); ok {
+			path = p
+		}
+	}
+	if path == "" {
+		t.Fatal("Expected EMAIL_ATTACHMENT_PATH to be set")
+	}
+	if !strings.HasSuffix(path, ".pdf") {
+		t.Errorf("Expected saved attachment to keep its extension, got %s", path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read saved attachment: %v", err)
+	}
+	if string(content) != "%PDF-1.4\ntest invoice\n" {
+		t.Errorf("Unexpected attachment content %q", content)
+	}
+}
+
+func containsEnv(env []string, want string) bool {
+	for _, v := range env {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
 func TestEmailMonitorExecuteCommand(t *testing.T) {
 	config := Config{
 		IMAP: IMAPConfig{
@@ -666,7 +1104,7 @@ func TestEmailMonitorExecuteCommand(t *testing.T) {
 
 	body := "test email body"
 
-	err = monitor.executeCommand(message, body, config.Monitor[0].Triggers[0].Command)
+	err = monitor.executeCommand(message, body, config.Monitor[0].Triggers[0].Command, monitor.mailboxes[0])
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -675,8 +1113,8 @@ func TestEmailMonitorExecuteCommand(t *testing.T) {
 		t.Error("Expected Execute to be called")
 	}
 
-	if mockExecutor.lastCommand != config.Monitor[0].Triggers[0].Command {
-		t.Errorf("Expected command %q, got %q", config.Monitor[0].Triggers[0].Command, mockExecutor.lastCommand)
+	if want := []string{"sh", "-c", config.Monitor[0].Triggers[0].Command}; !reflect.DeepEqual(mockExecutor.lastArgs, want) {
+		t.Errorf("Expected args %q, got %q", want, mockExecutor.lastArgs)
 	}
 
 	if mockExecutor.lastStdin != body {
@@ -730,7 +1168,7 @@ func TestEmailMonitorExecuteCommandNoCommand(t *testing.T) {
 		},
 	}
 
-	err = monitor.executeCommand(message, "test body", "")
+	err = monitor.executeCommand(message, "test body", "", monitor.mailboxes[0])
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -752,6 +1190,80 @@ func TestEmailMonitorExecuteCommandNoCommand(t *testing.T) {
 	}
 }
 
+func TestEmailMonitorExecuteCommandAllowedCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		allowed bool
+	}{
+		{"exact match", "dancerctl blink", true},
+		{"prefix match", "dancerctl blink --count 3", true},
+		{"not listed", "rm -rf /tmp/x", false},
+		{"prefix without space", "dancerctl blinkx", false},
+		{"shell operator", "dancerctl blink; rm -rf /tmp/x", false},
+		{"command substitution", "dancerctl blink $(cat /etc/passwd)", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{
+				IMAP:            IMAPConfig{Server: "imap.example.com", Port: 993},
+				AllowedCommands: []string{"dancerctl blink", "dancerctl switch"},
+				Monitor: []MailboxConfig{
+					{
+						Mailbox:  "INBOX",
+						Triggers: []TriggerConfig{{RegexPattern: "test", Command: tt.command}},
+					},
+				},
+			}
+
+			mockExecutor := &MockCommandExecutor{}
+			monitor, err := NewEmailMonitor(config, &MockIMAPDialer{}, mockExecutor, &MockLogger{}, &MockTimer{})
+			if err != nil {
+				t.Fatalf("Failed to create monitor: %v", err)
+			}
+
+			message := &imap.Message{Uid: 123, Envelope: &imap.Envelope{Subject: "Test Subject"}}
+			err = monitor.executeCommand(message, "test body", tt.command, monitor.mailboxes[0])
+
+			if mockExecutor.executeCalled != tt.allowed {
+				t.Errorf("Expected command executed=%v, got %v", tt.allowed, mockExecutor.executeCalled)
+			}
+			if !tt.allowed && !errors.Is(err, ErrCommandNotAllowed) {
+				t.Errorf("Expected ErrCommandNotAllowed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewEmailMonitorWarnsWithoutAllowedCommands(t *testing.T) {
+	config := Config{
+		IMAP: IMAPConfig{Server: "imap.example.com", Port: 993},
+		Monitor: []MailboxConfig{
+			{
+				Mailbox:  "INBOX",
+				Triggers: []TriggerConfig{{RegexPattern: "test", Command: "dancerctl blink"}},
+			},
+		},
+	}
+
+	mockLogger := &MockLogger{}
+	if _, err := NewEmailMonitor(config, &MockIMAPDialer{}, &MockCommandExecutor{}, mockLogger, &MockTimer{}); err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	found := false
+	for _, msg := range mockLogger.printlnCalls {
+		if strings.Contains(msg, "allowed-commands is not set") {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Error("Expected a warning that allowed-commands is not set")
+	}
+}
+
 func TestEmailMonitorStop(t *testing.T) {
 	config := Config{
 		IMAP: IMAPConfig{
@@ -794,3 +1306,111 @@ func TestEmailMonitorStop(t *testing.T) {
 		t.Error("Expected stop channel to be closed")
 	}
 }
+
+// countingIMAPClient records how many times each mailbox is checked for new
+// messages
+type countingIMAPClient struct {
+	*MockIMAPClient
+	selected string
+	checks   map[string]int
+}
+
+func (c *countingIMAPClient) Select(name string, readOnly bool) (*imap.MailboxStatus, error) {
+	c.selected = name
+	return c.MockIMAPClient.Select(name, readOnly)
+}
+
+func (c *countingIMAPClient) UidSearch(criteria *imap.SearchCriteria) ([]uint32, error) {
+	c.checks[c.selected]++
+	return c.MockIMAPClient.UidSearch(criteria)
+}
+
+func TestEmailMonitorRunOnce(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     string
+		wantState map[string]mailboxState
+	}{
+		{
+			name: "first run",
+			wantState: map[string]mailboxState{
+				"user@imap.example.com:993/INBOX":  {UIDValidity: 7, LastUID: 11},
+				"user@imap.example.com:993/Alerts": {UIDValidity: 7, LastUID: 11},
+			},
+		},
+		{
+			name: "saved state",
+			state: `{"mailboxes": {
+				"user@imap.example.com:993/INBOX": {"uidValidity": 7, "lastUID": 10},
+				"user@imap.example.com:993/Alerts": {"uidValidity": 7, "lastUID": 11}
+			}}`,
+			wantState: map[string]mailboxState{
+				"user@imap.example.com:993/INBOX":  {UIDValidity: 7, LastUID: 11},
+				"user@imap.example.com:993/Alerts": {UIDValidity: 7, LastUID: 11},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stateFile := t.TempDir() + "/state.json"
+			if tt.state != "" {
+				if err := os.WriteFile(stateFile, []byte(tt.state), 0644); err != nil {
+					t.Fatalf("Failed to write state file: %v", err)
+				}
+			}
+
+			config := Config{
+				IMAP: IMAPConfig{
+					Server:   "imap.example.com",
+					Port:     993,
+					Username: "user",
+				},
+				Once:      true,
+				StateFile: stateFile,
+				Monitor: []MailboxConfig{
+					{Mailbox: "INBOX", Triggers: []TriggerConfig{{RegexPattern: "test"}}},
+					{Mailbox: "Alerts", Triggers: []TriggerConfig{{RegexPattern: "test"}}},
+				},
+			}
+
+			mockClient := &countingIMAPClient{
+				MockIMAPClient: &MockIMAPClient{
+					mailboxStatus: &imap.MailboxStatus{Messages: 1, UidValidity: 7},
+					searchResults: []uint32{11},
+					messages:      []*imap.Message{{Uid: 11}},
+				},
+				checks: make(map[string]int),
+			}
+			dialer := &MockIMAPDialer{client: mockClient}
+
+			monitor, err := NewEmailMonitor(config, dialer, &MockCommandExecutor{}, &MockLogger{}, &MockTimer{})
+			if err != nil {
+				t.Fatalf("Failed to create monitor: %v", err)
+			}
+
+			if err := monitor.RunOnce(); err != nil {
+				t.Fatalf("RunOnce() failed: %v", err)
+			}
+
+			if want := map[string]int{"INBOX": 1, "Alerts": 1}; !reflect.DeepEqual(mockClient.checks, want) {
+				t.Errorf("checks = %v, want %v", mockClient.checks, want)
+			}
+			if !mockClient.closeCalled {
+				t.Error("RunOnce() did not disconnect")
+			}
+
+			data, err := os.ReadFile(stateFile)
+			if err != nil {
+				t.Fatalf("Failed to read state file: %v", err)
+			}
+			var state monitorState
+			if err := json.Unmarshal(data, &state); err != nil {
+				t.Fatalf("Failed to parse state file %s: %v", data, err)
+			}
+			if !reflect.DeepEqual(state.Mailboxes, tt.wantState) {
+				t.Errorf("saved state = %v, want %v", state.Mailboxes, tt.wantState)
+			}
+		})
+	}
+}
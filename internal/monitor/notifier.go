@@ -0,0 +1,239 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// Notifier types
+const (
+	NotifierCommand = "command"
+	NotifierNtfy    = "ntfy"
+	NotifierWebhook = "webhook"
+)
+
+// defaultNtfyServer is used for ntfy notifications that do not set server
+const defaultNtfyServer = "https://ntfy.sh"
+
+// notifyTimeout bounds each request made by the ntfy and webhook notifiers
+const notifyTimeout = 10 * time.Second
+
+// Templates used when a notification does not set title or message
+const (
+	defaultTitleTemplate   = "Email from {{.From}}"
+	defaultMessageTemplate = "{{.Subject}}"
+)
+
+// Notification describes a message that matched a trigger. It is the data
+// for the title and message templates, so its fields are exported.
+type Notification struct {
+	From    string    `json:"from"`
+	To      []string  `json:"to"`
+	Subject string    `json:"subject"`
+	Date    time.Time `json:"date"`
+	UID     uint32    `json:"uid"`
+	Mailbox string    `json:"mailbox"`
+	// Account identifies the IMAP account of the mailbox, as
+	// username@server
+	Account string `json:"account"`
+	// Groups holds the match of the trigger's regex-pattern against the
+	// body followed by its capture groups; it is empty if the trigger has
+	// no regex-pattern.
+	Groups []string `json:"groups"`
+
+	// Used by the command notifier
+	msg      *imap.Message
+	body     string
+	extraEnv []string
+	source   compiledMailbox
+}
+
+// templateVariables turns the ${mailbox} and ${account} references that
+// commands use into the equivalent template actions, so that notification
+// templates accept them too
+var templateVariables = strings.NewReplacer("${mailbox}", "{{.Mailbox}}", "${account}", "{{.Account}}")
+
+// Notifier takes action when a message matches a trigger
+type Notifier interface {
+	Notify(n *Notification) error
+}
+
+// commandNotifier runs the trigger's command with the message on stdin
+type commandNotifier struct {
+	em      *EmailMonitor
+	command string
+	options commandOptions
+}
+
+func (c *commandNotifier) Notify(n *Notification) error {
+	if err := c.em.executeCommandWithEnv(n.msg, n.body, c.command, n.source, c.options, n.extraEnv); err != nil {
+		return fmt.Errorf("%w: %v", ErrCommandExecution, err)
+	}
+	return nil
+}
+
+// ntfyNotifier publishes a message to an ntfy topic
+type ntfyNotifier struct {
+	client   *http.Client
+	url      string
+	token    string
+	priority string
+	title    *template.Template
+	message  *template.Template
+}
+
+func (nf *ntfyNotifier) Notify(n *Notification) error {
+	title, message, err := renderNotification(nf.title, nf.message, n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, nf.url, strings.NewReader(message))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotificationFailed, err)
+	}
+	req.Header.Set("Title", title)
+	if nf.priority != "" {
+		req.Header.Set("Priority", nf.priority)
+	}
+	if nf.token != "" {
+		req.Header.Set("Authorization", "Bearer "+nf.token)
+	}
+
+	return sendNotification(nf.client, req)
+}
+
+// webhookPayload is the body posted by the webhook notifier. Text repeats
+// Message for services such as Slack incoming webhooks that expect it.
+type webhookPayload struct {
+	Notification
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	Text    string `json:"text"`
+}
+
+// webhookNotifier posts the notification as JSON to a URL
+type webhookNotifier struct {
+	client  *http.Client
+	url     string
+	token   string
+	title   *template.Template
+	message *template.Template
+}
+
+func (wn *webhookNotifier) Notify(n *Notification) error {
+	title, message, err := renderNotification(wn.title, wn.message, n)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(webhookPayload{Notification: *n, Title: title, Message: message, Text: message})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotificationFailed, err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, wn.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotificationFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if wn.token != "" {
+		req.Header.Set("Authorization", "Bearer "+wn.token)
+	}
+
+	return sendNotification(wn.client, req)
+}
+
+// sendNotification sends req and checks that it succeeded
+func sendNotification(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotificationFailed, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%w: %s returned status %d", ErrNotificationFailed, req.URL.Redacted(), resp.StatusCode)
+	}
+	return nil
+}
+
+// renderNotification expands the title and message templates for n
+func renderNotification(title, message *template.Template, n *Notification) (string, string, error) {
+	var titleBuf, messageBuf strings.Builder
+	if err := title.Execute(&titleBuf, n); err != nil {
+		return "", "", fmt.Errorf("%w: title: %v", ErrNotificationFailed, err)
+	}
+	if err := message.Execute(&messageBuf, n); err != nil {
+		return "", "", fmt.Errorf("%w: message: %v", ErrNotificationFailed, err)
+	}
+	return titleBuf.String(), messageBuf.String(), nil
+}
+
+// newNotifier creates the notifier for a trigger. Triggers without a notify
+// section run their command.
+func (em *EmailMonitor) newNotifier(trigger TriggerConfig) (Notifier, error) {
+	notify := trigger.Notify
+	if notify == nil || notify.Type == "" || notify.Type == NotifierCommand {
+		if err := validateCommandMode(trigger.CommandMode); err != nil {
+			return nil, err
+		}
+		if err := validateCommandEnv(trigger.Env); err != nil {
+			return nil, err
+		}
+		return &commandNotifier{em: em, command: trigger.Command, options: newCommandOptions(trigger)}, nil
+	}
+
+	titleText := notify.Title
+	if titleText == "" {
+		titleText = defaultTitleTemplate
+	}
+	title, err := template.New("title").Parse(templateVariables.Replace(titleText))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid title: %v", ErrInvalidNotifier, err)
+	}
+
+	messageText := notify.Message
+	if messageText == "" {
+		messageText = defaultMessageTemplate
+	}
+	message, err := template.New("message").Parse(templateVariables.Replace(messageText))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid message: %v", ErrInvalidNotifier, err)
+	}
+
+	client := &http.Client{Timeout: notifyTimeout}
+
+	switch notify.Type {
+	case NotifierNtfy:
+		server := notify.Server
+		if server == "" {
+			server = defaultNtfyServer
+		}
+		return &ntfyNotifier{
+			client:   client,
+			url:      strings.TrimSuffix(server, "/") + "/" + notify.Topic,
+			token:    notify.Token,
+			priority: notify.Priority,
+			title:    title,
+			message:  message,
+		}, nil
+	case NotifierWebhook:
+		return &webhookNotifier{
+			client:  client,
+			url:     notify.URL,
+			token:   notify.Token,
+			title:   title,
+			message: message,
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidNotifier, notify.Type)
+	}
+}
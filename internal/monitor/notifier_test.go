@@ -0,0 +1,201 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+// notifyRequest records a request received by the test notification server
+type notifyRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// startNotifyServer returns a server that records each request it receives
+// on the returned channel
+func startNotifyServer(t *testing.T) (*httptest.Server, chan notifyRequest) {
+	t.Helper()
+
+	requests := make(chan notifyRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- notifyRequest{path: r.URL.Path, header: r.Header, body: body}
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+// notifyMonitor creates a monitor with a single trigger that matches
+// "pattern" in the body and notifies with notify, then processes a
+// matching message
+func notifyMonitor(t *testing.T, notify *NotifyConfig) error {
+	t.Helper()
+
+	config := Config{
+		IMAP: IMAPConfig{Server: "imap.example.com", Port: 993},
+		Monitor: []MailboxConfig{
+			{
+				Mailbox: "INBOX",
+				Triggers: []TriggerConfig{
+					{RegexPattern: "with (pattern)", Notify: notify},
+				},
+			},
+		},
+	}
+
+	monitor, err := NewEmailMonitor(config, &MockIMAPDialer{}, &MockCommandExecutor{}, &MockLogger{}, &MockTimer{})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	msg := &imap.Message{
+		Uid: 42,
+		Envelope: &imap.Envelope{
+			Subject: "Test Subject",
+			From:    []*imap.Address{{MailboxName: "test", HostName: "example.com"}},
+		},
+		Body: map[*imap.BodySectionName]imap.Literal{
+			{}: &MockLiteral{content: testEmailWithPattern},
+		},
+	}
+	return monitor.processMessageInMailbox(msg, monitor.mailboxes[0])
+}
+
+func TestNtfyNotifier(t *testing.T) {
+	server, requests := startNotifyServer(t)
+
+	err := notifyMonitor(t, &NotifyConfig{
+		Type:     NotifierNtfy,
+		Server:   server.URL + "/",
+		Topic:    "alerts",
+		Priority: "high",
+		Token:    "secret",
+		Message:  "{{.Subject}} matched {{index .Groups 1}}",
+	})
+	if err != nil {
+		t.Fatalf("processMessageInMailbox() failed: %v", err)
+	}
+
+	req := <-requests
+	if req.path != "/alerts" {
+		t.Errorf("ntfy path = %q, want %q", req.path, "/alerts")
+	}
+	if got := string(req.body); got != "Test Subject matched pattern" {
+		t.Errorf("ntfy message = %q, want %q", got, "Test Subject matched pattern")
+	}
+	if got := req.header.Get("Title"); got != "Email from test@example.com" {
+		t.Errorf("ntfy title = %q, want %q", got, "Email from test@example.com")
+	}
+	if got := req.header.Get("Priority"); got != "high" {
+		t.Errorf("ntfy priority = %q, want %q", got, "high")
+	}
+	if got := req.header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("ntfy authorization = %q, want %q", got, "Bearer secret")
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	server, requests := startNotifyServer(t)
+
+	err := notifyMonitor(t, &NotifyConfig{
+		Type:  NotifierWebhook,
+		URL:   server.URL + "/hook",
+		Title: "{{.Mailbox}}",
+	})
+	if err != nil {
+		t.Fatalf("processMessageInMailbox() failed: %v", err)
+	}
+
+	req := <-requests
+	if got := req.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("webhook content type = %q, want %q", got, "application/json")
+	}
+
+	var payload struct {
+		From    string   `json:"from"`
+		Subject string   `json:"subject"`
+		UID     uint32   `json:"uid"`
+		Groups  []string `json:"groups"`
+		Title   string   `json:"title"`
+		Message string   `json:"message"`
+		Text    string   `json:"text"`
+	}
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("Failed to decode webhook payload %s: %v", req.body, err)
+	}
+
+	if payload.From != "test@example.com" || payload.Subject != "Test Subject" || payload.UID != 42 {
+		t.Errorf("webhook message = %+v, want from test@example.com, subject Test Subject, uid 42", payload)
+	}
+	if len(payload.Groups) != 2 || payload.Groups[1] != "pattern" {
+		t.Errorf("webhook groups = %q, want [with pattern, pattern]", payload.Groups)
+	}
+	if payload.Title != "INBOX" || payload.Message != "Test Subject" || payload.Text != payload.Message {
+		t.Errorf("webhook title/message/text = %q/%q/%q, want INBOX/Test Subject/Test Subject", payload.Title, payload.Message, payload.Text)
+	}
+}
+
+func TestNotifierTemplateVariables(t *testing.T) {
+	server, requests := startNotifyServer(t)
+
+	err := notifyMonitor(t, &NotifyConfig{
+		Type:    NotifierNtfy,
+		Server:  server.URL,
+		Topic:   "alerts",
+		Title:   "${mailbox}",
+		Message: "${account}: {{.Subject}}",
+	})
+	if err != nil {
+		t.Fatalf("processMessageInMailbox() failed: %v", err)
+	}
+
+	req := <-requests
+	if got := req.header.Get("Title"); got != "INBOX" {
+		t.Errorf("ntfy title = %q, want %q", got, "INBOX")
+	}
+	if got, want := string(req.body), "@imap.example.com: Test Subject"; got != want {
+		t.Errorf("ntfy message = %q, want %q", got, want)
+	}
+}
+
+func TestWebhookNotifierFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := notifyMonitor(t, &NotifyConfig{Type: NotifierWebhook, URL: server.URL})
+	if !errors.Is(err, ErrNotificationFailed) {
+		t.Errorf("processMessageInMailbox() error = %v, want %v", err, ErrNotificationFailed)
+	}
+}
+
+func TestNotifyConfigValidate(t *testing.T) {
+	for _, notify := range []NotifyConfig{
+		{Type: NotifierNtfy},
+		{Type: NotifierWebhook},
+		{Type: "pager"},
+	} {
+		if err := notify.Validate(); !errors.Is(err, ErrInvalidNotifier) {
+			t.Errorf("Validate(%+v) error = %v, want %v", notify, err, ErrInvalidNotifier)
+		}
+	}
+
+	for _, notify := range []NotifyConfig{
+		{},
+		{Type: NotifierCommand},
+		{Type: NotifierNtfy, Topic: "alerts"},
+		{Type: NotifierWebhook, URL: "https://example.com/hook"},
+	} {
+		if err := notify.Validate(); err != nil {
+			t.Errorf("Validate(%+v) unexpected error: %v", notify, err)
+		}
+	}
+}
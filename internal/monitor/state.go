@@ -0,0 +1,151 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// monitorState is the content of the state file. Mailboxes maps the key
+// returned by stateKey to the position of the monitor in that mailbox.
+type monitorState struct {
+	Mailboxes map[string]mailboxState `json:"mailboxes"`
+}
+
+// mailboxState records the UID of the last message that was processed in a
+// mailbox. UIDs are only meaningful for the UIDVALIDITY of the mailbox at
+// the time they were saved.
+type mailboxState struct {
+	UIDValidity uint32 `json:"uidValidity"`
+	LastUID     uint32 `json:"lastUID"`
+}
+
+// stateKey identifies a mailbox in the state file, so that monitors for
+// different accounts can share a state file
+func (em *EmailMonitor) stateKey(mailboxName string) string {
+	return fmt.Sprintf("%s@%s:%d/%s", em.config.IMAP.Username, em.config.IMAP.Server, em.config.IMAP.Port, mailboxName)
+}
+
+// loadState reads the state file, if one is configured. A missing state
+// file is not an error. The saved position in each mailbox is used when the
+// mailbox is initialized, if its UIDVALIDITY has not changed.
+func (em *EmailMonitor) loadState() error {
+	if em.config.StateFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(em.config.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read state file %s: %w", em.config.StateFile, err)
+	}
+
+	var state monitorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse state file %s: %w", em.config.StateFile, err)
+	}
+
+	em.stateMutex.Lock()
+	defer em.stateMutex.Unlock()
+	for key, saved := range state.Mailboxes {
+		em.savedState[key] = saved
+	}
+	return nil
+}
+
+// savedLastUID returns the last UID saved for a mailbox. ok is false if
+// nothing was saved, or if the saved UID is stale because the UIDVALIDITY of
+// the mailbox has changed; stale entries are discarded.
+func (em *EmailMonitor) savedLastUID(mailboxName string, uidValidity uint32) (lastUID uint32, ok bool) {
+	em.stateMutex.Lock()
+	defer em.stateMutex.Unlock()
+
+	key := em.stateKey(mailboxName)
+	saved, exists := em.savedState[key]
+	if !exists {
+		return 0, false
+	}
+	if saved.UIDValidity != uidValidity {
+		em.logger.Printf("discarding saved state for %s: UIDVALIDITY changed from %d to %d", mailboxName, saved.UIDValidity, uidValidity)
+		delete(em.savedState, key)
+		return 0, false
+	}
+	return saved.LastUID, true
+}
+
+// saveState writes the position of the monitor in each mailbox to the
+// state file, if one is configured. Entries for other accounts and
+// mailboxes are kept. The file is replaced atomically so that a crash does
+// not leave it truncated.
+func (em *EmailMonitor) saveState() error {
+	if em.config.StateFile == "" {
+		return nil
+	}
+
+	em.stateMutex.Lock()
+	defer em.stateMutex.Unlock()
+
+	for mailboxName, uidValidity := range em.uidValidity {
+		em.savedState[em.stateKey(mailboxName)] = mailboxState{
+			UIDValidity: uidValidity,
+			LastUID:     em.lastUIDs[mailboxName],
+		}
+	}
+
+	data, err := json.MarshalIndent(monitorState{Mailboxes: em.savedState}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmpFile := em.config.StateFile + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to save state to %s: %w", em.config.StateFile, err)
+	}
+	if err := os.Rename(tmpFile, em.config.StateFile); err != nil {
+		os.Remove(tmpFile) //nolint:errcheck
+		return fmt.Errorf("failed to save state to %s: %w", em.config.StateFile, err)
+	}
+	return nil
+}
+
+// persistState saves the state file, logging any error. It is used while
+// monitoring, where failing to save the state should not stop the monitor.
+func (em *EmailMonitor) persistState() {
+	if err := em.saveState(); err != nil {
+		em.logger.Printf("failed to save state: %v", err)
+	}
+}
+
+// lastUID returns the UID of the last message processed in a mailbox. ok is
+// false if the mailbox has not been initialized.
+func (em *EmailMonitor) lastUID(mailboxName string) (uid uint32, ok bool) {
+	em.stateMutex.Lock()
+	defer em.stateMutex.Unlock()
+	uid, ok = em.lastUIDs[mailboxName]
+	return uid, ok
+}
+
+// setLastUID records the UID of the last message processed in a mailbox
+func (em *EmailMonitor) setLastUID(mailboxName string, uid uint32) {
+	em.stateMutex.Lock()
+	defer em.stateMutex.Unlock()
+	em.lastUIDs[mailboxName] = uid
+}
+
+// knownUIDValidity returns the UIDVALIDITY of a mailbox when it was
+// initialized. ok is false if the mailbox has not been initialized.
+func (em *EmailMonitor) knownUIDValidity(mailboxName string) (uidValidity uint32, ok bool) {
+	em.stateMutex.Lock()
+	defer em.stateMutex.Unlock()
+	uidValidity, ok = em.uidValidity[mailboxName]
+	return uidValidity, ok
+}
+
+// setUIDValidity records the UIDVALIDITY of a mailbox
+func (em *EmailMonitor) setUIDValidity(mailboxName string, uidValidity uint32) {
+	em.stateMutex.Lock()
+	defer em.stateMutex.Unlock()
+	em.uidValidity[mailboxName] = uidValidity
+}
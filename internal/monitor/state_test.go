@@ -0,0 +1,140 @@
+package monitor
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	stateFile := t.TempDir() + "/state.json"
+
+	// Another monitor shares the state file
+	otherAccount := `{"mailboxes": {"other@imap.example.com:993/INBOX": {"uidValidity": 3, "lastUID": 99}}}`
+	if err := os.WriteFile(stateFile, []byte(otherAccount), 0644); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+
+	config := Config{
+		IMAP: IMAPConfig{
+			Server:   "imap.example.com",
+			Port:     993,
+			Username: "user",
+		},
+		StateFile: stateFile,
+		Monitor: []MailboxConfig{
+			{
+				Mailbox:  "INBOX",
+				Triggers: []TriggerConfig{{RegexPattern: "test"}},
+			},
+		},
+	}
+
+	newMonitor := func() *EmailMonitor {
+		monitor, err := NewEmailMonitor(config, &MockIMAPDialer{}, &MockCommandExecutor{}, &MockLogger{}, &MockTimer{})
+		if err != nil {
+			t.Fatalf("Failed to create monitor: %v", err)
+		}
+		if err := monitor.loadState(); err != nil {
+			t.Fatalf("loadState() failed: %v", err)
+		}
+		return monitor
+	}
+
+	saved := newMonitor()
+	saved.setUIDValidity("INBOX", 7)
+	saved.setLastUID("INBOX", 42)
+	if err := saved.saveState(); err != nil {
+		t.Fatalf("saveState() failed: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		uidValidity uint32
+		want        uint32
+		wantSearch  bool
+	}{
+		{"same UIDVALIDITY", 7, 42, false},
+		{"changed UIDVALIDITY", 8, 50, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &MockIMAPClient{
+				mailboxStatus: &imap.MailboxStatus{Messages: 50, UidValidity: tt.uidValidity},
+				searchResults: []uint32{50},
+				messages:      []*imap.Message{{Uid: 50}},
+			}
+
+			restarted := newMonitor()
+			restarted.client = mockClient
+			if err := restarted.initializeLastUIDs(); err != nil {
+				t.Fatalf("initializeLastUIDs() failed: %v", err)
+			}
+
+			if got := restarted.lastUIDs["INBOX"]; got != tt.want {
+				t.Errorf("lastUID = %d, want %d", got, tt.want)
+			}
+			if mockClient.searchCalled != tt.wantSearch {
+				t.Errorf("searched for the newest message = %v, want %v", mockClient.searchCalled, tt.wantSearch)
+			}
+		})
+	}
+
+	// The stale entry is replaced when the state is saved again, and the
+	// other account's entry is kept
+	restarted := newMonitor()
+	restarted.client = &MockIMAPClient{
+		mailboxStatus: &imap.MailboxStatus{Messages: 50, UidValidity: 8},
+		searchResults: []uint32{50},
+		messages:      []*imap.Message{{Uid: 50}},
+	}
+	if err := restarted.initializeLastUIDs(); err != nil {
+		t.Fatalf("initializeLastUIDs() failed: %v", err)
+	}
+	if err := restarted.saveState(); err != nil {
+		t.Fatalf("saveState() failed: %v", err)
+	}
+
+	reloaded := newMonitor()
+	want := map[string]mailboxState{
+		"user@imap.example.com:993/INBOX":  {UIDValidity: 8, LastUID: 50},
+		"other@imap.example.com:993/INBOX": {UIDValidity: 3, LastUID: 99},
+	}
+	for key, wantState := range want {
+		if got := reloaded.savedState[key]; got != wantState {
+			t.Errorf("saved state for %s = %+v, want %+v", key, got, wantState)
+		}
+	}
+}
+
+func TestCheckDetectsUIDValidityChange(t *testing.T) {
+	config := Config{
+		IMAP: IMAPConfig{
+			Server: "imap.example.com",
+			Port:   993,
+		},
+		Monitor: []MailboxConfig{
+			{
+				Mailbox:  "INBOX",
+				Triggers: []TriggerConfig{{RegexPattern: "test"}},
+			},
+		},
+	}
+
+	monitor, err := NewEmailMonitor(config, &MockIMAPDialer{}, &MockCommandExecutor{}, &MockLogger{}, &MockTimer{})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	monitor.client = &MockIMAPClient{
+		mailboxStatus: &imap.MailboxStatus{Messages: 1, UidValidity: 8},
+	}
+	monitor.setUIDValidity("INBOX", 7)
+	monitor.setLastUID("INBOX", 42)
+
+	if err := monitor.checkForNewMessagesInMailbox(monitor.mailboxes[0]); !errors.Is(err, ErrUIDValidityChanged) {
+		t.Errorf("checkForNewMessagesInMailbox() error = %v, want %v", err, ErrUIDValidityChanged)
+	}
+}
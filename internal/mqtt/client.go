@@ -5,24 +5,76 @@ import (
 	"fmt"
 	"log"
 	"net/url"
+	"slices"
+	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+// DefaultQueueSize is the number of topics for which switch events are
+// queued while the client is disconnected, if Config.QueueSize is not set
+const DefaultQueueSize = 100
+
+// publishTimeout limits how long a publish waits to be sent
+const publishTimeout = 5 * time.Second
+
+// disconnectFlushTimeout limits how long Disconnect spends publishing the
+// messages still queued
+const disconnectFlushTimeout = 5 * time.Second
+
 // Client provides a common MQTT client interface for the airdancer project
 type Client struct {
 	client mqtt.Client
+
+	// mutex protects connected, lastErr, and the queue
+	mutex     sync.Mutex
+	connected bool
+	lastErr   error
+	queue     []*queuedMessage
+	queueSize int
+
+	// wake is signaled when a message is queued or the client connects, to
+	// have publishLoop publish the queue
+	wake chan struct{}
+
+	// switchEventTopic is the template for switch event topics
+	switchEventTopic string
+
+	// statusTopic, if set, is where the client publishes StatusOnline when
+	// it connects and StatusOffline when it disconnects. The broker
+	// publishes StatusOffline as the client's last will if the connection
+	// is lost.
+	statusTopic string
+
+	// stop is closed by Disconnect to end the initial connection attempts
+	// and publishLoop, which closes loopDone once it has returned
+	stop     chan struct{}
+	stopOnce sync.Once
+	loopDone chan struct{}
+}
+
+// queuedMessage is a message waiting to be published, in order, by
+// publishLoop
+type queuedMessage struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  interface{}
 }
 
 // Config holds MQTT client configuration
 type Config struct {
 	ServerURL         string
 	ClientID          string
-	MaxRetries        int           // Maximum number of connection retries (0 = infinite)
-	InitialRetryDelay time.Duration // Initial delay between retries
-	MaxRetryDelay     time.Duration // Maximum delay between retries
-	OnConnect         func(*Client) // Callback to execute when connected
+	MaxRetries        int                  // Maximum number of connection retries (0 = infinite)
+	InitialRetryDelay time.Duration        // Initial delay between retries
+	MaxRetryDelay     time.Duration        // Maximum delay between retries
+	OnConnect         func(*Client)        // Callback to execute when connected
+	OnConnectionLost  func(*Client, error) // Callback to execute when the connection is lost
+	QueueSize         int                  // Topics queued while disconnected (0 = DefaultQueueSize)
+	SwitchEventTopic  string               // Topic template for switch events ("" = DefaultSwitchEventTopic)
+	StatusTopic       string               // Retained online/offline status topic, with a last will ("" = none)
 }
 
 // ButtonEvent represents a button event from the MQTT topic
@@ -54,33 +106,90 @@ func NewClient(config Config) (*Client, error) {
 		maxDelay = 30 * time.Second
 	}
 
+	queueSize := config.QueueSize
+	if queueSize == 0 {
+		queueSize = DefaultQueueSize
+	}
+	switchEventTopic := config.SwitchEventTopic
+	if switchEventTopic == "" {
+		switchEventTopic = DefaultSwitchEventTopic
+	}
+	if err := ValidateTopicTemplate(switchEventTopic); err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		queueSize:        queueSize,
+		switchEventTopic: switchEventTopic,
+		statusTopic:      config.StatusTopic,
+		stop:             make(chan struct{}),
+		loopDone:         make(chan struct{}),
+		wake:             make(chan struct{}, 1),
+	}
+	go c.publishLoop()
+
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(config.ServerURL)
 	opts.SetClientID(config.ClientID)
 	opts.SetCleanSession(true)
 	opts.SetAutoReconnect(true)
-	opts.SetMaxReconnectInterval(config.MaxRetryDelay)
+	opts.SetMaxReconnectInterval(maxDelay)
+	if c.statusTopic != "" {
+		// Subscribers keep retained states after the client dies, so have
+		// the broker tell them that it is gone
+		opts.SetWill(c.statusTopic, StatusOffline, 1, true)
+	}
 	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
 		log.Printf("MQTT connection lost: %v", err)
+		c.mutex.Lock()
+		c.connected = false
+		c.lastErr = err
+		c.mutex.Unlock()
+
+		// Execute the callback if provided
+		if config.OnConnectionLost != nil {
+			config.OnConnectionLost(c, err)
+		}
 	})
 	opts.SetOnConnectHandler(func(client mqtt.Client) {
 		log.Printf("Connected to MQTT broker at %s", config.ServerURL)
+		// Publish the status before any queued messages, which replaces
+		// the last will if it was published when the connection was lost
+		if c.statusTopic != "" {
+			if err := c.send(c.statusTopic, 1, true, StatusOnline); err != nil {
+				log.Printf("Failed to publish MQTT status: %v", err)
+			}
+		}
+		c.mutex.Lock()
+		c.connected = true
+		c.lastErr = nil
+		if len(c.queue) > 0 {
+			log.Printf("Publishing %d queued MQTT messages", len(c.queue))
+		}
+		c.mutex.Unlock()
+		c.signal()
 
 		// Execute the callback if provided
 		if config.OnConnect != nil {
-			c := &Client{client: client}
 			config.OnConnect(c)
 		}
 	})
 
 	client := mqtt.NewClient(opts)
+	c.client = client
 
-	// Start async connection with retry logic
+	// Start async connection with retry logic. Once connected, the client
+	// reconnects by itself (with the same maximum delay) if the connection
+	// is lost.
 	go func() {
 		delay := initialDelay
 		attempt := 0
 		for {
 			if token := client.Connect(); token.Wait() && token.Error() != nil {
+				c.mutex.Lock()
+				c.lastErr = token.Error()
+				c.mutex.Unlock()
+
 				attempt++
 				if config.MaxRetries > 0 && attempt >= config.MaxRetries {
 					log.Printf("Failed to connect to MQTT broker after %d attempts, giving up: %v", attempt, token.Error())
@@ -88,7 +197,11 @@ func NewClient(config Config) (*Client, error) {
 				}
 
 				log.Printf("Failed to connect to MQTT broker (attempt %d): %v. Retrying in %v...", attempt, token.Error(), delay)
-				time.Sleep(delay)
+				select {
+				case <-c.stop:
+					return
+				case <-time.After(delay):
+				}
 
 				// Exponential backoff
 				delay = delay * 2
@@ -102,22 +215,133 @@ func NewClient(config Config) (*Client, error) {
 		}
 	}()
 
-	return &Client{client: client}, nil
+	return c, nil
 }
 
 // Publish publishes a message to the specified topic
 func (c *Client) Publish(topic string, qos byte, retained bool, payload interface{}) error {
-	if c.client == nil || !c.client.IsConnected() {
+	if c.client == nil || !c.client.IsConnectionOpen() {
 		return fmt.Errorf("MQTT client is not connected")
 	}
 
-	if token := c.client.Publish(topic, qos, retained, payload); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to publish MQTT message: %w", token.Error())
+	return c.send(topic, qos, retained, payload)
+}
+
+// send publishes a message and waits for it to be sent
+func (c *Client) send(topic string, qos byte, retained bool, payload interface{}) error {
+	token := c.client.Publish(topic, qos, retained, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("failed to publish MQTT message: timed out after %v", publishTimeout)
 	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to publish MQTT message: %w", err)
+	}
+	return nil
+}
 
+// PublishQueued queues a message for the specified topic, to be published
+// in the order it was queued. Messages are published by a single goroutine,
+// so messages for a topic reach the broker in order even when publishes are
+// slow or fail. While the client is disconnected, or after a publish fails,
+// messages stay queued until it reconnects. Only the most recent message for
+// each topic is kept, so that a burst of changes to a topic is published as
+// its final state, and once the queue is full the oldest topic is dropped to
+// make room. Publish errors are logged rather than returned.
+func (c *Client) PublishQueued(topic string, qos byte, retained bool, payload interface{}) error {
+	c.mutex.Lock()
+	c.enqueue(&queuedMessage{topic: topic, qos: qos, retained: retained, payload: payload})
+	c.mutex.Unlock()
+
+	c.signal()
 	return nil
 }
 
+// signal wakes publishLoop, unless it has already been woken
+func (c *Client) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue adds msg to the end of the queue, replacing any message already
+// queued for the same topic. The caller must hold c.mutex.
+func (c *Client) enqueue(msg *queuedMessage) {
+	for i, queued := range c.queue {
+		if queued.topic == msg.topic {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			break
+		}
+	}
+
+	if len(c.queue) >= c.queueSize {
+		log.Printf("MQTT publish queue is full, dropping message for %s", c.queue[0].topic)
+		c.queue = c.queue[1:]
+	}
+	c.queue = append(c.queue, msg)
+}
+
+// publishLoop publishes queued messages each time it is woken, until the
+// client is disconnected
+func (c *Client) publishLoop() {
+	defer close(c.loopDone)
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-c.wake:
+		}
+		c.flushQueue(c.stop, time.Time{})
+	}
+}
+
+// flushQueue publishes the queued messages in order while the client is
+// connected, until stop is closed or deadline passes (if they are set). If
+// a publish fails, it and the remaining messages stay queued until the
+// next message is queued or the client reconnects. The mutex is not held
+// while publishing, so a message for a topic may be replaced while it is
+// being sent; the newer message is then published after it.
+func (c *Client) flushQueue(stop <-chan struct{}, deadline time.Time) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return
+		}
+
+		c.mutex.Lock()
+		// A client that is reconnecting silently drops messages, so only
+		// publish while the connection is open
+		if !c.connected || len(c.queue) == 0 || !c.client.IsConnectionOpen() {
+			c.mutex.Unlock()
+			return
+		}
+		msg := c.queue[0]
+		c.mutex.Unlock()
+
+		if err := c.send(msg.topic, msg.qos, msg.retained, msg.payload); err != nil {
+			log.Printf("Failed to publish queued MQTT message for %s: %v", msg.topic, err)
+			return
+		}
+
+		c.mutex.Lock()
+		if i := slices.Index(c.queue, msg); i >= 0 {
+			c.queue = slices.Delete(c.queue, i, i+1)
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// QueueLength returns the number of messages waiting to be published
+func (c *Client) QueueLength() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.queue)
+}
+
 // PublishButtonEvent publishes a button event to the appropriate MQTT topic
 func (c *Client) PublishButtonEvent(buttonName, eventName string) error {
 	event := ButtonEvent{
@@ -142,7 +366,9 @@ type SwitchEvent struct {
 	Timestamp  string `json:"timestamp"`
 }
 
-// PublishSwitchEvent publishes a switch event to the appropriate MQTT topic
+// PublishSwitchEvent publishes a switch event to the topic given by the
+// client's switch event topic template. Events published while the client is disconnected are queued
+// until it reconnects.
 func (c *Client) PublishSwitchEvent(switchName, eventName string) error {
 	event := SwitchEvent{
 		SwitchName: switchName,
@@ -155,13 +381,46 @@ func (c *Client) PublishSwitchEvent(switchName, eventName string) error {
 		return fmt.Errorf("failed to marshal event to JSON: %w", err)
 	}
 
-	topic := fmt.Sprintf("event/switch/%s/%s", switchName, eventName)
-	return c.Publish(topic, 0, false, eventJSON)
+	topic := renderTopic(c.switchEventTopic, switchName, eventName)
+	return c.PublishQueued(topic, 0, false, eventJSON)
+}
+
+// SwitchState is the current state of a switch, as published to its state
+// topic
+type SwitchState struct {
+	SwitchName string `json:"switch_name"`
+	State      string `json:"state"`
+	Timestamp  string `json:"timestamp"`
+}
+
+// SwitchStateTopic returns the topic to which the state of a switch is
+// published
+func SwitchStateTopic(switchName string) string {
+	return fmt.Sprintf("state/switch/%s", switchName)
+}
+
+// PublishSwitchState publishes the current state of a switch to its state
+// topic. If retained is set, the broker delivers the last state to clients
+// that subscribe later. Like switch events, states published while the
+// client is disconnected are queued until it reconnects.
+func (c *Client) PublishSwitchState(switchName, state string, retained bool) error {
+	switchState := SwitchState{
+		SwitchName: switchName,
+		State:      state,
+		Timestamp:  time.Now().Format(time.RFC3339),
+	}
+
+	stateJSON, err := json.Marshal(switchState)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state to JSON: %w", err)
+	}
+
+	return c.PublishQueued(SwitchStateTopic(switchName), 0, retained, stateJSON)
 }
 
 // Subscribe subscribes to a topic with the given message handler
 func (c *Client) Subscribe(topic string, qos byte, handler func(topic string, payload []byte)) error {
-	if c.client == nil || !c.client.IsConnected() {
+	if c.client == nil || !c.client.IsConnectionOpen() {
 		return fmt.Errorf("MQTT client is not connected")
 	}
 
@@ -176,14 +435,45 @@ func (c *Client) Subscribe(topic string, qos byte, handler func(topic string, pa
 	return nil
 }
 
-// IsConnected returns true if the client is connected to the MQTT broker
+// IsConnected returns true if the client is connected to the MQTT broker.
+// It is false while the client is reconnecting.
 func (c *Client) IsConnected() bool {
-	return c.client != nil && c.client.IsConnected()
+	return c.client != nil && c.client.IsConnectionOpen()
 }
 
-// Disconnect disconnects from the MQTT broker
+// LastError returns the error from the most recent failed connection
+// attempt or lost connection, or nil if the client has connected since
+func (c *Client) LastError() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lastErr
+}
+
+// Disconnect disconnects from the MQTT broker, and stops trying to connect
+// if the client has not connected yet. Queued messages are published
+// first, for up to disconnectFlushTimeout. The broker does not publish the last
+// will when the client disconnects cleanly, so the client publishes
+// StatusOffline to its status topic itself.
 func (c *Client) Disconnect(quiesce uint) {
+	if c.stop != nil {
+		c.stopOnce.Do(func() { close(c.stop) })
+	}
+	if c.loopDone != nil {
+		<-c.loopDone
+	}
 	if c.client != nil && c.client.IsConnected() {
+		// Publish what is still queued, such as the final states of
+		// switches, before going offline
+		c.flushQueue(nil, time.Now().Add(disconnectFlushTimeout))
+		if n := c.QueueLength(); n > 0 {
+			log.Printf("Dropping %d queued MQTT messages on disconnect", n)
+		}
+
+		if c.statusTopic != "" && c.client.IsConnectionOpen() {
+			if err := c.send(c.statusTopic, 1, true, StatusOffline); err != nil {
+				log.Printf("Failed to publish MQTT status: %v", err)
+			}
+		}
 		c.client.Disconnect(quiesce)
 		log.Printf("Disconnected from MQTT broker")
 	}
@@ -0,0 +1,303 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/larsks/airdancer/internal/mqtt/mqtttest"
+)
+
+// waitFor polls cond until it is true or the test times out
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// connectClient returns a client connected to broker
+func connectClient(t *testing.T, broker *mqtttest.Broker) *Client {
+	t.Helper()
+
+	client, err := NewClient(Config{
+		ServerURL:         broker.URL(),
+		ClientID:          "test",
+		InitialRetryDelay: 10 * time.Millisecond,
+		MaxRetryDelay:     100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect(0) })
+
+	waitFor(t, "connection", client.IsConnected)
+	return client
+}
+
+func TestClientQueuesSwitchEventsWhileDisconnected(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	client := connectClient(t, broker)
+
+	if err := client.PublishSwitchEvent("porch", "on"); err != nil {
+		t.Fatalf("PublishSwitchEvent() failed: %v", err)
+	}
+	broker.ExpectPublished(t, "event/switch/porch/on")
+
+	broker.Drop()
+	waitFor(t, "disconnection", func() bool { return !client.IsConnected() })
+
+	for _, event := range [][2]string{{"porch", "on"}, {"porch", "off"}, {"porch", "on"}, {"garage", "on"}} {
+		if err := client.PublishSwitchEvent(event[0], event[1]); err != nil {
+			t.Fatalf("PublishSwitchEvent(%s, %s) while disconnected failed: %v", event[0], event[1], err)
+		}
+	}
+	if got := client.QueueLength(); got != 3 {
+		t.Errorf("QueueLength() = %d, want 3", got)
+	}
+
+	broker.Restore()
+	broker.ExpectPublished(t, "event/switch/porch/off", "event/switch/porch/on", "event/switch/garage/on")
+	waitFor(t, "queue to drain", func() bool { return client.QueueLength() == 0 })
+}
+
+func TestClientRetriesUntilConnected(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	broker.Drop()
+
+	connects := make(chan struct{}, 2)
+	lost := make(chan error, 1)
+	client, err := NewClient(Config{
+		ServerURL:         broker.URL(),
+		ClientID:          "test",
+		InitialRetryDelay: 10 * time.Millisecond,
+		MaxRetryDelay:     100 * time.Millisecond,
+		OnConnect:         func(*Client) { connects <- struct{}{} },
+		OnConnectionLost:  func(_ *Client, err error) { lost <- err },
+	})
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	defer client.Disconnect(0)
+
+	waitFor(t, "a failed connection attempt", func() bool { return client.LastError() != nil })
+	if client.IsConnected() {
+		t.Fatalf("IsConnected() = true while the broker is down")
+	}
+
+	broker.Restore()
+	waitFor(t, "connection", client.IsConnected)
+	<-connects
+	if err := client.LastError(); err != nil {
+		t.Errorf("LastError() = %v after connecting, want nil", err)
+	}
+
+	broker.Drop()
+	select {
+	case err := <-lost:
+		if err == nil {
+			t.Errorf("OnConnectionLost called with a nil error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for OnConnectionLost")
+	}
+	if client.LastError() == nil {
+		t.Errorf("LastError() = nil after the connection was lost")
+	}
+}
+
+func TestPublishQueuedFinalState(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	client := connectClient(t, broker)
+
+	// publishedStates returns the states published to the porch state
+	// topic once the queue has drained and the broker has gone quiet
+	publishedStates := func() []string {
+		t.Helper()
+		waitFor(t, "queue to drain", func() bool { return client.QueueLength() == 0 })
+		var states []string
+		for {
+			select {
+			case msg := <-broker.Published:
+				var state SwitchState
+				if err := json.Unmarshal(msg.Payload, &state); err != nil {
+					t.Fatalf("Failed to decode switch state %s: %v", msg.Payload, err)
+				}
+				states = append(states, state.State)
+			case <-time.After(200 * time.Millisecond):
+				return states
+			}
+		}
+	}
+
+	// However much of the burst is coalesced, the last state published is
+	// the final one
+	for _, state := range []string{"on", "off", "on"} {
+		if err := client.PublishSwitchState("porch", state, true); err != nil {
+			t.Fatalf("PublishSwitchState(%s) failed: %v", state, err)
+		}
+	}
+	if states := publishedStates(); len(states) == 0 || states[len(states)-1] != "on" {
+		t.Errorf("Published states %q, want the last to be on", states)
+	}
+
+	// A burst while disconnected is published as just its final state
+	broker.Drop()
+	waitFor(t, "disconnection", func() bool { return !client.IsConnected() })
+	for _, state := range []string{"off", "on", "off", "on"} {
+		if err := client.PublishSwitchState("porch", state, true); err != nil {
+			t.Fatalf("PublishSwitchState(%s) failed: %v", state, err)
+		}
+	}
+	broker.Restore()
+	waitFor(t, "connection", client.IsConnected)
+	if states := publishedStates(); len(states) != 1 || states[0] != "on" {
+		t.Errorf("Published states after reconnecting %q, want just on", states)
+	}
+}
+
+func TestDisconnectFlushesQueue(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	client := connectClient(t, broker)
+
+	var topics []string
+	for i := range 20 {
+		switchName := fmt.Sprintf("switch%d", i)
+		if err := client.PublishSwitchState(switchName, "on", true); err != nil {
+			t.Fatalf("PublishSwitchState(%s) failed: %v", switchName, err)
+		}
+		topics = append(topics, SwitchStateTopic(switchName))
+	}
+	client.Disconnect(250)
+
+	if got := client.QueueLength(); got != 0 {
+		t.Errorf("QueueLength() after Disconnect = %d, want 0", got)
+	}
+	broker.ExpectPublished(t, topics...)
+}
+
+func TestPublishSwitchStateRetained(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	client := connectClient(t, broker)
+
+	if err := client.PublishSwitchState("porch", "on", true); err != nil {
+		t.Fatalf("PublishSwitchState() failed: %v", err)
+	}
+
+	msg := broker.Next(t)
+	if msg.Topic != "state/switch/porch" {
+		t.Errorf("Published topic = %q, want %q", msg.Topic, "state/switch/porch")
+	}
+	if !msg.Retained {
+		t.Errorf("Switch state was not retained")
+	}
+
+	var state SwitchState
+	if err := json.Unmarshal(msg.Payload, &state); err != nil {
+		t.Fatalf("Failed to decode switch state %s: %v", msg.Payload, err)
+	}
+	if state.SwitchName != "porch" || state.State != "on" {
+		t.Errorf("Switch state = %+v, want porch on", state)
+	}
+}
+
+func TestPublishQueuedDropsOldest(t *testing.T) {
+	client := &Client{
+		client:    mqtt.NewClient(mqtt.NewClientOptions()),
+		queueSize: 2,
+	}
+
+	for _, topic := range []string{"a", "b", "a", "c"} {
+		if err := client.PublishQueued(topic, 0, false, topic); err != nil {
+			t.Fatalf("PublishQueued(%s) failed: %v", topic, err)
+		}
+	}
+
+	if len(client.queue) != 2 || client.queue[0].topic != "a" || client.queue[1].topic != "c" {
+		t.Errorf("queue = %+v, want topics a, c", client.queue)
+	}
+}
+
+func TestSwitchEventTopicTemplate(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+
+	client, err := NewClient(Config{
+		ServerURL:        broker.URL(),
+		ClientID:         "test",
+		SwitchEventTopic: "home/{switch}/state",
+	})
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	defer client.Disconnect(0)
+	waitFor(t, "connection", client.IsConnected)
+
+	if err := client.PublishSwitchEvent("porch", "on"); err != nil {
+		t.Fatalf("PublishSwitchEvent() failed: %v", err)
+	}
+	broker.ExpectPublished(t, "home/porch/state")
+
+	if got := renderTopic("airdancer/{event}/{switch}", "porch", "blink"); got != "airdancer/blink/porch" {
+		t.Errorf("renderTopic() = %q, want %q", got, "airdancer/blink/porch")
+	}
+}
+
+func TestValidateTopicTemplate(t *testing.T) {
+	for _, template := range []string{DefaultSwitchEventTopic, "home/{switch}/state", "airdancer/events"} {
+		if err := ValidateTopicTemplate(template); err != nil {
+			t.Errorf("ValidateTopicTemplate(%q) unexpected error: %v", template, err)
+		}
+	}
+
+	for _, template := range []string{"", "home/{name}/state", "home/{switch/state", "home/switch}/state", "home/+/{switch}", "home/{switch}/#"} {
+		if err := ValidateTopicTemplate(template); !errors.Is(err, ErrInvalidTopicTemplate) {
+			t.Errorf("ValidateTopicTemplate(%q) error = %v, want %v", template, err, ErrInvalidTopicTemplate)
+		}
+	}
+
+	if _, err := NewClient(Config{ServerURL: "mqtt://localhost:1883", SwitchEventTopic: "home/{name}"}); !errors.Is(err, ErrInvalidTopicTemplate) {
+		t.Errorf("NewClient() with an invalid template error = %v, want %v", err, ErrInvalidTopicTemplate)
+	}
+}
+
+func TestStatusTopicLastWill(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+
+	client, err := NewClient(Config{
+		ServerURL:   broker.URL(),
+		ClientID:    "test",
+		StatusTopic: DefaultStatusTopic,
+	})
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	defer client.Disconnect(0)
+	waitFor(t, "connection", client.IsConnected)
+
+	will, ok := broker.Will()
+	if !ok {
+		t.Fatalf("Client connected without a last will")
+	}
+	if will.Topic != "airdancer/status" || string(will.Payload) != "offline" || !will.Retained {
+		t.Errorf("Last will = %s %q (retained %v), want airdancer/status \"offline\" (retained)", will.Topic, will.Payload, will.Retained)
+	}
+
+	msg := broker.Next(t)
+	if msg.Topic != "airdancer/status" || string(msg.Payload) != "online" || !msg.Retained {
+		t.Errorf("Published %s %q (retained %v) after connecting, want airdancer/status \"online\" (retained)", msg.Topic, msg.Payload, msg.Retained)
+	}
+
+	client.Disconnect(0)
+	msg = broker.Next(t)
+	if msg.Topic != "airdancer/status" || string(msg.Payload) != "offline" || !msg.Retained {
+		t.Errorf("Published %s %q (retained %v) when disconnecting, want airdancer/status \"offline\" (retained)", msg.Topic, msg.Payload, msg.Retained)
+	}
+}
@@ -0,0 +1,8 @@
+package mqtt
+
+import "errors"
+
+// Configuration errors
+var (
+	ErrInvalidTopicTemplate = errors.New("invalid MQTT topic template")
+)
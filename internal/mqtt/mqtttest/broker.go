@@ -0,0 +1,173 @@
+// Package mqtttest provides a minimal MQTT broker for tests.
+package mqtttest
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// Message is a message published to the broker
+type Message struct {
+	Topic    string
+	Payload  []byte
+	Retained bool
+}
+
+// Broker is a minimal MQTT broker that accepts connections, records
+// published messages, and can simulate an outage. It acknowledges
+// subscriptions but does not deliver messages to subscribers.
+type Broker struct {
+	listener net.Listener
+
+	// Published receives every message published to the broker
+	Published chan Message
+
+	mutex sync.Mutex
+	down  bool
+	conns []net.Conn
+	will  *Message
+}
+
+// NewBroker starts a broker listening on a local port. It is stopped when
+// the test finishes.
+func NewBroker(t *testing.T) *Broker {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	b := &Broker{listener: listener, Published: make(chan Message, 100)}
+	go b.serve()
+	t.Cleanup(func() {
+		listener.Close() //nolint:errcheck
+		b.Drop()
+	})
+	return b
+}
+
+// URL returns the mqtt:// URL of the broker
+func (b *Broker) URL() string {
+	return "mqtt://" + b.listener.Addr().String()
+}
+
+func (b *Broker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		b.mutex.Lock()
+		if b.down {
+			conn.Close() //nolint:errcheck
+		} else {
+			b.conns = append(b.conns, conn)
+			go b.handle(conn)
+		}
+		b.mutex.Unlock()
+	}
+}
+
+func (b *Broker) handle(conn net.Conn) {
+	defer conn.Close() //nolint:errcheck
+
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		var reply packets.ControlPacket
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			if p.WillFlag {
+				b.mutex.Lock()
+				b.will = &Message{Topic: p.WillTopic, Payload: p.WillMessage, Retained: p.WillRetain}
+				b.mutex.Unlock()
+			}
+			reply = packets.NewControlPacket(packets.Connack)
+		case *packets.PublishPacket:
+			b.Published <- Message{Topic: p.TopicName, Payload: p.Payload, Retained: p.Retain}
+			if p.Qos > 0 {
+				puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				puback.MessageID = p.MessageID
+				reply = puback
+			}
+		case *packets.SubscribePacket:
+			suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			suback.MessageID = p.MessageID
+			suback.ReturnCodes = p.Qoss
+			reply = suback
+		case *packets.PingreqPacket:
+			reply = packets.NewControlPacket(packets.Pingresp)
+		case *packets.DisconnectPacket:
+			return
+		}
+
+		if reply != nil {
+			if err := reply.Write(conn); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Drop closes every client connection and refuses new ones until Restore
+// is called
+func (b *Broker) Drop() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.down = true
+	for _, conn := range b.conns {
+		conn.Close() //nolint:errcheck
+	}
+	b.conns = nil
+}
+
+// Restore accepts connections again after Drop
+func (b *Broker) Restore() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.down = false
+}
+
+// Will returns the last will set by the most recent client that connected
+// with one
+func (b *Broker) Will() (Message, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.will == nil {
+		return Message{}, false
+	}
+	return *b.will, true
+}
+
+// Next returns the next message published to the broker, failing the test
+// if none arrives within a few seconds
+func (b *Broker) Next(t *testing.T) Message {
+	t.Helper()
+	select {
+	case msg := <-b.Published:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for a published message")
+		return Message{}
+	}
+}
+
+// ExpectPublished fails the test unless the broker receives messages for
+// topics, in order
+func (b *Broker) ExpectPublished(t *testing.T, topics ...string) {
+	t.Helper()
+	for _, want := range topics {
+		if got := b.Next(t).Topic; got != want {
+			t.Fatalf("Published topic = %q, want %q", got, want)
+		}
+	}
+}
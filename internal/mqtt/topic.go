@@ -0,0 +1,53 @@
+package mqtt
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultSwitchEventTopic is the topic template used for switch events if
+// Config.SwitchEventTopic is not set
+const DefaultSwitchEventTopic = "event/switch/{switch}/{event}"
+
+// DefaultStatusTopic is the topic to which a client publishes whether it is
+// online, for clients that set Config.StatusTopic to it
+const DefaultStatusTopic = "airdancer/status"
+
+// Payloads published to a client's status topic
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
+// topicPlaceholder matches a placeholder in a topic template
+var topicPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// ValidateTopicTemplate checks that a topic template only uses the
+// {switch} and {event} placeholders and produces a valid topic name
+func ValidateTopicTemplate(template string) error {
+	if template == "" {
+		return fmt.Errorf("%w: template is empty", ErrInvalidTopicTemplate)
+	}
+
+	for _, placeholder := range topicPlaceholder.FindAllString(template, -1) {
+		if placeholder != "{switch}" && placeholder != "{event}" {
+			return fmt.Errorf("%w: unknown placeholder %s in %q", ErrInvalidTopicTemplate, placeholder, template)
+		}
+	}
+
+	literal := topicPlaceholder.ReplaceAllString(template, "")
+	if strings.ContainsAny(literal, "{}") {
+		return fmt.Errorf("%w: unbalanced braces in %q", ErrInvalidTopicTemplate, template)
+	}
+	if strings.ContainsAny(literal, "+#\x00") {
+		return fmt.Errorf("%w: %q contains a wildcard or null character", ErrInvalidTopicTemplate, template)
+	}
+
+	return nil
+}
+
+// renderTopic expands the placeholders in a topic template
+func renderTopic(template, switchName, eventName string) string {
+	return strings.NewReplacer("{switch}", switchName, "{event}", eventName).Replace(template)
+}
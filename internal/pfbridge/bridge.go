@@ -0,0 +1,218 @@
+// Package pfbridge forwards PiFace input changes to the airdancer API, so that
+// buttons wired to a local PiFace board can control remote switches and groups.
+package pfbridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/larsks/airdancer/internal/buttondriver/common"
+)
+
+// Mode determines how an input change is translated into an API request.
+type Mode string
+
+const (
+	// ModeToggle toggles the target each time the input is pressed.
+	ModeToggle Mode = "toggle"
+	// ModeFollow turns the target on while the input is active and off when it is released.
+	ModeFollow Mode = "follow"
+)
+
+const numberOfInputs = 8
+
+// InputReader reads the state of all inputs as a bit vector.
+type InputReader interface {
+	ReadInputs() (uint8, error)
+}
+
+// HTTPClient interface for testing
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Mapping associates an input pin with an API switch or group.
+type Mapping struct {
+	Pin    uint8
+	Target string
+	Mode   Mode
+}
+
+// ParseMapping parses a mapping of the form pin:target[:mode].
+func ParseMapping(arg string) (Mapping, error) {
+	parts := strings.Split(arg, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Mapping{}, fmt.Errorf("format must be pin:target[:mode]")
+	}
+
+	pin, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return Mapping{}, fmt.Errorf("invalid pin number '%s': %v", parts[0], err)
+	}
+	if pin >= numberOfInputs {
+		return Mapping{}, fmt.Errorf("invalid pin number %d: must be 0-%d", pin, numberOfInputs-1)
+	}
+
+	if parts[1] == "" {
+		return Mapping{}, fmt.Errorf("target for pin %d cannot be empty", pin)
+	}
+
+	mode := ModeToggle
+	if len(parts) == 3 {
+		mode = Mode(parts[2])
+		if mode != ModeToggle && mode != ModeFollow {
+			return Mapping{}, fmt.Errorf("invalid mode '%s': must be '%s' or '%s'", parts[2], ModeToggle, ModeFollow)
+		}
+	}
+
+	return Mapping{
+		Pin:    uint8(pin),
+		Target: parts[1],
+		Mode:   mode,
+	}, nil
+}
+
+// Bridge polls a set of inputs and issues API requests when a mapped input
+// changes state.
+type Bridge struct {
+	inputs        InputReader
+	client        HTTPClient
+	serverURL     string
+	mappings      []Mapping
+	debounceDelay time.Duration
+	now           func() time.Time
+
+	initialized bool
+	pins        [numberOfInputs]common.Debouncer
+}
+
+// NewBridge creates a new Bridge that reads from inputs and sends requests to
+// the API server at serverURL using client.
+func NewBridge(inputs InputReader, client HTTPClient, serverURL string, mappings []Mapping, debounceDelay time.Duration) (*Bridge, error) {
+	if len(mappings) == 0 {
+		return nil, fmt.Errorf("at least one mapping is required")
+	}
+
+	seen := make(map[uint8]bool)
+	for _, m := range mappings {
+		if seen[m.Pin] {
+			return nil, fmt.Errorf("pin %d is mapped more than once", m.Pin)
+		}
+		seen[m.Pin] = true
+	}
+
+	return &Bridge{
+		inputs:        inputs,
+		client:        client,
+		serverURL:     strings.TrimSuffix(serverURL, "/"),
+		mappings:      mappings,
+		debounceDelay: debounceDelay,
+		now:           time.Now,
+	}, nil
+}
+
+// Run polls the inputs every interval until stop is closed.
+func (b *Bridge) Run(stop <-chan struct{}, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			if err := b.Poll(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Poll reads the inputs once and sends API requests for any mapped inputs
+// whose debounced state has changed. Failed API requests are logged but do not
+// cause Poll to return an error; only a failure to read the inputs does.
+func (b *Bridge) Poll() error {
+	val, err := b.inputs.ReadInputs()
+	if err != nil {
+		return fmt.Errorf("failed to read inputs: %w", err)
+	}
+	now := b.now()
+
+	// The first reading establishes the initial state without generating events
+	if !b.initialized {
+		for pin := range b.pins {
+			state := (val>>pin)&0x1 != 0
+			b.pins[pin] = common.NewDebouncer(state, now)
+		}
+		b.initialized = true
+		return nil
+	}
+
+	for _, m := range b.mappings {
+		state := (val>>m.Pin)&0x1 != 0
+		changed, pressed := b.pins[m.Pin].Update(state, now, b.debounceDelay)
+		if !changed {
+			continue
+		}
+
+		if err := b.handleChange(m, pressed); err != nil {
+			log.Printf("failed to update %s for input %d: %v", m.Target, m.Pin, err)
+		}
+	}
+
+	return nil
+}
+
+// handleChange sends the API request corresponding to an input change.
+func (b *Bridge) handleChange(m Mapping, pressed bool) error {
+	var state string
+	switch m.Mode {
+	case ModeFollow:
+		state = "off"
+		if pressed {
+			state = "on"
+		}
+	default:
+		// Toggle only on press
+		if !pressed {
+			return nil
+		}
+		state = "toggle"
+	}
+
+	log.Printf("input %d changed (pressed=%t): setting %s to %s", m.Pin, pressed, m.Target, state)
+	return b.sendSwitchRequest(m.Target, state)
+}
+
+// sendSwitchRequest posts a state change for target to the API server.
+func (b *Bridge) sendSwitchRequest(target, state string) error {
+	reqBody, err := json.Marshal(map[string]string{"state": state})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", b.serverURL+"/switch/"+target, strings.NewReader(string(reqBody)))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+package pfbridge
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeInputs struct {
+	val uint8
+}
+
+func (f *fakeInputs) ReadInputs() (uint8, error) {
+	return f.val, nil
+}
+
+type recordedRequest struct {
+	path  string
+	state string
+}
+
+type fakeClient struct {
+	mutex    sync.Mutex
+	requests []recordedRequest
+}
+
+func (c *fakeClient) Do(req *http.Request) (*http.Response, error) {
+	var body map[string]string
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.requests = append(c.requests, recordedRequest{path: req.URL.Path, state: body["state"]})
+	c.mutex.Unlock()
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`{"status":"ok"}`)),
+	}, nil
+}
+
+// testBridge creates a bridge with a controllable clock
+func testBridge(t *testing.T, mappings []Mapping) (*Bridge, *fakeInputs, *fakeClient, *time.Time) {
+	inputs := &fakeInputs{}
+	client := &fakeClient{}
+	bridge, err := NewBridge(inputs, client, "http://example.com/", mappings, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewBridge() error: %v", err)
+	}
+
+	now := time.Unix(0, 0)
+	bridge.now = func() time.Time { return now }
+
+	if err := bridge.Poll(); err != nil {
+		t.Fatalf("initial Poll() error: %v", err)
+	}
+
+	return bridge, inputs, client, &now
+}
+
+// settle polls the bridge until the current input state is past the debounce delay
+func settle(t *testing.T, b *Bridge, now *time.Time) {
+	for range 3 {
+		if err := b.Poll(); err != nil {
+			t.Fatalf("Poll() error: %v", err)
+		}
+		*now = now.Add(30 * time.Millisecond)
+	}
+}
+
+func TestParseMapping(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    Mapping
+		wantErr bool
+	}{
+		{"0:lamp1", Mapping{Pin: 0, Target: "lamp1", Mode: ModeToggle}, false},
+		{"7:group1:follow", Mapping{Pin: 7, Target: "group1", Mode: ModeFollow}, false},
+		{"3:all:toggle", Mapping{Pin: 3, Target: "all", Mode: ModeToggle}, false},
+		{"8:lamp1", Mapping{}, true},
+		{"x:lamp1", Mapping{}, true},
+		{"0:", Mapping{}, true},
+		{"0", Mapping{}, true},
+		{"0:lamp1:blink", Mapping{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := ParseMapping(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMapping(%q) error = %v, wantErr %v", tt.arg, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseMapping(%q) = %+v, want %+v", tt.arg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBridge_DuplicatePin(t *testing.T) {
+	_, err := NewBridge(&fakeInputs{}, &fakeClient{}, "http://example.com", []Mapping{
+		{Pin: 0, Target: "a", Mode: ModeToggle},
+		{Pin: 0, Target: "b", Mode: ModeToggle},
+	}, 0)
+	if err == nil {
+		t.Error("NewBridge() expected error for duplicate pin")
+	}
+}
+
+func TestBridge_Toggle(t *testing.T) {
+	bridge, inputs, client, now := testBridge(t, []Mapping{
+		{Pin: 0, Target: "lamp1", Mode: ModeToggle},
+	})
+
+	// Press and release input 0
+	inputs.val = 0x01
+	settle(t, bridge, now)
+	inputs.val = 0x00
+	settle(t, bridge, now)
+
+	if len(client.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d: %+v", len(client.requests), client.requests)
+	}
+	if client.requests[0].path != "/switch/lamp1" || client.requests[0].state != "toggle" {
+		t.Errorf("unexpected request: %+v", client.requests[0])
+	}
+}
+
+func TestBridge_Follow(t *testing.T) {
+	bridge, inputs, client, now := testBridge(t, []Mapping{
+		{Pin: 2, Target: "group1", Mode: ModeFollow},
+	})
+
+	inputs.val = 0x04
+	settle(t, bridge, now)
+	inputs.val = 0x00
+	settle(t, bridge, now)
+
+	if len(client.requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d: %+v", len(client.requests), client.requests)
+	}
+	if client.requests[0].state != "on" || client.requests[1].state != "off" {
+		t.Errorf("unexpected requests: %+v", client.requests)
+	}
+}
+
+func TestBridge_Debounce(t *testing.T) {
+	bridge, inputs, client, now := testBridge(t, []Mapping{
+		{Pin: 0, Target: "lamp1", Mode: ModeFollow},
+	})
+
+	// Bounce the input faster than the debounce delay
+	for i := 1; i <= 10; i++ {
+		inputs.val = uint8(i % 2)
+		if err := bridge.Poll(); err != nil {
+			t.Fatalf("Poll() error: %v", err)
+		}
+		*now = now.Add(10 * time.Millisecond)
+	}
+
+	// Input ends up released, which matches the initial state
+	settle(t, bridge, now)
+
+	if len(client.requests) != 0 {
+		t.Errorf("expected no requests for bouncing input, got %+v", client.requests)
+	}
+}
+
+func TestBridge_UnmappedInputsIgnored(t *testing.T) {
+	bridge, inputs, client, now := testBridge(t, []Mapping{
+		{Pin: 0, Target: "lamp1", Mode: ModeToggle},
+	})
+
+	inputs.val = 0xFE
+	settle(t, bridge, now)
+
+	if len(client.requests) != 0 {
+		t.Errorf("expected no requests for unmapped inputs, got %+v", client.requests)
+	}
+}
+
+func TestBridge_DebounceGlitchWhileHeld(t *testing.T) {
+	bridge, inputs, client, now := testBridge(t, []Mapping{
+		{Pin: 0, Target: "lamp1", Mode: ModeFollow},
+	})
+
+	inputs.val = 0x01
+	settle(t, bridge, now)
+
+	// A release shorter than the debounce delay while the input is held
+	// is ignored
+	inputs.val = 0x00
+	if err := bridge.Poll(); err != nil {
+		t.Fatalf("Poll() error: %v", err)
+	}
+	*now = now.Add(20 * time.Millisecond)
+	inputs.val = 0x01
+	settle(t, bridge, now)
+
+	if len(client.requests) != 1 || client.requests[0].state != "on" {
+		t.Errorf("expected a single on request, got %+v", client.requests)
+	}
+}
+
+func TestBridge_RepeatedStableState(t *testing.T) {
+	bridge, inputs, client, now := testBridge(t, []Mapping{
+		{Pin: 0, Target: "lamp1", Mode: ModeToggle},
+	})
+
+	// Holding the input down is a single press, however often it is read
+	inputs.val = 0x01
+	for range 5 {
+		settle(t, bridge, now)
+	}
+
+	if len(client.requests) != 1 {
+		t.Errorf("expected 1 request for a held input, got %d: %+v", len(client.requests), client.requests)
+	}
+}
@@ -1,6 +1,7 @@
 package piface
 
 import (
+	"context"
 	"fmt"
 	"log"
 
@@ -32,7 +33,8 @@ type PiFace struct {
 	spiPort     spi.PortCloser
 	spiConn     spi.Conn
 	offOnClose  bool
-	maxSwitches uint
+	outputs     []uint8
+	names       []string
 }
 
 // Helper functions for bit operations and validation
@@ -43,6 +45,43 @@ func validatePin(pin uint8) error {
 	return nil
 }
 
+// ValidateOutputs checks that outputs is a non-empty list of distinct output
+// numbers in the range 0-7, and that names (if provided) has one entry per output.
+func ValidateOutputs(outputs []uint8, names []string) error {
+	if len(outputs) == 0 {
+		return ErrNoOutputs
+	}
+	if len(outputs) > NUMBER_OF_OUTPUTS {
+		return ErrTooManySwitches
+	}
+
+	seen := make(map[uint8]bool)
+	for _, output := range outputs {
+		if err := validatePin(output); err != nil {
+			return err
+		}
+		if seen[output] {
+			return fmt.Errorf("%w: %d", ErrDuplicateOutput, output)
+		}
+		seen[output] = true
+	}
+
+	if len(names) > 0 && len(names) != len(outputs) {
+		return fmt.Errorf("%w: got %d names for %d outputs", ErrOutputNamesMismatch, len(names), len(outputs))
+	}
+
+	return nil
+}
+
+// outputMask returns a bitmask with a bit set for each output in outputs.
+func outputMask(outputs []uint8) uint8 {
+	var mask uint8
+	for _, output := range outputs {
+		mask = setBit(mask, output, true)
+	}
+	return mask
+}
+
 func setBit(value uint8, pin uint8, state bool) uint8 {
 	if state {
 		return value | (1 << pin)
@@ -55,6 +94,30 @@ func getBit(value uint8, pin uint8) bool {
 }
 
 func NewPiFace(offOnClose bool, spiPortName string, maxSwitches uint) (*PiFace, error) {
+	if maxSwitches > NUMBER_OF_OUTPUTS {
+		return nil, ErrTooManySwitches
+	}
+
+	if maxSwitches == 0 {
+		maxSwitches = NUMBER_OF_OUTPUTS
+	}
+
+	outputs := make([]uint8, maxSwitches)
+	for i := range outputs {
+		outputs[i] = uint8(i)
+	}
+
+	return NewPiFaceWithOutputs(offOnClose, spiPortName, outputs, nil)
+}
+
+// NewPiFaceWithOutputs creates a PiFace that manages only the given outputs. Switch
+// index i refers to physical output outputs[i]. If names is non-empty, it must have
+// the same length as outputs and provides a name for each switch.
+func NewPiFaceWithOutputs(offOnClose bool, spiPortName string, outputs []uint8, names []string) (*PiFace, error) {
+	if err := ValidateOutputs(outputs, names); err != nil {
+		return nil, err
+	}
+
 	// Initialize periph.io host
 	if _, err := host.Init(); err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrPeriphInitFailed, err)
@@ -73,20 +136,13 @@ func NewPiFace(offOnClose bool, spiPortName string, maxSwitches uint) (*PiFace,
 	}
 	log.Printf("opened piface device at %s", spiPortName)
 
-	if maxSwitches > NUMBER_OF_OUTPUTS {
-		return nil, ErrTooManySwitches
-	}
-
-	if maxSwitches == 0 {
-		maxSwitches = NUMBER_OF_OUTPUTS
-	}
-
 	return &PiFace{
 		spiPortName: spiPortName,
 		spiPort:     spiPort,
 		spiConn:     spiConn,
 		offOnClose:  offOnClose,
-		maxSwitches: maxSwitches,
+		outputs:     outputs,
+		names:       names,
 	}, nil
 }
 
@@ -122,6 +178,12 @@ func (pf *PiFace) Close() error {
 	return pf.spiPort.Close()
 }
 
+// HealthCheck always succeeds; the PiFace is attached locally and is
+// verified when it is initialized
+func (pf *PiFace) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
 func (pf *PiFace) writeRegister(reg, value uint8) error {
 	// Hardware CS is handled automatically by the SPI subsystem
 	write := []byte{OPCODE_WRITE, reg, value}
@@ -16,6 +16,13 @@ var (
 	ErrTooManySwitches  = errors.New("cannot more switches than available outputs")
 )
 
+// Output selection errors
+var (
+	ErrNoOutputs           = errors.New("at least one output is required")
+	ErrDuplicateOutput     = errors.New("duplicate output")
+	ErrOutputNamesMismatch = errors.New("number of output names does not match number of outputs")
+)
+
 // Register operation errors
 var (
 	ErrRegisterWrite = errors.New("failed to write register")
@@ -3,11 +3,14 @@ package piface
 import (
 	"fmt"
 	"log"
+
+	"github.com/larsks/airdancer/internal/switchcollection"
 )
 
 type PiFaceOutput struct {
-	pf  *PiFace
-	pin uint8
+	pf   *PiFace
+	pin  uint8
+	name string
 }
 
 // PiFaceOutput methods
@@ -56,6 +59,17 @@ func (pfo *PiFaceOutput) IsDisabled() bool {
 	return false
 }
 
+// GetName returns the configured name of the output, or an empty string
+// if the output is unnamed.
+func (pfo *PiFaceOutput) GetName() string {
+	return pfo.name
+}
+
+var _ switchcollection.Labeler = (*PiFaceOutput)(nil)
+
 func (pfo *PiFaceOutput) String() string {
+	if pfo.name != "" {
+		return fmt.Sprintf("%s:%d(%s)", pfo.pf, pfo.pin, pfo.name)
+	}
 	return fmt.Sprintf("%s:%d", pfo.pf, pfo.pin)
 }
@@ -89,12 +89,12 @@ func (pf *PiFace) String() string {
 
 // SwitchCollection interface implementation
 func (pf *PiFace) CountSwitches() uint {
-	return pf.maxSwitches
+	return uint(len(pf.outputs))
 }
 
 func (pf *PiFace) ListSwitches() []switchcollection.Switch {
 	var switches []switchcollection.Switch
-	for i := range pf.maxSwitches {
+	for i := range pf.CountSwitches() {
 		if sw, err := pf.GetSwitch(i); err == nil {
 			switches = append(switches, sw)
 		}
@@ -104,74 +104,58 @@ func (pf *PiFace) ListSwitches() []switchcollection.Switch {
 }
 
 func (pf *PiFace) GetSwitch(id uint) (switchcollection.Switch, error) {
-	if id > 7 {
-		return nil, fmt.Errorf("%w: %d (must be 0-7)", ErrInvalidSwitchID, id)
+	if id >= pf.CountSwitches() {
+		return nil, fmt.Errorf("%w: %d (must be 0-%d)", ErrInvalidSwitchID, id, pf.CountSwitches()-1)
 	}
+
+	var name string
+	if len(pf.names) > 0 {
+		name = pf.names[id]
+	}
+
 	return &PiFaceOutput{
-		pf:  pf,
-		pin: uint8(id),
+		pf:   pf,
+		pin:  pf.outputs[id],
+		name: name,
 	}, nil
 }
 
-func setLowerBits(original, newValues uint8, writableBits uint8) uint8 {
-	// 1. Create a mask for the bits we want to update.
-	//    If writableBits is N, we need a mask with N ones at the end.
-	//    (1 << N) creates a 1 at position N. Subtracting 1 flips all lower bits to 1.
-	//    Example (writableBits = 6):
-	//    1 << 6  -> 01000000
-	//    - 1     -> 00111111 (this is our updateMask, 0x3F)
-	updateMask := uint8((1 << writableBits) - 1)
-
-	// 2. Use the bit clear operator (&^) to clear the lower bits in the original value.
-	//    This is equivalent to `original & (^updateMask)`.
-	//    Example (original = 11010101, updateMask = 00111111):
-	//    11010101 &^ 00111111  ->  11000000
-	preservedBits := original &^ updateMask
-
-	// 3. Ensure the new values only affect the bits within the mask.
-	//    Example (newValues = 00001100, updateMask = 00111111):
-	//    00001100 & 00111111  ->  00001100
-	newBits := newValues & updateMask
-
-	// 4. Combine the preserved upper bits with the new lower bits.
-	//    11000000 | 00001100  ->  11001100
-	return preservedBits | newBits
-}
-
-// TurnOn turns on all managed outputs (that is, outputs
-// up to pf.maxSwitches).
+// TurnOn turns on all managed outputs.
 func (pf *PiFace) TurnOn() error {
 	log.Printf("turn on all switches on %s", pf)
 	outputs, err := pf.ReadOutputs()
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrSwitchTurnOn, err)
 	}
-	outputs = setLowerBits(outputs, 0xff, uint8(pf.maxSwitches))
+	outputs |= outputMask(pf.outputs)
 	if err := pf.WriteOutputs(outputs); err != nil {
 		return fmt.Errorf("%w: %v", ErrSwitchTurnOn, err)
 	}
 	return nil
 }
 
+// TurnOff turns off all managed outputs.
 func (pf *PiFace) TurnOff() error {
 	log.Printf("turn off all switches on %s", pf)
 	outputs, err := pf.ReadOutputs()
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrSwitchTurnOn, err)
+		return fmt.Errorf("%w: %v", ErrSwitchTurnOff, err)
 	}
-	outputs = setLowerBits(outputs, 0x00, uint8(pf.maxSwitches))
+	outputs &^= outputMask(pf.outputs)
 	if err := pf.WriteOutputs(outputs); err != nil {
 		return fmt.Errorf("%w: %v", ErrSwitchTurnOff, err)
 	}
 	return nil
 }
 
+// GetState returns true if all managed outputs are on.
 func (pf *PiFace) GetState() (bool, error) {
 	outputs, err := pf.ReadOutputs()
 	if err != nil {
 		return false, fmt.Errorf("%w: %v", ErrGetState, err)
 	}
-	return outputs == 0xFF, nil
+	mask := outputMask(pf.outputs)
+	return outputs&mask == mask, nil
 }
 
 func (pf *PiFace) GetDetailedState() ([]bool, error) {
@@ -180,9 +164,9 @@ func (pf *PiFace) GetDetailedState() ([]bool, error) {
 		return nil, fmt.Errorf("%w: %v", ErrGetDetailedState, err)
 	}
 
-	states := make([]bool, pf.maxSwitches)
-	for i := 0; i < int(pf.maxSwitches); i++ {
-		states[i] = getBit(outputs, uint8(i))
+	states := make([]bool, len(pf.outputs))
+	for i, output := range pf.outputs {
+		states[i] = getBit(outputs, output)
 	}
 	return states, nil
 }
@@ -332,3 +332,53 @@ func TestBitManipulationScenarios(t *testing.T) {
 		}
 	})
 }
+
+func TestValidateOutputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		outputs []uint8
+		names   []string
+		wantErr error
+	}{
+		{"all outputs", []uint8{0, 1, 2, 3, 4, 5, 6, 7}, nil, nil},
+		{"subset", []uint8{0, 1, 5}, nil, nil},
+		{"subset with names", []uint8{5, 0}, []string{"fan", "light"}, nil},
+		{"empty", []uint8{}, nil, ErrNoOutputs},
+		{"out of range", []uint8{0, 8}, nil, ErrInvalidPin},
+		{"duplicate", []uint8{1, 1}, nil, ErrDuplicateOutput},
+		{"name count mismatch", []uint8{0, 1}, []string{"fan"}, ErrOutputNamesMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateOutputs(tt.outputs, tt.names)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("ValidateOutputs() unexpected error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateOutputs() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOutputMask(t *testing.T) {
+	tests := []struct {
+		outputs []uint8
+		expect  uint8
+	}{
+		{[]uint8{}, 0x00},
+		{[]uint8{0, 1, 5}, 0x23},
+		{[]uint8{7}, 0x80},
+		{[]uint8{0, 1, 2, 3, 4, 5, 6, 7}, 0xFF},
+	}
+
+	for _, tt := range tests {
+		if got := outputMask(tt.outputs); got != tt.expect {
+			t.Errorf("outputMask(%v) = %02x, want %02x", tt.outputs, got, tt.expect)
+		}
+	}
+}
@@ -1,31 +1,75 @@
 package soundboard
 
 import (
+	"errors"
 	"fmt"
-	"os/exec"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/larsks/airdancer/internal/clock"
 )
 
-// AudioPlayer handles server-side audio playback
+// AudioPlayer handles server-side audio playback. There is a single player
+// shared by all clients; mutex serializes play and stop requests. A new sound
+// stops the one that is playing unless it is played with Overlap, so
+// normally at most one sound is playing at a time.
 type AudioPlayer struct {
 	config           *Config
-	currentProcess   *exec.Cmd
+	runner           CommandRunner
+	clock            clock.Clock
+	currentProcess   Process
 	currentSoundFile string
 	playbackStarted  time.Time
 	lastError        error
 	mutex            sync.Mutex
+
+	// maxDuration, if set, is how long the current sound may play before
+	// stopTimer stops it
+	maxDuration time.Duration
+	stopTimer   clock.Timer
+
+	// overlapped holds the sounds that are still playing after a sound
+	// played with Overlap replaced them as the current sound, with the
+	// timers (or nil) that stop them at their maximum play time
+	overlapped map[Process]clock.Timer
 }
 
-// NewAudioPlayer creates a new AudioPlayer instance
-func NewAudioPlayer(config *Config) *AudioPlayer {
+// PlayOptions are optional settings for playing a sound
+type PlayOptions struct {
+	// Card is the sound card to play on instead of the configured device.
+	// It should be validated with ValidateCard first.
+	Card string
+	// MaxDuration, if set, stops the sound after it has played this long.
+	// It cannot extend the limit set by max-play-seconds.
+	MaxDuration time.Duration
+	// Overlap leaves the sounds that are playing running, rather than
+	// stopping them before the new sound starts
+	Overlap bool
+}
+
+// NewAudioPlayer creates a new AudioPlayer instance that runs commands with
+// runner
+func NewAudioPlayer(config *Config, runner CommandRunner) *AudioPlayer {
 	return &AudioPlayer{
 		config: config,
+		runner: runner,
+		clock:  clock.Real,
 	}
 }
 
+// NewAudioPlayerWithDefaults creates a new AudioPlayer that runs commands
+// with os/exec
+func NewAudioPlayerWithDefaults(config *Config) *AudioPlayer {
+	return NewAudioPlayer(config, &RealCommandRunner{})
+}
+
 // IsServerMode returns true if audio playback should happen on the server
 // This is now determined by the API call, not configuration
 func (ap *AudioPlayer) IsServerMode() bool {
@@ -34,21 +78,36 @@ func (ap *AudioPlayer) IsServerMode() bool {
 
 // PlaySound plays a sound file using the configured ALSA device
 func (ap *AudioPlayer) PlaySound(soundFilePath string) error {
+	return ap.Play(soundFilePath, PlayOptions{})
+}
+
+// Play plays a sound file with the given options
+func (ap *AudioPlayer) Play(soundFilePath string, opts PlayOptions) error {
 	ap.mutex.Lock()
 	defer ap.mutex.Unlock()
 
-	// Stop any currently playing sound
-	ap.stopCurrentSound() //nolint:errcheck
+	// A player command can only play on the requested card if it says
+	// where the device goes
+	if playerCommand, _ := ap.config.GetPlayerCommand(); playerCommand != nil && opts.Card != "" && !playerCommandHas(playerCommand, "{device}") {
+		return fmt.Errorf("%w: player-command does not contain {device}, so it cannot play on card %s", ErrInvalidDevice, opts.Card)
+	}
+
+	// Stop any currently playing sounds, or let them play on
+	if opts.Overlap {
+		ap.overlapCurrentSound()
+	} else {
+		ap.stopAllSounds() //nolint:errcheck
+	}
 
 	// Build the command to play the audio file
-	args := ap.buildPlayCommand(soundFilePath)
+	args := ap.buildPlayCommand(soundFilePath, opts.Card)
 	if len(args) == 0 {
 		return fmt.Errorf("no suitable audio player found")
 	}
 
 	// Start the audio playback process
-	cmd := exec.Command(args[0], args[1:]...)
-	if err := cmd.Start(); err != nil {
+	cmd, err := ap.runner.Start(args[0], args[1:]...)
+	if err != nil {
 		ap.lastError = fmt.Errorf("failed to start audio playback with %s: %w", args[0], err)
 		return ap.lastError
 	}
@@ -56,9 +115,27 @@ func (ap *AudioPlayer) PlaySound(soundFilePath string) error {
 	// Store the current process and file for stopping later
 	ap.currentProcess = cmd
 	ap.currentSoundFile = soundFilePath
-	ap.playbackStarted = time.Now()
+	ap.playbackStarted = ap.clock.Now()
 	ap.lastError = nil
 
+	// Stop the sound once it reaches its limit, unless another sound has
+	// replaced it by then
+	ap.maxDuration = ap.playLimit(opts.MaxDuration)
+	if ap.maxDuration > 0 {
+		maxDuration := ap.maxDuration
+		ap.stopTimer = ap.clock.AfterFunc(maxDuration, func() {
+			ap.mutex.Lock()
+			defer ap.mutex.Unlock()
+			if _, overlapped := ap.overlapped[cmd]; ap.currentProcess != cmd && !overlapped {
+				return
+			}
+			log.Printf("stopping %s after its maximum play time of %s", soundFilePath, maxDuration)
+			if err := ap.stopSound(cmd); err != nil {
+				ap.lastError = err
+			}
+		})
+	}
+
 	// Start a goroutine to wait for the process to complete
 	go func() {
 		err := cmd.Wait()
@@ -66,39 +143,117 @@ func (ap *AudioPlayer) PlaySound(soundFilePath string) error {
 		defer ap.mutex.Unlock()
 
 		if ap.currentProcess == cmd {
-			ap.currentProcess = nil
-			ap.currentSoundFile = ""
+			ap.clearPlayback()
 
 			// Store any error that occurred during playback
 			if err != nil {
 				ap.lastError = fmt.Errorf("audio playback failed: %w", err)
 			}
+		} else if timer, overlapped := ap.overlapped[cmd]; overlapped {
+			if timer != nil {
+				timer.Stop()
+			}
+			delete(ap.overlapped, cmd)
 		}
 	}()
 
 	return nil
 }
 
-// StopCurrentSound stops any currently playing sound
+// StopCurrentSound stops every sound that is playing and resets the
+// playback status, including the last error
 func (ap *AudioPlayer) StopCurrentSound() error {
 	ap.mutex.Lock()
 	defer ap.mutex.Unlock()
-	return ap.stopCurrentSound()
+	if err := ap.stopAllSounds(); err != nil {
+		return err
+	}
+	ap.lastError = nil
+	return nil
 }
 
 // stopCurrentSound stops the current sound (internal, assumes mutex is held)
 func (ap *AudioPlayer) stopCurrentSound() error {
 	if ap.currentProcess != nil {
-		// Try to terminate the process gracefully
-		if err := ap.currentProcess.Process.Kill(); err != nil {
+		// The player may have exited on its own before its Wait goroutine
+		// got the mutex
+		if err := ap.currentProcess.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
 			return fmt.Errorf("failed to stop audio playback: %w", err)
 		}
-		ap.currentProcess = nil
-		ap.currentSoundFile = ""
+		ap.clearPlayback()
 	}
 	return nil
 }
 
+// overlapCurrentSound lets the current sound play on, with its timer, after
+// another sound replaces it (internal, assumes mutex is held)
+func (ap *AudioPlayer) overlapCurrentSound() {
+	if ap.currentProcess == nil {
+		return
+	}
+	if ap.overlapped == nil {
+		ap.overlapped = make(map[Process]clock.Timer)
+	}
+	ap.overlapped[ap.currentProcess] = ap.stopTimer
+	ap.stopTimer = nil
+	ap.clearPlayback()
+}
+
+// stopSound stops cmd, which is the current sound or an overlapped one
+// (internal, assumes mutex is held)
+func (ap *AudioPlayer) stopSound(cmd Process) error {
+	if cmd == ap.currentProcess {
+		return ap.stopCurrentSound()
+	}
+	if err := cmd.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to stop audio playback: %w", err)
+	}
+	if timer := ap.overlapped[cmd]; timer != nil {
+		timer.Stop()
+	}
+	delete(ap.overlapped, cmd)
+	return nil
+}
+
+// stopAllSounds stops the current sound and any overlapped sounds
+// (internal, assumes mutex is held)
+func (ap *AudioPlayer) stopAllSounds() error {
+	var errs []error
+	for cmd := range ap.overlapped {
+		if err := ap.stopSound(cmd); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := ap.stopCurrentSound(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// clearPlayback forgets the current sound and stops its timer (internal,
+// assumes mutex is held)
+func (ap *AudioPlayer) clearPlayback() {
+	ap.currentProcess = nil
+	ap.currentSoundFile = ""
+	ap.playbackStarted = time.Time{}
+	ap.maxDuration = 0
+	if ap.stopTimer != nil {
+		ap.stopTimer.Stop()
+		ap.stopTimer = nil
+	}
+}
+
+// playLimit returns how long a sound may play: the shorter of requested and
+// the configured max-play-seconds, ignoring either if it is not set. It
+// returns 0 if there is no limit.
+func (ap *AudioPlayer) playLimit(requested time.Duration) time.Duration {
+	limit := time.Duration(ap.config.MaxPlaySeconds) * time.Second
+	if requested > 0 && (limit == 0 || requested < limit) {
+		limit = requested
+	}
+	return limit
+}
+
 // GetCurrentSoundFile returns the currently playing sound file path
 func (ap *AudioPlayer) GetCurrentSoundFile() string {
 	ap.mutex.Lock()
@@ -106,25 +261,50 @@ func (ap *AudioPlayer) GetCurrentSoundFile() string {
 	return ap.currentSoundFile
 }
 
-// IsPlaying returns true if audio is currently playing
+// IsPlaying returns true if audio is currently playing, including sounds
+// overlapped by the current one
 func (ap *AudioPlayer) IsPlaying() bool {
 	ap.mutex.Lock()
 	defer ap.mutex.Unlock()
-	return ap.currentProcess != nil
+	return ap.playingCount() > 0
+}
+
+// playingCount returns the number of sounds playing (internal, assumes
+// mutex is held)
+func (ap *AudioPlayer) playingCount() int {
+	count := len(ap.overlapped)
+	if ap.currentProcess != nil {
+		count++
+	}
+	return count
 }
 
-// GetPlaybackStatus returns detailed playback status
+// GetPlaybackStatus returns detailed playback status. While a sound is
+// playing, it includes the sound's path and file name, when it started, and
+// how many seconds it has been playing. If the sound has a maximum play
+// time, it also includes the limit and the seconds remaining before the
+// sound is stopped. The current sound is the one started last; playingCount
+// includes sounds that it overlaps.
 func (ap *AudioPlayer) GetPlaybackStatus() map[string]interface{} {
 	ap.mutex.Lock()
 	defer ap.mutex.Unlock()
 
 	status := map[string]interface{}{
-		"isPlaying":    ap.currentProcess != nil,
-		"currentSound": ap.currentSoundFile,
+		"isPlaying":        ap.playingCount() > 0,
+		"playingCount":     ap.playingCount(),
+		"currentSound":     ap.currentSoundFile,
+		"currentSoundName": "",
 	}
 
 	if ap.currentProcess != nil {
-		status["playbackDuration"] = time.Since(ap.playbackStarted).Seconds()
+		status["currentSoundName"] = filepath.Base(ap.currentSoundFile)
+		status["playbackStarted"] = ap.playbackStarted.Format(time.RFC3339)
+		elapsed := ap.clock.Now().Sub(ap.playbackStarted)
+		status["playbackDuration"] = elapsed.Seconds()
+		if ap.maxDuration > 0 {
+			status["maxPlaySeconds"] = ap.maxDuration.Seconds()
+			status["remainingSeconds"] = max(ap.maxDuration-elapsed, 0).Seconds()
+		}
 	}
 
 	if ap.lastError != nil {
@@ -148,8 +328,33 @@ func (ap *AudioPlayer) ClearLastError() {
 	ap.lastError = nil
 }
 
-// buildPlayCommand constructs the command to play audio based on available tools and configuration
-func (ap *AudioPlayer) buildPlayCommand(soundFilePath string) []string {
+// outputDevice returns the ALSA device and card name to play on and set the
+// volume of. A card selected by the request replaces both the configured
+// device and card name.
+func (ap *AudioPlayer) outputDevice(card string) (device, cardName string) {
+	if card != "" {
+		return fmt.Sprintf("hw:%s", card), card
+	}
+	return ap.config.ALSADevice, ap.config.ALSACardName
+}
+
+// buildPlayCommand constructs the command to play audio based on available
+// tools and configuration. If card is not empty, the sound is played on that
+// card instead of the configured device.
+func (ap *AudioPlayer) buildPlayCommand(soundFilePath, card string) []string {
+	device, _ := ap.outputDevice(card)
+
+	// A configured player command overrides detection. It was validated
+	// when the server started.
+	if playerCommand, _ := ap.config.GetPlayerCommand(); playerCommand != nil {
+		replacer := strings.NewReplacer("{file}", soundFilePath, "{device}", device)
+		args := make([]string, len(playerCommand))
+		for i, arg := range playerCommand {
+			args[i] = replacer.Replace(arg)
+		}
+		return args
+	}
+
 	// Try different audio players in order of preference
 	players := []struct {
 		cmd  string
@@ -160,10 +365,10 @@ func (ap *AudioPlayer) buildPlayCommand(soundFilePath string) []string {
 			cmd: "aplay",
 			args: func(file string) []string {
 				args := []string{}
-				if ap.config.ALSADevice != "" && ap.config.ALSADevice != "default" {
-					args = append(args, "-D", ap.config.ALSADevice)
+				if device != "" && device != "default" {
+					args = append(args, "-D", device)
 				}
-				if ap.config.ALSACardName != "" {
+				if card == "" && ap.config.ALSACardName != "" {
 					args = append(args, "-D", fmt.Sprintf("hw:%s", ap.config.ALSACardName))
 				}
 				args = append(args, file)
@@ -175,8 +380,8 @@ func (ap *AudioPlayer) buildPlayCommand(soundFilePath string) []string {
 			cmd: "mpg123",
 			args: func(file string) []string {
 				args := []string{"-q"} // quiet mode
-				if ap.config.ALSADevice != "" && ap.config.ALSADevice != "default" {
-					args = append(args, "-a", ap.config.ALSADevice)
+				if device != "" && device != "default" {
+					args = append(args, "-a", device)
 				}
 				args = append(args, file)
 				return args
@@ -187,8 +392,8 @@ func (ap *AudioPlayer) buildPlayCommand(soundFilePath string) []string {
 			cmd: "ogg123",
 			args: func(file string) []string {
 				args := []string{"-q"} // quiet mode
-				if ap.config.ALSADevice != "" && ap.config.ALSADevice != "default" {
-					args = append(args, "-d", "alsa", "-o", fmt.Sprintf("dev:%s", ap.config.ALSADevice))
+				if device != "" && device != "default" {
+					args = append(args, "-d", "alsa", "-o", fmt.Sprintf("dev:%s", device))
 				}
 				args = append(args, file)
 				return args
@@ -199,8 +404,8 @@ func (ap *AudioPlayer) buildPlayCommand(soundFilePath string) []string {
 			cmd: "ffplay",
 			args: func(file string) []string {
 				args := []string{"-nodisp", "-autoexit", "-loglevel", "quiet"}
-				if ap.config.ALSADevice != "" && ap.config.ALSADevice != "default" {
-					args = append(args, "-f", "alsa", "-i", ap.config.ALSADevice)
+				if device != "" && device != "default" {
+					args = append(args, "-f", "alsa", "-i", device)
 				}
 				args = append(args, file)
 				return args
@@ -224,7 +429,7 @@ func (ap *AudioPlayer) buildPlayCommand(soundFilePath string) []string {
 
 	// Try each player until we find one that exists
 	for _, player := range players {
-		if _, err := exec.LookPath(player.cmd); err == nil {
+		if _, err := ap.runner.LookPath(player.cmd); err == nil {
 			args := player.args(soundFilePath)
 			return append([]string{player.cmd}, args...)
 		}
@@ -233,13 +438,18 @@ func (ap *AudioPlayer) buildPlayCommand(soundFilePath string) []string {
 	return []string{}
 }
 
-// GetAudioPlayerInfo returns information about the available audio players
+// GetAudioPlayerInfo returns information about the available audio players.
+// If a player command is configured, only its program is reported, since
+// no other player is used.
 func (ap *AudioPlayer) GetAudioPlayerInfo() map[string]bool {
 	players := []string{"aplay", "mpg123", "ogg123", "ffplay", "paplay"}
+	if playerCommand, _ := ap.config.GetPlayerCommand(); playerCommand != nil {
+		players = playerCommand[:1]
+	}
 	info := make(map[string]bool)
 
 	for _, player := range players {
-		_, err := exec.LookPath(player)
+		_, err := ap.runner.LookPath(player)
 		info[player] = err == nil
 	}
 
@@ -248,32 +458,19 @@ func (ap *AudioPlayer) GetAudioPlayerInfo() map[string]bool {
 
 // SetVolume sets the ALSA volume using amixer
 func (ap *AudioPlayer) SetVolume(volume int) error {
+	return ap.SetCardVolume(volume, "")
+}
+
+// SetCardVolume sets the volume of the given sound card using amixer, or of
+// the configured ALSA device if card is empty
+func (ap *AudioPlayer) SetCardVolume(volume int, card string) error {
 	if volume < 0 || volume > 100 {
 		return fmt.Errorf("volume must be between 0 and 100, got %d", volume)
 	}
 
-	// Try different amixer approaches
-	commands := [][]string{
-		// Try with configured device first
-		{"amixer", "-D", ap.config.ALSADevice, "sset", "Master", fmt.Sprintf("%d%%", volume)},
-		// Try with card name if configured
-		{"amixer", "-c", ap.config.ALSACardName, "sset", "Master", fmt.Sprintf("%d%%", volume)},
-		// Try default master control
-		{"amixer", "sset", "Master", fmt.Sprintf("%d%%", volume)},
-		// Try PCM control as fallback
-		{"amixer", "sset", "PCM", fmt.Sprintf("%d%%", volume)},
-	}
-
 	var lastErr error
-	for _, cmdArgs := range commands {
-		// Skip if missing required parameters
-		if (cmdArgs[1] == "-D" && ap.config.ALSADevice == "") ||
-			(cmdArgs[1] == "-c" && ap.config.ALSACardName == "") {
-			continue
-		}
-
-		cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
-		if err := cmd.Run(); err == nil {
+	for _, cmdArgs := range ap.amixerCommands(card, "sset", fmt.Sprintf("%d%%", volume)) {
+		if err := ap.runner.Run(cmdArgs[0], cmdArgs[1:]...); err == nil {
 			return nil // Success
 		} else {
 			lastErr = err
@@ -285,28 +482,15 @@ func (ap *AudioPlayer) SetVolume(volume int) error {
 
 // GetVolume gets the current ALSA volume using amixer
 func (ap *AudioPlayer) GetVolume() (int, error) {
-	// Try different amixer approaches to get volume
-	commands := [][]string{
-		// Try with configured device first
-		{"amixer", "-D", ap.config.ALSADevice, "sget", "Master"},
-		// Try with card name if configured
-		{"amixer", "-c", ap.config.ALSACardName, "sget", "Master"},
-		// Try default master control
-		{"amixer", "sget", "Master"},
-		// Try PCM control as fallback
-		{"amixer", "sget", "PCM"},
-	}
+	return ap.GetCardVolume("")
+}
 
+// GetCardVolume gets the current volume of the given sound card using
+// amixer, or of the configured ALSA device if card is empty
+func (ap *AudioPlayer) GetCardVolume(card string) (int, error) {
 	var lastErr error
-	for _, cmdArgs := range commands {
-		// Skip if missing required parameters
-		if (len(cmdArgs) > 2 && cmdArgs[1] == "-D" && ap.config.ALSADevice == "") ||
-			(len(cmdArgs) > 2 && cmdArgs[1] == "-c" && ap.config.ALSACardName == "") {
-			continue
-		}
-
-		cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
-		output, err := cmd.Output()
+	for _, cmdArgs := range ap.amixerCommands(card, "sget") {
+		output, err := ap.runner.Output(cmdArgs[0], cmdArgs[1:]...)
 		if err != nil {
 			lastErr = err
 			continue
@@ -325,6 +509,96 @@ func (ap *AudioPlayer) GetVolume() (int, error) {
 	return 0, fmt.Errorf("failed to get volume with amixer: %w", lastErr)
 }
 
+// amixerCommands returns the amixer commands to try, in order, to run
+// command (sset or sget) with args on the Master or PCM control. If card is
+// empty, they try the configured device, then the configured card, then the
+// default controls. If card is set, only that card's controls are tried, so
+// that a failure does not change the volume of another card.
+func (ap *AudioPlayer) amixerCommands(card, command string, args ...string) [][]string {
+	var targets [][]string
+	if card != "" {
+		targets = [][]string{{"-c", card}}
+	} else {
+		// Try with configured device first
+		if ap.config.ALSADevice != "" {
+			targets = append(targets, []string{"-D", ap.config.ALSADevice})
+		}
+		// Try with card name if configured
+		if ap.config.ALSACardName != "" {
+			targets = append(targets, []string{"-c", ap.config.ALSACardName})
+		}
+		// Try default controls
+		targets = append(targets, nil)
+	}
+
+	var commands [][]string
+	for _, target := range targets {
+		controls := []string{"Master"}
+		if target == nil || card != "" {
+			// Try PCM control as fallback
+			controls = append(controls, "PCM")
+		}
+		for _, control := range controls {
+			cmdArgs := append([]string{"amixer"}, target...)
+			cmdArgs = append(cmdArgs, command, control)
+			commands = append(commands, append(cmdArgs, args...))
+		}
+	}
+	return commands
+}
+
+// SoundCard is an ALSA sound card that sounds can be played on
+type SoundCard struct {
+	// Index is the card number
+	Index int `json:"index"`
+	// ID is the card name, as used in ALSA device names like hw:ID
+	ID string `json:"id"`
+	// Name is the card's description
+	Name string `json:"name"`
+}
+
+// aplayCardPattern matches the card lines of aplay -l output, such as
+// "card 0: PCH [HDA Intel PCH], device 0: ALC257 Analog [ALC257 Analog]"
+var aplayCardPattern = regexp.MustCompile(`^card (\d+): (\S+) \[([^\]]*)\]`)
+
+// ListCards returns the sound cards reported by aplay -l. A card with
+// several devices is listed once.
+func (ap *AudioPlayer) ListCards() ([]SoundCard, error) {
+	output, err := ap.runner.Output("aplay", "-l")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sound cards with aplay: %w", err)
+	}
+
+	var cards []SoundCard
+	for _, line := range strings.Split(string(output), "\n") {
+		match := aplayCardPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		index, _ := strconv.Atoi(match[1])
+		if slices.ContainsFunc(cards, func(card SoundCard) bool { return card.Index == index }) {
+			continue
+		}
+		cards = append(cards, SoundCard{Index: index, ID: match[2], Name: match[3]})
+	}
+	return cards, nil
+}
+
+// ValidateCard returns an error wrapping ErrInvalidDevice unless card is
+// the ID or index of an available sound card
+func (ap *AudioPlayer) ValidateCard(card string) error {
+	cards, err := ap.ListCards()
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidDevice, card, err)
+	}
+	for _, available := range cards {
+		if card == available.ID || card == strconv.Itoa(available.Index) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: no sound card named %s", ErrInvalidDevice, card)
+}
+
 // parseAmixerVolume parses amixer output to extract volume percentage
 func (ap *AudioPlayer) parseAmixerVolume(output string) (int, error) {
 	lines := strings.Split(output, "\n")
@@ -0,0 +1,679 @@
+package soundboard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/larsks/airdancer/internal/clock"
+)
+
+// MockCommandRunner records the commands run by an AudioPlayer. LookPath
+// finds only the programs in available. Run fails for commands in runErrs,
+// and Output returns the entry in outputs for the command.
+type MockCommandRunner struct {
+	mutex     sync.Mutex
+	available map[string]bool
+	runErrs   map[string]error
+	outputs   map[string]string
+	started   [][]string
+	run       [][]string
+	processes []*MockProcess
+}
+
+func newMockCommandRunner(available ...string) *MockCommandRunner {
+	m := &MockCommandRunner{
+		available: make(map[string]bool),
+		runErrs:   make(map[string]error),
+		outputs:   make(map[string]string),
+	}
+	for _, name := range available {
+		m.available[name] = true
+	}
+	return m
+}
+
+func (m *MockCommandRunner) LookPath(file string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.available[file] {
+		return "", fmt.Errorf("%s: executable file not found in $PATH", file)
+	}
+	return "/usr/bin/" + file, nil
+}
+
+func (m *MockCommandRunner) Start(name string, args ...string) (Process, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.started = append(m.started, append([]string{name}, args...))
+	process := &MockProcess{done: make(chan struct{})}
+	m.processes = append(m.processes, process)
+	return process, nil
+}
+
+func (m *MockCommandRunner) Run(name string, args ...string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	command := append([]string{name}, args...)
+	m.run = append(m.run, command)
+	return m.runErrs[strings.Join(command, " ")]
+}
+
+func (m *MockCommandRunner) Output(name string, args ...string) ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	command := append([]string{name}, args...)
+	m.run = append(m.run, command)
+	output, ok := m.outputs[strings.Join(command, " ")]
+	if !ok {
+		return nil, errors.New("exit status 1")
+	}
+	return []byte(output), nil
+}
+
+// MockProcess is a command that runs until it is killed or finish is
+// called
+type MockProcess struct {
+	done   chan struct{}
+	once   sync.Once
+	killed bool
+}
+
+func (p *MockProcess) Wait() error {
+	<-p.done
+	if p.killed {
+		return errors.New("signal: killed")
+	}
+	return nil
+}
+
+func (p *MockProcess) Kill() error {
+	p.once.Do(func() {
+		p.killed = true
+		close(p.done)
+	})
+	return nil
+}
+
+// finish makes the process exit successfully
+func (p *MockProcess) finish() {
+	p.once.Do(func() { close(p.done) })
+}
+
+func TestPlaySoundCommand(t *testing.T) {
+	testCases := []struct {
+		name      string
+		available []string
+		device    string
+		command   string
+		expected  []string
+	}{
+		{"aplay on the default device", []string{"aplay", "mpg123"}, "default", "", []string{"aplay", "/sounds/one.mp3"}},
+		{"aplay on a device", []string{"aplay"}, "hw:1", "", []string{"aplay", "-D", "hw:1", "/sounds/one.mp3"}},
+		{"mpg123 on a device", []string{"mpg123", "ffplay"}, "hw:1", "", []string{"mpg123", "-q", "-a", "hw:1", "/sounds/one.mp3"}},
+		{"ffplay", []string{"ffplay"}, "default", "", []string{"ffplay", "-nodisp", "-autoexit", "-loglevel", "quiet", "/sounds/one.mp3"}},
+		{"player command", []string{"aplay"}, "default", "myplayer --device=hw:2 {file}", []string{"myplayer", "--device=hw:2", "/sounds/one.mp3"}},
+		{"player command on a device", []string{"aplay"}, "hw:1", "myplayer --device={device} {file}", []string{"myplayer", "--device=hw:1", "/sounds/one.mp3"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := NewConfig()
+			config.ALSADevice = tc.device
+			config.PlayerCommand = tc.command
+			runner := newMockCommandRunner(tc.available...)
+			ap := NewAudioPlayer(config, runner)
+
+			if err := ap.PlaySound("/sounds/one.mp3"); err != nil {
+				t.Fatalf("PlaySound() error: %v", err)
+			}
+			if len(runner.started) != 1 || !reflect.DeepEqual(runner.started[0], tc.expected) {
+				t.Errorf("started %q, want %q", runner.started, tc.expected)
+			}
+		})
+	}
+
+	ap := NewAudioPlayer(NewConfig(), newMockCommandRunner())
+	if err := ap.PlaySound("/sounds/one.mp3"); err == nil {
+		t.Errorf("PlaySound() with no players succeeded, want an error")
+	}
+}
+
+func TestPlaySoundCommandOnCard(t *testing.T) {
+	config := NewConfig()
+	config.PlayerCommand = "myplayer -d {device} {file}"
+	runner := newMockCommandRunner()
+	ap := NewAudioPlayer(config, runner)
+
+	if err := ap.Play("/sounds/one.mp3", PlayOptions{Card: "2"}); err != nil {
+		t.Fatalf("Play() on card 2 error: %v", err)
+	}
+	expected := []string{"myplayer", "-d", "hw:2", "/sounds/one.mp3"}
+	if len(runner.started) != 1 || !reflect.DeepEqual(runner.started[0], expected) {
+		t.Errorf("started %q, want %q", runner.started, expected)
+	}
+
+	config.PlayerCommand = "myplayer {file}"
+	if err := ap.Play("/sounds/one.mp3", PlayOptions{Card: "2"}); !errors.Is(err, ErrInvalidDevice) {
+		t.Errorf("Play() on card 2 with a player command without {device} error = %v, want %v", err, ErrInvalidDevice)
+	}
+	if len(runner.started) != 1 {
+		t.Errorf("started %q, want only the first sound", runner.started)
+	}
+}
+
+func TestPlaySoundStopsPreviousSound(t *testing.T) {
+	runner := newMockCommandRunner("aplay")
+	ap := NewAudioPlayer(NewConfig(), runner)
+
+	for _, file := range []string{"/sounds/one.wav", "/sounds/two.wav"} {
+		if err := ap.PlaySound(file); err != nil {
+			t.Fatalf("PlaySound(%s) error: %v", file, err)
+		}
+	}
+
+	if !runner.processes[0].killed {
+		t.Errorf("first sound was not stopped when the second started")
+	}
+	if got := ap.GetCurrentSoundFile(); got != "/sounds/two.wav" {
+		t.Errorf("GetCurrentSoundFile() = %q, want %q", got, "/sounds/two.wav")
+	}
+}
+
+func TestStopSoundResetsStatus(t *testing.T) {
+	runner := newMockCommandRunner("aplay")
+	ap := NewAudioPlayer(NewConfig(), runner)
+
+	if err := ap.PlaySound("/sounds/one.wav"); err != nil {
+		t.Fatalf("PlaySound() error: %v", err)
+	}
+	if status := ap.GetPlaybackStatus(); status["isPlaying"] != true || status["currentSound"] != "/sounds/one.wav" {
+		t.Errorf("status while playing = %v, want one.wav playing", status)
+	}
+
+	if err := ap.StopCurrentSound(); err != nil {
+		t.Fatalf("StopCurrentSound() error: %v", err)
+	}
+	if !runner.processes[0].killed {
+		t.Errorf("StopCurrentSound() did not kill the player")
+	}
+	status := ap.GetPlaybackStatus()
+	if status["isPlaying"] != false || status["currentSound"] != "" {
+		t.Errorf("status after stop = %v, want nothing playing", status)
+	}
+	if _, ok := status["playbackDuration"]; ok {
+		t.Errorf("status after stop includes playbackDuration: %v", status)
+	}
+	if _, ok := status["lastError"]; ok {
+		t.Errorf("status after stop includes lastError: %v", status)
+	}
+
+	// Stopping again is harmless
+	if err := ap.StopCurrentSound(); err != nil {
+		t.Errorf("StopCurrentSound() with nothing playing error: %v", err)
+	}
+}
+
+func TestSetVolumeCommand(t *testing.T) {
+	runner := newMockCommandRunner()
+	ap := NewAudioPlayer(NewConfig(), runner)
+
+	if err := ap.SetVolume(75); err != nil {
+		t.Fatalf("SetVolume() error: %v", err)
+	}
+	expected := [][]string{{"amixer", "-D", "default", "sset", "Master", "75%"}}
+	if !reflect.DeepEqual(runner.run, expected) {
+		t.Errorf("ran %q, want %q", runner.run, expected)
+	}
+
+	// Each control is tried in turn; the card is skipped when it is not set
+	runner = newMockCommandRunner()
+	runner.runErrs["amixer -D default sset Master 50%"] = errors.New("exit status 1")
+	runner.runErrs["amixer sset Master 50%"] = errors.New("exit status 1")
+	ap = NewAudioPlayer(NewConfig(), runner)
+
+	if err := ap.SetVolume(50); err != nil {
+		t.Fatalf("SetVolume() error: %v", err)
+	}
+	expected = [][]string{
+		{"amixer", "-D", "default", "sset", "Master", "50%"},
+		{"amixer", "sset", "Master", "50%"},
+		{"amixer", "sset", "PCM", "50%"},
+	}
+	if !reflect.DeepEqual(runner.run, expected) {
+		t.Errorf("ran %q, want %q", runner.run, expected)
+	}
+
+	if err := ap.SetVolume(101); err == nil {
+		t.Errorf("SetVolume(101) succeeded, want an error")
+	}
+}
+
+func TestGetVolumeCommand(t *testing.T) {
+	runner := newMockCommandRunner()
+	runner.outputs["amixer sget Master"] = "Simple mixer control 'Master',0\n  Mono: Playback 48 [75%] [on]\n"
+	config := NewConfig()
+	config.ALSADevice = ""
+	ap := NewAudioPlayer(config, runner)
+
+	volume, err := ap.GetVolume()
+	if err != nil {
+		t.Fatalf("GetVolume() error: %v", err)
+	}
+	if volume != 75 {
+		t.Errorf("GetVolume() = %d, want 75", volume)
+	}
+	expected := [][]string{{"amixer", "sget", "Master"}}
+	if !reflect.DeepEqual(runner.run, expected) {
+		t.Errorf("ran %q, want %q", runner.run, expected)
+	}
+}
+
+func TestGetAudioPlayerInfo(t *testing.T) {
+	config := NewConfig()
+	ap := NewAudioPlayer(config, newMockCommandRunner("aplay", "myplayer"))
+
+	expected := map[string]bool{"aplay": true, "mpg123": false, "ogg123": false, "ffplay": false, "paplay": false}
+	if info := ap.GetAudioPlayerInfo(); !reflect.DeepEqual(info, expected) {
+		t.Errorf("GetAudioPlayerInfo() = %v, want %v", info, expected)
+	}
+
+	config.PlayerCommand = "myplayer {file}"
+	if info := ap.GetAudioPlayerInfo(); !reflect.DeepEqual(info, map[string]bool{"myplayer": true}) {
+		t.Errorf("GetAudioPlayerInfo() with a player command = %v, want only myplayer", info)
+	}
+}
+
+// TestConcurrentPlayAndStop has several clients playing and stopping sounds
+// on the shared server-side player at once, while sounds also finish on
+// their own. Run with -race to detect unsynchronized access.
+func TestConcurrentPlayAndStop(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 4 {
+		writeSounds(t, dir, fmt.Sprintf("sound%d.wav", i))
+	}
+	s := newTestServer(t, dir)
+	runner := newMockCommandRunner("aplay")
+	s.audioPlayer = NewAudioPlayer(s.config, runner)
+
+	var wg sync.WaitGroup
+	for worker := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 20 {
+				path := fmt.Sprintf("/api/sounds/sound%d.wav/play?mode=server", (worker+i)%4)
+				if i%3 == 2 {
+					path = "/api/sounds/stop"
+				}
+
+				req := httptest.NewRequest("POST", path, nil)
+				w := httptest.NewRecorder()
+				s.router.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					t.Errorf("POST %s: status = %d, want %d", path, w.Code, http.StatusOK)
+					return
+				}
+
+				s.audioPlayer.GetPlaybackStatus()
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 20 {
+			runner.mutex.Lock()
+			processes := runner.processes
+			runner.mutex.Unlock()
+			if len(processes) > 0 {
+				processes[len(processes)-1].finish()
+			}
+		}
+	}()
+	wg.Wait()
+
+	req := httptest.NewRequest("POST", "/api/sounds/stop", nil)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /api/sounds/stop: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if s.audioPlayer.IsPlaying() || s.audioPlayer.GetCurrentSoundFile() != "" {
+		t.Errorf("sound still playing after stop: %v", s.audioPlayer.GetPlaybackStatus())
+	}
+}
+
+func TestRealCommandRunner(t *testing.T) {
+	runner := &RealCommandRunner{}
+
+	if _, err := runner.LookPath("sh"); err != nil {
+		t.Skipf("sh not available: %v", err)
+	}
+
+	output, err := runner.Output("sh", "-c", "echo hello")
+	if err != nil || strings.TrimSpace(string(output)) != "hello" {
+		t.Errorf("Output() = %q, %v; want hello", output, err)
+	}
+
+	process, err := runner.Start("sh", "-c", "exec sleep 30")
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	if err := process.Kill(); err != nil {
+		t.Errorf("Kill() error: %v", err)
+	}
+	if err := process.Wait(); err == nil {
+		t.Errorf("Wait() after Kill() succeeded, want an error")
+	}
+	if err := process.Kill(); !errors.Is(err, os.ErrProcessDone) {
+		t.Errorf("Kill() after exit error = %v, want %v", err, os.ErrProcessDone)
+	}
+}
+
+func TestAudioInfoCurrentSound(t *testing.T) {
+	dir := t.TempDir()
+	writeSounds(t, dir, "airhorn.mp3")
+	if err := os.WriteFile(filepath.Join(dir, "airhorn.json"), []byte(`{"displayName": "Air Horn"}`), 0o644); err != nil {
+		t.Fatalf("failed to write metadata: %v", err)
+	}
+	s := newTestServer(t, dir)
+	runner := newMockCommandRunner("aplay")
+	s.audioPlayer = NewAudioPlayer(s.config, runner)
+
+	audioInfo := func() map[string]interface{} {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/api/audio/info", nil)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		var info map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+			t.Fatalf("failed to decode audio info: %v", err)
+		}
+		return info
+	}
+
+	req := httptest.NewRequest("POST", "/api/sounds/airhorn.mp3/play?mode=server", nil)
+	s.router.ServeHTTP(httptest.NewRecorder(), req)
+
+	info := audioInfo()
+	if info["isPlaying"] != true || info["currentSoundName"] != "airhorn.mp3" || info["currentDisplayName"] != "Air Horn" {
+		t.Errorf("audio info while playing = %v, want airhorn.mp3 (Air Horn) playing", info)
+	}
+	if _, ok := info["playbackStarted"].(string); !ok {
+		t.Errorf("audio info while playing has no playbackStarted: %v", info)
+	}
+	if elapsed, ok := info["playbackDuration"].(float64); !ok || elapsed < 0 {
+		t.Errorf("audio info while playing has playbackDuration %v, want elapsed seconds", info["playbackDuration"])
+	}
+
+	// The fields clear when the sound finishes
+	runner.processes[0].finish()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.audioPlayer.IsPlaying() {
+		if time.Now().After(deadline) {
+			t.Fatalf("sound still playing after it finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	info = audioInfo()
+	if info["currentSound"] != "" || info["currentSoundName"] != "" {
+		t.Errorf("audio info after playback = %v, want no current sound", info)
+	}
+	for _, key := range []string{"currentDisplayName", "playbackStarted", "playbackDuration"} {
+		if _, ok := info[key]; ok {
+			t.Errorf("audio info after playback includes %s: %v", key, info)
+		}
+	}
+}
+
+func TestAudioDevice(t *testing.T) {
+	dir := t.TempDir()
+	writeSounds(t, dir, "airhorn.mp3")
+	s := newTestServer(t, dir)
+	runner := newMockCommandRunner("aplay")
+	runner.outputs["aplay -l"] = "**** List of PLAYBACK Hardware Devices ****\n" +
+		"card 0: PCH [HDA Intel PCH], device 0: ALC257 Analog [ALC257 Analog]\n" +
+		"  Subdevices: 1/1\n" +
+		"card 1: Speaker [USB Speaker], device 0: USB Audio [USB Audio]\n" +
+		"card 1: Speaker [USB Speaker], device 1: USB Audio [USB Audio #1]\n"
+	runner.outputs["amixer -c PCH sget Master"] = "  Mono: Playback 48 [40%] [on]\n"
+	runner.outputs["amixer -c Speaker sget PCM"] = "  Mono: Playback 30 [60%] [on]\n"
+	runner.runErrs["amixer -c 1 sset Master 25%"] = errors.New("exit status 1")
+	s.audioPlayer = NewAudioPlayer(s.config, runner)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The sound is played on the requested card
+	if w := serve("POST", "/api/sounds/airhorn.mp3/play?mode=server&device=Speaker", ""); w.Code != http.StatusOK {
+		t.Fatalf("play on Speaker: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	expected := []string{"aplay", "-D", "hw:Speaker", filepath.Join(dir, "airhorn.mp3")}
+	if len(runner.started) != 1 || !reflect.DeepEqual(runner.started[0], expected) {
+		t.Errorf("started %q, want %q", runner.started, expected)
+	}
+
+	// The volume of the requested card is set, trying only its controls
+	runner.run = nil
+	if w := serve("POST", "/api/audio/volume", `{"volume": 25, "device": "1"}`); w.Code != http.StatusOK {
+		t.Fatalf("set volume on card 1: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	expectedRun := [][]string{
+		{"aplay", "-l"},
+		{"amixer", "-c", "1", "sset", "Master", "25%"},
+		{"amixer", "-c", "1", "sset", "PCM", "25%"},
+	}
+	if !reflect.DeepEqual(runner.run, expectedRun) {
+		t.Errorf("ran %q, want %q", runner.run, expectedRun)
+	}
+
+	// Unknown cards are rejected
+	if w := serve("POST", "/api/sounds/airhorn.mp3/play?mode=server&device=HDMI", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("play on unknown card: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := serve("POST", "/api/audio/volume", `{"volume": 25, "device": "HDMI"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("set volume on unknown card: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if len(runner.started) != 1 {
+		t.Errorf("started %q after requests for an unknown card", runner.started)
+	}
+
+	// The audio info reports the volume of each card
+	w := serve("GET", "/api/audio/info", "")
+	var info struct {
+		Devices []struct {
+			ID            string `json:"id"`
+			Volume        int    `json:"volume"`
+			VolumeSuccess bool   `json:"volumeSuccess"`
+		} `json:"devices"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatalf("failed to decode audio info: %v", err)
+	}
+	if len(info.Devices) != 2 ||
+		info.Devices[0].ID != "PCH" || info.Devices[0].Volume != 40 || !info.Devices[0].VolumeSuccess ||
+		info.Devices[1].ID != "Speaker" || info.Devices[1].Volume != 60 || !info.Devices[1].VolumeSuccess {
+		t.Errorf("audio info devices = %+v, want PCH at 40%% and Speaker at 60%%", info.Devices)
+	}
+}
+
+func TestMaxPlayDuration(t *testing.T) {
+	dir := t.TempDir()
+	writeSounds(t, dir, "siren.mp3")
+	s := newTestServer(t, dir)
+	s.config.MaxPlaySeconds = 60
+	runner := newMockCommandRunner("aplay")
+	s.audioPlayer = NewAudioPlayer(s.config, runner)
+	fake := clock.NewFake(time.Unix(0, 0))
+	s.audioPlayer.clock = fake
+
+	play := func(query string) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/sounds/siren.mp3/play?mode=server"+query, nil)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("play: status = %d, body: %s", w.Code, w.Body.String())
+		}
+	}
+
+	// A request limit shorter than max-play-seconds applies
+	play("&max_seconds=30")
+	fake.Advance(20 * time.Second)
+	status := s.audioPlayer.GetPlaybackStatus()
+	if status["isPlaying"] != true || status["maxPlaySeconds"] != 30.0 || status["remainingSeconds"] != 10.0 {
+		t.Errorf("status after 20s = %v, want playing with 10 of 30 seconds remaining", status)
+	}
+	fake.Advance(10 * time.Second)
+	if s.audioPlayer.IsPlaying() {
+		t.Fatal("sound still playing after its max_seconds elapsed")
+	}
+	if !runner.processes[0].killed {
+		t.Error("player was not killed when max_seconds elapsed")
+	}
+
+	// A request cannot extend max-play-seconds
+	play("&max_seconds=600")
+	fake.Advance(59 * time.Second)
+	if !s.audioPlayer.IsPlaying() {
+		t.Fatal("sound stopped before max-play-seconds elapsed")
+	}
+	fake.Advance(time.Second)
+	if s.audioPlayer.IsPlaying() {
+		t.Fatal("sound still playing after max-play-seconds elapsed")
+	}
+
+	// The timer of a sound that was replaced does not stop the next one
+	play("&max_seconds=10")
+	fake.Advance(5 * time.Second)
+	play("")
+	fake.Advance(5 * time.Second)
+	if !s.audioPlayer.IsPlaying() {
+		t.Error("the timer of a replaced sound stopped the next sound")
+	}
+
+	for _, query := range []string{"&max_seconds=0", "&max_seconds=soon"} {
+		req := httptest.NewRequest("POST", "/api/sounds/siren.mp3/play?mode=server"+query, nil)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("play with %s: status = %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestDefaultPlaybackMode(t *testing.T) {
+	dir := t.TempDir()
+	writeSounds(t, dir, "airhorn.mp3")
+	s := newTestServer(t, dir)
+	s.audioPlayer = NewAudioPlayer(s.config, newMockCommandRunner("aplay"))
+	s.config.DefaultPlaybackMode = "server"
+
+	serve := func(method, path string) map[string]interface{} {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s status = %d, body: %s", method, path, w.Code, w.Body.String())
+		}
+		var resp map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	if info := serve("GET", "/api/audio/info"); info["defaultPlaybackMode"] != "server" {
+		t.Errorf("audio info defaultPlaybackMode = %v, want server", info["defaultPlaybackMode"])
+	}
+
+	// A request without a mode uses the configured default
+	resp := serve("POST", "/api/sounds/airhorn.mp3/play")
+	if resp["playbackMode"] != "server" || resp["serverPlayback"] != true {
+		t.Errorf("play without mode = %v, want server playback", resp)
+	}
+
+	// A request can still choose browser playback
+	if err := s.audioPlayer.StopCurrentSound(); err != nil {
+		t.Fatalf("StopCurrentSound() error: %v", err)
+	}
+	resp = serve("POST", "/api/sounds/airhorn.mp3/play?mode=browser")
+	if resp["playbackMode"] != "browser" || resp["serverPlayback"] != false {
+		t.Errorf("play with mode=browser = %v, want browser playback", resp)
+	}
+	if s.audioPlayer.IsPlaying() {
+		t.Error("browser playback started a sound on the server")
+	}
+
+	config := NewConfig()
+	config.SoundDirectory = dir
+	config.ScanInterval = 0
+	config.DefaultPlaybackMode = "speakers"
+	if _, err := NewServer(config); !errors.Is(err, ErrInvalidPlaybackMode) {
+		t.Errorf("NewServer() with default playback mode %q error = %v, want %v", config.DefaultPlaybackMode, err, ErrInvalidPlaybackMode)
+	}
+}
+
+func TestStopOnNewPlay(t *testing.T) {
+	for _, stopOnNewPlay := range []bool{true, false} {
+		t.Run(fmt.Sprintf("stop-on-new-play=%v", stopOnNewPlay), func(t *testing.T) {
+			dir := t.TempDir()
+			writeSounds(t, dir, "one.mp3", "two.mp3")
+			s := newTestServer(t, dir)
+			s.config.StopOnNewPlay = stopOnNewPlay
+			runner := newMockCommandRunner("aplay")
+			s.audioPlayer = NewAudioPlayer(s.config, runner)
+
+			for _, name := range []string{"one.mp3", "two.mp3"} {
+				w := httptest.NewRecorder()
+				s.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/sounds/"+name+"/play?mode=server", nil))
+				if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"serverPlayback":true`) {
+					t.Fatalf("play %s = %d %s, want server playback", name, w.Code, w.Body.String())
+				}
+			}
+
+			if runner.processes[0].killed != stopOnNewPlay {
+				t.Errorf("first sound killed = %v when the second started, want %v", runner.processes[0].killed, stopOnNewPlay)
+			}
+			if runner.processes[1].killed {
+				t.Error("second sound was killed")
+			}
+			wantPlaying := 1
+			if !stopOnNewPlay {
+				wantPlaying = 2
+			}
+			status := s.audioPlayer.GetPlaybackStatus()
+			if status["playingCount"] != wantPlaying || status["currentSoundName"] != "two.mp3" {
+				t.Errorf("playback status = %v, want %d playing with two.mp3 current", status, wantPlaying)
+			}
+
+			// Stopping stops every sound that is playing
+			if err := s.audioPlayer.StopCurrentSound(); err != nil {
+				t.Fatalf("StopCurrentSound() error: %v", err)
+			}
+			if !runner.processes[0].killed || !runner.processes[1].killed {
+				t.Error("StopCurrentSound() did not stop every sound")
+			}
+			if s.audioPlayer.IsPlaying() {
+				t.Error("IsPlaying() = true after StopCurrentSound()")
+			}
+		})
+	}
+}
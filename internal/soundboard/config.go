@@ -1,6 +1,7 @@
 package soundboard
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/larsks/airdancer/internal/config"
@@ -13,10 +14,21 @@ type Config struct {
 	ConfigFile string `mapstructure:"config-file"`
 	// ListenAddress is the address to bind the HTTP server to
 	ListenAddress string `mapstructure:"listen-address"`
+	// ListenAddresses is a list of addresses to bind the HTTP server to (instead of ListenAddress)
+	ListenAddresses []string `mapstructure:"listen-addresses"`
 	// ListenPort is the port to bind the HTTP server to
 	ListenPort int `mapstructure:"listen-port"`
 	// SoundDirectory is the path to the directory containing sound files
 	SoundDirectory string `mapstructure:"sound-directory"`
+	// AllowDirectoryChange enables the API endpoint that changes SoundDirectory at runtime
+	AllowDirectoryChange bool `mapstructure:"allow-directory-change"`
+	// SoundRoots are the directories that SoundDirectory can be changed to
+	// at runtime, along with the directories below them. If it is empty,
+	// only SoundDirectory and the directories below it are allowed.
+	SoundRoots []string `mapstructure:"sound-roots"`
+	// APIKey must be sent as a bearer token to change SoundDirectory at
+	// runtime. If it is empty, the sound directory cannot be changed.
+	APIKey string `mapstructure:"api-key"`
 	// ItemsPerPage is the default number of items to show per page
 	ItemsPerPage int `mapstructure:"items-per-page"`
 	// BaseURL is the base URL path when hosted behind a proxy (e.g., "/soundboard")
@@ -25,8 +37,29 @@ type Config struct {
 	ALSADevice string `mapstructure:"alsa-device"`
 	// ALSACardName is the ALSA card name to use for server-side audio playback
 	ALSACardName string `mapstructure:"alsa-card-name"`
+	// StopOnNewPlay stops the sound playing on the server when another
+	// sound is played there; otherwise the sounds overlap
+	StopOnNewPlay bool `mapstructure:"stop-on-new-play"`
+	// DefaultPlaybackMode is the playback mode used for play requests that
+	// do not give one: "browser" or "server"
+	DefaultPlaybackMode string `mapstructure:"default-playback-mode"`
+	// PlayerCommand is the command used for server-side audio playback
+	// instead of an automatically selected player. {file} is replaced by
+	// the path of the sound file and {device} by the ALSA device.
+	PlayerCommand string `mapstructure:"player-command"`
+	// MaxPlaySeconds, if set, stops server-side playback after this many
+	// seconds, so that a looping or very long sound cannot play forever
+	MaxPlaySeconds int `mapstructure:"max-play-seconds"`
 	// ScanInterval is the interval in seconds to scan for sound directory changes (0 = disabled)
 	ScanInterval int `mapstructure:"scan-interval"`
+	// TLSCertFile is the TLS certificate file; setting it (with TLSKeyFile) enables HTTPS
+	TLSCertFile string `mapstructure:"tls-cert-file"`
+	// TLSKeyFile is the TLS private key file
+	TLSKeyFile string `mapstructure:"tls-key-file"`
+	// TLSReload reloads the certificate and key when they change
+	TLSReload bool `mapstructure:"tls-reload"`
+	// Strict causes unknown settings in the configuration file to be errors
+	Strict bool `mapstructure:"strict"`
 }
 
 // NewConfig creates a new Config with default values
@@ -40,6 +73,9 @@ func NewConfig() *Config {
 		ALSADevice:     "default",
 		ALSACardName:   "",
 		ScanInterval:   30, // Default to 30 seconds
+
+		DefaultPlaybackMode: "browser",
+		StopOnNewPlay:       true,
 	}
 }
 
@@ -47,26 +83,49 @@ func NewConfig() *Config {
 func (c *Config) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&c.ConfigFile, "config", "", "Path to configuration file")
 	fs.StringVar(&c.ListenAddress, "listen-address", c.ListenAddress, "Address to bind HTTP server to")
+	fs.StringSliceVar(&c.ListenAddresses, "listen-addresses", c.ListenAddresses, "Addresses to bind HTTP server to (instead of --listen-address)")
 	fs.IntVar(&c.ListenPort, "listen-port", c.ListenPort, "Port to bind HTTP server to")
 	fs.StringVar(&c.SoundDirectory, "sound-directory", c.SoundDirectory, "Directory containing sound files")
+	fs.BoolVar(&c.AllowDirectoryChange, "allow-directory-change", c.AllowDirectoryChange, "Allow the sound directory to be changed through the API")
+	fs.StringSliceVar(&c.SoundRoots, "sound-roots", c.SoundRoots, "Directories the sound directory can be changed to, along with the directories below them (default: the sound directory)")
+	fs.StringVar(&c.APIKey, "api-key", c.APIKey, "API key that clients must send as a bearer token to change the sound directory")
 	fs.IntVar(&c.ItemsPerPage, "items-per-page", c.ItemsPerPage, "Default number of items per page")
 	fs.StringVar(&c.BaseURL, "base-url", c.BaseURL, "Base URL path when hosted behind a proxy (e.g., '/soundboard')")
 	fs.StringVar(&c.ALSADevice, "alsa-device", c.ALSADevice, "ALSA device for server-side audio playback")
 	fs.StringVar(&c.ALSACardName, "alsa-card-name", c.ALSACardName, "ALSA card name for server-side audio playback")
+	fs.BoolVar(&c.StopOnNewPlay, "stop-on-new-play", c.StopOnNewPlay, "Stop the sound playing on the server when another sound is played there, rather than overlapping them")
+	fs.StringVar(&c.DefaultPlaybackMode, "default-playback-mode", c.DefaultPlaybackMode, "Playback mode for play requests that do not give one: browser or server")
+	fs.StringVar(&c.PlayerCommand, "player-command", c.PlayerCommand, "Command for server-side audio playback, with {file} for the sound file and {device} for the ALSA device (e.g., 'ffplay -nodisp -autoexit {file}'; default: detect a player)")
+	fs.IntVar(&c.MaxPlaySeconds, "max-play-seconds", c.MaxPlaySeconds, "Stop server-side playback after this many seconds (0 = no limit)")
 	fs.IntVar(&c.ScanInterval, "scan-interval", c.ScanInterval, "Interval in seconds to scan for sound directory changes (0 = disabled)")
+	fs.StringVar(&c.TLSCertFile, "tls-cert-file", c.TLSCertFile, "TLS certificate file (enables HTTPS)")
+	fs.StringVar(&c.TLSKeyFile, "tls-key-file", c.TLSKeyFile, "TLS private key file (enables HTTPS)")
+	fs.BoolVar(&c.TLSReload, "tls-reload", c.TLSReload, "Reload the TLS certificate and key when they change")
+	fs.BoolVar(&c.Strict, "strict", c.Strict, "Fail if the config file contains unknown settings")
 }
 
 // LoadConfig loads configuration using the standard config pattern
 func (c *Config) LoadConfig() error {
 	defaults := map[string]any{
-		"listen-address":  "",
-		"listen-port":     8082,
-		"sound-directory": "./sounds",
-		"items-per-page":  20,
-		"base-url":        "",
-		"alsa-device":     "default",
-		"alsa-card-name":  "",
-		"scan-interval":   30,
+		"listen-address":         "",
+		"listen-addresses":       []string{},
+		"listen-port":            8082,
+		"sound-directory":        "./sounds",
+		"allow-directory-change": false,
+		"sound-roots":            []string{},
+		"api-key":                "",
+		"items-per-page":         20,
+		"base-url":               "",
+		"alsa-device":            "default",
+		"alsa-card-name":         "",
+		"default-playback-mode":  "browser",
+		"stop-on-new-play":       true,
+		"player-command":         "",
+		"max-play-seconds":       0,
+		"scan-interval":          30,
+		"tls-cert-file":          "",
+		"tls-key-file":           "",
+		"tls-reload":             false,
 	}
 
 	return config.StandardConfigPattern(c, c.ConfigFile, defaults)
@@ -76,15 +135,28 @@ func (c *Config) LoadConfig() error {
 func (c *Config) LoadConfigWithFlagSet(fs *pflag.FlagSet) error {
 	loader := config.NewConfigLoader()
 	loader.SetConfigFile(c.ConfigFile)
+	loader.SetStrictModeKey("strict")
 	loader.SetDefaults(map[string]any{
-		"listen-address":  "",
-		"listen-port":     8082,
-		"sound-directory": "./sounds",
-		"items-per-page":  20,
-		"base-url":        "",
-		"alsa-device":     "default",
-		"alsa-card-name":  "",
-		"scan-interval":   30,
+		"listen-address":         "",
+		"listen-addresses":       []string{},
+		"listen-port":            8082,
+		"sound-directory":        "./sounds",
+		"allow-directory-change": false,
+		"sound-roots":            []string{},
+		"api-key":                "",
+		"items-per-page":         20,
+		"base-url":               "",
+		"alsa-device":            "default",
+		"alsa-card-name":         "",
+		"default-playback-mode":  "browser",
+		"stop-on-new-play":       true,
+		"player-command":         "",
+		"max-play-seconds":       0,
+		"scan-interval":          30,
+		"tls-cert-file":          "",
+		"tls-key-file":           "",
+		"tls-reload":             false,
+		"strict":                 false,
 	})
 
 	return loader.LoadConfigWithFlagSet(c, fs)
@@ -109,6 +181,63 @@ func (c *Config) GetBaseURL() string {
 	return baseURL
 }
 
+// GetPlayerCommand splits PlayerCommand into the program and its arguments.
+// It returns nil if no player command is configured, and an error if the
+// command is not a program followed by arguments that include {file}, or if
+// an ALSA device other than "default" is configured and the arguments do
+// not include {device}, since the device would otherwise be ignored.
+func (c *Config) GetPlayerCommand() ([]string, error) {
+	if strings.TrimSpace(c.PlayerCommand) == "" {
+		return nil, nil
+	}
+
+	args := strings.Fields(c.PlayerCommand)
+	if strings.Contains(args[0], "{file}") || strings.Contains(args[0], "{device}") {
+		return nil, fmt.Errorf("%w: %q must start with a program", ErrInvalidPlayerCommand, c.PlayerCommand)
+	}
+	if !playerCommandHas(args, "{file}") {
+		return nil, fmt.Errorf("%w: %q does not contain {file}", ErrInvalidPlayerCommand, c.PlayerCommand)
+	}
+	if c.ALSADevice != "" && c.ALSADevice != "default" && !playerCommandHas(args, "{device}") {
+		return nil, fmt.Errorf("%w: %q does not contain {device}, so alsa-device %q would be ignored", ErrInvalidPlayerCommand, c.PlayerCommand, c.ALSADevice)
+	}
+	return args, nil
+}
+
+// playerCommandHas returns true if an argument of the player command args
+// contains placeholder
+func playerCommandHas(args []string, placeholder string) bool {
+	for _, arg := range args[1:] {
+		if strings.Contains(arg, placeholder) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSoundRoots returns the directories that the sound directory can be
+// changed to, which are SoundRoots or, if it is empty, SoundDirectory
+func (c *Config) GetSoundRoots() []string {
+	if len(c.SoundRoots) == 0 {
+		return []string{c.SoundDirectory}
+	}
+	return c.SoundRoots
+}
+
+// GetDefaultPlaybackMode returns the playback mode used for play requests
+// that do not give one, which is "browser" if none is configured, and an
+// error if the configured mode is not "browser" or "server"
+func (c *Config) GetDefaultPlaybackMode() (string, error) {
+	switch mode := strings.TrimSpace(c.DefaultPlaybackMode); mode {
+	case "":
+		return "browser", nil
+	case "browser", "server":
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%w: %q must be browser or server", ErrInvalidPlaybackMode, c.DefaultPlaybackMode)
+	}
+}
+
 // GetFullPath returns a full path including the base URL
 func (c *Config) GetFullPath(path string) string {
 	baseURL := c.GetBaseURL()
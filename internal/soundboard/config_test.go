@@ -1,6 +1,8 @@
 package soundboard
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/spf13/pflag"
@@ -33,7 +35,7 @@ func TestAddFlags(t *testing.T) {
 	cfg.AddFlags(fs)
 
 	// Test that flags were added
-	flags := []string{"config", "listen-address", "listen-port", "sound-directory", "items-per-page"}
+	flags := []string{"config", "listen-address", "listen-port", "sound-directory", "allow-directory-change", "sound-roots", "api-key", "items-per-page", "player-command", "max-play-seconds", "default-playback-mode", "stop-on-new-play"}
 	for _, flagName := range flags {
 		if fs.Lookup(flagName) == nil {
 			t.Errorf("flag %s was not added", flagName)
@@ -66,3 +68,57 @@ func TestFlagDefaults(t *testing.T) {
 		t.Errorf("expected default items per page 20, got %d", cfg.ItemsPerPage)
 	}
 }
+
+func TestGetPlayerCommand(t *testing.T) {
+	testCases := []struct {
+		command  string
+		expected []string
+	}{
+		{"", nil},
+		{"ffplay -nodisp -autoexit {file}", []string{"ffplay", "-nodisp", "-autoexit", "{file}"}},
+		{"  player --input={file} ", []string{"player", "--input={file}"}},
+		{"player -d {device} {file}", []string{"player", "-d", "{device}", "{file}"}},
+	}
+
+	for _, tc := range testCases {
+		cfg := &Config{PlayerCommand: tc.command}
+		args, err := cfg.GetPlayerCommand()
+		if err != nil {
+			t.Errorf("GetPlayerCommand(%q) unexpected error: %v", tc.command, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, tc.expected) {
+			t.Errorf("GetPlayerCommand(%q) = %q, expected %q", tc.command, args, tc.expected)
+		}
+	}
+
+	for _, command := range []string{"ffplay -nodisp", "{file}", "{file} -q"} {
+		cfg := &Config{PlayerCommand: command}
+		if _, err := cfg.GetPlayerCommand(); !errors.Is(err, ErrInvalidPlayerCommand) {
+			t.Errorf("GetPlayerCommand(%q) error = %v, expected %v", command, err, ErrInvalidPlayerCommand)
+		}
+	}
+
+	// A configured device must be passed to the player command
+	for _, device := range []string{"", "default"} {
+		cfg := &Config{PlayerCommand: "player {file}", ALSADevice: device}
+		if _, err := cfg.GetPlayerCommand(); err != nil {
+			t.Errorf("GetPlayerCommand() with alsa-device %q unexpected error: %v", device, err)
+		}
+	}
+	cfg := &Config{PlayerCommand: "player {file}", ALSADevice: "hw:1"}
+	if _, err := cfg.GetPlayerCommand(); !errors.Is(err, ErrInvalidPlayerCommand) {
+		t.Errorf("GetPlayerCommand() without {device} and alsa-device hw:1 error = %v, expected %v", err, ErrInvalidPlayerCommand)
+	}
+	cfg.PlayerCommand = "player -d {device} {file}"
+	if _, err := cfg.GetPlayerCommand(); err != nil {
+		t.Errorf("GetPlayerCommand() with {device} and alsa-device hw:1 unexpected error: %v", err)
+	}
+
+	config := NewConfig()
+	config.SoundDirectory = t.TempDir()
+	config.PlayerCommand = "ffplay"
+	if _, err := NewServer(config); !errors.Is(err, ErrInvalidPlayerCommand) {
+		t.Errorf("NewServer() with an invalid player command error = %v, expected %v", err, ErrInvalidPlayerCommand)
+	}
+}
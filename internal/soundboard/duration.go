@@ -0,0 +1,217 @@
+package soundboard
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// errUnknownDuration is returned when the duration of a sound file cannot be
+// determined from its header
+var errUnknownDuration = errors.New("unable to determine duration")
+
+// mp3ScanSize is how much of an MP3 file (after any ID3v2 tag) is searched
+// for the first frame header
+const mp3ScanSize = 8192
+
+// soundDuration reads the header of a sound file and returns its duration.
+// WAV, FLAC and MP3 files are supported; for other formats, and for files
+// whose header cannot be parsed, it returns errUnknownDuration.
+func soundDuration(path string) (time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav":
+		return wavDuration(f)
+	case ".flac":
+		return flacDuration(f)
+	case ".mp3":
+		info, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return mp3Duration(f, info.Size())
+	default:
+		return 0, errUnknownDuration
+	}
+}
+
+// wavDuration returns the duration of a RIFF WAVE file, computed from the
+// byte rate in its fmt chunk and the size of its data chunk
+func wavDuration(r io.ReadSeeker) (time.Duration, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, fmt.Errorf("%w: %v", errUnknownDuration, err)
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return 0, fmt.Errorf("%w: not a WAVE file", errUnknownDuration)
+	}
+
+	var byteRate uint32
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return 0, fmt.Errorf("%w: no data chunk", errUnknownDuration)
+		}
+		id := string(chunk[0:4])
+		size := binary.LittleEndian.Uint32(chunk[4:8])
+
+		switch id {
+		case "fmt ":
+			var format [16]byte
+			if size < uint32(len(format)) {
+				return 0, fmt.Errorf("%w: short fmt chunk", errUnknownDuration)
+			}
+			if _, err := io.ReadFull(r, format[:]); err != nil {
+				return 0, fmt.Errorf("%w: %v", errUnknownDuration, err)
+			}
+			byteRate = binary.LittleEndian.Uint32(format[8:12])
+			size -= uint32(len(format))
+		case "data":
+			if byteRate == 0 {
+				return 0, fmt.Errorf("%w: data chunk before fmt chunk", errUnknownDuration)
+			}
+			return time.Duration(float64(size) / float64(byteRate) * float64(time.Second)), nil
+		}
+
+		// Chunks are padded to an even number of bytes
+		if _, err := r.Seek(int64(size)+int64(size%2), io.SeekCurrent); err != nil {
+			return 0, fmt.Errorf("%w: %v", errUnknownDuration, err)
+		}
+	}
+}
+
+// flacDuration returns the duration of a FLAC file from the sample rate and
+// total number of samples in its STREAMINFO block
+func flacDuration(r io.Reader) (time.Duration, error) {
+	// "fLaC", the metadata block header, and the 34 byte STREAMINFO block
+	var header [42]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, fmt.Errorf("%w: %v", errUnknownDuration, err)
+	}
+	if string(header[0:4]) != "fLaC" || header[4]&0x7f != 0 {
+		return 0, fmt.Errorf("%w: not a FLAC file", errUnknownDuration)
+	}
+
+	// Sample rate (20 bits), channels (3), bits per sample (5) and total
+	// samples (36) are packed into the 8 bytes after the block and frame
+	// sizes
+	packed := binary.BigEndian.Uint64(header[18:26])
+	sampleRate := packed >> 44
+	totalSamples := packed & (1<<36 - 1)
+	if sampleRate == 0 || totalSamples == 0 {
+		return 0, fmt.Errorf("%w: sample count not recorded", errUnknownDuration)
+	}
+
+	return time.Duration(totalSamples) * time.Second / time.Duration(sampleRate), nil
+}
+
+// MPEG audio layer III bitrates (kbit/s), indexed by the bitrate field of
+// the frame header, for MPEG-1 and for MPEG-2 and 2.5
+var (
+	mp3BitratesV1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3BitratesV2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+)
+
+// MPEG-1 sample rates, indexed by the sample rate field of the frame
+// header. MPEG-2 uses half these rates and MPEG-2.5 a quarter.
+var mp3SampleRates = [3]int{44100, 48000, 32000}
+
+// mp3Duration returns the duration of an MPEG layer III file. The frame
+// count in a Xing or Info header is used if there is one (as written by
+// most encoders for VBR files); otherwise the file is assumed to have the
+// constant bitrate of its first frame.
+func mp3Duration(r io.ReadSeeker, size int64) (time.Duration, error) {
+	start, err := skipID3v2(r)
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, mp3ScanSize)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, fmt.Errorf("%w: %v", errUnknownDuration, err)
+	}
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xff || buf[i+1]&0xe0 != 0xe0 {
+			continue
+		}
+
+		version := (buf[i+1] >> 3) & 0x03 // 3 = MPEG-1, 2 = MPEG-2, 0 = MPEG-2.5
+		layer := (buf[i+1] >> 1) & 0x03   // 1 = layer III
+		bitrateIndex := buf[i+2] >> 4
+		sampleRateIndex := (buf[i+2] >> 2) & 0x03
+		if version == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+			continue
+		}
+
+		bitrate := mp3BitratesV1[bitrateIndex]
+		sampleRate := mp3SampleRates[sampleRateIndex]
+		samplesPerFrame := 1152
+		sideInfo := 32
+		if buf[i+3]>>6 == 3 { // mono
+			sideInfo = 17
+		}
+		if version != 3 {
+			bitrate = mp3BitratesV2[bitrateIndex]
+			sampleRate /= 2
+			if version == 0 {
+				sampleRate /= 2
+			}
+			samplesPerFrame = 576
+			sideInfo = (sideInfo + 1) / 2
+		}
+
+		// A Xing ("Xing" for VBR, "Info" for CBR) header follows the side
+		// information in the first frame. Its first flag says whether the
+		// frame count is present.
+		xing := buf[min(i+4+sideInfo, len(buf)):]
+		if len(xing) >= 12 && (bytes.HasPrefix(xing, []byte("Xing")) || bytes.HasPrefix(xing, []byte("Info"))) {
+			if binary.BigEndian.Uint32(xing[4:8])&1 != 0 {
+				frames := binary.BigEndian.Uint32(xing[8:12])
+				return time.Duration(frames) * time.Duration(samplesPerFrame) * time.Second / time.Duration(sampleRate), nil
+			}
+		}
+
+		audioBytes := size - start - int64(i)
+		return time.Duration(audioBytes) * 8 * time.Second / time.Duration(bitrate*1000), nil
+	}
+
+	return 0, fmt.Errorf("%w: no MPEG layer III frame found", errUnknownDuration)
+}
+
+// skipID3v2 positions r after the ID3v2 tag at its start, if there is one,
+// and returns the offset of the audio data
+func skipID3v2(r io.ReadSeeker) (int64, error) {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, fmt.Errorf("%w: %v", errUnknownDuration, err)
+	}
+
+	var start int64
+	if string(header[0:3]) == "ID3" {
+		// The tag size is a 28 bit "syncsafe" integer that does not include
+		// the header, or the footer that is present if flag 0x10 is set
+		start = 10 + (int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9]))
+		if header[5]&0x10 != 0 {
+			start += 10
+		}
+	}
+
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("%w: %v", errUnknownDuration, err)
+	}
+	return start, nil
+}
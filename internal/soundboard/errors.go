@@ -0,0 +1,12 @@
+package soundboard
+
+import "errors"
+
+var (
+	ErrInvalidSoundDirectory = errors.New("invalid sound directory")
+	ErrSoundDirectoryDenied  = errors.New("sound directory is not below an allowed sound root")
+	ErrInvalidPlayerCommand  = errors.New("invalid player command")
+	ErrInvalidDevice         = errors.New("invalid audio device")
+	ErrInvalidMaxPlayTime    = errors.New("max-play-seconds cannot be negative")
+	ErrInvalidPlaybackMode   = errors.New("invalid default playback mode")
+)
@@ -0,0 +1,60 @@
+package soundboard
+
+import "os/exec"
+
+// CommandRunner abstracts running external commands, such as audio players
+// and amixer, for testing
+type CommandRunner interface {
+	// LookPath searches for an executable in the directories named by PATH
+	LookPath(file string) (string, error)
+	// Start starts a command without waiting for it to finish
+	Start(name string, args ...string) (Process, error)
+	// Run runs a command and waits for it to finish
+	Run(name string, args ...string) error
+	// Output runs a command and returns its standard output
+	Output(name string, args ...string) ([]byte, error)
+}
+
+// Process is a command started by a CommandRunner
+type Process interface {
+	// Wait waits for the command to exit
+	Wait() error
+	// Kill causes the command to exit immediately
+	Kill() error
+}
+
+// RealCommandRunner implements CommandRunner using os/exec
+type RealCommandRunner struct{}
+
+func (r *RealCommandRunner) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+func (r *RealCommandRunner) Start(name string, args ...string) (Process, error) {
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &realProcess{cmd}, nil
+}
+
+func (r *RealCommandRunner) Run(name string, args ...string) error {
+	return exec.Command(name, args...).Run()
+}
+
+func (r *RealCommandRunner) Output(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).Output()
+}
+
+// realProcess implements Process for a command started with os/exec
+type realProcess struct {
+	cmd *exec.Cmd
+}
+
+func (p *realProcess) Wait() error {
+	return p.cmd.Wait()
+}
+
+func (p *realProcess) Kill() error {
+	return p.cmd.Process.Kill()
+}
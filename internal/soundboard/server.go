@@ -2,17 +2,24 @@ package soundboard
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
+	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/larsks/airdancer/internal/httpserver"
 	"github.com/larsks/airdancer/internal/static"
+	"github.com/larsks/airdancer/internal/version"
 )
 
 // Server represents the HTTP server for the soundboard
@@ -32,19 +39,33 @@ type SoundsResponse struct {
 	Sounds       []Sound `json:"sounds"`
 	CurrentPage  int     `json:"currentPage"`
 	TotalPages   int     `json:"totalPages"`
+	TotalItems   int     `json:"totalItems"`
 	ItemsPerPage int     `json:"itemsPerPage"`
+	HasNext      bool    `json:"hasNext"`
+	HasPrev      bool    `json:"hasPrev"`
 }
 
 // NewServer creates a new soundboard server
 func NewServer(config *Config) (*Server, error) {
+	if _, err := config.GetPlayerCommand(); err != nil {
+		return nil, err
+	}
+	if config.MaxPlaySeconds < 0 {
+		return nil, ErrInvalidMaxPlayTime
+	}
+	if _, err := config.GetDefaultPlaybackMode(); err != nil {
+		return nil, err
+	}
+
 	soundManager := NewSoundManager(config.SoundDirectory)
+	soundManager.SetRoots(config.GetSoundRoots())
 
 	// Load sounds at startup
 	if err := soundManager.LoadSounds(); err != nil {
 		return nil, fmt.Errorf("failed to load sounds: %w", err)
 	}
 
-	audioPlayer := NewAudioPlayer(config)
+	audioPlayer := NewAudioPlayerWithDefaults(config)
 
 	s := &Server{
 		config:       config,
@@ -90,15 +111,58 @@ func (s *Server) setupSubRoutes(r chi.Router) {
 		apiRouter.Post("/audio/volume", s.handleSetVolume)
 		apiRouter.Post("/sounds/rescan", s.handleRescanSounds)
 		apiRouter.Get("/sounds/status", s.handleSoundsStatus)
+		apiRouter.Get("/sounds/folders", s.handleSoundFolders)
+		apiRouter.With(s.requireAPIKey).Post("/sounds/directory", s.handleSetSoundDirectory)
 	})
 
 	// Static file serving for sound files
-	r.Handle("/sounds/*", http.StripPrefix(s.config.GetFullPath("/sounds/"), http.FileServer(http.Dir(s.config.SoundDirectory))))
+	r.Handle("/sounds/*", http.StripPrefix(s.config.GetFullPath("/sounds/"), http.HandlerFunc(s.handleSoundFile)))
+
+	// Build version of the server
+	r.Get("/version", s.handleVersion)
 
 	// Frontend route (serves the main page)
 	r.Get("/", s.handleIndex)
 }
 
+// handleVersion reports the build version of the server
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version.GetInfo()) //nolint:errcheck
+}
+
+// handleSoundFile serves the sound files found by the last scan of the
+// sound directory. Other files in the directory are not served.
+func (s *Server) handleSoundFile(w http.ResponseWriter, r *http.Request) {
+	sound, ok := s.soundManager.FindSound(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, sound.FilePath)
+}
+
+// requireAPIKey rejects requests that do not carry the configured API key
+// as a bearer token. If no API key is configured, every request is
+// rejected, so that endpoints behind it are never public.
+func (s *Server) requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.APIKey == "" {
+			http.Error(w, "This endpoint requires an API key, and none is configured", http.StatusForbidden)
+			return
+		}
+
+		key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(key), []byte(s.config.APIKey)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "A valid API key is required", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // corsMiddleware adds CORS headers to allow browser audio playback
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -135,8 +199,16 @@ func (s *Server) handleSounds(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Get paginated sounds
-	sounds, totalPages, err := s.soundManager.GetSoundsPage(page, perPage)
+	// Get paginated sounds, only from one folder if the folder parameter
+	// is given
+	var sounds []Sound
+	var totalPages, totalItems int
+	var err error
+	if query.Has("folder") {
+		sounds, totalPages, totalItems, err = s.soundManager.GetFolderSoundsPage(cleanFolder(query.Get("folder")), page, perPage)
+	} else {
+		sounds, totalPages, totalItems, err = s.soundManager.GetSoundsPage(page, perPage)
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error getting sounds: %v", err), http.StatusBadRequest)
 		return
@@ -146,7 +218,10 @@ func (s *Server) handleSounds(w http.ResponseWriter, r *http.Request) {
 		Sounds:       sounds,
 		CurrentPage:  page,
 		TotalPages:   totalPages,
+		TotalItems:   totalItems,
 		ItemsPerPage: perPage,
+		HasNext:      page < totalPages,
+		HasPrev:      page > 1,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -160,16 +235,39 @@ func (s *Server) handleSounds(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handlePlaySound(w http.ResponseWriter, r *http.Request) {
 	filename := chi.URLParam(r, "filename")
 
-	// Parse playback mode from query parameter (default to browser)
+	// Parse playback mode from query parameter (default to the configured
+	// default playback mode, which was validated when the server started)
 	playbackMode := r.URL.Query().Get("mode")
 	if playbackMode == "" {
-		playbackMode = "browser"
+		playbackMode, _ = s.config.GetDefaultPlaybackMode()
+	}
+
+	// An optional sound card to play on instead of the configured device
+	device := r.URL.Query().Get("device")
+	if device != "" {
+		if err := s.audioPlayer.ValidateCard(device); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// An optional limit on how long the sound plays on the server
+	var maxDuration time.Duration
+	if maxSecondsStr := r.URL.Query().Get("max_seconds"); maxSecondsStr != "" {
+		maxSeconds, err := strconv.ParseFloat(maxSecondsStr, 64)
+		if err != nil || maxSeconds <= 0 {
+			http.Error(w, "max_seconds must be a positive number", http.StatusBadRequest)
+			return
+		}
+		maxDuration = time.Duration(maxSeconds * float64(time.Second))
 	}
 
-	// Find the sound by filename
+	// Find the sound by filename, in the given folder if there is one
+	query := r.URL.Query()
+	folder := cleanFolder(query.Get("folder"))
 	var targetSound *Sound
 	for _, sound := range s.soundManager.GetSounds() {
-		if sound.FileName == filename {
+		if sound.FileName == filename && (!query.Has("folder") || sound.Folder == folder) {
 			targetSound = &sound
 			break
 		}
@@ -185,16 +283,20 @@ func (s *Server) handlePlaySound(w http.ResponseWriter, r *http.Request) {
 		"filename":       filename,
 		"displayName":    targetSound.DisplayName,
 		"playbackMode":   playbackMode,
-		"url":            s.config.GetFullPath(fmt.Sprintf("/sounds/%s", filename)),
+		"folder":         targetSound.Folder,
+		"url":            s.config.GetFullPath(fmt.Sprintf("/sounds/%s", targetSound.Path())),
 		"serverPlayback": false,
 	}
+	if device != "" {
+		response["device"] = device
+	}
 
 	// If server-side playback is requested, play the sound on the server
 	if playbackMode == "server" {
 		// Clear any previous errors
 		s.audioPlayer.ClearLastError()
 
-		if err := s.audioPlayer.PlaySound(targetSound.FilePath); err != nil {
+		if err := s.audioPlayer.Play(targetSound.FilePath, PlayOptions{Card: device, MaxDuration: maxDuration, Overlap: !s.config.StopOnNewPlay}); err != nil {
 			response["serverPlayback"] = false
 			response["error"] = err.Error()
 			response["message"] = "Failed to start sound playback on server"
@@ -231,12 +333,17 @@ func (s *Server) handleStopSound(w http.ResponseWriter, r *http.Request) {
 // handleAudioInfo provides comprehensive information about audio configuration, status, and volume
 func (s *Server) handleAudioInfo(w http.ResponseWriter, r *http.Request) {
 	playbackStatus := s.audioPlayer.GetPlaybackStatus()
+	defaultPlaybackMode, _ := s.config.GetDefaultPlaybackMode()
 
 	response := map[string]interface{}{
-		"alsaDevice":       s.config.ALSADevice,
-		"alsaCardName":     s.config.ALSACardName,
-		"serverAvailable":  s.audioPlayer.IsServerMode(),
-		"availablePlayers": s.audioPlayer.GetAudioPlayerInfo(),
+		"alsaDevice":          s.config.ALSADevice,
+		"alsaCardName":        s.config.ALSACardName,
+		"defaultPlaybackMode": defaultPlaybackMode,
+		"serverAvailable":     s.audioPlayer.IsServerMode(),
+		"availablePlayers":    s.audioPlayer.GetAudioPlayerInfo(),
+	}
+	if s.config.PlayerCommand != "" {
+		response["playerCommand"] = s.config.PlayerCommand
 	}
 
 	// Add volume information
@@ -249,19 +356,55 @@ func (s *Server) handleAudioInfo(w http.ResponseWriter, r *http.Request) {
 		response["volumeError"] = err.Error()
 	}
 
+	// Add the volume of each sound card
+	if cards, err := s.audioPlayer.ListCards(); err == nil {
+		devices := make([]map[string]interface{}, 0, len(cards))
+		for _, card := range cards {
+			device := map[string]interface{}{
+				"index": card.Index,
+				"id":    card.ID,
+				"name":  card.Name,
+			}
+			if volume, err := s.audioPlayer.GetCardVolume(card.ID); err == nil {
+				device["volume"] = volume
+				device["volumeSuccess"] = true
+			} else {
+				device["volume"] = 0
+				device["volumeSuccess"] = false
+				device["volumeError"] = err.Error()
+			}
+			devices = append(devices, device)
+		}
+		response["devices"] = devices
+	} else {
+		response["devicesError"] = err.Error()
+	}
+
 	// Merge playback status
 	for key, value := range playbackStatus {
 		response[key] = value
 	}
 
+	// Add the display name of the sound that is playing
+	if currentSound, _ := playbackStatus["currentSound"].(string); currentSound != "" {
+		for _, sound := range s.soundManager.GetSounds() {
+			if sound.FilePath == currentSound {
+				response["currentDisplayName"] = sound.DisplayName
+				break
+			}
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response) //nolint:errcheck
 }
 
-// handleSetVolume sets the ALSA volume
+// handleSetVolume sets the ALSA volume of the configured device, or of the
+// sound card named by the optional device field
 func (s *Server) handleSetVolume(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Volume int `json:"volume"`
+		Volume int    `json:"volume"`
+		Device string `json:"device"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -274,12 +417,22 @@ func (s *Server) handleSetVolume(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.audioPlayer.SetVolume(req.Volume); err != nil {
+	if req.Device != "" {
+		if err := s.audioPlayer.ValidateCard(req.Device); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.audioPlayer.SetCardVolume(req.Volume, req.Device); err != nil {
 		response := map[string]interface{}{
 			"success": false,
 			"error":   err.Error(),
 			"volume":  req.Volume,
 		}
+		if req.Device != "" {
+			response["device"] = req.Device
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response) //nolint:errcheck
 		return
@@ -290,11 +443,31 @@ func (s *Server) handleSetVolume(w http.ResponseWriter, r *http.Request) {
 		"volume":  req.Volume,
 		"message": "Volume set successfully",
 	}
+	if req.Device != "" {
+		response["device"] = req.Device
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response) //nolint:errcheck
+}
+
+// handleSoundFolders lists the folders that contain sounds, with the number
+// of sounds directly in each. The sound directory itself is listed as "".
+func (s *Server) handleSoundFolders(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"folders": s.soundManager.GetFolders(),
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response) //nolint:errcheck
 }
 
+// cleanFolder normalizes a folder given in a request to the form used by
+// Sound.Folder
+func cleanFolder(folder string) string {
+	return strings.Trim(path.Clean("/"+folder), "/")
+}
+
 // handleRescanSounds manually triggers a rescan of the sound directory
 func (s *Server) handleRescanSounds(w http.ResponseWriter, r *http.Request) {
 	changed, err := s.soundManager.RescanDirectory()
@@ -320,7 +493,52 @@ func (s *Server) handleSoundsStatus(w http.ResponseWriter, r *http.Request) {
 		"soundCount":     s.soundManager.GetSoundCount(),
 		"lastScanTime":   s.soundManager.GetLastScanTime().Unix(),
 		"scanInterval":   s.config.ScanInterval,
-		"soundDirectory": s.config.SoundDirectory,
+		"soundDirectory": s.soundManager.GetDirectory(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response) //nolint:errcheck
+}
+
+// handleSetSoundDirectory switches to a different sound directory. This is
+// only allowed if enabled with allow-directory-change, and only to the
+// directories allowed by sound-roots.
+func (s *Server) handleSetSoundDirectory(w http.ResponseWriter, r *http.Request) {
+	if !s.config.AllowDirectoryChange {
+		http.Error(w, "Changing the sound directory is not enabled", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Directory string `json:"directory"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Directory == "" {
+		http.Error(w, "Directory is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.soundManager.SetDirectory(filepath.Clean(req.Directory)); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrInvalidSoundDirectory) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, ErrSoundDirectoryDenied) {
+			status = http.StatusForbidden
+		}
+		http.Error(w, fmt.Sprintf("Failed to change sound directory: %v", err), status)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success":   true,
+		"message":   "Sound directory changed successfully",
+		"directory": s.soundManager.GetDirectory(),
+		"count":     s.soundManager.GetSoundCount(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -383,14 +601,32 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 
 // Start starts the HTTP server
 func (s *Server) Start() error {
-	addr := fmt.Sprintf("%s:%d", s.config.ListenAddress, s.config.ListenPort)
+	addrs, err := httpserver.ListenAddresses(s.config.ListenAddress, s.config.ListenAddresses, s.config.ListenPort)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := httpserver.NewTLSConfig(httpserver.TLSOptions{
+		CertFile: s.config.TLSCertFile,
+		KeyFile:  s.config.TLSKeyFile,
+		Reload:   s.config.TLSReload,
+	})
+	if err != nil {
+		return err
+	}
+
+	listeners, err := httpserver.Listen(addrs)
+	if err != nil {
+		return err
+	}
+
 	s.server = &http.Server{
-		Addr:    addr,
-		Handler: s.router,
+		Handler:   s.router,
+		TLSConfig: tlsConfig,
 	}
 
-	fmt.Printf("Starting soundboard server on %s\n", addr)
-	return s.server.ListenAndServe()
+	fmt.Printf("Starting soundboard server on %s\n", strings.Join(addrs, ", "))
+	return httpserver.Serve(context.Background(), s.server, listeners)
 }
 
 // Close shuts down the HTTP server
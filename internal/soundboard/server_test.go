@@ -0,0 +1,412 @@
+package soundboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/larsks/airdancer/internal/version"
+)
+
+// testAPIKey is the API key of servers created by newTestServer
+const testAPIKey = "secret"
+
+// newTestServer creates a soundboard server for the given directory without
+// starting background scanning.
+func newTestServer(t *testing.T, dir string) *Server {
+	t.Helper()
+
+	config := NewConfig()
+	config.SoundDirectory = dir
+	config.ScanInterval = 0
+	config.AllowDirectoryChange = true
+	config.APIKey = testAPIKey
+
+	s, err := NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer() error: %v", err)
+	}
+	t.Cleanup(func() { s.Close() }) //nolint:errcheck
+
+	return s
+}
+
+// TestConcurrentPlayAndRescan exercises the sound list from request handlers
+// while it is being rescanned. Run with -race to detect unsynchronized access.
+func TestConcurrentPlayAndRescan(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 10 {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("sound%d.mp3", i)), []byte("fake"), 0o644); err != nil {
+			t.Fatalf("failed to create sound file: %v", err)
+		}
+	}
+
+	s := newTestServer(t, dir)
+
+	var wg sync.WaitGroup
+	const iterations = 50
+
+	// Repeatedly add and remove a file and rescan
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		extra := filepath.Join(dir, "extra.wav")
+		for i := range iterations {
+			if i%2 == 0 {
+				os.WriteFile(extra, []byte("fake"), 0o644)
+			} else {
+				os.Remove(extra)
+			}
+			if _, err := s.soundManager.RescanDirectory(); err != nil {
+				t.Errorf("RescanDirectory() error: %v", err)
+				return
+			}
+		}
+	}()
+
+	// Play sounds and list pages while rescanning
+	for worker := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range iterations {
+				filename := fmt.Sprintf("sound%d.mp3", (worker+i)%10)
+				req := httptest.NewRequest("POST", "/api/sounds/"+filename+"/play", nil)
+				w := httptest.NewRecorder()
+				s.router.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					t.Errorf("play %s: status = %d, want %d", filename, w.Code, http.StatusOK)
+					return
+				}
+
+				req = httptest.NewRequest("GET", "/api/sounds?page=1&per_page=5", nil)
+				w = httptest.NewRecorder()
+				s.router.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					t.Errorf("list sounds: status = %d, want %d", w.Code, http.StatusOK)
+					return
+				}
+
+				s.soundManager.GetSoundCount()
+				s.soundManager.GetLastScanTime()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if count := s.soundManager.GetSoundCount(); count < 10 {
+		t.Errorf("GetSoundCount() = %d, want at least 10", count)
+	}
+}
+
+// TestGetSoundsPageReturnsCopy verifies that modifying a page does not affect
+// the sound manager's list.
+func TestGetSoundsPageReturnsCopy(t *testing.T) {
+	sm := NewSoundManager(".")
+	sm.sounds = []Sound{
+		{FileName: "a.mp3", DisplayName: "a"},
+		{FileName: "b.mp3", DisplayName: "b"},
+	}
+
+	page, _, _, err := sm.GetSoundsPage(1, 2)
+	if err != nil {
+		t.Fatalf("GetSoundsPage() error: %v", err)
+	}
+	page[0].DisplayName = "modified"
+
+	if sm.sounds[0].DisplayName != "a" {
+		t.Errorf("modifying page changed sound manager state: %q", sm.sounds[0].DisplayName)
+	}
+}
+
+// writeSounds creates the named sound files in dir, each containing its
+// own name
+func writeSounds(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("failed to create sound file: %v", err)
+		}
+	}
+}
+
+func TestSetSoundDirectory(t *testing.T) {
+	first := t.TempDir()
+	second := t.TempDir()
+	writeSounds(t, first, "one.mp3")
+	writeSounds(t, second, "two.mp3", "three.wav")
+
+	s := newTestServer(t, first)
+	s.soundManager.SetRoots([]string{first, second})
+
+	setDirectoryWithKey := func(dir, key string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"directory": %q}`, dir)
+		req := httptest.NewRequest("POST", "/api/sounds/directory", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	setDirectory := func(dir string) *httptest.ResponseRecorder {
+		return setDirectoryWithKey(dir, testAPIKey)
+	}
+
+	for _, tc := range []struct {
+		dir   string
+		count int
+		file  string
+	}{
+		{second, 2, "two.mp3"},
+		{first, 1, "one.mp3"},
+	} {
+		w := setDirectory(tc.dir)
+		if w.Code != http.StatusOK {
+			t.Fatalf("set directory %s: status = %d, want %d, body: %s", tc.dir, w.Code, http.StatusOK, w.Body.String())
+		}
+
+		var resp struct {
+			Directory string `json:"directory"`
+			Count     int    `json:"count"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if resp.Directory != tc.dir || resp.Count != tc.count {
+			t.Errorf("response = %+v, want directory %s with %d sounds", resp, tc.dir, tc.count)
+		}
+
+		// Sound files are served from the new directory
+		req := httptest.NewRequest("GET", "/sounds/"+tc.file, nil)
+		w = httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Body.String() != tc.file {
+			t.Errorf("GET /sounds/%s: status = %d, body = %q", tc.file, w.Code, w.Body.String())
+		}
+
+		// Rescans use the new directory
+		if _, err := s.soundManager.RescanDirectory(); err != nil {
+			t.Fatalf("RescanDirectory() error: %v", err)
+		}
+		if count := s.soundManager.GetSoundCount(); count != tc.count {
+			t.Errorf("GetSoundCount() after rescan = %d, want %d", count, tc.count)
+		}
+	}
+
+	// Invalid directories are rejected and leave the current one in place
+	notADir := filepath.Join(first, "one.mp3")
+	for _, dir := range []string{filepath.Join(first, "missing"), notADir} {
+		if w := setDirectory(dir); w.Code != http.StatusBadRequest {
+			t.Errorf("set directory %s: status = %d, want %d", dir, w.Code, http.StatusBadRequest)
+		}
+	}
+	if dir := s.soundManager.GetDirectory(); dir != first {
+		t.Errorf("GetDirectory() after invalid change = %s, want %s", dir, first)
+	}
+
+	// Directories outside the sound roots are rejected
+	outside := t.TempDir()
+	writeSounds(t, outside, "four.mp3")
+	for _, dir := range []string{outside, filepath.Join(first, "..")} {
+		if w := setDirectory(dir); w.Code != http.StatusForbidden {
+			t.Errorf("set directory %s: status = %d, want %d", dir, w.Code, http.StatusForbidden)
+		}
+	}
+
+	// Requests without a valid API key are rejected
+	for _, key := range []string{"", "wrong"} {
+		if w := setDirectoryWithKey(second, key); w.Code != http.StatusUnauthorized {
+			t.Errorf("set directory with key %q: status = %d, want %d", key, w.Code, http.StatusUnauthorized)
+		}
+	}
+	if dir := s.soundManager.GetDirectory(); dir != first {
+		t.Errorf("GetDirectory() after rejected changes = %s, want %s", dir, first)
+	}
+
+	// The endpoint can be disabled
+	s.config.AllowDirectoryChange = false
+	if w := setDirectory(second); w.Code != http.StatusForbidden {
+		t.Errorf("set directory when disabled: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestSoundsPagination(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 7 {
+		writeSounds(t, dir, fmt.Sprintf("sound%d.mp3", i))
+	}
+
+	s := newTestServer(t, dir)
+
+	for _, tc := range []struct {
+		page    int
+		count   int
+		hasPrev bool
+		hasNext bool
+	}{
+		{1, 3, false, true},
+		{2, 3, true, true},
+		{3, 1, true, false},
+	} {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/api/sounds?page=%d&per_page=3", tc.page), nil)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("page %d: status = %d, want %d", tc.page, w.Code, http.StatusOK)
+		}
+
+		var resp SoundsResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+
+		if resp.TotalItems != s.soundManager.GetSoundCount() || resp.TotalItems != 7 {
+			t.Errorf("page %d: TotalItems = %d, want 7", tc.page, resp.TotalItems)
+		}
+		if resp.TotalPages != 3 {
+			t.Errorf("page %d: TotalPages = %d, want 3", tc.page, resp.TotalPages)
+		}
+		if len(resp.Sounds) != tc.count {
+			t.Errorf("page %d: got %d sounds, want %d", tc.page, len(resp.Sounds), tc.count)
+		}
+		if resp.HasPrev != tc.hasPrev || resp.HasNext != tc.hasNext {
+			t.Errorf("page %d: HasPrev, HasNext = %v, %v; want %v, %v", tc.page, resp.HasPrev, resp.HasNext, tc.hasPrev, tc.hasNext)
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	oldVersion := version.BuildVersion
+	version.BuildVersion = "1.2.3"
+	t.Cleanup(func() { version.BuildVersion = oldVersion })
+
+	s := newTestServer(t, t.TempDir())
+
+	req := httptest.NewRequest("GET", "/version", nil)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /version status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var info version.Info
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if info.Version != "1.2.3" {
+		t.Errorf("GET /version version = %q, want %q", info.Version, "1.2.3")
+	}
+}
+
+func TestSoundFolders(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "sounds")
+	for _, folder := range []string{"animals/farm", "horns"} {
+		if err := os.MkdirAll(filepath.Join(dir, folder), 0o755); err != nil {
+			t.Fatalf("failed to create folder: %v", err)
+		}
+	}
+	writeSounds(t, dir, "bell.mp3")
+	writeSounds(t, filepath.Join(dir, "animals"), "cat.mp3", "dog.mp3")
+	writeSounds(t, filepath.Join(dir, "animals/farm"), "cow.mp3")
+	writeSounds(t, filepath.Join(dir, "horns"), "bell.mp3")
+	if err := os.WriteFile(filepath.Join(dir, "animals", "cat.json"), []byte(`{"displayName": "Kitten"}`), 0o644); err != nil {
+		t.Fatalf("failed to write metadata: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	s := newTestServer(t, dir)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := serve("GET", "/api/sounds/folders")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/sounds/folders status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var folders struct {
+		Folders []SoundFolder `json:"folders"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&folders); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	wantFolders := []SoundFolder{{"", 1}, {"animals", 2}, {"animals/farm", 1}, {"horns", 1}}
+	if fmt.Sprint(folders.Folders) != fmt.Sprint(wantFolders) {
+		t.Errorf("folders = %v, want %v", folders.Folders, wantFolders)
+	}
+
+	// The folder parameter lists only the sounds directly in a folder
+	for folder, want := range map[string][]string{
+		"":         {"bell.mp3"},
+		"animals":  {"cat.mp3", "dog.mp3"},
+		"animals/": {"cat.mp3", "dog.mp3"},
+		"horns":    {"bell.mp3"},
+		"missing":  {},
+	} {
+		w := serve("GET", "/api/sounds?folder="+folder)
+		var resp SoundsResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		got := []string{}
+		for _, sound := range resp.Sounds {
+			got = append(got, sound.FileName)
+			if sound.Folder != cleanFolder(folder) {
+				t.Errorf("folder %q: sound %s has folder %q", folder, sound.FileName, sound.Folder)
+			}
+			if sound.FileName == "cat.mp3" && sound.DisplayName != "Kitten" {
+				t.Errorf("cat.mp3 display name = %q, want metadata from its own folder", sound.DisplayName)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") || resp.TotalItems != len(want) {
+			t.Errorf("folder %q: sounds = %v (total %d), want %v", folder, got, resp.TotalItems, want)
+		}
+	}
+	if w := serve("GET", "/api/sounds"); !strings.Contains(w.Body.String(), `"totalItems":5`) {
+		t.Errorf("GET /api/sounds without folder = %s, want all 5 sounds", w.Body.String())
+	}
+
+	// A sound is played from the given folder, and its URL includes it
+	w = serve("POST", "/api/sounds/bell.mp3/play?mode=browser&folder=horns")
+	var play map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&play); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if play["folder"] != "horns" || play["url"] != "/sounds/horns/bell.mp3" {
+		t.Errorf("play horns/bell.mp3 = %v, want folder horns and url /sounds/horns/bell.mp3", play)
+	}
+	if w := serve("POST", "/api/sounds/cow.mp3/play?mode=browser&folder=animals"); w.Code != http.StatusNotFound {
+		t.Errorf("play cow.mp3 in the wrong folder status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// Nested sound files are served, but nothing outside the sound directory
+	if w := serve("GET", "/sounds/animals/farm/cow.mp3"); w.Code != http.StatusOK || w.Body.String() != "cow.mp3" {
+		t.Errorf("GET /sounds/animals/farm/cow.mp3 = %d %q, want the sound file", w.Code, w.Body.String())
+	}
+	for _, path := range []string{"/sounds/../secret.txt", "/sounds/animals/../../secret.txt", "/sounds/%2e%2e/secret.txt", "/sounds/..%2fsecret.txt"} {
+		if w := serve("GET", path); strings.Contains(w.Body.String(), "secret") {
+			t.Errorf("GET %s served a file outside the sound directory", path)
+		}
+	}
+
+	// Only sound files are served, not other files in the sound directory
+	for _, path := range []string{"/sounds/animals/cat.json", "/sounds/animals/", "/sounds/missing.mp3"} {
+		if w := serve("GET", path); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s status = %d, want %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -18,6 +20,26 @@ type Sound struct {
 	DisplayName string `json:"displayName"`
 	// FilePath is the full path to the sound file
 	FilePath string `json:"-"`
+	// Folder is the folder containing the sound file, relative to the
+	// sound directory and separated by slashes, or "" for the sound
+	// directory itself
+	Folder string `json:"folder"`
+	// Duration is the length of the sound in seconds, or 0 if it could
+	// not be determined from the file
+	Duration float64 `json:"duration"`
+}
+
+// Path returns the path of the sound file relative to the sound directory,
+// separated by slashes
+func (s Sound) Path() string {
+	return path.Join(s.Folder, s.FileName)
+}
+
+// SoundFolder is a folder that contains sounds, and the number of sounds
+// directly in it
+type SoundFolder struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
 }
 
 // SoundMetadata represents the optional JSON metadata file for a sound
@@ -26,41 +48,144 @@ type SoundMetadata struct {
 }
 
 // SoundManager handles discovery and management of sound files
+//
+// SoundManager is safe for concurrent use. The sound list is never modified in
+// place: a scan builds a new list without holding the lock and then swaps it in,
+// so readers are never blocked by (or exposed to) a scan in progress.
 type SoundManager struct {
 	soundDirectory string
-	sounds         []Sound
-	lastScanTime   time.Time
-	mutex          sync.RWMutex
+	// roots are the directories that SetDirectory accepts, along with the
+	// directories below them
+	roots        []string
+	sounds       []Sound
+	lastScanTime time.Time
+	// mutex protects sounds and lastScanTime, and soundDirectory for
+	// readers outside of a scan
+	mutex sync.RWMutex
+	// scanMutex serializes directory scans and directory changes
+	scanMutex sync.Mutex
 }
 
 // NewSoundManager creates a new SoundManager
 func NewSoundManager(soundDirectory string) *SoundManager {
 	return &SoundManager{
 		soundDirectory: soundDirectory,
+		roots:          []string{soundDirectory},
 		sounds:         make([]Sound, 0),
 	}
 }
 
+// SetRoots sets the directories that SetDirectory accepts, along with the
+// directories below them. By default, only the initial sound directory and
+// the directories below it are accepted.
+func (sm *SoundManager) SetRoots(roots []string) {
+	sm.scanMutex.Lock()
+	defer sm.scanMutex.Unlock()
+	sm.roots = slices.Clone(roots)
+}
+
 // LoadSounds discovers and loads all sound files from the configured directory
 func (sm *SoundManager) LoadSounds() error {
+	sm.scanMutex.Lock()
+	defer sm.scanMutex.Unlock()
+
+	sounds, err := sm.scanSounds(sm.soundDirectory)
+	if err != nil {
+		return err
+	}
+
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
+	sm.sounds = sounds
+	sm.lastScanTime = time.Now()
 
-	return sm.loadSounds()
+	return nil
 }
 
-// loadSounds is the internal implementation (assumes mutex is held)
-func (sm *SoundManager) loadSounds() error {
+// SetDirectory switches to a different sound directory and loads the sounds
+// it contains. The directory must be one of the roots of the SoundManager,
+// or below one of them. The current directory and sounds are kept if the
+// new directory cannot be scanned.
+func (sm *SoundManager) SetDirectory(soundDirectory string) error {
+	info, err := os.Stat(soundDirectory)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSoundDirectory, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s is not a directory", ErrInvalidSoundDirectory, soundDirectory)
+	}
+
+	sm.scanMutex.Lock()
+	defer sm.scanMutex.Unlock()
+
+	if !sm.underRoot(soundDirectory) {
+		return fmt.Errorf("%w: %s", ErrSoundDirectoryDenied, soundDirectory)
+	}
+
+	sounds, err := sm.scanSounds(soundDirectory)
+	if err != nil {
+		return err
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.soundDirectory = soundDirectory
+	sm.sounds = sounds
+	sm.lastScanTime = time.Now()
+
+	return nil
+}
+
+// underRoot returns true if dir, with symbolic links resolved, is one of
+// the roots of the SoundManager or below one of them. The caller must hold
+// sm.scanMutex.
+func (sm *SoundManager) underRoot(dir string) bool {
+	resolved, err := resolvePath(dir)
+	if err != nil {
+		return false
+	}
+	for _, root := range sm.roots {
+		resolvedRoot, err := resolvePath(root)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(resolvedRoot, resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePath returns the absolute path of path with symbolic links
+// resolved
+func resolvePath(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(resolved)
+}
+
+// GetDirectory returns the directory sounds are loaded from
+func (sm *SoundManager) GetDirectory() string {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.soundDirectory
+}
+
+// scanSounds walks soundDirectory and returns the sounds it contains. It
+// does not modify the SoundManager, so it may run without holding sm.mutex.
+func (sm *SoundManager) scanSounds(soundDirectory string) ([]Sound, error) {
 	// Check if directory exists
-	if _, err := os.Stat(sm.soundDirectory); os.IsNotExist(err) {
-		return fmt.Errorf("sound directory does not exist: %s", sm.soundDirectory)
+	if _, err := os.Stat(soundDirectory); os.IsNotExist(err) {
+		return nil, fmt.Errorf("sound directory does not exist: %s", soundDirectory)
 	}
 
-	// Clear existing sounds
-	sm.sounds = make([]Sound, 0)
+	sounds := make([]Sound, 0)
 
 	// Walk through the directory to find sound files
-	err := filepath.Walk(sm.soundDirectory, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(soundDirectory, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -81,22 +206,29 @@ func (sm *SoundManager) loadSounds() error {
 			FileName: info.Name(),
 			FilePath: path,
 		}
+		if folder, err := filepath.Rel(soundDirectory, filepath.Dir(path)); err == nil && folder != "." {
+			sound.Folder = filepath.ToSlash(folder)
+		}
+
+		// Formats whose duration cannot be read are left at zero
+		if duration, err := soundDuration(path); err == nil {
+			sound.Duration = duration.Seconds()
+		}
 
 		// Try to load metadata
-		if err := sm.loadSoundMetadata(&sound); err != nil {
+		if err := sm.loadSoundMetadata(soundDirectory, &sound); err != nil {
 			// If metadata loading fails, use filename without extension as display name
 			sound.DisplayName = sm.getFileNameWithoutExt(sound.FileName)
 		}
 
-		sm.sounds = append(sm.sounds, sound)
+		sounds = append(sounds, sound)
 		return nil
 	})
-
-	if err == nil {
-		sm.lastScanTime = time.Now()
+	if err != nil {
+		return nil, err
 	}
 
-	return err
+	return sounds, nil
 }
 
 // isSoundFile checks if the file extension indicates it's a sound file
@@ -114,11 +246,12 @@ func (sm *SoundManager) isSoundFile(ext string) bool {
 	return false
 }
 
-// loadSoundMetadata attempts to load metadata from a JSON file with the same basename
-func (sm *SoundManager) loadSoundMetadata(sound *Sound) error {
+// loadSoundMetadata attempts to load metadata from a JSON file with the same
+// basename, in the same folder as the sound
+func (sm *SoundManager) loadSoundMetadata(soundDirectory string, sound *Sound) error {
 	// Get the base name without extension
 	baseName := sm.getFileNameWithoutExt(sound.FileName)
-	metadataPath := filepath.Join(sm.soundDirectory, baseName+".json")
+	metadataPath := filepath.Join(soundDirectory, filepath.FromSlash(sound.Folder), baseName+".json")
 
 	// Check if metadata file exists
 	if _, err := os.Stat(metadataPath); os.IsNotExist(err) {
@@ -166,11 +299,67 @@ func (sm *SoundManager) GetSounds() []Sound {
 	return sounds
 }
 
-// GetSoundsPage returns a page of sounds for pagination
-func (sm *SoundManager) GetSoundsPage(page, pageSize int) ([]Sound, int, error) {
+// FindSound returns the sound whose path relative to the sound directory,
+// separated by slashes, is soundPath, and false if there is none
+func (sm *SoundManager) FindSound(soundPath string) (Sound, bool) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	for _, sound := range sm.sounds {
+		if sound.Path() == soundPath {
+			return sound, true
+		}
+	}
+	return Sound{}, false
+}
+
+// GetSoundsPage returns a page of sounds for pagination, along with the
+// total number of pages and of sounds
+func (sm *SoundManager) GetSoundsPage(page, pageSize int) ([]Sound, int, int, error) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return soundsPage(sm.sounds, page, pageSize)
+}
+
+// GetFolderSoundsPage returns a page of the sounds directly in folder ("" for
+// the sound directory itself), like GetSoundsPage
+func (sm *SoundManager) GetFolderSoundsPage(folder string, page, pageSize int) ([]Sound, int, int, error) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	sounds := make([]Sound, 0)
+	for _, sound := range sm.sounds {
+		if sound.Folder == folder {
+			sounds = append(sounds, sound)
+		}
+	}
+	return soundsPage(sounds, page, pageSize)
+}
+
+// GetFolders returns the folders that contain sounds, sorted by name
+func (sm *SoundManager) GetFolders() []SoundFolder {
 	sm.mutex.RLock()
 	defer sm.mutex.RUnlock()
 
+	counts := make(map[string]int)
+	for _, sound := range sm.sounds {
+		counts[sound.Folder]++
+	}
+
+	folders := make([]SoundFolder, 0, len(counts))
+	for name, count := range counts {
+		folders = append(folders, SoundFolder{Name: name, Count: count})
+	}
+	slices.SortFunc(folders, func(a, b SoundFolder) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return folders
+}
+
+// soundsPage returns a copy of a page of sounds, along with the total number
+// of pages and of sounds
+func soundsPage(sounds []Sound, page, pageSize int) ([]Sound, int, int, error) {
+
 	if page < 1 {
 		page = 1
 	}
@@ -178,43 +367,50 @@ func (sm *SoundManager) GetSoundsPage(page, pageSize int) ([]Sound, int, error)
 		pageSize = 20
 	}
 
-	totalSounds := len(sm.sounds)
+	totalSounds := len(sounds)
 	totalPages := (totalSounds + pageSize - 1) / pageSize
 
 	if page > totalPages && totalPages > 0 {
-		return nil, totalPages, fmt.Errorf("page %d exceeds total pages %d", page, totalPages)
+		return nil, totalPages, totalSounds, fmt.Errorf("page %d exceeds total pages %d", page, totalPages)
 	}
 
 	startIdx := (page - 1) * pageSize
 	endIdx := startIdx + pageSize
 
 	if startIdx >= totalSounds {
-		return []Sound{}, totalPages, nil
+		return []Sound{}, totalPages, totalSounds, nil
 	}
 
 	if endIdx > totalSounds {
 		endIdx = totalSounds
 	}
 
-	return sm.sounds[startIdx:endIdx], totalPages, nil
+	// Return a copy to avoid race conditions
+	pageSounds := make([]Sound, endIdx-startIdx)
+	copy(pageSounds, sounds[startIdx:endIdx])
+	return pageSounds, totalPages, totalSounds, nil
 }
 
 // RescanDirectory rescans the sound directory and returns true if changes were found
 func (sm *SoundManager) RescanDirectory() (bool, error) {
-	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
-
-	// Store the current sounds for comparison
-	oldSounds := make([]Sound, len(sm.sounds))
-	copy(oldSounds, sm.sounds)
+	sm.scanMutex.Lock()
+	defer sm.scanMutex.Unlock()
 
-	// Rescan the directory
-	if err := sm.loadSounds(); err != nil {
+	// Rescan the directory without blocking readers
+	sounds, err := sm.scanSounds(sm.soundDirectory)
+	if err != nil {
 		return false, err
 	}
 
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
 	// Compare the old and new sound lists
-	return !sm.soundListsEqual(oldSounds, sm.sounds), nil
+	changed := !sm.soundListsEqual(sm.sounds, sounds)
+	sm.sounds = sounds
+	sm.lastScanTime = time.Now()
+
+	return changed, nil
 }
 
 // soundListsEqual compares two sound slices for equality
@@ -228,17 +424,17 @@ func (sm *SoundManager) soundListsEqual(a, b []Sound) bool {
 	bMap := make(map[string]Sound)
 
 	for _, sound := range a {
-		aMap[sound.FileName] = sound
+		aMap[sound.Path()] = sound
 	}
 
 	for _, sound := range b {
-		bMap[sound.FileName] = sound
+		bMap[sound.Path()] = sound
 	}
 
 	// Compare the maps
 	for filename, soundA := range aMap {
 		soundB, exists := bMap[filename]
-		if !exists || soundA.DisplayName != soundB.DisplayName || soundA.FilePath != soundB.FilePath {
+		if !exists || soundA.DisplayName != soundB.DisplayName || soundA.FilePath != soundB.FilePath || soundA.Duration != soundB.Duration {
 			return false
 		}
 	}
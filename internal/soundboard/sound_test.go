@@ -1,10 +1,14 @@
 package soundboard
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestNewSoundManager(t *testing.T) {
@@ -82,7 +86,7 @@ func TestGetSoundsPage(t *testing.T) {
 	}
 
 	// Test first page
-	sounds, totalPages, err := sm.GetSoundsPage(1, 10)
+	sounds, totalPages, totalItems, err := sm.GetSoundsPage(1, 10)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -95,8 +99,12 @@ func TestGetSoundsPage(t *testing.T) {
 		t.Errorf("expected 3 total pages, got %d", totalPages)
 	}
 
+	if totalItems != 25 {
+		t.Errorf("expected 25 total items, got %d", totalItems)
+	}
+
 	// Test last page
-	sounds, _, err = sm.GetSoundsPage(3, 10)
+	sounds, _, _, err = sm.GetSoundsPage(3, 10)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -106,13 +114,13 @@ func TestGetSoundsPage(t *testing.T) {
 	}
 
 	// Test out of bounds page
-	_, _, err = sm.GetSoundsPage(5, 10)
+	_, _, _, err = sm.GetSoundsPage(5, 10)
 	if err == nil {
 		t.Error("expected error for out of bounds page")
 	}
 
 	// Test invalid page number
-	sounds, _, err = sm.GetSoundsPage(0, 10)
+	sounds, _, _, err = sm.GetSoundsPage(0, 10)
 	if err != nil {
 		t.Fatalf("unexpected error for page 0: %v", err)
 	}
@@ -138,7 +146,7 @@ func TestLoadSoundMetadata(t *testing.T) {
 		FilePath: filepath.Join(tempDir, "test.mp3"),
 	}
 
-	err = sm.loadSoundMetadata(&sound)
+	err = sm.loadSoundMetadata(tempDir, &sound)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -168,7 +176,7 @@ func TestLoadSoundMetadata(t *testing.T) {
 		FilePath: filepath.Join(tempDir, "test.mp3"),
 	}
 
-	err = sm.loadSoundMetadata(&sound2)
+	err = sm.loadSoundMetadata(tempDir, &sound2)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -239,3 +247,112 @@ func TestLoadSoundsNonExistentDir(t *testing.T) {
 		t.Error("expected error for non-existent directory")
 	}
 }
+
+// wavFile returns a WAVE file containing seconds of 8 kHz, 16 bit mono
+// silence, with a LIST chunk before the audio data
+func wavFile(seconds int) []byte {
+	const byteRate = 8000 * 2
+	dataSize := seconds * byteRate
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+8+16+8+3+1+8+dataSize)) //nolint:errcheck
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, []uint32{16, 1 | 1<<16, 8000, byteRate, 2 | 16<<16}) //nolint:errcheck
+	buf.WriteString("LIST")
+	binary.Write(&buf, binary.LittleEndian, uint32(3)) //nolint:errcheck
+	buf.WriteString("abc\x00data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize)) //nolint:errcheck
+	buf.Write(make([]byte, dataSize))
+	return buf.Bytes()
+}
+
+// flacFile returns the start of a FLAC file whose STREAMINFO block
+// records totalSamples samples at 44.1 kHz
+func flacFile(totalSamples uint64) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("fLaC")
+	buf.Write([]byte{0x80, 0, 0, 34})
+	buf.Write(make([]byte, 10))
+	binary.Write(&buf, binary.BigEndian, uint64(44100)<<44|uint64(1)<<41|uint64(15)<<36|totalSamples) //nolint:errcheck
+	buf.Write(make([]byte, 16))
+	return buf.Bytes()
+}
+
+// mp3File returns an MPEG-1 layer III file with an ID3v2 tag followed by
+// frames of 128 kbit/s, 44.1 kHz stereo audio. If xingFrames is not zero,
+// the first frame contains a Xing header with that frame count.
+func mp3File(frames, xingFrames int) []byte {
+	const frameSize = 144 * 128000 / 44100
+
+	var buf bytes.Buffer
+	buf.WriteString("ID3\x04\x00\x00\x00\x00\x01\x00") // 128 byte tag
+	buf.Write(make([]byte, 128))
+	for i := range frames {
+		frame := make([]byte, frameSize)
+		copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+		if i == 0 && xingFrames > 0 {
+			copy(frame[36:], "Xing")
+			binary.BigEndian.PutUint32(frame[40:], 1)
+			binary.BigEndian.PutUint32(frame[44:], uint32(xingFrames))
+		}
+		buf.Write(frame)
+	}
+	return buf.Bytes()
+}
+
+func TestSoundDuration(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, tc := range []struct {
+		name    string
+		content []byte
+		want    time.Duration
+	}{
+		{"sound.wav", wavFile(2), 2 * time.Second},
+		{"sound.flac", flacFile(441000), 10 * time.Second},
+		{"cbr.mp3", mp3File(100, 0), 2606250 * time.Microsecond},
+		{"vbr.mp3", mp3File(10, 1000), 26122448979},
+		{"sound.ogg", []byte("OggS"), 0},
+		{"fake.wav", []byte("fake"), 0},
+		{"fake.mp3", []byte("fake content"), 0},
+	} {
+		path := filepath.Join(dir, tc.name)
+		if err := os.WriteFile(path, tc.content, 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", tc.name, err)
+		}
+
+		got, err := soundDuration(path)
+		if tc.want == 0 {
+			if !errors.Is(err, errUnknownDuration) {
+				t.Errorf("soundDuration(%s) error = %v, want %v", tc.name, err, errUnknownDuration)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("soundDuration(%s) unexpected error: %v", tc.name, err)
+			continue
+		}
+		if diff := got - tc.want; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("soundDuration(%s) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// LoadSounds records the duration, or zero if it is unknown
+	sm := NewSoundManager(dir)
+	if err := sm.LoadSounds(); err != nil {
+		t.Fatalf("failed to load sounds: %v", err)
+	}
+	for _, sound := range sm.GetSounds() {
+		switch sound.FileName {
+		case "sound.wav":
+			if sound.Duration != 2 {
+				t.Errorf("%s duration = %v, want 2", sound.FileName, sound.Duration)
+			}
+		case "sound.ogg", "fake.wav", "fake.mp3":
+			if sound.Duration != 0 {
+				t.Errorf("%s duration = %v, want 0", sound.FileName, sound.Duration)
+			}
+		}
+	}
+}
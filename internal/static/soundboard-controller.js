@@ -8,6 +8,9 @@ class SoundboardController extends AirdancerUI {
         this.baseURL = baseURL;
         this.currentPage = 1;
         this.totalPages = 1;
+        this.totalItems = 0;
+        this.hasNext = false;
+        this.hasPrev = false;
         this.perPage = 20;
         this.sounds = [];
         this.currentAudio = null;
@@ -49,6 +52,12 @@ class SoundboardController extends AirdancerUI {
         this.initializeModeFeatures();
     }
     
+    // soundPath returns the path of a sound file relative to the sound
+    // directory, including the folder it is in
+    soundPath(sound) {
+        return sound.folder ? `${sound.folder}/${sound.fileName}` : sound.fileName;
+    }
+
     initializeModeFeatures() {
         if (this.playbackMode === 'server') {
             setTimeout(() => {
@@ -70,7 +79,7 @@ class SoundboardController extends AirdancerUI {
 
         if (prevBtn) {
             prevBtn.addEventListener('click', () => {
-                if (this.currentPage > 1) {
+                if (this.hasPrev) {
                     this.currentPage--;
                     this.loadSounds();
                 }
@@ -79,7 +88,7 @@ class SoundboardController extends AirdancerUI {
 
         if (nextBtn) {
             nextBtn.addEventListener('click', () => {
-                if (this.currentPage < this.totalPages) {
+                if (this.hasNext) {
                     this.currentPage++;
                     this.loadSounds();
                 }
@@ -150,6 +159,21 @@ class SoundboardController extends AirdancerUI {
             statusElement.textContent = '✓ Available';
             statusElement.className = 'server-status available';
             playbackModeSelect.disabled = false;
+
+            // Until a mode is selected in this browser, start in the
+            // server's default playback mode
+            const savedMode = localStorage.getItem('soundboard-playback-mode');
+            const defaultMode = audioInfo && audioInfo.defaultPlaybackMode;
+            if (!savedMode && (defaultMode === 'browser' || defaultMode === 'server') && defaultMode !== this.playbackMode) {
+                this.playbackMode = defaultMode;
+                playbackModeSelect.value = defaultMode;
+                if (this.playbackMode === 'server') {
+                    this.startStatusPolling();
+                    this.syncServerVolume();
+                } else {
+                    this.stopStatusPolling();
+                }
+            }
         } else {
             statusElement.textContent = '✗ Unavailable';
             statusElement.className = 'server-status unavailable';
@@ -230,13 +254,33 @@ class SoundboardController extends AirdancerUI {
         }
     }
 
+    updateNowPlaying(audioInfo) {
+        const nowPlaying = document.getElementById('nowPlaying');
+        if (!nowPlaying) return;
+
+        if (!audioInfo || !audioInfo.isPlaying) {
+            nowPlaying.textContent = '';
+            nowPlaying.classList.add('hidden');
+            return;
+        }
+
+        const elapsed = Math.floor(audioInfo.playbackDuration || 0);
+        const minutes = Math.floor(elapsed / 60);
+        const seconds = String(elapsed % 60).padStart(2, '0');
+        const name = audioInfo.currentDisplayName || audioInfo.currentSoundName;
+        nowPlaying.textContent = `Playing: ${name} (${minutes}:${seconds})`;
+        nowPlaying.classList.remove('hidden');
+    }
+
     async checkServerPlaybackStatus() {
         if (this.playbackMode !== 'server') {
+            this.updateNowPlaying(null);
             return;
         }
         
         try {
             const data = await this.apiRequest(this.buildURL('/api/audio/info'));
+            this.updateNowPlaying(data);
             
             if (!data.isPlaying && this.currentPlayingButton) {
                 this.currentPlayingButton.classList.remove('playing');
@@ -266,6 +310,9 @@ class SoundboardController extends AirdancerUI {
             this.sounds = data.sounds;
             this.currentPage = data.currentPage;
             this.totalPages = data.totalPages;
+            this.totalItems = data.totalItems;
+            this.hasNext = data.hasNext;
+            this.hasPrev = data.hasPrev;
             this.perPage = data.itemsPerPage;
             
             this.renderSounds();
@@ -296,6 +343,9 @@ class SoundboardController extends AirdancerUI {
             button.className = 'sound-button';
             button.textContent = sound.displayName;
             button.title = `Play/Stop ${sound.displayName}`;
+            if (sound.duration > 0) {
+                button.title += ` (${sound.duration.toFixed(1)}s)`;
+            }
             
             button.addEventListener('click', () => {
                 this.playSound(sound, button);
@@ -335,7 +385,7 @@ class SoundboardController extends AirdancerUI {
             this.currentPlayingButton = button;
             
             if (this.playbackMode === 'server') {
-                const result = await this.apiRequest(this.buildURL(`/api/sounds/${sound.fileName}/play?mode=server`), {
+                const result = await this.apiRequest(this.buildURL(`/api/sounds/${sound.fileName}/play?mode=server&folder=${encodeURIComponent(sound.folder || '')}`), {
                     method: 'POST'
                 });
                 
@@ -350,7 +400,7 @@ class SoundboardController extends AirdancerUI {
                 }
                 
             } else {
-                const audio = new Audio(this.buildURL(`/sounds/${sound.fileName}`));
+                const audio = new Audio(this.buildURL(`/sounds/${this.soundPath(sound)}`));
                 audio.volume = this.volume / 100;
                 this.currentAudio = audio;
                 
@@ -366,7 +416,7 @@ class SoundboardController extends AirdancerUI {
                 
                 await audio.play();
                 
-                fetch(this.buildURL(`/api/sounds/${sound.fileName}/play?mode=browser`), {
+                fetch(this.buildURL(`/api/sounds/${sound.fileName}/play?mode=browser&folder=${encodeURIComponent(sound.folder || '')}`), {
                     method: 'POST'
                 }).catch(err => console.warn('Failed to log play event:', err));
             }
@@ -384,9 +434,17 @@ class SoundboardController extends AirdancerUI {
         const pageInfo = document.getElementById('pageInfo');
         const perPageSelect = document.getElementById('perPage');
 
-        if (prevButton) prevButton.disabled = this.currentPage <= 1;
-        if (nextButton) nextButton.disabled = this.currentPage >= this.totalPages;
-        if (pageInfo) pageInfo.textContent = `Page ${this.currentPage} of ${this.totalPages}`;
+        if (prevButton) prevButton.disabled = !this.hasPrev;
+        if (nextButton) nextButton.disabled = !this.hasNext;
+        if (pageInfo) {
+            if (this.totalItems > 0) {
+                const first = (this.currentPage - 1) * this.perPage + 1;
+                const last = Math.min(first + this.perPage - 1, this.totalItems);
+                pageInfo.textContent = `Showing ${first}–${last} of ${this.totalItems} (page ${this.currentPage} of ${this.totalPages})`;
+            } else {
+                pageInfo.textContent = 'No sounds';
+            }
+        }
         if (perPageSelect) perPageSelect.value = this.perPage.toString();
     }
 
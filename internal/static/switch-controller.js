@@ -2,6 +2,16 @@
  * Switch Controller for Airdancer Switch Control Interface
  */
 
+// Polling interval used while the event stream is unavailable
+const POLL_INTERVAL = 2000;
+
+// Delays between attempts to reconnect to the event stream
+const STREAM_RECONNECT_MIN_DELAY = 1000;
+const STREAM_RECONNECT_MAX_DELAY = 60000;
+
+// Ways switches can be grouped into sections
+const SWITCH_GROUPINGS = ['collection', 'tag'];
+
 class SwitchController extends AirdancerUI {
     constructor(apiBaseURL) {
         super();
@@ -11,6 +21,14 @@ class SwitchController extends AirdancerUI {
         this.groups = {};
         this.groupNames = [];
         this.updateInterval = null;
+        this.eventSource = null;
+        this.reconnectTimer = null;
+        this.reconnectDelay = STREAM_RECONNECT_MIN_DELAY;
+        this.refreshPending = false;
+        this.groupBy = this.getGroupBy();
+        this.collapsedSections = new Set();
+        // Cleared if the API has no endpoint for checking a switch
+        this.retrySupported = true;
         this.switchCount = 0;
         this.lastUpdated = null;
         this.init();
@@ -20,6 +38,7 @@ class SwitchController extends AirdancerUI {
         await this.loadSwitches();
         this.setupEventListeners();
         this.startAutoUpdate();
+        this.connectEventStream();
         this.updateConnectionStatus('Connected');
     }
 
@@ -128,16 +147,83 @@ class SwitchController extends AirdancerUI {
         }
     }
 
+    /**
+     * Return how switches are grouped: 'collection', 'tag', or null for a
+     * flat list. The groupBy query parameter overrides the server default.
+     */
+    getGroupBy() {
+        const groupBy = new URLSearchParams(window.location.search).get('groupBy') ?? SwitchController.defaultGroupBy;
+        return SWITCH_GROUPINGS.includes(groupBy) ? groupBy : null;
+    }
+
+    /**
+     * Return the heading of the section a switch is shown under
+     */
+    getSectionName(switchData) {
+        if (this.groupBy === 'collection') {
+            return switchData.collection || 'Other';
+        }
+        return (switchData.tags && switchData.tags[0]) || 'Untagged';
+    }
+
     renderSwitches() {
         const container = document.getElementById('switches-container');
         if (!container) return;
         
         container.innerHTML = '';
 
+        if (!this.groupBy) {
+            container.classList.add('grid', 'grid-auto-fit');
+            for (const switchName of this.switchNames) {
+                const switchCard = this.createSwitchCard(switchName, this.switches[switchName]);
+                container.appendChild(switchCard);
+            }
+            return;
+        }
+
+        // Each section holds its own grid of cards
+        container.classList.remove('grid', 'grid-auto-fit');
+
+        const sections = new Map();
         for (const switchName of this.switchNames) {
-            const switchCard = this.createSwitchCard(switchName, this.switches[switchName]);
-            container.appendChild(switchCard);
+            const sectionName = this.getSectionName(this.switches[switchName]);
+            if (!sections.has(sectionName)) {
+                sections.set(sectionName, []);
+            }
+            sections.get(sectionName).push(switchName);
+        }
+
+        for (const sectionName of [...sections.keys()].sort()) {
+            container.appendChild(this.createSection(sectionName, sections.get(sectionName)));
+        }
+    }
+
+    createSection(sectionName, switchNames) {
+        const section = document.createElement('details');
+        section.className = 'switch-section';
+        section.open = !this.collapsedSections.has(sectionName);
+
+        // Remember collapsed sections when switches are re-rendered
+        section.addEventListener('toggle', () => {
+            if (section.open) {
+                this.collapsedSections.delete(sectionName);
+            } else {
+                this.collapsedSections.add(sectionName);
+            }
+        });
+
+        const summary = document.createElement('summary');
+        summary.textContent = `${sectionName} (${switchNames.length})`;
+        section.appendChild(summary);
+
+        const grid = document.createElement('div');
+        grid.className = 'grid grid-auto-fit';
+        for (const switchName of switchNames) {
+            grid.appendChild(this.createSwitchCard(switchName, this.switches[switchName]));
         }
+        section.appendChild(grid);
+
+        return section;
     }
 
     renderGroups() {
@@ -194,9 +280,69 @@ class SwitchController extends AirdancerUI {
         `;
         
         card.appendChild(toggle);
+        card.appendChild(this.createRetryButton(switchName, isDisabled));
         return card;
     }
 
+    /**
+     * Create the button that asks the API to check a disabled switch's
+     * device again. It is only shown while the switch is disabled.
+     */
+    createRetryButton(switchName, isDisabled) {
+        const button = document.createElement('button');
+        button.className = 'btn btn-retry';
+        button.id = `retry-${this.getSafeId(switchName)}`;
+        button.textContent = 'Retry';
+        button.hidden = !(isDisabled && this.retrySupported);
+        button.addEventListener('click', () => {
+            this.retrySwitch(switchName);
+        });
+        return button;
+    }
+
+    async retrySwitch(switchName) {
+        const button = document.getElementById(`retry-${this.getSafeId(switchName)}`);
+        if (button) {
+            button.disabled = true;
+        }
+
+        try {
+            const response = await fetch(`${this.apiBaseURL}/switch/${encodeURIComponent(switchName)}/check`, {
+                method: 'POST'
+            });
+
+            // Older API servers cannot check switches; leave disabled
+            // switches greyed out without a retry button
+            if (response.status === 404 || response.status === 405) {
+                this.retrySupported = false;
+                document.querySelectorAll('.btn-retry').forEach((retryButton) => {
+                    retryButton.hidden = true;
+                });
+                this.showMessage('The API server does not support retrying switches', 'warning');
+                return;
+            }
+
+            const data = await response.json();
+            if (data.data) {
+                this.switches[switchName] = data.data;
+                this.updateSwitchUI(switchName, data.data);
+            }
+
+            if (data.status === 'ok') {
+                this.showMessage(`Switch ${switchName} is reachable`, 'success');
+            } else {
+                this.showMessage(data.message || `Switch ${switchName} is still unreachable`, 'error');
+            }
+        } catch (error) {
+            console.error(`Failed to retry switch ${switchName}:`, error);
+            this.showMessage(`Failed to retry switch ${switchName}: ${error.message}`, 'error');
+        } finally {
+            if (button) {
+                button.disabled = false;
+            }
+        }
+    }
+
     createGroupCard(groupName, groupData) {
         const card = document.createElement('div');
         card.className = 'card';
@@ -369,6 +515,7 @@ class SwitchController extends AirdancerUI {
         const stateLabel = document.getElementById(`state-${safeId}`);
         const card = checkbox?.closest('.card');
         const toggleSwitch = checkbox?.closest('.toggle-switch');
+        const retryButton = document.getElementById(`retry-${safeId}`);
         
         const isDisabled = switchData.state === 'disabled';
         
@@ -398,6 +545,10 @@ class SwitchController extends AirdancerUI {
                 toggleSwitch.classList.remove('disabled');
             }
         }
+
+        if (retryButton) {
+            retryButton.hidden = !(isDisabled && this.retrySupported);
+        }
     }
 
     setupEventListeners() {
@@ -418,9 +569,66 @@ class SwitchController extends AirdancerUI {
     }
 
     startAutoUpdate() {
+        if (this.updateInterval) return;
         this.updateInterval = setInterval(() => {
             this.updateSwitches();
-        }, 2000);
+        }, POLL_INTERVAL);
+    }
+
+    stopAutoUpdate() {
+        if (this.updateInterval) {
+            clearInterval(this.updateInterval);
+            this.updateInterval = null;
+        }
+    }
+
+    /**
+     * Subscribe to switch events from the API. While the stream is open,
+     * switches are refreshed when an event arrives instead of by polling.
+     * If the browser or the API does not support the stream, or it drops,
+     * polling resumes and the stream is retried with increasing delays.
+     */
+    connectEventStream() {
+        if (typeof EventSource === 'undefined') return;
+
+        this.reconnectTimer = null;
+        const source = new EventSource(`${this.apiBaseURL}/events`);
+        this.eventSource = source;
+
+        source.onopen = () => {
+            this.reconnectDelay = STREAM_RECONNECT_MIN_DELAY;
+            this.stopAutoUpdate();
+            // Pick up any changes made while the stream was down
+            this.updateSwitches();
+        };
+
+        source.addEventListener('switch', () => {
+            this.scheduleRefresh();
+        });
+
+        source.onerror = () => {
+            source.close();
+            if (this.eventSource !== source) return;
+            this.eventSource = null;
+
+            console.warn(`Event stream unavailable, polling until it reconnects in ${this.reconnectDelay / 1000}s`);
+            this.startAutoUpdate();
+            this.reconnectTimer = setTimeout(() => this.connectEventStream(), this.reconnectDelay);
+            this.reconnectDelay = Math.min(this.reconnectDelay * 2, STREAM_RECONNECT_MAX_DELAY);
+        };
+    }
+
+    /**
+     * Refresh switches once for a burst of events, such as a group
+     * changing state
+     */
+    scheduleRefresh() {
+        if (this.refreshPending) return;
+        this.refreshPending = true;
+        setTimeout(async () => {
+            this.refreshPending = false;
+            await this.updateSwitches();
+        }, 100);
     }
 
     updateLastUpdated() {
@@ -430,4 +638,7 @@ class SwitchController extends AirdancerUI {
             element.textContent = `Last updated: ${this.formatTime(this.lastUpdated)}`;
         }
     }
-}
\ No newline at end of file
+}
+
+// Grouping used when the page does not ask for one; set by the UI server
+SwitchController.defaultGroupBy = null;
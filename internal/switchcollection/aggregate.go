@@ -0,0 +1,138 @@
+package switchcollection
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AggregatePolicy determines how the state of an AggregateSwitch is derived
+// from the states of its members
+type AggregatePolicy string
+
+const (
+	// AggregateAllOn reports the aggregate as on only if every member is on
+	AggregateAllOn AggregatePolicy = "all-on"
+	// AggregateAnyOn reports the aggregate as on if at least one member is on
+	AggregateAnyOn AggregatePolicy = "any-on"
+)
+
+// ParseAggregatePolicy parses the name of an aggregate policy. An empty name
+// selects AggregateAllOn.
+func ParseAggregatePolicy(name string) (AggregatePolicy, error) {
+	switch policy := AggregatePolicy(name); policy {
+	case "":
+		return AggregateAllOn, nil
+	case AggregateAllOn, AggregateAnyOn:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%w: %s (must be %s or %s)", ErrInvalidAggregatePolicy, name, AggregateAllOn, AggregateAnyOn)
+	}
+}
+
+// AggregateSwitch is a single logical switch that drives several physical
+// switches, possibly from different collections
+type AggregateSwitch struct {
+	members []Switch
+	policy  AggregatePolicy
+}
+
+// NewAggregateSwitch creates a switch that operates all of members together
+func NewAggregateSwitch(members []Switch, policy AggregatePolicy) (*AggregateSwitch, error) {
+	if len(members) == 0 {
+		return nil, ErrNoAggregateMembers
+	}
+	policy, err := ParseAggregatePolicy(string(policy))
+	if err != nil {
+		return nil, err
+	}
+
+	return &AggregateSwitch{
+		members: members,
+		policy:  policy,
+	}, nil
+}
+
+// Members returns the switches operated by the aggregate
+func (as *AggregateSwitch) Members() []Switch {
+	return as.members
+}
+
+// Policy returns the policy that derives the state of the aggregate from
+// the states of its members
+func (as *AggregateSwitch) Policy() AggregatePolicy {
+	return as.policy
+}
+
+// TurnOn turns on every member. Members that fail do not prevent the others
+// from being turned on; their errors are returned together.
+func (as *AggregateSwitch) TurnOn() error {
+	return as.forEachMember(Switch.TurnOn)
+}
+
+// TurnOff turns off every member. Members that fail do not prevent the
+// others from being turned off; their errors are returned together.
+func (as *AggregateSwitch) TurnOff() error {
+	return as.forEachMember(Switch.TurnOff)
+}
+
+func (as *AggregateSwitch) forEachMember(fn func(Switch) error) error {
+	var errs []error
+	for _, member := range as.members {
+		if err := fn(member); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", member, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetState returns the state of the aggregate according to its policy
+func (as *AggregateSwitch) GetState() (bool, error) {
+	onCount := 0
+	for _, member := range as.members {
+		state, err := member.GetState()
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", member, err)
+		}
+		if state {
+			onCount++
+		}
+	}
+
+	if as.policy == AggregateAnyOn {
+		return onCount > 0, nil
+	}
+	return onCount == len(as.members), nil
+}
+
+// IsDisabled returns true if any member is disabled
+func (as *AggregateSwitch) IsDisabled() bool {
+	for _, member := range as.members {
+		if member.IsDisabled() {
+			return true
+		}
+	}
+	return false
+}
+
+func (as *AggregateSwitch) String() string {
+	names := make([]string, len(as.members))
+	for i, member := range as.members {
+		names[i] = member.String()
+	}
+	return fmt.Sprintf("aggregate:[%s]", strings.Join(names, ","))
+}
+
+// Capabilities returns the capabilities shared by every member of the
+// aggregate switch
+func (as *AggregateSwitch) Capabilities() Capabilities {
+	caps := Capabilities{OnOff: true, Toggle: true, ReadState: true, Dimmable: true}
+	for _, member := range as.members {
+		memberCaps := GetCapabilities(member)
+		caps.OnOff = caps.OnOff && memberCaps.OnOff
+		caps.Toggle = caps.Toggle && memberCaps.Toggle
+		caps.ReadState = caps.ReadState && memberCaps.ReadState
+		caps.Dimmable = caps.Dimmable && memberCaps.Dimmable
+	}
+	return caps
+}
@@ -0,0 +1,101 @@
+package switchcollection
+
+import (
+	"errors"
+	"testing"
+)
+
+func newTestAggregate(t *testing.T, policy AggregatePolicy) (*AggregateSwitch, []Switch) {
+	t.Helper()
+	first := NewDummySwitchCollection(2)
+	second := NewDummySwitchCollection(2)
+	members := []Switch{first.ListSwitches()[0], second.ListSwitches()[1]}
+
+	aggregate, err := NewAggregateSwitch(members, policy)
+	if err != nil {
+		t.Fatalf("NewAggregateSwitch() failed: %v", err)
+	}
+	return aggregate, members
+}
+
+func TestAggregateSwitchPropagatesOnOff(t *testing.T) {
+	aggregate, members := newTestAggregate(t, AggregateAllOn)
+
+	if err := aggregate.TurnOn(); err != nil {
+		t.Fatalf("TurnOn() failed: %v", err)
+	}
+	for _, member := range members {
+		if state, _ := member.GetState(); !state {
+			t.Errorf("member %s is off after TurnOn()", member)
+		}
+	}
+
+	if err := aggregate.TurnOff(); err != nil {
+		t.Fatalf("TurnOff() failed: %v", err)
+	}
+	for _, member := range members {
+		if state, _ := member.GetState(); state {
+			t.Errorf("member %s is on after TurnOff()", member)
+		}
+	}
+}
+
+func TestAggregateSwitchState(t *testing.T) {
+	tests := []struct {
+		policy AggregatePolicy
+		states []bool
+		want   bool
+	}{
+		{AggregateAllOn, []bool{false, false}, false},
+		{AggregateAllOn, []bool{true, false}, false},
+		{AggregateAllOn, []bool{true, true}, true},
+		{AggregateAnyOn, []bool{false, false}, false},
+		{AggregateAnyOn, []bool{false, true}, true},
+		{AggregateAnyOn, []bool{true, true}, true},
+	}
+
+	for _, tt := range tests {
+		aggregate, members := newTestAggregate(t, tt.policy)
+		for i, on := range tt.states {
+			if on {
+				members[i].TurnOn() //nolint:errcheck
+			}
+		}
+
+		state, err := aggregate.GetState()
+		if err != nil {
+			t.Fatalf("GetState() failed: %v", err)
+		}
+		if state != tt.want {
+			t.Errorf("%s with members %v: GetState() = %v, want %v", tt.policy, tt.states, state, tt.want)
+		}
+	}
+}
+
+func TestAggregateSwitchDisabledMember(t *testing.T) {
+	aggregate, members := newTestAggregate(t, AggregateAllOn)
+	members[1].(*DummySwitch).SetDisabled(true)
+
+	if !aggregate.IsDisabled() {
+		t.Error("IsDisabled() = false with a disabled member, want true")
+	}
+
+	// The other members are still turned on
+	if err := aggregate.TurnOn(); !errors.Is(err, ErrSwitchDisabled) {
+		t.Errorf("TurnOn() error = %v, want %v", err, ErrSwitchDisabled)
+	}
+	if state, _ := members[0].GetState(); !state {
+		t.Error("enabled member is off after TurnOn()")
+	}
+}
+
+func TestNewAggregateSwitchErrors(t *testing.T) {
+	sw := NewDummySwitchCollection(1).ListSwitches()[0]
+
+	if _, err := NewAggregateSwitch(nil, AggregateAllOn); !errors.Is(err, ErrNoAggregateMembers) {
+		t.Errorf("NewAggregateSwitch() with no members error = %v, want %v", err, ErrNoAggregateMembers)
+	}
+	if _, err := NewAggregateSwitch([]Switch{sw}, "most-on"); !errors.Is(err, ErrInvalidAggregatePolicy) {
+		t.Errorf("NewAggregateSwitch() with invalid policy error = %v, want %v", err, ErrInvalidAggregatePolicy)
+	}
+}
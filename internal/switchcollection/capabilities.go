@@ -0,0 +1,37 @@
+package switchcollection
+
+// Capabilities describes the operations a switch supports, so that clients
+// can offer only the controls that apply to it.
+type Capabilities struct {
+	// OnOff is set if the switch can be turned on and off
+	OnOff bool `json:"onOff"`
+	// Toggle is set if the switch can be toggled
+	Toggle bool `json:"toggle"`
+	// ReadState is set if GetState reports the state of the device
+	// rather than only the state airdancer last set
+	ReadState bool `json:"readState"`
+	// Dimmable is set if the brightness of the switch can be set
+	Dimmable bool `json:"dimmable"`
+}
+
+// BasicCapabilities are those of a switch that does not report its own
+var BasicCapabilities = Capabilities{
+	OnOff:     true,
+	Toggle:    true,
+	ReadState: true,
+}
+
+// CapabilityReporter is implemented by switches whose capabilities differ
+// from BasicCapabilities.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// GetCapabilities returns the capabilities of sw: those it reports if it is
+// a CapabilityReporter, otherwise BasicCapabilities.
+func GetCapabilities(sw Switch) Capabilities {
+	if reporter, ok := sw.(CapabilityReporter); ok {
+		return reporter.Capabilities()
+	}
+	return BasicCapabilities
+}
@@ -0,0 +1,48 @@
+package switchcollection
+
+import "testing"
+
+// pwmSwitch is a dummy switch whose brightness can be set
+type pwmSwitch struct {
+	*DummySwitch
+}
+
+func (s *pwmSwitch) Capabilities() Capabilities {
+	caps := BasicCapabilities
+	caps.Dimmable = true
+	return caps
+}
+
+func TestGetCapabilities(t *testing.T) {
+	dummy := NewDummySwitchCollection(1)
+	sw, err := dummy.GetSwitch(0)
+	if err != nil {
+		t.Fatalf("GetSwitch() failed: %v", err)
+	}
+
+	if caps := GetCapabilities(sw); caps != BasicCapabilities {
+		t.Errorf("dummy switch capabilities = %+v, want %+v", caps, BasicCapabilities)
+	}
+
+	pwm := &pwmSwitch{sw.(*DummySwitch)}
+	caps := GetCapabilities(pwm)
+	if !caps.Dimmable || !caps.OnOff {
+		t.Errorf("PWM switch capabilities = %+v, want dimmable and on/off", caps)
+	}
+
+	aggregate, err := NewAggregateSwitch([]Switch{pwm, sw}, AggregateAllOn)
+	if err != nil {
+		t.Fatalf("NewAggregateSwitch() failed: %v", err)
+	}
+	if caps := GetCapabilities(aggregate); caps != BasicCapabilities {
+		t.Errorf("aggregate of a PWM and a dummy switch capabilities = %+v, want %+v", caps, BasicCapabilities)
+	}
+
+	aggregate, err = NewAggregateSwitch([]Switch{pwm, pwm}, AggregateAllOn)
+	if err != nil {
+		t.Fatalf("NewAggregateSwitch() failed: %v", err)
+	}
+	if caps := GetCapabilities(aggregate); !caps.Dimmable {
+		t.Errorf("aggregate of PWM switches capabilities = %+v, want dimmable", caps)
+	}
+}
@@ -1,6 +1,7 @@
 package switchcollection
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sync"
@@ -8,29 +9,74 @@ import (
 
 // DummySwitch represents a single virtual switch for testing
 type DummySwitch struct {
-	id    uint
-	state bool
-	mutex sync.RWMutex
+	id         uint
+	state      bool
+	disabled   bool
+	collection *DummySwitchCollection
+	mutex      sync.RWMutex
 }
 
 // DummySwitchCollection implements SwitchCollection for testing
 type DummySwitchCollection struct {
-	switches []Switch
-	mutex    sync.RWMutex
+	switches         []Switch
+	onDisabledChange DisabledCallback
+	onCountChange    CountChangedCallback
+	mutex            sync.RWMutex
 }
 
 // NewDummySwitchCollection creates a new dummy switch collection with specified number of switches
 func NewDummySwitchCollection(switchCount uint) *DummySwitchCollection {
-	switches := make([]Switch, switchCount)
+	dsc := &DummySwitchCollection{
+		switches: make([]Switch, switchCount),
+	}
 	for i := uint(0); i < switchCount; i++ {
-		switches[i] = &DummySwitch{
-			id:    i,
-			state: false,
+		dsc.switches[i] = &DummySwitch{
+			id:         i,
+			state:      false,
+			collection: dsc,
 		}
 	}
 
-	return &DummySwitchCollection{
-		switches: switches,
+	return dsc
+}
+
+// SetDisabledCallback sets a function to be called when a switch in the
+// collection is disabled or re-enabled with SetDisabled
+func (dsc *DummySwitchCollection) SetDisabledCallback(fn DisabledCallback) {
+	dsc.mutex.Lock()
+	defer dsc.mutex.Unlock()
+	dsc.onDisabledChange = fn
+}
+
+// SetCountChangedCallback sets a function to be called when the number of
+// switches in the collection is changed with SetSwitchCount
+func (dsc *DummySwitchCollection) SetCountChangedCallback(fn CountChangedCallback) {
+	dsc.mutex.Lock()
+	defer dsc.mutex.Unlock()
+	dsc.onCountChange = fn
+}
+
+// SetSwitchCount grows or shrinks the collection to switchCount switches.
+// Switches that remain keep their state; switches that are added start
+// off. This simulates devices whose number of outputs changes at runtime
+// for testing.
+func (dsc *DummySwitchCollection) SetSwitchCount(switchCount uint) {
+	dsc.mutex.Lock()
+	oldCount := uint(len(dsc.switches))
+	if switchCount < oldCount {
+		dsc.switches = dsc.switches[:switchCount:switchCount]
+	}
+	for i := oldCount; i < switchCount; i++ {
+		dsc.switches = append(dsc.switches, &DummySwitch{
+			id:         i,
+			collection: dsc,
+		})
+	}
+	callback := dsc.onCountChange
+	dsc.mutex.Unlock()
+
+	if switchCount != oldCount && callback != nil {
+		callback(dsc)
 	}
 }
 
@@ -46,6 +92,11 @@ func (dsc *DummySwitchCollection) Close() error {
 	return nil
 }
 
+// HealthCheck always succeeds since dummy switches have nothing to probe
+func (dsc *DummySwitchCollection) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
 // CountSwitches returns the number of switches
 func (dsc *DummySwitchCollection) CountSwitches() uint {
 	dsc.mutex.RLock()
@@ -149,6 +200,10 @@ func (ds *DummySwitch) TurnOn() error {
 	ds.mutex.Lock()
 	defer ds.mutex.Unlock()
 
+	if ds.disabled {
+		return fmt.Errorf("dummy switch %d: %w", ds.id, ErrSwitchDisabled)
+	}
+
 	log.Printf("turning on dummy switch %d", ds.id)
 	ds.state = true
 	return nil
@@ -159,6 +214,10 @@ func (ds *DummySwitch) TurnOff() error {
 	ds.mutex.Lock()
 	defer ds.mutex.Unlock()
 
+	if ds.disabled {
+		return fmt.Errorf("dummy switch %d: %w", ds.id, ErrSwitchDisabled)
+	}
+
 	log.Printf("turning off dummy switch %d", ds.id)
 	ds.state = false
 	return nil
@@ -172,9 +231,32 @@ func (ds *DummySwitch) GetState() (bool, error) {
 	return ds.state, nil
 }
 
-// IsDisabled returns false since dummy switches are never disabled
+// IsDisabled returns true if the switch has been disabled with SetDisabled
 func (ds *DummySwitch) IsDisabled() bool {
-	return false
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+	return ds.disabled
+}
+
+// SetDisabled marks the switch as disabled or enabled. This simulates the
+// connectivity failures of network-backed drivers for testing.
+func (ds *DummySwitch) SetDisabled(disabled bool) {
+	ds.mutex.Lock()
+	changed := ds.disabled != disabled
+	ds.disabled = disabled
+	ds.mutex.Unlock()
+
+	if !changed || ds.collection == nil {
+		return
+	}
+
+	ds.collection.mutex.RLock()
+	callback := ds.collection.onDisabledChange
+	ds.collection.mutex.RUnlock()
+
+	if callback != nil {
+		callback(ds, disabled)
+	}
 }
 
 // String returns a string representation of the switch
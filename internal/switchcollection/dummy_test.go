@@ -1,6 +1,7 @@
 package switchcollection
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -178,3 +179,79 @@ func TestDummySwitch(t *testing.T) {
 		t.Errorf("String() = %q, want %q", str, expected)
 	}
 }
+
+func TestDummySwitchSetDisabled(t *testing.T) {
+	dsc := NewDummySwitchCollection(1)
+
+	var transitions []bool
+	dsc.SetDisabledCallback(func(sw Switch, disabled bool) {
+		transitions = append(transitions, disabled)
+	})
+
+	sw, err := dsc.GetSwitch(0)
+	if err != nil {
+		t.Fatalf("GetSwitch() failed: %v", err)
+	}
+	ds := sw.(*DummySwitch)
+
+	ds.SetDisabled(true)
+	ds.SetDisabled(true)
+
+	if !ds.IsDisabled() {
+		t.Error("IsDisabled() should be true after SetDisabled(true)")
+	}
+	if err := ds.TurnOn(); !errors.Is(err, ErrSwitchDisabled) {
+		t.Errorf("TurnOn() on disabled switch error = %v, want %v", err, ErrSwitchDisabled)
+	}
+
+	ds.SetDisabled(false)
+
+	if ds.IsDisabled() {
+		t.Error("IsDisabled() should be false after SetDisabled(false)")
+	}
+	if err := ds.TurnOn(); err != nil {
+		t.Errorf("TurnOn() after re-enabling failed: %v", err)
+	}
+
+	if len(transitions) != 2 || !transitions[0] || transitions[1] {
+		t.Errorf("callback transitions = %v, want [true false]", transitions)
+	}
+}
+
+func TestDummySwitchCollectionSetSwitchCount(t *testing.T) {
+	dsc := NewDummySwitchCollection(2)
+
+	var counts []uint
+	dsc.SetCountChangedCallback(func(collection SwitchCollection) {
+		counts = append(counts, collection.CountSwitches())
+	})
+
+	sw, err := dsc.GetSwitch(0)
+	if err != nil {
+		t.Fatalf("GetSwitch() failed: %v", err)
+	}
+	if err := sw.TurnOn(); err != nil {
+		t.Fatalf("TurnOn() failed: %v", err)
+	}
+
+	dsc.SetSwitchCount(1)
+	dsc.SetSwitchCount(1)
+	if _, err := dsc.GetSwitch(1); !errors.Is(err, ErrInvalidSwitchID) {
+		t.Errorf("GetSwitch(1) after shrinking error = %v, want %v", err, ErrInvalidSwitchID)
+	}
+
+	dsc.SetSwitchCount(3)
+	if got := dsc.CountSwitches(); got != 3 {
+		t.Errorf("CountSwitches() = %d, want 3", got)
+	}
+	if kept, _ := dsc.GetSwitch(0); kept != sw {
+		t.Error("GetSwitch(0) should return the same switch after resizing")
+	}
+	if state, _ := sw.GetState(); !state {
+		t.Error("switch 0 should stay on after resizing")
+	}
+
+	if len(counts) != 2 || counts[0] != 1 || counts[1] != 3 {
+		t.Errorf("callback counts = %v, want [1 3]", counts)
+	}
+}
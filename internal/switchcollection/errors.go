@@ -5,4 +5,16 @@ import "errors"
 // Switch validation errors
 var (
 	ErrInvalidSwitchID = errors.New("invalid switch id")
+	ErrSwitchDisabled  = errors.New("switch is disabled")
+)
+
+// Aggregate switch errors
+var (
+	ErrInvalidAggregatePolicy = errors.New("invalid aggregate policy")
+	ErrNoAggregateMembers     = errors.New("aggregate switch has no members")
+)
+
+// Subset collection errors
+var (
+	ErrInvalidSubset = errors.New("invalid enabled switches")
 )
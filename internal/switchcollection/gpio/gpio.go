@@ -1,6 +1,7 @@
 package gpio
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strings"
@@ -102,6 +103,12 @@ func (sc *GPIOSwitchCollection) Close() error {
 	return nil
 }
 
+// HealthCheck always succeeds; GPIO pins are local and are verified when
+// the collection is initialized
+func (sc *GPIOSwitchCollection) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
 func (sc *GPIOSwitchCollection) CountSwitches() uint {
 	return uint(len(sc.switches))
 }
@@ -1,6 +1,7 @@
 package gpio_warthog
 
 import (
+	"context"
 	"fmt"
 	"log"
 
@@ -117,6 +118,12 @@ func (sc *WarthogGPIOSwitchCollection) Close() error {
 	return nil
 }
 
+// HealthCheck always succeeds; GPIO lines are local and are verified when
+// the collection is initialized
+func (sc *WarthogGPIOSwitchCollection) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
 func (sc *WarthogGPIOSwitchCollection) CountSwitches() uint {
 	return uint(len(sc.switches))
 }
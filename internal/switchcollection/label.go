@@ -0,0 +1,16 @@
+package switchcollection
+
+// Labeler is implemented by switches that are given a name in their driver
+// configuration, such as PiFace outputs configured with output-names.
+type Labeler interface {
+	GetName() string
+}
+
+// GetLabel returns the name sw is given in its driver configuration, or an
+// empty string if it is not a Labeler or has no name.
+func GetLabel(sw Switch) string {
+	if labeler, ok := sw.(Labeler); ok {
+		return labeler.GetName()
+	}
+	return ""
+}
@@ -0,0 +1,28 @@
+package switchcollection
+
+import "testing"
+
+// namedSwitch is a dummy switch with a name from its driver configuration
+type namedSwitch struct {
+	*DummySwitch
+	name string
+}
+
+func (s *namedSwitch) GetName() string {
+	return s.name
+}
+
+func TestGetLabel(t *testing.T) {
+	dummy := NewDummySwitchCollection(1)
+	sw, err := dummy.GetSwitch(0)
+	if err != nil {
+		t.Fatalf("GetSwitch() failed: %v", err)
+	}
+
+	if label := GetLabel(sw); label != "" {
+		t.Errorf("dummy switch label = %q, want none", label)
+	}
+	if label := GetLabel(&namedSwitch{sw.(*DummySwitch), "fan"}); label != "fan" {
+		t.Errorf("named switch label = %q, want %q", label, "fan")
+	}
+}
@@ -0,0 +1,178 @@
+package switchcollection
+
+import (
+	"context"
+	"fmt"
+)
+
+// SubsetCollection exposes some of the switches of another collection,
+// numbered from 0 in the order in which they were enabled. Switch n of the
+// subset is switch indices[n] of the underlying collection.
+type SubsetCollection struct {
+	collection SwitchCollection
+	indices    []uint
+}
+
+// NewSubsetCollection returns a collection exposing the switches of
+// collection at indices. Each index must be a switch of collection, and may
+// be given only once.
+func NewSubsetCollection(collection SwitchCollection, indices []uint) (*SubsetCollection, error) {
+	if len(indices) == 0 {
+		return nil, fmt.Errorf("%w: no switches are enabled", ErrInvalidSubset)
+	}
+
+	count := collection.CountSwitches()
+	seen := make(map[uint]bool, len(indices))
+	for _, index := range indices {
+		if index >= count {
+			return nil, fmt.Errorf("%w: switch %d out of range (have %d switches)", ErrInvalidSubset, index, count)
+		}
+		if seen[index] {
+			return nil, fmt.Errorf("%w: switch %d is enabled more than once", ErrInvalidSubset, index)
+		}
+		seen[index] = true
+	}
+
+	return &SubsetCollection{collection: collection, indices: indices}, nil
+}
+
+// Init initializes the underlying collection
+func (sc *SubsetCollection) Init() error {
+	return sc.collection.Init()
+}
+
+// Close closes the underlying collection
+func (sc *SubsetCollection) Close() error {
+	return sc.collection.Close()
+}
+
+// HealthCheck probes the underlying collection
+func (sc *SubsetCollection) HealthCheck(ctx context.Context) error {
+	return sc.collection.HealthCheck(ctx)
+}
+
+// CountSwitches returns the number of enabled switches
+func (sc *SubsetCollection) CountSwitches() uint {
+	return uint(len(sc.indices))
+}
+
+// ListSwitches returns the enabled switches. Switches that the underlying
+// collection no longer provides are left out.
+func (sc *SubsetCollection) ListSwitches() []Switch {
+	switches := make([]Switch, 0, len(sc.indices))
+	for _, index := range sc.indices {
+		if sw, err := sc.collection.GetSwitch(index); err == nil {
+			switches = append(switches, sw)
+		}
+	}
+	return switches
+}
+
+// GetSwitch returns enabled switch id
+func (sc *SubsetCollection) GetSwitch(id uint) (Switch, error) {
+	if id >= uint(len(sc.indices)) {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidSwitchID, id)
+	}
+	return sc.collection.GetSwitch(sc.indices[id])
+}
+
+// TurnOn turns on the enabled switches
+func (sc *SubsetCollection) TurnOn() error {
+	for id := range sc.indices {
+		sw, err := sc.GetSwitch(uint(id))
+		if err != nil {
+			return err
+		}
+		if err := sw.TurnOn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TurnOff turns off the enabled switches
+func (sc *SubsetCollection) TurnOff() error {
+	for id := range sc.indices {
+		sw, err := sc.GetSwitch(uint(id))
+		if err != nil {
+			return err
+		}
+		if err := sw.TurnOff(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetState returns true if all enabled switches are on
+func (sc *SubsetCollection) GetState() (bool, error) {
+	states, err := sc.GetDetailedState()
+	if err != nil {
+		return false, err
+	}
+	for _, state := range states {
+		if !state {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// GetDetailedState returns the state of each enabled switch
+func (sc *SubsetCollection) GetDetailedState() ([]bool, error) {
+	states := make([]bool, len(sc.indices))
+	for id := range sc.indices {
+		sw, err := sc.GetSwitch(uint(id))
+		if err != nil {
+			return nil, err
+		}
+		if states[id], err = sw.GetState(); err != nil {
+			return nil, err
+		}
+	}
+	return states, nil
+}
+
+// IsDisabled returns true if the underlying collection is disabled
+func (sc *SubsetCollection) IsDisabled() bool {
+	return sc.collection.IsDisabled()
+}
+
+// String returns a string representation
+func (sc *SubsetCollection) String() string {
+	return fmt.Sprintf("switches %v of %s", sc.indices, sc.collection)
+}
+
+// SetDisabledCallback passes fn to the underlying collection, if it reports
+// switches becoming disabled
+func (sc *SubsetCollection) SetDisabledCallback(fn DisabledCallback) {
+	if notifier, ok := sc.collection.(DisabledStateNotifier); ok {
+		notifier.SetDisabledCallback(fn)
+	}
+}
+
+// SetStateCallback passes fn to the underlying collection, if it reports
+// state changes made on its devices
+func (sc *SubsetCollection) SetStateCallback(fn StateCallback) {
+	if notifier, ok := sc.collection.(StateChangeNotifier); ok {
+		notifier.SetStateCallback(fn)
+	}
+}
+
+// SetCountChangedCallback has fn called with the subset when the number of
+// switches in the underlying collection changes, if it can change. The
+// subset keeps its switches, some of which may no longer be provided.
+func (sc *SubsetCollection) SetCountChangedCallback(fn CountChangedCallback) {
+	if notifier, ok := sc.collection.(CountChangeNotifier); ok {
+		notifier.SetCountChangedCallback(func(SwitchCollection) { fn(sc) })
+	}
+}
+
+// SubscribeTelemetry subscribes the underlying collection to the state
+// reports of its devices, if it supports them
+func (sc *SubsetCollection) SubscribeTelemetry(sub MessageSubscriber) error {
+	if subscriber, ok := sc.collection.(TelemetrySubscriber); ok {
+		return subscriber.SubscribeTelemetry(sub)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package switchcollection
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSubsetCollection(t *testing.T) {
+	dsc := NewDummySwitchCollection(6)
+	subset, err := NewSubsetCollection(dsc, []uint{4, 1})
+	if err != nil {
+		t.Fatalf("NewSubsetCollection() failed: %v", err)
+	}
+
+	if count := subset.CountSwitches(); count != 2 {
+		t.Errorf("CountSwitches() = %d, want 2", count)
+	}
+	if switches := subset.ListSwitches(); len(switches) != 2 || switches[0] != dsc.switches[4] || switches[1] != dsc.switches[1] {
+		t.Errorf("ListSwitches() = %v, want switches 4 and 1", switches)
+	}
+
+	// Switches are remapped to the order in which they were enabled
+	sw, err := subset.GetSwitch(0)
+	if err != nil {
+		t.Fatalf("GetSwitch(0) failed: %v", err)
+	}
+	if err := sw.TurnOn(); err != nil {
+		t.Fatalf("TurnOn() failed: %v", err)
+	}
+	if states, _ := dsc.GetDetailedState(); !states[4] || states[0] {
+		t.Errorf("underlying states after turning on subset switch 0 = %v, want only switch 4 on", states)
+	}
+	if _, err := subset.GetSwitch(2); !errors.Is(err, ErrInvalidSwitchID) {
+		t.Errorf("GetSwitch(2) error = %v, want %v", err, ErrInvalidSwitchID)
+	}
+
+	// Operations on the whole collection only affect enabled switches
+	if err := subset.TurnOn(); err != nil {
+		t.Fatalf("TurnOn() failed: %v", err)
+	}
+	if on, err := subset.GetState(); err != nil || !on {
+		t.Errorf("GetState() = %v, %v; want true", on, err)
+	}
+	if states, _ := dsc.GetDetailedState(); states[0] || states[2] || states[3] || states[5] {
+		t.Errorf("underlying states after turning on the subset = %v, want only switches 1 and 4 on", states)
+	}
+
+	for _, indices := range [][]uint{nil, {6}, {1, 1}} {
+		if _, err := NewSubsetCollection(dsc, indices); !errors.Is(err, ErrInvalidSubset) {
+			t.Errorf("NewSubsetCollection(%v) error = %v, want %v", indices, err, ErrInvalidSubset)
+		}
+	}
+}
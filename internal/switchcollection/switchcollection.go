@@ -1,5 +1,7 @@
 package switchcollection
 
+import "context"
+
 type (
 	Switch interface {
 		TurnOn() error
@@ -17,5 +19,77 @@ type (
 		GetDetailedState() ([]bool, error)
 		Init() error
 		Close() error
+		// HealthCheck probes the underlying hardware or devices and
+		// returns an error if they cannot be reached. Collections that
+		// have nothing to probe return nil.
+		HealthCheck(ctx context.Context) error
+	}
+
+	// HealthChecker is implemented by switches that can probe their
+	// device individually. HealthCheck returns an error if the device
+	// cannot be reached, and re-enables a disabled switch if it can.
+	HealthChecker interface {
+		HealthCheck(ctx context.Context) error
+	}
+
+	// DisabledCallback is called when a switch becomes disabled (disabled
+	// is true) or is re-enabled (disabled is false).
+	DisabledCallback func(sw Switch, disabled bool)
+
+	// DisabledStateNotifier is implemented by switch collections whose
+	// switches can become disabled at runtime, for example because a
+	// network device is unreachable. The callback is called once per
+	// transition, not on every failed operation.
+	DisabledStateNotifier interface {
+		SetDisabledCallback(fn DisabledCallback)
+	}
+
+	// StateCallback is called when a switch reports that its state was
+	// changed outside of airdancer, for example with a button on the
+	// device.
+	StateCallback func(sw Switch, state bool)
+
+	// StateChangeNotifier is implemented by switch collections whose
+	// devices report state changes made on the device itself.
+	StateChangeNotifier interface {
+		SetStateCallback(fn StateCallback)
+	}
+
+	// CountChangedCallback is called when the number of switches in a
+	// collection changes.
+	CountChangedCallback func(collection SwitchCollection)
+
+	// CountChangeNotifier is implemented by switch collections whose
+	// number of switches can change at runtime, for example a device
+	// that reports a different number of relays after a firmware update,
+	// or hardware that is hotplugged. Switches that keep their index may
+	// be replaced by new Switch values, so users should look switches up
+	// again with GetSwitch when the callback is called. The callback must
+	// not be called from inside a switch operation.
+	CountChangeNotifier interface {
+		SetCountChangedCallback(fn CountChangedCallback)
+	}
+
+	// MessageSubscriber is a connection to a message broker, such as an
+	// MQTT client, that delivers messages published on a topic.
+	MessageSubscriber interface {
+		Subscribe(topic string, qos byte, handler func(topic string, payload []byte)) error
+		IsConnected() bool
+	}
+
+	// MessagePublisher is a connection to a message broker, such as an
+	// MQTT client, that publishes messages on a topic. The
+	// MessageSubscriber passed to SubscribeTelemetry may implement it, so
+	// that collections can send commands to their devices through the
+	// broker.
+	MessagePublisher interface {
+		Publish(topic string, qos byte, retained bool, payload interface{}) error
+	}
+
+	// TelemetrySubscriber is implemented by switch collections whose
+	// devices publish their state to a message broker. SubscribeTelemetry
+	// is called each time the broker connection is established.
+	TelemetrySubscriber interface {
+		SubscribeTelemetry(sub MessageSubscriber) error
 	}
 )
@@ -0,0 +1,49 @@
+package switchdrivers
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultMaxIdleConnsPerHost is the number of idle keep-alive
+	// connections kept open to each device when not otherwise configured.
+	DefaultMaxIdleConnsPerHost = 4
+
+	// DefaultIdleConnTimeout is how long an idle keep-alive connection is
+	// kept open when not otherwise configured.
+	DefaultIdleConnTimeout = 90 * time.Second
+)
+
+// HTTPClientConfig configures the HTTP client used by HTTP-based drivers.
+type HTTPClientConfig struct {
+	Timeout             time.Duration
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	DisableKeepAlives   bool
+}
+
+// NewHTTPClient creates an HTTP client tuned for talking to a set of
+// devices. A single client should be created per collection and shared by
+// all of its switches so that connections to each device are kept alive
+// and reused rather than re-established for every request.
+func NewHTTPClient(cfg HTTPClientConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	if transport.MaxIdleConnsPerHost == 0 {
+		transport.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	if transport.IdleConnTimeout == 0 {
+		transport.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+
+	transport.DisableKeepAlives = cfg.DisableKeepAlives
+
+	return &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: transport,
+	}
+}
@@ -9,8 +9,10 @@ import (
 
 // PiFaceConfig represents PiFace driver configuration
 type PiFaceConfig struct {
-	SPIDev      string `mapstructure:"spidev"`
-	MaxSwitches uint   `mapstructure:"max-switches"`
+	SPIDev         string   `mapstructure:"spidev"`
+	MaxSwitches    uint     `mapstructure:"max-switches"`
+	EnabledOutputs []uint8  `mapstructure:"enabled-outputs"`
+	OutputNames    []string `mapstructure:"output-names"`
 }
 
 // PiFaceFactory implements Factory for PiFace drivers
@@ -28,7 +30,12 @@ func (f *PiFaceFactory) CreateDriver(config map[string]interface{}) (switchcolle
 		spidev = "/dev/spidev0.0"
 	}
 
-	sc, err := piface.NewPiFace(true, spidev, cfg.MaxSwitches)
+	var sc *piface.PiFace
+	if len(cfg.EnabledOutputs) > 0 {
+		sc, err = piface.NewPiFaceWithOutputs(true, spidev, cfg.EnabledOutputs, cfg.OutputNames)
+	} else {
+		sc, err = piface.NewPiFace(true, spidev, cfg.MaxSwitches)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create PiFace on %s: %w", spidev, err)
 	}
@@ -59,6 +66,43 @@ func (f *PiFaceFactory) parseConfig(config map[string]interface{}) (*PiFaceConfi
 		cfg.MaxSwitches = uint(maxSwitches)
 	}
 
+	if rawOutputs, exists := config["enabled-outputs"]; exists {
+		outputs, err := parseIndexList[uint8](rawOutputs, "output", piface.NUMBER_OF_OUTPUTS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid enabled-outputs: %w", err)
+		}
+		if len(outputs) == 0 {
+			return nil, fmt.Errorf("invalid enabled-outputs: %w", piface.ErrNoOutputs)
+		}
+		cfg.EnabledOutputs = outputs
+	}
+
+	if names, ok := config["output-names"].([]interface{}); ok {
+		cfg.OutputNames = make([]string, len(names))
+		for i, name := range names {
+			nameStr, ok := name.(string)
+			if !ok {
+				return nil, fmt.Errorf("output name %d is not a string", i)
+			}
+			cfg.OutputNames[i] = nameStr
+		}
+	} else if names, ok := config["output-names"].([]string); ok {
+		cfg.OutputNames = names
+	}
+
+	if len(cfg.OutputNames) > 0 && len(cfg.EnabledOutputs) == 0 {
+		return nil, fmt.Errorf("output-names requires enabled-outputs")
+	}
+
+	if len(cfg.EnabledOutputs) > 0 {
+		if cfg.MaxSwitches != 0 {
+			return nil, fmt.Errorf("max-switches and enabled-outputs cannot both be set")
+		}
+		if err := piface.ValidateOutputs(cfg.EnabledOutputs, cfg.OutputNames); err != nil {
+			return nil, err
+		}
+	}
+
 	return cfg, nil
 }
 
@@ -0,0 +1,164 @@
+package switchdrivers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/larsks/airdancer/internal/piface"
+)
+
+func TestPiFaceFactory_ParseConfig(t *testing.T) {
+	factory := &PiFaceFactory{}
+
+	tests := []struct {
+		name    string
+		config  map[string]interface{}
+		want    *PiFaceConfig
+		wantErr error
+	}{
+		{
+			name:   "empty config",
+			config: map[string]interface{}{},
+			want:   &PiFaceConfig{},
+		},
+		{
+			name: "max-switches",
+			config: map[string]interface{}{
+				"max-switches": 4,
+			},
+			want: &PiFaceConfig{MaxSwitches: 4},
+		},
+		{
+			name: "enabled outputs from config file",
+			config: map[string]interface{}{
+				"enabled-outputs": []interface{}{int64(0), int64(1), int64(5)},
+			},
+			want: &PiFaceConfig{EnabledOutputs: []uint8{0, 1, 5}},
+		},
+		{
+			name: "enabled outputs with names",
+			config: map[string]interface{}{
+				"enabled-outputs": []int{7, 2},
+				"output-names":    []interface{}{"fan", "light"},
+			},
+			want: &PiFaceConfig{
+				EnabledOutputs: []uint8{7, 2},
+				OutputNames:    []string{"fan", "light"},
+			},
+		},
+		{
+			name: "output out of range",
+			config: map[string]interface{}{
+				"enabled-outputs": []interface{}{0, 8},
+			},
+			wantErr: errors.New("out of range"),
+		},
+		{
+			name: "negative output",
+			config: map[string]interface{}{
+				"enabled-outputs": []interface{}{-1},
+			},
+			wantErr: errors.New("out of range"),
+		},
+		{
+			name: "duplicate output",
+			config: map[string]interface{}{
+				"enabled-outputs": []interface{}{1, 3, 1},
+			},
+			wantErr: piface.ErrDuplicateOutput,
+		},
+		{
+			name: "empty output list",
+			config: map[string]interface{}{
+				"enabled-outputs": []interface{}{},
+			},
+			wantErr: piface.ErrNoOutputs,
+		},
+		{
+			name: "non-integer output",
+			config: map[string]interface{}{
+				"enabled-outputs": []interface{}{"one"},
+			},
+			wantErr: errors.New("not an integer"),
+		},
+		{
+			name: "wrong number of names",
+			config: map[string]interface{}{
+				"enabled-outputs": []interface{}{0, 1},
+				"output-names":    []string{"fan"},
+			},
+			wantErr: piface.ErrOutputNamesMismatch,
+		},
+		{
+			name: "names without outputs",
+			config: map[string]interface{}{
+				"output-names": []string{"fan"},
+			},
+			wantErr: errors.New("requires enabled-outputs"),
+		},
+		{
+			name: "max-switches with enabled outputs",
+			config: map[string]interface{}{
+				"max-switches":    2,
+				"enabled-outputs": []interface{}{0, 1},
+			},
+			wantErr: errors.New("cannot both be set"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := factory.parseConfig(tt.config)
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatalf("parseConfig() expected error %v, got nil", tt.wantErr)
+				}
+				if !errors.Is(err, tt.wantErr) && !strings.Contains(err.Error(), tt.wantErr.Error()) {
+					t.Errorf("parseConfig() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseConfig() unexpected error = %v", err)
+			}
+
+			if got.MaxSwitches != tt.want.MaxSwitches {
+				t.Errorf("parseConfig() max-switches = %d, want %d", got.MaxSwitches, tt.want.MaxSwitches)
+			}
+			if len(got.EnabledOutputs) != len(tt.want.EnabledOutputs) {
+				t.Fatalf("parseConfig() enabled-outputs = %v, want %v", got.EnabledOutputs, tt.want.EnabledOutputs)
+			}
+			for i := range got.EnabledOutputs {
+				if got.EnabledOutputs[i] != tt.want.EnabledOutputs[i] {
+					t.Errorf("parseConfig() enabled-outputs[%d] = %d, want %d", i, got.EnabledOutputs[i], tt.want.EnabledOutputs[i])
+				}
+			}
+			if len(got.OutputNames) != len(tt.want.OutputNames) {
+				t.Fatalf("parseConfig() output-names = %v, want %v", got.OutputNames, tt.want.OutputNames)
+			}
+			for i := range got.OutputNames {
+				if got.OutputNames[i] != tt.want.OutputNames[i] {
+					t.Errorf("parseConfig() output-names[%d] = %s, want %s", i, got.OutputNames[i], tt.want.OutputNames[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPiFaceFactory_ValidateConfig(t *testing.T) {
+	factory := &PiFaceFactory{}
+
+	if err := factory.ValidateConfig(map[string]interface{}{
+		"enabled-outputs": []interface{}{0, 1, 5},
+		"output-names":    []interface{}{"a", "b", "c"},
+	}); err != nil {
+		t.Errorf("ValidateConfig() unexpected error = %v", err)
+	}
+
+	if err := factory.ValidateConfig(map[string]interface{}{
+		"enabled-outputs": []interface{}{0, 0},
+	}); err == nil {
+		t.Error("ValidateConfig() expected error for duplicate outputs")
+	}
+}
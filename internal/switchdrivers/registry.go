@@ -39,7 +39,13 @@ func (r *Registry) Register(name string, factory Factory) error {
 	return nil
 }
 
-// Create creates a switch collection using the specified driver
+// EnabledSwitchesKey is the configuration option, accepted by every driver,
+// that lists the switches of a collection to expose. The enabled switches
+// are numbered from 0 in the order they are listed.
+const EnabledSwitchesKey = "enabled-switches"
+
+// Create creates a switch collection using the specified driver. If the
+// configuration lists enabled switches, only those are exposed.
 func (r *Registry) Create(driverName string, config map[string]interface{}) (switchcollection.SwitchCollection, error) {
 	r.mu.RLock()
 	factory, exists := r.drivers[driverName]
@@ -49,10 +55,26 @@ func (r *Registry) Create(driverName string, config map[string]interface{}) (swi
 		return nil, fmt.Errorf("unknown driver: %s", driverName)
 	}
 
-	return factory.CreateDriver(config)
+	driverConfig, enabled, err := splitEnabledSwitches(config)
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := factory.CreateDriver(driverConfig)
+	if err != nil || enabled == nil {
+		return sc, err
+	}
+
+	subset, err := switchcollection.NewSubsetCollection(sc, enabled)
+	if err != nil {
+		sc.Close() //nolint:errcheck
+		return nil, err
+	}
+	return subset, nil
 }
 
-// ValidateConfig validates configuration for the specified driver
+// ValidateConfig validates configuration for the specified driver. Enabled
+// switches can only be checked against the collection once it is created.
 func (r *Registry) ValidateConfig(driverName string, config map[string]interface{}) error {
 	r.mu.RLock()
 	factory, exists := r.drivers[driverName]
@@ -62,7 +84,87 @@ func (r *Registry) ValidateConfig(driverName string, config map[string]interface
 		return fmt.Errorf("unknown driver: %s", driverName)
 	}
 
-	return factory.ValidateConfig(config)
+	driverConfig, _, err := splitEnabledSwitches(config)
+	if err != nil {
+		return err
+	}
+
+	return factory.ValidateConfig(driverConfig)
+}
+
+// splitEnabledSwitches returns config without EnabledSwitchesKey, and the
+// switches it lists, or nil if it is not set
+func splitEnabledSwitches(config map[string]interface{}) (map[string]interface{}, []uint, error) {
+	raw, exists := config[EnabledSwitchesKey]
+	if !exists {
+		return config, nil, nil
+	}
+
+	enabled, err := parseIndexList[uint](raw, "switch", 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", switchcollection.ErrInvalidSubset, err)
+	}
+	if len(enabled) == 0 {
+		return nil, nil, fmt.Errorf("%w: no switches are enabled", switchcollection.ErrInvalidSubset)
+	}
+
+	driverConfig := make(map[string]interface{}, len(config)-1)
+	for key, value := range config {
+		if key != EnabledSwitchesKey {
+			driverConfig[key] = value
+		}
+	}
+	return driverConfig, enabled, nil
+}
+
+// parseIndexList converts a list of indices (as decoded from a config file or
+// provided directly) into a slice of T. name is what each index refers to,
+// for error messages. If limit is not 0, every index must be less than it.
+func parseIndexList[T uint | uint8](raw interface{}, name string, limit int64) ([]T, error) {
+	var items []interface{}
+	switch v := raw.(type) {
+	case []interface{}:
+		items = v
+	case []int:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	case []uint:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("must be a list of integers")
+	}
+
+	indices := make([]T, len(items))
+	for i, item := range items {
+		var n int64
+		switch v := item.(type) {
+		case int:
+			n = int64(v)
+		case int64:
+			n = v
+		case uint:
+			n = int64(v)
+		case float64:
+			if v != float64(int64(v)) {
+				return nil, fmt.Errorf("%s %d is not an integer: %v", name, i, v)
+			}
+			n = int64(v)
+		default:
+			return nil, fmt.Errorf("%s %d is not an integer: %v", name, i, item)
+		}
+		switch {
+		case limit != 0 && (n < 0 || n >= limit):
+			return nil, fmt.Errorf("%s %d out of range: %d (must be 0-%d)", name, i, n, limit-1)
+		case n < 0:
+			return nil, fmt.Errorf("%s %d cannot be negative: %d", name, i, n)
+		}
+		indices[i] = T(n)
+	}
+
+	return indices, nil
 }
 
 // ListDrivers returns the names of all registered drivers
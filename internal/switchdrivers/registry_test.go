@@ -1,7 +1,11 @@
 package switchdrivers
 
 import (
+	"errors"
+	"fmt"
 	"testing"
+
+	"github.com/larsks/airdancer/internal/switchcollection"
 )
 
 func TestDefaultRegistry_SwitchDrivers(t *testing.T) {
@@ -70,3 +74,51 @@ func TestValidateConfig(t *testing.T) {
 		t.Error("Unknown driver should produce error")
 	}
 }
+
+func TestEnabledSwitches(t *testing.T) {
+	driver, err := Create("dummy", map[string]interface{}{
+		"switch-count":     6,
+		"enabled-switches": []interface{}{int64(5), int64(1), int64(3)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create dummy switch driver with enabled switches: %v", err)
+	}
+
+	// Only the enabled switches are exposed, renumbered in the order listed
+	if driver.CountSwitches() != 3 {
+		t.Fatalf("Expected 3 switches, got %d", driver.CountSwitches())
+	}
+	subset := driver.(*switchcollection.SubsetCollection)
+	for id, want := range []uint{5, 1, 3} {
+		sw, err := subset.GetSwitch(uint(id))
+		if err != nil {
+			t.Fatalf("GetSwitch(%d) failed: %v", id, err)
+		}
+		if sw.String() != fmt.Sprintf("dummy:%d", want) {
+			t.Errorf("GetSwitch(%d) = %s, want switch %d", id, sw, want)
+		}
+	}
+	if _, err := subset.GetSwitch(3); !errors.Is(err, switchcollection.ErrInvalidSwitchID) {
+		t.Errorf("GetSwitch(3) error = %v, want %v", err, switchcollection.ErrInvalidSwitchID)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		enabled interface{}
+	}{
+		{"out of range", []interface{}{int64(0), int64(6)}},
+		{"duplicate", []interface{}{int64(2), int64(2)}},
+		{"empty", []interface{}{}},
+		{"negative", []interface{}{int64(-1)}},
+		{"not a list", "0,1"},
+	} {
+		config := map[string]interface{}{"switch-count": 6, "enabled-switches": tc.enabled}
+		if _, err := Create("dummy", config); !errors.Is(err, switchcollection.ErrInvalidSubset) {
+			t.Errorf("%s: Create() error = %v, want %v", tc.name, err, switchcollection.ErrInvalidSubset)
+		}
+	}
+
+	if err := ValidateConfig("dummy", map[string]interface{}{"enabled-switches": []interface{}{int64(0)}}); err != nil {
+		t.Errorf("ValidateConfig() with enabled switches failed: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package switchdrivers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -15,10 +16,26 @@ import (
 	"github.com/larsks/airdancer/internal/switchcollection"
 )
 
+// Tasmota control modes select how switches are turned on and off
+const (
+	// TasmotaControlHTTP sends commands to the device over HTTP. This is
+	// the default.
+	TasmotaControlHTTP = "http"
+	// TasmotaControlMQTT publishes commands to the device's
+	// cmnd/<topic>/POWER topic while the MQTT broker is connected, and
+	// sends them over HTTP otherwise. It requires topics.
+	TasmotaControlMQTT = "mqtt"
+)
+
 // TasmotaConfig represents Tasmota driver configuration
 type TasmotaConfig struct {
-	Addresses []string `mapstructure:"addresses"`
-	Timeout   int      `mapstructure:"timeout"` // in seconds
+	Addresses           []string      `mapstructure:"addresses"`
+	Topics              []string      `mapstructure:"topics"`
+	Control             string        `mapstructure:"control"`
+	Timeout             time.Duration `mapstructure:"timeout"`
+	MaxIdleConnsPerHost int           `mapstructure:"max-idle-conns-per-host"`
+	IdleConnTimeout     time.Duration `mapstructure:"idle-conn-timeout"`
+	DisableKeepAlives   bool          `mapstructure:"disable-keep-alives"`
 }
 
 // TasmotaFactory implements Factory for Tasmota drivers
@@ -35,11 +52,21 @@ func (f *TasmotaFactory) CreateDriver(config map[string]interface{}) (switchcoll
 		return nil, fmt.Errorf("tasmota driver requires at least one address")
 	}
 
-	if cfg.Timeout == 0 {
-		cfg.Timeout = 5 // Default timeout of 5 seconds
+	client := NewHTTPClient(HTTPClientConfig{
+		Timeout:             cfg.Timeout,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		DisableKeepAlives:   cfg.DisableKeepAlives,
+	})
+
+	collection := NewTasmotaSwitchCollectionWithClient(cfg.Addresses, client)
+	for i, topic := range cfg.Topics {
+		tasmotaSwitch := collection.switches[i].(*TasmotaSwitch)
+		tasmotaSwitch.SetTopic(topic)
+		tasmotaSwitch.SetMQTTControl(cfg.Control == TasmotaControlMQTT)
 	}
 
-	return NewTasmotaSwitchCollection(cfg.Addresses, time.Duration(cfg.Timeout)*time.Second), nil
+	return collection, nil
 }
 
 // ValidateConfig validates Tasmota configuration
@@ -85,8 +112,60 @@ func (f *TasmotaFactory) parseConfig(config map[string]interface{}) (*TasmotaCon
 		return nil, fmt.Errorf("addresses configuration is required and must be a string array")
 	}
 
-	if timeout, ok := config["timeout"].(int); ok {
-		cfg.Timeout = timeout
+	if topics, ok := config["topics"].([]interface{}); ok {
+		cfg.Topics = make([]string, len(topics))
+		for i, topic := range topics {
+			if topicStr, ok := topic.(string); ok {
+				cfg.Topics[i] = topicStr
+			} else {
+				return nil, fmt.Errorf("topic %d is not a string", i)
+			}
+		}
+	} else if topics, ok := config["topics"].([]string); ok {
+		cfg.Topics = topics
+	}
+	if len(cfg.Topics) > 0 && len(cfg.Topics) != len(cfg.Addresses) {
+		return nil, fmt.Errorf("topics must have one entry for each address (have %d topics and %d addresses)", len(cfg.Topics), len(cfg.Addresses))
+	}
+
+	cfg.Control = TasmotaControlHTTP
+	if control, ok := config["control"]; ok {
+		controlStr, ok := control.(string)
+		if !ok {
+			return nil, fmt.Errorf("control must be a string")
+		}
+		switch controlStr {
+		case "", TasmotaControlHTTP:
+		case TasmotaControlMQTT:
+			if len(cfg.Topics) == 0 {
+				return nil, fmt.Errorf("control %q requires topics", TasmotaControlMQTT)
+			}
+			cfg.Control = controlStr
+		default:
+			return nil, fmt.Errorf("control must be %q or %q, got %q", TasmotaControlHTTP, TasmotaControlMQTT, controlStr)
+		}
+	}
+
+	timeout, err := ParseTimeout(config)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Timeout = timeout
+
+	maxIdle, err := parseNonNegativeInt(config, "max-idle-conns-per-host", 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg.MaxIdleConnsPerHost = maxIdle
+
+	idleTimeout, err := parseSeconds(config, "idle-conn-timeout", 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg.IdleConnTimeout = idleTimeout
+
+	if disableKeepAlives, ok := config["disable-keep-alives"].(bool); ok {
+		cfg.DisableKeepAlives = disableKeepAlives
 	}
 
 	return cfg, nil
@@ -99,25 +178,65 @@ type TasmotaResponse struct {
 
 // TasmotaSwitch represents a single Tasmota switch
 type TasmotaSwitch struct {
-	address  string
-	client   *http.Client
-	disabled bool
-	mutex    sync.RWMutex
+	address          string
+	client           *http.Client
+	disabled         bool
+	onDisabledChange switchcollection.DisabledCallback
+	mutex            sync.RWMutex
+
+	// The device's MQTT topic and the last state it reported. While
+	// telemetry is connected, GetState returns the cached state instead of
+	// querying the device.
+	topic         string
+	telemetry     switchcollection.MessageSubscriber
+	state         bool
+	stateKnown    bool
+	onStateChange switchcollection.StateCallback
+
+	// mqttControl sends commands through publisher, rather than over
+	// HTTP, while telemetry is connected. A command sent over MQTT is
+	// pending until the device confirms it on its stat topic, or until
+	// confirmTimeout passes and the command is sent over HTTP instead.
+	mqttControl    bool
+	publisher      switchcollection.MessagePublisher
+	pending        *powerCommand
+	confirmTimeout time.Duration
 }
 
-// NewTasmotaSwitch creates a new Tasmota switch
+// powerCommand is a command sent over MQTT that is waiting for the device to
+// report the state it asked for. done is closed once the device does, and
+// superseded is closed if a newer command is sent before it does.
+type powerCommand struct {
+	state      bool
+	done       chan struct{}
+	superseded chan struct{}
+}
+
+// NewTasmotaSwitch creates a new Tasmota switch with its own HTTP client
 func NewTasmotaSwitch(address string, timeout time.Duration) *TasmotaSwitch {
+	return NewTasmotaSwitchWithClient(address, NewHTTPClient(HTTPClientConfig{Timeout: timeout}))
+}
+
+// NewTasmotaSwitchWithClient creates a new Tasmota switch that sends
+// requests using the given HTTP client
+func NewTasmotaSwitchWithClient(address string, client *http.Client) *TasmotaSwitch {
 	// Ensure address has http:// prefix
 	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
 		address = "http://" + address
 	}
 
+	// Commands sent over MQTT are given as long to be confirmed as
+	// requests sent over HTTP are given to complete
+	confirmTimeout := client.Timeout
+	if confirmTimeout == 0 {
+		confirmTimeout = DefaultTimeout
+	}
+
 	return &TasmotaSwitch{
-		address:  address,
-		disabled: false,
-		client: &http.Client{
-			Timeout: timeout,
-		},
+		address:        address,
+		disabled:       false,
+		client:         client,
+		confirmTimeout: confirmTimeout,
 	}
 }
 
@@ -130,7 +249,7 @@ func (s *TasmotaSwitch) TurnOn() error {
 	}
 	s.mutex.RUnlock()
 
-	_, err := s.sendCommand("Power+ON")
+	err := s.setPower(true)
 	if err != nil {
 		log.Printf("switch %s failed to turn on: %v", s.address, err)
 		s.markDisabled()
@@ -149,7 +268,7 @@ func (s *TasmotaSwitch) TurnOff() error {
 	}
 	s.mutex.RUnlock()
 
-	_, err := s.sendCommand("Power+OFF")
+	err := s.setPower(false)
 	if err != nil {
 		log.Printf("switch %s failed to turn off: %v", s.address, err)
 		s.markDisabled()
@@ -166,6 +285,11 @@ func (s *TasmotaSwitch) GetState() (bool, error) {
 		s.mutex.RUnlock()
 		return false, nil
 	}
+	if s.stateKnown && s.telemetry != nil && s.telemetry.IsConnected() {
+		state := s.state
+		s.mutex.RUnlock()
+		return state, nil
+	}
 	s.mutex.RUnlock()
 
 	resp, err := s.sendCommand("Power")
@@ -188,21 +312,168 @@ func (s *TasmotaSwitch) IsDisabled() bool {
 // markDisabled marks the switch as disabled
 func (s *TasmotaSwitch) markDisabled() {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	if !s.disabled {
+	changed := !s.disabled
+	if changed {
 		s.disabled = true
 		log.Printf("switch %s marked as disabled due to network connectivity issues", s.address)
 	}
+	callback := s.onDisabledChange
+	s.mutex.Unlock()
+
+	if changed && callback != nil {
+		callback(s, true)
+	}
 }
 
 // markEnabled marks the switch as enabled
 func (s *TasmotaSwitch) markEnabled() {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	if s.disabled {
+	changed := s.disabled
+	if changed {
 		s.disabled = false
 		log.Printf("switch %s re-enabled after network connectivity restored", s.address)
 	}
+	callback := s.onDisabledChange
+	s.mutex.Unlock()
+
+	if changed && callback != nil {
+		callback(s, false)
+	}
+}
+
+// SetTopic sets the MQTT topic the device publishes its state on (the
+// Tasmota "Topic" setting). Its state reports are received once the
+// collection is subscribed to telemetry.
+func (s *TasmotaSwitch) SetTopic(topic string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.topic = topic
+}
+
+// SetMQTTControl selects whether the switch is turned on and off by
+// publishing to the device's cmnd/<topic>/POWER topic while the collection
+// is subscribed to telemetry, rather than over HTTP. Commands are still
+// sent over HTTP while the broker is not connected.
+func (s *TasmotaSwitch) SetMQTTControl(enabled bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mqttControl = enabled
+}
+
+// setPower turns the device on or off, through MQTT if the switch is
+// controlled that way and the broker is connected, and over HTTP otherwise
+func (s *TasmotaSwitch) setPower(on bool) error {
+	payload, command := "OFF", "Power+OFF"
+	if on {
+		payload, command = "ON", "Power+ON"
+	}
+
+	s.mutex.Lock()
+	topic, publisher, timeout := s.topic, s.publisher, s.confirmTimeout
+	viaMQTT := s.mqttControl && publisher != nil && s.telemetry != nil && s.telemetry.IsConnected()
+	var pending *powerCommand
+	if viaMQTT {
+		// The device's report of the new state on stat/<topic>/POWER
+		// confirms the command, and is not taken for a change made on
+		// the device. A command still waiting for its confirmation is
+		// superseded by this one, so that it is not sent over HTTP
+		// after this one.
+		if s.pending != nil {
+			close(s.pending.superseded)
+		}
+		pending = &powerCommand{state: on, done: make(chan struct{}), superseded: make(chan struct{})}
+		s.pending = pending
+	}
+	s.mutex.Unlock()
+
+	if viaMQTT {
+		// Publishing only hands the command to the client, so the state
+		// is not known to have changed until the device reports it
+		err := publisher.Publish(fmt.Sprintf("cmnd/%s/POWER", topic), 0, false, payload)
+		if err == nil {
+			select {
+			case <-pending.done:
+				return nil
+			case <-pending.superseded:
+				log.Printf("switch %s: command %s was superseded before the device confirmed it", s.address, payload)
+				return nil
+			case <-time.After(timeout):
+				err = fmt.Errorf("device did not confirm the command within %s", timeout)
+			}
+		}
+
+		s.mutex.Lock()
+		superseded := s.pending != pending
+		if !superseded {
+			s.pending = nil
+		}
+		s.mutex.Unlock()
+		if superseded {
+			// A newer command was sent while this one timed out
+			return nil
+		}
+		log.Printf("switch %s failed to send command over MQTT, using HTTP: %v", s.address, err)
+	}
+
+	_, err := s.sendCommand(command)
+	return err
+}
+
+// setState records the state reported by the device. If notify is true and
+// the state differs from the last known state, the state callback is
+// called.
+func (s *TasmotaSwitch) setState(state, notify bool) {
+	s.mutex.Lock()
+	changed := s.stateKnown && s.state != state
+	s.state = state
+	s.stateKnown = true
+	callback := s.onStateChange
+	s.mutex.Unlock()
+
+	if notify && changed && callback != nil {
+		callback(s, state)
+	}
+}
+
+// handlePowerMessage handles a stat/<topic>/POWER message, which Tasmota
+// publishes whenever the relay changes state. A report of the state asked
+// for by a pending command confirms the command rather than being reported
+// as a change made on the device.
+func (s *TasmotaSwitch) handlePowerMessage(topic string, payload []byte) {
+	var state bool
+	switch strings.ToUpper(strings.TrimSpace(string(payload))) {
+	case "ON":
+		state = true
+	case "OFF":
+		state = false
+	default:
+		log.Printf("switch %s: ignoring unexpected payload %q on %s", s.address, payload, topic)
+		return
+	}
+
+	s.mutex.Lock()
+	pending := s.pending
+	confirmed := pending != nil && pending.state == state
+	if confirmed {
+		s.pending = nil
+	}
+	s.mutex.Unlock()
+
+	s.setState(state, !confirmed)
+	if confirmed {
+		close(pending.done)
+	}
+}
+
+// HealthCheck reads the power state of the device to check that it is
+// reachable, and marks the switch disabled or enabled accordingly.
+func (s *TasmotaSwitch) HealthCheck(ctx context.Context) error {
+	if _, err := s.sendCommandContext(ctx, "Power"); err != nil {
+		s.markDisabled()
+		return fmt.Errorf("switch %s is unreachable: %w", s.address, err)
+	}
+	s.markEnabled()
+	return nil
 }
 
 // String returns a string representation of the switch
@@ -212,15 +483,28 @@ func (s *TasmotaSwitch) String() string {
 
 // sendCommand sends a command to the Tasmota device and returns the response
 func (s *TasmotaSwitch) sendCommand(command string) (*TasmotaResponse, error) {
+	return s.sendCommandContext(context.Background(), command)
+}
+
+// sendCommandContext is like sendCommand, but the request is canceled if
+// ctx is done before it completes
+func (s *TasmotaSwitch) sendCommandContext(ctx context.Context, command string) (*TasmotaResponse, error) {
 	url := fmt.Sprintf("%s/cm?cmnd=%s", s.address, command)
 
-	resp, err := s.client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
 	}
 	defer resp.Body.Close() //nolint:errcheck
 
 	if resp.StatusCode != http.StatusOK {
+		// Drain the body so that the connection can be reused
+		io.Copy(io.Discard, resp.Body) //nolint:errcheck
 		return nil, fmt.Errorf("HTTP request failed with status %d", resp.StatusCode)
 	}
 
@@ -234,26 +518,41 @@ func (s *TasmotaSwitch) sendCommand(command string) (*TasmotaResponse, error) {
 		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
 	}
 
+	switch tasmotaResp.Power {
+	case "ON":
+		s.setState(true, false)
+	case "OFF":
+		s.setState(false, false)
+	}
+
 	return &tasmotaResp, nil
 }
 
 // TasmotaSwitchCollection represents a collection of Tasmota switches
 type TasmotaSwitchCollection struct {
 	switches   []switchcollection.Switch
+	client     *http.Client
 	cancelFunc context.CancelFunc
 	monitorCtx context.Context
 }
 
 // NewTasmotaSwitchCollection creates a new Tasmota switch collection
 func NewTasmotaSwitchCollection(addresses []string, timeout time.Duration) *TasmotaSwitchCollection {
+	return NewTasmotaSwitchCollectionWithClient(addresses, NewHTTPClient(HTTPClientConfig{Timeout: timeout}))
+}
+
+// NewTasmotaSwitchCollectionWithClient creates a new Tasmota switch
+// collection whose switches all share the given HTTP client
+func NewTasmotaSwitchCollectionWithClient(addresses []string, client *http.Client) *TasmotaSwitchCollection {
 	switches := make([]switchcollection.Switch, len(addresses))
 	for i, addr := range addresses {
-		switches[i] = NewTasmotaSwitch(addr, timeout)
+		switches[i] = NewTasmotaSwitchWithClient(addr, client)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	collection := &TasmotaSwitchCollection{
 		switches:   switches,
+		client:     client,
 		cancelFunc: cancel,
 		monitorCtx: ctx,
 	}
@@ -311,6 +610,65 @@ func (c *TasmotaSwitchCollection) GetState() (bool, error) {
 	return false, nil
 }
 
+// SetDisabledCallback sets a function to be called when a switch in the
+// collection is disabled due to network issues or re-enabled
+func (c *TasmotaSwitchCollection) SetDisabledCallback(fn switchcollection.DisabledCallback) {
+	for _, sw := range c.switches {
+		if tasmotaSwitch, ok := sw.(*TasmotaSwitch); ok {
+			tasmotaSwitch.mutex.Lock()
+			tasmotaSwitch.onDisabledChange = fn
+			tasmotaSwitch.mutex.Unlock()
+		}
+	}
+}
+
+// SetStateCallback sets a function to be called when a switch in the
+// collection reports, through telemetry, that it was turned on or off on
+// the device
+func (c *TasmotaSwitchCollection) SetStateCallback(fn switchcollection.StateCallback) {
+	for _, sw := range c.switches {
+		if tasmotaSwitch, ok := sw.(*TasmotaSwitch); ok {
+			tasmotaSwitch.mutex.Lock()
+			tasmotaSwitch.onStateChange = fn
+			tasmotaSwitch.mutex.Unlock()
+		}
+	}
+}
+
+// SubscribeTelemetry subscribes to the stat/<topic>/POWER topic of every
+// switch that has a topic, so that state changes made on the device are
+// noticed without polling. If sub is also a MessagePublisher, switches
+// controlled through MQTT send their commands with it.
+func (c *TasmotaSwitchCollection) SubscribeTelemetry(sub switchcollection.MessageSubscriber) error {
+	publisher, _ := sub.(switchcollection.MessagePublisher)
+
+	var errs []error
+	for _, sw := range c.switches {
+		tasmotaSwitch, ok := sw.(*TasmotaSwitch)
+		if !ok {
+			continue
+		}
+
+		tasmotaSwitch.mutex.RLock()
+		topic := tasmotaSwitch.topic
+		tasmotaSwitch.mutex.RUnlock()
+		if topic == "" {
+			continue
+		}
+
+		if err := sub.Subscribe(fmt.Sprintf("stat/%s/POWER", topic), 0, tasmotaSwitch.handlePowerMessage); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		tasmotaSwitch.mutex.Lock()
+		tasmotaSwitch.telemetry = sub
+		tasmotaSwitch.publisher = publisher
+		tasmotaSwitch.mutex.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
 // IsDisabled returns false since Tasmota switch collections are never disabled (individual switches can be)
 func (c *TasmotaSwitchCollection) IsDisabled() bool {
 	return false
@@ -361,15 +719,11 @@ func (c *TasmotaSwitchCollection) GetDetailedState() ([]bool, error) {
 // Init initializes the switch collection and checks initial connectivity
 func (c *TasmotaSwitchCollection) Init() error {
 	log.Printf("initializing Tasmota switch collection with %d switches", len(c.switches))
-	// Perform initial connectivity check for all switches
+	// Perform initial connectivity check for all switches. Switches that
+	// are unreachable are marked as disabled.
 	for _, sw := range c.switches {
 		if tasmotaSwitch, ok := sw.(*TasmotaSwitch); ok {
-			// Try to get the initial state to test connectivity
-			_, err := tasmotaSwitch.sendCommand("Power")
-			if err != nil {
-				// Mark as disabled if unreachable during initialization
-				tasmotaSwitch.markDisabled()
-			} else {
+			if err := tasmotaSwitch.HealthCheck(c.monitorCtx); err == nil {
 				log.Printf("switch %s is reachable and ready", tasmotaSwitch.address)
 			}
 		}
@@ -377,12 +731,29 @@ func (c *TasmotaSwitchCollection) Init() error {
 	return nil
 }
 
+// HealthCheck probes every switch in the collection and returns an error
+// describing the switches that could not be reached
+func (c *TasmotaSwitchCollection) HealthCheck(ctx context.Context) error {
+	var errs []error
+	for _, sw := range c.switches {
+		if tasmotaSwitch, ok := sw.(*TasmotaSwitch); ok {
+			if err := tasmotaSwitch.HealthCheck(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // Close closes the switch collection
 func (c *TasmotaSwitchCollection) Close() error {
 	if c.cancelFunc != nil {
 		log.Printf("stopping Tasmota switch monitoring")
 		c.cancelFunc()
 	}
+	if c.client != nil {
+		c.client.CloseIdleConnections()
+	}
 	return nil
 }
 
@@ -407,12 +778,8 @@ func (c *TasmotaSwitchCollection) checkDisabledSwitches() {
 	for _, sw := range c.switches {
 		if tasmotaSwitch, ok := sw.(*TasmotaSwitch); ok && tasmotaSwitch.IsDisabled() {
 			disabledCount++
-			// Try to get state to test connectivity
-			_, err := tasmotaSwitch.sendCommand("Power")
-			if err == nil {
-				// Switch is back online, mark as enabled
-				tasmotaSwitch.markEnabled()
-			}
+			// A successful probe re-enables the switch
+			tasmotaSwitch.HealthCheck(c.monitorCtx) //nolint:errcheck
 		}
 	}
 	if disabledCount > 0 {
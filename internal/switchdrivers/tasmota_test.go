@@ -1,11 +1,22 @@
 package switchdrivers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/larsks/airdancer/internal/switchcollection"
+	"github.com/spf13/viper"
 )
 
 func TestTasmotaFactory_ParseConfig(t *testing.T) {
@@ -25,7 +36,7 @@ func TestTasmotaFactory_ParseConfig(t *testing.T) {
 			},
 			want: &TasmotaConfig{
 				Addresses: []string{"192.168.1.100", "192.168.1.101"},
-				Timeout:   10,
+				Timeout:   10 * time.Second,
 			},
 			wantErr: false,
 		},
@@ -36,10 +47,64 @@ func TestTasmotaFactory_ParseConfig(t *testing.T) {
 			},
 			want: &TasmotaConfig{
 				Addresses: []string{"192.168.1.100", "192.168.1.101"},
-				Timeout:   0,
+				Timeout:   DefaultTimeout,
+			},
+			wantErr: false,
+		},
+		{
+			name: "connection tuning",
+			config: map[string]interface{}{
+				"addresses":               []string{"192.168.1.100"},
+				"max-idle-conns-per-host": 2,
+				"idle-conn-timeout":       30,
+				"disable-keep-alives":     true,
+			},
+			want: &TasmotaConfig{
+				Addresses:           []string{"192.168.1.100"},
+				Timeout:             DefaultTimeout,
+				MaxIdleConnsPerHost: 2,
+				IdleConnTimeout:     30 * time.Second,
+				DisableKeepAlives:   true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "topics",
+			config: map[string]interface{}{
+				"addresses": []string{"192.168.1.100", "192.168.1.101"},
+				"topics":    []interface{}{"plug_a", ""},
+			},
+			want: &TasmotaConfig{
+				Addresses: []string{"192.168.1.100", "192.168.1.101"},
+				Topics:    []string{"plug_a", ""},
+				Timeout:   DefaultTimeout,
 			},
 			wantErr: false,
 		},
+		{
+			name: "topics without matching addresses",
+			config: map[string]interface{}{
+				"addresses": []string{"192.168.1.100", "192.168.1.101"},
+				"topics":    []string{"plug_a"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative idle-conn-timeout",
+			config: map[string]interface{}{
+				"addresses":         []string{"192.168.1.100"},
+				"idle-conn-timeout": -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative max-idle-conns-per-host",
+			config: map[string]interface{}{
+				"addresses":               []string{"192.168.1.100"},
+				"max-idle-conns-per-host": -1,
+			},
+			wantErr: true,
+		},
 		{
 			name: "missing addresses",
 			config: map[string]interface{}{
@@ -80,14 +145,53 @@ func TestTasmotaFactory_ParseConfig(t *testing.T) {
 						t.Errorf("parseConfig() address[%d] = %v, want %v", i, addr, tt.want.Addresses[i])
 					}
 				}
+				if !slices.Equal(got.Topics, tt.want.Topics) {
+					t.Errorf("parseConfig() topics = %v, want %v", got.Topics, tt.want.Topics)
+				}
 				if got.Timeout != tt.want.Timeout {
 					t.Errorf("parseConfig() timeout = %v, want %v", got.Timeout, tt.want.Timeout)
 				}
+				if got.MaxIdleConnsPerHost != tt.want.MaxIdleConnsPerHost {
+					t.Errorf("parseConfig() max-idle-conns-per-host = %v, want %v", got.MaxIdleConnsPerHost, tt.want.MaxIdleConnsPerHost)
+				}
+				if got.IdleConnTimeout != tt.want.IdleConnTimeout {
+					t.Errorf("parseConfig() idle-conn-timeout = %v, want %v", got.IdleConnTimeout, tt.want.IdleConnTimeout)
+				}
+				if got.DisableKeepAlives != tt.want.DisableKeepAlives {
+					t.Errorf("parseConfig() disable-keep-alives = %v, want %v", got.DisableKeepAlives, tt.want.DisableKeepAlives)
+				}
 			}
 		})
 	}
 }
 
+func TestTasmotaFactory_ParseConfigFromTOML(t *testing.T) {
+	// Options read from a config file are decoded by viper, which gives
+	// integers as int64 rather than int
+	v := viper.New()
+	v.SetConfigType("toml")
+	if err := v.ReadConfig(strings.NewReader(`
+[driverconfig]
+addresses = ["192.168.1.100"]
+max-idle-conns-per-host = 4
+idle-conn-timeout = 30
+`)); err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+
+	factory := &TasmotaFactory{}
+	got, err := factory.parseConfig(v.GetStringMap("driverconfig"))
+	if err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+	if got.MaxIdleConnsPerHost != 4 {
+		t.Errorf("parseConfig() max-idle-conns-per-host = %v, want 4", got.MaxIdleConnsPerHost)
+	}
+	if got.IdleConnTimeout != 30*time.Second {
+		t.Errorf("parseConfig() idle-conn-timeout = %v, want %v", got.IdleConnTimeout, 30*time.Second)
+	}
+}
+
 func TestTasmotaFactory_ValidateConfig(t *testing.T) {
 	factory := &TasmotaFactory{}
 
@@ -124,6 +228,31 @@ func TestTasmotaFactory_ValidateConfig(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "mqtt control",
+			config: map[string]interface{}{
+				"addresses": []string{"192.168.1.100"},
+				"topics":    []string{"plug_a"},
+				"control":   "mqtt",
+			},
+			wantErr: false,
+		},
+		{
+			name: "mqtt control without topics",
+			config: map[string]interface{}{
+				"addresses": []string{"192.168.1.100"},
+				"control":   "mqtt",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown control",
+			config: map[string]interface{}{
+				"addresses": []string{"192.168.1.100"},
+				"control":   "websocket",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -524,3 +653,457 @@ func TestNewTasmotaSwitch_URLHandling(t *testing.T) {
 		})
 	}
 }
+
+func TestTasmotaSwitchCollection_ReusesConnections(t *testing.T) {
+	var newConns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TasmotaResponse{Power: "ON"}) //nolint:errcheck
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	// Several switches on the same device share the collection's client
+	addresses := []string{server.URL, server.URL, server.URL}
+	collection := NewTasmotaSwitchCollection(addresses, 5*time.Second)
+	defer collection.Close() //nolint:errcheck
+
+	for i := 0; i < 5; i++ {
+		for _, sw := range collection.ListSwitches() {
+			if err := sw.TurnOn(); err != nil {
+				t.Fatalf("TurnOn() error = %v", err)
+			}
+		}
+	}
+
+	if got := newConns.Load(); got != 1 {
+		t.Errorf("server saw %d new connections, want 1", got)
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	client := NewHTTPClient(HTTPClientConfig{Timeout: 3 * time.Second})
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("NewHTTPClient() transport is %T, want *http.Transport", client.Transport)
+	}
+	if client.Timeout != 3*time.Second {
+		t.Errorf("NewHTTPClient() timeout = %v, want %v", client.Timeout, 3*time.Second)
+	}
+	if transport.MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost {
+		t.Errorf("NewHTTPClient() MaxIdleConnsPerHost = %v, want %v", transport.MaxIdleConnsPerHost, DefaultMaxIdleConnsPerHost)
+	}
+	if transport.IdleConnTimeout != DefaultIdleConnTimeout {
+		t.Errorf("NewHTTPClient() IdleConnTimeout = %v, want %v", transport.IdleConnTimeout, DefaultIdleConnTimeout)
+	}
+	if transport == http.DefaultTransport {
+		t.Error("NewHTTPClient() must not modify http.DefaultTransport")
+	}
+}
+
+func TestTasmotaSwitchCollection_DisabledCallback(t *testing.T) {
+	online := atomic.Bool{}
+	online.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !online.Load() {
+			http.Error(w, "offline", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TasmotaResponse{Power: "ON"}) //nolint:errcheck
+	}))
+	defer server.Close()
+
+	collection := NewTasmotaSwitchCollection([]string{server.URL}, 5*time.Second)
+	defer collection.Close() //nolint:errcheck
+
+	var transitions []bool
+	collection.SetDisabledCallback(func(sw switchcollection.Switch, disabled bool) {
+		transitions = append(transitions, disabled)
+	})
+
+	sw := collection.ListSwitches()[0].(*TasmotaSwitch)
+
+	online.Store(false)
+	sw.TurnOn()   //nolint:errcheck
+	sw.GetState() //nolint:errcheck
+
+	online.Store(true)
+	collection.checkDisabledSwitches()
+	collection.checkDisabledSwitches()
+
+	if len(transitions) != 2 || !transitions[0] || transitions[1] {
+		t.Errorf("callback transitions = %v, want [true false]", transitions)
+	}
+}
+
+func TestTasmotaSwitchCollection_HealthCheck(t *testing.T) {
+	var commands atomic.Int32
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commands.Add(1)
+		if cmnd := r.URL.Query().Get("cmnd"); cmnd != "Power" {
+			t.Errorf("health check sent command %q, want %q", cmnd, "Power")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TasmotaResponse{Power: "OFF"}) //nolint:errcheck
+	}))
+	defer up.Close()
+
+	// A server that has been shut down refuses connections
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	downURL := down.URL
+	down.Close()
+
+	t.Run("up", func(t *testing.T) {
+		collection := NewTasmotaSwitchCollection([]string{up.URL}, 5*time.Second)
+		defer collection.Close() //nolint:errcheck
+
+		if err := collection.HealthCheck(context.Background()); err != nil {
+			t.Errorf("HealthCheck() error = %v, want nil", err)
+		}
+		if commands.Load() == 0 {
+			t.Error("HealthCheck() did not contact the device")
+		}
+		if collection.ListSwitches()[0].IsDisabled() {
+			t.Error("switch disabled after successful health check")
+		}
+	})
+
+	t.Run("down", func(t *testing.T) {
+		collection := NewTasmotaSwitchCollection([]string{up.URL, downURL}, 5*time.Second)
+		defer collection.Close() //nolint:errcheck
+
+		err := collection.HealthCheck(context.Background())
+		if err == nil {
+			t.Fatal("HealthCheck() error = nil, want error for unreachable switch")
+		}
+		if !strings.Contains(err.Error(), downURL) {
+			t.Errorf("HealthCheck() error %q does not mention %s", err, downURL)
+		}
+		if strings.Contains(err.Error(), "switch "+up.URL+" ") {
+			t.Errorf("HealthCheck() error %q mentions reachable switch %s", err, up.URL)
+		}
+
+		switches := collection.ListSwitches()
+		if switches[0].IsDisabled() {
+			t.Error("reachable switch disabled after health check")
+		}
+		if !switches[1].IsDisabled() {
+			t.Error("unreachable switch not disabled after health check")
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		collection := NewTasmotaSwitchCollection([]string{up.URL}, 5*time.Second)
+		defer collection.Close() //nolint:errcheck
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := collection.HealthCheck(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("HealthCheck() error = %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+// fakeSubscriber records subscriptions so that tests can deliver messages,
+// and records the messages it is asked to publish
+type fakeSubscriber struct {
+	handlers  map[string]func(topic string, payload []byte)
+	connected bool
+
+	// mutex protects published, which commands sent concurrently append
+	// to
+	mutex     sync.Mutex
+	published []string
+
+	// echo makes a fake device confirm each POWER command by reporting
+	// the new state on its stat topic
+	echo bool
+}
+
+func (f *fakeSubscriber) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	f.mutex.Lock()
+	f.published = append(f.published, fmt.Sprintf("%s %v", topic, payload))
+	f.mutex.Unlock()
+	if f.echo {
+		if deviceTopic, ok := strings.CutPrefix(topic, "cmnd/"); ok {
+			f.publish("stat/"+deviceTopic, fmt.Sprint(payload))
+		}
+	}
+	return nil
+}
+
+func (f *fakeSubscriber) Subscribe(topic string, qos byte, handler func(topic string, payload []byte)) error {
+	f.handlers[topic] = handler
+	return nil
+}
+
+func (f *fakeSubscriber) IsConnected() bool {
+	return f.connected
+}
+
+// publishedCount returns the number of messages published so far
+func (f *fakeSubscriber) publishedCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.published)
+}
+
+func (f *fakeSubscriber) publish(topic, payload string) {
+	if handler, ok := f.handlers[topic]; ok {
+		handler(topic, []byte(payload))
+	}
+}
+
+func TestTasmotaSwitchCollection_Telemetry(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TasmotaResponse{Power: "OFF"}) //nolint:errcheck
+	}))
+	defer server.Close()
+
+	collection := NewTasmotaSwitchCollection([]string{server.URL, server.URL}, 5*time.Second)
+	defer collection.Close() //nolint:errcheck
+	sw := collection.ListSwitches()[0].(*TasmotaSwitch)
+	sw.SetTopic("plug_a")
+
+	var changes []bool
+	collection.SetStateCallback(func(changed switchcollection.Switch, state bool) {
+		if changed != sw {
+			t.Errorf("state callback called for %s, want %s", changed, sw)
+		}
+		changes = append(changes, state)
+	})
+
+	sub := &fakeSubscriber{handlers: make(map[string]func(string, []byte)), connected: true}
+	if err := collection.SubscribeTelemetry(sub); err != nil {
+		t.Fatalf("SubscribeTelemetry() failed: %v", err)
+	}
+	if len(sub.handlers) != 1 || sub.handlers["stat/plug_a/POWER"] == nil {
+		t.Fatalf("SubscribeTelemetry() subscribed to %v, want only stat/plug_a/POWER", sub.handlers)
+	}
+
+	// The first report is recorded without calling the callback, since
+	// there is no previous state to compare it with
+	sub.publish("stat/plug_a/POWER", "OFF")
+	requests.Store(0)
+
+	// A button press on the device turns it on
+	sub.publish("stat/plug_a/POWER", "ON")
+	state, err := sw.GetState()
+	if err != nil {
+		t.Fatalf("GetState() failed: %v", err)
+	}
+	if !state {
+		t.Error("GetState() = false after telemetry reported ON")
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("GetState() sent %d requests while telemetry is connected, want 0", n)
+	}
+
+	// Repeated and invalid reports don't call the callback
+	sub.publish("stat/plug_a/POWER", "ON")
+	sub.publish("stat/plug_a/POWER", "bogus")
+	sub.publish("stat/plug_a/POWER", "OFF")
+	if !slices.Equal(changes, []bool{true, false}) {
+		t.Errorf("state changes = %v, want [true false]", changes)
+	}
+
+	// Without a telemetry connection the device is queried again
+	sub.connected = false
+	if _, err := sw.GetState(); err != nil {
+		t.Fatalf("GetState() failed: %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("GetState() sent %d requests while telemetry is disconnected, want 1", n)
+	}
+}
+
+func TestTasmotaSwitchCollection_MQTTControl(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		power := "OFF"
+		if r.URL.Query().Get("cmnd") == "Power ON" {
+			power = "ON"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TasmotaResponse{Power: power}) //nolint:errcheck
+	}))
+	defer server.Close()
+
+	driver, err := (&TasmotaFactory{}).CreateDriver(map[string]interface{}{
+		"addresses": []string{server.URL},
+		"topics":    []string{"plug_a"},
+		"control":   "mqtt",
+	})
+	if err != nil {
+		t.Fatalf("CreateDriver() failed: %v", err)
+	}
+	collection := driver.(*TasmotaSwitchCollection)
+	defer collection.Close() //nolint:errcheck
+	sw := collection.ListSwitches()[0]
+
+	var changes []bool
+	collection.SetStateCallback(func(_ switchcollection.Switch, state bool) {
+		changes = append(changes, state)
+	})
+
+	sub := &fakeSubscriber{handlers: make(map[string]func(string, []byte)), connected: true, echo: true}
+	if err := collection.SubscribeTelemetry(sub); err != nil {
+		t.Fatalf("SubscribeTelemetry() failed: %v", err)
+	}
+	sub.publish("stat/plug_a/POWER", "OFF")
+
+	// Commands are published to the device's command topic, not sent
+	// over HTTP, and the device confirms them on its stat topic, which
+	// is not a change made on the device
+	if err := sw.TurnOn(); err != nil {
+		t.Fatalf("TurnOn() failed: %v", err)
+	}
+	if want := []string{"cmnd/plug_a/POWER ON"}; !slices.Equal(sub.published, want) {
+		t.Errorf("published %q, want %q", sub.published, want)
+	}
+	if state, err := sw.GetState(); err != nil || !state {
+		t.Errorf("GetState() = %v, %v after turning on over MQTT, want true", state, err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("state changes = %v after a command sent over MQTT, want none", changes)
+	}
+
+	// The state is read from the stat topic
+	sub.publish("stat/plug_a/POWER", "OFF")
+	if state, err := sw.GetState(); err != nil || state {
+		t.Errorf("GetState() = %v, %v after the device reported OFF, want false", state, err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("sent %d HTTP requests while MQTT is connected, want 0", n)
+	}
+
+	// A command that the device does not confirm leaves the state
+	// unchanged until it is sent over HTTP instead
+	sub.echo = false
+	sw.(*TasmotaSwitch).confirmTimeout = 10 * time.Millisecond
+	if err := sw.TurnOn(); err != nil {
+		t.Fatalf("TurnOn() failed: %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("sent %d HTTP requests after an unconfirmed command, want 1", n)
+	}
+	if state, err := sw.GetState(); err != nil || !state {
+		t.Errorf("GetState() = %v, %v after turning on over HTTP, want true", state, err)
+	}
+
+	// Without the broker, commands are sent over HTTP
+	sub.connected = false
+	if err := sw.TurnOn(); err != nil {
+		t.Fatalf("TurnOn() failed: %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("sent %d HTTP requests while MQTT is disconnected, want 2", n)
+	}
+	if len(sub.published) != 2 {
+		t.Errorf("published %q while MQTT is disconnected, want nothing more", sub.published)
+	}
+}
+
+func TestTasmotaSwitch_MQTTControlUnconfirmed(t *testing.T) {
+	// The device is offline, so neither the command nor the fallback
+	// request reaches it
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sw := NewTasmotaSwitch(server.URL, time.Second)
+	sw.SetTopic("plug_a")
+	sw.SetMQTTControl(true)
+	sw.confirmTimeout = 10 * time.Millisecond
+
+	collection := &TasmotaSwitchCollection{switches: []switchcollection.Switch{sw}}
+	sub := &fakeSubscriber{handlers: make(map[string]func(string, []byte)), connected: true}
+	if err := collection.SubscribeTelemetry(sub); err != nil {
+		t.Fatalf("SubscribeTelemetry() failed: %v", err)
+	}
+	sub.publish("stat/plug_a/POWER", "OFF")
+
+	if err := sw.TurnOn(); err == nil {
+		t.Error("TurnOn() succeeded although the device never confirmed the command")
+	}
+	sw.markEnabled()
+	if state, _ := sw.GetState(); state {
+		t.Error("GetState() = true after an unconfirmed command, want false")
+	}
+}
+
+func TestTasmotaSwitch_MQTTControlSuperseded(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TasmotaResponse{Power: "OFF"}) //nolint:errcheck
+	}))
+	defer server.Close()
+
+	sw := NewTasmotaSwitch(server.URL, time.Second)
+	sw.SetTopic("plug_a")
+	sw.SetMQTTControl(true)
+	sw.confirmTimeout = 200 * time.Millisecond
+
+	collection := &TasmotaSwitchCollection{switches: []switchcollection.Switch{sw}}
+	var changes atomic.Int32
+	collection.SetStateCallback(func(_ switchcollection.Switch, _ bool) {
+		changes.Add(1)
+	})
+	sub := &fakeSubscriber{handlers: make(map[string]func(string, []byte)), connected: true}
+	if err := collection.SubscribeTelemetry(sub); err != nil {
+		t.Fatalf("SubscribeTelemetry() failed: %v", err)
+	}
+	sub.publish("stat/plug_a/POWER", "OFF")
+
+	waitPublished := func(n int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for sub.publishedCount() < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d commands were not published", n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// The device has not confirmed "on" when "off" is sent, and then
+	// confirms only "off"
+	errs := make(chan error, 2)
+	go func() { errs <- sw.TurnOn() }()
+	waitPublished(1)
+	go func() { errs <- sw.TurnOff() }()
+	waitPublished(2)
+	sub.publish("stat/plug_a/POWER", "OFF")
+
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Errorf("overlapping command failed: %v", err)
+		}
+	}
+
+	// Outlive the confirmation timeout of the first command, which must
+	// not fall back to HTTP and turn the device back on
+	time.Sleep(2 * sw.confirmTimeout)
+	if n := requests.Load(); n != 0 {
+		t.Errorf("sent %d HTTP requests for a superseded command, want 0", n)
+	}
+	if state, _ := sw.GetState(); state {
+		t.Error("GetState() = true after the newer off command was confirmed")
+	}
+	if n := changes.Load(); n != 0 {
+		t.Errorf("state callback called %d times for confirmed commands, want 0", n)
+	}
+}
@@ -0,0 +1,91 @@
+package switchdrivers
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// DefaultTimeout is the request timeout used by network drivers when the
+// collection does not set "timeout".
+const DefaultTimeout = 5 * time.Second
+
+// ParseTimeout returns the "timeout" option of a driver configuration.
+// Network drivers should use this so that every driver interprets the
+// option the same way: a number of seconds (integer or fractional), with
+// DefaultTimeout used when it is missing or zero.
+func ParseTimeout(config map[string]interface{}) (time.Duration, error) {
+	return parseSeconds(config, "timeout", DefaultTimeout)
+}
+
+// parseSeconds reads an option given in seconds as an integer or floating
+// point value. Missing or zero values return def; negative values and
+// other types are errors.
+func parseSeconds(config map[string]interface{}, key string, def time.Duration) (time.Duration, error) {
+	value, ok := config[key]
+	if !ok || value == nil {
+		return def, nil
+	}
+
+	var seconds float64
+	switch v := value.(type) {
+	case int:
+		seconds = float64(v)
+	case int32:
+		seconds = float64(v)
+	case int64:
+		seconds = float64(v)
+	case uint:
+		seconds = float64(v)
+	case uint32:
+		seconds = float64(v)
+	case uint64:
+		seconds = float64(v)
+	case float32:
+		seconds = float64(v)
+	case float64:
+		seconds = v
+	default:
+		return 0, fmt.Errorf("%s must be a number of seconds, got %T", key, value)
+	}
+
+	if seconds < 0 || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, fmt.Errorf("%s must be a non-negative number of seconds, got %v", key, value)
+	}
+	if seconds == 0 {
+		return def, nil
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// parseNonNegativeInt reads an option given as a non-negative integer. Config
+// files decode integers as int64, and may give them as floating point values
+// with no fractional part. Missing values return def; negative or fractional
+// values and other types are errors.
+func parseNonNegativeInt(config map[string]interface{}, key string, def int) (int, error) {
+	value, ok := config[key]
+	if !ok || value == nil {
+		return def, nil
+	}
+
+	var n int64
+	switch v := value.(type) {
+	case int:
+		n = int64(v)
+	case int64:
+		n = v
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v > math.MaxInt64 {
+			return 0, fmt.Errorf("%s must be an integer, got %v", key, value)
+		}
+		n = int64(v)
+	default:
+		return 0, fmt.Errorf("%s must be an integer, got %T", key, value)
+	}
+
+	if n < 0 || n > math.MaxInt32 {
+		return 0, fmt.Errorf("%s must be a non-negative integer, got %v", key, value)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,127 @@
+package switchdrivers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]interface{}
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name:   "missing",
+			config: map[string]interface{}{},
+			want:   DefaultTimeout,
+		},
+		{
+			name:   "nil",
+			config: map[string]interface{}{"timeout": nil},
+			want:   DefaultTimeout,
+		},
+		{
+			name:   "zero",
+			config: map[string]interface{}{"timeout": 0},
+			want:   DefaultTimeout,
+		},
+		{
+			name:   "int",
+			config: map[string]interface{}{"timeout": 10},
+			want:   10 * time.Second,
+		},
+		{
+			// TOML integers are decoded as int64
+			name:   "int64",
+			config: map[string]interface{}{"timeout": int64(3)},
+			want:   3 * time.Second,
+		},
+		{
+			name:   "float",
+			config: map[string]interface{}{"timeout": 1.5},
+			want:   1500 * time.Millisecond,
+		},
+		{
+			name:    "negative",
+			config:  map[string]interface{}{"timeout": -1},
+			wantErr: true,
+		},
+		{
+			name:    "string",
+			config:  map[string]interface{}{"timeout": "5"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTimeout(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimeout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNonNegativeInt(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]interface{}
+		want    int
+		wantErr bool
+	}{
+		{
+			name:   "missing",
+			config: map[string]interface{}{},
+			want:   7,
+		},
+		{
+			name:   "int",
+			config: map[string]interface{}{"count": 2},
+			want:   2,
+		},
+		{
+			// TOML integers are decoded as int64
+			name:   "int64",
+			config: map[string]interface{}{"count": int64(3)},
+			want:   3,
+		},
+		{
+			name:   "integral float",
+			config: map[string]interface{}{"count": 4.0},
+			want:   4,
+		},
+		{
+			name:    "fractional float",
+			config:  map[string]interface{}{"count": 1.5},
+			wantErr: true,
+		},
+		{
+			name:    "negative",
+			config:  map[string]interface{}{"count": int64(-1)},
+			wantErr: true,
+		},
+		{
+			name:    "string",
+			config:  map[string]interface{}{"count": "5"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNonNegativeInt(tt.config, "count", 7)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseNonNegativeInt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseNonNegativeInt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,3 +6,9 @@ import "errors"
 var (
 	ErrServerShutdownFailed = errors.New("UI server shutdown failed")
 )
+
+// Configuration errors
+var (
+	ErrInvalidAPIBaseURL = errors.New("invalid api-base-url")
+	ErrInvalidGroupBy    = errors.New("invalid group-by")
+)
@@ -22,6 +22,16 @@ func (h *UIHandler) Start(config cli.Configurable) error {
 		return fmt.Errorf("invalid config type for UI server")
 	}
 
+	if err := validateGroupBy(cfg.GroupBy); err != nil {
+		return err
+	}
+
+	if cfg.ProxyAPI {
+		if _, err := parseAPIBaseURL(cfg.APIBaseURL); err != nil {
+			return err
+		}
+	}
+
 	srv := NewUIServer(cfg)
 	return httpserver.StartFromConfig(cfg, srv)
 }
@@ -31,6 +41,11 @@ func (c *Config) GetListenAddress() string {
 	return c.ListenAddress
 }
 
+// GetListenAddresses implements httpserver.Config interface
+func (c *Config) GetListenAddresses() []string {
+	return c.ListenAddresses
+}
+
 // GetListenPort implements httpserver.Config interface
 func (c *Config) GetListenPort() int {
 	return c.ListenPort
@@ -1,29 +1,36 @@
 package ui
 
 import (
-	"context"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
-	"time"
+	"net/http/httputil"
+	"net/url"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/larsks/airdancer/internal/config"
+	"github.com/larsks/airdancer/internal/httpserver"
 	"github.com/larsks/airdancer/internal/static"
 	"github.com/spf13/pflag"
 )
 
 // Config holds the configuration for the UI server.
 type Config struct {
-	ListenAddress string `mapstructure:"listen-address"`
-	ListenPort    int    `mapstructure:"listen-port"`
-	ConfigFile    string `mapstructure:"config-file"`
-	APIBaseURL    string `mapstructure:"api-base-url"`
+	ListenAddress   string   `mapstructure:"listen-address"`
+	ListenAddresses []string `mapstructure:"listen-addresses"`
+	ListenPort      int      `mapstructure:"listen-port"`
+	ConfigFile      string   `mapstructure:"config-file"`
+	APIBaseURL      string   `mapstructure:"api-base-url"`
+	// ProxyAPI serves the API under /api on the UI server, so that the
+	// browser never talks to the API server directly
+	ProxyAPI bool `mapstructure:"proxy-api"`
+	// GroupBy groups switches into sections by "collection" or "tag". It
+	// is empty for a flat list.
+	GroupBy string `mapstructure:"group-by"`
+	Strict  bool   `mapstructure:"strict"`
 }
 
 // NewConfig creates a new Config instance with default values.
@@ -39,8 +46,12 @@ func NewConfig() *Config {
 func (c *Config) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&c.ConfigFile, "config", "", "Config file to use")
 	fs.StringVar(&c.ListenAddress, "listen-address", c.ListenAddress, "Listen address for UI server")
+	fs.StringSliceVar(&c.ListenAddresses, "listen-addresses", c.ListenAddresses, "Listen addresses for UI server (instead of --listen-address)")
 	fs.IntVar(&c.ListenPort, "listen-port", c.ListenPort, "Listen port for UI server")
 	fs.StringVar(&c.APIBaseURL, "api-base-url", c.APIBaseURL, "Base URL for the API server")
+	fs.BoolVar(&c.ProxyAPI, "proxy-api", c.ProxyAPI, "Forward requests for /api to the API server instead of having the browser contact it directly")
+	fs.StringVar(&c.GroupBy, "group-by", c.GroupBy, "Group switches into sections by \"collection\" or \"tag\"")
+	fs.BoolVar(&c.Strict, "strict", c.Strict, "Fail if the config file contains unknown settings")
 }
 
 // LoadConfig loads the configuration from a file and binds it to the Config struct.
@@ -52,35 +63,90 @@ func (c *Config) LoadConfig() error {
 func (c *Config) LoadConfigWithFlagSet(fs *pflag.FlagSet) error {
 	loader := config.NewConfigLoader()
 	loader.SetConfigFile(c.ConfigFile)
+	loader.SetStrictModeKey("strict")
 
 	// Set default values
 	loader.SetDefaults(map[string]any{
-		"listen-address": "",
-		"listen-port":    8081,
-		"api-base-url":   "http://localhost:8080",
+		"listen-address":   "",
+		"listen-addresses": []string{},
+		"listen-port":      8081,
+		"api-base-url":     "http://localhost:8080",
+		"proxy-api":        false,
+		"group-by":         "",
+		"strict":           false,
 	})
 
 	return loader.LoadConfigWithFlagSet(c, fs)
 }
 
+// apiProxyPath is the path under which the API is served when ProxyAPI is
+// set
+const apiProxyPath = "/api"
+
+// parseAPIBaseURL parses the API base URL, which must be an absolute http
+// or https URL
+func parseAPIBaseURL(apiBaseURL string) (*url.URL, error) {
+	target, err := url.Parse(apiBaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAPIBaseURL, err)
+	}
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("%w: %q is not an http or https URL", ErrInvalidAPIBaseURL, apiBaseURL)
+	}
+	return target, nil
+}
+
+// validateGroupBy checks that groupBy is a grouping the UI supports
+func validateGroupBy(groupBy string) error {
+	switch groupBy {
+	case "", "collection", "tag":
+		return nil
+	}
+	return fmt.Errorf("%w: %q (must be \"collection\" or \"tag\")", ErrInvalidGroupBy, groupBy)
+}
+
 type UIServer struct {
-	listenAddr string
+	config     *Config
 	apiBaseURL string
+	apiProxy   http.Handler
 	router     *chi.Mux
 }
 
-// NewUIServer creates a new UI server instance.
+// NewUIServer creates a new UI server instance. If cfg.ProxyAPI is set,
+// the page is told to use the API through the UI server.
 func NewUIServer(cfg *Config) *UIServer {
 	ui := &UIServer{
-		listenAddr: fmt.Sprintf("%s:%d", cfg.ListenAddress, cfg.ListenPort),
+		config:     cfg,
 		apiBaseURL: cfg.APIBaseURL,
 		router:     chi.NewRouter(),
 	}
 
+	if cfg.ProxyAPI {
+		if target, err := parseAPIBaseURL(cfg.APIBaseURL); err != nil {
+			log.Printf("not proxying API requests: %v", err)
+		} else {
+			ui.apiProxy = newAPIProxy(target)
+			ui.apiBaseURL = apiProxyPath
+		}
+	}
+
 	ui.setupRoutes()
 	return ui
 }
 
+// newAPIProxy returns a handler that forwards requests to the API server at
+// target. The method, body, and response status are passed through
+// unchanged.
+func newAPIProxy(target *url.URL) http.Handler {
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded()
+		},
+	}
+	return http.StripPrefix(apiProxyPath, proxy)
+}
+
 func (ui *UIServer) setupRoutes() {
 	ui.router.Use(middleware.Logger)
 	ui.router.Use(middleware.Recoverer)
@@ -90,6 +156,11 @@ func (ui *UIServer) setupRoutes() {
 
 	// Serve static assets from the shared static package
 	ui.router.Handle("/static/*", http.StripPrefix("/static/", http.FileServer(http.FS(static.GetAssets()))))
+
+	// Forward API requests to the API server
+	if ui.apiProxy != nil {
+		ui.router.Handle(apiProxyPath+"/*", ui.apiProxy)
+	}
 }
 
 func (ui *UIServer) indexHandler(w http.ResponseWriter, r *http.Request) {
@@ -107,6 +178,13 @@ func (ui *UIServer) indexHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The page's groupBy query parameter takes precedence over this
+	defaultGroupBy, err := json.Marshal(ui.config.GroupBy)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode group-by: %v", err), http.StatusInternalServerError)
+		return
+	}
+
 	// Prepare template data
 	data := static.TemplateData{
 		Title:         "Airdancer Switch Control",
@@ -115,13 +193,15 @@ func (ui *UIServer) indexHandler(w http.ResponseWriter, r *http.Request) {
 		ExtraJS: template.HTML(fmt.Sprintf(`
 			<script>
 				%s
+
+				SwitchController.defaultGroupBy = %s;
 				
 				// Initialize the switch controller when the page loads
 				document.addEventListener('DOMContentLoaded', () => {
 					new SwitchController('%s');
 				});
 			</script>
-		`, switchControllerJS, ui.apiBaseURL)),
+		`, switchControllerJS, defaultGroupBy, ui.apiBaseURL)),
 	}
 
 	// Render the template
@@ -146,33 +226,6 @@ func (ui *UIServer) Handler() http.Handler {
 
 // Start starts the UI server.
 func (ui *UIServer) Start() error {
-	srv := &http.Server{
-		Addr:    ui.listenAddr,
-		Handler: ui.router,
-	}
-
-	go func() {
-		log.Printf("starting UI server on %s", ui.listenAddr)
-		log.Printf("API URL: %s", ui.apiBaseURL)
-		log.Printf("open http://localhost%s in your browser", ui.listenAddr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("UI server failed: %v", err)
-		}
-	}()
-
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-	<-stop
-
-	log.Println("Shutting down UI server...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := srv.Shutdown(ctx); err != nil {
-		return fmt.Errorf("%w: %v", ErrServerShutdownFailed, err)
-	}
-
-	log.Println("UI server gracefully stopped")
-	return nil
+	log.Printf("API URL: %s", ui.config.APIBaseURL)
+	return httpserver.StartFromConfig(ui.config, ui.router)
 }
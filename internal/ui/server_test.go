@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -73,3 +75,102 @@ func TestStaticFileServing(t *testing.T) {
 		t.Errorf("expected status %d for non-existent static file, got %d", http.StatusNotFound, w.Code)
 	}
 }
+
+func TestAPIProxy(t *testing.T) {
+	type received struct {
+		method string
+		path   string
+		body   string
+	}
+	requests := make(chan received, 1)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{method: r.Method, path: r.URL.Path, body: string(body)}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"status":"error"}`)) //nolint:errcheck
+	}))
+	defer api.Close()
+
+	server := NewUIServer(&Config{
+		APIBaseURL: api.URL + "/v1",
+		ProxyAPI:   true,
+	})
+
+	req := httptest.NewRequest("POST", "/api/switch/lamp", strings.NewReader(`{"state":"on"}`))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	select {
+	case got := <-requests:
+		want := received{method: "POST", path: "/v1/switch/lamp", body: `{"state":"on"}`}
+		if got != want {
+			t.Errorf("API received %+v, want %+v", got, want)
+		}
+	default:
+		t.Fatal("proxied request did not reach the API server")
+	}
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected proxied status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if body := w.Body.String(); body != `{"status":"error"}` {
+		t.Errorf("expected proxied body, got %q", body)
+	}
+
+	// The page uses the proxy rather than the API server's address
+	req = httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	body := w.Body.String()
+	if strings.Contains(body, api.URL) {
+		t.Error("API URL was exposed in the HTML even though the API is proxied")
+	}
+	if !strings.Contains(body, "new SwitchController('/api')") {
+		t.Error("HTML does not direct the switch controller to the proxy")
+	}
+}
+
+func TestAPIProxyDisabled(t *testing.T) {
+	server := NewUIServer(&Config{APIBaseURL: "http://localhost:8080"})
+
+	req := httptest.NewRequest("GET", "/api/switch/all", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d without proxy-api, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestParseAPIBaseURL(t *testing.T) {
+	for _, apiBaseURL := range []string{"localhost:8080", "/api", "ftp://example.com", "http://%zz"} {
+		if _, err := parseAPIBaseURL(apiBaseURL); !errors.Is(err, ErrInvalidAPIBaseURL) {
+			t.Errorf("parseAPIBaseURL(%q) error = %v, want %v", apiBaseURL, err, ErrInvalidAPIBaseURL)
+		}
+	}
+	if _, err := parseAPIBaseURL("https://example.com/airdancer"); err != nil {
+		t.Errorf("parseAPIBaseURL() unexpected error: %v", err)
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	server := NewUIServer(&Config{APIBaseURL: "http://test-api:8080", GroupBy: "tag"})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if body := w.Body.String(); !strings.Contains(body, `SwitchController.defaultGroupBy = "tag";`) {
+		t.Error("group-by was not injected into the HTML")
+	}
+
+	for _, groupBy := range []string{"", "collection", "tag"} {
+		if err := validateGroupBy(groupBy); err != nil {
+			t.Errorf("validateGroupBy(%q) unexpected error: %v", groupBy, err)
+		}
+	}
+	if err := validateGroupBy("color"); !errors.Is(err, ErrInvalidGroupBy) {
+		t.Errorf("validateGroupBy(%q) error = %v, want %v", "color", err, ErrInvalidGroupBy)
+	}
+}
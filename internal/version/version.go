@@ -10,6 +10,23 @@ var (
 	BuildDate    = ""
 )
 
+// Info describes the build of the running program. HTTP servers return it
+// from their version endpoints.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+}
+
+// GetInfo returns the build information reported by ShowVersion
+func GetInfo() Info {
+	return Info{
+		Version:   BuildVersion,
+		Commit:    BuildRef,
+		BuildDate: BuildDate,
+	}
+}
+
 func ShowVersion() {
 	fmt.Printf("Version: %s\n", BuildVersion)
 	fmt.Printf("Build ref: %s\n", BuildRef)